@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"godsendjoseph.dev/sandbox-api/internal/configbackup"
+	"godsendjoseph.dev/sandbox-api/internal/env"
+	"godsendjoseph.dev/sandbox-api/internal/storage"
+)
+
+// backupKeyVar holds the encryption key. It is never part of a backup, keep it in the
+// password manager so a restore does not need anything from the lost machine.
+const backupKeyVar = "CONFIG_BACKUP_KEY"
+
+const usage = `usage: adminctl <command> [flags]
+
+commands:
+  config-keygen     print a new CONFIG_BACKUP_KEY
+  config-backup     upload the effective configuration as a new version
+  config-versions   list the stored versions
+  config-restore    decrypt a version into an env file
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	command, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch command {
+	case "config-keygen":
+		err = keygen()
+	case "config-backup":
+		err = backup(ctx, args)
+	case "config-versions":
+		err = versions(ctx, args)
+	case "config-restore":
+		err = restore(ctx, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("%s: %v", command, err)
+	}
+}
+
+func keygen() error {
+	key, err := configbackup.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(key)
+	return nil
+}
+
+// backup snapshots the variables of the env file. A variable also set in the process
+// environment is taken from there, which is the value the API actually runs with.
+func backup(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("config-backup", flag.ExitOnError)
+	envFile := flags.String("env", ".env", "env file listing the variables to back up")
+	note := flags.String("note", "", "free text stored in the manifest, e.g. why the backup was taken")
+	flags.Parse(args)
+
+	values, err := godotenv.Read(*envFile)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", *envFile, err)
+	}
+	for name := range values {
+		if value, ok := os.LookupEnv(name); ok {
+			values[name] = value
+		}
+	}
+	delete(values, backupKeyVar)
+
+	// the file also provides the storage credentials when they are not exported
+	_ = godotenv.Load(*envFile)
+
+	client, err := storageClient()
+	if err != nil {
+		return err
+	}
+
+	source, _ := os.Hostname()
+	manifest, err := configbackup.Backup(ctx, client, env.GetString(backupKeyVar, ""), values, source, *note, time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("stored version %s, %d variables, %d redacted in the manifest\n", manifest.Version, len(manifest.Values), len(manifest.Redacted))
+	return nil
+}
+
+func versions(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("config-versions", flag.ExitOnError)
+	flags.Parse(args)
+
+	client, err := storageClient()
+	if err != nil {
+		return err
+	}
+
+	list, err := configbackup.Versions(ctx, client)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return configbackup.ErrNoBackups
+	}
+
+	for _, version := range list {
+		manifest, err := configbackup.ReadManifest(ctx, client, version)
+		if err != nil {
+			fmt.Printf("%s  (unreadable manifest: %v)\n", version, err)
+			continue
+		}
+		fmt.Printf("%s  %-20s %3d variables  %s\n", version, manifest.Source, len(manifest.Values), manifest.Note)
+	}
+
+	return nil
+}
+
+// restore writes a version to a new file, it never overwrites the running .env by itself
+func restore(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("config-restore", flag.ExitOnError)
+	version := flags.String("version", "latest", "version to restore, see config-versions")
+	out := flags.String("out", ".env.restored", "file to write")
+	force := flags.Bool("force", false, "overwrite the output file when it exists")
+	flags.Parse(args)
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		return fmt.Errorf("%s already exists, pass -force to overwrite it", *out)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	client, err := storageClient()
+	if err != nil {
+		return err
+	}
+
+	values, manifest, err := configbackup.Restore(ctx, client, env.GetString(backupKeyVar, ""), *version)
+	if err != nil {
+		return err
+	}
+
+	content, err := godotenv.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(*out, []byte(content+"\n"), 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("restored version %s from %s (%s) into %s\n", manifest.Version, manifest.Source, manifest.CreatedAt.Format(time.RFC3339), *out)
+	return nil
+}
+
+// storageClient connects to the bucket the API uses, backups are kept under their own prefix
+func storageClient() (storage.Client, error) {
+	return storage.New(storage.Config{
+		Driver:          env.GetString("STORAGE_DRIVER", storage.DriverR2),
+		Endpoint:        env.GetString("STORAGE_ENDPOINT", env.GetString("R2_ENDPOINT", "")),
+		Region:          env.GetString("STORAGE_REGION", ""),
+		AccessKeyID:     env.GetString("STORAGE_ACCESS_KEY_ID", env.GetString("R2_ACCESS_KEY_ID", "")),
+		SecretAccessKey: env.GetString("STORAGE_SECRET_ACCESS_KEY", env.GetString("R2_SECRET_ACCESS_KEY", "")),
+		Bucket:          env.GetString("STORAGE_BUCKET", env.GetString("R2_BUCKET_NAME", "")),
+		PublicURL:       env.GetString("STORAGE_PUBLIC_URL", env.GetString("R2_PUBLIC_URL", "")),
+	})
+}
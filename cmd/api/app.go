@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -13,47 +16,268 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/swaggo/swag/example/basic/docs"
+	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 
+	"godsendjoseph.dev/sandbox-api/docs"
 	"godsendjoseph.dev/sandbox-api/internal/auth"
+	"godsendjoseph.dev/sandbox-api/internal/captcha"
 	"godsendjoseph.dev/sandbox-api/internal/cron"
+	"godsendjoseph.dev/sandbox-api/internal/db"
+	"godsendjoseph.dev/sandbox-api/internal/events"
+	"godsendjoseph.dev/sandbox-api/internal/geoip"
+	"godsendjoseph.dev/sandbox-api/internal/ipaccess"
+	"godsendjoseph.dev/sandbox-api/internal/jobs"
 	"godsendjoseph.dev/sandbox-api/internal/mailer"
 	"godsendjoseph.dev/sandbox-api/internal/notification"
+	"godsendjoseph.dev/sandbox-api/internal/outbox"
 	ratelimiter "godsendjoseph.dev/sandbox-api/internal/rateLimiter"
+	"godsendjoseph.dev/sandbox-api/internal/readonly"
+	"godsendjoseph.dev/sandbox-api/internal/realtime"
 	"godsendjoseph.dev/sandbox-api/internal/storage"
 	"godsendjoseph.dev/sandbox-api/internal/store"
 	"godsendjoseph.dev/sandbox-api/internal/store/cache"
+	"godsendjoseph.dev/sandbox-api/internal/supportref"
+	"godsendjoseph.dev/sandbox-api/internal/webhook"
 )
 
 type application struct {
-	config        config
-	store         store.Storage
-	cacheStorage  cache.Storage
-	logger        *zap.SugaredLogger
-	mailer        mailer.Client
+	config config
+	db     *sql.DB
+	// replicas is nil without read replicas
+	replicas     *store.Replicas
+	queryMetrics *db.QueryMetrics
+	redisClient  *redis.Client
+	store        store.Storage
+	cacheStorage cache.Storage
+	logger       *zap.SugaredLogger
+	mailer       mailer.Client
+	// mailProvider is the provider behind the queue, used for the failover stats
+	mailProvider  mailer.Provider
 	authenticator auth.Authenticator
 	rateLimiter   ratelimiter.Limiter
+	// otpLimiter caps the OTP emails a single address receives, keyed by email
+	otpLimiter ratelimiter.Limiter
+	// contactLimiter caps the support requests per user or client address
+	contactLimiter ratelimiter.Limiter
+	// strictRateLimiter replaces rateLimiter for clients from GEOIP_STRICT_COUNTRIES
+	strictRateLimiter ratelimiter.Limiter
+	// concurrency counts the requests in flight and sheds the ones over its limits
+	concurrency *ratelimiter.ConcurrencyLimiter
+	// geoip is nil when no MaxMind database is configured, it then finds nothing
+	geoip *geoip.Reader
+	// ipAccess holds the IP allow and deny lists, the admin API edits their runtime rules
+	ipAccess *ipaccess.Checker
+	// captcha is nil when no CAPTCHA provider is configured
+	captcha       captcha.Verifier
 	scheduler     *cron.Scheduler
-	slackNotifier *notification.SlackNotifier
+	notifier      *notification.Fanout
 	storageClient storage.Client
+	supportEvents supportref.Store
+	// emailVerifications holds admin email list verification reports
+	emailVerifications *emailVerificationJobs
+	slo                *sloTracker
+	status             *statusMonitor
+	deprecationUsage   *deprecationUsage
+	webhooks           *webhook.Dispatcher
+	events             *events.Bus
+	jobs               *jobs.Pool
+	outbox             *outbox.Dispatcher
+	realtime           *realtime.Hub
+	// readOnly can be flipped at runtime through the admin API, on every instance
+	readOnly *readonly.Switch
 }
 
 // testing this
 
 type config struct {
-	addr        string
-	db          dbConfig
-	env         string
-	apiURL      string
-	mail        mailConfig
-	frontendURL string
-	auth        authConfig
-	redisCfg    redisConfig
-	rateLimiter ratelimiter.Config
-	timezone    string
-	slack       slackConfig
-	r2          r2Config
+	addr         string
+	db           dbConfig
+	env          string
+	apiURL       string
+	mail         mailConfig
+	frontendURL  string
+	auth         authConfig
+	redisCfg     redisConfig
+	rateLimiter  ratelimiter.Config
+	concurrency  concurrencyConfig
+	userDeletion userDeletionConfig
+	timezone     string
+	cronLocker   string
+	slack        slackConfig
+	notify       notifyConfig
+	fileStorage  storageConfig
+	sdkDir       string
+	readOnly     readOnlyConfig
+	gravatar     bool
+	slo          sloConfig
+	cache        cache.Config
+	cacheWarmup  cacheWarmupConfig
+	support      supportConfig
+	captcha      captchaConfig
+	geoip        geoipConfig
+	ipAccess     ipAccessConfig
+	snapshot     snapshotConfig
+	digest       digestConfig
+	events       eventsConfig
+	jobs         jobsConfig
+	realtime     realtimeConfig
+	password     passwordConfig
+	body         bodyConfig
+	verification verificationConfig
+	campaigns    campaignConfig
+	cors         corsConfig
+	security     securityConfig
+}
+
+type securityConfig struct {
+	// hstsMaxAge 0 leaves out Strict-Transport-Security
+	hstsMaxAge     time.Duration
+	frameOptions   string
+	referrerPolicy string
+}
+
+type corsConfig struct {
+	// allowedOrigins are filled in by resolve when the env leaves them empty
+	allowedOrigins   []string
+	allowedMethods   []string
+	allowedHeaders   []string
+	allowCredentials bool
+	// maxAge is in seconds, 300 is the most every major browser honours
+	maxAge int
+}
+
+type campaignConfig struct {
+	// perMinute is how many campaign emails go to the mail queue each minute, 0 pauses campaigns
+	perMinute int
+}
+
+type verificationConfig struct {
+	// reminders turns on the job that reminds and eventually deletes unverified accounts
+	reminders   bool
+	remindAfter time.Duration
+	// deleteAfter 0 keeps unverified accounts forever
+	deleteAfter time.Duration
+	// otpExpiry is how long the code in a reminder stays valid
+	otpExpiry time.Duration
+}
+
+type bodyConfig struct {
+	// jsonLimit and uploadLimit cap request bodies in bytes, see largeBodyPaths
+	jsonLimit   int64
+	uploadLimit int64
+	// compressionLevel is the gzip/deflate level of responses, 0 turns compression off
+	compressionLevel int
+}
+
+type passwordConfig struct {
+	// minScore is the lowest auth.PasswordStrength score new passwords need
+	minScore int
+	// breachCheck rejects passwords found in the Have I Been Pwned corpus
+	breachCheck  bool
+	breachAPIURL string
+}
+
+type realtimeConfig struct {
+	// channel is the Redis pub/sub channel the instances share the pushed messages on
+	channel string
+}
+
+type jobsConfig struct {
+	// backend is one of the jobs.Backend* constants
+	backend     string
+	workerCount int
+	// queueSize caps the memory backend
+	queueSize   int
+	redisPrefix string
+}
+
+type eventsConfig struct {
+	// publisher is one of the events.Publisher* constants
+	publisher string
+	// stream is the Redis stream or the Kafka topic
+	stream string
+	group  string
+	// kafkaRESTURL is the Kafka REST Proxy the kafka publisher talks to
+	kafkaRESTURL string
+}
+
+type snapshotConfig struct {
+	enabled  bool
+	schedule string
+	// salt keys the email hashes, changing it breaks joins with older snapshots
+	salt string
+	// keep is how many snapshots stay in the bucket, 0 keeps all of them
+	keep int
+}
+
+type digestConfig struct {
+	enabled  bool
+	schedule string
+	// batchSize is how many users one read of their activity covers
+	batchSize int
+}
+
+type supportConfig struct {
+	// email receives new tickets, empty only notifies Slack
+	email string
+	// contactPerHour is how many tickets one user or client address may open per hour
+	contactPerHour int
+	// eventTTL is how long a failed request can be looked up by its support reference
+	eventTTL time.Duration
+}
+
+// geoipConfig points at the MaxMind databases. Requests from blockedCountries are refused,
+// the ones from strictCountries are rate limited to strictRequestCount per window instead.
+type geoipConfig struct {
+	countryDB          string
+	asnDB              string
+	blockedCountries   []string
+	strictCountries    []string
+	strictRequestCount int
+}
+
+// concurrencyConfig caps the requests in flight on one instance, 0 lifts a cap. Shed requests
+// are told to retry after retryAfter.
+type concurrencyConfig struct {
+	maxInFlight int
+	perUser     int
+	retryAfter  time.Duration
+}
+
+// ipAccessConfig holds the networks of the IP lists that come from the environment. Only
+// adminAllowlist may reach the admin routes when it or its runtime rules are not empty,
+// denylist is refused everywhere. Forwarded client addresses are only believed from
+// trustedProxies.
+type ipAccessConfig struct {
+	adminAllowlist []string
+	denylist       []string
+	trustedProxies []netip.Prefix
+}
+
+// captchaConfig is the CAPTCHA anonymous support requests need. With auth on, registering
+// and requesting a password reset need one as well.
+type captchaConfig struct {
+	provider string
+	secret   string
+	auth     bool
+}
+
+type cacheWarmupConfig struct {
+	enabled bool
+	timeout time.Duration
+}
+
+type sloConfig struct {
+	// objectives is a parseSLOObjectives spec, see SLO_OBJECTIVES in .env.example
+	objectives    string
+	burnRateAlert float64
+}
+
+type readOnlyConfig struct {
+	enabled bool
+	// allowlist holds paths that stay writable in read-only mode
+	allowlist []string
 }
 
 type redisConfig struct {
@@ -63,18 +287,55 @@ type redisConfig struct {
 	enabled bool
 }
 
-type r2Config struct {
-	endpoint        string
-	accessKeyID     string
-	secretAccessKey string
-	bucketName      string
-	publicURL       string
-	enabled         bool
+type userDeletionConfig struct {
+	posts      string
+	reparentTo int64
+}
+
+type storageConfig struct {
+	client  storage.Config
+	enabled bool
+	// cleanupDryRun makes the orphan cleanup log the objects it would delete
+	cleanupDryRun bool
 }
 
 type authConfig struct {
-	basic basicConfig
-	token tokenConfig
+	basic      basicConfig
+	token      tokenConfig
+	cookie     cookieConfig
+	invitation invitationConfig
+	newDevice  newDeviceConfig
+}
+
+// newDeviceConfig is what happens when a user signs in from an IP and user agent they never
+// used before. reportExp is how long the "this wasn't me" link of the email works.
+type newDeviceConfig struct {
+	email     bool
+	alert     bool
+	reportExp time.Duration
+}
+
+// invitationConfig is how long invitations stay open and the secret their tokens are
+// signed with, TOKEN_SECRET when it is empty
+type invitationConfig struct {
+	exp    time.Duration
+	secret string
+}
+
+// cookieConfig is the cookie auth mode for browser clients, the token is also set in an
+// HttpOnly cookie and mutating requests need the double-submit CSRF token
+type cookieConfig struct {
+	enabled  bool
+	name     string
+	csrfName string
+	domain   string
+	// only leaves the token out of response bodies, so scripts never see it
+	only bool
+	// sameSite is lax, strict or none, resolve turns it into sameSiteMode
+	sameSite     string
+	sameSiteMode http.SameSite
+	// secure is forced on in production
+	secure bool
 }
 
 type basicConfig struct {
@@ -87,6 +348,15 @@ type tokenConfig struct {
 	audience string
 	issuer   string
 	exp      time.Duration
+	// keysDir switches from the HMAC secret to the RSA/ECDSA keys in it
+	keysDir     string
+	activeKeyID string
+	// roleExp overrides exp for the named roles, e.g. a shorter lifetime for admins
+	roleExp map[string]time.Duration
+	// maxSession caps how long refreshing can keep a login alive
+	maxSession time.Duration
+	// impersonationExp is the lifetime of the tokens admins mint to act as a user
+	impersonationExp time.Duration
 }
 
 type dbConfig struct {
@@ -97,15 +367,31 @@ type dbConfig struct {
 	maxOpenConns int
 	maxIdleConns int
 	maxIdleTime  string
+	// migrateOnStart applies the pending migrations at startup, a dirty version is refused either way
+	migrateOnStart bool
+	// replicaAddrs are the read replicas, host:port, that take the hot reads off the primary
+	replicaAddrs         []string
+	replicaUser          string
+	replicaPassword      string
+	replicaCheckInterval time.Duration
+	// slowQueryThreshold is the duration above which a query is logged, 0 turns it off
+	slowQueryThreshold time.Duration
+	// statementCache is how many prepared statements each connection keeps
+	statementCache int
 }
 
 type mailConfig struct {
-	mailerType  string
-	httpMail    httpMailConfig
-	smtpMail    smtpMailConfig
-	workerCount int
-	queueSize   int
-	exp         time.Duration
+	driver   string
+	httpMail httpMailConfig
+	smtpMail smtpMailConfig
+	sesMail  sesMailConfig
+	// otpPerHour is how many OTP emails one address can receive per hour
+	otpPerHour int
+	// failoverThreshold and failoverCooldown apply when driver lists several drivers
+	failoverThreshold int
+	failoverCooldown  time.Duration
+	// scheduledPerMinute is how many scheduled emails go to the mail queue each minute once due
+	scheduledPerMinute int
 }
 
 type httpMailConfig struct {
@@ -114,14 +400,26 @@ type httpMailConfig struct {
 	mailFromName    string
 }
 
+type sesMailConfig struct {
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	mailFromAddress string
+	mailFromName    string
+}
+
 type smtpMailConfig struct {
 	mailHost        string
 	mailPort        string
 	mailUsername    string
 	mailPassword    string
 	mailEncryption  string
+	tlsVerify       bool
+	tlsCAFile       string
 	mailFromAddress string
 	mailFromName    string
+	poolSize        int
+	idleTimeout     time.Duration
 }
 
 type slackConfig struct {
@@ -130,6 +428,20 @@ type slackConfig struct {
 	username   string
 	iconEmoji  string
 	enabled    bool
+	// routes is a notification.ParseRoutes spec, see SLACK_ROUTES in .env.example
+	routes string
+}
+
+// notifyConfig holds the services notified next to Slack, each is enabled by its URL.
+// The min severities are notification.ParseSeverity names.
+type notifyConfig struct {
+	discordWebhookURL  string
+	discordMinSeverity string
+	teamsWebhookURL    string
+	teamsMinSeverity   string
+	webhookURL         string
+	webhookSecret      string
+	webhookMinSeverity string
 }
 
 type contextKey string
@@ -139,25 +451,32 @@ func (app *application) mount() http.Handler {
 
 	// middleware
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	router.Use(app.SupportRefMiddleware)
+	router.Use(app.RequestLoggerMiddleware)
+	router.Use(app.LocaleMiddleware)
+	router.Use(app.VersionNegotiationMiddleware)
+	router.Use(app.RealIPMiddleware)
 	router.Use(middleware.Logger)
+	router.Use(app.MetricsMiddleware)
 	router.Use(middleware.Recoverer)
+	if app.config.body.compressionLevel > 0 {
+		router.Use(middleware.Compress(app.config.body.compressionLevel, compressibleTypes...))
+	}
 
 	// cors
-	router.Use(cors.Handler(cors.Options{
-		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
-		AllowedOrigins: []string{"https://*", "http://*", "http://localhost:*"},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300, // Maximum value not ignored by any of major browsers
-	}))
+	router.Use(cors.Handler(app.config.cors.options()))
+	router.Use(app.SecurityHeadersMiddleware)
+	router.Use(app.CSRFMiddleware)
 
+	// refused clients do not count against the rate limits
+	router.Use(app.IPDenyMiddleware)
+	router.Use(app.GeoBlockMiddleware)
 	router.Use(app.RateLimiterMiddleware)
+	router.Use(app.ConcurrencyMiddleware)
+	router.Use(app.ReadOnlyMiddleware)
+	router.Use(app.BodyMiddleware)
 
-	router.Use(middleware.Timeout(60 * time.Second))
+	router.Use(app.TimeoutMiddleware(60 * time.Second))
 
 	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		app.notFoundResponse(w, r, errors.New("route not found"))
@@ -188,8 +507,11 @@ func (app *application) mount() http.Handler {
 func (app *application) run(mux http.Handler) error {
 	// Docs
 	docs.SwaggerInfo.Version = version
-	docs.SwaggerInfo.Host = app.config.apiURL
 	docs.SwaggerInfo.BasePath = "/v1"
+	if external, err := url.Parse(app.config.apiURL); err == nil {
+		docs.SwaggerInfo.Host = external.Host
+		docs.SwaggerInfo.Schemes = []string{external.Scheme}
+	}
 
 	server := &http.Server{
 		Addr:         app.config.addr,
@@ -198,6 +520,7 @@ func (app *application) run(mux http.Handler) error {
 		ReadTimeout:  time.Second * 10,
 		IdleTimeout:  time.Minute,
 	}
+	server.RegisterOnShutdown(app.realtime.Disconnect)
 
 	shutdown := make(chan error)
 
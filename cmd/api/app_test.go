@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"godsendjoseph.dev/sandbox-api/internal/auth"
+	"godsendjoseph.dev/sandbox-api/internal/events"
+	"godsendjoseph.dev/sandbox-api/internal/ipaccess"
+	"godsendjoseph.dev/sandbox-api/internal/mocks"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/outbox"
+	ratelimiter "godsendjoseph.dev/sandbox-api/internal/rateLimiter"
+	"godsendjoseph.dev/sandbox-api/internal/readonly"
+	"godsendjoseph.dev/sandbox-api/internal/realtime"
+	"godsendjoseph.dev/sandbox-api/internal/supportref"
+	"godsendjoseph.dev/sandbox-api/internal/webhook"
+)
+
+// newTestApplication returns an application on the fakes of internal/mocks, without
+// rate limits, CAPTCHA, Geo-IP or object storage. Every call starts from empty stores.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	logger := zap.NewNop().Sugar()
+	storage := mocks.NewStorage()
+
+	ipAccess, err := ipaccess.NewChecker(ipaccess.NewMemoryStore(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{
+		env: "test",
+		auth: authConfig{
+			token: tokenConfig{
+				secret:     "test-secret",
+				audience:   "sandbox-api",
+				issuer:     "sandbox-api",
+				exp:        time.Hour,
+				maxSession: 24 * time.Hour,
+			},
+		},
+		body: bodyConfig{jsonLimit: 1 << 20, uploadLimit: 10 << 20},
+	}
+
+	return &application{
+		config:           cfg,
+		store:            storage,
+		cacheStorage:     mocks.NewCache(),
+		logger:           logger,
+		mailer:           mocks.NewMailer(),
+		authenticator:    auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.audience, cfg.auth.token.issuer),
+		concurrency:      ratelimiter.NewConcurrencyLimiter(0, 0),
+		ipAccess:         ipAccess,
+		readOnly:         readonly.NewSwitch(readonly.NewMemoryStore(), false),
+		supportEvents:    supportref.NewMemoryStore(supportEventLimit),
+		slo:              newSLOTracker(nil, 0),
+		status:           newStatusMonitor(),
+		deprecationUsage: newDeprecationUsage(),
+		webhooks:         webhook.NewDispatcher(storage.Webhooks, logger),
+		events:           events.NewBus(events.NewInProcessPublisher(100), logger),
+		outbox:           outbox.NewDispatcher(storage.Outbox, logger),
+		realtime:         realtime.NewHub(nil, logger),
+	}
+}
+
+// do sends a request with body encoded as JSON through the routes of app and decodes
+// the response envelope, token is sent as the bearer token when set
+func do(t *testing.T, app *application, method, path string, body any, token string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&encoded).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := httptest.NewRequest(method, path, &encoded)
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	app.mount().ServeHTTP(recorder, request)
+
+	var envelope map[string]any
+	if recorder.Body.Len() > 0 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("%s %s: response is not JSON: %v\n%s", method, path, err, recorder.Body.String())
+		}
+	}
+
+	return recorder, envelope
+}
+
+// testPassword passes the password policy and is not in the breach corpus
+const testPassword = "Quiet-Harbor-Lantern-42"
+
+// createTestUser stores a user with testPassword, verified when active is set
+func createTestUser(t *testing.T, app *application, username, email string, active bool) *models.User {
+	t.Helper()
+
+	user := &models.User{
+		FirstName: "Test",
+		LastName:  "User",
+		Username:  username,
+		Email:     email,
+		IsActive:  active,
+		Role:      models.Role{Name: "user"},
+	}
+	if err := user.Password.Set(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Users.CreateUserTx(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+var (
+	errUnknownRole   = errors.New("role does not exist")
+	errChangeOwnRole = errors.New("you cannot change your own role")
+)
+
+type ChangeRolePayload struct {
+	Role string `json:"role" validate:"required,max=50"`
+}
+
+// audit records a security-relevant action on the account userID, 0 when there is none.
+// The action already happened, so a failure to record it is logged and not returned.
+func (app *application) audit(request *http.Request, action string, userID int64, metadata map[string]any) {
+	log := app.auditEntry(request, action, userID, metadata)
+
+	// a client hanging up must not lose the record of what it already did
+	ctx := context.WithoutCancel(request.Context())
+	if err := app.store.AuditLogs.Create(ctx, log); err != nil {
+		app.loggerFor(request).Errorw("error recording audit log", "action", action, "userID", userID, "error", err)
+	}
+}
+
+// auditEntry builds the entry audit records, for callers that write it in their own
+// transaction
+func (app *application) auditEntry(request *http.Request, action string, userID int64, metadata map[string]any) *models.AuditLog {
+	log := &models.AuditLog{
+		Action:    action,
+		IP:        clientIP(request),
+		UserAgent: request.UserAgent(),
+	}
+	if userID != 0 {
+		log.UserID = &userID
+	}
+
+	// where the client is registered, a copy so the caller's map is left alone
+	if location := app.geoip.Lookup(log.IP); !location.Empty() {
+		metadata = maps.Clone(metadata)
+		if metadata == nil {
+			metadata = map[string]any{}
+		}
+		if location.Country != "" {
+			metadata["country"] = location.Country
+		}
+		if location.ASN != 0 {
+			metadata["asn"] = location.Network()
+		}
+	}
+
+	if len(metadata) > 0 {
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			app.loggerFor(request).Errorw("error encoding audit metadata", "action", action, "error", err)
+		} else {
+			log.Metadata = encoded
+		}
+	}
+
+	return log
+}
+
+// listAuditLogsHandler pages through the audit trail, filtered by user_id, action and a
+// since/until time range
+//
+// @Summary  List the audit trail
+// @Tags     admin
+// @Produce  json
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Param    sort query string false "created_at for oldest first, -created_at (default) for newest first"
+// @Param    user_id query int false "User ID"
+// @Param    action query string false "Action"
+// @Param    since query string false "RFC 3339 time"
+// @Param    until query string false "RFC 3339 time"
+// @Success  200 {object} Response[List[models.AuditLog]]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/audit [get]
+func (app *application) listAuditLogsHandler(writer http.ResponseWriter, request *http.Request) {
+	params, offset, err := parseOffsetPage(request, createdAtPage(50))
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.AuditLogQuery{
+		Limit:  params.Limit,
+		Offset: offset,
+		Sort:   params.Sort.Direction(),
+	}
+
+	query, err = query.Parse(request)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	logs, err := app.store.AuditLogs.List(request.Context(), query)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	page := pagination.OffsetPage(query.Limit, query.Offset, len(logs))
+
+	if err := writeList(writer, request, "Audit logs retrieved", logs, page); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// changeUserRoleHandler gives another user a different role
+//
+// @Summary  Change the role of a user
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    userID path int true "User ID"
+// @Param    payload body ChangeRolePayload true "Request body"
+// @Success  200 {object} Response[models.User]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/users/{userID}/role [put]
+func (app *application) changeUserRoleHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload ChangeRolePayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := request.Context()
+	admin := getUserFromCtx(request)
+	user := getUserParamFromCtx(request)
+
+	// an admin demoting themselves could leave no one able to undo it
+	if user.ID == admin.ID {
+		app.unprocessableEntityResponse(writer, request, errChangeOwnRole)
+		return
+	}
+
+	role, err := app.store.Roles.GetByName(ctx, payload.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unprocessableEntityResponse(writer, request, errUnknownRole)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	previous := user.Role.Name
+	if err := app.store.Users.UpdateRole(ctx, user.ID, role.ID); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+	app.evictCachedUser(request, user.ID)
+
+	app.audit(request, models.AuditRoleChange, user.ID, map[string]any{"from": previous, "to": role.Name})
+
+	user.RoleID, user.Role = role.ID, *role
+	if err := writeJSON(writer, request, http.StatusOK, "Role changed", user); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
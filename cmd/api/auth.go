@@ -1,37 +1,60 @@
 package main
 
 import (
-	"crypto/rand"
+	"context"
 	"errors"
 	"fmt"
-	"math/big"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 
+	"godsendjoseph.dev/sandbox-api/internal/events"
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
 	"godsendjoseph.dev/sandbox-api/internal/mailer"
 	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/outbox"
 	"godsendjoseph.dev/sandbox-api/internal/store"
 )
 
+var (
+	errOTPExpired     = errors.New("OTP code has expired")
+	errSessionExpired = errors.New("session has expired, please log in again")
+)
+
 type RegisterUserPayload struct {
 	FirstName string `json:"first_name" validate:"required,max=100"`
 	LastName  string `json:"last_name" validate:"required,max=100"`
-	Username  string `json:"username" validate:"required,max=100"`
+	Username  string `json:"username" validate:"required,max=100,username"`
 	Email     string `json:"email" validate:"required,email,max=255"`
-	Password  string `json:"password" validate:"required,min=8,max=100"`
+	// Phone is optional, in E.164 format such as +14155552671
+	Phone    string `json:"phone" validate:"omitempty,e164"`
+	Password string `json:"password" validate:"required,min=8,max=100,password,notbreached"`
+	// InviteToken registers with the role of the invitation, the email must be the invited one
+	InviteToken string `json:"invite_token" validate:"max=255"`
+	// CaptchaToken is required with CAPTCHA_AUTH_ENABLED
+	CaptchaToken string `json:"captcha_token" validate:"max=4096"`
 }
 
 type LoginUserPayload struct {
 	Email    string `json:"email" validate:"required,email,max=255"`
 	Password string `json:"password" validate:"required,min=8,max=100"`
+	// TwoFactorCode is a TOTP or backup code, required once two-factor is enabled
+	TwoFactorCode string `json:"two_factor_code" validate:"max=20"`
 }
 
 type ResendOTPPayload struct {
 	Email string `json:"email" validate:"required,email,max=255"`
 }
 
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	// CaptchaToken is required with CAPTCHA_AUTH_ENABLED
+	CaptchaToken string `json:"captcha_token" validate:"max=4096"`
+}
+
 type VerifyEmailPayload struct {
 	Email   string `json:"email" validate:"required,email,max=255"`
 	OtpCode string `json:"otp_code" validate:"required,max=6"`
@@ -40,9 +63,33 @@ type VerifyEmailPayload struct {
 type ResetPasswordPayload struct {
 	Email       string `json:"email" validate:"required,email,max=255"`
 	OtpCode     string `json:"otp_code" validate:"required,max=6"`
-	NewPassword string `json:"new_password" validate:"required,min=8,max=100"`
+	NewPassword string `json:"new_password" validate:"required,min=8,max=100,password,notbreached"`
 }
 
+// CheckUsernameQuery is the username to check, sent as ?username= (?u= is deprecated)
+type CheckUsernameQuery struct {
+	Username string `json:"username" validate:"required,max=100,username"`
+}
+
+// UsernameAvailability says whether a username can be registered, and why not
+type UsernameAvailability struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// @Summary Register a user
+// @Tags    auth
+// @Accept  json
+// @Produce json
+// @Param   payload body RegisterUserPayload true "Request body"
+// @Success 200 {object} Response[Session]
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router  /auth/register [post]
 func (app *application) registerUserHandler(writer http.ResponseWriter, request *http.Request) {
 	var payload RegisterUserPayload
 
@@ -51,25 +98,34 @@ func (app *application) registerUserHandler(writer http.ResponseWriter, request
 		return
 	}
 
-	isPayloadValid := validatePayload(writer, payload)
+	isPayloadValid := validatePayload(writer, request, payload)
 	if !isPayloadValid {
 		return
 	}
 
-	otpCode, err := generateOTP()
-	if err != nil {
-		app.internalServerError(writer, request, err)
+	if !app.checkAuthCaptcha(writer, request, payload.CaptchaToken) {
 		return
 	}
-	otpCodeExpiring := time.Now().Add(5 * time.Minute)
 
+	ctx := request.Context()
+
+	var invitation *models.Invitation
+	if payload.InviteToken != "" {
+		var err error
+		invitation, err = app.invitationFromToken(ctx, payload.InviteToken)
+		if err != nil {
+			app.invitationErrorResponse(writer, request, err)
+			return
+		}
+	}
+
+	// the code to verify the email is generated when the outbox sends it
 	user := &models.User{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Username:  payload.Username,
 		Email:     payload.Email,
-		OtpCode:   otpCode,
-		OtpExp:    otpCodeExpiring.Format(time.RFC3339),
+		Phone:     payload.Phone,
 		Role: models.Role{
 			Name: "user",
 		},
@@ -81,32 +137,54 @@ func (app *application) registerUserHandler(writer http.ResponseWriter, request
 		return
 	}
 
-	ctx := request.Context()
-	// store the user
-	err = app.store.Users.CreateUserTx(ctx, user)
+	metadata := map[string]any{"username": user.Username}
+	if invitation != nil {
+		user.Role.Name = invitation.Role.Name
+		metadata["invitation_id"] = invitation.ID
+	}
+
+	// store the user, the start of its audit trail and the verification email, none exists
+	// without the others, nor without using up the invitation
+	err := app.store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := app.store.Users.CreateUserTx(ctx, user); err != nil {
+			return err
+		}
+		if invitation != nil {
+			if user.NormalizedEmail != invitation.NormalizedEmail {
+				return errInvitationInvalid
+			}
+			if err := app.store.Invitations.Accept(ctx, invitation.ID, user.ID); err != nil {
+				return err
+			}
+		}
+		if err := app.outbox.Add(ctx, outbox.VerificationEmail{UserID: user.ID, Email: user.Email, Locale: i18n.FromContext(ctx)}); err != nil {
+			return err
+		}
+		return app.store.AuditLogs.Create(ctx, app.auditEntry(request, models.AuditRegister, user.ID, metadata))
+	})
 	if err != nil {
 		switch err {
 		case store.ErrDuplicateEmail:
-			app.badRequestResponse(writer, request, err)
+			app.conflictResponse(writer, request, err)
 		case store.ErrDuplicateUsername:
-			app.badRequestResponse(writer, request, err)
+			app.conflictResponse(writer, request, err)
+		case errInvitationInvalid, store.ErrInvitationUsed:
+			app.invitationErrorResponse(writer, request, err)
 		default:
 			app.internalServerError(writer, request, err)
 		}
 		return
 	}
 
-	err = app.sendOTP(user, "Finish up your Registration", otpCode, otpCodeExpiring, mailer.UserWelcomeTemplate)
+	// the verification email went into the outbox with the user
+	app.outbox.Notify()
+
+	app.publishEvent(ctx, events.UserRegistered{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+	})
 
-	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
-		// rollback user creation if email fails (SAGA Pattern)
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
-		}
-		app.internalServerError(writer, request, err)
-		return
-	}
 	// generate the token -> add claims -> sign the token
 	token, err := app.generateJWTToken(user)
 	if err != nil {
@@ -114,17 +192,25 @@ func (app *application) registerUserHandler(writer http.ResponseWriter, request
 		return
 	}
 
-	var data = map[string]any{
-		"user":  user,
-		"token": token,
-	}
+	data := app.withSessionToken(writer, user, token, Session{User: user})
 
-	if err := writeJSON(writer, http.StatusOK, "User created", data); err != nil {
+	request = withViewer(request, user)
+	if err := writeJSON(writer, request, http.StatusOK, "User created", data); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 }
 
+// @Summary Log in
+// @Tags    auth
+// @Accept  json
+// @Produce json
+// @Param   payload body LoginUserPayload true "Request body"
+// @Success 200 {object} Response[Session]
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router  /auth/login [post]
 func (app *application) loginUserHandler(writer http.ResponseWriter, request *http.Request) {
 	// parse the json payload
 	var payload LoginUserPayload
@@ -134,18 +220,21 @@ func (app *application) loginUserHandler(writer http.ResponseWriter, request *ht
 		return
 	}
 
-	isPayloadValid := validatePayload(writer, payload)
+	isPayloadValid := validatePayload(writer, request, payload)
 	if !isPayloadValid {
 		return
 	}
 
-	// fetch the user (check if the user exists) from the payload
-	user, err := app.store.Users.GetByEmail(request.Context(), payload.Email, true)
+	// fetch the user (check if the user exists) from the payload, from the primary so a
+	// password just reset is already there
+	user, err := app.store.Users.GetByEmail(store.ContextWithPrimary(request.Context()), payload.Email, true)
 	if err != nil {
 		switch err {
 		case store.ErrNotFound:
+			app.audit(request, models.AuditLoginFailed, 0, map[string]any{"email": payload.Email, "reason": "unknown_email"})
 			app.unauthorizedErrorResponse(writer, request, err)
 		case store.ErrAccountNotVerified:
+			app.audit(request, models.AuditLoginFailed, 0, map[string]any{"email": payload.Email, "reason": "not_verified"})
 			app.unauthorizedErrorResponse(writer, request, err)
 		default:
 			app.internalServerError(writer, request, err)
@@ -156,10 +245,35 @@ func (app *application) loginUserHandler(writer http.ResponseWriter, request *ht
 	// compare the password
 	err = user.Password.Compare(payload.Password)
 	if err != nil {
+		app.audit(request, models.AuditLoginFailed, user.ID, map[string]any{"reason": "wrong_password"})
 		app.unauthorizedPwdErrorResponse(writer, request, err)
 		return
 	}
 
+	// no token is issued without the second factor
+	if user.TwoFactorEnabled() && !app.checkSecondFactor(writer, request, user, payload.TwoFactorCode) {
+		app.audit(request, models.AuditLoginFailed, user.ID, map[string]any{"reason": "two_factor"})
+		return
+	}
+
+	// logging in during the grace period cancels a pending account deletion
+	restored := false
+	if user.DeletedAt != nil {
+		if time.Since(*user.DeletedAt) > store.DeletedAccountGracePeriod {
+			app.audit(request, models.AuditLoginFailed, user.ID, map[string]any{"reason": "deleted"})
+			app.unauthorizedErrorResponse(writer, request, store.ErrNotFound)
+			return
+		}
+
+		if err := app.store.Users.Restore(request.Context(), user.ID); err != nil {
+			app.internalServerError(writer, request, err)
+			return
+		}
+		app.evictCachedUser(request, user.ID)
+		user.DeletedAt = nil
+		restored = true
+	}
+
 	// generate the token -> add claims -> sign the token
 	token, err := app.generateJWTToken(user)
 	if err != nil {
@@ -167,18 +281,30 @@ func (app *application) loginUserHandler(writer http.ResponseWriter, request *ht
 		return
 	}
 
-	var data = map[string]any{
-		"user":  user,
-		"token": token,
-	}
+	newDevice := app.recordDevice(request, user)
+
+	app.audit(request, models.AuditLogin, user.ID, map[string]any{"two_factor": user.TwoFactorEnabled(), "restored": restored, "new_device": newDevice})
+
+	data := app.withSessionToken(writer, user, token, Session{User: user})
 
 	// send back the token
-	if err := writeJSON(writer, http.StatusOK, "User authenticated", data); err != nil {
+	request = withViewer(request, user)
+	if err := writeJSON(writer, request, http.StatusOK, "User authenticated", data); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 }
 
+// @Summary Verify an email address with its OTP
+// @Tags    auth
+// @Accept  json
+// @Produce json
+// @Param   payload body VerifyEmailPayload true "Request body"
+// @Success 200 {object} Response[any]
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router  /auth/verify-email [post]
 func (app *application) verifyEmailHandler(writer http.ResponseWriter, request *http.Request) {
 	var payload VerifyEmailPayload
 
@@ -187,13 +313,14 @@ func (app *application) verifyEmailHandler(writer http.ResponseWriter, request *
 		return
 	}
 
-	isPayloadValid := validatePayload(writer, payload)
+	isPayloadValid := validatePayload(writer, request, payload)
 	if !isPayloadValid {
 		return
 	}
 
+	// the OTP was written moments ago, a replica may not have it yet
 	ctx := request.Context()
-	user, err := app.store.Users.GetByEmail(ctx, payload.Email, false)
+	user, err := app.store.Users.GetByEmail(store.ContextWithPrimary(ctx), payload.Email, false)
 
 	if err != nil {
 		switch err {
@@ -205,44 +332,65 @@ func (app *application) verifyEmailHandler(writer http.ResponseWriter, request *
 		return
 	}
 
-	if user.OtpCode != payload.OtpCode {
-		app.unauthorizedErrorResponse(writer, request, errors.New("invalid otp code"))
+	if !app.checkOTP(writer, request, user, payload.OtpCode) {
 		return
 	}
 
-	otpExp, err := time.Parse(time.RFC3339, user.OtpExp)
+	err = app.store.Users.VerifyEmail(ctx, user.ID, payload.OtpCode)
 	if err != nil {
-		app.internalServerError(writer, request, fmt.Errorf("invalid OTP expiration format: %w", err))
+		switch {
+		case errors.Is(err, store.ErrInvalidOTP):
+			app.unauthorizedErrorResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
 		return
 	}
 
-	if time.Now().After(otpExp) {
-		app.unauthorizedErrorResponse(writer, request, errors.New("OTP code has expired"))
-		return
-	}
+	app.evictCachedUser(request, user.ID)
 
-	err = app.store.Users.VerifyEmail(ctx, user.ID)
-	if err != nil {
-		app.internalServerError(writer, request, err)
-		return
-	}
+	app.publishEvent(ctx, events.UserVerified{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+	})
 
-	writeJSON(writer, http.StatusOK, "Email verified", user.OtpCode)
+	writeMessage(writer, request, http.StatusOK, "Email verified")
 }
 
+// @Summary Email an OTP to reset the password
+// @Tags    auth
+// @Accept  json
+// @Produce json
+// @Param   payload body ForgotPasswordPayload true "Request body"
+// @Success 200 {object} Response[any]
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router  /auth/forgot-password [post]
 func (app *application) forgotPasswordHandler(writer http.ResponseWriter, request *http.Request) {
-	var payload ResendOTPPayload
+	var payload ForgotPasswordPayload
 
 	if err := readJSON(writer, request, &payload); err != nil {
 		app.badRequestResponse(writer, request, err)
 		return
 	}
 
-	isPayloadValid := validatePayload(writer, payload)
+	isPayloadValid := validatePayload(writer, request, payload)
 	if !isPayloadValid {
 		return
 	}
 
+	if !app.checkAuthCaptcha(writer, request, payload.CaptchaToken) {
+		return
+	}
+
+	if !app.allowOTPEmail(writer, request, payload.Email) {
+		return
+	}
+
 	user, err := app.store.Users.GetByEmail(request.Context(), payload.Email, false)
 
 	if err != nil {
@@ -255,17 +403,17 @@ func (app *application) forgotPasswordHandler(writer http.ResponseWriter, reques
 		return
 	}
 
-	otpCode, err := generateOTP()
+	otpCode, err := models.GenerateOTP()
 	if err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 	otpCodeExpiring := time.Now().Add(5 * time.Minute)
 
-	err = app.sendOTP(user, "OTP Code", otpCode, otpCodeExpiring, mailer.UserWelcomeTemplate)
+	err = app.sendOTP(request.Context(), user, "OTP Code", otpCode, otpCodeExpiring, mailer.UserWelcomeTemplate, mailer.AsyncInMemory)
 
 	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
+		app.loggerFor(request).Errorw("error sending welcome email", "error", err)
 		app.internalServerError(writer, request, err)
 		return
 	}
@@ -277,12 +425,22 @@ func (app *application) forgotPasswordHandler(writer http.ResponseWriter, reques
 		return
 	}
 
-	if err := writeJSON(writer, http.StatusOK, "Email sent for password reset", nil); err != nil {
+	if err := writeMessage(writer, request, http.StatusOK, "Email sent for password reset"); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 }
 
+// @Summary Reset the password with an OTP
+// @Tags    auth
+// @Accept  json
+// @Produce json
+// @Param   payload body ResetPasswordPayload true "Request body"
+// @Success 200 {object} Response[any]
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router  /auth/reset-password [post]
 func (app *application) resetPasswordHandler(writer http.ResponseWriter, request *http.Request) {
 	var payload ResetPasswordPayload
 
@@ -291,12 +449,13 @@ func (app *application) resetPasswordHandler(writer http.ResponseWriter, request
 		return
 	}
 
-	isPayloadValid := validatePayload(writer, payload)
+	isPayloadValid := validatePayload(writer, request, payload)
 	if !isPayloadValid {
 		return
 	}
 
-	user, err := app.store.Users.GetByEmail(request.Context(), payload.Email, false)
+	// the OTP was written moments ago, a replica may not have it yet
+	user, err := app.store.Users.GetByEmail(store.ContextWithPrimary(request.Context()), payload.Email, false)
 
 	if err != nil {
 		switch {
@@ -308,19 +467,7 @@ func (app *application) resetPasswordHandler(writer http.ResponseWriter, request
 		return
 	}
 
-	if user.OtpCode != payload.OtpCode {
-		app.unauthorizedErrorResponse(writer, request, errors.New("invalid otp code"))
-		return
-	}
-
-	otpExp, err := time.Parse(time.RFC3339, user.OtpExp)
-	if err != nil {
-		app.internalServerError(writer, request, fmt.Errorf("invalid OTP expiration format: %w", err))
-		return
-	}
-
-	if time.Now().After(otpExp) {
-		app.unauthorizedErrorResponse(writer, request, errors.New("OTP code has expired"))
+	if !app.checkOTP(writer, request, user, payload.OtpCode) {
 		return
 	}
 
@@ -330,19 +477,41 @@ func (app *application) resetPasswordHandler(writer http.ResponseWriter, request
 		return
 	}
 
-	err = app.store.Users.ResetPassword(request.Context(), user)
+	// revokes every token issued before the reset, truncated like in changePasswordHandler
+	changedAt := time.Now().UTC().Truncate(time.Second)
+	user.PasswordChangedAt = &changedAt
+
+	err = app.store.Users.ResetPassword(request.Context(), user, payload.OtpCode)
 
 	if err != nil {
-		app.internalServerError(writer, request, err)
+		switch {
+		case errors.Is(err, store.ErrInvalidOTP):
+			app.unauthorizedErrorResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
 		return
 	}
 
-	if err := writeJSON(writer, http.StatusOK, "You have successfully reset your password", nil); err != nil {
+	app.evictCachedUser(request, user.ID)
+	app.audit(request, models.AuditPasswordReset, user.ID, nil)
+
+	if err := writeMessage(writer, request, http.StatusOK, "You have successfully reset your password"); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 }
 
+// @Summary Email a new OTP
+// @Tags    auth
+// @Accept  json
+// @Produce json
+// @Param   payload body ResendOTPPayload true "Request body"
+// @Success 200 {object} Response[any]
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router  /auth/resend-otp [post]
 func (app *application) resendOTPHandler(writer http.ResponseWriter, request *http.Request) {
 	var payload ResendOTPPayload
 
@@ -351,11 +520,15 @@ func (app *application) resendOTPHandler(writer http.ResponseWriter, request *ht
 		return
 	}
 
-	isPayloadValid := validatePayload(writer, payload)
+	isPayloadValid := validatePayload(writer, request, payload)
 	if !isPayloadValid {
 		return
 	}
 
+	if !app.allowOTPEmail(writer, request, payload.Email) {
+		return
+	}
+
 	user, err := app.store.Users.GetByEmail(request.Context(), payload.Email, false)
 
 	if err != nil {
@@ -368,17 +541,17 @@ func (app *application) resendOTPHandler(writer http.ResponseWriter, request *ht
 		return
 	}
 
-	otpCode, err := generateOTP()
+	otpCode, err := models.GenerateOTP()
 	if err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 	otpCodeExpiring := time.Now().Add(5 * time.Minute)
 
-	err = app.sendOTP(user, "OTP Code", otpCode, otpCodeExpiring, mailer.UserWelcomeTemplate)
+	err = app.sendOTP(request.Context(), user, "OTP Code", otpCode, otpCodeExpiring, mailer.UserWelcomeTemplate, mailer.AsyncInMemory)
 
 	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
+		app.loggerFor(request).Errorw("error sending welcome email", "error", err)
 		app.internalServerError(writer, request, err)
 		return
 	}
@@ -390,30 +563,166 @@ func (app *application) resendOTPHandler(writer http.ResponseWriter, request *ht
 		return
 	}
 
-	if err := writeJSON(writer, http.StatusOK, "OTP sent", nil); err != nil {
+	if err := writeMessage(writer, request, http.StatusOK, "OTP sent"); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 
 }
 
+// @Summary Check whether a username is free to register
+// @Tags    auth
+// @Produce json
+// @Param   username query string true "Username"
+// @Param   u query string false "Deprecated, use username"
+// @Success 200 {object} Response[UsernameAvailability]
+// @Failure 500 {object} ErrorResponse
+// @Router  /auth/check-username [get]
+func (app *application) checkUsernameHandler(writer http.ResponseWriter, request *http.Request) {
+	query := CheckUsernameQuery{Username: request.URL.Query().Get("username")}
+	if query.Username == "" && request.URL.Query().Has("u") {
+		query.Username = request.URL.Query().Get("u")
+		app.deprecatedField(writer, request, "GET /v1/auth/check-username u")
+	}
+	availability := UsernameAvailability{Username: query.Username}
+
+	if err := Validate.Struct(query); err != nil {
+		availability.Reason, _ = formatValidationErrors(err, i18n.FromContext(request.Context()))
+		if err := writeJSON(writer, request, http.StatusOK, "Username checked", availability); err != nil {
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	available, err := app.usernameAvailable(request.Context(), query.Username)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	availability.Available = available
+	if !available {
+		availability.Reason = i18n.T(i18n.FromContext(request.Context()), store.ErrDuplicateUsername.Error())
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Username checked", availability); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// usernameAvailable reports whether registering username would pass the unique key.
+// Unverified and soft deleted accounts keep their usernames, so they count as taken.
+func (app *application) usernameAvailable(ctx context.Context, username string) (bool, error) {
+	_, cached, err := app.cacheStorage.Usernames.Get(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	if cached {
+		return false, nil
+	}
+
+	user, err := app.store.Users.GetByUsername(store.ContextWithDeleted(ctx, store.DeletedInclude), username)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return true, nil
+	case errors.Is(err, store.ErrAccountNotVerified):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	if user.DeletedAt == nil {
+		if err := app.cacheStorage.Usernames.Set(ctx, user.Username, user.ID); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// allowOTPEmail answers 429 once the address got its hourly share of OTP emails. It runs
+// before the user lookup, so unknown addresses are throttled the same way.
+func (app *application) allowOTPEmail(writer http.ResponseWriter, request *http.Request, email string) bool {
+	key := strings.ToLower(strings.TrimSpace(email))
+
+	if allow, retryAfter := app.otpLimiter.Allow(key); !allow {
+		app.loggerFor(request).Warnw("OTP email throttled", "email", key, "path", request.URL.Path)
+		app.rateLimitExceededResponse(writer, request, retryAfter.String())
+		return false
+	}
+
+	return true
+}
+
+// refreshTokenHandler swaps a valid token for a fresh one in the same session.
+// Clients are told when to call it by the tokenRefreshHeader on authenticated responses.
+//
+// @Summary  Swap the token for a fresh one
+// @Tags     auth
+// @Produce  json
+// @Success  200 {object} Response[Session]
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /auth/refresh [post]
+func (app *application) refreshTokenHandler(writer http.ResponseWriter, request *http.Request) {
+	user := getUserFromCtx(request)
+	authTime := getSessionStartFromCtx(request)
+
+	if !time.Now().Before(authTime.Add(app.config.auth.token.maxSession)) {
+		app.unauthorizedErrorResponse(writer, request, errSessionExpired)
+		return
+	}
+
+	token, err := app.generateSessionToken(user, authTime)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	data := app.withSessionToken(writer, user, token, Session{})
+	if err := writeJSON(writer, request, http.StatusOK, "Token refreshed", data); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
 // ==================== Private Methods ===================== //
-func generateOTP() (string, error) {
-	const digits = 6
-	max := big.NewInt(1000000) // 10^6 = 1,000,000
 
-	n, err := rand.Int(rand.Reader, max)
+// checkOTP answers 401 unless code is the user's pending, unexpired OTP. A wrong code
+// counts towards models.MaxOTPAttempts, after which a new one has to be requested.
+func (app *application) checkOTP(writer http.ResponseWriter, request *http.Request, user *models.User, code string) bool {
+	if !user.CompareOTP(code) {
+		if user.OtpCode != "" {
+			if err := app.store.Users.RecordOTPFailure(request.Context(), user.ID); err != nil {
+				app.loggerFor(request).Errorw("error recording failed otp attempt", "user_id", user.ID, "error", err)
+			}
+		}
+		app.unauthorizedErrorResponse(writer, request, store.ErrInvalidOTP)
+		return false
+	}
+
+	otpExp, err := time.Parse(time.RFC3339, user.OtpExp)
 	if err != nil {
-		return "", err
+		app.internalServerError(writer, request, fmt.Errorf("invalid OTP expiration format: %w", err))
+		return false
+	}
+
+	if time.Now().After(otpExp) {
+		app.unauthorizedErrorResponse(writer, request, errOTPExpired)
+		return false
 	}
 
-	// Format with leading zeros (e.g., 000123)
-	otp := fmt.Sprintf("%06d", n.Int64())
-	return otp, nil
+	return true
 }
 
-func (app *application) sendOTP(user *models.User, subject string, otpCode string, otpCodeExpiring time.Time, emailTemplate string) error {
+// sendOTP emails the code in the locale of ctx, subject is translated and emailTemplate
+// resolved to its translation when there is one
+func (app *application) sendOTP(ctx context.Context, user *models.User, subject string, otpCode string, otpCodeExpiring time.Time, emailTemplate string, deliveryMode string) error {
 	isProdEnv := app.config.env == "production"
+	locale := i18n.FromContext(ctx)
+	subject = i18n.T(locale, subject)
 
 	vars := struct {
 		Username string
@@ -428,7 +737,33 @@ func (app *application) sendOTP(user *models.User, subject string, otpCode strin
 	}
 
 	return app.mailer.SendWithOptions(
-		emailTemplate,
+		mailer.Localized(emailTemplate, locale),
+		user.Username,
+		user.Email,
+		subject,
+		vars,
+		deliveryMode,
+		!isProdEnv,
+	)
+}
+
+func (app *application) sendPasswordChangedEmail(ctx context.Context, user *models.User, changedAt time.Time) error {
+	isProdEnv := app.config.env == "production"
+	locale := i18n.FromContext(ctx)
+	subject := i18n.T(locale, "Your password was changed")
+
+	vars := struct {
+		Username  string
+		ChangedAt string
+		Subject   string
+	}{
+		Username:  user.Username,
+		ChangedAt: changedAt.Format(time.RFC1123),
+		Subject:   subject,
+	}
+
+	return app.mailer.SendWithOptions(
+		mailer.Localized(mailer.PasswordChangedTemplate, locale),
 		user.Username,
 		user.Email,
 		subject,
@@ -439,13 +774,27 @@ func (app *application) sendOTP(user *models.User, subject string, otpCode strin
 }
 
 func (app *application) generateJWTToken(user *models.User) (string, error) {
+	return app.generateSessionToken(user, time.Now())
+}
+
+// generateSessionToken issues a token for a session that started at authTime.
+// Refreshed tokens keep the original authTime so the session cannot outlive maxSession.
+func (app *application) generateSessionToken(user *models.User, authTime time.Time) (string, error) {
+	now := time.Now()
+
+	exp := now.Add(app.tokenExpiry(user))
+	if sessionEnd := authTime.Add(app.config.auth.token.maxSession); exp.After(sessionEnd) {
+		exp = sessionEnd
+	}
+
 	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
-		"iss": app.config.auth.token.issuer,
-		"aud": app.config.auth.token.audience,
+		"sub":       user.ID,
+		"exp":       exp.Unix(),
+		"iat":       now.Unix(),
+		"nbf":       now.Unix(),
+		"auth_time": authTime.Unix(),
+		"iss":       app.config.auth.token.issuer,
+		"aud":       app.config.auth.token.audience,
 	}
 	token, err := app.authenticator.GenerateToken(claims)
 
@@ -455,3 +804,33 @@ func (app *application) generateJWTToken(user *models.User) (string, error) {
 	}
 	return token, nil
 }
+
+func (app *application) tokenExpiry(user *models.User) time.Duration {
+	if exp, ok := app.config.auth.token.roleExp[user.Role.Name]; ok {
+		return exp
+	}
+	return app.config.auth.token.exp
+}
+
+// parseRoleExpiry reads "admin=1h,moderator=12h" into a role -> token lifetime map.
+// Malformed pairs are skipped so a typo falls back to the default expiry.
+func parseRoleExpiry(value string) map[string]time.Duration {
+	roleExp := map[string]time.Duration{}
+
+	for _, pair := range strings.Split(value, ",") {
+		role, duration, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+
+		exp, err := time.ParseDuration(duration)
+		if err != nil || exp <= 0 {
+			log.Printf("invalid token expiry %q for role %s, using the default", duration, role)
+			continue
+		}
+
+		roleExp[role] = exp
+	}
+
+	return roleExp
+}
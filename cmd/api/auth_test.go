@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+func TestRegisterUserHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   map[string]any
+		wantCode  int
+		wantError ErrorCode
+	}{
+		{
+			name:     "new user",
+			payload:  map[string]any{"first_name": "Ada", "last_name": "Lovelace", "username": "ada", "email": "ada@example.com", "password": testPassword},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "email taken",
+			payload:   map[string]any{"first_name": "Ada", "last_name": "Lovelace", "username": "ada2", "email": "taken@example.com", "password": testPassword},
+			wantCode:  http.StatusConflict,
+			wantError: CodeUserDuplicateEmail,
+		},
+		{
+			name:      "username taken",
+			payload:   map[string]any{"first_name": "Ada", "last_name": "Lovelace", "username": "taken", "email": "ada@example.com", "password": testPassword},
+			wantCode:  http.StatusConflict,
+			wantError: CodeUserDuplicateUsername,
+		},
+		{
+			name:      "missing email",
+			payload:   map[string]any{"first_name": "Ada", "last_name": "Lovelace", "username": "ada", "password": testPassword},
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: CodeValidationFailed,
+		},
+		{
+			name:      "weak password",
+			payload:   map[string]any{"first_name": "Ada", "last_name": "Lovelace", "username": "ada", "email": "ada@example.com", "password": "password"},
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: CodeValidationFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			createTestUser(t, app, "taken", "taken@example.com", true)
+
+			response, body := do(t, app, http.MethodPost, "/v1/auth/register", test.payload, "")
+			if response.Code != test.wantCode {
+				t.Fatalf("status = %d, want %d: %v", response.Code, test.wantCode, body)
+			}
+			if test.wantError != "" {
+				if got := body["error_code"]; got != string(test.wantError) {
+					t.Errorf("error_code = %v, want %s", got, test.wantError)
+				}
+				// version 2 of the envelope dropped the status-level code
+				if got, ok := body["code"]; ok {
+					t.Errorf("envelope still has code = %v", got)
+				}
+				return
+			}
+
+			data, _ := body["data"].(map[string]any)
+			if token, _ := data["token"].(string); token == "" {
+				t.Errorf("no token in %v", body)
+			}
+			if user, _ := data["user"].(map[string]any); user["username"] != "ada" {
+				t.Errorf("no user in %v", body)
+			}
+
+			user, err := app.store.Users.GetByEmail(context.Background(), "ada@example.com", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.IsActive {
+				t.Error("a new user is active before verifying the email")
+			}
+		})
+	}
+}
+
+func TestVerifyEmailHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		code      string
+		expiresIn time.Duration
+		wantCode  int
+		wantError ErrorCode
+	}{
+		{"right code", "new@example.com", "123456", time.Minute, http.StatusOK, ""},
+		{"wrong code", "new@example.com", "654321", time.Minute, http.StatusUnauthorized, CodeAuthOTPInvalid},
+		{"expired code", "new@example.com", "123456", -time.Minute, http.StatusUnauthorized, CodeAuthOTPExpired},
+		{"unknown email", "nobody@example.com", "123456", time.Minute, http.StatusUnauthorized, CodeUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			user := createTestUser(t, app, "new", "new@example.com", false)
+
+			expiresAt := time.Now().Add(test.expiresIn).Format(time.RFC3339)
+			if err := app.store.Users.UpdateOTPCode(context.Background(), user, "123456", expiresAt); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := map[string]any{"email": test.email, "otp_code": test.code}
+			response, body := do(t, app, http.MethodPost, "/v1/auth/verify-email", payload, "")
+			if response.Code != test.wantCode {
+				t.Fatalf("status = %d, want %d: %v", response.Code, test.wantCode, body)
+			}
+			if test.wantError != "" {
+				if got := body["error_code"]; got != string(test.wantError) {
+					t.Errorf("error_code = %v, want %s", got, test.wantError)
+				}
+			}
+
+			stored, err := app.store.Users.GetByEmail(context.Background(), "new@example.com", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.IsActive != (test.wantCode == http.StatusOK) {
+				t.Errorf("is_active = %v after status %d", stored.IsActive, response.Code)
+			}
+		})
+	}
+}
+
+func TestLoginUserHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		password  string
+		wantCode  int
+		wantError ErrorCode
+	}{
+		{"right password", "active@example.com", testPassword, http.StatusOK, ""},
+		{"email in another case", "Active@Example.com", testPassword, http.StatusOK, ""},
+		{"wrong password", "active@example.com", "Wrong-Harbor-Lantern-42", http.StatusUnauthorized, CodeAuthInvalidCredentials},
+		{"email not verified", "inactive@example.com", testPassword, http.StatusUnauthorized, CodeAuthAccountNotVerified},
+		{"unknown email", "nobody@example.com", testPassword, http.StatusUnauthorized, CodeUnauthorized},
+		{"short password", "active@example.com", "short", http.StatusUnprocessableEntity, CodeValidationFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			createTestUser(t, app, "active", "active@example.com", true)
+			createTestUser(t, app, "inactive", "inactive@example.com", false)
+
+			payload := map[string]any{"email": test.email, "password": test.password}
+			response, body := do(t, app, http.MethodPost, "/v1/auth/login", payload, "")
+			if response.Code != test.wantCode {
+				t.Fatalf("status = %d, want %d: %v", response.Code, test.wantCode, body)
+			}
+			if test.wantError != "" {
+				if got := body["error_code"]; got != string(test.wantError) {
+					t.Errorf("error_code = %v, want %s", got, test.wantError)
+				}
+				return
+			}
+
+			data, _ := body["data"].(map[string]any)
+			if token, _ := data["token"].(string); token == "" {
+				t.Errorf("no token in %v", body)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		// token returns the bearer token to refresh with
+		token     func(app *application, user *models.User) string
+		wantCode  int
+		wantError ErrorCode
+	}{
+		{
+			name: "fresh session",
+			token: func(app *application, user *models.User) string {
+				token, _ := app.generateJWTToken(user)
+				return token
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "session past its maximum",
+			token: func(app *application, user *models.User) string {
+				token, _ := app.generateSessionToken(user, time.Now().Add(-app.config.auth.token.maxSession+time.Minute))
+				app.config.auth.token.maxSession -= time.Hour
+				return token
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantError: CodeAuthSessionExpired,
+		},
+		{
+			name:      "no token",
+			token:     func(*application, *models.User) string { return "" },
+			wantCode:  http.StatusUnauthorized,
+			wantError: CodeAuthTokenInvalid,
+		},
+		{
+			name:      "malformed token",
+			token:     func(*application, *models.User) string { return "not-a-jwt" },
+			wantCode:  http.StatusUnauthorized,
+			wantError: CodeAuthTokenInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			user := createTestUser(t, app, "active", "active@example.com", true)
+
+			response, body := do(t, app, http.MethodPost, "/v1/auth/refresh", nil, test.token(app, user))
+			if response.Code != test.wantCode {
+				t.Fatalf("status = %d, want %d: %v", response.Code, test.wantCode, body)
+			}
+			if test.wantError != "" {
+				if got := body["error_code"]; got != string(test.wantError) {
+					t.Errorf("error_code = %v, want %s", got, test.wantError)
+				}
+				return
+			}
+
+			data, _ := body["data"].(map[string]any)
+			if token, _ := data["token"].(string); token == "" {
+				t.Errorf("no token in %v", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// identiconGrid is the number of cells per side, the left half is mirrored onto the right
+const identiconGrid = 5
+
+// identiconVersion is part of the ETag, bump it when the drawing changes
+const identiconVersion = "1"
+
+type avatarConfig struct {
+	apiURL   string
+	gravatar bool
+}
+
+// avatars is read by the serializer, which has no access to the application
+var avatars avatarConfig
+
+// avatarURL is where clients can always load a picture for the user. An uploaded avatar
+// wins, otherwise with Gravatar enabled it points there and falls back to the generated identicon.
+func avatarURL(user *models.User) string {
+	if user.AvatarURL != "" {
+		return user.AvatarURL
+	}
+
+	identicon := fmt.Sprintf("%s/v1/avatars/%s", avatars.apiURL, url.PathEscape(user.Username))
+
+	if !avatars.gravatar || user.Email == "" {
+		return identicon
+	}
+
+	hash := md5.Sum([]byte(strings.ToLower(strings.TrimSpace(user.Email))))
+	return fmt.Sprintf("https://www.gravatar.com/avatar/%s?d=%s", hex.EncodeToString(hash[:]), url.QueryEscape(identicon))
+}
+
+// getAvatarHandler draws an identicon for the username. The picture only depends on
+// the username, so it is cached for a long time and revalidated through its ETag.
+//
+// @Summary Draw the identicon of a username
+// @Tags    users
+// @Produce image/svg+xml
+// @Param   username path string true "Username"
+// @Success 200 {string} string
+// @Router  /avatars/{username} [get]
+func (app *application) getAvatarHandler(writer http.ResponseWriter, request *http.Request) {
+	username := strings.ToLower(chi.URLParam(request, "username"))
+	hash := sha256.Sum256([]byte(username))
+
+	etag := fmt.Sprintf(`"%s-%s"`, identiconVersion, hex.EncodeToString(hash[:8]))
+
+	writer.Header().Set("ETag", etag)
+	writer.Header().Set("Cache-Control", "public, max-age=86400, immutable")
+
+	if request.Header.Get("If-None-Match") == etag {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "image/svg+xml")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, err := writer.Write([]byte(identiconSVG(hash))); err != nil {
+		app.loggerFor(request).Errorw("error writing avatar", "username", username, "error", err)
+	}
+}
+
+// identiconSVG draws a mirrored grid coloured from the hash, in the style of GitHub's identicons
+func identiconSVG(hash [32]byte) string {
+	const cell = 50
+	const size = cell * (identiconGrid + 1)
+
+	color := fmt.Sprintf("hsl(%d, 55%%, 55%%)", int(hash[0])*360/256)
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, size, size, size, size)
+	fmt.Fprintf(&builder, `<rect width="%d" height="%d" fill="#f0f0f0"/>`, size, size)
+
+	half := (identiconGrid + 1) / 2
+	for row := 0; row < identiconGrid; row++ {
+		for column := 0; column < half; column++ {
+			if hash[1+row*half+column]%2 != 0 {
+				continue
+			}
+
+			fmt.Fprintf(&builder, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`, cell/2+column*cell, cell/2+row*cell, cell, cell, color)
+			if mirrored := identiconGrid - 1 - column; mirrored != column {
+				fmt.Fprintf(&builder, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`, cell/2+mirrored*cell, cell/2+row*cell, cell, cell, color)
+			}
+		}
+	}
+
+	builder.WriteString(`</svg>`)
+	return builder.String()
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/imaging"
+	"godsendjoseph.dev/sandbox-api/internal/storage"
+)
+
+const (
+	// avatarMaxBytes limits the uploaded file, the stored avatar is much smaller
+	avatarMaxBytes = 5 << 20
+	// avatarMaxPixels rejects images that are small files but huge once decoded
+	avatarMaxPixels = 40_000_000
+	// avatarSize is the side of the square every avatar is cropped and scaled to
+	avatarSize = 256
+)
+
+// avatarDecoders are the accepted formats, keyed by the sniffed content type
+var avatarDecoders = map[string]func(io.Reader) (image.Image, error){
+	"image/jpeg": jpeg.Decode,
+	"image/png":  png.Decode,
+	"image/gif":  gif.Decode,
+}
+
+// Avatar is where the stored avatar is served from
+type Avatar struct {
+	AvatarURL string `json:"avatar_url"`
+}
+
+// uploadAvatarHandler takes a multipart "avatar" file, crops and scales it to a square,
+// stores it under the user's folder and removes the previous upload
+//
+// @Summary  Upload the avatar of the current user
+// @Tags     users
+// @Accept   multipart/form-data
+// @Produce  json
+// @Param    avatar formData file true "JPEG, PNG or GIF image"
+// @Success  200 {object} Response[Avatar]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/avatar [post]
+func (app *application) uploadAvatarHandler(writer http.ResponseWriter, request *http.Request) {
+	request.Body = http.MaxBytesReader(writer, request.Body, avatarMaxBytes+(64<<10))
+
+	file, header, err := request.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			app.unprocessableEntityResponse(writer, request, fmt.Errorf("avatar must not be larger than %d MB", avatarMaxBytes>>20))
+			return
+		}
+		app.badRequestResponse(writer, request, errors.New("avatar file is required"))
+		return
+	}
+	defer file.Close()
+
+	if header.Size > avatarMaxBytes {
+		app.unprocessableEntityResponse(writer, request, fmt.Errorf("avatar must not be larger than %d MB", avatarMaxBytes>>20))
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	// the client's file name and content type are not trusted, the bytes decide
+	contentType := http.DetectContentType(data)
+	decode, ok := avatarDecoders[contentType]
+	if !ok {
+		app.unprocessableEntityResponse(writer, request, errors.New("avatar must be a JPEG, PNG or GIF image"))
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		app.unprocessableEntityResponse(writer, request, errors.New("avatar could not be read as an image"))
+		return
+	}
+	if config.Width*config.Height > avatarMaxPixels {
+		app.unprocessableEntityResponse(writer, request, errors.New("avatar dimensions are too large"))
+		return
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		app.unprocessableEntityResponse(writer, request, errors.New("avatar could not be read as an image"))
+		return
+	}
+
+	// photos stay JPEG, everything else becomes PNG to keep transparency
+	var encoded bytes.Buffer
+	ext, outputType := ".png", "image/png"
+	thumbnail := imaging.Thumbnail(img, avatarSize)
+	if contentType == "image/jpeg" {
+		ext, outputType = ".jpg", "image/jpeg"
+		err = jpeg.Encode(&encoded, thumbnail, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&encoded, thumbnail)
+	}
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	ctx := request.Context()
+	user := getUserFromCtx(request)
+
+	key := fmt.Sprintf("%savatar_%d%s", storage.UserFolder(user.ID), time.Now().UnixNano(), ext)
+
+	fileKey, fileURL, err := app.putFile(ctx, &user.ID, key, encoded.Bytes(), outputType)
+	if err != nil {
+		app.loggerFor(request).Errorw("failed to store avatar", "userID", user.ID, "error", err)
+		app.internalServerError(writer, request, errors.New("failed to upload avatar"))
+		return
+	}
+
+	if err := app.store.Users.UpdateAvatar(ctx, user.ID, fileKey, fileURL); err != nil {
+		if deleteErr := app.deleteFile(ctx, fileKey); deleteErr != nil {
+			app.loggerFor(request).Warnw("failed to delete orphaned avatar", "key", fileKey, "error", deleteErr)
+		}
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	// the previous avatar is only removed once nothing points at it anymore
+	if user.AvatarKey != "" {
+		if err := app.deleteFile(ctx, user.AvatarKey); err != nil {
+			app.loggerFor(request).Warnw("failed to delete previous avatar", "key", user.AvatarKey, "error", err)
+		}
+	}
+
+	app.evictCachedUser(request, user.ID)
+
+	if err := writeJSON(writer, request, http.StatusOK, "Avatar updated", Avatar{AvatarURL: fileURL}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// putFile stores data under key, in ./uploads during development and in object storage
+// otherwise, and records it in the files table as owned by ownerID
+func (app *application) putFile(ctx context.Context, ownerID *int64, key string, data []byte, contentType string) (string, string, error) {
+	var fileURL string
+
+	if app.config.env == "development" {
+		filePath := filepath.Join("./uploads", key)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return "", "", err
+		}
+
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			return "", "", err
+		}
+
+		fileURL = fmt.Sprintf("%s/uploads/%s", app.config.apiURL, key)
+	} else {
+		if app.storageClient == nil {
+			return "", "", errors.New("storage service not available")
+		}
+
+		result, err := app.storageClient.UploadFile(ctx, key, bytes.NewReader(data), contentType, int64(len(data)))
+		if err != nil {
+			return "", "", err
+		}
+		key, fileURL = result.Key, result.URL
+	}
+
+	checksum := sha256.Sum256(data)
+	if err := app.recordFile(ctx, ownerID, key, contentType, int64(len(data)), hex.EncodeToString(checksum[:])); err != nil {
+		return "", "", err
+	}
+
+	return key, fileURL, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// largeBodyPaths take uploads or bulk payloads, they get the upload body limit instead of
+// the JSON one
+var largeBodyPaths = map[string]bool{
+	"/v1/user/avatar":               true,
+	"/v1/admin/email-verifications": true,
+}
+
+// compressibleTypes are the response types compressed for clients that accept gzip or
+// deflate. Event streams are left out, they have to reach the client as they are written.
+var compressibleTypes = []string{
+	"application/json",
+	problemJSONType,
+	"text/html",
+	"text/plain",
+	"text/css",
+	"text/javascript",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding, send gzip, deflate or an uncompressed body")
+
+func (app *application) bodyLimitFor(path string) int64 {
+	if largeBodyPaths[canonicalPath(path)] {
+		return app.config.body.uploadLimit
+	}
+	return app.config.body.jsonLimit
+}
+
+// BodyMiddleware decompresses gzip and deflate request bodies and caps the body at the
+// limit of the route. The limit applies to the decompressed size, so a small compressed
+// body cannot expand past it.
+func (app *application) BodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		limit := app.bodyLimitFor(request.URL.Path)
+
+		if request.ContentLength > limit {
+			app.payloadTooLargeResponse(writer, request, &http.MaxBytesError{Limit: limit})
+			return
+		}
+
+		var decoded io.ReadCloser
+		switch strings.ToLower(strings.TrimSpace(request.Header.Get("Content-Encoding"))) {
+		case "", "identity":
+		case "gzip":
+			reader, err := gzip.NewReader(request.Body)
+			if err != nil {
+				app.badRequestResponse(writer, request, fmt.Errorf("invalid gzip body: %w", err))
+				return
+			}
+			decoded = reader
+		case "deflate":
+			// HTTP deflate is the zlib format, not a raw deflate stream
+			reader, err := zlib.NewReader(request.Body)
+			if err != nil {
+				app.badRequestResponse(writer, request, fmt.Errorf("invalid deflate body: %w", err))
+				return
+			}
+			decoded = reader
+		default:
+			app.unsupportedMediaTypeResponse(writer, request, errUnsupportedEncoding)
+			return
+		}
+
+		if decoded != nil {
+			defer decoded.Close()
+
+			request.Body = struct {
+				io.Reader
+				io.Closer
+			}{decoded, request.Body}
+			request.Header.Del("Content-Encoding")
+			request.ContentLength = -1
+		}
+
+		request.Body = http.MaxBytesReader(writer, request.Body, limit)
+
+		next.ServeHTTP(writer, request)
+	})
+}
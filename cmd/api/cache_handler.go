@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"godsendjoseph.dev/sandbox-api/internal/store/cache"
+)
+
+// CacheStats is the cache backend of this instance and the hit rates of its lookups
+type CacheStats struct {
+	Enabled bool             `json:"enabled"`
+	Backend string           `json:"backend"`
+	Users   cache.BatchStats `json:"users"`
+}
+
+// getCacheStatsHandler reports how well the batched cache lookups are doing on this instance
+//
+// @Summary  Report the cache hit rates of this instance
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[CacheStats]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/cache-stats [get]
+func (app *application) getCacheStatsHandler(writer http.ResponseWriter, request *http.Request) {
+	stats := CacheStats{
+		Enabled: app.cacheStorage.Backend != cache.BackendNone,
+		Backend: app.cacheStorage.Backend,
+		Users:   app.cacheStorage.Users.Stats(),
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Cache stats retrieved", stats); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"godsendjoseph.dev/sandbox-api/internal/captcha"
+)
+
+// checkCaptcha verifies the CAPTCHA token of an anonymous request and answers the ones that
+// fail. It passes everything when no provider is configured.
+func (app *application) checkCaptcha(writer http.ResponseWriter, request *http.Request, token string) bool {
+	if app.captcha == nil {
+		return true
+	}
+
+	err := app.captcha.Verify(request.Context(), token, clientIP(request))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, captcha.ErrMissingToken), errors.Is(err, captcha.ErrFailed):
+		app.unprocessableEntityResponse(writer, request, err)
+	default:
+		// fail closed, an unreachable provider must not open the endpoint to bots
+		app.serviceUnavailableResponse(writer, request, err)
+	}
+	return false
+}
+
+// checkAuthCaptcha is checkCaptcha for register and forgot-password, which only need a
+// token with CAPTCHA_AUTH_ENABLED
+func (app *application) checkAuthCaptcha(writer http.ResponseWriter, request *http.Request, token string) bool {
+	if !app.config.captcha.auth {
+		return true
+	}
+	return app.checkCaptcha(writer, request, token)
+}
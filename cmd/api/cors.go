@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/cors"
+)
+
+// developmentOrigins are allowed outside production when CORS_ALLOWED_ORIGINS is not set.
+// Production falls back to FRONTEND_URL alone.
+var developmentOrigins = []string{"https://*", "http://*", "http://localhost:*"}
+
+// corsMethods are the methods CORS_ALLOWED_METHODS may list
+var corsMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// splitList splits a comma-separated env value, dropping blanks
+func splitList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// resolve fills in the default origins and checks the configuration, an error stops the
+// API at startup. Wildcard origins are refused in production.
+func (c *corsConfig) resolve(environment, frontendURL string) error {
+	production := environment == "production"
+
+	if len(c.allowedOrigins) == 0 {
+		switch {
+		case !production:
+			c.allowedOrigins = developmentOrigins
+		case frontendURL != "":
+			c.allowedOrigins = []string{strings.TrimSuffix(frontendURL, "/")}
+		default:
+			return errors.New("CORS_ALLOWED_ORIGINS or FRONTEND_URL is required in production")
+		}
+	}
+
+	for _, origin := range c.allowedOrigins {
+		if strings.Contains(origin, "*") {
+			if production {
+				return fmt.Errorf("invalid CORS origin %q: wildcards are not allowed in production", origin)
+			}
+			if origin == "*" && c.allowCredentials {
+				return fmt.Errorf("invalid CORS origin %q: credentials cannot be allowed for every origin", origin)
+			}
+			continue
+		}
+
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			(parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+			return fmt.Errorf("invalid CORS origin %q: expected scheme://host[:port]", origin)
+		}
+	}
+
+	for i, method := range c.allowedMethods {
+		c.allowedMethods[i] = strings.ToUpper(method)
+		if !slices.Contains(corsMethods, c.allowedMethods[i]) {
+			return fmt.Errorf("invalid CORS method %q", method)
+		}
+	}
+
+	if len(c.allowedMethods) == 0 {
+		return errors.New("CORS_ALLOWED_METHODS must list at least one method")
+	}
+
+	if c.maxAge < 0 {
+		return errors.New("CORS_MAX_AGE must not be negative")
+	}
+
+	return nil
+}
+
+func (c corsConfig) options() cors.Options {
+	return cors.Options{
+		AllowedOrigins:   c.allowedOrigins,
+		AllowedMethods:   c.allowedMethods,
+		AllowedHeaders:   c.allowedHeaders,
+		ExposedHeaders:   []string{"Link", tokenRefreshHeader, supportRefHeader, requestIDHeader, apiVersionHeader, "Deprecation", "Sunset", "Warning"},
+		AllowCredentials: c.allowCredentials,
+		MaxAge:           c.maxAge,
+	}
+}
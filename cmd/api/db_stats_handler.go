@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"godsendjoseph.dev/sandbox-api/internal/db"
+)
+
+var errInvalidLimit = errors.New("limit must be a number, 0 or more")
+
+// DBStats is the connection pool of this instance and its queries by the time spent in them
+type DBStats struct {
+	Pool                 DBPoolStats     `json:"pool"`
+	Replicas             DBReplicaStats  `json:"replicas"`
+	SlowQueryThresholdMS int64           `json:"slow_query_threshold_ms"`
+	StatementCache       int             `json:"statement_cache"`
+	Queries              []db.QueryStats `json:"queries"`
+}
+
+type DBPoolStats struct {
+	Open          int   `json:"open"`
+	InUse         int   `json:"in_use"`
+	Idle          int   `json:"idle"`
+	WaitCount     int64 `json:"wait_count"`
+	WaitMS        int64 `json:"wait_ms"`
+	MaxOpen       int   `json:"max_open"`
+	MaxIdleClosed int64 `json:"max_idle_closed"`
+}
+
+type DBReplicaStats struct {
+	Configured int `json:"configured"`
+	Healthy    int `json:"healthy"`
+}
+
+// getDBStatsHandler reports the connection pool and the queries of this instance by the
+// time spent in them, ?limit= keeps the top ones (20 by default, 0 for all)
+//
+// @Summary  Report the connection pool and the slowest queries
+// @Tags     admin
+// @Produce  json
+// @Param    limit query int false "Queries to keep, 0 for all"
+// @Success  200 {object} Response[DBStats]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/db-stats [get]
+func (app *application) getDBStatsHandler(writer http.ResponseWriter, request *http.Request) {
+	limit := 20
+	if value := request.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			app.badRequestResponse(writer, request, errInvalidLimit)
+			return
+		}
+		limit = parsed
+	}
+
+	queries := app.queryMetrics.Snapshot()
+	if limit > 0 && len(queries) > limit {
+		queries = queries[:limit]
+	}
+
+	pool := app.db.Stats()
+	stats := DBStats{
+		Pool: DBPoolStats{
+			Open:          pool.OpenConnections,
+			InUse:         pool.InUse,
+			Idle:          pool.Idle,
+			WaitCount:     pool.WaitCount,
+			WaitMS:        pool.WaitDuration.Milliseconds(),
+			MaxOpen:       pool.MaxOpenConnections,
+			MaxIdleClosed: pool.MaxIdleClosed,
+		},
+		Replicas: DBReplicaStats{
+			Configured: len(app.config.db.replicaAddrs),
+			Healthy:    app.replicas.Healthy(),
+		},
+		SlowQueryThresholdMS: app.config.db.slowQueryThreshold.Milliseconds(),
+		StatementCache:       app.config.db.statementCache,
+		Queries:              orEmpty(queries),
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Database stats retrieved", stats); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// deprecationClientLimit bounds the clients tracked per surface, later ones are only counted in the total
+const deprecationClientLimit = 1000
+
+// deprecation describes an endpoint or payload field that is going away
+type deprecation struct {
+	// Since is sent as the Deprecation header
+	Since time.Time
+	// Sunset, when set, is the date the surface stops working
+	Sunset time.Time
+	// Replacement tells clients what to use instead
+	Replacement string
+	// Link points to the migration notes
+	Link string
+}
+
+// deprecations are keyed by surface, "/version" for a whole API version, "METHOD /path"
+// for endpoints and "METHOD /path field" for payload fields. Add an entry here, then set it
+// as the deprecation of the version, wrap the route with app.deprecated or call
+// app.deprecatedField from the handler.
+var deprecations = map[string]deprecation{
+	"/v1": {
+		Since:       time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC),
+		Sunset:      time.Date(2027, time.October, 16, 0, 0, 0, 0, time.UTC),
+		Replacement: "/v2",
+	},
+	"POST /v1/user/update-profile": {
+		Since:       time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC),
+		Sunset:      time.Date(2027, time.April, 16, 0, 0, 0, 0, time.UTC),
+		Replacement: "PATCH /v1/user/profile",
+	},
+	"GET /v1/auth/check-username u": {
+		Since:       time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC),
+		Replacement: "?username=",
+	},
+}
+
+const deprecationCallerCtx contextKey = "deprecationCaller"
+
+// deprecationCaller is filled in by AuthTokenMiddleware, so a call to a surface deprecated
+// before the route authenticates, such as a whole version, is counted against the user
+type deprecationCaller struct {
+	user *models.User
+}
+
+// setDeprecationCaller names the authenticated user of a request to the deprecated wrapper around it
+func setDeprecationCaller(ctx context.Context, user *models.User) {
+	if caller, ok := ctx.Value(deprecationCallerCtx).(*deprecationCaller); ok {
+		caller.user = user
+	}
+}
+
+// deprecated marks every request of the route as using surface. The call is counted once
+// the request is served, against the user when a route further in authenticated it.
+func (app *application) deprecated(surface string) func(http.Handler) http.Handler {
+	if _, ok := deprecations[surface]; !ok {
+		panic(fmt.Sprintf("deprecated surface %q is not registered", surface))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writeDeprecationHeaders(writer, surface)
+
+			// a deprecated route inside a deprecated version shares the caller of the version
+			ctx := request.Context()
+			caller, ok := ctx.Value(deprecationCallerCtx).(*deprecationCaller)
+			if !ok {
+				caller = &deprecationCaller{}
+				ctx = context.WithValue(ctx, deprecationCallerCtx, caller)
+			}
+
+			next.ServeHTTP(writer, request.WithContext(ctx))
+
+			user := caller.user
+			if user == nil {
+				user = getUserFromCtx(request)
+			}
+			app.deprecationUsage.record(surface, deprecationClient(user, request), time.Now())
+		})
+	}
+}
+
+// deprecatedField is called by a handler that received a deprecated field, before it writes the response
+func (app *application) deprecatedField(writer http.ResponseWriter, request *http.Request, surface string) {
+	if _, ok := deprecations[surface]; !ok {
+		app.logger.Errorw("deprecated surface is not registered", "surface", surface)
+		return
+	}
+	writeDeprecationHeaders(writer, surface)
+	app.deprecationUsage.record(surface, deprecationClient(getUserFromCtx(request), request), time.Now())
+}
+
+func writeDeprecationHeaders(writer http.ResponseWriter, surface string) {
+	d := deprecations[surface]
+	header := writer.Header()
+
+	header.Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+	if !d.Sunset.IsZero() {
+		header.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, d.Link))
+	}
+
+	message := surface + " is deprecated"
+	if d.Replacement != "" {
+		message += ", use " + d.Replacement
+	}
+	header.Add("Warning", fmt.Sprintf("299 - %q", message))
+}
+
+// deprecationClient identifies the caller, the user when authenticated and the user agent otherwise
+func deprecationClient(user *models.User, request *http.Request) string {
+	if user != nil {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+
+	agent := request.UserAgent()
+	if agent == "" {
+		agent = "unknown"
+	}
+	if len(agent) > 200 {
+		agent = agent[:200]
+	}
+	return "agent:" + agent
+}
+
+type deprecationClientUsage struct {
+	Client   string    `json:"client"`
+	Calls    int64     `json:"calls"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type deprecationReport struct {
+	Surface     string                   `json:"surface"`
+	Since       time.Time                `json:"since"`
+	Sunset      *time.Time               `json:"sunset,omitempty"`
+	Replacement string                   `json:"replacement,omitempty"`
+	Calls       int64                    `json:"calls"`
+	Clients     []deprecationClientUsage `json:"clients"`
+}
+
+// deprecationUsage counts the calls per surface and client on this instance since it started
+type deprecationUsage struct {
+	sync.Mutex
+	calls   map[string]int64
+	clients map[string]map[string]*deprecationClientUsage
+}
+
+func newDeprecationUsage() *deprecationUsage {
+	return &deprecationUsage{
+		calls:   make(map[string]int64),
+		clients: make(map[string]map[string]*deprecationClientUsage),
+	}
+}
+
+func (usage *deprecationUsage) record(surface, client string, now time.Time) {
+	usage.Lock()
+	defer usage.Unlock()
+
+	usage.calls[surface]++
+
+	clients, ok := usage.clients[surface]
+	if !ok {
+		clients = make(map[string]*deprecationClientUsage)
+		usage.clients[surface] = clients
+	}
+
+	entry, ok := clients[client]
+	if !ok {
+		if len(clients) >= deprecationClientLimit {
+			return
+		}
+		entry = &deprecationClientUsage{Client: client}
+		clients[client] = entry
+	}
+
+	entry.Calls++
+	entry.LastSeen = now
+}
+
+// report lists every registered surface, including the ones nobody called
+func (usage *deprecationUsage) report() []deprecationReport {
+	usage.Lock()
+	defer usage.Unlock()
+
+	reports := make([]deprecationReport, 0, len(deprecations))
+	for surface, d := range deprecations {
+		report := deprecationReport{
+			Surface:     surface,
+			Since:       d.Since,
+			Replacement: d.Replacement,
+			Calls:       usage.calls[surface],
+			Clients:     []deprecationClientUsage{},
+		}
+		if !d.Sunset.IsZero() {
+			sunset := d.Sunset
+			report.Sunset = &sunset
+		}
+
+		for _, entry := range usage.clients[surface] {
+			report.Clients = append(report.Clients, *entry)
+		}
+		sort.Slice(report.Clients, func(i, j int) bool {
+			return report.Clients[i].Calls > report.Clients[j].Calls
+		})
+
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Surface < reports[j].Surface
+	})
+
+	return reports
+}
+
+// deprecationMetrics counts the calls and callers of each surface. Clients are only counted,
+// the report names them, so the labels stay bounded by the registered surfaces.
+func deprecationMetrics(reports []deprecationReport) []metric {
+	metrics := make([]metric, 0, 2*len(reports))
+	for _, report := range reports {
+		labels := map[string]string{"surface": report.Surface}
+		metrics = append(metrics,
+			metric{"deprecated_calls_total", "counter", "Calls to a deprecated endpoint or field on this instance", labels, float64(report.Calls)},
+			metric{"deprecated_clients", "gauge", "Clients that called a deprecated endpoint or field on this instance", labels, float64(len(report.Clients))},
+		)
+	}
+	return metrics
+}
+
+// getDeprecationsHandler shows who still calls deprecated surfaces, busiest clients first
+//
+// @Summary  Report who still calls deprecated surfaces
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[[]deprecationReport]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/deprecations [get]
+func (app *application) getDeprecationsHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := writeJSON(writer, request, http.StatusOK, "Deprecated surfaces retrieved", app.deprecationUsage.report()); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
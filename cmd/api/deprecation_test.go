@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// deprecationCalls returns the calls per client of surface in the report of app
+func deprecationCalls(app *application, surface string) map[string]int64 {
+	calls := map[string]int64{}
+	for _, report := range app.deprecationUsage.report() {
+		if report.Surface != surface {
+			continue
+		}
+		for _, client := range report.Clients {
+			calls[client.Client] = client.Calls
+		}
+	}
+	return calls
+}
+
+func TestDeprecatedRoute(t *testing.T) {
+	const surface = "POST /v1/user/update-profile"
+
+	app := newTestApplication(t)
+	user := createTestUser(t, app, "active", "active@example.com", true)
+	token, err := app.generateJWTToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := map[string]any{"first_name": "Changed", "last_name": "Name"}
+
+	// under v2, v1 announces its own deprecation on every response
+	response, body := do(t, app, http.MethodPatch, "/v2/user/profile", payload, token)
+	if response.Code != http.StatusOK {
+		t.Fatalf("replacement: status %d: %v", response.Code, body)
+	}
+	if got := response.Header().Get("Deprecation"); got != "" {
+		t.Errorf("replacement: Deprecation = %q, want none", got)
+	}
+
+	response, body = do(t, app, http.MethodPost, "/v2/user/update-profile", payload, token)
+	if response.Code != http.StatusOK {
+		t.Fatalf("deprecated: status %d: %v", response.Code, body)
+	}
+	if response.Header().Get("Deprecation") == "" || response.Header().Get("Sunset") == "" {
+		t.Errorf("deprecated: headers %v, want Deprecation and Sunset", response.Header())
+	}
+
+	client := fmt.Sprintf("user:%d", user.ID)
+	if calls := deprecationCalls(app, surface); calls[client] != 1 {
+		t.Errorf("calls = %v, want 1 for %s", calls, client)
+	}
+}
+
+func TestDeprecatedBeforeAuthCountsTheUser(t *testing.T) {
+	const surface = "POST /v1/user/update-profile"
+
+	app := newTestApplication(t)
+	user := createTestUser(t, app, "active", "active@example.com", true)
+	token, err := app.generateJWTToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the way versionMiddleware wraps a deprecated version around the authenticated routes
+	handler := app.deprecated(surface)(app.AuthTokenMiddleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	})))
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/user/update-profile", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("User-Agent", "old-client/1.0")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	request = httptest.NewRequest(http.MethodPost, "/v1/user/update-profile", nil)
+	request.Header.Set("User-Agent", "old-client/1.0")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	calls := deprecationCalls(app, surface)
+	if client := fmt.Sprintf("user:%d", user.ID); calls[client] != 1 {
+		t.Errorf("calls = %v, want 1 for %s", calls, client)
+	}
+	if calls["agent:old-client/1.0"] != 1 {
+		t.Errorf("calls = %v, want 1 for the unauthenticated agent", calls)
+	}
+
+	var total float64
+	for _, sample := range deprecationMetrics(app.deprecationUsage.report()) {
+		if sample.name == "deprecated_calls_total" && sample.labels["surface"] == surface {
+			total = sample.value
+		}
+	}
+	if total != 2 {
+		t.Errorf("deprecated_calls_total = %g, want 2", total)
+	}
+}
+
+func TestDeprecatedField(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		wantDeprecated bool
+	}{
+		{"username", "?username=ada", false},
+		{"deprecated u", "?u=ada", true},
+		{"both", "?username=ada&u=ada", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			response, body := do(t, app, http.MethodGet, "/v2/auth/check-username"+test.query, nil, "")
+			if response.Code != http.StatusOK {
+				t.Fatalf("status %d: %v", response.Code, body)
+			}
+			if data, _ := body["data"].(map[string]any); data["username"] != "ada" {
+				t.Errorf("data = %v, want username ada", data)
+			}
+			if deprecated := response.Header().Get("Deprecation") != ""; deprecated != test.wantDeprecated {
+				t.Errorf("Deprecation header = %v, want %v", deprecated, test.wantDeprecated)
+			}
+		})
+	}
+}
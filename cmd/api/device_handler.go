@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/auth"
+	"godsendjoseph.dev/sandbox-api/internal/events"
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/notification"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+// maxUserAgentLength is the width of user_devices.user_agent
+const maxUserAgentLength = 512
+
+var (
+	errDeviceReportInvalid = errors.New("device report link is invalid")
+	errDeviceReportExpired = errors.New("device report link has expired")
+)
+
+// ReportSignInPayload carries the token of the "this wasn't me" link of a new sign-in email
+type ReportSignInPayload struct {
+	Token string `json:"token" validate:"required,max=255"`
+}
+
+// recordDevice remembers the device of a successful sign-in and reports whether the user
+// never signed in from it before, publishing events.NewSignIn then. The login already
+// succeeded, so a failure is only logged.
+func (app *application) recordDevice(request *http.Request, user *models.User) bool {
+	ctx := request.Context()
+
+	userAgent := request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	device := &models.UserDevice{
+		UserID:    user.ID,
+		IP:        clientIP(request),
+		UserAgent: userAgent,
+	}
+
+	newDevice, err := app.store.Devices.Record(ctx, device)
+	if err != nil {
+		app.loggerFor(request).Errorw("error recording sign-in device", "userID", user.ID, "error", err)
+		return false
+	}
+	if !newDevice {
+		return false
+	}
+
+	app.publishEvent(ctx, events.NewSignIn{
+		UserID:      user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DeviceID:    device.ID,
+		IP:          device.IP,
+		UserAgent:   device.UserAgent,
+		FirstSeenAt: device.FirstSeenAt,
+		Locale:      i18n.FromContext(ctx),
+	})
+
+	return true
+}
+
+// reportSignInHandler is the "this wasn't me" link of a new sign-in email. It signs the
+// user out everywhere by replacing their password with a random one, and emails them a code
+// to choose a new one with /auth/reset-password. The link works once.
+//
+// @Summary Report a sign-in from a new device that was not the user
+// @Tags    auth
+// @Accept  json
+// @Produce json
+// @Param   payload body ReportSignInPayload true "Request body"
+// @Success 200 {object} Response[any]
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router  /auth/report-sign-in [post]
+func (app *application) reportSignInHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload ReportSignInPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := store.ContextWithPrimary(request.Context())
+
+	device, err := app.deviceFromToken(ctx, payload.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, errDeviceReportInvalid), errors.Is(err, errDeviceReportExpired), errors.Is(err, store.ErrDeviceReported):
+			app.unprocessableEntityResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, device.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unprocessableEntityResponse(writer, request, errDeviceReportInvalid)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	// nobody knows the new password, the user has to reset it with the emailed code
+	if err := user.Password.Set(rand.Text()); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+	changedAt := time.Now().UTC().Truncate(time.Second)
+	user.PasswordChangedAt = &changedAt
+
+	otpCode, err := models.GenerateOTP()
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+	otpCodeExpiring := time.Now().Add(5 * time.Minute)
+
+	err = app.store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := app.store.Devices.MarkReported(ctx, device.ID); err != nil {
+			return err
+		}
+		if err := app.store.Users.ChangePassword(ctx, user); err != nil {
+			return err
+		}
+		return app.store.Users.UpdateOTPCode(ctx, user, otpCode, otpCodeExpiring.Format(time.RFC3339))
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceReported):
+			app.unprocessableEntityResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	app.evictCachedUser(request, user.ID)
+	app.audit(request, models.AuditSignInReported, user.ID, map[string]any{
+		"device_id":  device.ID,
+		"ip":         device.IP,
+		"user_agent": device.UserAgent,
+	})
+
+	app.publishEvent(ctx, events.SignInReported{
+		UserID:    user.ID,
+		Username:  user.Username,
+		DeviceID:  device.ID,
+		IP:        device.IP,
+		UserAgent: device.UserAgent,
+	})
+
+	err = app.sendOTP(ctx, user, "Reset your password", otpCode, otpCodeExpiring, mailer.UserWelcomeTemplate, mailer.AsyncInMemory)
+	if err != nil {
+		app.loggerFor(request).Errorw("error sending password reset email", "userID", user.ID, "error", err)
+	}
+
+	if err := writeMessage(writer, request, http.StatusOK, "Sign-in reported, check your email to choose a new password"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// deviceFromToken loads the device a report token was signed for, if it can still be reported
+func (app *application) deviceFromToken(ctx context.Context, token string) (*models.UserDevice, error) {
+	id, err := auth.ParseDeviceToken(token)
+	if err != nil {
+		return nil, errDeviceReportInvalid
+	}
+
+	device, err := app.store.Devices.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, errDeviceReportInvalid
+		}
+		return nil, err
+	}
+
+	if !auth.VerifyDeviceToken(app.config.auth.token.secret, token, device.ID, device.UserID, device.FirstSeenAt) {
+		return nil, errDeviceReportInvalid
+	}
+	if device.ReportedAt != nil {
+		return nil, store.ErrDeviceReported
+	}
+	if time.Since(device.FirstSeenAt) > app.config.auth.newDevice.reportExp {
+		return nil, errDeviceReportExpired
+	}
+
+	return device, nil
+}
+
+// mailNewSignIn tells the user about a sign-in from a new device, with a link to report it
+func (app *application) mailNewSignIn(ctx context.Context, event events.NewSignIn) error {
+	if !app.config.auth.newDevice.email {
+		return nil
+	}
+
+	isProdEnv := app.config.env == "production"
+	locale := event.Locale
+	subject := i18n.T(locale, "New sign-in to your account")
+
+	token := auth.DeviceToken(app.config.auth.token.secret, event.DeviceID, event.UserID, event.FirstSeenAt)
+
+	vars := struct {
+		Username   string
+		Subject    string
+		SignedInAt string
+		IP         string
+		UserAgent  string
+		ReportURL  string
+	}{
+		Username:   event.Username,
+		Subject:    subject,
+		SignedInAt: event.FirstSeenAt.Format(time.RFC1123),
+		IP:         event.IP,
+		UserAgent:  event.UserAgent,
+		ReportURL:  strings.TrimSuffix(app.config.frontendURL, "/") + "/report-sign-in?token=" + url.QueryEscape(token),
+	}
+
+	return app.mailer.SendWithOptions(
+		mailer.Localized(mailer.NewSignInTemplate, locale),
+		event.Username,
+		event.Email,
+		subject,
+		vars,
+		mailer.AsyncInMemory,
+		!isProdEnv,
+	)
+}
+
+// alertNewSignIn posts a sign-in from a new device to the auth route when AUTH_NEW_DEVICE_ALERT is on
+func (app *application) alertNewSignIn(_ context.Context, event events.NewSignIn) error {
+	if !app.config.auth.newDevice.alert {
+		return nil
+	}
+
+	fields := map[string]string{
+		"IP":         event.IP,
+		"User-Agent": event.UserAgent,
+	}
+	app.geoip.Lookup(event.IP).AddFields(fields)
+
+	err := app.notifier.SendCategoryNotification(
+		notification.CategoryAuth,
+		notification.SeverityInfo,
+		fmt.Sprintf("🔐 New sign-in for %s (#%d)", event.Username, event.UserID),
+		"",
+		"#3AA3E3",
+		fields,
+	)
+	if err != nil {
+		app.logger.Errorw("error sending new sign-in alert", "userID", event.UserID, "error", err)
+	}
+
+	return nil
+}
+
+// alertSignInReported posts a reported sign-in to the auth route, it is always sent
+func (app *application) alertSignInReported(_ context.Context, event events.SignInReported) error {
+	fields := map[string]string{
+		"IP":         event.IP,
+		"User-Agent": event.UserAgent,
+		"Device":     fmt.Sprintf("%d", event.DeviceID),
+	}
+	app.geoip.Lookup(event.IP).AddFields(fields)
+
+	err := app.notifier.SendCategoryNotification(
+		notification.CategoryAuth,
+		notification.SeverityWarning,
+		fmt.Sprintf("🚨 %s (#%d) reported a sign-in that was not them", event.Username, event.UserID),
+		"The password was reset and every session revoked.",
+		"danger",
+		fields,
+	)
+	if err != nil {
+		app.logger.Errorw("error sending sign-in reported alert", "userID", event.UserID, "error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/swaggo/swag"
+
+	"godsendjoseph.dev/sandbox-api/docs"
+)
+
+// swaggerUIVersion pins the Swagger UI release the docs page loads from the CDN
+const swaggerUIVersion = "5.17.14"
+
+// docsPage loads Swagger UI and points it at doc.json next to it
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Sandbox API docs</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({ url: window.location.pathname.replace(/\/$/, "") + "/doc.json", dom_id: "#swagger-ui" });
+</script>
+</body>
+</html>
+`
+
+// getDocsHandler serves Swagger UI for the generated API docs
+func (app *application) getDocsHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Write([]byte(docsPage))
+}
+
+// getDocsSpecHandler serves the OpenAPI document generated by make docs, with the host and
+// version of this instance
+func (app *application) getDocsSpecHandler(writer http.ResponseWriter, request *http.Request) {
+	doc, err := swag.ReadDoc(docs.SwaggerInfo.InstanceName())
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Write([]byte(doc))
+}
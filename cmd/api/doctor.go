@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/db"
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/storage"
+	"godsendjoseph.dev/sandbox-api/internal/store/cache"
+)
+
+const doctorTimeout = 10 * time.Second
+
+// doctorCommand runs runDoctor instead of the server, e.g. go run cmd/api/*.go doctor
+const doctorCommand = "doctor"
+
+type doctorCheck struct {
+	name    string
+	enabled bool
+	hint    string
+	run     func(ctx context.Context) error
+}
+
+// runDoctor checks every external dependency the API relies on and
+// returns the process exit code: 0 when everything enabled passed, 1 otherwise
+func runDoctor(cfg config) int {
+	checks := []doctorCheck{
+		{
+			name:    "MySQL",
+			enabled: true,
+			hint:    "check DB_HOST, DB_PORT, DB_USER, DB_PASSWORD and DB_NAME, and that the database is accepting connections",
+			run: func(ctx context.Context) error {
+				return db.Ping(ctx, cfg.db.addr, cfg.db.user, cfg.db.password, cfg.db.dbName)
+			},
+		},
+		{
+			name:    "Redis",
+			enabled: cfg.redisCfg.enabled,
+			hint:    "check REDIS_ADDR, REDIS_PASSWORD and REDIS_DB, or set REDIS_ENABLED=false",
+			run: func(ctx context.Context) error {
+				client := cache.NewRedisClient(cfg.redisCfg.addr, cfg.redisCfg.pwd, cfg.redisCfg.db)
+				defer client.Close()
+				return client.Ping(ctx).Err()
+			},
+		},
+	}
+
+	for _, addr := range cfg.db.replicaAddrs {
+		checks = append(checks, doctorCheck{
+			name:    "MySQL replica " + addr,
+			enabled: true,
+			hint:    "check DB_REPLICA_ADDRS, DB_REPLICA_USER and DB_REPLICA_PASSWORD, reads fall back to the primary while it is down",
+			run: func(ctx context.Context) error {
+				return db.Ping(ctx, addr, cfg.db.replicaUser, cfg.db.replicaPassword, cfg.db.dbName)
+			},
+		})
+	}
+
+	checks = append(checks, mailDoctorChecks(cfg)...)
+	checks = append(checks, doctorCheck{
+		name:    "Email templates",
+		enabled: true,
+		hint:    "every template needs subject and body blocks and may only use the fields listed in mailer.Templates",
+		run: func(ctx context.Context) error {
+			return errors.Join(mailer.LintTemplates()...)
+		},
+	})
+
+	checks = append(checks, []doctorCheck{
+		{
+			name:    "Slack",
+			enabled: cfg.slack.enabled,
+			hint:    "check SLACK_WEBHOOK_URL and SLACK_ROUTES, a webhook may have been revoked, or set SLACK_ENABLED=false",
+			run:     pingNotifier(cfg, "slack"),
+		},
+		{
+			name:    "Discord",
+			enabled: cfg.notify.discordWebhookURL != "",
+			hint:    "check DISCORD_WEBHOOK_URL and DISCORD_MIN_SEVERITY, the webhook may have been deleted",
+			run:     pingNotifier(cfg, "discord"),
+		},
+		{
+			name:    "Microsoft Teams",
+			enabled: cfg.notify.teamsWebhookURL != "",
+			hint:    "check TEAMS_WEBHOOK_URL and TEAMS_MIN_SEVERITY, only the URL format can be checked",
+			run:     pingNotifier(cfg, "teams"),
+		},
+		{
+			name:    "Notification webhook",
+			enabled: cfg.notify.webhookURL != "",
+			hint:    "check NOTIFY_WEBHOOK_URL and NOTIFY_WEBHOOK_MIN_SEVERITY, only the URL format can be checked",
+			run:     pingNotifier(cfg, "webhook"),
+		},
+		{
+			name:    "Storage (" + cfg.fileStorage.client.Driver + ")",
+			enabled: cfg.fileStorage.enabled,
+			hint:    "check STORAGE_ENDPOINT, STORAGE_ACCESS_KEY_ID, STORAGE_SECRET_ACCESS_KEY and STORAGE_BUCKET (or the R2_* names), or set STORAGE_ENABLED=false",
+			run: func(ctx context.Context) error {
+				client, err := storage.New(cfg.fileStorage.client)
+				if err != nil {
+					return err
+				}
+				return client.Ping(ctx)
+			},
+		},
+	}...)
+
+	failed := 0
+	for _, check := range checks {
+		if !check.enabled {
+			fmt.Printf("[SKIP] %s (disabled)\n", check.name)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		startTime := time.Now()
+		err := check.run(ctx)
+		cancel()
+
+		if err != nil {
+			failed++
+			fmt.Printf("[FAIL] %s: %v\n", check.name, err)
+			fmt.Printf("       hint: %s\n", check.hint)
+			continue
+		}
+
+		fmt.Printf("[PASS] %s (%v)\n", check.name, time.Since(startTime).Round(time.Millisecond))
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d check(s) failed\n", failed)
+		return 1
+	}
+
+	fmt.Println("\nall checks passed")
+	return 0
+}
+
+// mailDoctorChecks checks every driver of a failover chain on its own
+func mailDoctorChecks(cfg config) []doctorCheck {
+	drivers := mailer.Chain(cfg.mail.driver)
+	if len(drivers) == 0 {
+		// Let mailer.New report the empty driver
+		drivers = []string{cfg.mail.driver}
+	}
+
+	var checks []doctorCheck
+	for _, driver := range drivers {
+		checks = append(checks, doctorCheck{
+			name:    "Mail (" + driver + ")",
+			enabled: true,
+			hint:    mailDoctorHint(driver),
+			run: func(ctx context.Context) error {
+				provider, err := mailer.New(driver, mailerConfig(cfg.mail))
+				if err != nil {
+					return err
+				}
+				return provider.Ping()
+			},
+		})
+	}
+	return checks
+}
+
+func mailDoctorHint(driver string) string {
+	switch driver {
+	case mailer.DriverSMTP:
+		return "check MAIL_HOST, MAIL_PORT, MAIL_USERNAME, MAIL_PASSWORD and MAIL_ENCRYPTION, and that outbound SMTP is not blocked"
+	case mailer.DriverPlunk, "http":
+		return "check PLUNK_API_KEY and that api.useplunk.com is reachable"
+	case mailer.DriverSES:
+		return "check SES_REGION, SES_ACCESS_KEY_ID and SES_SECRET_ACCESS_KEY, and that the sender is verified in SES"
+	default:
+		return "set MAIL_DRIVER to one of " + strings.Join(mailer.Drivers(), ", ")
+	}
+}
+
+// pingNotifier pings the notifier called name, as newNotifier builds it
+func pingNotifier(cfg config, name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		fanout, err := newNotifier(cfg)
+		if err != nil {
+			return err
+		}
+
+		for _, notifier := range fanout.Notifiers() {
+			if notifier.Name() == name {
+				return notifier.Ping()
+			}
+		}
+
+		return fmt.Errorf("%s is not configured", name)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+var (
+	errCampaignTemplate     = errors.New("template cannot be used for a campaign")
+	errCampaignRoleRequired = errors.New("role is required for the role audience")
+	errCampaignFinished     = errors.New("campaign already finished")
+)
+
+type CreateEmailCampaignPayload struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	Template string `json:"template" validate:"required,max=100"`
+	Subject  string `json:"subject" validate:"required,max=255"`
+	Message  string `json:"message" validate:"required,max=10000"`
+	Audience string `json:"audience" validate:"required,oneof=all verified role"`
+	Role     string `json:"role" validate:"max=50"`
+}
+
+// EmailCampaignList is a page of campaigns with the templates a campaign can use
+type EmailCampaignList struct {
+	List[*models.EmailCampaign]
+	Templates []string `json:"templates"`
+}
+
+// view keeps templates next to the redacted items
+func (list EmailCampaignList) view(viewer *models.User) any {
+	return struct {
+		List[any]
+		Templates []string `json:"templates"`
+	}{list.List.views(viewer), list.Templates}
+}
+
+// createEmailCampaignHandler picks the recipients of a campaign, the cron job then hands
+// them to the mail queue a batch per minute
+//
+// @Summary  Create an email campaign
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    payload body CreateEmailCampaignPayload true "Request body"
+// @Success  201 {object} Response[models.EmailCampaign]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/email-campaigns [post]
+func (app *application) createEmailCampaignHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload CreateEmailCampaignPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	if !slices.Contains(mailer.CampaignTemplates, payload.Template) {
+		app.unprocessableEntityResponse(writer, request, errCampaignTemplate)
+		return
+	}
+
+	ctx := request.Context()
+
+	if payload.Audience == models.AudienceRole {
+		if payload.Role == "" {
+			app.unprocessableEntityResponse(writer, request, errCampaignRoleRequired)
+			return
+		}
+
+		if _, err := app.store.Roles.GetByName(ctx, payload.Role); err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.unprocessableEntityResponse(writer, request, errUnknownRole)
+			default:
+				app.internalServerError(writer, request, err)
+			}
+			return
+		}
+	} else {
+		payload.Role = ""
+	}
+
+	campaign := &models.EmailCampaign{
+		Name:     payload.Name,
+		Template: payload.Template,
+		Subject:  payload.Subject,
+		Message:  payload.Message,
+		Audience: payload.Audience,
+		Role:     payload.Role,
+	}
+
+	if err := app.store.EmailCampaigns.Create(ctx, campaign); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusCreated, "Email campaign created", campaign); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  List email campaigns
+// @Tags     admin
+// @Produce  json
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Param    status query string false "Campaign status"
+// @Success  200 {object} Response[EmailCampaignList]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/email-campaigns [get]
+func (app *application) listEmailCampaignsHandler(writer http.ResponseWriter, request *http.Request) {
+	params, offset, err := parseOffsetPage(request, pagination.Options{DefaultLimit: 20, MaxLimit: 100})
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.EmailCampaignQuery{
+		Limit:  params.Limit,
+		Offset: offset,
+	}
+
+	query, err = query.Parse(request)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	campaigns, err := app.store.EmailCampaigns.List(request.Context(), query)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	page := pagination.OffsetPage(query.Limit, query.Offset, len(campaigns))
+	list := EmailCampaignList{List: newList(campaigns, page), Templates: mailer.CampaignTemplates}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Email campaigns retrieved", list, withCursorPage(page)); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// getEmailCampaignHandler reports the progress of a campaign, its recipients counted per state
+//
+// @Summary  Get an email campaign and its progress
+// @Tags     admin
+// @Produce  json
+// @Param    campaignID path int true "Campaign ID"
+// @Success  200 {object} Response[models.EmailCampaign]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/email-campaigns/{campaignID} [get]
+func (app *application) getEmailCampaignHandler(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(request, "campaignID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	campaign, err := app.store.EmailCampaigns.GetByID(request.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Email campaign retrieved", campaign); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// cancelEmailCampaignHandler stops a campaign, emails already in the mail queue still go out
+//
+// @Summary  Cancel an email campaign
+// @Tags     admin
+// @Produce  json
+// @Param    campaignID path int true "Campaign ID"
+// @Success  200 {object} Response[models.EmailCampaign]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  409 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/email-campaigns/{campaignID}/cancel [post]
+func (app *application) cancelEmailCampaignHandler(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(request, "campaignID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	ctx := request.Context()
+
+	if err := app.store.EmailCampaigns.Cancel(ctx, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(writer, request, errCampaignFinished)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	campaign, err := app.store.EmailCampaigns.GetByID(ctx, id)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Email campaign cancelled", campaign); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
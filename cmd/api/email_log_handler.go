@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+// listEmailLogsHandler pages through every email the API tried to send, filtered by
+// status, recipient, template and a since/until time range
+//
+// @Summary  List the emails the API tried to send
+// @Tags     admin
+// @Produce  json
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Param    sort query string false "created_at for oldest first, -created_at (default) for newest first"
+// @Param    status query string false "Delivery status"
+// @Param    recipient query string false "Recipient address"
+// @Param    template query string false "Template name"
+// @Param    since query string false "RFC 3339 time"
+// @Param    until query string false "RFC 3339 time"
+// @Success  200 {object} Response[List[models.EmailLog]]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/emails [get]
+func (app *application) listEmailLogsHandler(writer http.ResponseWriter, request *http.Request) {
+	params, offset, err := parseOffsetPage(request, createdAtPage(50))
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.EmailLogQuery{
+		Limit:  params.Limit,
+		Offset: offset,
+		Sort:   params.Sort.Direction(),
+	}
+
+	query, err = query.Parse(request)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	logs, err := app.store.EmailLogs.List(request.Context(), query)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	page := pagination.OffsetPage(query.Limit, query.Offset, len(logs))
+
+	if err := writeList(writer, request, "Emails retrieved", logs, page); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
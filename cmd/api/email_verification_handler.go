@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+)
+
+const (
+	// emailVerificationWorkers caps concurrent DNS lookups per job
+	emailVerificationWorkers = 10
+	// emailVerificationTimeout bounds a single address, a job can take far longer
+	emailVerificationTimeout = 5 * time.Second
+	// emailVerificationJobLimit is how many finished reports are kept in memory
+	emailVerificationJobLimit = 100
+)
+
+type VerifyEmailsPayload struct {
+	Emails []string `json:"emails" validate:"required,min=1,max=1000,dive,required,max=255"`
+}
+
+// EmailVerificationStarted is the job to poll for the report
+type EmailVerificationStarted struct {
+	ID string `json:"id"`
+}
+
+type emailVerificationJob struct {
+	ID          string                  `json:"id"`
+	Status      string                  `json:"status"`
+	Total       int                     `json:"total"`
+	Summary     map[string]int          `json:"summary"`
+	Results     []mailer.AddressVerdict `json:"results"`
+	CreatedAt   time.Time               `json:"created_at"`
+	CompletedAt *time.Time              `json:"completed_at,omitempty"`
+}
+
+// emailVerificationJobs holds the reports of this instance in memory
+type emailVerificationJobs struct {
+	sync.Mutex
+	jobs  map[string]*emailVerificationJob
+	order []string
+	limit int
+}
+
+func newEmailVerificationJobs(limit int) *emailVerificationJobs {
+	return &emailVerificationJobs{
+		jobs:  make(map[string]*emailVerificationJob),
+		limit: limit,
+	}
+}
+
+func (jobs *emailVerificationJobs) add(job *emailVerificationJob) {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	jobs.jobs[job.ID] = job
+	jobs.order = append(jobs.order, job.ID)
+
+	if len(jobs.order) > jobs.limit {
+		delete(jobs.jobs, jobs.order[0])
+		jobs.order = jobs.order[1:]
+	}
+}
+
+// get returns a copy so the report can be encoded while the job is still running
+func (jobs *emailVerificationJobs) get(id string) (emailVerificationJob, bool) {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	job, ok := jobs.jobs[id]
+	if !ok {
+		return emailVerificationJob{}, false
+	}
+
+	copied := *job
+	copied.Results = append([]mailer.AddressVerdict(nil), job.Results...)
+	copied.Summary = make(map[string]int, len(job.Summary))
+	for verdict, count := range job.Summary {
+		copied.Summary[verdict] = count
+	}
+	return copied, true
+}
+
+func (jobs *emailVerificationJobs) record(job *emailVerificationJob, verdict mailer.AddressVerdict) {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	job.Results = append(job.Results, verdict)
+	job.Summary[verdict.Verdict]++
+}
+
+func (jobs *emailVerificationJobs) complete(job *emailVerificationJob) {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	completedAt := time.Now().UTC()
+	job.Status = "completed"
+	job.CompletedAt = &completedAt
+}
+
+// verifyEmailsHandler starts checking a list of addresses and answers 202 with
+// the job to poll for the report
+//
+// @Summary  Start checking a list of email addresses
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    payload body VerifyEmailsPayload true "Request body"
+// @Success  202 {object} Response[EmailVerificationStarted]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/email-verifications [post]
+func (app *application) verifyEmailsHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload VerifyEmailsPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	job := &emailVerificationJob{
+		ID:        uuid.NewString(),
+		Status:    "running",
+		Total:     len(payload.Emails),
+		Summary:   map[string]int{},
+		Results:   []mailer.AddressVerdict{},
+		CreatedAt: time.Now().UTC(),
+	}
+	app.emailVerifications.add(job)
+
+	go app.runEmailVerification(job, payload.Emails)
+
+	if err := writeJSON(writer, request, http.StatusAccepted, "Email verification started", EmailVerificationStarted{ID: job.ID}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Get the report of an email verification
+// @Tags     admin
+// @Produce  json
+// @Param    jobID path string true "Job ID"
+// @Success  200 {object} Response[emailVerificationJob]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/email-verifications/{jobID} [get]
+func (app *application) getEmailVerificationHandler(writer http.ResponseWriter, request *http.Request) {
+	job, ok := app.emailVerifications.get(chi.URLParam(request, "jobID"))
+	if !ok {
+		app.notFoundResponse(writer, request, errors.New("email verification job not found"))
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Email verification retrieved", job); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+func (app *application) runEmailVerification(job *emailVerificationJob, emails []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			app.logger.Errorw("email verification panicked", "jobID", job.ID, "panic", r)
+		}
+		app.emailVerifications.complete(job)
+	}()
+
+	resolver := &net.Resolver{}
+	queue := make(chan string)
+
+	var wg sync.WaitGroup
+	for i := 0; i < emailVerificationWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for email := range queue {
+				ctx, cancel := context.WithTimeout(context.Background(), emailVerificationTimeout)
+				verdict := mailer.VerifyAddress(ctx, resolver, strings.TrimSpace(email))
+				cancel()
+
+				app.emailVerifications.record(job, verdict)
+			}
+		}()
+	}
+
+	for _, email := range emails {
+		queue <- email
+	}
+	close(queue)
+	wg.Wait()
+
+	app.logger.Infow("email verification completed", "jobID", job.ID, "total", job.Total)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/captcha"
+	"godsendjoseph.dev/sandbox-api/internal/ipaccess"
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	ratelimiter "godsendjoseph.dev/sandbox-api/internal/rateLimiter"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+// ErrorCode is the machine-readable reason of an error response, sent as error_code. Codes
+// are stable: a new reason gets a new code, an existing code never changes meaning.
+type ErrorCode string
+
+// Generic codes, used when the error is not in the catalog
+const (
+	CodeBadRequest         ErrorCode = "BAD_REQUEST"
+	CodeUnauthorized       ErrorCode = "UNAUTHORIZED"
+	CodeForbidden          ErrorCode = "FORBIDDEN"
+	CodeNotFound           ErrorCode = "NOT_FOUND"
+	CodeMethodNotAllowed   ErrorCode = "METHOD_NOT_ALLOWED"
+	CodeUnsupportedVersion ErrorCode = "API_VERSION_UNSUPPORTED"
+	CodeConflict           ErrorCode = "CONFLICT"
+	CodeUnprocessable      ErrorCode = "UNPROCESSABLE_ENTITY"
+	CodeValidationFailed   ErrorCode = "VALIDATION_FAILED"
+	CodePayloadTooLarge    ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedMedia   ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	CodeRateLimited        ErrorCode = "RATE_LIMITED"
+	CodeInternal           ErrorCode = "INTERNAL_ERROR"
+	CodeServiceUnavailable ErrorCode = "SERVICE_UNAVAILABLE"
+)
+
+const (
+	CodeAuthInvalidCredentials ErrorCode = "AUTH_INVALID_CREDENTIALS"
+	CodeAuthAccountNotVerified ErrorCode = "AUTH_ACCOUNT_NOT_VERIFIED"
+	CodeAuthOTPInvalid         ErrorCode = "AUTH_OTP_INVALID"
+	CodeAuthOTPExpired         ErrorCode = "AUTH_OTP_EXPIRED"
+	CodeAuthSessionExpired     ErrorCode = "AUTH_SESSION_EXPIRED"
+	CodeAuthTokenInvalid       ErrorCode = "AUTH_TOKEN_INVALID"
+	CodeAuthTokenExpired       ErrorCode = "AUTH_TOKEN_EXPIRED"
+	CodeAuthTwoFactorRequired  ErrorCode = "AUTH_TWO_FACTOR_REQUIRED"
+	CodeAuthTwoFactorInvalid   ErrorCode = "AUTH_TWO_FACTOR_INVALID"
+	CodeAuthTwoFactorLocked    ErrorCode = "AUTH_TWO_FACTOR_LOCKED"
+	CodeTwoFactorEnabled       ErrorCode = "TWO_FACTOR_ALREADY_ENABLED"
+	CodeTwoFactorNotEnabled    ErrorCode = "TWO_FACTOR_NOT_ENABLED"
+	CodeTwoFactorNotStarted    ErrorCode = "TWO_FACTOR_NOT_STARTED"
+	CodeUserDuplicateEmail     ErrorCode = "USER_DUPLICATE_EMAIL"
+	CodeUserDuplicateUsername  ErrorCode = "USER_DUPLICATE_USERNAME"
+	CodeUserFollowSelf         ErrorCode = "USER_FOLLOW_SELF"
+	CodeUserSamePassword       ErrorCode = "USER_SAME_PASSWORD"
+	CodeUserRoleUnknown        ErrorCode = "USER_ROLE_UNKNOWN"
+	CodeUserRoleSelf           ErrorCode = "USER_ROLE_SELF"
+	CodeInvitationInvalid      ErrorCode = "INVITATION_INVALID"
+	CodeInvitationExpired      ErrorCode = "INVITATION_EXPIRED"
+	CodeInvitationUsed         ErrorCode = "INVITATION_USED"
+	CodeInvitationRole         ErrorCode = "INVITATION_ROLE_ABOVE_OWN"
+	CodeDeviceReportInvalid    ErrorCode = "DEVICE_REPORT_INVALID"
+	CodeDeviceReportExpired    ErrorCode = "DEVICE_REPORT_EXPIRED"
+	CodeDeviceReported         ErrorCode = "DEVICE_ALREADY_REPORTED"
+	CodeImpersonateAdmin       ErrorCode = "IMPERSONATION_ADMIN_TARGET"
+	CodeImpersonating          ErrorCode = "IMPERSONATION_NOT_ALLOWED"
+	CodeImpersonatorRevoked    ErrorCode = "IMPERSONATION_REVOKED"
+	CodeFeedInvalidCursor      ErrorCode = "FEED_INVALID_CURSOR"
+	CodeInvalidCursor          ErrorCode = "PAGINATION_INVALID_CURSOR"
+	CodeInvalidSort            ErrorCode = "PAGINATION_INVALID_SORT"
+	CodeInvalidDeletedScope    ErrorCode = "DELETED_SCOPE_INVALID"
+	CodeCampaignTemplate       ErrorCode = "CAMPAIGN_TEMPLATE_UNKNOWN"
+	CodeCampaignRoleRequired   ErrorCode = "CAMPAIGN_ROLE_REQUIRED"
+	CodeCampaignFinished       ErrorCode = "CAMPAIGN_FINISHED"
+	CodeMailTemplateInvalid    ErrorCode = "MAIL_TEMPLATE_INVALID"
+	CodeMailTemplateUnknown    ErrorCode = "MAIL_TEMPLATE_UNKNOWN"
+	CodeSettingsLocale         ErrorCode = "SETTINGS_LOCALE_UNSUPPORTED"
+	CodeSettingsOptOut         ErrorCode = "SETTINGS_OPT_OUT_UNKNOWN"
+	CodeCSRFToken              ErrorCode = "CSRF_TOKEN_INVALID"
+	CodeCaptchaRequired        ErrorCode = "CAPTCHA_REQUIRED"
+	CodeCaptchaFailed          ErrorCode = "CAPTCHA_FAILED"
+	CodeReadOnlyMode           ErrorCode = "READ_ONLY_MODE"
+	CodeCountryBlocked         ErrorCode = "GEO_COUNTRY_BLOCKED"
+	CodeIPDenied               ErrorCode = "IP_DENIED"
+	CodeIPNotAllowed           ErrorCode = "IP_NOT_ALLOWED"
+	CodeIPListUnknown          ErrorCode = "IP_LIST_UNKNOWN"
+	CodeIPNetworkInvalid       ErrorCode = "IP_NETWORK_INVALID"
+	CodeIPRuleExpiry           ErrorCode = "IP_RULE_EXPIRY_INVALID"
+	CodeIPRuleLockout          ErrorCode = "IP_RULE_LOCKOUT"
+	CodeOverloaded             ErrorCode = "SERVER_OVERLOADED"
+	CodeUserConcurrency        ErrorCode = "TOO_MANY_IN_FLIGHT"
+)
+
+// errorCatalog maps the errors handlers pass to the response helpers onto their code. It
+// is matched with errors.Is, so wrapped errors are found too.
+var errorCatalog = []struct {
+	err  error
+	code ErrorCode
+}{
+	{store.ErrAccountNotVerified, CodeAuthAccountNotVerified},
+	{store.ErrInvalidOTP, CodeAuthOTPInvalid},
+	{errOTPExpired, CodeAuthOTPExpired},
+	{errSessionExpired, CodeAuthSessionExpired},
+	{errInvalidAuthHeader, CodeAuthTokenInvalid},
+	{jwt.ErrTokenExpired, CodeAuthTokenExpired},
+	{jwt.ErrTokenMalformed, CodeAuthTokenInvalid},
+	{jwt.ErrTokenSignatureInvalid, CodeAuthTokenInvalid},
+	{jwt.ErrTokenUnverifiable, CodeAuthTokenInvalid},
+	{jwt.ErrTokenInvalidClaims, CodeAuthTokenInvalid},
+	{errTwoFactorRequired, CodeAuthTwoFactorRequired},
+	{errInvalidTwoFactor, CodeAuthTwoFactorInvalid},
+	{errTwoFactorLocked, CodeAuthTwoFactorLocked},
+	{errTwoFactorEnabled, CodeTwoFactorEnabled},
+	{errTwoFactorNotEnabled, CodeTwoFactorNotEnabled},
+	{errTwoFactorNotStarted, CodeTwoFactorNotStarted},
+	{store.ErrDuplicateEmail, CodeUserDuplicateEmail},
+	{store.ErrDuplicate, CodeUserDuplicateEmail},
+	{store.ErrDuplicateUsername, CodeUserDuplicateUsername},
+	{errFollowSelf, CodeUserFollowSelf},
+	{errSamePassword, CodeUserSamePassword},
+	{errUnknownRole, CodeUserRoleUnknown},
+	{errChangeOwnRole, CodeUserRoleSelf},
+	{errInvitationInvalid, CodeInvitationInvalid},
+	{errInvitationExpired, CodeInvitationExpired},
+	{store.ErrInvitationUsed, CodeInvitationUsed},
+	{errInvitationRole, CodeInvitationRole},
+	{errDeviceReportInvalid, CodeDeviceReportInvalid},
+	{errDeviceReportExpired, CodeDeviceReportExpired},
+	{store.ErrDeviceReported, CodeDeviceReported},
+	{errImpersonateAdmin, CodeImpersonateAdmin},
+	{errImpersonating, CodeImpersonating},
+	{errImpersonatorRevoked, CodeImpersonatorRevoked},
+	{store.ErrInvalidCursor, CodeFeedInvalidCursor},
+	{pagination.ErrInvalidCursor, CodeInvalidCursor},
+	{pagination.ErrInvalidSort, CodeInvalidSort},
+	{store.ErrInvalidDeleted, CodeInvalidDeletedScope},
+	{errCampaignTemplate, CodeCampaignTemplate},
+	{errCampaignRoleRequired, CodeCampaignRoleRequired},
+	{errCampaignFinished, CodeCampaignFinished},
+	{errMailTemplateInvalid, CodeMailTemplateInvalid},
+	{mailer.ErrUnknownTemplate, CodeMailTemplateUnknown},
+	{errUnsupportedLocale, CodeSettingsLocale},
+	{errUnknownOptOut, CodeSettingsOptOut},
+	{errCSRFToken, CodeCSRFToken},
+	{captcha.ErrMissingToken, CodeCaptchaRequired},
+	{captcha.ErrFailed, CodeCaptchaFailed},
+	{errReadOnly, CodeReadOnlyMode},
+	{errCountryBlocked, CodeCountryBlocked},
+	{errIPDenied, CodeIPDenied},
+	{errIPNotAllowed, CodeIPNotAllowed},
+	{ipaccess.ErrUnknownList, CodeIPListUnknown},
+	{ipaccess.ErrInvalidNetwork, CodeIPNetworkInvalid},
+	{errIPRuleExpiry, CodeIPRuleExpiry},
+	{errIPRuleLockout, CodeIPRuleLockout},
+	{ratelimiter.ErrOverloaded, CodeOverloaded},
+	{ratelimiter.ErrKeyConcurrency, CodeUserConcurrency},
+}
+
+// errorCodeFor returns the catalog code of err, fallback when it has none
+func errorCodeFor(err error, fallback ErrorCode) ErrorCode {
+	if err == nil {
+		return fallback
+	}
+
+	for _, entry := range errorCatalog {
+		if errors.Is(err, entry.err) {
+			return entry.code
+		}
+	}
+	return fallback
+}
@@ -1,64 +1,152 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
+	"godsendjoseph.dev/sandbox-api/internal/store"
 )
 
+// duplicateFields names the request field behind each duplicate error, so clients can
+// highlight it the same way as a validation failure
+var duplicateFields = map[error]string{
+	store.ErrDuplicateEmail:    "email",
+	store.ErrDuplicateUsername: "username",
+}
+
 func (app *application) internalServerError(writer http.ResponseWriter, request *http.Request, err error) {
-	app.logger.Errorw("internal server error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
-	app.slackNotifier.NotifyServerError(err, request)
-	writeJSONError(writer, http.StatusInternalServerError, "the server encountered a problem and could not process your request", nil)
+	app.loggerFor(request).Errorw("internal server error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusInternalServerError, err)
+	app.notifier.NotifyServerError(err, request)
+	writeJSONError(writer, request, http.StatusInternalServerError, CodeInternal, "the server encountered a problem and could not process your request", nil)
 }
 
 func (app *application) badRequestResponse(writer http.ResponseWriter, request *http.Request, err error) {
-	app.logger.Errorw("bad request error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
-	writeJSONError(writer, http.StatusBadRequest, err.Error(), nil)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		app.payloadTooLargeResponse(writer, request, maxBytesErr)
+		return
+	}
+
+	app.loggerFor(request).Errorw("bad request error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusBadRequest, err)
+	writeJSONError(writer, request, http.StatusBadRequest, errorCodeFor(err, CodeBadRequest), err.Error(), nil)
+}
+
+// unprocessableEntityResponse is for requests that parsed fine but break a business rule
+func (app *application) unprocessableEntityResponse(writer http.ResponseWriter, request *http.Request, err error) {
+	app.loggerFor(request).Errorw("unprocessable entity error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusUnprocessableEntity, err)
+	writeJSONError(writer, request, http.StatusUnprocessableEntity, errorCodeFor(err, CodeUnprocessable), err.Error(), nil)
+}
+
+func (app *application) payloadTooLargeResponse(writer http.ResponseWriter, request *http.Request, err *http.MaxBytesError) {
+	app.loggerFor(request).Warnw("payload too large error", "method", request.Method, "path", request.URL.Path, "limit", err.Limit)
+	app.trackError(request, http.StatusRequestEntityTooLarge, err)
+	writeJSONError(writer, request, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, i18n.Translate(request.Context(), "request body must not be larger than {limit} KB", "limit", strconv.FormatInt(err.Limit>>10, 10)), nil)
+}
+
+func (app *application) unsupportedMediaTypeResponse(writer http.ResponseWriter, request *http.Request, err error) {
+	app.loggerFor(request).Warnw("unsupported media type error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusUnsupportedMediaType, err)
+	writeJSONError(writer, request, http.StatusUnsupportedMediaType, CodeUnsupportedMedia, err.Error(), nil)
+}
+
+func (app *application) notAcceptableResponse(writer http.ResponseWriter, request *http.Request, err error) {
+	app.loggerFor(request).Warnw("not acceptable error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusNotAcceptable, err)
+	writeJSONError(writer, request, http.StatusNotAcceptable, CodeUnsupportedVersion, err.Error(), nil)
 }
+
 func (app *application) methodNotAllowedResponse(writer http.ResponseWriter, request *http.Request, err error) {
-	app.logger.Errorf("method not allowed error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
-	_ = writeJSONError(writer, http.StatusMethodNotAllowed, "method not allowed", nil)
+	app.loggerFor(request).Errorw("method not allowed error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusMethodNotAllowed, err)
+	_ = writeJSONError(writer, request, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed", nil)
 }
 
 func (app *application) notFoundResponse(writer http.ResponseWriter, request *http.Request, err error) {
-	app.logger.Errorf("not found error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.loggerFor(request).Errorw("not found error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusNotFound, err)
 	if app.isCriticalResource(request.URL.Path) {
-		app.slackNotifier.NotifyNotFound(err, request)
+		app.notifier.NotifyNotFound(err, request)
 	}
 
-	writeJSONError(writer, http.StatusNotFound, "not found", nil)
+	writeJSONError(writer, request, http.StatusNotFound, CodeNotFound, "not found", nil)
 }
 
 func (app *application) conflictResponse(writer http.ResponseWriter, request *http.Request, err error) {
-	app.logger.Errorf("conflict error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
-	writeJSONError(writer, http.StatusConflict, "resource already exists", nil)
+	app.loggerFor(request).Errorw("conflict error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusConflict, err)
+	writeJSONError(writer, request, http.StatusConflict, errorCodeFor(err, CodeConflict), err.Error(), conflictFields(err))
+}
+
+// conflictFields returns the errors map of a duplicate error, nil for any other conflict
+func conflictFields(err error) map[string]string {
+	for target, field := range duplicateFields {
+		if errors.Is(err, target) {
+			return map[string]string{field: "already in use"}
+		}
+	}
+	return nil
 }
 
 func (app *application) forbiddenResponseError(writer http.ResponseWriter, request *http.Request) {
-	app.logger.Warnw("forbidden error", "method", request.Method, "path", request.URL.Path)
-	app.slackNotifier.NotifyForbidden(request)
-	writeJSONError(writer, http.StatusForbidden, "request is forbidden", nil)
+	app.loggerFor(request).Warnw("forbidden error", "method", request.Method, "path", request.URL.Path)
+	app.trackError(request, http.StatusForbidden, nil)
+	app.notifier.NotifyForbidden(request)
+	writeJSONError(writer, request, http.StatusForbidden, CodeForbidden, "request is forbidden", nil)
+}
+
+// forbiddenResponse is forbiddenResponseError with a reason the client can act on, it is not
+// sent to Slack
+func (app *application) forbiddenResponse(writer http.ResponseWriter, request *http.Request, err error) {
+	app.loggerFor(request).Warnw("forbidden error", "method", request.Method, "path", request.URL.Path, "error", err)
+	app.trackError(request, http.StatusForbidden, err)
+	writeJSONError(writer, request, http.StatusForbidden, errorCodeFor(err, CodeForbidden), err.Error(), nil)
 }
 
 func (app *application) unauthorizedErrorResponse(writer http.ResponseWriter, request *http.Request, err error) {
-	app.logger.Errorf("unauthorized error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
-	writeJSONError(writer, http.StatusUnauthorized, err.Error(), nil)
+	app.loggerFor(request).Errorw("unauthorized error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusUnauthorized, err)
+	writeJSONError(writer, request, http.StatusUnauthorized, errorCodeFor(err, CodeUnauthorized), err.Error(), nil)
 }
 
 func (app *application) unauthorizedPwdErrorResponse(writer http.ResponseWriter, request *http.Request, err error) {
-	app.logger.Errorf("unauthorized password error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
-	writeJSONError(writer, http.StatusUnauthorized, "password is incorrect", nil)
+	app.loggerFor(request).Errorw("unauthorized password error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusUnauthorized, err)
+	writeJSONError(writer, request, http.StatusUnauthorized, CodeAuthInvalidCredentials, "password is incorrect", nil)
 }
 
 func (app *application) unauthorizedBasicErrorResponse(writer http.ResponseWriter, request *http.Request, err error) {
-	app.logger.Errorf("unauthorized basic error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.loggerFor(request).Errorw("unauthorized basic error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusUnauthorized, err)
 	writer.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
-	writeJSONError(writer, http.StatusUnauthorized, "unauthorized", nil)
+	writeJSONError(writer, request, http.StatusUnauthorized, CodeUnauthorized, "unauthorized", nil)
 }
 
 func (app *application) rateLimitExceededResponse(writer http.ResponseWriter, request *http.Request, retryAfter string) {
-	app.logger.Warnw("rate limit error", "method", request.Method, "path", request.URL.Path, "error", retryAfter)
+	app.loggerFor(request).Warnw("rate limit error", "method", request.Method, "path", request.URL.Path, "error", retryAfter)
+	app.trackError(request, http.StatusTooManyRequests, nil)
 	writer.Header().Set("Retry-After", retryAfter)
-	writeJSONError(writer, http.StatusTooManyRequests, "rate limit exceeded", nil)
+	writeJSONError(writer, request, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded", nil)
+}
+
+func (app *application) serviceUnavailableResponse(writer http.ResponseWriter, request *http.Request, err error) {
+	app.loggerFor(request).Warnw("service unavailable error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusServiceUnavailable, err)
+	writer.Header().Set("Retry-After", "60")
+	writeJSONError(writer, request, http.StatusServiceUnavailable, errorCodeFor(err, CodeServiceUnavailable), err.Error(), nil)
+}
+
+// overloadedResponse is serviceUnavailableResponse for requests shed under load, which are
+// worth retrying after CONCURRENCY_RETRY_AFTER rather than a minute
+func (app *application) overloadedResponse(writer http.ResponseWriter, request *http.Request, err error) {
+	app.loggerFor(request).Warnw("overloaded error", "method", request.Method, "path", request.URL.Path, "error", err.Error())
+	app.trackError(request, http.StatusServiceUnavailable, err)
+	writer.Header().Set("Retry-After", strconv.Itoa(int(app.config.concurrency.retryAfter.Seconds())))
+	writeJSONError(writer, request, http.StatusServiceUnavailable, errorCodeFor(err, CodeServiceUnavailable), err.Error(), nil)
 }
 
 func (app *application) isCriticalResource(path string) bool {
@@ -67,6 +155,7 @@ func (app *application) isCriticalResource(path string) bool {
 		"/v1/payments",
 	}
 
+	path = canonicalPath(path)
 	for _, url := range criticalUrls {
 		if url == path {
 			return true
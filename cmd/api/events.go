@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/events"
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/outbox"
+	"godsendjoseph.dev/sandbox-api/internal/realtime"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+	"godsendjoseph.dev/sandbox-api/internal/webhook"
+)
+
+// subscribeEvents registers the side effects of every event. The ones that must not be
+// lost go through the outbox instead, see subscribeOutbox.
+func (app *application) subscribeEvents() {
+	events.Subscribe(app.events, func(ctx context.Context, event events.UserRegistered) error {
+		return app.webhooks.Emit(ctx, webhook.UserRegistered, event)
+	})
+	events.Subscribe(app.events, func(ctx context.Context, event events.UserVerified) error {
+		return app.webhooks.Emit(ctx, webhook.UserVerified, event)
+	})
+	events.Subscribe(app.events, func(ctx context.Context, event events.PostCreated) error {
+		return app.webhooks.Emit(ctx, webhook.PostCreated, event)
+	})
+	events.Subscribe(app.events, app.pushFeedUpdate)
+	events.Subscribe(app.events, app.forwardSupportTicket)
+	events.Subscribe(app.events, app.mailSupportResponse)
+	events.Subscribe(app.events, app.mailNewSignIn)
+	events.Subscribe(app.events, app.alertNewSignIn)
+	events.Subscribe(app.events, app.alertSignInReported)
+
+	// in-app notifications
+	events.Subscribe(app.events, func(ctx context.Context, event events.UserFollowed) error {
+		return app.notifyUser(ctx, event.UserID, &event.FollowerID, models.NotificationNewFollower, map[string]any{
+			"follower_id": event.FollowerID,
+			"username":    event.FollowerUsername,
+		})
+	})
+	events.Subscribe(app.events, func(ctx context.Context, event events.SupportTicketAnswered) error {
+		if event.UserID == nil {
+			return nil
+		}
+		return app.notifyUser(ctx, *event.UserID, nil, models.NotificationTicketAnswered, map[string]any{
+			"ticket_id": event.TicketID,
+			"subject":   event.Subject,
+			"status":    event.Status,
+		})
+	})
+}
+
+// subscribeOutbox registers the handlers of the outbox messages, written in the same
+// transaction as the change that causes them and retried until they succeed
+func (app *application) subscribeOutbox() {
+	outbox.Subscribe(app.outbox, app.sendVerificationEmail)
+}
+
+// sendVerificationEmail mails a new code to a user who registered. A user verified or
+// deleted in the meantime gets nothing.
+func (app *application) sendVerificationEmail(ctx context.Context, message outbox.VerificationEmail) error {
+	// by email, GetByID only returns verified users
+	user, err := app.store.Users.GetByEmail(store.ContextWithPrimary(ctx), message.Email, false)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.ID != message.UserID || user.IsActive {
+		return nil
+	}
+
+	otpCode, err := models.GenerateOTP()
+	if err != nil {
+		return err
+	}
+	otpCodeExpiring := time.Now().Add(5 * time.Minute)
+
+	if err := app.store.Users.UpdateOTPCode(ctx, user, otpCode, otpCodeExpiring.Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	// sent before the message is deleted, a failure is retried with a new code
+	ctx = i18n.WithLocale(ctx, message.Locale)
+	return app.sendOTP(ctx, user, "Finish up your Registration", otpCode, otpCodeExpiring, mailer.UserWelcomeTemplate, mailer.SyncDelivery)
+}
+
+// pushFeedUpdate tells the open streams of the author's followers a post joined their feed
+func (app *application) pushFeedUpdate(ctx context.Context, event events.PostCreated) error {
+	followerIDs, err := app.store.Followers.FollowerIDs(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+
+	return app.realtime.Publish(ctx, followerIDs, realtime.TypeFeed, event)
+}
+
+// publishEvent hands event to the bus. A failure is only logged, the request that caused
+// the event has already succeeded.
+func (app *application) publishEvent(ctx context.Context, event events.Event) {
+	if err := app.events.Publish(ctx, event); err != nil {
+		app.logger.Errorw("failed to publish event", "event", event.EventName(), "error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+	"godsendjoseph.dev/sandbox-api/internal/store/cache"
+)
+
+// feedPage are the page options of the feed, it is always newest first
+var feedPage = pagination.Options{DefaultLimit: 20, MaxLimit: 50}
+
+// @Summary  Get the feed of the current user
+// @Tags     posts
+// @Produce  json
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Success  200 {object} Response[List[models.Post]]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /feed [get]
+func (app *application) getUserFeedHandler(writer http.ResponseWriter, request *http.Request) {
+	params, err := pagination.Parse(request, feedPage)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.FeedQuery{
+		Limit:  params.Limit,
+		Cursor: params.Cursor,
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	ctx := request.Context()
+	user := getUserFromCtx(request)
+
+	// only the first page is cached, later pages are cheap thanks to the cursor
+	isFirstPage := query.Cursor == ""
+	if isFirstPage {
+		page, err := app.cacheStorage.Feeds.Get(ctx, user.ID, query.Limit)
+		if err != nil {
+			app.loggerFor(request).Warnw("error reading feed from cache", "userID", user.ID, "error", err)
+		} else if page != nil {
+			app.writeFeed(writer, request, page)
+			return
+		}
+	}
+
+	posts, nextCursor, err := app.store.Posts.GetFeed(ctx, user.ID, query)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	page := &cache.FeedPage{
+		Posts:      posts,
+		NextCursor: nextCursor,
+	}
+
+	if isFirstPage {
+		if err := app.cacheStorage.Feeds.Set(ctx, user.ID, query.Limit, page); err != nil {
+			app.loggerFor(request).Warnw("error writing feed to cache", "userID", user.ID, "error", err)
+		}
+	}
+
+	app.writeFeed(writer, request, page)
+}
+
+func (app *application) writeFeed(writer http.ResponseWriter, request *http.Request, page *cache.FeedPage) {
+	if err := writeList(writer, request, "Feed retrieved", page.Posts, pagination.Page{NextCursor: page.NextCursor}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"godsendjoseph.dev/sandbox-api/internal/models"
 	"godsendjoseph.dev/sandbox-api/internal/storage"
+	"godsendjoseph.dev/sandbox-api/internal/store"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -34,6 +38,33 @@ func (app *application) deleteFile(ctx context.Context, fileKey string) error {
 		}
 	}
 
+	// files uploaded before the files table existed have no row
+	if err := app.store.Files.DeleteByKey(ctx, fileKey); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to delete file record: %w", err)
+	}
+
+	return nil
+}
+
+// recordFile adds a stored object to the files table. When that fails the object is
+// deleted again, an untracked upload would only be found by the orphan cleanup.
+func (app *application) recordFile(ctx context.Context, ownerID *int64, key, contentType string, size int64, checksum string) error {
+	file := &models.File{
+		Key:         key,
+		UserID:      ownerID,
+		Size:        size,
+		ContentType: contentType,
+		Checksum:    checksum,
+		Status:      models.FileActive,
+	}
+
+	if err := app.store.Files.Create(ctx, file); err != nil {
+		if deleteErr := app.deleteFile(ctx, key); deleteErr != nil {
+			app.logger.Warnw("failed to delete untracked upload", "key", key, "error", deleteErr)
+		}
+		return fmt.Errorf("failed to record file: %w", err)
+	}
+
 	return nil
 }
 
@@ -47,7 +78,7 @@ func (app *application) uploadFile(writer http.ResponseWriter, request *http.Req
 	fileExt = strings.ToLower(filepath.Ext(fileHeader.Filename))
 
 	if !allowedExtensions[fileExt] {
-		app.badRequestResponse(writer, request, errors.New("invalid file extension"))
+		app.unprocessableEntityResponse(writer, request, errors.New("invalid file extension"))
 		return errors.New("invalid file extension"), "", ""
 	}
 
@@ -61,7 +92,19 @@ func (app *application) uploadFile(writer http.ResponseWriter, request *http.Req
 	}
 	defer file.Close()
 
+	// hash before storing, the upload needs the file from the start again
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		app.internalServerError(writer, request, err)
+		return err, "", ""
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(writer, request, err)
+		return err, "", ""
+	}
+
 	var fileKey, fileURL string
+	var contentType = storage.GetContentType(fileHeader.Filename)
 
 	if app.config.env == "development" {
 		// LOCAL STORAGE (your existing code)
@@ -94,16 +137,13 @@ func (app *application) uploadFile(writer http.ResponseWriter, request *http.Req
 			return errors.New("storage service not available"), "", ""
 		}
 
-		// Get content type
-		contentType := storage.GetContentType(fileHeader.Filename)
-
 		// Generate R2 key
 		r2Key := fmt.Sprintf("categories/%s", newFilename)
 
 		// Upload to R2
 		result, err := app.storageClient.UploadFile(request.Context(), r2Key, file, contentType, fileHeader.Size)
 		if err != nil {
-			app.logger.Errorw("Failed to upload to R2", "error", err)
+			app.loggerFor(request).Errorw("Failed to upload to R2", "error", err)
 			app.internalServerError(writer, request, errors.New("failed to upload file"))
 			return err, "", ""
 		}
@@ -113,5 +153,15 @@ func (app *application) uploadFile(writer http.ResponseWriter, request *http.Req
 		fileURL = result.URL
 	}
 
+	var ownerID *int64
+	if user := getUserFromCtx(request); user != nil {
+		ownerID = &user.ID
+	}
+
+	if err := app.recordFile(request.Context(), ownerID, fileKey, contentType, fileHeader.Size, hex.EncodeToString(hash.Sum(nil))); err != nil {
+		app.internalServerError(writer, request, err)
+		return err, "", ""
+	}
+
 	return nil, fileKey, fileURL
 }
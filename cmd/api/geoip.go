@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"godsendjoseph.dev/sandbox-api/internal/geoip"
+)
+
+var errCountryBlocked = errors.New("requests from your country are not accepted")
+
+// GeoBlockMiddleware refuses requests from GEOIP_BLOCKED_COUNTRIES. Addresses the database
+// does not know, such as private networks, are let through.
+func (app *application) GeoBlockMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if len(app.config.geoip.blockedCountries) > 0 && slices.Contains(app.config.geoip.blockedCountries, app.location(request).Country) {
+			app.forbiddenResponse(writer, request, errCountryBlocked)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// location is where the client of request is registered, empty without Geo-IP
+func (app *application) location(request *http.Request) geoip.Location {
+	return app.geoip.Lookup(clientIP(request))
+}
+
+// strictCountry reports whether the client of request is in GEOIP_STRICT_COUNTRIES
+func (app *application) strictCountry(request *http.Request) bool {
+	if len(app.config.geoip.strictCountries) == 0 {
+		return false
+	}
+	return slices.Contains(app.config.geoip.strictCountries, app.location(request).Country)
+}
+
+// addLocationFields annotates the fields of a notification about request with its country
+// and network
+func (app *application) addLocationFields(request *http.Request, fields map[string]string) {
+	app.location(request).AddFields(fields)
+}
+
+// countryCodes reads a comma-separated list of ISO country codes, in upper case like the
+// databases
+func countryCodes(value string) []string {
+	codes := splitList(value)
+	for i, code := range codes {
+		codes[i] = strings.ToUpper(code)
+	}
+	return codes
+}
@@ -1,16 +1,124 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// readinessTimeout bounds every dependency probe so a hung dependency fails the check instead of blocking it
+const readinessTimeout = 2 * time.Second
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Health is the environment and the build the API runs
+type Health struct {
+	Env      string `json:"env"`
+	Versions string `json:"versions"`
+}
+
+// @Summary Report the health of the API
+// @Tags    health
+// @Produce json
+// @Success 200 {object} Response[Health]
+// @Failure 500 {object} ErrorResponse
+// @Router  /health [get]
 func (app *application) healthCheckHandler(writer http.ResponseWriter, request *http.Request) {
-	data := map[string]any{
-		"env":      app.config.env,
-		"versions": version,
+	health := Health{Env: app.config.env, Versions: version}
+
+	if err := writeJSON(writer, request, http.StatusOK, "API is healthy running in "+app.config.env+" mode", health); err != nil {
+		app.internalServerError(writer, request, err)
+	}
+}
+
+// livenessHandler only reports that the process is serving requests, it never touches dependencies
+//
+// @Summary Report that the process is serving requests
+// @Tags    health
+// @Produce json
+// @Success 200 {object} Response[any]
+// @Failure 500 {object} ErrorResponse
+// @Router  /health/live [get]
+func (app *application) livenessHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := writeMessage(writer, request, http.StatusOK, "API is live"); err != nil {
+		app.internalServerError(writer, request, err)
+	}
+}
+
+// readinessHandler answers 503 when any enabled dependency cannot be reached
+//
+// @Summary Report whether every enabled dependency can be reached
+// @Tags    health
+// @Produce json
+// @Success 200 {object} Response[map[string]dependencyStatus]
+// @Failure 500 {object} ErrorResponse
+// @Router  /health/ready [get]
+func (app *application) readinessHandler(writer http.ResponseWriter, request *http.Request) {
+	dependencies := probeAll(request.Context(), app.dependencyProbes())
+
+	httpStatus, message := http.StatusOK, "API is ready"
+	for name, status := range dependencies {
+		if status.Status != "up" {
+			app.logger.Warnw("readiness probe failed", "dependency", name, "error", status.Error)
+			httpStatus, message = http.StatusServiceUnavailable, "API is not ready"
+		}
 	}
 
-	if err := writeJSON(writer, http.StatusOK, "API is healthy running in "+app.config.env+" mode", data); err != nil {
+	if err := writeJSON(writer, request, httpStatus, message, dependencies); err != nil {
 		app.internalServerError(writer, request, err)
 	}
 }
+
+// dependencyProbes are the enabled dependencies the API cannot serve without
+func (app *application) dependencyProbes() map[string]func(ctx context.Context) error {
+	probes := map[string]func(ctx context.Context) error{
+		"mysql": app.db.PingContext,
+	}
+	if app.config.redisCfg.enabled && app.redisClient != nil {
+		probes["redis"] = func(ctx context.Context) error {
+			return app.redisClient.Ping(ctx).Err()
+		}
+	}
+	if app.storageClient != nil {
+		probes["storage"] = app.storageClient.Ping
+	}
+	return probes
+}
+
+// probeAll runs the probes concurrently, each bounded by readinessTimeout
+func probeAll(ctx context.Context, probes map[string]func(ctx context.Context) error) map[string]dependencyStatus {
+	dependencies := make(map[string]dependencyStatus, len(probes))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, probe := range probes {
+		wg.Add(1)
+		go func(name string, probe func(ctx context.Context) error) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := probe(ctx)
+
+			status := dependencyStatus{Status: "up", LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = "down"
+				status.Error = err.Error()
+			}
+
+			mutex.Lock()
+			dependencies[name] = status
+			mutex.Unlock()
+		}(name, probe)
+	}
+	wg.Wait()
+
+	return dependencies
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+const impersonatorCtx contextKey = "impersonator"
+
+var (
+	errImpersonateAdmin    = errors.New("admins cannot be impersonated")
+	errImpersonating       = errors.New("not allowed while impersonating a user")
+	errImpersonatorRevoked = errors.New("impersonator is no longer an admin")
+)
+
+type ImpersonatePayload struct {
+	// Reason is kept in the audit log, e.g. the support ticket being debugged
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// Impersonation is a token that acts as User until ExpiresAt
+type Impersonation struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      *models.User `json:"user"`
+}
+
+func (impersonation Impersonation) view(viewer *models.User) any {
+	return struct {
+		Impersonation
+		User any `json:"user"`
+	}{impersonation, serialize(impersonation.User, viewer)}
+}
+
+// impersonateUserHandler mints a short-lived token that acts as the user. The admin is
+// named in the act claim of the token and every request made with it is audit-logged.
+//
+// @Summary  Create a token that acts as a user
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    userID path int true "User ID"
+// @Param    payload body ImpersonatePayload true "Request body"
+// @Success  201 {object} Response[Impersonation]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/users/{userID}/impersonate [post]
+func (app *application) impersonateUserHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload ImpersonatePayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	admin := getUserFromCtx(request)
+	user := getUserParamFromCtx(request)
+
+	// this also covers admins impersonating themselves
+	isAdmin, err := app.checkRolePrecedence(request.Context(), user, "admin")
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+	if isAdmin {
+		app.unprocessableEntityResponse(writer, request, errImpersonateAdmin)
+		return
+	}
+
+	token, expiresAt, err := app.generateImpersonationToken(user, admin)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.audit(request, models.AuditImpersonationStart, user.ID, map[string]any{
+		"reason":     payload.Reason,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	})
+
+	impersonation := Impersonation{Token: token, ExpiresAt: expiresAt.UTC().Truncate(time.Second), User: user}
+
+	if err := writeJSON(writer, request, http.StatusCreated, "Impersonation token created", impersonation); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// generateImpersonationToken issues a token for user with admin as the actor (RFC 8693).
+// It lasts impersonationExp and cannot be refreshed.
+func (app *application) generateImpersonationToken(user, admin *models.User) (string, time.Time, error) {
+	now := time.Now()
+	exp := now.Add(app.config.auth.token.impersonationExp)
+
+	claims := jwt.MapClaims{
+		"sub":       user.ID,
+		"act":       map[string]any{"sub": admin.ID},
+		"exp":       exp.Unix(),
+		"iat":       now.Unix(),
+		"nbf":       now.Unix(),
+		"auth_time": now.Unix(),
+		"iss":       app.config.auth.token.issuer,
+		"aud":       app.config.auth.token.audience,
+	}
+
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		app.logger.Errorw("error generating impersonation token", "error", err)
+		return "", time.Time{}, err
+	}
+	return token, exp, nil
+}
+
+// impersonator returns the admin named in the act claim, nil for a regular token. The
+// token stops working as soon as that account is no longer an admin.
+func (app *application) impersonator(ctx context.Context, claims jwt.MapClaims) (*models.User, error) {
+	act, ok := claims["act"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	adminID, err := strconv.ParseInt(fmt.Sprintf("%.f", act["sub"]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := app.getUser(ctx, adminID)
+	if err != nil {
+		return nil, err
+	}
+
+	isAdmin, err := app.checkRolePrecedence(ctx, admin, "admin")
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, errImpersonatorRevoked
+	}
+
+	return admin, nil
+}
+
+// serveImpersonated runs an impersonated request and records it with its status
+func (app *application) serveImpersonated(writer http.ResponseWriter, request *http.Request, next http.Handler) {
+	wrapped := middleware.NewWrapResponseWriter(writer, request.ProtoMajor)
+	next.ServeHTTP(wrapped, request)
+
+	app.audit(request, models.AuditImpersonatedRequest, getUserFromCtx(request).ID, map[string]any{
+		"method": request.Method,
+		"path":   request.URL.Path,
+		"status": wrapped.Status(),
+	})
+}
+
+// denyImpersonation keeps impersonated sessions away from the credentials and the
+// existence of the account
+func (app *application) denyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if getImpersonatorFromCtx(request) != nil {
+			app.forbiddenResponse(writer, request, errImpersonating)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+func getImpersonatorFromCtx(request *http.Request) *models.User {
+	admin, _ := request.Context().Value(impersonatorCtx).(*models.User)
+	return admin
+}
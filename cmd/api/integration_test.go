@@ -0,0 +1,256 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-sql-driver/mysql"
+
+	"godsendjoseph.dev/sandbox-api/internal/db"
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
+	"godsendjoseph.dev/sandbox-api/internal/migrations"
+	"godsendjoseph.dev/sandbox-api/internal/mocks"
+	"godsendjoseph.dev/sandbox-api/internal/outbox"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+	"godsendjoseph.dev/sandbox-api/internal/store/cache"
+)
+
+// The integration suite runs the handlers on MySQL and Redis, with the migrations of the
+// repository applied:
+//
+//	go test -tags=integration ./cmd/api/
+//
+// It starts throwaway mysql:8.0 and redis:alpine containers with the docker CLI, unless
+// INTEGRATION_DB_ADDR (user:password@tcp(host:port)/database) and INTEGRATION_REDIS_ADDR
+// point it at running ones. Their data is not cleaned up, use an empty database.
+var (
+	integrationDB    *sql.DB
+	integrationRedis *redis.Client
+)
+
+const integrationDBPassword = "integration"
+
+func TestMain(m *testing.M) {
+	var containers []string
+	cleanup := func() {
+		for _, id := range containers {
+			exec.Command("docker", "rm", "-f", id).Run()
+		}
+	}
+
+	dsn := os.Getenv("INTEGRATION_DB_ADDR")
+	if dsn == "" {
+		id, address, err := startContainer("mysql:8.0", "3306/tcp",
+			"-e", "MYSQL_ROOT_PASSWORD="+integrationDBPassword, "-e", "MYSQL_DATABASE=sandbox")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		containers = append(containers, id)
+		dsn = fmt.Sprintf("root:%s@tcp(%s)/sandbox", integrationDBPassword, address)
+	}
+
+	redisAddr := os.Getenv("INTEGRATION_REDIS_ADDR")
+	if redisAddr == "" {
+		id, address, err := startContainer("redis:alpine", "6379/tcp")
+		if err != nil {
+			cleanup()
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		containers = append(containers, id)
+		redisAddr = address
+	}
+
+	if err := connectIntegrationServices(dsn, redisAddr); err != nil {
+		cleanup()
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+
+	integrationDB.Close()
+	integrationRedis.Close()
+	cleanup()
+	os.Exit(code)
+}
+
+// startContainer runs image detached with port published on a random local port and
+// returns the container and the host:port to reach it on
+func startContainer(image, port string, args ...string) (string, string, error) {
+	run := append([]string{"run", "-d", "--rm", "-p", "127.0.0.1::" + strings.TrimSuffix(port, "/tcp")}, args...)
+	output, err := exec.Command("docker", append(run, image)...).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("docker run %s: %w", image, err)
+	}
+	id := strings.TrimSpace(string(output))
+
+	output, err = exec.Command("docker", "port", id, port).Output()
+	if err != nil {
+		exec.Command("docker", "rm", "-f", id).Run()
+		return "", "", fmt.Errorf("docker port %s: %w", image, err)
+	}
+
+	// the first line is the IPv4 binding, e.g. 127.0.0.1:32768
+	address, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return id, address, nil
+}
+
+// connectIntegrationServices waits for MySQL and Redis to answer and migrates the database
+func connectIntegrationServices(dsn, redisAddr string) error {
+	dbConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return fmt.Errorf("INTEGRATION_DB_ADDR: %w", err)
+	}
+
+	// a fresh MySQL container takes a while to initialize, db.New retries for it
+	integrationDB, err = db.New(dbConfig.Addr, dbConfig.User, dbConfig.Passwd, dbConfig.DBName, 10, 10, "15m", nil)
+	if err != nil {
+		return err
+	}
+
+	// the migrate driver closes its database with the runner
+	migrationDB, err := db.New(dbConfig.Addr, dbConfig.User, dbConfig.Passwd, dbConfig.DBName, 2, 2, "15m", nil)
+	if err != nil {
+		return err
+	}
+	runner, err := migrations.New(migrationDB, "../migrate/migrations", io.Discard)
+	if err != nil {
+		migrationDB.Close()
+		return err
+	}
+	defer runner.Close()
+
+	if _, err := runner.Up(0, true); err != nil {
+		return fmt.Errorf("migrating: %w", err)
+	}
+
+	integrationRedis = cache.NewRedisClient(redisAddr, "", 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for {
+		if err := integrationRedis.Ping(ctx).Err(); err == nil {
+			return nil
+		} else if ctx.Err() != nil {
+			return fmt.Errorf("redis did not answer: %w", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// newIntegrationApplication is newTestApplication on MySQL and Redis, emails still go to
+// the returned fake mailer
+func newIntegrationApplication(t *testing.T) (*application, *mocks.Mailer) {
+	t.Helper()
+
+	app := newTestApplication(t)
+
+	storage, err := store.NewStorage(integrationDB, nil, store.DeletionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.store = storage
+	app.cacheStorage = cache.NewStorage(integrationRedis, cache.Config{
+		Users: cache.EntityConfig{TTL: cache.UserExpTime},
+		Feeds: cache.EntityConfig{TTL: cache.FeedExpTime},
+	})
+	app.outbox = outbox.NewDispatcher(storage.Outbox, app.logger)
+
+	mailer := mocks.NewMailer()
+	app.mailer = mailer
+
+	return app, mailer
+}
+
+func TestIntegrationAuthFlow(t *testing.T) {
+	app, mailer := newIntegrationApplication(t)
+	ctx := context.Background()
+
+	// unique per run, so the suite can be pointed at a database it ran against before
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	username := "flow" + suffix[len(suffix)-8:]
+	email := username + "@example.com"
+
+	response, body := do(t, app, http.MethodPost, "/v1/auth/register", map[string]any{
+		"first_name": "Flow",
+		"last_name":  "Test",
+		"username":   username,
+		"email":      email,
+		"password":   testPassword,
+	}, "")
+	if response.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %v", response.Code, body)
+	}
+
+	// the outbox dispatcher is not running, send the verification email it holds
+	user, err := app.store.Users.GetByEmail(store.ContextWithPrimary(ctx), email, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := outbox.VerificationEmail{UserID: user.ID, Email: email, Locale: i18n.DefaultLocale}
+	if err := app.sendVerificationEmail(ctx, message); err != nil {
+		t.Fatal(err)
+	}
+	sent, ok := mailer.LastTo(email)
+	if !ok {
+		t.Fatal("no verification email was sent")
+	}
+	otpCode := reflect.ValueOf(sent.Data).FieldByName("OtpCode").String()
+
+	response, body = do(t, app, http.MethodPost, "/v1/auth/login", map[string]any{"email": email, "password": testPassword}, "")
+	if response.Code != http.StatusUnauthorized {
+		t.Fatalf("login before verifying: status %d, want 401: %v", response.Code, body)
+	}
+
+	response, body = do(t, app, http.MethodPost, "/v1/auth/verify-email", map[string]any{"email": email, "otp_code": otpCode}, "")
+	if response.Code != http.StatusOK {
+		t.Fatalf("verify email: status %d: %v", response.Code, body)
+	}
+
+	response, body = do(t, app, http.MethodPost, "/v1/auth/login", map[string]any{"email": email, "password": testPassword}, "")
+	if response.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %v", response.Code, body)
+	}
+	data, _ := body["data"].(map[string]any)
+	token, _ := data["token"].(string)
+	if token == "" {
+		t.Fatalf("login: no token in %v", body)
+	}
+
+	// the second read is served from the Redis cache the first one filled
+	for range 2 {
+		response, body = do(t, app, http.MethodGet, "/v1/user/profile", nil, token)
+		if response.Code != http.StatusOK {
+			t.Fatalf("profile: status %d: %v", response.Code, body)
+		}
+		profile, _ := body["data"].(map[string]any)
+		if profile["username"] != username {
+			t.Fatalf("profile: username %v, want %s", profile["username"], username)
+		}
+	}
+
+	response, body = do(t, app, http.MethodPatch, "/v1/user/profile", map[string]any{"first_name": "Changed", "last_name": "Name"}, token)
+	if response.Code != http.StatusOK {
+		t.Fatalf("update profile: status %d: %v", response.Code, body)
+	}
+
+	// the update evicted the cached user, so the change shows
+	response, body = do(t, app, http.MethodGet, "/v1/user/profile", nil, token)
+	profile, _ := body["data"].(map[string]any)
+	if response.Code != http.StatusOK || profile["first_name"] != "Changed" {
+		t.Fatalf("profile after update: status %d: %v", response.Code, body)
+	}
+}
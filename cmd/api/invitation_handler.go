@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/auth"
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+var (
+	errInvitationInvalid = errors.New("invitation is invalid")
+	errInvitationExpired = errors.New("invitation has expired")
+	errInvitationRole    = errors.New("you cannot invite to a role above your own")
+)
+
+type CreateInvitationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Role  string `json:"role" validate:"required,max=50"`
+}
+
+// createInvitationHandler emails an invite link that registers the address with the role.
+// The token is only in the email, so the invitation also proves the address.
+//
+// @Summary  Invite someone to register with a role
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    payload body CreateInvitationPayload true "Request body"
+// @Success  201 {object} Response[models.Invitation]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  409 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/invitations [post]
+func (app *application) createInvitationHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload CreateInvitationPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := request.Context()
+	admin := getUserFromCtx(request)
+
+	role, err := app.store.Roles.GetByName(ctx, payload.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unprocessableEntityResponse(writer, request, errUnknownRole)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if role.Level > admin.Role.Level {
+		app.unprocessableEntityResponse(writer, request, errInvitationRole)
+		return
+	}
+
+	// registering would fail on the unique email, so would the invitation
+	_, err = app.store.Users.GetByEmail(store.ContextWithDeleted(ctx, store.DeletedInclude), payload.Email, false)
+	switch {
+	case err == nil:
+		app.conflictResponse(writer, request, store.ErrDuplicateEmail)
+		return
+	case !errors.Is(err, store.ErrNotFound):
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	invitation := &models.Invitation{
+		Email:     payload.Email,
+		RoleID:    role.ID,
+		Role:      *role,
+		InvitedBy: &admin.ID,
+		// the column keeps whole seconds, the token is signed with what it keeps
+		ExpiresAt: time.Now().Add(app.config.auth.invitation.exp).UTC().Truncate(time.Second),
+	}
+
+	if err := app.store.Invitations.Create(ctx, invitation); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := app.sendInvitation(ctx, invitation); err != nil {
+		app.loggerFor(request).Errorw("error sending invitation", "invitationID", invitation.ID, "error", err)
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.audit(request, models.AuditInvitationCreate, 0, map[string]any{
+		"invitation_id": invitation.ID,
+		"email":         invitation.Email,
+		"role":          role.Name,
+	})
+
+	if err := writeJSON(writer, request, http.StatusCreated, "Invitation sent", invitation); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// invitationFromToken returns the open invitation token was signed for
+func (app *application) invitationFromToken(ctx context.Context, token string) (*models.Invitation, error) {
+	id, err := auth.ParseInvitationToken(token)
+	if err != nil {
+		return nil, errInvitationInvalid
+	}
+
+	invitation, err := app.store.Invitations.GetByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return nil, errInvitationInvalid
+		default:
+			return nil, err
+		}
+	}
+
+	if !auth.VerifyInvitationToken(app.invitationSecret(), token, invitation.ID, invitation.Email, invitation.ExpiresAt) {
+		return nil, errInvitationInvalid
+	}
+	if invitation.AcceptedAt != nil {
+		return nil, store.ErrInvitationUsed
+	}
+	if invitation.Expired(time.Now()) {
+		return nil, errInvitationExpired
+	}
+
+	return invitation, nil
+}
+
+// invitationErrorResponse answers a registration whose invitation cannot be used
+func (app *application) invitationErrorResponse(writer http.ResponseWriter, request *http.Request, err error) {
+	switch {
+	case errors.Is(err, errInvitationInvalid), errors.Is(err, errInvitationExpired), errors.Is(err, store.ErrInvitationUsed):
+		app.unprocessableEntityResponse(writer, request, err)
+	default:
+		app.internalServerError(writer, request, err)
+	}
+}
+
+func (app *application) sendInvitation(ctx context.Context, invitation *models.Invitation) error {
+	isProdEnv := app.config.env == "production"
+	locale := i18n.FromContext(ctx)
+	subject := i18n.T(locale, "You're invited")
+
+	token := auth.InvitationToken(app.invitationSecret(), invitation.ID, invitation.Email, invitation.ExpiresAt)
+
+	vars := struct {
+		Email     string
+		Role      string
+		InviteURL string
+		ExpiresAt string
+		Subject   string
+	}{
+		Email:     invitation.Email,
+		Role:      invitation.Role.Name,
+		InviteURL: strings.TrimSuffix(app.config.frontendURL, "/") + "/invite?token=" + url.QueryEscape(token),
+		ExpiresAt: invitation.ExpiresAt.Format(time.RFC1123),
+		Subject:   subject,
+	}
+
+	return app.mailer.SendWithOptions(
+		mailer.Localized(mailer.InvitationTemplate, locale),
+		invitation.Email,
+		invitation.Email,
+		subject,
+		vars,
+		mailer.AsyncInMemory,
+		!isProdEnv,
+	)
+}
+
+// invitationSecret signs the invitation tokens, TOKEN_SECRET unless INVITATION_SECRET is set
+func (app *application) invitationSecret() string {
+	if app.config.auth.invitation.secret != "" {
+		return app.config.auth.invitation.secret
+	}
+	return app.config.auth.token.secret
+}
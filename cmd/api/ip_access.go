@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/ipaccess"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+var (
+	errIPDenied       = errors.New("requests from your address are not accepted")
+	errIPNotAllowed   = errors.New("the admin API is not available from your address")
+	errIPRuleLockout  = errors.New("this change would lock you out of the admin API")
+	errIPRuleNotFound = errors.New("ip rule not found")
+	errIPRuleExpiry   = errors.New("expires_in must be a positive duration such as 24h")
+)
+
+type AddIPRulePayload struct {
+	// Network is an IP address or a CIDR such as 203.0.113.0/24
+	Network string `json:"network" validate:"required,max=64"`
+	Note    string `json:"note" validate:"max=255"`
+	// ExpiresIn is a duration such as 24h, the rule stays until it is removed when empty
+	ExpiresIn string `json:"expires_in" validate:"max=32"`
+}
+
+// IPListResponse is one IP list, the networks from the environment cannot be removed
+// through the API
+type IPListResponse struct {
+	Configured []string        `json:"configured"`
+	Rules      []ipaccess.Rule `json:"rules"`
+}
+
+// IPDenyMiddleware refuses clients on the deny list, before they count against the rate limits
+func (app *application) IPDenyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if app.ipAccess.Denied(clientIP(request)) {
+			app.forbiddenResponse(writer, request, errIPDenied)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// AdminIPAllowMiddleware keeps clients off the allow list away from the admin routes, before
+// their token is even looked at. Everybody passes while the list is empty.
+func (app *application) AdminIPAllowMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !app.ipAccess.Allowed(clientIP(request)) {
+			app.forbiddenResponse(writer, request, errIPNotAllowed)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// listIPRulesHandler shows both IP lists, the networks from the environment and the
+// runtime rules that have not expired
+//
+// @Summary  List the IP allow and deny lists
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[map[string]IPListResponse]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/ip-rules [get]
+func (app *application) listIPRulesHandler(writer http.ResponseWriter, request *http.Request) {
+	lists := map[ipaccess.List]IPListResponse{}
+
+	for _, list := range []ipaccess.List{ipaccess.Allow, ipaccess.Deny} {
+		rules, err := app.ipAccess.Store().Rules(request.Context(), list)
+		if err != nil {
+			app.internalServerError(writer, request, err)
+			return
+		}
+
+		lists[list] = IPListResponse{
+			Configured: app.ipAccess.Configured(list),
+			Rules:      rules,
+		}
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "IP rules fetched", lists); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// addIPRuleHandler adds a network to the allow or deny list of every instance. A rule that
+// would keep the admin making it out of the admin API is refused.
+//
+// @Summary  Add a network to an IP list
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    list    path string           true "allow or deny"
+// @Param    payload body AddIPRulePayload true "Request body"
+// @Success  201 {object} Response[ipaccess.Rule]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/ip-rules/{list} [post]
+func (app *application) addIPRuleHandler(writer http.ResponseWriter, request *http.Request) {
+	list, err := ipaccess.ParseList(chi.URLParam(request, "list"))
+	if err != nil {
+		app.notFoundResponse(writer, request, err)
+		return
+	}
+
+	var payload AddIPRulePayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	network, err := ipaccess.ParseNetwork(payload.Network)
+	if err != nil {
+		app.unprocessableEntityResponse(writer, request, err)
+		return
+	}
+
+	rule := ipaccess.Rule{
+		Network:   network.String(),
+		Note:      payload.Note,
+		CreatedBy: getUserFromCtx(request).ID,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if payload.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(payload.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			app.unprocessableEntityResponse(writer, request, errIPRuleExpiry)
+			return
+		}
+		expiresAt := rule.CreatedAt.Add(expiresIn)
+		rule.ExpiresAt = &expiresAt
+	}
+
+	// denying yourself, or starting an allow list without yourself, locks you out
+	ip := clientIP(request)
+	address, _ := ipaccess.ParseAddr(ip)
+	lockout := list == ipaccess.Deny && network.Contains(address) ||
+		list == ipaccess.Allow && !app.ipAccess.AllowedWith(ip, network)
+	if lockout {
+		app.unprocessableEntityResponse(writer, request, errIPRuleLockout)
+		return
+	}
+
+	if err := app.ipAccess.Store().Add(request.Context(), list, rule); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.audit(request, models.AuditIPRuleChange, 0, map[string]any{"list": list, "network": rule.Network, "added": true})
+	app.reloadIPRules(request)
+
+	if err := writeJSON(writer, request, http.StatusCreated, "IP rule added", rule); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// removeIPRuleHandler removes a runtime rule from the allow or deny list of every instance
+//
+// @Summary  Remove a network from an IP list
+// @Tags     admin
+// @Produce  json
+// @Param    list    path  string true "allow or deny"
+// @Param    network query string true "Network of the rule, as listed"
+// @Success  200 {object} Response[any]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/ip-rules/{list} [delete]
+func (app *application) removeIPRuleHandler(writer http.ResponseWriter, request *http.Request) {
+	list, err := ipaccess.ParseList(chi.URLParam(request, "list"))
+	if err != nil {
+		app.notFoundResponse(writer, request, err)
+		return
+	}
+
+	network, err := ipaccess.ParseNetwork(request.URL.Query().Get("network"))
+	if err != nil {
+		app.unprocessableEntityResponse(writer, request, err)
+		return
+	}
+
+	if list == ipaccess.Allow && !app.ipAccess.AllowedWithout(clientIP(request), network) {
+		app.unprocessableEntityResponse(writer, request, errIPRuleLockout)
+		return
+	}
+
+	removed, err := app.ipAccess.Store().Remove(request.Context(), list, network.String())
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+	if !removed {
+		app.notFoundResponse(writer, request, errIPRuleNotFound)
+		return
+	}
+
+	app.audit(request, models.AuditIPRuleChange, 0, map[string]any{"list": list, "network": network.String(), "added": false})
+	app.reloadIPRules(request)
+
+	if err := writeMessage(writer, request, http.StatusOK, "IP rule removed"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// reloadIPRules applies a change on this instance right away, the others pick it up
+// within a minute
+func (app *application) reloadIPRules(request *http.Request) {
+	if err := app.ipAccess.Reload(context.WithoutCancel(request.Context())); err != nil {
+		app.logger.Warnw("failed to reload IP rules", "error", err)
+	}
+}
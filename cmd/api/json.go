@@ -11,36 +11,225 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/go-viper/mapstructure/v2"
+
+	"godsendjoseph.dev/sandbox-api/internal/auth"
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
 )
 
 var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// password checks the strength of a new password, notbreached looks it up in known breaches
+	Validate.RegisterValidation("password", func(field validator.FieldLevel) bool {
+		return passwords.strong(field.Field().String())
+	})
+	Validate.RegisterValidation("notbreached", func(field validator.FieldLevel) bool {
+		return passwords.notBreached(field.Field().String())
+	})
+
+	Validate.RegisterValidation("username", func(field validator.FieldLevel) bool {
+		return usernameProblem(field.Field().String()) == ""
+	})
+	Validate.RegisterValidation("slug", func(field validator.FieldLevel) bool {
+		return slugPattern.MatchString(field.Field().String())
+	})
+	// e164 is built into the validator, only its message is ours
+}
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	slugPattern     = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+)
+
+// reservedUsernames could pass for the service or a route, compared case-insensitively
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "system": true, "support": true,
+	"help": true, "moderator": true, "staff": true, "security": true, "api": true,
+	"www": true, "mail": true, "postmaster": true, "webmaster": true, "noreply": true,
+	"me": true, "user": true, "users": true, "settings": true, "login": true,
+	"logout": true, "register": true, "anonymous": true, "null": true, "undefined": true,
+}
+
+// usernameProblem says why username is not acceptable, empty when it is
+func usernameProblem(username string) string {
+	switch {
+	case !usernamePattern.MatchString(username):
+		return "may only contain letters, digits and underscores"
+	case reservedUsernames[strings.ToLower(username)]:
+		return "is reserved, please choose another one"
+	}
+	return ""
+}
+
+// Response is the envelope of every successful response. Data is null when there is
+// nothing to return and lists are [] rather than null.
+type Response[T any] struct {
+	Status  int    `json:"status" example:"200"`
+	Success bool   `json:"success" example:"true"`
+	Message string `json:"message"`
+	Data    T      `json:"data"`
+	Meta    *Meta  `json:"meta,omitempty"`
+}
+
+// Meta describes the response rather than belongs to its data
+type Meta struct {
+	RequestID  string          `json:"request_id,omitempty"`
+	Pagination *PaginationMeta `json:"pagination,omitempty"`
+}
+
+// PaginationMeta is the position of a page, as in the list envelope
+type PaginationMeta struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// ResponseOption adds metadata to a response
+type ResponseOption func(meta *Meta)
+
+// withCursorPage records the cursor of the next page of a cursor paged list
+func withCursorPage(page pagination.Page) ResponseOption {
+	return func(meta *Meta) {
+		meta.Pagination = &PaginationMeta{NextCursor: page.NextCursor, HasMore: page.NextCursor != "", Total: page.Total}
+	}
 }
 
-func writeJSON(writer http.ResponseWriter, status int, message string, data any) error {
+// ErrorResponse is the error envelope served under /v1, see errorEnvelopeVersion
+type ErrorResponse struct {
+	Status          int               `json:"status" example:"400"`
+	Success         bool              `json:"success" example:"false"`
+	Message         string            `json:"message"`
+	Data            any               `json:"data"`
+	ErrorCode       ErrorCode         `json:"error_code"`
+	EnvelopeVersion int               `json:"envelope_version" example:"2"`
+	SupportRef      string            `json:"support_ref,omitempty"`
+	RequestID       string            `json:"request_id,omitempty"`
+	Errors          map[string]string `json:"errors,omitempty"`
+}
+
+// Problem is an RFC 7807 problem, with the error code, the field errors, the support
+// reference and the request ID as extension members
+type Problem struct {
+	Type       string            `json:"type"`
+	Title      string            `json:"title"`
+	Status     int               `json:"status"`
+	Detail     string            `json:"detail"`
+	Instance   string            `json:"instance"`
+	Code       ErrorCode         `json:"code"`
+	SupportRef string            `json:"support_ref,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Errors     map[string]string `json:"errors,omitempty"`
+}
+
+// writeJSON writes the standard response envelope around data, a model or a typed
+// response struct. Models in data are redacted to the view the authenticated user is
+// allowed to see (see serialize), message is translated into the locale of the request.
+func writeJSON[T any](writer http.ResponseWriter, request *http.Request, status int, message string, data T, options ...ResponseOption) error {
+	response := Response[any]{
+		Status:  status,
+		Success: status < 400,
+		Message: i18n.Translate(request.Context(), message),
+		Data:    serialize(data, getUserFromCtx(request)),
+	}
+
+	meta := Meta{RequestID: writer.Header().Get(requestIDHeader)}
+	for _, option := range options {
+		option(&meta)
+	}
+	if meta != (Meta{}) {
+		response.Meta = &meta
+	}
+
 	writer.Header().Set("Content-Type", "application/json")
 	writer.WriteHeader(status)
 
-	response := map[string]any{
-		"status":  status,
-		"success": status < 400,
-		"message": message,
-		"data":    data,
+	return json.NewEncoder(writer).Encode(response)
+}
+
+// writeMessage writes the standard response envelope with null data
+func writeMessage(writer http.ResponseWriter, request *http.Request, status int, message string) error {
+	return writeJSON[any](writer, request, status, message, nil)
+}
+
+// List is the standard list envelope that writeList writes, items is never null
+type List[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// newList is the list envelope of items at page
+func newList[T any](items []T, page pagination.Page) List[T] {
+	return List[T]{
+		Items:      orEmpty(items),
+		NextCursor: page.NextCursor,
+		HasMore:    page.NextCursor != "",
+		Total:      page.Total,
 	}
+}
 
-	return json.NewEncoder(writer).Encode(response)
+// view redacts the models in the items, like writeJSON does for a single model
+func (list List[T]) view(viewer *models.User) any {
+	return list.views(viewer)
+}
+
+// views is list with each item replaced by its view. List types that add fields next to
+// the items build their view on it, the promoted view would drop those fields.
+func (list List[T]) views(viewer *models.User) List[any] {
+	items := make([]any, len(list.Items))
+	for i, item := range list.Items {
+		items[i] = serialize(item, viewer)
+	}
+
+	return List[any]{
+		Items:      items,
+		NextCursor: list.NextCursor,
+		HasMore:    list.HasMore,
+		Total:      list.Total,
+	}
+}
+
+// writeList writes a page of a list endpoint in the standard list envelope
+func writeList[T any](writer http.ResponseWriter, request *http.Request, message string, items []T, page pagination.Page) error {
+	return writeJSON(writer, request, http.StatusOK, message, newList(items, page), withCursorPage(page))
 }
 
+// createdAtPage are the page options of a list that clients may read oldest first with
+// sort=created_at, it is newest first otherwise
+func createdAtPage(defaultLimit int) pagination.Options {
+	return pagination.Options{
+		DefaultLimit: defaultLimit,
+		MaxLimit:     100,
+		Sorts:        pagination.Sorts{"created_at": "created_at"},
+		DefaultSort:  pagination.Sort{Field: "created_at", Column: "created_at", Desc: true},
+	}
+}
+
+// parseOffsetPage reads the page of a list the store reads with LIMIT and OFFSET, the
+// offset travels in the cursor (see pagination.OffsetPage)
+func parseOffsetPage(request *http.Request, options pagination.Options) (pagination.Params, int, error) {
+	params, err := pagination.Parse(request, options)
+	if err != nil {
+		return params, 0, err
+	}
+
+	offset, err := params.Offset()
+	return params, offset, err
+}
+
+// readFormData reads a form or multipart body, BodyMiddleware has already capped its size
 func readFormData(writer http.ResponseWriter, request *http.Request, data any) (map[string][]*multipart.FileHeader, error) {
-	maxBytes := 1_048_576 // 1mb
-	request.Body = http.MaxBytesReader(writer, request.Body, int64(maxBytes))
+	maxMemory := int64(1_048_576) // 1mb, larger files spill to disk
 
 	files := make(map[string][]*multipart.FileHeader)
 
 	// First, try to parse as a multipart form (for file uploads)
-	if err := request.ParseMultipartForm(int64(maxBytes)); err != nil {
+	if err := request.ParseMultipartForm(maxMemory); err != nil {
 		if !errors.Is(err, http.ErrNotMultipart) {
 			return nil, err
 		}
@@ -82,37 +271,89 @@ func readFormData(writer http.ResponseWriter, request *http.Request, data any) (
 	return files, nil
 }
 
+// readJSON decodes the body into data, BodyMiddleware has already capped its size
 func readJSON(writer http.ResponseWriter, request *http.Request, data any) error {
-	maxBytes := 1_048_576 // 1mb
-	request.Body = http.MaxBytesReader(writer, request.Body, int64(maxBytes))
-
 	decoder := json.NewDecoder(request.Body)
 	decoder.DisallowUnknownFields()
 
 	return decoder.Decode(data)
 }
 
-func writeJSONError(writer http.ResponseWriter, status int, message string, errorsMap map[string]string) error {
+// errorEnvelopeVersion is the shape of the error body served under /v1.
+// Bump it (and document the new shape in the ReadMe) whenever a field is
+// renamed or removed so clients can branch on it.
+const errorEnvelopeVersion = 2
+
+// problemJSONType is the RFC 7807 media type, served to clients that accept it
+const problemJSONType = "application/problem+json"
+
+// problemTypePrefix turns an ErrorCode into the problem type URI
+const problemTypePrefix = "urn:sandbox-api:problem:"
+
+// writeJSONError writes the error envelope, or an RFC 7807 problem when the client accepts
+// application/problem+json. Both carry errorCode, the envelope as error_code and the problem
+// as code. message is translated into the locale of the request when the bundle has it.
+func writeJSONError(writer http.ResponseWriter, request *http.Request, status int, errorCode ErrorCode, message string, errorsMap map[string]string) error {
+	message = i18n.Translate(request.Context(), message)
+
+	if wantsProblemJSON(request) {
+		return writeProblem(writer, request, status, errorCode, message, errorsMap)
+	}
+
+	response := ErrorResponse{
+		Status:          status,
+		Message:         message,
+		ErrorCode:       errorCode,
+		EnvelopeVersion: errorEnvelopeVersion,
+		SupportRef:      writer.Header().Get(supportRefHeader),
+		RequestID:       writer.Header().Get(requestIDHeader),
+		Errors:          errorsMap,
+	}
+
 	writer.Header().Set("Content-Type", "application/json")
 	writer.WriteHeader(status)
 
-	response := map[string]any{
-		"status":  status,
-		"success": false,
-		"message": message,
-		"data":    nil,
+	return json.NewEncoder(writer).Encode(response)
+}
+
+// writeProblem writes an RFC 7807 problem
+func writeProblem(writer http.ResponseWriter, request *http.Request, status int, errorCode ErrorCode, message string, errorsMap map[string]string) error {
+	problem := Problem{
+		Type:       problemTypePrefix + string(errorCode),
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     message,
+		Instance:   request.URL.Path,
+		Code:       errorCode,
+		SupportRef: writer.Header().Get(supportRefHeader),
+		RequestID:  writer.Header().Get(requestIDHeader),
+		Errors:     errorsMap,
 	}
 
-	if errorsMap != nil {
-		response["errors"] = errorsMap
+	writer.Header().Set("Content-Type", problemJSONType)
+	writer.WriteHeader(status)
+
+	return json.NewEncoder(writer).Encode(problem)
+}
+
+// wantsProblemJSON is true for clients accepting application/problem+json and for the
+// versions that always answer errors as problems
+func wantsProblemJSON(request *http.Request) bool {
+	if request == nil {
+		return false
 	}
-	return json.NewEncoder(writer).Encode(response)
+	if version := getAPIVersionFromCtx(request); version != nil && version.problemErrors {
+		return true
+	}
+	return strings.Contains(request.Header.Get("Accept"), problemJSONType)
 }
 
-func validatePayload(writer http.ResponseWriter, payload any) bool {
+// validatePayload answers 422 on failure: the body was well-formed JSON but its
+// values are not acceptable. Malformed bodies are rejected earlier with a 400.
+func validatePayload(writer http.ResponseWriter, request *http.Request, payload any) bool {
 	if err := Validate.Struct(payload); err != nil {
-		msg, errorsMap := formatValidationErrors(err)
-		writeJSONError(writer, http.StatusBadRequest, msg, errorsMap)
+		msg, errorsMap := formatValidationErrors(err, i18n.FromContext(request.Context()))
+		writeJSONError(writer, request, http.StatusUnprocessableEntity, CodeValidationFailed, msg, errorsMap)
 		return false
 	}
 	return true
@@ -124,7 +365,9 @@ func convertFieldName(fieldName string) string {
 	return strings.ToLower(spaced)
 }
 
-func formatValidationErrors(err error) (string, map[string]string) {
+// formatValidationErrors words each failed rule in locale, field names stay as they are
+// in the payload
+func formatValidationErrors(err error, locale string) (string, map[string]string) {
 	errorsMap := make(map[string]string)
 	var firstError string
 
@@ -138,16 +381,19 @@ func formatValidationErrors(err error) (string, map[string]string) {
 			// Create a more user-friendly error message
 			var msg string
 			switch fieldErr.Tag() {
-			case "required":
-				msg = friendlyField + " is required"
-			case "email":
-				msg = friendlyField + " must be a valid email address"
-			case "min":
-				msg = friendlyField + " must be at least " + fieldErr.Param() + " characters long"
-			case "max":
-				msg = friendlyField + " must be at most " + fieldErr.Param() + " characters long"
+			case "required", "email", "notbreached", "slug", "e164":
+				msg = i18n.T(locale, "validation."+fieldErr.Tag(), "field", friendlyField)
+			case "min", "max":
+				msg = i18n.T(locale, "validation."+fieldErr.Tag(), "field", friendlyField, "param", fieldErr.Param())
+			case "password":
+				value, _ := fieldErr.Value().(string)
+				_, problem := auth.PasswordStrength(value)
+				msg = i18n.T(locale, "validation.password", "field", friendlyField, "problem", i18n.T(locale, problem))
+			case "username":
+				value, _ := fieldErr.Value().(string)
+				msg = i18n.T(locale, "validation.username", "field", friendlyField, "problem", i18n.T(locale, usernameProblem(value)))
 			default:
-				msg = friendlyField + " is " + fieldErr.Tag()
+				msg = i18n.T(locale, "validation.other", "field", friendlyField, "tag", fieldErr.Tag())
 			}
 
 			errorsMap[field] = msg
@@ -164,5 +410,5 @@ func formatValidationErrors(err error) (string, map[string]string) {
 		return firstError, errorsMap
 	}
 
-	return "Invalid input", errorsMap
+	return i18n.T(locale, "validation.invalid"), errorsMap
 }
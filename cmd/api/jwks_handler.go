@@ -0,0 +1,21 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// getJWKSHandler publishes the public token keys so other services can verify our tokens
+// without the HMAC secret. The set is empty while tokens are signed with TOKEN_SECRET.
+// It is served as a bare JWK Set, not in the response envelope, because that is what
+// JWT libraries expect.
+func (app *application) getJWKSHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	// short enough that a rotated key is picked up soon after the reload job
+	writer.Header().Set("Cache-Control", "public, max-age=300")
+
+	keys := map[string]any{"keys": app.authenticator.PublicKeys()}
+	if err := json.NewEncoder(writer).Encode(keys); err != nil {
+		app.internalServerError(writer, request, err)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+func TestListUsersPages(t *testing.T) {
+	app := newTestApplication(t)
+	viewer := createTestUser(t, app, "viewer", "viewer@example.com", true)
+	createTestUser(t, app, "second", "second@example.com", true)
+	createTestUser(t, app, "third", "third@example.com", true)
+	createTestUser(t, app, "unverified", "unverified@example.com", false)
+
+	token, err := app.generateJWTToken(viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var usernames []any
+	path := "/v1/users?limit=2&sort=created_at"
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("still paging after %d pages", pages)
+		}
+
+		response, body := do(t, app, http.MethodGet, path, nil, token)
+		if response.Code != http.StatusOK {
+			t.Fatalf("status = %d: %v", response.Code, body)
+		}
+
+		data, _ := body["data"].(map[string]any)
+		items, _ := data["items"].([]any)
+		for _, item := range items {
+			usernames = append(usernames, item.(map[string]any)["username"])
+		}
+
+		cursor, _ := data["next_cursor"].(string)
+		if hasMore, _ := data["has_more"].(bool); hasMore != (cursor != "") {
+			t.Fatalf("has_more = %v with next_cursor %q", hasMore, cursor)
+		}
+		if cursor == "" {
+			break
+		}
+		path = "/v1/users?limit=2&sort=created_at&cursor=" + url.QueryEscape(cursor)
+	}
+
+	want := []any{"viewer", "second", "third"}
+	if len(usernames) != len(want) {
+		t.Fatalf("usernames = %v, want %v", usernames, want)
+	}
+	for i := range want {
+		if usernames[i] != want[i] {
+			t.Fatalf("usernames = %v, want %v", usernames, want)
+		}
+	}
+}
+
+func TestListUsersRejectsBadPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantError ErrorCode
+	}{
+		{"unknown sort", "?sort=email", CodeInvalidSort},
+		{"malformed cursor", "?cursor=not-a-cursor", CodeInvalidCursor},
+		{"negative offset in the cursor", "?cursor=LTE", CodeInvalidCursor},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			viewer := createTestUser(t, app, "viewer", "viewer@example.com", true)
+			token, err := app.generateJWTToken(viewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response, body := do(t, app, http.MethodGet, "/v1/users"+test.query, nil, token)
+			if response.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %v", response.Code, body)
+			}
+			if got := body["error_code"]; got != string(test.wantError) {
+				t.Errorf("error_code = %v, want %s", got, test.wantError)
+			}
+		})
+	}
+}
+
+func TestListAuditLogsPages(t *testing.T) {
+	app := newTestApplication(t)
+	admin := createTestUser(t, app, "admin", "admin@example.com", true)
+	role, err := app.store.Roles.GetByName(context.Background(), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Users.UpdateRole(context.Background(), admin.ID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	token, err := app.generateJWTToken(admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range []string{models.AuditLogin, models.AuditLogin, models.AuditLogin, models.AuditLoginFailed} {
+		if err := app.store.AuditLogs.Create(context.Background(), &models.AuditLog{Action: action, UserID: &admin.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	response, body := do(t, app, http.MethodGet, "/v1/admin/audit?action=auth.login&limit=2", nil, token)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d: %v", response.Code, body)
+	}
+	data, _ := body["data"].(map[string]any)
+	if items, _ := data["items"].([]any); len(items) != 2 {
+		t.Fatalf("first page has %d items, want 2: %v", len(items), data)
+	}
+
+	cursor, _ := data["next_cursor"].(string)
+	response, body = do(t, app, http.MethodGet, "/v1/admin/audit?action=auth.login&limit=2&cursor="+url.QueryEscape(cursor), nil, token)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d: %v", response.Code, body)
+	}
+	data, _ = body["data"].(map[string]any)
+	if items, _ := data["items"].([]any); len(items) != 1 || data["has_more"] != false {
+		t.Fatalf("second page = %v, want the last login", data)
+	}
+}
+
+func TestListsRedactUsers(t *testing.T) {
+	app := newTestApplication(t)
+	viewer := createTestUser(t, app, "viewer", "viewer@example.com", true)
+	author := createTestUser(t, app, "author", "author@example.com", true)
+
+	viewerToken, err := app.generateJWTToken(viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorToken, err := app.generateJWTToken(author)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, body := do(t, app, http.MethodPost, "/v1/posts", map[string]any{"title": "Title", "content": "Content"}, authorToken)
+	if response.Code != http.StatusCreated && response.Code != http.StatusOK {
+		t.Fatalf("create post: status %d: %v", response.Code, body)
+	}
+
+	private := []string{"email", "normalized_email", "role", "role_id"}
+
+	// items returns the items of the list at path, seen by viewer
+	items := func(path string) []any {
+		t.Helper()
+		response, body := do(t, app, http.MethodGet, path, nil, viewerToken)
+		if response.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %v", path, response.Code, body)
+		}
+		data, _ := body["data"].(map[string]any)
+		items, _ := data["items"].([]any)
+		return items
+	}
+
+	for _, item := range items("/v1/users") {
+		user := item.(map[string]any)
+		if user["username"] != "author" {
+			continue
+		}
+		for _, field := range private {
+			if _, ok := user[field]; ok {
+				t.Errorf("/v1/users: another user shows %s: %v", field, user)
+			}
+		}
+	}
+
+	posts := items("/v1/posts")
+	if len(posts) != 1 {
+		t.Fatalf("/v1/posts: %d items, want 1", len(posts))
+	}
+	user, ok := posts[0].(map[string]any)["user"].(map[string]any)
+	if !ok {
+		t.Fatalf("/v1/posts: no author in %v", posts[0])
+	}
+	for _, field := range private {
+		if _, ok := user[field]; ok {
+			t.Errorf("/v1/posts: the author shows %s: %v", field, user)
+		}
+	}
+}
+
+func TestListNotificationsCountsUnread(t *testing.T) {
+	app := newTestApplication(t)
+	user := createTestUser(t, app, "viewer", "viewer@example.com", true)
+	token, err := app.generateJWTToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, body := do(t, app, http.MethodGet, "/v1/user/notifications", nil, token)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d: %v", response.Code, body)
+	}
+	data, _ := body["data"].(map[string]any)
+	if items, ok := data["items"].([]any); !ok || len(items) != 0 {
+		t.Errorf("items = %v, want an empty list", data["items"])
+	}
+	if unread, ok := data["unread"].(float64); !ok || unread != 0 {
+		t.Errorf("unread = %v, want 0", data["unread"])
+	}
+}
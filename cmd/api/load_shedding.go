@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	ratelimiter "godsendjoseph.dev/sandbox-api/internal/rateLimiter"
+)
+
+// ConcurrencyMiddleware counts the requests in flight on this instance and answers 503 with
+// Retry-After once CONCURRENCY_MAX_IN_FLIGHT are, or once the client has
+// CONCURRENCY_PER_USER of its own. Health checks, metrics and event streams are never shed.
+func (app *application) ConcurrencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if isShedExempt(request.URL.Path) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		release, err := app.concurrency.Acquire(app.concurrencyKey(request))
+		if err != nil {
+			app.overloadedResponse(writer, request, err)
+			return
+		}
+		defer release()
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// concurrencyKey is the user of a valid token, the client address otherwise. Checking the
+// token is skipped when there is no per-user limit to count against.
+func (app *application) concurrencyKey(request *http.Request) string {
+	if app.config.concurrency.perUser <= 0 {
+		return ""
+	}
+
+	if userID, ok := app.tokenSubject(request); ok {
+		return "user:" + userID
+	}
+	return "ip:" + clientIP(request)
+}
+
+// isShedExempt reports whether path, as VersionNegotiationMiddleware left it, stays available
+// under load. Probes failing would get a busy instance restarted, scrapes are how the
+// saturation is seen, and streams hold their slot for as long as they are open.
+func isShedExempt(path string) bool {
+	path = canonicalPath(path)
+	return path == "/metrics" || path == "/v1/health" || strings.HasPrefix(path, "/v1/health/") || isStreamPath(path)
+}
+
+func concurrencyMetrics(stats ratelimiter.ConcurrencyStats) []metric {
+	const shedHelp = "Requests turned away with 503 because too many were in flight, by limit"
+
+	metrics := []metric{
+		{"http_requests_in_flight", "gauge", "Requests being handled on this instance", nil, float64(stats.InFlight)},
+		{"http_requests_in_flight_peak", "gauge", "Most requests handled at once on this instance since it started", nil, float64(stats.Peak)},
+		{"http_requests_shed_total", "counter", shedHelp, map[string]string{"limit": "instance"}, float64(stats.Shed)},
+		{"http_requests_shed_total", "counter", shedHelp, map[string]string{"limit": "user"}, float64(stats.ShedKey)},
+	}
+
+	// saturation is only defined against a limit, 1 means the next request is shed
+	if stats.Limit > 0 {
+		metrics = append(metrics,
+			metric{"http_requests_in_flight_limit", "gauge", "CONCURRENCY_MAX_IN_FLIGHT of this instance", nil, float64(stats.Limit)},
+			metric{"http_requests_saturation", "gauge", "Share of CONCURRENCY_MAX_IN_FLIGHT in use", nil, float64(stats.InFlight) / float64(stats.Limit)},
+		)
+	}
+
+	return metrics
+}
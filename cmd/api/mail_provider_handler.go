@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+)
+
+// MailProviders is the configured mail driver and the drivers of its failover chain
+type MailProviders struct {
+	Driver    string                 `json:"driver"`
+	Providers []mailer.ProviderStats `json:"providers"`
+}
+
+// getMailProvidersHandler reports the health and counters of each driver in the failover
+// chain of this instance. A single driver has no chain, so the list is empty.
+//
+// @Summary  Report the mail drivers of the failover chain
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[MailProviders]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/mail-providers [get]
+func (app *application) getMailProvidersHandler(writer http.ResponseWriter, request *http.Request) {
+	providers := []mailer.ProviderStats{}
+	if failover, ok := app.mailProvider.(*mailer.FailoverMailer); ok {
+		providers = failover.Stats()
+	}
+
+	data := MailProviders{Driver: app.config.mail.driver, Providers: providers}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Mail providers retrieved", data); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+)
+
+var errMailNotQueued = errors.New("emails are not sent through the job queue")
+
+// getMailQueueHandler reports the depth of the job queue and how the email jobs and the
+// workers of this instance did since it started
+//
+// @Summary  Report the mail queue
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[mailer.QueueStats]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/mail-queue [get]
+func (app *application) getMailQueueHandler(writer http.ResponseWriter, request *http.Request) {
+	queued, ok := app.mailer.(*mailer.QueuedMailer)
+	if !ok {
+		app.internalServerError(writer, request, errMailNotQueued)
+		return
+	}
+
+	stats, err := queued.Stats(request.Context())
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Mail queue retrieved", stats); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
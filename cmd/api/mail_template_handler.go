@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+var errMailTemplateInvalid = errors.New("email template is invalid")
+
+type CreateMailTemplatePayload struct {
+	Content string `json:"content" validate:"required,max=200000"`
+}
+
+type ActivateMailTemplatePayload struct {
+	// Version 0 goes back to the embedded template
+	Version *int `json:"version" validate:"required,gte=0"`
+}
+
+type PreviewMailTemplatePayload struct {
+	// Content is a draft to render, the template in use when empty
+	Content string            `json:"content" validate:"max=200000"`
+	Data    map[string]string `json:"data"`
+}
+
+// MailTemplateSummary is a registered template with the fields it can use and the version
+// that is sent, 0 for the embedded one
+type MailTemplateSummary struct {
+	Name          string   `json:"name"`
+	Fields        []string `json:"fields"`
+	ActiveVersion int      `json:"active_version"`
+}
+
+type MailTemplateList struct {
+	Templates []MailTemplateSummary `json:"templates"`
+}
+
+// MailTemplateDetail is the embedded source of a template and its edited versions
+type MailTemplateDetail struct {
+	Name     string                 `json:"name"`
+	Fields   []string               `json:"fields"`
+	Embedded string                 `json:"embedded"`
+	Versions []*models.MailTemplate `json:"versions"`
+}
+
+type ActiveMailTemplate struct {
+	Name          string `json:"name"`
+	ActiveVersion int    `json:"active_version"`
+}
+
+// MailTemplatePreview is a rendered template, with placeholders for the missing fields
+type MailTemplatePreview struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// syncMailTemplates hands the active edited templates to the mailer. It runs at startup,
+// every minute and after each change, so edits made on another instance are picked up
+// without a restart.
+func (app *application) syncMailTemplates(ctx context.Context) error {
+	active, err := app.store.MailTemplates.ListActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	templates := make(map[string]string, len(active))
+	for _, mailTemplate := range active {
+		templates[mailTemplate.Name] = mailTemplate.Content
+	}
+	mailer.SetTemplateOverrides(templates)
+
+	return nil
+}
+
+// listMailTemplatesHandler lists the registered templates with the fields they can use and
+// the version that is sent, 0 for the embedded one
+//
+// @Summary  List the email templates
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[MailTemplateList]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/mail-templates [get]
+func (app *application) listMailTemplatesHandler(writer http.ResponseWriter, request *http.Request) {
+	active, err := app.store.MailTemplates.ListActive(request.Context())
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	versions := make(map[string]int, len(active))
+	for _, mailTemplate := range active {
+		versions[mailTemplate.Name] = mailTemplate.Version
+	}
+
+	names := make([]string, 0, len(mailer.Templates))
+	for name := range mailer.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := MailTemplateList{Templates: make([]MailTemplateSummary, 0, len(names))}
+	for _, name := range names {
+		list.Templates = append(list.Templates, MailTemplateSummary{
+			Name:          name,
+			Fields:        orEmpty(mailer.Templates[name].Fields),
+			ActiveVersion: versions[name],
+		})
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Email templates retrieved", list); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// getMailTemplateHandler returns the embedded source of a template and its edited versions
+//
+// @Summary  Get an email template and its versions
+// @Tags     admin
+// @Produce  json
+// @Param    name path string true "Template name"
+// @Success  200 {object} Response[MailTemplateDetail]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/mail-templates/{name} [get]
+func (app *application) getMailTemplateHandler(writer http.ResponseWriter, request *http.Request) {
+	name := chi.URLParam(request, "name")
+
+	embedded, err := mailer.EmbeddedTemplate(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrUnknownTemplate):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	versions, err := app.store.MailTemplates.ListVersions(request.Context(), name)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	detail := MailTemplateDetail{
+		Name:     name,
+		Fields:   orEmpty(mailer.Templates[name].Fields),
+		Embedded: embedded,
+		Versions: orEmpty(versions),
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Email template retrieved", detail); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// createMailTemplateHandler saves content as the next version of a template and sends it
+// from now on. It is linted like the embedded templates first.
+//
+// @Summary  Save a new version of an email template
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    name path string true "Template name"
+// @Param    payload body CreateMailTemplatePayload true "Request body"
+// @Success  201 {object} Response[models.MailTemplate]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/mail-templates/{name} [post]
+func (app *application) createMailTemplateHandler(writer http.ResponseWriter, request *http.Request) {
+	name := chi.URLParam(request, "name")
+	if _, ok := mailer.Templates[name]; !ok {
+		app.notFoundResponse(writer, request, mailer.ErrUnknownTemplate)
+		return
+	}
+
+	var payload CreateMailTemplatePayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	if errs := mailer.LintContent(name, payload.Content); len(errs) > 0 {
+		app.unprocessableEntityResponse(writer, request, fmt.Errorf("%w: %w", errMailTemplateInvalid, errors.Join(errs...)))
+		return
+	}
+
+	mailTemplate := &models.MailTemplate{Name: name, Content: payload.Content}
+	if err := app.store.MailTemplates.Create(request.Context(), mailTemplate); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.audit(request, models.AuditMailTemplateChange, 0, map[string]any{"name": name, "version": mailTemplate.Version})
+	app.reloadMailTemplates(request)
+
+	if err := writeJSON(writer, request, http.StatusCreated, "Email template saved", mailTemplate); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// activateMailTemplateHandler sends an earlier version of a template again, or the embedded
+// one with version 0
+//
+// @Summary  Choose the version of an email template that is sent
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    name path string true "Template name"
+// @Param    payload body ActivateMailTemplatePayload true "Request body"
+// @Success  200 {object} Response[ActiveMailTemplate]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/mail-templates/{name}/active [put]
+func (app *application) activateMailTemplateHandler(writer http.ResponseWriter, request *http.Request) {
+	name := chi.URLParam(request, "name")
+	if _, ok := mailer.Templates[name]; !ok {
+		app.notFoundResponse(writer, request, mailer.ErrUnknownTemplate)
+		return
+	}
+
+	var payload ActivateMailTemplatePayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	if err := app.store.MailTemplates.Activate(request.Context(), name, *payload.Version); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	app.audit(request, models.AuditMailTemplateChange, 0, map[string]any{"name": name, "version": *payload.Version})
+	app.reloadMailTemplates(request)
+
+	if err := writeJSON(writer, request, http.StatusOK, "Email template activated", ActiveMailTemplate{Name: name, ActiveVersion: *payload.Version}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// previewMailTemplateHandler renders a draft, or the template in use, with the fields in
+// data and placeholders for the rest. Nothing is sent or saved.
+//
+// @Summary  Render an email template without sending it
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    name path string true "Template name"
+// @Param    payload body PreviewMailTemplatePayload true "Request body"
+// @Success  200 {object} Response[MailTemplatePreview]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/mail-templates/{name}/preview [post]
+func (app *application) previewMailTemplateHandler(writer http.ResponseWriter, request *http.Request) {
+	name := chi.URLParam(request, "name")
+	if _, ok := mailer.Templates[name]; !ok {
+		app.notFoundResponse(writer, request, mailer.ErrUnknownTemplate)
+		return
+	}
+
+	var payload PreviewMailTemplatePayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	message, err := mailer.Preview(name, payload.Content, payload.Data)
+	if err != nil {
+		app.unprocessableEntityResponse(writer, request, fmt.Errorf("%w: %w", errMailTemplateInvalid, err))
+		return
+	}
+
+	preview := MailTemplatePreview{Subject: message.Subject, HTML: message.HTML, Text: message.Text}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Email template rendered", preview); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// reloadMailTemplates applies a change on this instance right away, the others pick it up
+// with the next sync
+func (app *application) reloadMailTemplates(request *http.Request) {
+	if err := app.syncMailTemplates(context.WithoutCancel(request.Context())); err != nil {
+		app.logger.Warnw("failed to reload email templates", "error", err)
+	}
+}
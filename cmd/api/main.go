@@ -1,52 +1,92 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/mysql"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 
 	"godsendjoseph.dev/sandbox-api/internal/auth"
+	"godsendjoseph.dev/sandbox-api/internal/captcha"
+	appconfig "godsendjoseph.dev/sandbox-api/internal/config"
 	"godsendjoseph.dev/sandbox-api/internal/cron"
 	"godsendjoseph.dev/sandbox-api/internal/db"
 	"godsendjoseph.dev/sandbox-api/internal/env"
+	"godsendjoseph.dev/sandbox-api/internal/events"
+	"godsendjoseph.dev/sandbox-api/internal/geoip"
+	"godsendjoseph.dev/sandbox-api/internal/ipaccess"
+	"godsendjoseph.dev/sandbox-api/internal/jobs"
 	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/migrations"
+	"godsendjoseph.dev/sandbox-api/internal/models"
 	"godsendjoseph.dev/sandbox-api/internal/notification"
+	"godsendjoseph.dev/sandbox-api/internal/outbox"
 	ratelimiter "godsendjoseph.dev/sandbox-api/internal/rateLimiter"
+	"godsendjoseph.dev/sandbox-api/internal/readonly"
+	"godsendjoseph.dev/sandbox-api/internal/realtime"
 	"godsendjoseph.dev/sandbox-api/internal/storage"
 	"godsendjoseph.dev/sandbox-api/internal/store"
 	"godsendjoseph.dev/sandbox-api/internal/store/cache"
+	"godsendjoseph.dev/sandbox-api/internal/supportref"
+	"godsendjoseph.dev/sandbox-api/internal/webhook"
 )
 
 const version = "0.0.1"
 
+// @title                      Sandbox API
+// @version                    0.0.1
+// @description                Users, posts, feeds and the admin tools around them. /v2 serves the same routes with RFC 7807 errors.
+// @BasePath                   /v1
+// @securityDefinitions.apikey BearerAuth
+// @in                         header
+// @name                       Authorization
+// @description                "Bearer " followed by the token of /auth/login
 func main() {
-	err := godotenv.Load()
+	envErr := godotenv.Load()
+
+	// a config file or flags may stand in for the .env file
+	loaded, err := appconfig.Load(os.Args[1:])
 	if err != nil {
+		log.Fatal(err)
+	}
+	if loaded.Command != "" && loaded.Command != doctorCommand {
+		log.Fatalf("unknown command %q, run without one to start the server or with %s", loaded.Command, doctorCommand)
+	}
+	if envErr != nil && loaded.File == "" {
 		log.Fatal("Error loading .env file")
 	}
 
+	// credentials may point at secret files or a secrets manager, resolve them before any client is built
+	if err := loaded.ResolveSecrets(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
 	cfg := config{
 		addr:        env.GetString("ADDR", ":8080"),
 		apiURL:      env.GetString("EXTERNAL_URL", "http://localhost:8080"),
 		frontendURL: env.GetString("FRONTEND_URL", "http://localhost:8080"),
 		db: dbConfig{
-			addr:         fmt.Sprintf("%s:%s", env.GetString("DB_HOST", "127.0.0.1"), env.GetString("DB_PORT", "3306")),
-			user:         env.GetString("DB_USER", "root"),
-			password:     env.GetString("DB_PASSWORD", "root"),
-			dbName:       env.GetString("DB_NAME", "testdb"),
-			maxOpenConns: env.GetInt("DB_MAX_OPEN_CONNS", 25),
-			maxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 25),
-			maxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
+			addr:                 fmt.Sprintf("%s:%s", env.GetString("DB_HOST", "127.0.0.1"), env.GetString("DB_PORT", "3306")),
+			user:                 env.GetString("DB_USER", "root"),
+			password:             env.GetString("DB_PASSWORD", "root"),
+			dbName:               env.GetString("DB_NAME", "testdb"),
+			maxOpenConns:         env.GetInt("DB_MAX_OPEN_CONNS", 25),
+			maxIdleConns:         env.GetInt("DB_MAX_IDLE_CONNS", 25),
+			maxIdleTime:          env.GetString("DB_MAX_IDLE_TIME", "15m"),
+			migrateOnStart:       env.GetBool("MIGRATE_ON_START", true),
+			replicaAddrs:         splitList(env.GetString("DB_REPLICA_ADDRS", "")),
+			replicaUser:          env.GetString("DB_REPLICA_USER", env.GetString("DB_USER", "root")),
+			replicaPassword:      env.GetString("DB_REPLICA_PASSWORD", env.GetString("DB_PASSWORD", "root")),
+			replicaCheckInterval: env.GetDuration("DB_REPLICA_CHECK_INTERVAL", 10*time.Second),
+			slowQueryThreshold:   env.GetDuration("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+			statementCache:       env.GetInt("DB_STATEMENT_CACHE", 50),
 		},
 		redisCfg: redisConfig{
 			addr:    env.GetString("REDIS_ADDR", "localhost:6379"),
@@ -54,17 +94,27 @@ func main() {
 			db:      env.GetInt("REDIS_DB", 0),
 			enabled: env.GetBool("REDIS_ENABLED", false),
 		},
-		r2: r2Config{
-			endpoint:        env.GetString("R2_ENDPOINT", ""),
-			accessKeyID:     env.GetString("R2_ACCESS_KEY_ID", ""),
-			secretAccessKey: env.GetString("R2_SECRET_ACCESS_KEY", ""),
-			bucketName:      env.GetString("R2_BUCKET_NAME", ""),
-			publicURL:       env.GetString("R2_PUBLIC_URL", ""),
-			enabled:         env.GetBool("R2_ENABLED", false),
+		// the R2_* names are read as fallbacks from before STORAGE_DRIVER existed
+		fileStorage: storageConfig{
+			client: storage.Config{
+				Driver:          env.GetString("STORAGE_DRIVER", storage.DriverR2),
+				Endpoint:        env.GetString("STORAGE_ENDPOINT", env.GetString("R2_ENDPOINT", "")),
+				Region:          env.GetString("STORAGE_REGION", ""),
+				AccessKeyID:     env.GetString("STORAGE_ACCESS_KEY_ID", env.GetString("R2_ACCESS_KEY_ID", "")),
+				SecretAccessKey: env.GetString("STORAGE_SECRET_ACCESS_KEY", env.GetString("R2_SECRET_ACCESS_KEY", "")),
+				Bucket:          env.GetString("STORAGE_BUCKET", env.GetString("R2_BUCKET_NAME", "")),
+				PublicURL:       env.GetString("STORAGE_PUBLIC_URL", env.GetString("R2_PUBLIC_URL", "")),
+			},
+			enabled:       env.GetBool("STORAGE_ENABLED", env.GetBool("R2_ENABLED", false)),
+			cleanupDryRun: env.GetBool("STORAGE_CLEANUP_DRY_RUN", true),
 		},
-		env: env.GetString("ENV", "development"),
+		env:    env.GetString("ENV", "development"),
+		sdkDir: env.GetString("SDK_DIR", "sdk"),
 		mail: mailConfig{
-			mailerType: env.GetString("MAILER_TYPE", "smtp"),
+			// MAILER_TYPE is the old name of MAIL_DRIVER. A list like "plunk,smtp" fails over in that order
+			driver:            env.GetString("MAIL_DRIVER", env.GetString("MAILER_TYPE", mailer.DriverSMTP)),
+			failoverThreshold: env.GetInt("MAIL_FAILOVER_THRESHOLD", 3),
+			failoverCooldown:  env.GetDuration("MAIL_FAILOVER_COOLDOWN", time.Minute),
 
 			// HTTP mailer config (Plunk)
 			httpMail: httpMailConfig{
@@ -80,15 +130,25 @@ func main() {
 				mailUsername:    env.GetString("MAIL_USERNAME", "plunk"),
 				mailPassword:    env.GetString("MAIL_PASSWORD", "-"),
 				mailEncryption:  env.GetString("MAIL_ENCRYPTION", "tls"),
+				tlsVerify:       env.GetBool("MAIL_TLS_VERIFY", true),
+				tlsCAFile:       env.GetString("MAIL_TLS_CA_FILE", ""),
 				mailFromAddress: env.GetString("MAIL_FROM_ADDRESS", "demo@godsend.dev"),
 				mailFromName:    env.GetString("MAIL_FROM_NAME", "Test"),
+				poolSize:        env.GetInt("MAIL_SMTP_POOL_SIZE", 3),
+				idleTimeout:     env.GetDuration("MAIL_SMTP_IDLE_TIMEOUT", 30*time.Second),
 			},
 
-			// Queue settings
-			workerCount: env.GetInt("MAIL_WORKER_COUNT", 3),
-			queueSize:   env.GetInt("MAIL_QUEUE_SIZE", 100),
+			// SES mailer config
+			sesMail: sesMailConfig{
+				region:          env.GetString("SES_REGION", "us-east-1"),
+				accessKeyID:     env.GetString("SES_ACCESS_KEY_ID", ""),
+				secretAccessKey: env.GetString("SES_SECRET_ACCESS_KEY", ""),
+				mailFromAddress: env.GetString("MAIL_FROM_ADDRESS", "demo@godsend.dev"),
+				mailFromName:    env.GetString("MAIL_FROM_NAME", "Test"),
+			},
 
-			exp: time.Hour * 24 * 3, // user have 3 days to accept invitation
+			otpPerHour:         env.GetInt("OTP_EMAILS_PER_HOUR", 5),
+			scheduledPerMinute: env.GetInt("MAIL_SCHEDULED_PER_MINUTE", 500),
 		},
 		auth: authConfig{
 			basic: basicConfig{
@@ -96,27 +156,187 @@ func main() {
 				password: env.GetString("BASIC_AUTH_PASSWORD", "password"),
 			},
 			token: tokenConfig{
-				secret:   env.GetString("TOKEN_SECRET", "secret"),
-				exp:      time.Hour * 24 * 1, // expires in 1 days
-				audience: env.GetString("TOKEN_AUDIENCE", "social-api"),
-				issuer:   env.GetString("TOKEN_ISSUER", "social-api"),
+				secret:           env.GetString("TOKEN_SECRET", "secret"),
+				keysDir:          env.GetString("TOKEN_KEYS_DIR", ""),
+				activeKeyID:      env.GetString("TOKEN_ACTIVE_KEY_ID", ""),
+				exp:              env.GetDuration("TOKEN_EXP", time.Hour*24), // expires in 1 days
+				roleExp:          parseRoleExpiry(env.GetString("TOKEN_ROLE_EXP", "admin=1h")),
+				maxSession:       env.GetDuration("TOKEN_MAX_SESSION", time.Hour*24*7),
+				impersonationExp: env.GetDuration("TOKEN_IMPERSONATION_EXP", time.Minute*15),
+				audience:         env.GetString("TOKEN_AUDIENCE", "social-api"),
+				issuer:           env.GetString("TOKEN_ISSUER", "social-api"),
+			},
+			cookie: cookieConfig{
+				enabled:  env.GetBool("AUTH_COOKIE_ENABLED", false),
+				name:     env.GetString("AUTH_COOKIE_NAME", "session"),
+				csrfName: env.GetString("AUTH_CSRF_COOKIE_NAME", "csrf_token"),
+				domain:   env.GetString("AUTH_COOKIE_DOMAIN", ""),
+				only:     env.GetBool("AUTH_COOKIE_ONLY", false),
+				sameSite: env.GetString("AUTH_COOKIE_SAME_SITE", "lax"),
+				secure:   env.GetBool("AUTH_COOKIE_SECURE", false),
+			},
+			invitation: invitationConfig{
+				exp:    env.GetDuration("INVITATION_EXP", time.Hour*24*3), // invitees have 3 days to accept
+				secret: env.GetString("INVITATION_SECRET", ""),
+			},
+			newDevice: newDeviceConfig{
+				email:     env.GetBool("AUTH_NEW_DEVICE_EMAIL", true),
+				alert:     env.GetBool("AUTH_NEW_DEVICE_ALERT", false),
+				reportExp: env.GetDuration("AUTH_NEW_DEVICE_REPORT_EXP", time.Hour*24*7),
 			},
 		},
 		rateLimiter: ratelimiter.Config{
 			RequestPerTimeForIP: env.GetInt("RATE_LIMITER_REQUEST_COUNT", 20),
 			TimeFrame:           time.Minute * 5,
 			Enabled:             env.GetBool("RATE_LIMITER_ENABLED", true),
+			KeyStrategy:         env.GetString("RATE_LIMITER_KEY_STRATEGY", ratelimiter.KeyByIP),
+		},
+		concurrency: concurrencyConfig{
+			maxInFlight: env.GetInt("CONCURRENCY_MAX_IN_FLIGHT", 0),
+			perUser:     env.GetInt("CONCURRENCY_PER_USER", 0),
+			retryAfter:  env.GetDuration("CONCURRENCY_RETRY_AFTER", time.Second*5),
+		},
+		userDeletion: userDeletionConfig{
+			posts:      env.GetString("USER_DELETION_POSTS", string(store.CascadeDelete)),
+			reparentTo: int64(env.GetInt("USER_DELETION_REPARENT_TO", 0)),
+		},
+		readOnly: readOnlyConfig{
+			enabled:   env.GetBool("READ_ONLY_MODE", false),
+			allowlist: strings.Split(env.GetString("READ_ONLY_ALLOWLIST", "/v1/auth/login,/v1/auth/refresh,/v1/auth/logout"), ","),
+		},
+		gravatar: env.GetBool("AVATAR_GRAVATAR_ENABLED", false),
+		cache: cache.Config{
+			Users: cache.EntityConfig{
+				TTL:  env.GetDuration("CACHE_USERS_TTL", cache.UserExpTime),
+				Size: env.GetInt("CACHE_USERS_SIZE", 10_000),
+			},
+			Feeds: cache.EntityConfig{
+				TTL:  env.GetDuration("CACHE_FEEDS_TTL", cache.FeedExpTime),
+				Size: env.GetInt("CACHE_FEEDS_SIZE", 1_000),
+			},
+			MemoryFallback: env.GetBool("CACHE_MEMORY_FALLBACK", false),
+		},
+		cacheWarmup: cacheWarmupConfig{
+			enabled: env.GetBool("CACHE_WARMUP_ENABLED", false),
+			timeout: env.GetDuration("CACHE_WARMUP_TIMEOUT", time.Second*10),
+		},
+		slo: sloConfig{
+			objectives:    env.GetString("SLO_OBJECTIVES", "auth:/v1/auth:500ms:99.9;user:/v1/user,/v1/users:500ms:99.5;uploads:/uploads:2s:99"),
+			burnRateAlert: env.GetFloat("SLO_BURN_RATE_ALERT", 14.4),
+		},
+		support: supportConfig{
+			email:          env.GetString("SUPPORT_EMAIL", ""),
+			contactPerHour: env.GetInt("SUPPORT_CONTACT_PER_HOUR", 5),
+			eventTTL:       env.GetDuration("SUPPORT_EVENT_TTL", 7*24*time.Hour),
+		},
+		geoip: geoipConfig{
+			countryDB:          env.GetString("GEOIP_COUNTRY_DB", ""),
+			asnDB:              env.GetString("GEOIP_ASN_DB", ""),
+			blockedCountries:   countryCodes(env.GetString("GEOIP_BLOCKED_COUNTRIES", "")),
+			strictCountries:    countryCodes(env.GetString("GEOIP_STRICT_COUNTRIES", "")),
+			strictRequestCount: env.GetInt("GEOIP_STRICT_REQUEST_COUNT", 5),
+		},
+		ipAccess: ipAccessConfig{
+			adminAllowlist: splitList(env.GetString("IP_ADMIN_ALLOWLIST", "")),
+			denylist:       splitList(env.GetString("IP_DENYLIST", "")),
+		},
+		captcha: captchaConfig{
+			provider: env.GetString("CAPTCHA_PROVIDER", ""),
+			secret:   env.GetString("CAPTCHA_SECRET", ""),
+			auth:     env.GetBool("CAPTCHA_AUTH_ENABLED", false),
+		},
+		verification: verificationConfig{
+			reminders:   env.GetBool("VERIFICATION_REMINDERS_ENABLED", true),
+			remindAfter: env.GetDuration("VERIFICATION_REMIND_AFTER", time.Hour*24),
+			deleteAfter: env.GetDuration("VERIFICATION_DELETE_AFTER", time.Hour*24*7),
+			otpExpiry:   env.GetDuration("VERIFICATION_REMINDER_OTP_EXP", time.Hour*24),
+		},
+		campaigns: campaignConfig{
+			perMinute: env.GetInt("EMAIL_CAMPAIGN_PER_MINUTE", 100),
+		},
+		security: securityConfig{
+			hstsMaxAge:     env.GetDuration("SECURITY_HSTS_MAX_AGE", 365*24*time.Hour),
+			frameOptions:   env.GetString("SECURITY_FRAME_OPTIONS", "DENY"),
+			referrerPolicy: env.GetString("SECURITY_REFERRER_POLICY", "strict-origin-when-cross-origin"),
+		},
+		cors: corsConfig{
+			allowedOrigins:   splitList(env.GetString("CORS_ALLOWED_ORIGINS", "")),
+			allowedMethods:   splitList(env.GetString("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE,PATCH")),
+			allowedHeaders:   splitList(env.GetString("CORS_ALLOWED_HEADERS", "Accept,Authorization,Content-Type,Content-Encoding,X-CSRF-Token")),
+			allowCredentials: env.GetBool("CORS_ALLOW_CREDENTIALS", false),
+			maxAge:           env.GetInt("CORS_MAX_AGE", 300),
+		},
+		snapshot: snapshotConfig{
+			enabled:  env.GetBool("ANALYTICS_SNAPSHOT_ENABLED", false),
+			schedule: env.GetString("ANALYTICS_SNAPSHOT_SCHEDULE", "0 4 * * *"),
+			salt:     env.GetString("ANALYTICS_SNAPSHOT_SALT", ""),
+			keep:     env.GetInt("ANALYTICS_SNAPSHOT_KEEP", 7),
+		},
+		digest: digestConfig{
+			enabled:   env.GetBool("DIGEST_ENABLED", false),
+			schedule:  env.GetString("DIGEST_SCHEDULE", "0 8 * * 1"),
+			batchSize: env.GetInt("DIGEST_BATCH_SIZE", 200),
+		},
+		events: eventsConfig{
+			publisher:    env.GetString("EVENTS_PUBLISHER", events.PublisherInProcess),
+			stream:       env.GetString("EVENTS_STREAM", "sandbox-api-events"),
+			group:        env.GetString("EVENTS_CONSUMER_GROUP", "sandbox-api"),
+			kafkaRESTURL: env.GetString("EVENTS_KAFKA_REST_URL", ""),
+		},
+		jobs: jobsConfig{
+			backend: env.GetString("JOBS_BACKEND", jobs.BackendMemory),
+			// MAIL_WORKER_COUNT and MAIL_QUEUE_SIZE are the old names, from when only emails were queued
+			workerCount: env.GetInt("JOBS_WORKER_COUNT", env.GetInt("MAIL_WORKER_COUNT", 3)),
+			queueSize:   env.GetInt("JOBS_QUEUE_SIZE", env.GetInt("MAIL_QUEUE_SIZE", 100)),
+			redisPrefix: env.GetString("JOBS_REDIS_PREFIX", "sandbox-api-jobs"),
+		},
+		realtime: realtimeConfig{
+			channel: env.GetString("REALTIME_CHANNEL", "sandbox-api-realtime"),
+		},
+		body: bodyConfig{
+			jsonLimit:        int64(env.GetInt("BODY_LIMIT_JSON_KB", 1024)) << 10,
+			uploadLimit:      int64(env.GetInt("BODY_LIMIT_UPLOAD_KB", 10240)) << 10,
+			compressionLevel: env.GetInt("COMPRESSION_LEVEL", 5),
+		},
+		password: passwordConfig{
+			minScore:     env.GetInt("PASSWORD_MIN_SCORE", 2),
+			breachCheck:  env.GetBool("PASSWORD_BREACH_CHECK", false),
+			breachAPIURL: env.GetString("PASSWORD_BREACH_API_URL", auth.DefaultBreachAPIURL),
 		},
 		timezone: env.GetString("TIMEZONE", "UTC"),
+		// empty picks redis when it is enabled and the database otherwise
+		cronLocker: env.GetString("CRON_LOCKER", ""),
 		slack: slackConfig{
 			webhookURL: env.GetString("SLACK_WEBHOOK_URL", ""),
 			channel:    env.GetString("SLACK_CHANNEL", "#notifications"),
 			username:   env.GetString("SLACK_USERNAME", "GoApp Bot"),
 			iconEmoji:  env.GetString("SLACK_ICON_EMOJI", ":robot_face:"),
 			enabled:    env.GetBool("SLACK_ENABLED", false),
+			routes:     env.GetString("SLACK_ROUTES", ""),
+		},
+		notify: notifyConfig{
+			discordWebhookURL:  env.GetString("DISCORD_WEBHOOK_URL", ""),
+			discordMinSeverity: env.GetString("DISCORD_MIN_SEVERITY", "warning"),
+			teamsWebhookURL:    env.GetString("TEAMS_WEBHOOK_URL", ""),
+			teamsMinSeverity:   env.GetString("TEAMS_MIN_SEVERITY", "warning"),
+			webhookURL:         env.GetString("NOTIFY_WEBHOOK_URL", ""),
+			webhookSecret:      env.GetString("NOTIFY_WEBHOOK_SECRET", ""),
+			webhookMinSeverity: env.GetString("NOTIFY_WEBHOOK_MIN_SEVERITY", "error"),
 		},
 	}
 
+	if loaded.PrintConfig {
+		if err := loaded.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// run the dependency self-test instead of starting the server, it lints the templates itself
+	if loaded.Command == doctorCommand {
+		os.Exit(runDoctor(cfg))
+	}
+
 	cfgZap := zap.NewProductionConfig()
 	cfgZap.OutputPaths = []string{"stdout"}
 	cfgZap.ErrorOutputPaths = []string{"stderr"}
@@ -131,6 +351,22 @@ func main() {
 	defer loggerZap.Sync()
 	logger.Info("Logger initialized successfully")
 
+	// a broken template should stop a deploy before it reaches production, where it only warns
+	if errs := mailer.LintTemplates(); len(errs) > 0 {
+		for _, err := range errs {
+			logger.Warnw("email template lint", "error", err)
+		}
+		if cfg.env != "production" {
+			logger.Fatalf("%d email template problem(s), fix them or register the template in mailer.Templates", len(errs))
+		}
+	}
+
+	// every query of the primary and the replicas is timed, the slow ones are logged
+	queryMetrics := db.NewQueryMetrics(cfg.db.slowQueryThreshold, func(query db.SlowQuery) {
+		logger.Warnw("slow query", "query", query.Query, "duration", query.Duration, "error", query.Err)
+	})
+	instrument := &db.Instrumentation{Metrics: queryMetrics, StatementCache: cfg.db.statementCache}
+
 	// connect to the database
 	myDB, err := db.New(
 		cfg.db.addr,
@@ -140,6 +376,7 @@ func main() {
 		cfg.db.maxOpenConns,
 		cfg.db.maxIdleConns,
 		cfg.db.maxIdleTime,
+		instrument,
 	)
 	if err != nil {
 		logger.Panic(err)
@@ -148,6 +385,12 @@ func main() {
 	defer myDB.Close()
 	logger.Info("connected to database")
 
+	applied, err := startupMigrations(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infow("migrations checked", "applied", applied, "migrateOnStart", cfg.db.migrateOnStart)
+
 	// Cache instance
 	var redisDB *redis.Client
 	if cfg.redisCfg.enabled {
@@ -159,21 +402,14 @@ func main() {
 		logger.Info("redis connection has been established")
 	}
 
-	// R2 instance
+	// Object storage, R2, S3, GCS or MinIO
 	var storageClient storage.Client
-	if cfg.r2.enabled {
-		r2Client, err := storage.NewR2Client(
-			cfg.r2.endpoint,
-			cfg.r2.accessKeyID,
-			cfg.r2.secretAccessKey,
-			cfg.r2.bucketName,
-			cfg.r2.publicURL,
-		)
+	if cfg.fileStorage.enabled {
+		storageClient, err = storage.New(cfg.fileStorage.client)
 		if err != nil {
-			logger.Fatal("Failed to initialize R2 client:", err)
+			logger.Fatal("Failed to initialize storage client:", err)
 		}
-		storageClient = r2Client
-		logger.Info("R2 storage client initialized")
+		logger.Infow("storage client initialized", "driver", cfg.fileStorage.client.Driver)
 	}
 
 	// Rate Limiter
@@ -181,116 +417,447 @@ func main() {
 		cfg.rateLimiter.RequestPerTimeForIP,
 		cfg.rateLimiter.TimeFrame,
 	)
+	strictRateLimiter := ratelimiter.NewFixedWindowLimiter(
+		cfg.geoip.strictRequestCount,
+		cfg.rateLimiter.TimeFrame,
+	)
+
+	// Load shedding works on the requests of this instance, so it is never shared
+	concurrency := ratelimiter.NewConcurrencyLimiter(cfg.concurrency.maxInFlight, cfg.concurrency.perUser)
 
-	if err := handleMigrations(myDB); err != nil {
+	// OTP throttling has to be shared between instances, so it lives in Redis when available
+	var otpLimiter ratelimiter.Limiter = ratelimiter.NewFixedWindowLimiter(cfg.mail.otpPerHour, time.Hour)
+	if redisDB != nil {
+		otpLimiter = ratelimiter.NewRedisFixedWindowLimiter(redisDB, "otp-limit-", cfg.mail.otpPerHour, time.Hour)
+	}
+
+	var contactLimiter ratelimiter.Limiter = ratelimiter.NewFixedWindowLimiter(cfg.support.contactPerHour, time.Hour)
+	if redisDB != nil {
+		contactLimiter = ratelimiter.NewRedisFixedWindowLimiter(redisDB, "contact-limit-", cfg.support.contactPerHour, time.Hour)
+	}
+
+	captchaVerifier, err := captcha.New(cfg.captcha.provider, cfg.captcha.secret)
+	if err != nil {
 		logger.Fatal(err)
 	}
+	if cfg.captcha.auth && captchaVerifier == nil {
+		logger.Fatal("CAPTCHA_AUTH_ENABLED needs a CAPTCHA_PROVIDER")
+	}
 
-	// check for exiting after migrations
-	if len(os.Args) > 1 && (os.Args[len(os.Args)-1] == "up" || os.Args[len(os.Args)-1] == "down" || os.Args[len(os.Args)-1] == "force") {
-		return
+	geoReader, err := geoip.Open(cfg.geoip.countryDB, cfg.geoip.asnDB)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer geoReader.Close()
+	if cfg.geoip.countryDB == "" && (len(cfg.geoip.blockedCountries) > 0 || len(cfg.geoip.strictCountries) > 0) {
+		logger.Fatal("GEOIP_BLOCKED_COUNTRIES and GEOIP_STRICT_COUNTRIES need GEOIP_COUNTRY_DB")
+	}
+	if geoReader != nil {
+		logger.Infow("geoip initialized", "country", cfg.geoip.countryDB != "", "asn", cfg.geoip.asnDB != "")
 	}
 
-	dbStore := store.NewStorage(myDB)
-	rdb := cache.NewRedisStorage(redisDB)
+	// The runtime rules of the IP lists have to be shared between instances, so they live in
+	// Redis when available
+	var ipRules ipaccess.Store = ipaccess.NewMemoryStore()
+	if redisDB != nil {
+		ipRules = ipaccess.NewRedisStore(redisDB, "ip-access-")
+	}
+	ipAccess, err := ipaccess.NewChecker(ipRules, cfg.ipAccess.adminAllowlist, cfg.ipAccess.denylist)
+	if err != nil {
+		logger.Fatalf("IP_ADMIN_ALLOWLIST and IP_DENYLIST: %v", err)
+	}
 
-	var mailClient mailer.Client
+	// Read-only mode switched through the admin API has to reach every instance, READ_ONLY_MODE
+	// applies until it is
+	var readOnlyStore readonly.Store = readonly.NewMemoryStore()
+	if redisDB != nil {
+		readOnlyStore = readonly.NewRedisStore(redisDB, "read-only-mode")
+	}
 
-	switch cfg.mail.mailerType {
-	case "http":
-		logger.Info("Initializing HTTP mailer with Plunk API")
+	// A support reference can be looked up on any instance until SUPPORT_EVENT_TTL when the
+	// failed requests are in Redis, otherwise only on the instance that served it
+	var supportEvents supportref.Store = supportref.NewMemoryStore(supportEventLimit)
+	if redisDB != nil {
+		supportEvents = supportref.NewRedisStore(redisDB, "support-event-", cfg.support.eventTTL)
+	}
 
-		// Create HTTP mailer
-		httpMailer := mailer.NewHttpMailer(
-			cfg.mail.httpMail.apiKey,
-			cfg.mail.httpMail.mailFromAddress,
-			cfg.mail.httpMail.mailFromName,
-		)
+	cfg.ipAccess.trustedProxies, err = parseTrustedProxies(splitList(env.GetString("TRUSTED_PROXIES", "")))
+	if err != nil {
+		logger.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
 
-		// Wrap with in-memory queue
-		inMemoryHTTPMailer := mailer.NewHttpInMemoryMailer(
-			httpMailer,
-			cfg.mail.workerCount,
-			cfg.mail.queueSize,
-		)
+	if cfg.body.compressionLevel < 0 || cfg.body.compressionLevel > 9 {
+		logger.Fatal("COMPRESSION_LEVEL must be between 0 and 9")
+	}
 
-		// Start the mail processing workers
-		inMemoryHTTPMailer.Start()
-		// Make sure to stop gracefully at shutdown
-		defer inMemoryHTTPMailer.Stop()
-
-		mailClient = inMemoryHTTPMailer
-		//logger.Info("HTTP mailer initialized with %s workers and queue size of %s", cfg.mail.workerCount, cfg.mail.queueSize)
-		logger.Info("HTTP mailer initialized")
-	case "smtp":
-		logger.Info("Initializing SMTP mailer")
-
-		// Create SMTP mailer (your existing code)
-		smtpMailer := mailer.NewSendSMTP(
-			cfg.mail.smtpMail.mailHost,
-			cfg.mail.smtpMail.mailPort,
-			cfg.mail.smtpMail.mailUsername,
-			cfg.mail.smtpMail.mailPassword,
-			cfg.mail.smtpMail.mailEncryption,
-			cfg.mail.smtpMail.mailFromAddress,
-			cfg.mail.smtpMail.mailFromName,
-		)
+	if cfg.password.minScore < auth.PasswordScoreMin || cfg.password.minScore > auth.PasswordScoreMax {
+		logger.Fatalf("PASSWORD_MIN_SCORE must be between %d and %d", auth.PasswordScoreMin, auth.PasswordScoreMax)
+	}
+	passwords.minScore = cfg.password.minScore
+	passwords.logger = logger
+	if cfg.password.breachCheck {
+		passwords.breaches = auth.NewBreachChecker(cfg.password.breachAPIURL)
+	}
+	logger.Infow("password policy initialized", "minScore", cfg.password.minScore, "breachCheck", cfg.password.breachCheck)
 
-		// Create in-memory mailer with queue
-		inMemoryMailer := mailer.NewInMemoryMailer(
-			smtpMailer,
-			cfg.mail.workerCount,
-			cfg.mail.queueSize,
-		)
+	if err := cfg.cors.resolve(cfg.env, cfg.frontendURL); err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infow("cors initialized", "origins", cfg.cors.allowedOrigins, "credentials", cfg.cors.allowCredentials)
+
+	if err := cfg.auth.cookie.resolve(cfg.env); err != nil {
+		logger.Fatal(err)
+	}
+
+	// Read replicas, reads fall back to the primary while none of them answers
+	var replicas *store.Replicas
+	if len(cfg.db.replicaAddrs) > 0 {
+		replicaDBs := make([]*sql.DB, 0, len(cfg.db.replicaAddrs))
+		for _, addr := range cfg.db.replicaAddrs {
+			replicaDB, err := db.Open(addr, cfg.db.replicaUser, cfg.db.replicaPassword, cfg.db.dbName, cfg.db.maxOpenConns, cfg.db.maxIdleConns, cfg.db.maxIdleTime, instrument)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			replicaDBs = append(replicaDBs, replicaDB)
+		}
+
+		replicas = store.NewReplicas(myDB, replicaDBs, func(index int, healthy bool, err error) {
+			if healthy {
+				logger.Infow("read replica in rotation", "replica", cfg.db.replicaAddrs[index])
+				return
+			}
+			logger.Warnw("read replica out of rotation", "replica", cfg.db.replicaAddrs[index], "error", err)
+		})
+		replicas.Start(cfg.db.replicaCheckInterval)
+		defer replicas.Close()
+		defer replicas.Stop()
+		logger.Infow("read replicas initialized", "replicas", len(replicaDBs), "healthy", replicas.Healthy())
+	}
+
+	dbStore, err := store.NewStorage(myDB, replicas, store.DeletionPolicy{
+		Posts:      store.CascadeAction(cfg.userDeletion.posts),
+		ReparentTo: cfg.userDeletion.reparentTo,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	cacheStorage := cache.NewStorage(redisDB, cfg.cache)
+	logger.Infow("cache initialized", "backend", cacheStorage.Backend)
 
-		// Start the mail processing workers
-		inMemoryMailer.Start()
-		// Make sure to stop gracefully at shutdown
-		defer inMemoryMailer.Stop()
+	provider, err := mailer.New(cfg.mail.driver, mailerConfig(cfg.mail))
+	if err != nil {
+		logger.Fatal(err)
+	}
 
-		mailClient = inMemoryMailer
-		logger.Info("SMTP mailer initialized with %d workers and queue size of %d", cfg.mail.workerCount, cfg.mail.queueSize)
+	// Keep an audit trail of every email, sent or not
+	provider.Observe(func(delivery mailer.Delivery) {
+		err := dbStore.EmailLogs.Create(context.Background(), &models.EmailLog{
+			Provider:         delivery.Provider,
+			Template:         delivery.Template,
+			Recipient:        delivery.Recipient,
+			Subject:          delivery.Subject,
+			Status:           delivery.Status,
+			Attempts:         delivery.Attempts,
+			ProviderResponse: delivery.Response,
+		})
+		if err != nil {
+			logger.Errorw("failed to record email delivery", "recipient", delivery.Recipient, "template", delivery.Template, "error", err)
+		}
+	})
+
+	var jobQueue jobs.Queue
+	switch cfg.jobs.backend {
+	case jobs.BackendMemory:
+		jobQueue = jobs.NewMemoryQueue(cfg.jobs.queueSize)
+	case jobs.BackendRedis:
+		if redisDB == nil {
+			logger.Fatal("JOBS_BACKEND=redis needs REDIS_ENABLED=true")
+		}
+		jobQueue = jobs.NewRedisQueue(redisDB, cfg.jobs.redisPrefix)
+	case jobs.BackendDB:
+		jobQueue = jobs.NewDBQueue(dbStore.Jobs)
 	default:
-		logger.Fatal("Invalid mailer type: %s. Use 'smtp' or 'http'", cfg.mail.mailerType)
+		logger.Fatalf("unknown JOBS_BACKEND %q, use memory, redis or db", cfg.jobs.backend)
 	}
+	jobPool := jobs.NewPool(jobQueue, cfg.jobs.workerCount, logger)
+
+	// Async emails are jobs of the pool
+	queuedMailer := mailer.NewQueuedMailer(provider, jobPool)
+
+	// Campaigns, reminders and digests skip the users who turned them off in their settings
+	queuedMailer.CheckOptOuts(func(email, category string) (bool, error) {
+		return dbStore.Settings.OptedOut(context.Background(), email, category)
+	})
+
+	// Emails sent for later wait in the database, see dispatch-scheduled-emails
+	queuedMailer.ScheduleWith(dbStore.ScheduledEmails)
 
-	jwtAuthenticator := auth.NewJWTAuthenticator(
+	// Every job type is registered, start the workers
+	jobPool.Start()
+	// Stopped last, the memory backend runs what is left before shutting down
+	defer jobPool.Stop()
+	logger.Infow("job pool initialized", "backend", cfg.jobs.backend, "workers", cfg.jobs.workerCount)
+
+	var mailClient mailer.Client = queuedMailer
+	logger.Infow("mailer initialized", "driver", cfg.mail.driver)
+
+	var jwtAuthenticator auth.Authenticator = auth.NewJWTAuthenticator(
 		cfg.auth.token.secret,
 		cfg.auth.token.audience,
 		cfg.auth.token.issuer,
 	)
 
+	var keyAuthenticator *auth.KeyAuthenticator
+	if cfg.auth.token.keysDir != "" {
+		keyAuthenticator, err = auth.NewKeyAuthenticator(
+			cfg.auth.token.keysDir,
+			cfg.auth.token.activeKeyID,
+			cfg.auth.token.audience,
+			cfg.auth.token.issuer,
+		)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		jwtAuthenticator = keyAuthenticator
+		logger.Infow("signing tokens with asymmetric keys", "dir", cfg.auth.token.keysDir)
+	}
+
 	scheduler := cron.NewScheduler(logger, cfg.timezone)
+
+	// Replicas share the jobs, each run is claimed by one of them
+	hostname, _ := os.Hostname()
+	instance := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	cronLocker := cfg.cronLocker
+	if cronLocker == "" {
+		cronLocker = cron.LockerDB
+		if redisDB != nil {
+			cronLocker = cron.LockerRedis
+		}
+	}
+	switch cronLocker {
+	case cron.LockerRedis:
+		if redisDB == nil {
+			logger.Fatal("CRON_LOCKER=redis needs REDIS_ENABLED=true")
+		}
+		scheduler.SetLocker(cron.NewRedisLocker(redisDB, instance))
+	case cron.LockerDB:
+		scheduler.SetLocker(cron.NewDBLocker(dbStore.CronRuns, instance))
+	case cron.LockerNone:
+	default:
+		logger.Fatalf("unknown CRON_LOCKER %q, use redis, db or none", cronLocker)
+	}
+	logger.Infow("cron locker initialized", "locker", cronLocker, "instance", instance)
+
 	// Create job manager with necessary dependencies
-	//jobManager := cron.NewJobManager(logger, inMemoryMailer)
+	jobManager := cron.NewJobManager(logger, mailClient, dbStore, storageClient)
 
 	// Register jobs
 	//scheduler.Custom("send-test-email", "*/5 * * * *", jobManager.SendTestEmail(cfg.env)) // Every 5 minutes
+	scheduler.Daily("purge-deleted-accounts", "03:00", jobManager.PurgeDeletedAccounts())
+	scheduler.Daily("clear-expired-otps", "02:30", jobManager.ClearExpiredOTPs())
+	if storageClient != nil {
+		scheduler.Hourly("cleanup-orphaned-files", 15, jobManager.CleanupOrphanedFiles(cfg.fileStorage.cleanupDryRun))
+	}
+
+	if cfg.verification.reminders {
+		if cfg.verification.deleteAfter > 0 && cfg.verification.deleteAfter <= cfg.verification.remindAfter {
+			logger.Fatal("VERIFICATION_DELETE_AFTER must be longer than VERIFICATION_REMIND_AFTER, or 0 to keep unverified accounts")
+		}
+		scheduler.Hourly("remind-unverified-accounts", 45, jobManager.RemindUnverifiedAccounts(cron.UnverifiedAccountPolicy{
+			RemindAfter: cfg.verification.remindAfter,
+			DeleteAfter: cfg.verification.deleteAfter,
+			OTPExpiry:   cfg.verification.otpExpiry,
+			IsSandbox:   cfg.env != "production",
+		}))
+	}
+
+	scheduler.Custom("dispatch-scheduled-emails", "* * * * *", jobManager.DispatchScheduledEmails(cfg.mail.scheduledPerMinute))
+
+	if cfg.campaigns.perMinute > 0 {
+		scheduler.Custom("send-email-campaigns", "* * * * *", jobManager.SendEmailCampaigns(cfg.campaigns.perMinute, cfg.env != "production"))
+	}
+
+	if cfg.digest.enabled {
+		scheduler.Custom("send-weekly-digests", cfg.digest.schedule, jobManager.SendWeeklyDigests(cfg.digest.batchSize, cfg.env != "production"))
+	}
+
+	if cfg.snapshot.enabled {
+		if cfg.snapshot.salt == "" {
+			logger.Fatal("ANALYTICS_SNAPSHOT_SALT is required when analytics snapshots are enabled")
+		}
+		if storageClient == nil {
+			logger.Warn("analytics snapshots are enabled but object storage is not, no snapshot will be written")
+		}
+		scheduler.Custom("export-analytics-snapshot", cfg.snapshot.schedule, jobManager.ExportAnalyticsSnapshot(myDB, cfg.snapshot.salt, cfg.snapshot.keep))
+	}
+
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	notifierNames := []string{}
+	for _, n := range notifier.Notifiers() {
+		notifierNames = append(notifierNames, n.Name())
+	}
+	logger.Infow("notifications initialized", "notifiers", notifierNames)
+
+	var eventPublisher events.Publisher
+	switch cfg.events.publisher {
+	case events.PublisherInProcess:
+		eventPublisher = events.NewInProcessPublisher(1000)
+	case events.PublisherRedis:
+		if redisDB == nil {
+			logger.Fatal("EVENTS_PUBLISHER=redis needs REDIS_ENABLED=true")
+		}
+		eventPublisher = events.NewRedisPublisher(redisDB, cfg.events.stream, cfg.events.group, instance)
+	case events.PublisherKafka:
+		if cfg.events.kafkaRESTURL == "" {
+			logger.Fatal("EVENTS_PUBLISHER=kafka needs EVENTS_KAFKA_REST_URL")
+		}
+		eventPublisher = events.NewKafkaPublisher(cfg.events.kafkaRESTURL, cfg.events.stream, cfg.events.group, instance)
+	default:
+		logger.Fatalf("unknown EVENTS_PUBLISHER %q, use inprocess, redis or kafka", cfg.events.publisher)
+	}
+	logger.Infow("event bus initialized", "publisher", cfg.events.publisher)
+
+	// With Redis every instance hears the messages published by the others
+	var realtimeBroadcaster realtime.Broadcaster
+	if redisDB != nil {
+		realtimeBroadcaster = realtime.NewRedisBroadcaster(redisDB, cfg.realtime.channel)
+	}
+	logger.Infow("realtime hub initialized", "redis", realtimeBroadcaster != nil)
+
+	sloObjectives, err := parseSLOObjectives(cfg.slo.objectives)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	app := &application{
+		config:             cfg,
+		db:                 myDB,
+		replicas:           replicas,
+		queryMetrics:       queryMetrics,
+		redisClient:        redisDB,
+		store:              dbStore,
+		cacheStorage:       cacheStorage,
+		logger:             logger,
+		mailer:             mailClient,
+		mailProvider:       provider,
+		authenticator:      jwtAuthenticator,
+		rateLimiter:        rateLimiter,
+		otpLimiter:         otpLimiter,
+		contactLimiter:     contactLimiter,
+		strictRateLimiter:  strictRateLimiter,
+		concurrency:        concurrency,
+		geoip:              geoReader,
+		ipAccess:           ipAccess,
+		readOnly:           readonly.NewSwitch(readOnlyStore, cfg.readOnly.enabled),
+		captcha:            captchaVerifier,
+		scheduler:          scheduler,
+		notifier:           notifier,
+		storageClient:      storageClient,
+		supportEvents:      supportEvents,
+		emailVerifications: newEmailVerificationJobs(emailVerificationJobLimit),
+		slo:                newSLOTracker(sloObjectives, cfg.slo.burnRateAlert),
+		status:             newStatusMonitor(),
+		deprecationUsage:   newDeprecationUsage(),
+		webhooks:           webhook.NewDispatcher(dbStore.Webhooks, logger),
+		events:             events.NewBus(eventPublisher, logger),
+		jobs:               jobPool,
+		outbox:             outbox.NewDispatcher(dbStore.Outbox, logger),
+		realtime:           realtime.NewHub(realtimeBroadcaster, logger),
+	}
+
+	// these work on the state of this instance, so every instance runs them
+	scheduler.PerInstance("check-slo-burn-rates", "* * * * *", app.checkSLOBurnRates)
+	scheduler.PerInstance("check-status", "* * * * *", app.checkStatus)
+	if keyAuthenticator != nil {
+		// Picks up rotated keys without a restart
+		scheduler.PerInstance("reload-signing-keys", "*/5 * * * *", func() {
+			if err := keyAuthenticator.Reload(); err != nil {
+				logger.Errorw("failed to reload signing keys, keeping the current ones", "error", err)
+			}
+		})
+	}
+	scheduler.PerInstance("reload-mail-templates", "* * * * *", func() {
+		if err := app.syncMailTemplates(context.Background()); err != nil {
+			logger.Errorw("failed to reload email templates", "error", err)
+		}
+	})
+	scheduler.PerInstance("reload-scheduled-jobs", "* * * * *", func() {
+		if err := app.syncScheduledJobs(context.Background()); err != nil {
+			logger.Errorw("failed to reload scheduled jobs", "error", err)
+		}
+	})
+	scheduler.PerInstance("reload-ip-rules", "* * * * *", func() {
+		if err := app.ipAccess.Reload(context.Background()); err != nil {
+			logger.Errorw("failed to reload IP rules", "error", err)
+		}
+	})
+	scheduler.PerInstance("reload-read-only", "* * * * *", func() {
+		if err := app.readOnly.Reload(context.Background()); err != nil {
+			logger.Errorw("failed to reload read-only mode", "error", err)
+		}
+	})
+
+	// Templates edited through the admin API win over the embedded ones
+	if err := app.syncMailTemplates(context.Background()); err != nil {
+		logger.Errorw("failed to load email templates, using the embedded ones", "error", err)
+	}
+
+	// Schedules stored in the database win over the ones in code
+	if err := app.syncScheduledJobs(context.Background()); err != nil {
+		logger.Errorw("failed to load scheduled jobs, using the schedules from code", "error", err)
+	}
+
+	// Runtime IP rules added on other instances or before a restart
+	if err := app.ipAccess.Reload(context.Background()); err != nil {
+		logger.Errorw("failed to load IP rules, using the configured networks only", "error", err)
+	}
+
+	// Read-only mode switched on another instance or before a restart
+	if err := app.readOnly.Reload(context.Background()); err != nil {
+		logger.Errorw("failed to load read-only mode, using READ_ONLY_MODE", "error", err)
+	}
+
+	// Slack security alerts name the country and network of the client
+	notifier.EnrichWith(app.addLocationFields)
+
+	// The status page has something to show before the first scheduled check
+	go app.checkStatus()
 
 	// Start the scheduler
 	go scheduler.Start()
 	// Ensure the scheduler stops when the app shuts down
 	defer scheduler.Stop()
 
-	slackNotifier := notification.NewSlackNotifier(
-		cfg.slack.webhookURL,
-		cfg.slack.channel,
-		cfg.slack.username,
-		cfg.slack.iconEmoji,
-		cfg.slack.enabled,
-	)
+	// Every instance sends webhooks, each delivery is claimed by one of them
+	app.webhooks.Start()
+	defer app.webhooks.Stop()
 
-	app := &application{
-		config:        cfg,
-		store:         dbStore,
-		cacheStorage:  rdb,
-		logger:        logger,
-		mailer:        mailClient,
-		authenticator: jwtAuthenticator,
-		rateLimiter:   rateLimiter,
-		scheduler:     scheduler,
-		slackNotifier: slackNotifier,
-		storageClient: storageClient,
+	// Every instance sends the outbox, each message is claimed by one of them
+	app.subscribeOutbox()
+	app.outbox.Start()
+	defer app.outbox.Stop()
+
+	// started before the bus, whose subscribers push to it
+	app.realtime.Start()
+	defer app.realtime.Stop()
+
+	// Handlers publish, the subscribers send the mails, Slack messages and webhooks
+	app.subscribeEvents()
+	app.events.Start()
+	defer app.events.Stop()
+
+	avatars = avatarConfig{
+		apiURL:   cfg.apiURL,
+		gravatar: cfg.gravatar,
+	}
+
+	// Warm up before listening so the first requests after a deploy do not all miss
+	if cfg.cacheWarmup.enabled {
+		app.warmCaches(context.Background())
 	}
 
 	mux := app.mount()
@@ -298,50 +865,106 @@ func main() {
 	logger.Fatal(app.run(mux))
 }
 
-func handleMigrations(db *sql.DB) error {
-	driver, err := mysql.WithInstance(db, &mysql.Config{})
+// startupMigrations refuses a dirty migration version and, with MIGRATE_ON_START, applies
+// the pending migrations. Replicas take turns through the migration lock.
+func startupMigrations(cfg config) (int, error) {
+	// the migrate driver closes its database with the runner, so it gets a pool of its own
+	migrationDB, err := db.New(cfg.db.addr, cfg.db.user, cfg.db.password, cfg.db.dbName, 2, 2, cfg.db.maxIdleTime, nil)
 	if err != nil {
-		return fmt.Errorf("could not create driver instance: %v", err)
+		return 0, err
 	}
 
-	// Use filepath.Abs to get absolute path (this is the key fix)
-	migrationsPath := "file://cmd/migrate/migrations"
-	if os.Getenv("DOCKER_ENV") == "true" {
-		// If in Docker, use the absolute path within the container
-		migrationsPath = "file:///app/cmd/migrate/migrations"
-	}
-
-	m, err := migrate.NewWithDatabaseInstance(
-		migrationsPath,
-		"mysql",
-		driver,
-	)
+	runner, err := migrations.New(migrationDB, migrations.Dir(), os.Stdout)
 	if err != nil {
-		return fmt.Errorf("could not create migration instance: %v", err)
+		migrationDB.Close()
+		return 0, err
 	}
+	defer runner.Close()
 
-	cmd := os.Args[len(os.Args)-1]
-	switch cmd {
-	case "up":
-		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-			return fmt.Errorf("could not run up migration: %v", err)
-		}
-	case "down":
-		if err := m.Down(); err != nil && err != migrate.ErrNoChange {
-			return fmt.Errorf("could not run down migration: %v", err)
+	return runner.Startup(cfg.db.migrateOnStart)
+}
+
+// newNotifier fans out to Slack when it is enabled and to every other service with a
+// webhook URL set
+func newNotifier(cfg config) (*notification.Fanout, error) {
+	notifiers := []notification.Notifier{}
+
+	if cfg.slack.enabled {
+		slack := notification.NewSlackNotifier(
+			cfg.slack.webhookURL,
+			cfg.slack.channel,
+			cfg.slack.username,
+			cfg.slack.iconEmoji,
+			cfg.slack.enabled,
+		)
+
+		routes, err := notification.ParseRoutes(cfg.slack.routes)
+		if err != nil {
+			return nil, err
 		}
-	case "force":
-		if len(os.Args) != 3 {
-			return fmt.Errorf("force command requires a version number")
+		slack.SetRoutes(routes)
+
+		notifiers = append(notifiers, slack)
+	}
+
+	if cfg.notify.discordWebhookURL != "" {
+		severity, err := notification.ParseSeverity(cfg.notify.discordMinSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("DISCORD_MIN_SEVERITY: %w", err)
 		}
-		version, err := strconv.ParseInt(os.Args[1], 10, 64)
+		notifiers = append(notifiers, notification.NewDiscordNotifier(cfg.notify.discordWebhookURL, cfg.slack.username, severity))
+	}
+
+	if cfg.notify.teamsWebhookURL != "" {
+		severity, err := notification.ParseSeverity(cfg.notify.teamsMinSeverity)
 		if err != nil {
-			return fmt.Errorf("invalid version number: %v", err)
+			return nil, fmt.Errorf("TEAMS_MIN_SEVERITY: %w", err)
 		}
-		if err := m.Force(int(version)); err != nil {
-			return fmt.Errorf("could not force version: %v", err)
+		notifiers = append(notifiers, notification.NewTeamsNotifier(cfg.notify.teamsWebhookURL, severity))
+	}
+
+	if cfg.notify.webhookURL != "" {
+		severity, err := notification.ParseSeverity(cfg.notify.webhookMinSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFY_WEBHOOK_MIN_SEVERITY: %w", err)
 		}
+		notifiers = append(notifiers, notification.NewWebhookNotifier(cfg.notify.webhookURL, cfg.notify.webhookSecret, severity))
 	}
 
-	return nil
+	return notification.NewFanout(notifiers...), nil
+}
+
+// mailerConfig maps the mail settings onto the driver configuration of the mailer package
+func mailerConfig(cfg mailConfig) mailer.Config {
+	return mailer.Config{
+		SMTP: mailer.SMTPConfig{
+			Host:        cfg.smtpMail.mailHost,
+			Port:        cfg.smtpMail.mailPort,
+			Username:    cfg.smtpMail.mailUsername,
+			Password:    cfg.smtpMail.mailPassword,
+			Encryption:  cfg.smtpMail.mailEncryption,
+			TLSVerify:   cfg.smtpMail.tlsVerify,
+			TLSCAFile:   cfg.smtpMail.tlsCAFile,
+			FromAddress: cfg.smtpMail.mailFromAddress,
+			FromName:    cfg.smtpMail.mailFromName,
+			PoolSize:    cfg.smtpMail.poolSize,
+			IdleTimeout: cfg.smtpMail.idleTimeout,
+		},
+		Plunk: mailer.PlunkConfig{
+			APIKey:      cfg.httpMail.apiKey,
+			FromAddress: cfg.httpMail.mailFromAddress,
+			FromName:    cfg.httpMail.mailFromName,
+		},
+		SES: mailer.SESConfig{
+			Region:          cfg.sesMail.region,
+			AccessKeyID:     cfg.sesMail.accessKeyID,
+			SecretAccessKey: cfg.sesMail.secretAccessKey,
+			FromAddress:     cfg.sesMail.mailFromAddress,
+			FromName:        cfg.sesMail.mailFromName,
+		},
+		Failover: mailer.FailoverConfig{
+			Threshold: cfg.failoverThreshold,
+			Cooldown:  cfg.failoverCooldown,
+		},
+	}
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+)
+
+// metric is one sample in the Prometheus text format, labels are written sorted by name
+type metric struct {
+	name   string
+	kind   string
+	help   string
+	labels map[string]string
+	value  float64
+}
+
+// getMetricsHandler serves the gauges and counters of this instance in the Prometheus text
+// format, behind Basic Auth so a scraper can reach it without a user token
+func (app *application) getMetricsHandler(writer http.ResponseWriter, request *http.Request) {
+	metrics, err := app.collectMetrics(request)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(writer, metrics)
+}
+
+// collectMetrics gathers the samples of every component that reports any
+func (app *application) collectMetrics(request *http.Request) ([]metric, error) {
+	metrics := concurrencyMetrics(app.concurrency.Stats())
+	metrics = append(metrics, deprecationMetrics(app.deprecationUsage.report())...)
+
+	if queued, ok := app.mailer.(*mailer.QueuedMailer); ok {
+		stats, err := queued.Stats(request.Context())
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, mailQueueMetrics(stats)...)
+	}
+
+	return metrics, nil
+}
+
+func mailQueueMetrics(stats mailer.QueueStats) []metric {
+	const (
+		depthHelp    = "Jobs in the queue the emails are sent from, by state"
+		attemptsHelp = "Attempts at sending a queued email on this instance, by outcome"
+	)
+
+	metrics := []metric{
+		{"mail_queue_depth", "gauge", depthHelp, map[string]string{"state": "pending"}, float64(stats.Depth.Pending)},
+		{"mail_queue_depth", "gauge", depthHelp, map[string]string{"state": "running"}, float64(stats.Depth.Running)},
+		{"mail_queue_depth", "gauge", depthHelp, map[string]string{"state": "failed"}, float64(stats.Depth.Failed)},
+		{"mail_queue_attempts_total", "counter", attemptsHelp, map[string]string{"outcome": "succeeded"}, float64(stats.Email.Succeeded)},
+		{"mail_queue_attempts_total", "counter", attemptsHelp, map[string]string{"outcome": "retried"}, float64(stats.Email.Retried)},
+		{"mail_queue_attempts_total", "counter", attemptsHelp, map[string]string{"outcome": "failed"}, float64(stats.Email.Failed)},
+		{"mail_queue_attempt_duration_average_seconds", "gauge", "Average time of an attempt at sending a queued email", nil, float64(stats.Email.AverageDuration) / 1000},
+	}
+
+	for _, worker := range stats.Workers {
+		labels := map[string]string{"worker": fmt.Sprint(worker.ID)}
+		busy := 0.0
+		if worker.Busy {
+			busy = 1
+		}
+		metrics = append(metrics,
+			metric{"jobs_worker_busy", "gauge", "Whether the job worker is running a job", labels, busy},
+			metric{"jobs_worker_processed_total", "counter", "Jobs the worker ran on this instance", labels, float64(worker.Processed)},
+		)
+	}
+
+	return metrics
+}
+
+// writeMetrics writes the samples of a metric together, under one HELP and TYPE line
+func writeMetrics(writer io.Writer, metrics []metric) {
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+
+	for i, sample := range metrics {
+		if i == 0 || metrics[i-1].name != sample.name {
+			fmt.Fprintf(writer, "# HELP %s %s\n", sample.name, sample.help)
+			fmt.Fprintf(writer, "# TYPE %s %s\n", sample.name, sample.kind)
+		}
+		fmt.Fprintf(writer, "%s%s %g\n", sample.name, formatLabels(sample.labels), sample.value)
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -3,33 +3,44 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
 	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/notification"
+	ratelimiter "godsendjoseph.dev/sandbox-api/internal/rateLimiter"
+	"godsendjoseph.dev/sandbox-api/internal/store"
 )
 
+// requestIDHeader echoes the chi request ID, clients quote it to match a response to the logs
+const requestIDHeader = "X-Request-ID"
+
+const loggerCtx contextKey = "logger"
+
+// tokenRefreshHeader tells the client its token is past half its lifetime and should be refreshed
+const tokenRefreshHeader = "X-Token-Refresh"
+
+const sessionStartCtx contextKey = "sessionStart"
+
+var errInvalidAuthHeader = errors.New("invalid auth header")
+
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		// read the auth header
-		authHeader := request.Header.Get("Authorization")
-		if authHeader == "" {
-			app.unauthorizedErrorResponse(writer, request, fmt.Errorf("invalid auth header"))
-			return
-		}
-
-		// parse it -> get the base64 encoded username and password
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			app.unauthorizedErrorResponse(writer, request, fmt.Errorf("invalid auth header"))
+		token, err := app.requestToken(request)
+		if err != nil {
+			app.unauthorizedErrorResponse(writer, request, err)
 			return
 		}
 
-		token := parts[1]
-
 		jwtToken, err := app.authenticator.ValidateToken(token)
 		if err != nil {
 			app.unauthorizedErrorResponse(writer, request, err)
@@ -52,15 +63,107 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// tokens issued before the last password change have been revoked
+		if user.PasswordChangedAt != nil {
+			issuedAt, err := claims.GetIssuedAt()
+			if err != nil || issuedAt == nil || issuedAt.Before(*user.PasswordChangedAt) {
+				app.unauthorizedErrorResponse(writer, request, fmt.Errorf("token has been revoked"))
+				return
+			}
+		}
+
+		impersonator, err := app.impersonator(ctx, claims)
+		if err != nil {
+			app.unauthorizedErrorResponse(writer, request, err)
+			return
+		}
+
+		// impersonation tokens run out instead of being refreshed
+		authTime := sessionStart(claims)
+		if impersonator == nil && app.shouldRefreshToken(claims, authTime) {
+			writer.Header().Set(tokenRefreshHeader, "true")
+		}
+
 		ctx = context.WithValue(ctx, userAuthCtx, user)
+		ctx = context.WithValue(ctx, sessionStartCtx, authTime)
+		setDeprecationCaller(ctx, user)
+
+		if impersonator != nil {
+			ctx = context.WithValue(ctx, impersonatorCtx, impersonator)
+			ctx = store.ContextWithActor(ctx, impersonator.ID)
+			app.serveImpersonated(writer, request.WithContext(ctx), next)
+			return
+		}
 
+		ctx = store.ContextWithActor(ctx, user.ID)
 		next.ServeHTTP(writer, request.WithContext(ctx))
 	})
 }
 
+// requestToken reads the bearer token of the Authorization header. In cookie mode a request
+// without the header may send the token in the session cookie instead.
+func (app *application) requestToken(request *http.Request) (string, error) {
+	authHeader := request.Header.Get("Authorization")
+	if authHeader == "" {
+		if app.config.auth.cookie.enabled {
+			if cookie, err := request.Cookie(app.config.auth.cookie.name); err == nil && cookie.Value != "" {
+				return cookie.Value, nil
+			}
+		}
+		return "", errInvalidAuthHeader
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", errInvalidAuthHeader
+	}
+
+	return parts[1], nil
+}
+
+// sessionStart is when the user logged in. Tokens issued before sliding sessions
+// have no auth_time, for those the session starts when the token was issued.
+func sessionStart(claims jwt.MapClaims) time.Time {
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		return time.Unix(int64(authTime), 0)
+	}
+
+	if issuedAt, err := claims.GetIssuedAt(); err == nil && issuedAt != nil {
+		return issuedAt.Time
+	}
+
+	return time.Now()
+}
+
+// shouldRefreshToken is true once the token is more than half way to expiring,
+// as long as a refresh would still extend it
+func (app *application) shouldRefreshToken(claims jwt.MapClaims, authTime time.Time) bool {
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return false
+	}
+
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return false
+	}
+
+	halfway := issuedAt.Add(expiresAt.Sub(issuedAt.Time) / 2)
+	sessionEnd := authTime.Add(app.config.auth.token.maxSession)
+
+	return time.Now().After(halfway) && sessionEnd.After(expiresAt.Time)
+}
+
+// BasicAuthMiddleware checks the BASIC_AUTH_* credentials. Nobody gets in while either of them
+// is empty, so a blank .env never opens the routes behind it.
 func (app *application) BasicAuthMiddleware() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if app.config.auth.basic.username == "" || app.config.auth.basic.password == "" {
+				app.unauthorizedBasicErrorResponse(writer, request, fmt.Errorf("basic auth credentials are not configured"))
+				return
+			}
+
 			// read the auth header
 			authHeader := request.Header.Get("Authorization")
 			if authHeader == "" {
@@ -97,21 +200,71 @@ func (app *application) BasicAuthMiddleware() func(next http.Handler) http.Handl
 }
 
 func (app *application) checkRolePrecedence(ctx context.Context, user *models.User, roleName string) (bool, error) {
-	role, err := app.store.Roles.GetByName(ctx, roleName)
-
-	if err != nil {
-		return false, err
+	role, ok := app.cacheStorage.Roles.Get(roleName)
+	if !ok {
+		var err error
+		role, err = app.store.Roles.GetByName(ctx, roleName)
+		if err != nil {
+			return false, err
+		}
+		app.cacheStorage.Roles.Set(role)
 	}
 
 	return user.Role.Level >= role.Level, nil
 }
 
-func (app *application) getUser(ctx context.Context, userID int64) (*models.User, error) {
-	if app.config.redisCfg.enabled {
-		return app.store.Users.GetByID(ctx, userID)
+// deletedScopeMiddleware lets admins see soft deleted rows on GET requests with ?deleted=include
+// or ?deleted=only, everyone else keeps seeing only the rows that are not deleted
+func (app *application) deletedScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		value := request.URL.Query().Get("deleted")
+		if value == "" || request.Method != http.MethodGet {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		deleted, err := store.ParseDeleted(value)
+		if err != nil {
+			app.badRequestResponse(writer, request, err)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(request.Context(), getUserFromCtx(request), "admin")
+		if err != nil {
+			app.internalServerError(writer, request, err)
+			return
+		}
+		if !allowed {
+			app.forbiddenResponseError(writer, request)
+			return
+		}
+
+		ctx := store.ContextWithDeleted(request.Context(), deleted)
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// requireRole only lets users with at least the given role through
+func (app *application) requireRole(roleName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			allowed, err := app.checkRolePrecedence(request.Context(), getUserFromCtx(request), roleName)
+			if err != nil {
+				app.internalServerError(writer, request, err)
+				return
+			}
+
+			if !allowed {
+				app.forbiddenResponseError(writer, request)
+				return
+			}
+
+			next.ServeHTTP(writer, request)
+		})
 	}
+}
 
-	app.logger.Infow("cache hit", "key", "user", "userID", userID)
+func (app *application) getUser(ctx context.Context, userID int64) (*models.User, error) {
 	user, err := app.cacheStorage.Users.Get(ctx, userID)
 
 	if err != nil {
@@ -120,7 +273,7 @@ func (app *application) getUser(ctx context.Context, userID int64) (*models.User
 	}
 
 	if user == nil {
-		app.logger.Infow("fetching from db", "userID", userID)
+		app.logger.Debugw("fetching from db", "userID", userID)
 		user, err := app.store.Users.GetByID(ctx, userID)
 		if err != nil {
 			return nil, err
@@ -136,10 +289,102 @@ func (app *application) getUser(ctx context.Context, userID int64) (*models.User
 	return user, nil
 }
 
+// getUserByUsername resolves username through the cache and loads the user like getUser
+func (app *application) getUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	userID, ok, err := app.cacheStorage.Usernames.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		user, err := app.getUser(ctx, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			// the account was deleted since, the username may be free again
+			if err := app.cacheStorage.Usernames.Delete(ctx, username); err != nil {
+				return nil, err
+			}
+		}
+		return user, err
+	}
+
+	user, err := app.store.Users.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cacheStorage.Usernames.Set(ctx, user.Username, user.ID); err != nil {
+		return nil, err
+	}
+	if err := app.cacheStorage.Users.Set(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// TimeoutMiddleware cancels requests running longer than timeout, the streams are left open
+func (app *application) TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		timed := middleware.Timeout(timeout)(next)
+
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if isStreamPath(request.URL.Path) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			timed.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// LocaleMiddleware picks the locale of the response from Accept-Language, see i18n.Match
+func (app *application) LocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		locale := i18n.Match(request.Header.Get("Accept-Language"))
+
+		writer.Header().Set("Content-Language", locale)
+		writer.Header().Add("Vary", "Accept-Language")
+
+		next.ServeHTTP(writer, request.WithContext(i18n.WithLocale(request.Context(), locale)))
+	})
+}
+
+// RequestLoggerMiddleware has to run after SupportRefMiddleware. It answers the request ID
+// in X-Request-ID and stores a logger tagged with it and the support reference, see loggerFor.
+func (app *application) RequestLoggerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		requestID := middleware.GetReqID(ctx)
+
+		writer.Header().Set(requestIDHeader, requestID)
+		ctx = notification.ContextWithRequestID(ctx, requestID)
+		ctx = context.WithValue(ctx, loggerCtx, app.logger.With(
+			"request_id", requestID,
+			"support_ref", notification.SupportRefFromContext(ctx),
+		))
+
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// loggerFor returns the logger of the request, so every line it logs carries its request ID
+func (app *application) loggerFor(request *http.Request) *zap.SugaredLogger {
+	if logger, ok := request.Context().Value(loggerCtx).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return app.logger
+}
+
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		if app.config.rateLimiter.Enabled {
-			if allow, retryAfter := app.rateLimiter.Allow(request.RemoteAddr); !allow {
+			// clients from GEOIP_STRICT_COUNTRIES get the smaller budget of their own limiter
+			limiter := app.rateLimiter
+			if app.strictCountry(request) {
+				limiter = app.strictRateLimiter
+			}
+
+			if allow, retryAfter := limiter.Allow(app.rateLimitKey(request)); !allow {
 				app.rateLimitExceededResponse(writer, request, retryAfter.String())
 				return
 			}
@@ -147,3 +392,44 @@ func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(writer, request)
 	})
 }
+
+// rateLimitKey picks the bucket for a request
+func (app *application) rateLimitKey(request *http.Request) string {
+	if app.config.rateLimiter.KeyStrategy == ratelimiter.KeyByUser {
+		if userID, ok := app.tokenSubject(request); ok {
+			return "user:" + userID
+		}
+	}
+
+	return "ip:" + clientIP(request)
+}
+
+// clientIP is the address of the client. RemoteAddr has already been rewritten by
+// RealIPMiddleware when the request came through a trusted proxy, the port is dropped.
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// tokenSubject returns the sub claim of a valid bearer token, if there is one
+func (app *application) tokenSubject(request *http.Request) (string, bool) {
+	token, err := app.requestToken(request)
+	if err != nil {
+		return "", false
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(token)
+	if err != nil {
+		return "", false
+	}
+
+	claims, ok := jwtToken.Claims.(jwt.MapClaims)
+	if !ok || claims["sub"] == nil {
+		return "", false
+	}
+
+	return fmt.Sprintf("%.f", claims["sub"]), true
+}
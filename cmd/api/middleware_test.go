@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/auth"
+	ratelimiter "godsendjoseph.dev/sandbox-api/internal/rateLimiter"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	app := newTestApplication(t)
+	user := createTestUser(t, app, "limited", "limited@example.com", true)
+
+	valid, err := app.generateJWTToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := auth.NewJWTAuthenticator("another-secret", "sandbox-api", "sandbox-api").GenerateToken(jwt.MapClaims{
+		"sub": user.ID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iss": "sandbox-api",
+		"aud": "sandbox-api",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := app.authenticator.GenerateToken(jwt.MapClaims{
+		"sub": user.ID,
+		"exp": time.Now().Add(-time.Minute).Unix(),
+		"iss": "sandbox-api",
+		"aud": "sandbox-api",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		strategy   string
+		remoteAddr string
+		token      string
+		want       string
+	}{
+		{"IPv4 without the port", ratelimiter.KeyByIP, "203.0.113.7:4321", "", "ip:203.0.113.7"},
+		{"IPv6 without the port", ratelimiter.KeyByIP, "[2001:db8::1]:4321", "", "ip:2001:db8::1"},
+		{"address without a port", ratelimiter.KeyByIP, "203.0.113.7", "", "ip:203.0.113.7"},
+		{"token ignored by IP", ratelimiter.KeyByIP, "203.0.113.7:4321", valid, "ip:203.0.113.7"},
+		{"valid token by user", ratelimiter.KeyByUser, "203.0.113.7:4321", valid, "user:" + strconv.FormatInt(user.ID, 10)},
+		{"no token by user", ratelimiter.KeyByUser, "[2001:db8::1]:4321", "", "ip:2001:db8::1"},
+		{"token of another signer", ratelimiter.KeyByUser, "203.0.113.7:4321", foreign, "ip:203.0.113.7"},
+		{"expired token", ratelimiter.KeyByUser, "203.0.113.7:4321", expired, "ip:203.0.113.7"},
+		{"malformed token", ratelimiter.KeyByUser, "203.0.113.7:4321", "not-a-jwt", "ip:203.0.113.7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app.config.rateLimiter.KeyStrategy = test.strategy
+
+			request := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
+			request.RemoteAddr = test.remoteAddr
+			if test.token != "" {
+				request.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			if got := app.rateLimitKey(request); got != test.want {
+				t.Errorf("rateLimitKey = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	"godsendjoseph.dev/sandbox-api/internal/realtime"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+// notifyUser stores an in-app notification of kind for userID, actorID is whoever caused
+// it, and pushes it to the open streams of the user
+func (app *application) notifyUser(ctx context.Context, userID int64, actorID *int64, kind string, data map[string]any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	notification := &models.Notification{
+		UserID:  userID,
+		ActorID: actorID,
+		Type:    kind,
+		Data:    payload,
+	}
+
+	if err := app.store.Notifications.Create(ctx, notification); err != nil {
+		return err
+	}
+
+	return app.realtime.Publish(ctx, []int64{userID}, realtime.TypeNotification, notification)
+}
+
+// NotificationList is a page of notifications with the number still unread
+type NotificationList struct {
+	List[*models.Notification]
+	Unread int64 `json:"unread"`
+}
+
+// view keeps unread next to the redacted items
+func (list NotificationList) view(viewer *models.User) any {
+	return struct {
+		List[any]
+		Unread int64 `json:"unread"`
+	}{list.List.views(viewer), list.Unread}
+}
+
+// listNotificationsHandler pages through the notifications of the current user, newest
+// first, with the number still unread
+//
+// @Summary  List the notifications of the current user
+// @Tags     notifications
+// @Produce  json
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Param    unread query bool false "Only unread notifications"
+// @Success  200 {object} Response[NotificationList]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/notifications [get]
+func (app *application) listNotificationsHandler(writer http.ResponseWriter, request *http.Request) {
+	user := getUserFromCtx(request)
+
+	params, offset, err := parseOffsetPage(request, pagination.Options{DefaultLimit: 20, MaxLimit: 100})
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.NotificationQuery{
+		Limit:  params.Limit,
+		Offset: offset,
+	}
+
+	query, err = query.Parse(request)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	ctx := request.Context()
+
+	notifications, err := app.store.Notifications.List(ctx, user.ID, query)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	unread, err := app.store.Notifications.CountUnread(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	page := pagination.OffsetPage(query.Limit, query.Offset, len(notifications))
+	list := NotificationList{List: newList(notifications, page), Unread: unread}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Notifications retrieved", list, withCursorPage(page)); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Mark a notification read
+// @Tags     notifications
+// @Produce  json
+// @Param    notificationID path int true "Notification ID"
+// @Success  200 {object} Response[any]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/notifications/{notificationID}/read [post]
+func (app *application) markNotificationReadHandler(writer http.ResponseWriter, request *http.Request) {
+	user := getUserFromCtx(request)
+
+	id, err := strconv.ParseInt(chi.URLParam(request, "notificationID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	if err := app.store.Notifications.MarkRead(request.Context(), user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if err := writeMessage(writer, request, http.StatusOK, "Notification marked read"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// NotificationsMarked is how many notifications were unread
+type NotificationsMarked struct {
+	Marked int64 `json:"marked"`
+}
+
+// @Summary  Mark every notification read
+// @Tags     notifications
+// @Produce  json
+// @Success  200 {object} Response[NotificationsMarked]
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/notifications/read-all [post]
+func (app *application) markAllNotificationsReadHandler(writer http.ResponseWriter, request *http.Request) {
+	user := getUserFromCtx(request)
+
+	marked, err := app.store.Notifications.MarkAllRead(request.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Notifications marked read", NotificationsMarked{Marked: marked}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
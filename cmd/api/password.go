@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"godsendjoseph.dev/sandbox-api/internal/auth"
+)
+
+// passwordPolicy backs the password and notbreached validation tags
+type passwordPolicy struct {
+	// minScore is the lowest auth.PasswordStrength score accepted
+	minScore int
+	// breaches is nil when the breach check is off
+	breaches *auth.BreachChecker
+	logger   *zap.SugaredLogger
+}
+
+// passwords is set up by main from the config, the defaults only apply the strength check
+var passwords = &passwordPolicy{minScore: 2}
+
+func (policy *passwordPolicy) strong(password string) bool {
+	score, _ := auth.PasswordStrength(password)
+	return score >= policy.minScore
+}
+
+// notBreached lets the password through when the breach API cannot be reached, signing
+// up must not depend on it
+func (policy *passwordPolicy) notBreached(password string) bool {
+	if policy.breaches == nil {
+		return true
+	}
+
+	count, err := policy.breaches.Breaches(context.Background(), password)
+	if err != nil {
+		if policy.logger != nil {
+			policy.logger.Warnw("breached password check failed, skipping it", "error", err)
+		}
+		return true
+	}
+
+	return count == 0
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/events"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+	"godsendjoseph.dev/sandbox-api/internal/utils"
+)
+
+const postCtx contextKey = "post"
+
+type CreatePostPayload struct {
+	Title   string   `json:"title" validate:"required,max=255"`
+	Content string   `json:"content" validate:"required,max=5000"`
+	Tags    []string `json:"tags" validate:"max=10,dive,max=50,slug"`
+}
+
+type UpdatePostPayload struct {
+	Title   *string  `json:"title" validate:"omitempty,max=255"`
+	Content *string  `json:"content" validate:"omitempty,max=5000"`
+	Tags    []string `json:"tags" validate:"omitempty,max=10,dive,max=50,slug"`
+}
+
+// @Summary  Create a post
+// @Tags     posts
+// @Accept   json
+// @Produce  json
+// @Param    payload body CreatePostPayload true "Request body"
+// @Success  201 {object} Response[models.Post]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /posts [post]
+func (app *application) createPostHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload CreatePostPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	user := getUserFromCtx(request)
+
+	post := &models.Post{
+		Title:   payload.Title,
+		Content: payload.Content,
+		UserID:  user.ID,
+		Tags:    utils.StringSlice(payload.Tags),
+		User:    user,
+	}
+
+	if err := app.store.Posts.Create(request.Context(), post); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.publishEvent(request.Context(), events.PostCreated{
+		PostID:    post.ID,
+		UserID:    post.UserID,
+		Title:     post.Title,
+		Tags:      post.Tags,
+		CreatedAt: post.CreatedAt,
+	})
+
+	if err := writeJSON(writer, request, http.StatusCreated, "Post created", post); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  List posts
+// @Tags     posts
+// @Produce  json
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Param    sort query string false "created_at for oldest first, -created_at (default) for newest first"
+// @Param    search query string false "Search term on title and content"
+// @Param    tags query string false "Comma separated tags"
+// @Success  200 {object} Response[List[models.Post]]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /posts [get]
+func (app *application) listPostsHandler(writer http.ResponseWriter, request *http.Request) {
+	params, offset, err := parseOffsetPage(request, createdAtPage(20))
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.PaginatedQuery{
+		Limit:  params.Limit,
+		Offset: offset,
+		Sort:   params.Sort.Direction(),
+	}
+
+	query, err = query.Parse(request)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	posts, err := app.store.Posts.List(request.Context(), query)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	page := pagination.OffsetPage(query.Limit, query.Offset, len(posts))
+
+	if err := writeList(writer, request, "Posts retrieved", posts, page); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Get a post
+// @Tags     posts
+// @Produce  json
+// @Param    postID path int true "Post ID"
+// @Success  200 {object} Response[models.Post]
+// @Failure  401 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /posts/{postID} [get]
+func (app *application) getPostHandler(writer http.ResponseWriter, request *http.Request) {
+	post := getPostFromCtx(request)
+
+	if err := writeJSON(writer, request, http.StatusOK, "Post retrieved", post); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Update a post, its author or a moderator
+// @Tags     posts
+// @Accept   json
+// @Produce  json
+// @Param    postID path int true "Post ID"
+// @Param    payload body UpdatePostPayload true "Request body"
+// @Success  200 {object} Response[models.Post]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /posts/{postID} [patch]
+func (app *application) updatePostHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload UpdatePostPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	post := getPostFromCtx(request)
+
+	if payload.Title != nil {
+		post.Title = *payload.Title
+	}
+	if payload.Content != nil {
+		post.Content = *payload.Content
+	}
+	if payload.Tags != nil {
+		post.Tags = utils.StringSlice(payload.Tags)
+	}
+
+	if err := app.store.Posts.Update(request.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Post updated", post); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Delete a post, its author or an admin
+// @Tags     posts
+// @Produce  json
+// @Param    postID path int true "Post ID"
+// @Success  200 {object} Response[any]
+// @Failure  401 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /posts/{postID} [delete]
+func (app *application) deletePostHandler(writer http.ResponseWriter, request *http.Request) {
+	post := getPostFromCtx(request)
+
+	if err := app.store.Posts.Delete(request.Context(), post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if err := writeMessage(writer, request, http.StatusOK, "Post deleted"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		idParam := chi.URLParam(request, "postID")
+
+		id, err := strconv.ParseInt(idParam, 10, 64)
+		if err != nil {
+			app.badRequestResponse(writer, request, err)
+			return
+		}
+
+		ctx := request.Context()
+
+		post, err := app.store.Posts.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(writer, request, err)
+			default:
+				app.internalServerError(writer, request, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, postCtx, post)
+
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// checkPostOwnership lets the author through, otherwise the user needs at least the given role
+func (app *application) checkPostOwnership(roleName string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		user := getUserFromCtx(request)
+		post := getPostFromCtx(request)
+
+		if post.UserID == user.ID {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(request.Context(), user, roleName)
+		if err != nil {
+			app.internalServerError(writer, request, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponseError(writer, request)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	}
+}
+
+func getPostFromCtx(request *http.Request) *models.Post {
+	post, _ := request.Context().Value(postCtx).(*models.Post)
+	return post
+}
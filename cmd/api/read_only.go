@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+var errReadOnly = errors.New("the API is in read-only mode while we recover from an incident, please try again later")
+
+// readOnlyTogglePath stays writable in read-only mode so the mode can be switched off again
+const readOnlyTogglePath = "/v1/admin/read-only"
+
+type ReadOnlyModePayload struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+type ReadOnlyMode struct {
+	ReadOnly bool `json:"read_only"`
+}
+
+// ReadOnlyMiddleware rejects every mutating request with 503 while read-only mode is on.
+// Safe methods and the configured allowlist keep working.
+func (app *application) ReadOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if app.readOnly.Enabled() && !isSafeMethod(request.Method) && !app.isReadOnlyAllowed(request.URL.Path) {
+			app.serviceUnavailableResponse(writer, request, errReadOnly)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// @Summary  Turn read-only mode on or off
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    payload body ReadOnlyModePayload true "Request body"
+// @Success  200 {object} Response[ReadOnlyMode]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/read-only [put]
+func (app *application) setReadOnlyModeHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload ReadOnlyModePayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	// the other instances pick the change up within a minute
+	if err := app.readOnly.Set(context.WithoutCancel(request.Context()), *payload.Enabled); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+	app.loggerFor(request).Warnw("read-only mode changed", "enabled", *payload.Enabled, "userID", getUserFromCtx(request).ID)
+	app.audit(request, models.AuditReadOnlyChange, 0, map[string]any{"enabled": *payload.Enabled})
+
+	message := "Read-only mode disabled"
+	if *payload.Enabled {
+		message = "Read-only mode enabled"
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, message, ReadOnlyMode{ReadOnly: *payload.Enabled}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+func (app *application) isReadOnlyAllowed(path string) bool {
+	path = strings.TrimSuffix(canonicalPath(path), "/")
+	if path == readOnlyTogglePath {
+		return true
+	}
+
+	for _, allowed := range app.config.readOnly.allowlist {
+		if path == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"godsendjoseph.dev/sandbox-api/internal/ipaccess"
+)
+
+// RealIPMiddleware replaces RemoteAddr with the client address a trusted proxy forwarded, so
+// clientIP, the IP lists, Geo-IP and the rate limits see the client instead of the proxy.
+// The forwarding headers are only read when the connection comes from TRUSTED_PROXIES,
+// anybody else could send whatever address they like in them.
+func (app *application) RealIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if ip := app.forwardedIP(request); ip != "" {
+			request.RemoteAddr = ip
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// forwardedIP is the client address the proxies of request forwarded, empty when the
+// request did not come through a trusted proxy or they did not forward one
+func (app *application) forwardedIP(request *http.Request) string {
+	if len(app.config.ipAccess.trustedProxies) == 0 || !app.isTrustedProxy(clientIP(request)) {
+		return ""
+	}
+
+	// every proxy appends the address it got the request from, so the client is the
+	// rightmost address that is not one of our proxies. The ones left of it are whatever
+	// the client sent.
+	if forwardedFor := request.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				return ""
+			}
+			if i == 0 || !app.isTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+
+	for _, header := range []string{"True-Client-IP", "X-Real-IP"} {
+		if ip := strings.TrimSpace(request.Header.Get(header)); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+
+	return ""
+}
+
+func (app *application) isTrustedProxy(ip string) bool {
+	address, ok := ipaccess.ParseAddr(ip)
+	if !ok {
+		return false
+	}
+
+	for _, network := range app.config.ipAccess.trustedProxies {
+		if network.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies reads TRUSTED_PROXIES, addresses and CIDRs like the IP lists
+func parseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		network, err := ipaccess.ParseNetwork(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIPMiddleware(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		trusted    bool
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"untrusted peer keeps its address", true, "203.0.113.7:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"untrusted peer cannot spoof X-Real-IP", true, "203.0.113.7:4321", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7"},
+		{"no trusted proxies ignores headers", false, "10.0.0.1:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "10.0.0.1"},
+		{"trusted proxy forwards the client", true, "10.0.0.1:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"client prepended entries are skipped", true, "10.0.0.1:4321", map[string]string{"X-Forwarded-For": "192.0.2.9, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"trusted proxy with X-Real-IP", true, "10.0.0.1:4321", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"trusted IPv6 proxy", true, "[fd00::1]:4321", map[string]string{"True-Client-IP": "2001:db8::1"}, "2001:db8::1"},
+		{"malformed X-Forwarded-For is ignored", true, "10.0.0.1:4321", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := &application{}
+			if test.trusted {
+				app.config.ipAccess.trustedProxies = trusted
+			}
+
+			request := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
+			request.RemoteAddr = test.remoteAddr
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+
+			var got string
+			handler := app.RealIPMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+				got = clientIP(request)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			if got != test.want {
+				t.Errorf("clientIP = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
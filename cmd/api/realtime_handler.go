@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// realtimeHeartbeat keeps proxies from closing an idle stream
+	realtimeHeartbeat = time.Second * 25
+	// realtimeRetryMs is how long the client waits before reconnecting
+	realtimeRetryMs = 5000
+)
+
+// streamPaths stay open for as long as the client wants, so they are left out of the
+// request timeout and the SLO latency
+var streamPaths = map[string]bool{
+	"/v1/events": true,
+}
+
+func isStreamPath(path string) bool {
+	return streamPaths[canonicalPath(path)]
+}
+
+// realtimeEventsHandler streams the in-app notifications and feed updates of the current
+// user as server-sent events, named after the message type with its JSON as data
+//
+// @Summary  Stream notifications and feed updates as server-sent events
+// @Tags     notifications
+// @Produce  text/event-stream
+// @Success  200 {string} string
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /events [get]
+func (app *application) realtimeEventsHandler(writer http.ResponseWriter, request *http.Request) {
+	user := getUserFromCtx(request)
+
+	// the stream outlives the server write timeout
+	controller := http.NewResponseController(writer)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	messages, unsubscribe := app.realtime.Subscribe(user.ID)
+	defer unsubscribe()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	// nginx buffers responses by default, which would hold the events back
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(writer, "retry: %d\n\n", realtimeRetryMs)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(realtimeHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-app.realtime.Disconnected():
+			return
+		case msg := <-messages:
+			fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", msg.Type, msg.Data)
+		case <-heartbeat.C:
+			fmt.Fprint(writer, ": ping\n\n")
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -9,31 +9,155 @@ func (app *application) registerRoutes(router *chi.Mux) {
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/v1/health", http.StatusSeeOther)
 	})
+	router.Get("/.well-known/jwks.json", app.getJWKSHandler)
+	// Prometheus scrapes with the Basic Auth credentials
+	router.With(app.BasicAuthMiddleware()).Get("/metrics", app.getMetricsHandler)
 
-	router.Route("/v1", func(route chi.Router) {
-		route.Get("/health", app.healthCheckHandler)
-		route.Post("/bulk-emails", app.sendBulkEmails)
+	for _, version := range app.apiVersions() {
+		router.Route("/"+version.name, func(route chi.Router) {
+			route.Use(app.versionMiddleware(version))
+			version.register(route)
+		})
+	}
+}
+
+// registerSharedRoutes registers the routes every API version serves
+func (app *application) registerSharedRoutes(route chi.Router) {
+	route.Route("/health", func(route chi.Router) {
+		route.Get("/", app.healthCheckHandler)
+		route.Get("/live", app.livenessHandler)
+		route.Get("/ready", app.readinessHandler)
+	})
+	route.Get("/status", app.getStatusHandler)
+	route.Get("/status/page", app.getStatusPageHandler)
+
+	// contact form, the token is optional
+	route.Post("/support/contact", app.contactHandler)
 
-		// users
-		route.Route("/user", func(route chi.Router) {
-			route.Use(app.AuthTokenMiddleware)
-			route.Get("/profile", app.getUserHandler)
-			route.Post("/update-profile", app.updateUserProfileHandler)
+	// generated avatars
+	route.Get("/avatars/{username}", app.getAvatarHandler)
 
-			route.Route("/{userID}", func(route chi.Router) {
-				route.Use(app.usersContextMiddleware)
-				route.Get("/fetch-user", app.getUserByIDHandler)
-			})
+	// API docs, behind Basic Auth
+	route.With(app.BasicAuthMiddleware()).Get("/docs", app.getDocsHandler)
+	route.With(app.BasicAuthMiddleware()).Get("/docs/doc.json", app.getDocsSpecHandler)
+
+	// generated client SDKs
+	route.Get("/sdk", app.listSDKsHandler)
+	route.Get("/sdk/{language}", app.downloadSDKHandler)
+
+	// server-sent events with the notifications and feed updates of the user
+	route.With(app.AuthTokenMiddleware).Get("/events", app.realtimeEventsHandler)
+
+	// users
+	route.Route("/user", func(route chi.Router) {
+		route.Use(app.AuthTokenMiddleware)
+		route.Get("/profile", app.getUserHandler)
+		route.Patch("/profile", app.updateUserProfileHandler)
+		route.With(app.deprecated("POST /v1/user/update-profile")).Post("/update-profile", app.updateUserProfileHandler)
+		route.With(app.denyImpersonation).Post("/change-password", app.changePasswordHandler)
+		route.Post("/avatar", app.uploadAvatarHandler)
+		route.Post("/uploads/presign", app.presignUploadHandler)
+		route.With(app.denyImpersonation).Delete("/account", app.deleteAccountHandler)
+		route.With(app.denyImpersonation).Post("/2fa/enable", app.enableTwoFactorHandler)
+		route.With(app.denyImpersonation).Post("/2fa/confirm", app.confirmTwoFactorHandler)
+		route.With(app.denyImpersonation).Post("/2fa/disable", app.disableTwoFactorHandler)
+		route.Get("/settings", app.getSettingsHandler)
+		route.Patch("/settings", app.updateSettingsHandler)
+		route.Get("/notifications", app.listNotificationsHandler)
+		route.Post("/notifications/read-all", app.markAllNotificationsReadHandler)
+		route.Post("/notifications/{notificationID}/read", app.markNotificationReadHandler)
+
+		route.Route("/{userID}", func(route chi.Router) {
+			route.Use(app.deletedScopeMiddleware)
+			route.Use(app.usersContextMiddleware)
+			route.Get("/fetch-user", app.getUserByIDHandler)
+			route.Post("/follow", app.followUserHandler)
+			route.Delete("/unfollow", app.unfollowUserHandler)
 		})
+	})
 
-		// Public routes
-		route.Route("/auth", func(route chi.Router) {
-			route.Post("/register", app.registerUserHandler)
-			route.Post("/login", app.loginUserHandler)
-			route.Post("/verify-email", app.verifyEmailHandler)
-			route.Post("/forgot-password", app.forgotPasswordHandler)
-			route.Post("/reset-password", app.resetPasswordHandler)
-			route.Post("/resend-otp", app.resendOTPHandler)
+	route.Route("/users", func(route chi.Router) {
+		route.Use(app.AuthTokenMiddleware)
+		route.With(app.deletedScopeMiddleware).Get("/", app.listUsersHandler)
+		route.Get("/by-username/{username}", app.getUserByUsernameHandler)
+	})
+
+	// feed
+	route.Route("/feed", func(route chi.Router) {
+		route.Use(app.AuthTokenMiddleware)
+		route.Get("/", app.getUserFeedHandler)
+	})
+
+	// posts
+	route.Route("/posts", func(route chi.Router) {
+		route.Use(app.AuthTokenMiddleware)
+		route.Get("/", app.listPostsHandler)
+		route.Post("/", app.createPostHandler)
+
+		route.Route("/{postID}", func(route chi.Router) {
+			route.Use(app.postsContextMiddleware)
+			route.Get("/", app.getPostHandler)
+			route.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+			route.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
 		})
 	})
+
+	// admin tools
+	route.Route("/admin", func(route chi.Router) {
+		route.Use(app.AdminIPAllowMiddleware)
+		route.Use(app.AuthTokenMiddleware)
+		route.Use(app.requireRole("admin"))
+		route.Get("/support/{ref}", app.getSupportEventHandler)
+		route.Get("/support/tickets", app.listSupportTicketsHandler)
+		route.Get("/support/tickets/{ticketID}", app.getSupportTicketHandler)
+		route.Post("/support/tickets/{ticketID}/respond", app.respondSupportTicketHandler)
+		route.Put("/read-only", app.setReadOnlyModeHandler)
+		route.Get("/ip-rules", app.listIPRulesHandler)
+		route.Post("/ip-rules/{list}", app.addIPRuleHandler)
+		route.Delete("/ip-rules/{list}", app.removeIPRuleHandler)
+		route.Post("/email-verifications", app.verifyEmailsHandler)
+		route.Get("/email-verifications/{jobID}", app.getEmailVerificationHandler)
+		route.Get("/slo", app.getSLOHandler)
+		route.Get("/emails", app.listEmailLogsHandler)
+		route.Get("/email-campaigns", app.listEmailCampaignsHandler)
+		route.Post("/email-campaigns", app.createEmailCampaignHandler)
+		route.Get("/email-campaigns/{campaignID}", app.getEmailCampaignHandler)
+		route.Post("/email-campaigns/{campaignID}/cancel", app.cancelEmailCampaignHandler)
+		route.Get("/audit", app.listAuditLogsHandler)
+		route.With(app.usersContextMiddleware).Put("/users/{userID}/role", app.changeUserRoleHandler)
+		route.With(app.usersContextMiddleware).Post("/users/{userID}/impersonate", app.impersonateUserHandler)
+		route.Post("/invitations", app.createInvitationHandler)
+		route.Get("/mail-providers", app.getMailProvidersHandler)
+		route.Get("/mail-queue", app.getMailQueueHandler)
+		route.Get("/mail-templates", app.listMailTemplatesHandler)
+		route.Get("/mail-templates/{name}", app.getMailTemplateHandler)
+		route.Post("/mail-templates/{name}", app.createMailTemplateHandler)
+		route.Put("/mail-templates/{name}/active", app.activateMailTemplateHandler)
+		route.Post("/mail-templates/{name}/preview", app.previewMailTemplateHandler)
+		route.Get("/deprecations", app.getDeprecationsHandler)
+		route.Get("/cache-stats", app.getCacheStatsHandler)
+		route.Get("/db-stats", app.getDBStatsHandler)
+		route.Get("/scheduled-jobs", app.listScheduledJobsHandler)
+		route.Patch("/scheduled-jobs/{name}", app.updateScheduledJobHandler)
+		route.Get("/webhooks", app.listWebhooksHandler)
+		route.Post("/webhooks", app.createWebhookHandler)
+		route.Get("/webhooks/{webhookID}", app.getWebhookHandler)
+		route.Patch("/webhooks/{webhookID}", app.updateWebhookHandler)
+		route.Delete("/webhooks/{webhookID}", app.deleteWebhookHandler)
+		route.Get("/webhooks/{webhookID}/deliveries", app.listWebhookDeliveriesHandler)
+	})
+
+	// Public routes
+	route.Route("/auth", func(route chi.Router) {
+		route.Post("/register", app.registerUserHandler)
+		route.Get("/check-username", app.checkUsernameHandler)
+		route.Post("/login", app.loginUserHandler)
+		route.Post("/verify-email", app.verifyEmailHandler)
+		route.Post("/forgot-password", app.forgotPasswordHandler)
+		route.Post("/reset-password", app.resetPasswordHandler)
+		route.Post("/report-sign-in", app.reportSignInHandler)
+		route.Post("/resend-otp", app.resendOTPHandler)
+		route.With(app.AuthTokenMiddleware, app.denyImpersonation).Post("/refresh", app.refreshTokenHandler)
+		route.Post("/logout", app.logoutHandler)
+	})
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/cron"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+type UpdateScheduledJobPayload struct {
+	CronExpr *string         `json:"cron_expr" validate:"omitempty,min=9,max=100"`
+	Enabled  *bool           `json:"enabled"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// syncScheduledJobs stores the schedules registered in code that have no row yet and
+// applies every row to the scheduler. It runs at startup and every minute, so changes
+// made on another instance are picked up without a restart.
+func (app *application) syncScheduledJobs(ctx context.Context) error {
+	defaults := []*models.ScheduledJob{}
+	for _, job := range app.scheduler.GetJobs() {
+		defaults = append(defaults, &models.ScheduledJob{
+			Name:     job.Name,
+			CronExpr: job.Schedule,
+			Enabled:  !job.Disabled,
+		})
+	}
+
+	if err := app.store.ScheduledJobs.CreateMissing(ctx, defaults); err != nil {
+		return err
+	}
+
+	jobs, err := app.store.ScheduledJobs.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		err := app.scheduler.Configure(cron.JobConfig{
+			Name:     job.Name,
+			Schedule: job.CronExpr,
+			Enabled:  job.Enabled,
+		})
+		if err != nil {
+			app.logger.Warnw("could not apply scheduled job", "job", job.Name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// @Summary  List the scheduled jobs
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[[]models.ScheduledJob]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/scheduled-jobs [get]
+func (app *application) listScheduledJobsHandler(writer http.ResponseWriter, request *http.Request) {
+	jobs, err := app.store.ScheduledJobs.List(request.Context())
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Scheduled jobs retrieved", jobs); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// updateScheduledJobHandler changes the schedule, the enabled flag or the payload of a job.
+// This instance applies it right away, the others within a minute.
+//
+// @Summary  Update a scheduled job
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    name path string true "Job name"
+// @Param    payload body UpdateScheduledJobPayload true "Request body"
+// @Success  200 {object} Response[models.ScheduledJob]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/scheduled-jobs/{name} [patch]
+func (app *application) updateScheduledJobHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload UpdateScheduledJobPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	job, err := app.store.ScheduledJobs.GetByName(request.Context(), chi.URLParam(request, "name"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, errors.New("scheduled job not found"))
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if payload.CronExpr != nil {
+		if err := cron.ValidateSchedule(*payload.CronExpr); err != nil {
+			app.unprocessableEntityResponse(writer, request, err)
+			return
+		}
+		job.CronExpr = *payload.CronExpr
+	}
+
+	if payload.Enabled != nil {
+		job.Enabled = *payload.Enabled
+	}
+
+	if payload.Payload != nil {
+		job.Payload = payload.Payload
+		if string(payload.Payload) == "null" {
+			job.Payload = nil
+		}
+	}
+
+	if err := app.store.ScheduledJobs.Update(request.Context(), job); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	err = app.scheduler.Configure(cron.JobConfig{
+		Name:     job.Name,
+		Schedule: job.CronExpr,
+		Enabled:  job.Enabled,
+	})
+	if err != nil {
+		// the row is saved, a job removed from the code is just not scheduled anymore
+		app.loggerFor(request).Warnw("could not apply scheduled job", "job", job.Name, "error", err)
+	}
+
+	app.loggerFor(request).Infow("scheduled job updated", "job", job.Name, "cronExpr", job.CronExpr, "enabled", job.Enabled, "userID", getUserFromCtx(request).ID)
+
+	if err := writeJSON(writer, request, http.StatusOK, "Scheduled job updated", job); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const sdkAPIVersion = "v1"
+
+// sdkLanguages maps the public language name to the artifact produced by `make gen-sdk`
+var sdkLanguages = map[string]string{
+	"typescript": "typescript.tar.gz",
+	"go":         "go.tar.gz",
+}
+
+// SDK is a generated client and where to download it
+type SDK struct {
+	Language   string `json:"language"`
+	APIVersion string `json:"api_version"`
+	URL        string `json:"url"`
+}
+
+// @Summary List the generated client SDKs
+// @Tags    sdk
+// @Produce json
+// @Success 200 {object} Response[[]SDK]
+// @Failure 500 {object} ErrorResponse
+// @Router  /sdk [get]
+func (app *application) listSDKsHandler(writer http.ResponseWriter, request *http.Request) {
+	available := []SDK{}
+
+	for language, artifact := range sdkLanguages {
+		if _, err := os.Stat(app.sdkArtifactPath(artifact)); err != nil {
+			continue
+		}
+
+		available = append(available, SDK{
+			Language:   language,
+			APIVersion: sdkAPIVersion,
+			URL:        fmt.Sprintf("%s/%s/sdk/%s", app.config.apiURL, sdkAPIVersion, language),
+		})
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "SDKs retrieved", available); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary Download a generated client SDK
+// @Tags    sdk
+// @Produce application/gzip
+// @Param   language path string true "SDK language"
+// @Success 200 {file} file
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router  /sdk/{language} [get]
+func (app *application) downloadSDKHandler(writer http.ResponseWriter, request *http.Request) {
+	language := chi.URLParam(request, "language")
+
+	artifact, ok := sdkLanguages[language]
+	if !ok {
+		app.notFoundResponse(writer, request, fmt.Errorf("no sdk for language %s", language))
+		return
+	}
+
+	path := app.sdkArtifactPath(artifact)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			app.notFoundResponse(writer, request, fmt.Errorf("sdk for %s has not been generated, run make gen-sdk", language))
+			return
+		}
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	filename := fmt.Sprintf("sandbox-api-%s-%s-%s.tar.gz", sdkAPIVersion, language, version)
+	writer.Header().Set("Content-Type", "application/gzip")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	http.ServeFile(writer, request, path)
+}
+
+func (app *application) sdkArtifactPath(artifact string) string {
+	return filepath.Join(app.config.sdkDir, sdkAPIVersion, artifact)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// csrfHeader carries the value of the CSRF cookie on requests authenticated by cookie
+const csrfHeader = "X-CSRF-Token"
+
+var errCSRFToken = errors.New("missing or invalid CSRF token")
+
+// SecurityHeadersMiddleware sets the headers that keep browsers from sniffing, framing or
+// leaking the API. HSTS is only sent over HTTPS, browsers ignore it on plain http anyway.
+func (app *application) SecurityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		headers := writer.Header()
+		headers.Set("X-Content-Type-Options", "nosniff")
+		headers.Set("X-Frame-Options", app.config.security.frameOptions)
+		headers.Set("Referrer-Policy", app.config.security.referrerPolicy)
+
+		if app.config.security.hstsMaxAge > 0 && isHTTPS(request) {
+			headers.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int(app.config.security.hstsMaxAge.Seconds())))
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// CSRFMiddleware checks the double-submit token of mutating requests that authenticate with
+// the session cookie. Requests with an Authorization header cannot be forged by another site
+// and are left alone.
+func (app *application) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !app.config.auth.cookie.enabled || isSafeMethod(request.Method) || request.Header.Get("Authorization") != "" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		if _, err := request.Cookie(app.config.auth.cookie.name); err != nil {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		cookie, err := request.Cookie(app.config.auth.cookie.csrfName)
+		token := request.Header.Get(csrfHeader)
+		if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+			app.forbiddenResponse(writer, request, errCSRFToken)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// resolve checks the cookie settings at startup. SameSite=None cookies are only kept by
+// browsers when they are Secure.
+func (c *cookieConfig) resolve(environment string) error {
+	if environment == "production" {
+		c.secure = true
+	}
+
+	switch strings.ToLower(c.sameSite) {
+	case "", "lax":
+		c.sameSiteMode = http.SameSiteLaxMode
+	case "strict":
+		c.sameSiteMode = http.SameSiteStrictMode
+	case "none":
+		if !c.secure {
+			return errors.New("AUTH_COOKIE_SAME_SITE=none needs AUTH_COOKIE_SECURE=true")
+		}
+		c.sameSiteMode = http.SameSiteNoneMode
+	default:
+		return fmt.Errorf("invalid AUTH_COOKIE_SAME_SITE %q, use lax, strict or none", c.sameSite)
+	}
+
+	if c.only && !c.enabled {
+		return errors.New("AUTH_COOKIE_ONLY needs AUTH_COOKIE_ENABLED=true")
+	}
+
+	return nil
+}
+
+// Session is the data of the responses that issue a token, with the user when it is
+// new to the client. Token is left out in cookie-only deployments.
+type Session struct {
+	User  *models.User `json:"user,omitempty"`
+	Token string       `json:"token,omitempty"`
+}
+
+func (session Session) view(viewer *models.User) any {
+	return struct {
+		Session
+		User any `json:"user,omitempty"`
+	}{session, serialize(session.User, viewer)}
+}
+
+// withSessionToken hands a freshly issued token to the client. It goes in the session as
+// Token, and in cookie mode also in the session cookie next to a fresh CSRF token the client
+// echoes in X-CSRF-Token. Cookie-only deployments leave it out of the session.
+func (app *application) withSessionToken(writer http.ResponseWriter, user *models.User, token string, session Session) Session {
+	cfg := app.config.auth.cookie
+	if !cfg.enabled {
+		session.Token = token
+		return session
+	}
+
+	maxAge := int(app.tokenExpiry(user).Seconds())
+	http.SetCookie(writer, app.sessionCookie(cfg.name, token, maxAge, true))
+	http.SetCookie(writer, app.sessionCookie(cfg.csrfName, rand.Text(), maxAge, false))
+
+	if !cfg.only {
+		session.Token = token
+	}
+
+	return session
+}
+
+// logoutHandler clears the session cookies, bearer tokens simply stop being sent
+//
+// @Summary Clear the session cookies
+// @Tags    auth
+// @Produce json
+// @Success 200 {object} Response[any]
+// @Failure 500 {object} ErrorResponse
+// @Router  /auth/logout [post]
+func (app *application) logoutHandler(writer http.ResponseWriter, request *http.Request) {
+	if app.config.auth.cookie.enabled {
+		http.SetCookie(writer, app.sessionCookie(app.config.auth.cookie.name, "", -1, true))
+		http.SetCookie(writer, app.sessionCookie(app.config.auth.cookie.csrfName, "", -1, false))
+	}
+
+	if err := writeMessage(writer, request, http.StatusOK, "Logged out"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// sessionCookie builds one of the session cookies, the CSRF one is readable by scripts
+func (app *application) sessionCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	cfg := app.config.auth.cookie
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   cfg.domain,
+		MaxAge:   maxAge,
+		Secure:   cfg.secure,
+		HttpOnly: httpOnly,
+		SameSite: cfg.sameSiteMode,
+	}
+}
+
+func isHTTPS(request *http.Request) bool {
+	return request.TLS != nil || request.Header.Get("X-Forwarded-Proto") == "https"
+}
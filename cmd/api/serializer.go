@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// publicUserView is what any user can see about another user
+type publicUserView struct {
+	ID             int64  `json:"id"`
+	FirstName      string `json:"first_name"`
+	LastName       string `json:"last_name"`
+	Username       string `json:"username"`
+	AvatarURL      string `json:"avatar_url"`
+	CreatedAt      string `json:"created_at"`
+	FollowersCount int64  `json:"followers_count"`
+	FollowingCount int64  `json:"following_count"`
+}
+
+// privateUserView is what other users can see about a user with a private profile
+type privateUserView struct {
+	ID             int64  `json:"id"`
+	Username       string `json:"username"`
+	AvatarURL      string `json:"avatar_url"`
+	PrivateProfile bool   `json:"private_profile"`
+}
+
+// selfUserView is what users can see about themselves
+type selfUserView struct {
+	publicUserView
+	Email          string      `json:"email"`
+	Phone          string      `json:"phone,omitempty"`
+	IsActive       bool        `json:"is_active"`
+	UpdatedAt      string      `json:"updated_at"`
+	Role           models.Role `json:"role"`
+	PrivateProfile bool        `json:"private_profile"`
+}
+
+// adminUserView is what admins can see about any user
+type adminUserView struct {
+	selfUserView
+	NormalizedEmail string     `json:"normalized_email"`
+	RoleID          int64      `json:"role_id"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	CreatedBy       *int64     `json:"created_by,omitempty"`
+	UpdatedBy       *int64     `json:"updated_by,omitempty"`
+}
+
+type postView struct {
+	*models.Post
+	User any `json:"user,omitempty"`
+}
+
+// viewable is implemented by typed response data that holds models, it returns itself
+// with the models replaced by their views
+type viewable interface {
+	view(viewer *models.User) any
+}
+
+// serialize replaces every model in data with the view the viewer is allowed to see.
+// It walks the shapes handlers hand to writeJSON: models, slices of models and viewable
+// data. Nil slices and maps become empty ones, so lists are never null.
+func serialize(data any, viewer *models.User) any {
+	switch value := data.(type) {
+	case viewable:
+		return value.view(viewer)
+	case *models.User:
+		return userView(value, viewer)
+	case []*models.User:
+		views := make([]any, len(value))
+		for i, user := range value {
+			views[i] = userView(user, viewer)
+		}
+		return views
+	case *models.Post:
+		return newPostView(value, viewer)
+	case []*models.Post:
+		views := make([]any, len(value))
+		for i, post := range value {
+			views[i] = newPostView(post, viewer)
+		}
+		return views
+	default:
+		return emptyIfNil(data)
+	}
+}
+
+// orEmpty returns items, or an empty slice when it is nil
+func orEmpty[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// emptyIfNil returns an empty slice or map for a nil one and data otherwise
+func emptyIfNil(data any) any {
+	value := reflect.ValueOf(data)
+
+	switch {
+	case value.Kind() == reflect.Slice && value.IsNil():
+		return reflect.MakeSlice(value.Type(), 0, 0).Interface()
+	case value.Kind() == reflect.Map && value.IsNil():
+		return reflect.MakeMap(value.Type()).Interface()
+	}
+	return data
+}
+
+func userView(user *models.User, viewer *models.User) any {
+	if user == nil {
+		return nil
+	}
+
+	public := publicUserView{
+		ID:             user.ID,
+		FirstName:      user.FirstName,
+		LastName:       user.LastName,
+		Username:       user.Username,
+		AvatarURL:      avatarURL(user),
+		CreatedAt:      user.CreatedAt,
+		FollowersCount: user.FollowersCount,
+		FollowingCount: user.FollowingCount,
+	}
+
+	self := selfUserView{
+		publicUserView: public,
+		Email:          user.Email,
+		Phone:          user.Phone,
+		IsActive:       user.IsActive,
+		UpdatedAt:      user.UpdatedAt,
+		Role:           user.Role,
+		PrivateProfile: user.PrivateProfile,
+	}
+
+	switch {
+	case viewer != nil && viewer.Role.Name == "admin":
+		return adminUserView{
+			selfUserView:    self,
+			NormalizedEmail: user.NormalizedEmail,
+			RoleID:          user.RoleID,
+			DeletedAt:       user.DeletedAt,
+			CreatedBy:       user.CreatedBy,
+			UpdatedBy:       user.UpdatedBy,
+		}
+	case viewer != nil && viewer.ID == user.ID:
+		return self
+	case user.PrivateProfile:
+		return privateUserView{
+			ID:             user.ID,
+			Username:       user.Username,
+			AvatarURL:      public.AvatarURL,
+			PrivateProfile: true,
+		}
+	default:
+		return public
+	}
+}
+
+func newPostView(post *models.Post, viewer *models.User) any {
+	if post == nil {
+		return nil
+	}
+
+	view := postView{Post: post}
+	if post.User != nil {
+		view.User = userView(post.User, viewer)
+	}
+
+	return view
+}
+
+// withViewer marks user as the viewer of the response, for public routes
+// such as login where the user is known before the request is authenticated
+func withViewer(request *http.Request, user *models.User) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), userAuthCtx, user))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"godsendjoseph.dev/sandbox-api/internal/i18n"
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/utils"
+)
+
+var (
+	errUnsupportedLocale = errors.New("locale is not supported")
+	errUnknownOptOut     = errors.New("unknown email opt-out category")
+)
+
+// UpdateSettingsPayload changes the fields that are present, an empty locale follows
+// Accept-Language again, an empty email_opt_outs list turns every email back on and
+// private_profile hides everything but the username and avatar from other users
+type UpdateSettingsPayload struct {
+	Timezone       *string  `json:"timezone" validate:"omitempty,max=64,timezone"`
+	Locale         *string  `json:"locale" validate:"omitempty,max=10"`
+	Theme          *string  `json:"theme" validate:"omitempty,oneof=system light dark"`
+	EmailOptOuts   []string `json:"email_opt_outs" validate:"omitempty,max=10,dive,max=50"`
+	PrivateProfile *bool    `json:"private_profile"`
+}
+
+// SettingsWithOptions is the settings of a user with the values they can be set to
+type SettingsWithOptions struct {
+	Settings         *models.UserSettings `json:"settings"`
+	Locales          []string             `json:"locales"`
+	OptOutCategories []string             `json:"opt_out_categories"`
+}
+
+// @Summary  Get the settings of the current user
+// @Tags     settings
+// @Produce  json
+// @Success  200 {object} Response[SettingsWithOptions]
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/settings [get]
+func (app *application) getSettingsHandler(writer http.ResponseWriter, request *http.Request) {
+	settings, err := app.store.Settings.Get(request.Context(), getUserFromCtx(request).ID)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	data := SettingsWithOptions{
+		Settings:         settings,
+		Locales:          i18n.Locales(),
+		OptOutCategories: mailer.OptOutCategories,
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Settings retrieved", data); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Update the settings of the current user
+// @Tags     settings
+// @Accept   json
+// @Produce  json
+// @Param    payload body UpdateSettingsPayload true "Request body"
+// @Success  200 {object} Response[models.UserSettings]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/settings [patch]
+func (app *application) updateSettingsHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload UpdateSettingsPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	if payload.Locale != nil && *payload.Locale != "" && !slices.Contains(i18n.Locales(), *payload.Locale) {
+		app.unprocessableEntityResponse(writer, request, errUnsupportedLocale)
+		return
+	}
+
+	for _, category := range payload.EmailOptOuts {
+		if !slices.Contains(mailer.OptOutCategories, category) {
+			app.unprocessableEntityResponse(writer, request, errUnknownOptOut)
+			return
+		}
+	}
+
+	ctx := request.Context()
+	userID := getUserFromCtx(request).ID
+
+	settings, err := app.store.Settings.Get(ctx, userID)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if payload.Timezone != nil {
+		settings.Timezone = *payload.Timezone
+	}
+	if payload.Locale != nil {
+		settings.Locale = *payload.Locale
+	}
+	if payload.Theme != nil {
+		settings.Theme = *payload.Theme
+	}
+	if payload.EmailOptOuts != nil {
+		slices.Sort(payload.EmailOptOuts)
+		settings.EmailOptOuts = utils.StringSlice(slices.Compact(payload.EmailOptOuts))
+	}
+	if payload.PrivateProfile != nil {
+		settings.PrivateProfile = *payload.PrivateProfile
+	}
+
+	if err := app.store.Settings.Save(ctx, settings); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	// the cached user carries private_profile, drop it so other users see the change
+	if payload.PrivateProfile != nil {
+		app.evictCachedUser(request, userID)
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Settings updated", settings); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"godsendjoseph.dev/sandbox-api/internal/notification"
+)
+
+const (
+	// sloWindow is how far back compliance is computed, one bucket per minute
+	sloWindow = time.Hour
+	// sloShortWindow must burn as fast as the long window before alerting, so an
+	// incident that is already over does not page anyone
+	sloShortWindow = 5 * time.Minute
+	// sloAlertCooldown keeps a burning group from alerting every minute
+	sloAlertCooldown = 15 * time.Minute
+)
+
+// sloObjective is met by a request that answers below 500 within latency.
+// Target is the share of requests that must meet it, e.g. 0.995.
+type sloObjective struct {
+	Group    string
+	Prefixes []string
+	Latency  time.Duration
+	Target   float64
+}
+
+// parseSLOObjectives reads objectives from a spec such as
+//
+//	auth:/v1/auth:500ms:99.9;user:/v1/user,/v1/users:500ms:99.5
+//
+// Each rule is group:prefixes:latency:target%, prefixes are separated by commas.
+func parseSLOObjectives(spec string) ([]sloObjective, error) {
+	var objectives []sloObjective
+
+	for _, rule := range strings.Split(spec, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		parts := strings.Split(rule, ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid SLO %q: expected group:prefixes:latency:target", rule)
+		}
+
+		latency, err := time.ParseDuration(parts[2])
+		if err != nil || latency <= 0 {
+			return nil, fmt.Errorf("invalid SLO %q: bad latency %q", rule, parts[2])
+		}
+
+		target, err := strconv.ParseFloat(strings.TrimSuffix(parts[3], "%"), 64)
+		if err != nil || target <= 0 || target >= 100 {
+			return nil, fmt.Errorf("invalid SLO %q: target must be a percentage between 0 and 100", rule)
+		}
+
+		objectives = append(objectives, sloObjective{
+			Group:    parts[0],
+			Prefixes: strings.Split(parts[1], ","),
+			Latency:  latency,
+			Target:   target / 100,
+		})
+	}
+
+	return objectives, nil
+}
+
+type sloBucket struct {
+	minute int64
+	total  int
+	errors int
+	slow   int
+}
+
+type sloGroup struct {
+	objective sloObjective
+	buckets   [int(sloWindow / time.Minute)]sloBucket
+	alertedAt time.Time
+}
+
+// sloTracker keeps per minute counts of this instance for every objective
+type sloTracker struct {
+	sync.Mutex
+	groups []*sloGroup
+	// burnRateAlert is the burn rate above which both windows have to be to alert
+	burnRateAlert float64
+}
+
+func newSLOTracker(objectives []sloObjective, burnRateAlert float64) *sloTracker {
+	tracker := &sloTracker{burnRateAlert: burnRateAlert}
+	for _, objective := range objectives {
+		tracker.groups = append(tracker.groups, &sloGroup{objective: objective})
+	}
+	return tracker
+}
+
+// groupFor returns the objective with the longest prefix matching path
+func (tracker *sloTracker) groupFor(path string) *sloGroup {
+	var match *sloGroup
+	longest := 0
+
+	for _, group := range tracker.groups {
+		for _, prefix := range group.objective.Prefixes {
+			if len(prefix) > longest && strings.HasPrefix(path, prefix) {
+				match = group
+				longest = len(prefix)
+			}
+		}
+	}
+
+	return match
+}
+
+func (tracker *sloTracker) record(path string, status int, duration time.Duration, at time.Time) {
+	group := tracker.groupFor(path)
+	if group == nil {
+		return
+	}
+
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	minute := at.Unix() / 60
+	bucket := &group.buckets[minute%int64(len(group.buckets))]
+	if bucket.minute != minute {
+		*bucket = sloBucket{minute: minute}
+	}
+
+	bucket.total++
+	if status >= http.StatusInternalServerError {
+		bucket.errors++
+	} else if duration > group.objective.Latency {
+		bucket.slow++
+	}
+}
+
+type sloStatus struct {
+	Group              string  `json:"group"`
+	LatencyTargetMs    int64   `json:"latency_target_ms"`
+	Target             float64 `json:"target"`
+	Requests           int     `json:"requests"`
+	Errors             int     `json:"errors"`
+	Slow               int     `json:"slow"`
+	Compliance         float64 `json:"compliance"`
+	BurnRate           float64 `json:"burn_rate"`
+	ShortBurnRate      float64 `json:"short_burn_rate"`
+	BudgetRemaining    float64 `json:"budget_remaining"`
+	WindowMinutes      int     `json:"window_minutes"`
+	ShortWindowMinutes int     `json:"short_window_minutes"`
+	BurnRateAlertsAt   float64 `json:"burn_rate_alerts_at"`
+}
+
+// burnRate is how many times faster than allowed the error budget is being spent
+func burnRate(total, bad int, target float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return (float64(bad) / float64(total)) / (1 - target)
+}
+
+func (tracker *sloTracker) statuses(now time.Time) []sloStatus {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	current := now.Unix() / 60
+	statuses := make([]sloStatus, 0, len(tracker.groups))
+
+	for _, group := range tracker.groups {
+		status := sloStatus{
+			Group:              group.objective.Group,
+			LatencyTargetMs:    group.objective.Latency.Milliseconds(),
+			Target:             group.objective.Target,
+			Compliance:         1,
+			BudgetRemaining:    1,
+			WindowMinutes:      int(sloWindow / time.Minute),
+			ShortWindowMinutes: int(sloShortWindow / time.Minute),
+			BurnRateAlertsAt:   tracker.burnRateAlert,
+		}
+
+		shortTotal, shortBad := 0, 0
+		for _, bucket := range group.buckets {
+			age := current - bucket.minute
+			if bucket.total == 0 || age < 0 || age >= int64(status.WindowMinutes) {
+				continue
+			}
+
+			status.Requests += bucket.total
+			status.Errors += bucket.errors
+			status.Slow += bucket.slow
+
+			if age < int64(status.ShortWindowMinutes) {
+				shortTotal += bucket.total
+				shortBad += bucket.errors + bucket.slow
+			}
+		}
+
+		if status.Requests > 0 {
+			bad := status.Errors + status.Slow
+			status.Compliance = 1 - float64(bad)/float64(status.Requests)
+			status.BurnRate = burnRate(status.Requests, bad, status.Target)
+			status.BudgetRemaining = 1 - status.BurnRate
+		}
+		status.ShortBurnRate = burnRate(shortTotal, shortBad, status.Target)
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Group < statuses[j].Group })
+	return statuses
+}
+
+// shouldAlert marks the group as alerted when it is burning too fast in both windows
+func (tracker *sloTracker) shouldAlert(status sloStatus, now time.Time) bool {
+	if tracker.burnRateAlert <= 0 || status.BurnRate < tracker.burnRateAlert || status.ShortBurnRate < tracker.burnRateAlert {
+		return false
+	}
+
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	for _, group := range tracker.groups {
+		if group.objective.Group != status.Group {
+			continue
+		}
+		if now.Sub(group.alertedAt) < sloAlertCooldown {
+			return false
+		}
+		group.alertedAt = now
+		return true
+	}
+
+	return false
+}
+
+// MetricsMiddleware times every request and feeds the SLO tracker
+func (app *application) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if isStreamPath(request.URL.Path) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		start := time.Now()
+		wrapped := middleware.NewWrapResponseWriter(writer, request.ProtoMajor)
+
+		next.ServeHTTP(wrapped, request)
+
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		app.slo.record(canonicalPath(request.URL.Path), status, time.Since(start), start)
+	})
+}
+
+// checkSLOBurnRates runs every minute and alerts on groups spending their error budget too fast
+func (app *application) checkSLOBurnRates() {
+	now := time.Now()
+
+	for _, status := range app.slo.statuses(now) {
+		if !app.slo.shouldAlert(status, now) {
+			continue
+		}
+
+		app.logger.Warnw("SLO burn rate exceeded", "group", status.Group, "burnRate", status.BurnRate, "shortBurnRate", status.ShortBurnRate)
+
+		err := app.notifier.SendCategoryNotification(
+			notification.CategoryInfrastructure,
+			notification.SeverityError,
+			fmt.Sprintf("SLO burn rate alert: %s", status.Group),
+			fmt.Sprintf("The %s routes are spending their error budget %.1fx faster than allowed", status.Group, status.BurnRate),
+			"danger",
+			map[string]string{
+				"Compliance":     fmt.Sprintf("%.3f%%", status.Compliance*100),
+				"Target":         fmt.Sprintf("%.3f%%", status.Target*100),
+				"Burn Rate (1h)": fmt.Sprintf("%.1f", status.BurnRate),
+				"Burn Rate (5m)": fmt.Sprintf("%.1f", status.ShortBurnRate),
+				"Errors":         strconv.Itoa(status.Errors),
+				"Slow":           strconv.Itoa(status.Slow),
+				"Requests":       strconv.Itoa(status.Requests),
+			},
+		)
+		if err != nil {
+			app.logger.Errorw("failed to send SLO alert", "group", status.Group, "error", err)
+		}
+	}
+}
+
+// @Summary  Report the service level objectives
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[[]sloStatus]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/slo [get]
+func (app *application) getSLOHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := writeJSON(writer, request, http.StatusOK, "SLO status retrieved", app.slo.statuses(time.Now())); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
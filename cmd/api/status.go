@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// statusHistory is how far back the status page looks
+const statusHistory = 7 * 24 * time.Hour
+
+const (
+	componentUp   = "up"
+	componentDown = "down"
+)
+
+// statusTransition is a component changing state, the history is made of these only
+type statusTransition struct {
+	Status string
+	At     time.Time
+}
+
+type statusIncident struct {
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+type componentStatus struct {
+	Name      string           `json:"name"`
+	Status    string           `json:"status"`
+	Since     time.Time        `json:"since"`
+	Uptime24h float64          `json:"uptime_24h"`
+	Uptime7d  float64          `json:"uptime_7d"`
+	Incidents []statusIncident `json:"incidents"`
+}
+
+type statusReport struct {
+	Status     string            `json:"status"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	Components []componentStatus `json:"components"`
+}
+
+// statusMonitor keeps the state transitions of each component over statusHistory.
+// Probe results never leave the process, the report only says up or down.
+type statusMonitor struct {
+	mutex       sync.Mutex
+	started     time.Time
+	checkedAt   time.Time
+	transitions map[string][]statusTransition
+}
+
+func newStatusMonitor() *statusMonitor {
+	return &statusMonitor{
+		started:     time.Now(),
+		transitions: make(map[string][]statusTransition),
+	}
+}
+
+// record stores status when it differs from the component's current one
+func (monitor *statusMonitor) record(component, status string, now time.Time) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.checkedAt = now
+
+	history := monitor.transitions[component]
+	if len(history) > 0 && history[len(history)-1].Status == status {
+		return
+	}
+	history = append(history, statusTransition{Status: status, At: now})
+
+	// keep the last transition before the window, it is the state the window starts in
+	cutoff := now.Add(-statusHistory)
+	for len(history) > 1 && !history[1].At.After(cutoff) {
+		history = history[1:]
+	}
+
+	monitor.transitions[component] = history
+}
+
+func (monitor *statusMonitor) report(now time.Time) statusReport {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	report := statusReport{Status: "operational", UpdatedAt: monitor.checkedAt, Components: []componentStatus{}}
+
+	for name, history := range monitor.transitions {
+		current := history[len(history)-1]
+		component := componentStatus{
+			Name:      name,
+			Status:    current.Status,
+			Since:     current.At,
+			Uptime24h: monitor.uptime(history, now.Add(-24*time.Hour), now),
+			Uptime7d:  monitor.uptime(history, now.Add(-statusHistory), now),
+			Incidents: incidents(history, now.Add(-statusHistory)),
+		}
+
+		if current.Status != componentUp {
+			report.Status = "degraded"
+		}
+		report.Components = append(report.Components, component)
+	}
+
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i].Name < report.Components[j].Name
+	})
+
+	return report
+}
+
+// uptime is the share of [from, to] spent up, counting only time the monitor was running
+func (monitor *statusMonitor) uptime(history []statusTransition, from, to time.Time) float64 {
+	if from.Before(monitor.started) {
+		from = monitor.started
+	}
+
+	var up, total time.Duration
+	for i, transition := range history {
+		start := transition.At
+		end := to
+		if i+1 < len(history) {
+			end = history[i+1].At
+		}
+
+		if start.Before(from) {
+			start = from
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		total += end.Sub(start)
+		if transition.Status == componentUp {
+			up += end.Sub(start)
+		}
+	}
+
+	if total == 0 {
+		return 100
+	}
+	return float64(up) * 100 / float64(total)
+}
+
+// incidents lists the down periods that overlap the window, newest first
+func incidents(history []statusTransition, from time.Time) []statusIncident {
+	list := []statusIncident{}
+
+	for i, transition := range history {
+		if transition.Status != componentDown {
+			continue
+		}
+
+		incident := statusIncident{StartedAt: transition.At}
+		if i+1 < len(history) {
+			endedAt := history[i+1].At
+			if endedAt.Before(from) {
+				continue
+			}
+			incident.EndedAt = &endedAt
+		}
+		list = append(list, incident)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+
+	return list
+}
+
+// statusProbes are the components shown on the status page, the readiness probes plus mail
+func (app *application) statusProbes() map[string]func(ctx context.Context) error {
+	probes := map[string]func(ctx context.Context) error{
+		"api": func(ctx context.Context) error { return nil },
+	}
+	for name, probe := range app.dependencyProbes() {
+		probes[name] = probe
+	}
+	if app.mailProvider != nil {
+		probes["mail"] = func(ctx context.Context) error {
+			return app.mailProvider.Ping()
+		}
+	}
+	return probes
+}
+
+// checkStatus runs every minute and records the components that changed state
+func (app *application) checkStatus() {
+	results := probeAll(context.Background(), app.statusProbes())
+	now := time.Now()
+
+	for name, status := range results {
+		if status.Status != componentUp {
+			app.logger.Warnw("status check failed", "component", name, "error", status.Error)
+		}
+		app.status.record(name, status.Status, now)
+	}
+}
+
+// getStatusHandler is public, it reports up or down per component and never the probe errors
+//
+// @Summary Report up or down per component
+// @Tags    health
+// @Produce json
+// @Success 200 {object} Response[statusReport]
+// @Failure 500 {object} ErrorResponse
+// @Router  /status [get]
+func (app *application) getStatusHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Cache-Control", "public, max-age=30")
+
+	if err := writeJSON(writer, request, http.StatusOK, "Status retrieved", app.status.report(time.Now())); err != nil {
+		app.internalServerError(writer, request, err)
+	}
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>API Status</title>
+<style>
+body { font-family: sans-serif; max-width: 40rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+table { width: 100%; border-collapse: collapse; }
+td, th { text-align: left; padding: .4rem; border-bottom: 1px solid #ddd; }
+.up { color: #1a7f37; } .down, .degraded { color: #cf222e; } .operational { color: #1a7f37; }
+</style>
+</head>
+<body>
+<h1>API Status: <span class="{{.Status}}">{{.Status}}</span></h1>
+<table>
+<tr><th>Component</th><th>Status</th><th>24h</th><th>7d</th></tr>
+{{range .Components}}<tr><td>{{.Name}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{printf "%.2f" .Uptime24h}}%</td><td>{{printf "%.2f" .Uptime7d}}%</td></tr>
+{{end}}</table>
+{{range .Components}}{{$name := .Name}}{{range .Incidents}}<p>{{$name}} down from {{time .StartedAt}}{{with .EndedAt}} to {{time .}}{{else}}, ongoing{{end}}</p>
+{{end}}{{end}}<p><small>Last checked {{time .UpdatedAt}}</small></p>
+</body>
+</html>
+`))
+
+// getStatusPageHandler renders the status report as a minimal HTML page
+//
+// @Summary Render the status report as HTML
+// @Tags    health
+// @Produce html
+// @Success 200 {string} string
+// @Router  /status/page [get]
+func (app *application) getStatusPageHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "public, max-age=30")
+
+	if err := statusPageTemplate.Execute(writer, app.status.report(time.Now())); err != nil {
+		app.logger.Errorw("failed to render status page", "error", err)
+	}
+}
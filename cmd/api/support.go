@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"godsendjoseph.dev/sandbox-api/internal/notification"
+	"godsendjoseph.dev/sandbox-api/internal/supportref"
+)
+
+// supportRefHeader carries the code users quote to support when a request fails
+const supportRefHeader = "X-Support-Ref"
+
+// supportEventLimit bounds how many failed requests an instance without Redis keeps
+const supportEventLimit = 10_000
+
+// supportRef shortens a request ID into a code that is easy to read out over chat or email
+func supportRef(requestID string) string {
+	sum := sha256.Sum256([]byte(requestID))
+	return strings.ToUpper(hex.EncodeToString(sum[:4]))
+}
+
+// SupportRefMiddleware has to run after middleware.RequestID
+func (app *application) SupportRefMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ref := supportRef(middleware.GetReqID(request.Context()))
+
+		writer.Header().Set(supportRefHeader, ref)
+		ctx := notification.ContextWithSupportRef(request.Context(), ref)
+
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// trackError remembers a failed request under its support reference. Older ones are
+// still in the logs under the same support_ref.
+func (app *application) trackError(request *http.Request, status int, err error) {
+	event := supportref.Event{
+		Ref:        notification.SupportRefFromContext(request.Context()),
+		RequestID:  middleware.GetReqID(request.Context()),
+		Method:     request.Method,
+		Path:       request.URL.Path,
+		Status:     status,
+		OccurredAt: time.Now().UTC(),
+	}
+	if event.Ref == "" {
+		return
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	if user := getUserFromCtx(request); user != nil {
+		event.UserID = user.ID
+	}
+
+	// the request may have failed because it was cancelled
+	if err := app.supportEvents.Record(context.WithoutCancel(request.Context()), event); err != nil {
+		app.loggerFor(request).Warnw("error recording support event", "support_ref", event.Ref, "error", err)
+	}
+}
+
+// @Summary  Look up the error behind a support reference
+// @Tags     admin
+// @Produce  json
+// @Param    ref path string true "Support reference"
+// @Success  200 {object} Response[supportref.Event]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/support/{ref} [get]
+func (app *application) getSupportEventHandler(writer http.ResponseWriter, request *http.Request) {
+	ref := chi.URLParam(request, "ref")
+
+	event, found, err := app.supportEvents.Get(request.Context(), ref)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+	if !found {
+		app.notFoundResponse(writer, request, errors.New("support reference not found"))
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Support event retrieved", event); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
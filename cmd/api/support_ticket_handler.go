@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/events"
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/notification"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+type ContactPayload struct {
+	// Name and Email are taken from the account when the request is authenticated
+	Name         string `json:"name" validate:"omitempty,max=100"`
+	Email        string `json:"email" validate:"omitempty,email,max=255"`
+	Subject      string `json:"subject" validate:"required,max=200"`
+	Message      string `json:"message" validate:"required,max=5000"`
+	CaptchaToken string `json:"captcha_token" validate:"max=4096"`
+}
+
+// SupportTicketReceipt is the ticket a request was filed as, with its status once answered
+type SupportTicketReceipt struct {
+	TicketID int64  `json:"ticket_id"`
+	Status   string `json:"status,omitempty"`
+}
+
+type RespondTicketPayload struct {
+	Message string `json:"message" validate:"required,max=10000"`
+	// Close marks the ticket closed instead of answered
+	Close bool `json:"close"`
+}
+
+// contactHandler opens a support ticket. Anonymous requests need a name, an email and,
+// when a provider is configured, a solved CAPTCHA. Everyone is limited per hour.
+//
+// @Summary Open a support ticket
+// @Tags    support
+// @Accept  json
+// @Produce json
+// @Param   payload body ContactPayload true "Request body"
+// @Success 201 {object} Response[SupportTicketReceipt]
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router  /support/contact [post]
+func (app *application) contactHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload ContactPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := request.Context()
+	user := app.optionalUser(request)
+
+	host := clientIP(request)
+
+	ticket := &models.SupportTicket{
+		Name:    payload.Name,
+		Email:   payload.Email,
+		Subject: payload.Subject,
+		Message: payload.Message,
+	}
+
+	limitKey := "ip:" + host
+	if user != nil {
+		limitKey = fmt.Sprintf("user:%d", user.ID)
+		ticket.UserID = &user.ID
+		ticket.Email = user.Email
+		if ticket.Name == "" {
+			ticket.Name = user.Username
+		}
+	} else if ticket.Name == "" || ticket.Email == "" {
+		app.unprocessableEntityResponse(writer, request, errors.New("name and email are required when not logged in"))
+		return
+	}
+
+	if allow, retryAfter := app.contactLimiter.Allow(limitKey); !allow {
+		app.loggerFor(request).Warnw("support request throttled", "key", limitKey)
+		app.rateLimitExceededResponse(writer, request, retryAfter.String())
+		return
+	}
+
+	if user == nil && !app.checkCaptcha(writer, request, payload.CaptchaToken) {
+		return
+	}
+
+	if err := app.store.SupportTickets.Create(ctx, ticket); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.publishEvent(ctx, events.SupportTicketOpened{
+		TicketID: ticket.ID,
+		Name:     ticket.Name,
+		Email:    ticket.Email,
+		Subject:  ticket.Subject,
+		Message:  ticket.Message,
+	})
+
+	if err := writeJSON(writer, request, http.StatusCreated, "Support request received", SupportTicketReceipt{TicketID: ticket.ID}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// forwardSupportTicket posts the ticket to the support Slack route and mails SUPPORT_EMAIL
+func (app *application) forwardSupportTicket(_ context.Context, ticket events.SupportTicketOpened) error {
+	err := app.notifier.SendCategoryNotification(
+		notification.CategorySupport,
+		notification.SeverityInfo,
+		fmt.Sprintf("📨 Support ticket #%d: %s", ticket.TicketID, ticket.Subject),
+		ticket.Message,
+		"#3AA3E3",
+		map[string]string{
+			"From":  fmt.Sprintf("%s <%s>", ticket.Name, ticket.Email),
+			"Reply": fmt.Sprintf("POST /v1/admin/support/tickets/%d/respond", ticket.TicketID),
+		},
+	)
+	if err != nil {
+		app.logger.Errorw("error forwarding support ticket to slack", "ticketID", ticket.TicketID, "error", err)
+	}
+
+	if app.config.support.email == "" {
+		return nil
+	}
+
+	subject := fmt.Sprintf("[Support #%d] %s", ticket.TicketID, ticket.Subject)
+	vars := struct {
+		TicketID int64
+		Name     string
+		Email    string
+		Subject  string
+		Message  string
+	}{
+		TicketID: ticket.TicketID,
+		Name:     ticket.Name,
+		Email:    ticket.Email,
+		Subject:  ticket.Subject,
+		Message:  ticket.Message,
+	}
+
+	return app.mailer.SendWithOptions(
+		mailer.SupportTicketTemplate,
+		"Support",
+		app.config.support.email,
+		subject,
+		vars,
+		mailer.AsyncInMemory,
+		app.config.env != "production",
+	)
+}
+
+// optionalUser returns the user of a valid bearer token, or nil for anonymous requests
+func (app *application) optionalUser(request *http.Request) *models.User {
+	subject, ok := app.tokenSubject(request)
+	if !ok {
+		return nil
+	}
+
+	userID, err := strconv.ParseInt(subject, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	user, err := app.getUser(request.Context(), userID)
+	if err != nil {
+		return nil
+	}
+
+	return user
+}
+
+// listSupportTicketsHandler pages through the tickets, filtered by status
+//
+// @Summary  List support tickets
+// @Tags     admin
+// @Produce  json
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Param    sort query string false "created_at for oldest first, -created_at (default) for newest first"
+// @Param    status query string false "Ticket status"
+// @Success  200 {object} Response[List[models.SupportTicket]]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/support/tickets [get]
+func (app *application) listSupportTicketsHandler(writer http.ResponseWriter, request *http.Request) {
+	params, offset, err := parseOffsetPage(request, createdAtPage(50))
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.SupportTicketQuery{
+		Limit:  params.Limit,
+		Offset: offset,
+		Sort:   params.Sort.Direction(),
+	}
+
+	query, err = query.Parse(request)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	tickets, err := app.store.SupportTickets.List(request.Context(), query)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	page := pagination.OffsetPage(query.Limit, query.Offset, len(tickets))
+
+	if err := writeList(writer, request, "Support tickets retrieved", tickets, page); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Get a support ticket
+// @Tags     admin
+// @Produce  json
+// @Param    ticketID path int true "Ticket ID"
+// @Success  200 {object} Response[models.SupportTicket]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/support/tickets/{ticketID} [get]
+func (app *application) getSupportTicketHandler(writer http.ResponseWriter, request *http.Request) {
+	ticket, ok := app.loadSupportTicket(writer, request)
+	if !ok {
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Support ticket retrieved", ticket); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// respondSupportTicketHandler stores the answer and emails it to whoever opened the ticket
+//
+// @Summary  Answer a support ticket
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    ticketID path int true "Ticket ID"
+// @Param    payload body RespondTicketPayload true "Request body"
+// @Success  200 {object} Response[SupportTicketReceipt]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/support/tickets/{ticketID}/respond [post]
+func (app *application) respondSupportTicketHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload RespondTicketPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ticket, ok := app.loadSupportTicket(writer, request)
+	if !ok {
+		return
+	}
+
+	status := models.TicketAnswered
+	if payload.Close {
+		status = models.TicketClosed
+	}
+
+	admin := getUserFromCtx(request)
+
+	if err := app.store.SupportTickets.Respond(request.Context(), ticket.ID, admin.ID, payload.Message, status); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.publishEvent(request.Context(), events.SupportTicketAnswered{
+		TicketID: ticket.ID,
+		UserID:   ticket.UserID,
+		Name:     ticket.Name,
+		Email:    ticket.Email,
+		Subject:  ticket.Subject,
+		Message:  ticket.Message,
+		Response: payload.Message,
+		Status:   status,
+	})
+
+	if err := writeJSON(writer, request, http.StatusOK, "Response sent", SupportTicketReceipt{TicketID: ticket.ID, Status: status}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// mailSupportResponse emails the answer of an admin to whoever opened the ticket
+func (app *application) mailSupportResponse(_ context.Context, answer events.SupportTicketAnswered) error {
+	subject := fmt.Sprintf("Re: %s [#%d]", answer.Subject, answer.TicketID)
+	vars := struct {
+		TicketID int64
+		Username string
+		Subject  string
+		Response string
+		Message  string
+	}{
+		TicketID: answer.TicketID,
+		Username: answer.Name,
+		Subject:  subject,
+		Response: answer.Response,
+		Message:  answer.Message,
+	}
+
+	return app.mailer.SendWithOptions(
+		mailer.SupportResponseTemplate,
+		answer.Name,
+		answer.Email,
+		subject,
+		vars,
+		mailer.AsyncInMemory,
+		app.config.env != "production",
+	)
+}
+
+func (app *application) loadSupportTicket(writer http.ResponseWriter, request *http.Request) (*models.SupportTicket, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(request, "ticketID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return nil, false
+	}
+
+	ticket, err := app.store.SupportTickets.GetByID(request.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return nil, false
+	}
+
+	return ticket, true
+}
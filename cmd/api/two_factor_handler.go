@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/auth"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+// backupCodeCount is how many backup codes a user gets when two-factor is confirmed
+const backupCodeCount = 10
+
+var (
+	errTwoFactorRequired   = errors.New("two-factor code required")
+	errInvalidTwoFactor    = errors.New("invalid two-factor code")
+	errTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	errTwoFactorNotStarted = errors.New("call /v1/user/2fa/enable first")
+	errTwoFactorLocked     = errors.New("too many wrong two-factor codes, try again later")
+)
+
+type EnableTwoFactorPayload struct {
+	Password string `json:"password" validate:"required,max=100"`
+}
+
+type ConfirmTwoFactorPayload struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type DisableTwoFactorPayload struct {
+	Password string `json:"password" validate:"required,max=100"`
+	// Code is a TOTP code or an unused backup code
+	Code string `json:"code" validate:"required,max=20"`
+}
+
+// TwoFactorEnrollment is the secret to add to an authenticator app, as text and as a
+// URI for QR codes
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// TwoFactorBackupCodes are the one-time codes that stand in for a lost authenticator
+type TwoFactorBackupCodes struct {
+	BackupCodes []string `json:"backup_codes"`
+}
+
+// enableTwoFactorHandler starts an enrollment and returns the secret to scan. Two-factor
+// only applies to logins once a first code is confirmed with confirmTwoFactorHandler.
+//
+// @Summary  Start a two-factor enrollment
+// @Tags     two-factor
+// @Accept   json
+// @Produce  json
+// @Param    payload body EnableTwoFactorPayload true "Request body"
+// @Success  200 {object} Response[TwoFactorEnrollment]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  409 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/2fa/enable [post]
+func (app *application) enableTwoFactorHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload EnableTwoFactorPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := request.Context()
+
+	// the user in the context is loaded without the password hash
+	user, err := app.store.Users.GetByEmail(ctx, getUserFromCtx(request).Email, true)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		app.unauthorizedPwdErrorResponse(writer, request, err)
+		return
+	}
+
+	if user.TwoFactorEnabled() {
+		app.conflictResponse(writer, request, errTwoFactorEnabled)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := app.store.Users.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	enrollment := TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURL: auth.TOTPURI(app.config.auth.token.issuer, user.Email, secret),
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Scan the secret and confirm a code to finish", enrollment); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// confirmTwoFactorHandler turns two-factor on and returns the backup codes, the only
+// time they are shown
+//
+// @Summary  Confirm a code and turn two-factor on
+// @Tags     two-factor
+// @Accept   json
+// @Produce  json
+// @Param    payload body ConfirmTwoFactorPayload true "Request body"
+// @Success  200 {object} Response[TwoFactorBackupCodes]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  409 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/2fa/confirm [post]
+func (app *application) confirmTwoFactorHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload ConfirmTwoFactorPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := request.Context()
+
+	// the secret was stored by the enable call just before, read it from the primary
+	user, err := app.store.Users.GetByEmail(store.ContextWithPrimary(ctx), getUserFromCtx(request).Email, true)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if user.TwoFactorEnabled() {
+		app.conflictResponse(writer, request, errTwoFactorEnabled)
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		app.unprocessableEntityResponse(writer, request, errTwoFactorNotStarted)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, payload.Code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		app.unauthorizedErrorResponse(writer, request, errInvalidTwoFactor)
+		return
+	}
+
+	// the confirmed code cannot be used again to log in
+	if err := app.store.Users.UseTOTPStep(ctx, user.ID, step); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedErrorResponse(writer, request, errInvalidTwoFactor)
+			return
+		}
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	backupCodes, err := generateBackupCodes(backupCodeCount)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := app.store.Users.EnableTwoFactor(ctx, user.ID, backupCodes); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.evictCachedUser(request, user.ID)
+
+	if err := writeJSON(writer, request, http.StatusOK, "Two-factor authentication enabled", TwoFactorBackupCodes{BackupCodes: backupCodes}); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Turn two-factor off
+// @Tags     two-factor
+// @Accept   json
+// @Produce  json
+// @Param    payload body DisableTwoFactorPayload true "Request body"
+// @Success  200 {object} Response[any]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/2fa/disable [post]
+func (app *application) disableTwoFactorHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload DisableTwoFactorPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := request.Context()
+
+	user, err := app.store.Users.GetByEmail(ctx, getUserFromCtx(request).Email, true)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		app.unauthorizedPwdErrorResponse(writer, request, err)
+		return
+	}
+
+	if !user.TwoFactorEnabled() {
+		app.unprocessableEntityResponse(writer, request, errTwoFactorNotEnabled)
+		return
+	}
+
+	if !app.checkSecondFactor(writer, request, user, payload.Code) {
+		return
+	}
+
+	if err := app.store.Users.DisableTwoFactor(ctx, user.ID); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.evictCachedUser(request, user.ID)
+
+	if err := writeMessage(writer, request, http.StatusOK, "Two-factor authentication disabled"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// checkSecondFactor answers 401 unless code is a TOTP code of user newer than the last one
+// accepted, or an unused backup code. Either is used up by a successful check. After
+// models.MaxTwoFactorAttempts wrong codes in a row every code is refused for a while.
+func (app *application) checkSecondFactor(writer http.ResponseWriter, request *http.Request, user *models.User, code string) bool {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		app.unauthorizedErrorResponse(writer, request, errTwoFactorRequired)
+		return false
+	}
+
+	ctx := request.Context()
+	now := time.Now()
+
+	if user.TwoFactorLocked(now) {
+		retryAfter := int(math.Ceil(user.TwoFactorLockedUntil.Sub(now).Seconds()))
+		writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		app.unauthorizedErrorResponse(writer, request, errTwoFactorLocked)
+		return false
+	}
+
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, now, user.TOTPLastStep); ok {
+		// a concurrent request may have used the same code since the user was loaded
+		err := app.store.Users.UseTOTPStep(ctx, user.ID, step)
+		switch {
+		case err == nil:
+			return true
+		case !errors.Is(err, store.ErrNotFound):
+			app.internalServerError(writer, request, err)
+			return false
+		}
+	} else {
+		err := app.store.Users.UseBackupCode(ctx, user.ID, code)
+		switch {
+		case err == nil:
+			app.loggerFor(request).Infow("two-factor backup code used", "userID", user.ID)
+			return true
+		case !errors.Is(err, store.ErrNotFound):
+			app.internalServerError(writer, request, err)
+			return false
+		}
+	}
+
+	if err := app.store.Users.RecordTwoFactorFailure(ctx, user.ID); err != nil {
+		app.loggerFor(request).Errorw("error recording failed two-factor attempt", "userID", user.ID, "error", err)
+	}
+	app.unauthorizedErrorResponse(writer, request, errInvalidTwoFactor)
+	return false
+}
+
+// evictCachedUser drops the cached copy after a change the cached user shows
+func (app *application) evictCachedUser(request *http.Request, userID int64) {
+	if err := app.cacheStorage.Users.Delete(request.Context(), userID); err != nil {
+		app.loggerFor(request).Warnw("error evicting user from cache", "userID", userID, "error", err)
+	}
+}
+
+// generateBackupCodes returns codes like "k3v9q-2mfxa", 50 random bits each
+func generateBackupCodes(count int) ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, count)
+
+	for i := range codes {
+		random := make([]byte, 7)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(random))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
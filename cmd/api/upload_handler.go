@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/storage"
+)
+
+const (
+	// presignedUploadExpiry is how long a client has to start the upload
+	presignedUploadExpiry = 15 * time.Minute
+	// presignedUploadMaxBytes is the largest size a client may announce, the URL is signed
+	// for the announced size so the upload cannot be any larger
+	presignedUploadMaxBytes = 100 << 20
+)
+
+// presignedUploadTypes are the content types clients may upload directly, with the
+// extension their key gets
+var presignedUploadTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"video/mp4":       ".mp4",
+}
+
+type PresignUploadPayload struct {
+	ContentType string `json:"content_type" validate:"required,max=100"`
+	Size        int64  `json:"size" validate:"required,min=1"`
+}
+
+// PresignedUpload is how to send a file straight to object storage: Method to UploadURL
+// with Headers, before ExpiresAt. The file is then served from URL.
+type PresignedUpload struct {
+	UploadURL string            `json:"upload_url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	Key       string            `json:"key"`
+	URL       string            `json:"url"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// presignUploadHandler hands out a URL the client PUTs the file to, so large files go
+// straight to object storage instead of through the API. The key lives in the user's folder, so
+// the upload is removed together with the account.
+//
+// @Summary  Create a URL to upload a file to directly
+// @Tags     users
+// @Accept   json
+// @Produce  json
+// @Param    payload body PresignUploadPayload true "Request body"
+// @Success  200 {object} Response[PresignedUpload]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Failure  503 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/uploads/presign [post]
+func (app *application) presignUploadHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload PresignUploadPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ext, ok := presignedUploadTypes[payload.ContentType]
+	if !ok {
+		app.unprocessableEntityResponse(writer, request, fmt.Errorf("content type %s is not accepted", payload.ContentType))
+		return
+	}
+
+	if payload.Size > presignedUploadMaxBytes {
+		app.unprocessableEntityResponse(writer, request, fmt.Errorf("uploads must not be larger than %d MB", presignedUploadMaxBytes>>20))
+		return
+	}
+
+	if app.storageClient == nil {
+		app.serviceUnavailableResponse(writer, request, errors.New("direct uploads need object storage"))
+		return
+	}
+
+	user := getUserFromCtx(request)
+	key := fmt.Sprintf("%suploads/%s%s", storage.UserFolder(user.ID), uuid.New().String(), ext)
+
+	uploadURL, err := app.storageClient.GeneratePresignedUploadURL(request.Context(), key, payload.ContentType, payload.Size, presignedUploadExpiry)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	// the API never sees the bytes, the orphan cleanup activates the row once the object exists
+	file := &models.File{
+		Key:         key,
+		UserID:      &user.ID,
+		Size:        payload.Size,
+		ContentType: payload.ContentType,
+		Status:      models.FilePending,
+	}
+	if err := app.store.Files.Create(request.Context(), file); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	upload := PresignedUpload{
+		UploadURL: uploadURL,
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": payload.ContentType, "Content-Length": strconv.FormatInt(payload.Size, 10)},
+		Key:       key,
+		URL:       app.storageClient.GetFileURL(key),
+		ExpiresAt: time.Now().Add(presignedUploadExpiry).UTC(),
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Upload URL created", upload); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
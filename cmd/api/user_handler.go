@@ -6,30 +6,79 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"godsendjoseph.dev/sandbox-api/internal/events"
 	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
 	"godsendjoseph.dev/sandbox-api/internal/store"
 )
 
 const userAuthCtx contextKey = "user"
 const userParamCtx contextKey = "userID"
 
+var (
+	errFollowSelf   = errors.New("you cannot follow yourself")
+	errSamePassword = errors.New("new password must be different from the current password")
+)
+
+// UpdateUserPayload replaces the names, phone is only changed when it is sent
 type UpdateUserPayload struct {
-	FirstName string `json:"first_name" validate:"required,max=100"`
-	LastName  string `json:"last_name" validate:"required,max=100"`
+	FirstName string  `json:"first_name" validate:"required,max=100"`
+	LastName  string  `json:"last_name" validate:"required,max=100"`
+	Phone     *string `json:"phone,omitempty" validate:"omitempty,e164"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required,max=100"`
+}
+
+// AccountDeletion says when a deleted account is purged for good
+type AccountDeletion struct {
+	PurgeAfter time.Time `json:"purge_after"`
 }
 
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=100"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=100,password,notbreached"`
+}
+
+// @Summary  Get the current user
+// @Tags     users
+// @Produce  json
+// @Success  200 {object} Response[models.User]
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/profile [get]
 func (app *application) getUserHandler(writer http.ResponseWriter, request *http.Request) {
 	user := getUserFromCtx(request)
 
-	if err := writeJSON(writer, http.StatusOK, "User retrieved", user); err != nil {
+	if err := app.setFollowCounts(request.Context(), user); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "User retrieved", user); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 }
 
+// @Summary  Update the current user
+// @Tags     users
+// @Accept   json
+// @Produce  json
+// @Param    payload body UpdateUserPayload true "Request body"
+// @Success  200 {object} Response[models.User]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/profile [patch]
+// @Router   /user/update-profile [post]
 func (app *application) updateUserProfileHandler(writer http.ResponseWriter, request *http.Request) {
 	var payload UpdateUserPayload
 
@@ -38,7 +87,7 @@ func (app *application) updateUserProfileHandler(writer http.ResponseWriter, req
 		return
 	}
 
-	isPayloadValid := validatePayload(writer, payload)
+	isPayloadValid := validatePayload(writer, request, payload)
 	if !isPayloadValid {
 		return
 	}
@@ -46,21 +95,179 @@ func (app *application) updateUserProfileHandler(writer http.ResponseWriter, req
 	ctx := request.Context()
 
 	user := getUserFromCtx(request)
+	previous := UpdateUserPayload{FirstName: user.FirstName, LastName: user.LastName}
 
 	user.FirstName = payload.FirstName
 	user.LastName = payload.LastName
+	if payload.Phone != nil {
+		phone := user.Phone
+		previous.Phone = &phone
+		user.Phone = *payload.Phone
+	}
 
 	if err := app.store.Users.UpdateUserProfile(ctx, user); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 
-	if err := writeJSON(writer, http.StatusOK, "User updated", user); err != nil {
+	app.evictCachedUser(request, user.ID)
+
+	app.audit(request, models.AuditProfileUpdate, user.ID, map[string]any{"from": previous, "to": payload})
+
+	if err := writeJSON(writer, request, http.StatusOK, "User updated", user); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Change the password of the current user
+// @Tags     users
+// @Accept   json
+// @Produce  json
+// @Param    payload body ChangePasswordPayload true "Request body"
+// @Success  200 {object} Response[Session]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/change-password [post]
+func (app *application) changePasswordHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload ChangePasswordPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := request.Context()
+
+	// the user in the context is loaded without the password hash
+	user, err := app.store.Users.GetByEmail(ctx, getUserFromCtx(request).Email, true)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.CurrentPassword); err != nil {
+		app.unauthorizedPwdErrorResponse(writer, request, err)
+		return
+	}
+
+	if payload.CurrentPassword == payload.NewPassword {
+		app.unprocessableEntityResponse(writer, request, errSamePassword)
+		return
+	}
+
+	if err := user.Password.Set(payload.NewPassword); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	// truncated to the second so tokens issued right after the change are still valid
+	changedAt := time.Now().UTC().Truncate(time.Second)
+	user.PasswordChangedAt = &changedAt
+
+	if err := app.store.Users.ChangePassword(ctx, user); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.audit(request, models.AuditPasswordChange, user.ID, nil)
+
+	app.evictCachedUser(request, user.ID)
+
+	if err := app.sendPasswordChangedEmail(ctx, user, changedAt); err != nil {
+		app.loggerFor(request).Errorw("error sending password changed email", "userID", user.ID, "error", err)
+	}
+
+	// every other session was revoked, hand this one a fresh token
+	token, err := app.generateJWTToken(user)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	data := app.withSessionToken(writer, user, token, Session{})
+	if err := writeJSON(writer, request, http.StatusOK, "Password changed", data); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
 }
 
+// deleteAccountHandler soft deletes the account. Logging back in within
+// store.DeletedAccountGracePeriod restores it, after that it is purged by the cron job.
+//
+// @Summary  Schedule the account of the current user for deletion
+// @Tags     users
+// @Accept   json
+// @Produce  json
+// @Param    payload body DeleteAccountPayload true "Request body"
+// @Success  200 {object} Response[AccountDeletion]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/account [delete]
+func (app *application) deleteAccountHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload DeleteAccountPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	ctx := request.Context()
+
+	// the user in the context is loaded without the password hash
+	user, err := app.store.Users.GetByEmail(ctx, getUserFromCtx(request).Email, true)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		app.unauthorizedPwdErrorResponse(writer, request, err)
+		return
+	}
+
+	if err := app.store.Users.SoftDelete(ctx, user.ID); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	app.evictCachedUser(request, user.ID)
+
+	deletion := AccountDeletion{PurgeAfter: time.Now().Add(store.DeletedAccountGracePeriod).UTC().Truncate(time.Second)}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Account scheduled for deletion", deletion); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Get a user
+// @Tags     users
+// @Produce  json
+// @Param    userID path int true "User ID"
+// @Param    deleted query string false "include or only, for admins"
+// @Success  200 {object} Response[models.User]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/{userID}/fetch-user [get]
 func (app *application) getUserByIDHandler(writer http.ResponseWriter, request *http.Request) {
 	idParam := chi.URLParam(request, "userID")
 
@@ -85,7 +292,179 @@ func (app *application) getUserByIDHandler(writer http.ResponseWriter, request *
 		return
 	}
 
-	if err := writeJSON(writer, http.StatusOK, "User retrieved", user); err != nil {
+	if err := app.setFollowCounts(ctx, user); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "User retrieved", user); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Get a user by username
+// @Tags     users
+// @Produce  json
+// @Param    username path string true "Username"
+// @Success  200 {object} Response[models.User]
+// @Failure  401 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /users/by-username/{username} [get]
+func (app *application) getUserByUsernameHandler(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	user, err := app.getUserByUsername(ctx, chi.URLParam(request, "username"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrAccountNotVerified):
+			app.notFoundResponse(writer, request, store.ErrNotFound)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if err := app.setFollowCounts(ctx, user); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "User retrieved", user); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Follow a user
+// @Tags     users
+// @Produce  json
+// @Param    userID path int true "User ID"
+// @Success  200 {object} Response[any]
+// @Failure  401 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  409 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/{userID}/follow [post]
+func (app *application) followUserHandler(writer http.ResponseWriter, request *http.Request) {
+	follower := getUserFromCtx(request)
+	followedUser := getUserParamFromCtx(request)
+
+	if follower.ID == followedUser.ID {
+		app.unprocessableEntityResponse(writer, request, errFollowSelf)
+		return
+	}
+
+	if err := app.store.Followers.Follow(request.Context(), followedUser.ID, follower.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	app.publishEvent(request.Context(), events.UserFollowed{
+		UserID:           followedUser.ID,
+		FollowerID:       follower.ID,
+		FollowerUsername: follower.Username,
+	})
+
+	if err := writeMessage(writer, request, http.StatusOK, "User followed"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Unfollow a user
+// @Tags     users
+// @Produce  json
+// @Param    userID path int true "User ID"
+// @Success  200 {object} Response[any]
+// @Failure  401 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /user/{userID}/unfollow [delete]
+func (app *application) unfollowUserHandler(writer http.ResponseWriter, request *http.Request) {
+	follower := getUserFromCtx(request)
+	unfollowedUser := getUserParamFromCtx(request)
+
+	if err := app.store.Followers.Unfollow(request.Context(), unfollowedUser.ID, follower.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if err := writeMessage(writer, request, http.StatusOK, "User unfollowed"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  List users
+// @Tags     users
+// @Produce  json
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Param    sort query string false "created_at for oldest first, -created_at (default) for newest first"
+// @Param    search query string false "Matches usernames, and emails for admins"
+// @Param    deleted query string false "include or only, for admins"
+// @Success  200 {object} Response[List[models.User]]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /users [get]
+func (app *application) listUsersHandler(writer http.ResponseWriter, request *http.Request) {
+	params, offset, err := parseOffsetPage(request, createdAtPage(20))
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.PaginatedQuery{
+		Limit:  params.Limit,
+		Offset: offset,
+		Sort:   params.Sort.Direction(),
+	}
+
+	query, err = query.Parse(request)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	// only admins may find users by their email, everybody else searches usernames
+	isAdmin, err := app.checkRolePrecedence(request.Context(), getUserFromCtx(request), "admin")
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	users, err := app.store.Users.List(request.Context(), store.UserListQuery{PaginatedQuery: query, SearchEmail: isAdmin})
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	page := pagination.OffsetPage(query.Limit, query.Offset, len(users))
+
+	if err := writeList(writer, request, "Users retrieved", users, page); err != nil {
 		app.internalServerError(writer, request, err)
 		return
 	}
@@ -131,3 +510,25 @@ func getUserFromCtx(request *http.Request) *models.User {
 	user, _ := request.Context().Value(userAuthCtx).(*models.User)
 	return user
 }
+
+func getSessionStartFromCtx(request *http.Request) time.Time {
+	authTime, _ := request.Context().Value(sessionStartCtx).(time.Time)
+	return authTime
+}
+
+func getUserParamFromCtx(request *http.Request) *models.User {
+	user, _ := request.Context().Value(userParamCtx).(*models.User)
+	return user
+}
+
+func (app *application) setFollowCounts(ctx context.Context, user *models.User) error {
+	followers, following, err := app.store.Followers.Counts(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	user.FollowersCount = followers
+	user.FollowingCount = following
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// failedTag returns the tag the first field of payload failed on, empty when it is valid
+func failedTag(t *testing.T, payload any) string {
+	t.Helper()
+
+	err := Validate.Struct(payload)
+	if err == nil {
+		return ""
+	}
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatal(err)
+	}
+	return validationErrors[0].Tag()
+}
+
+func TestValidationTags(t *testing.T) {
+	register := func(username, phone string) RegisterUserPayload {
+		return RegisterUserPayload{
+			FirstName: "Ada",
+			LastName:  "Lovelace",
+			Username:  username,
+			Email:     "ada@example.com",
+			Phone:     phone,
+			Password:  testPassword,
+		}
+	}
+	post := func(tags ...string) CreatePostPayload {
+		return CreatePostPayload{Title: "Title", Content: "Content", Tags: tags}
+	}
+
+	tests := []struct {
+		name    string
+		payload any
+		wantTag string
+	}{
+		{"username", register("ada_lovelace", ""), ""},
+		{"username with a path", register("admin/../", ""), "username"},
+		{"reserved username", register("Admin", ""), "username"},
+		{"phone in E.164", register("ada", "+14155552671"), ""},
+		{"phone without the country code", register("ada", "4155552671"), "e164"},
+		{"phone with spaces", register("ada", "+1 415 555 2671"), "e164"},
+		{"slug tags", post("go", "api-design"), ""},
+		{"tag in upper case", post("Go"), "slug"},
+		{"tag with a space", post("api design"), "slug"},
+		{"tag with a double hyphen", post("api--design"), "slug"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := failedTag(t, test.payload); got != test.wantTag {
+				t.Errorf("failed on %q, want %q", got, test.wantTag)
+			}
+		})
+	}
+}
+
+func TestRegisterWithPhone(t *testing.T) {
+	app := newTestApplication(t)
+
+	payload := map[string]any{
+		"first_name": "Ada",
+		"last_name":  "Lovelace",
+		"username":   "ada",
+		"email":      "ada@example.com",
+		"phone":      "+14155552671",
+		"password":   testPassword,
+	}
+	response, body := do(t, app, http.MethodPost, "/v1/auth/register", payload, "")
+	if response.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %v", response.Code, body)
+	}
+
+	data, _ := body["data"].(map[string]any)
+	if user, _ := data["user"].(map[string]any); user["phone"] != "+14155552671" {
+		t.Errorf("phone = %v, want +14155552671", user["phone"])
+	}
+
+	payload["username"], payload["email"], payload["phone"] = "grace", "grace@example.com", "555-2671"
+	response, body = do(t, app, http.MethodPost, "/v1/auth/register", payload, "")
+	if response.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid phone: status %d, want 422: %v", response.Code, body)
+	}
+	if got := body["error_code"]; got != string(CodeValidationFailed) {
+		t.Errorf("error_code = %v, want %s", got, CodeValidationFailed)
+	}
+}
+
+func TestUpdateProfilePhone(t *testing.T) {
+	app := newTestApplication(t)
+	user := createTestUser(t, app, "active", "active@example.com", true)
+	token, err := app.generateJWTToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		payload   map[string]any
+		wantCode  int
+		wantPhone any
+	}{
+		{map[string]any{"first_name": "Ada", "last_name": "Lovelace", "phone": "+14155552671"}, http.StatusOK, "+14155552671"},
+		// a payload without phone keeps it
+		{map[string]any{"first_name": "Ada", "last_name": "King"}, http.StatusOK, "+14155552671"},
+		{map[string]any{"first_name": "Ada", "last_name": "King", "phone": "0155 5267"}, http.StatusUnprocessableEntity, "+14155552671"},
+	}
+
+	for _, step := range steps {
+		response, body := do(t, app, http.MethodPatch, "/v1/user/profile", step.payload, token)
+		if response.Code != step.wantCode {
+			t.Fatalf("%v: status %d, want %d: %v", step.payload, response.Code, step.wantCode, body)
+		}
+
+		_, body = do(t, app, http.MethodGet, "/v1/user/profile", nil, token)
+		if profile, _ := body["data"].(map[string]any); profile["phone"] != step.wantPhone {
+			t.Errorf("%v: phone = %v, want %v", step.payload, profile["phone"], step.wantPhone)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// apiVersionHeader names the version that served the response
+	apiVersionHeader = "API-Version"
+	// vendorMediaType picks the version of an unversioned path,
+	// e.g. Accept: application/vnd.sandbox-api.v2+json
+	vendorMediaType = "application/vnd.sandbox-api."
+	// defaultAPIVersion serves unversioned paths whose Accept header names no version
+	defaultAPIVersion = "v1"
+)
+
+const apiVersionCtx contextKey = "apiVersion"
+
+// apiVersion is one mounted version of the API. Versions share their handlers, a version
+// only differs in the routes it registers on top of the shared ones and in its flags.
+type apiVersion struct {
+	name     string
+	register func(route chi.Router)
+	// problemErrors answers every error as an RFC 7807 problem, whatever the Accept header
+	problemErrors bool
+	// deprecation, when set, is a deprecations surface announced on every response
+	deprecation string
+}
+
+// apiVersions are mounted at /{name}. To ship a breaking change, add a version whose
+// register calls registerSharedRoutes and then overrides the changed routes.
+func (app *application) apiVersions() []apiVersion {
+	return []apiVersion{
+		// v1 answers errors in the error envelope, clients move to the problems of v2
+		{name: "v1", register: app.registerSharedRoutes, deprecation: "/v1"},
+		// v2 answers errors as RFC 7807 problems
+		{name: "v2", register: app.registerSharedRoutes, problemErrors: true},
+	}
+}
+
+// versionMiddleware tags the request with version, and announces its deprecation
+func (app *application) versionMiddleware(version apiVersion) func(http.Handler) http.Handler {
+	var deprecated func(http.Handler) http.Handler
+	if version.deprecation != "" {
+		deprecated = app.deprecated(version.deprecation)
+	}
+
+	return func(next http.Handler) http.Handler {
+		if deprecated != nil {
+			next = deprecated(next)
+		}
+
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set(apiVersionHeader, version.name)
+
+			ctx := context.WithValue(request.Context(), apiVersionCtx, &version)
+			next.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
+
+func getAPIVersionFromCtx(request *http.Request) *apiVersion {
+	version, _ := request.Context().Value(apiVersionCtx).(*apiVersion)
+	return version
+}
+
+// unversionedPrefixes are served outside of the versions
+var unversionedPrefixes = []string{"/.well-known/", "/uploads/", "/metrics"}
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+(/|$)`)
+
+// VersionNegotiationMiddleware routes a path without a version prefix to the version named
+// in the Accept header, or to defaultAPIVersion
+func (app *application) VersionNegotiationMiddleware(next http.Handler) http.Handler {
+	versions := map[string]bool{}
+	for _, version := range app.apiVersions() {
+		versions[version.name] = true
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		path := request.URL.Path
+		if path == "/" || versionPrefix.MatchString(path) || hasAnyPrefix(path, unversionedPrefixes) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		version := acceptedVersion(request.Header.Get("Accept"))
+		if version == "" {
+			version = defaultAPIVersion
+		}
+		if !versions[version] {
+			app.notAcceptableResponse(writer, request, fmt.Errorf("API version %q does not exist", version))
+			return
+		}
+
+		request.URL.Path = "/" + version + path
+		if request.URL.RawPath != "" {
+			request.URL.RawPath = "/" + version + request.URL.RawPath
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// acceptedVersion returns the version of the vendor media type in accept, empty when there is none
+func acceptedVersion(accept string) string {
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType = strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0])
+		if !strings.HasPrefix(mediaType, vendorMediaType) {
+			continue
+		}
+
+		version, _, _ := strings.Cut(strings.TrimPrefix(mediaType, vendorMediaType), "+")
+		return version
+	}
+	return ""
+}
+
+// canonicalPath maps a path of any version onto its v1 path. The path tables (streams,
+// body limits, the read-only allowlist, SLO groups) are written against v1, they hold for
+// every version since the versions share their routes.
+func canonicalPath(path string) string {
+	prefix := versionPrefix.FindString(path)
+	if prefix == "" {
+		return path
+	}
+	return "/v1" + path[len(strings.TrimSuffix(prefix, "/")):]
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionNegotiationMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		want   string
+	}{
+		{"unversioned path goes to the default version", "/health", "", "/v1/health"},
+		{"Accept picks the version", "/health", "application/vnd.sandbox-api.v2+json", "/v2/health"},
+		{"versioned path is left alone", "/v2/users", "", "/v2/users"},
+		{"metrics are served outside the versions", "/metrics", "", "/metrics"},
+		{"well-known paths are served outside the versions", "/.well-known/jwks.json", "", "/.well-known/jwks.json"},
+	}
+
+	app := &application{}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.accept != "" {
+				request.Header.Set("Accept", test.accept)
+			}
+
+			var got string
+			handler := app.VersionNegotiationMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+				got = request.URL.Path
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			if got != test.want {
+				t.Errorf("path = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsShedExempt(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/metrics", true},
+		{"/v1/health", true},
+		{"/v2/health/ready", true},
+		{"/v1/events", true},
+		{"/v1/healthy", false},
+		{"/v1/users", false},
+	}
+
+	for _, test := range tests {
+		if got := isShedExempt(test.path); got != test.want {
+			t.Errorf("isShedExempt(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestDeprecatedVersion(t *testing.T) {
+	tests := []struct {
+		path           string
+		wantDeprecated bool
+	}{
+		{"/v1/health", true},
+		{"/health", true},
+		{"/v2/health", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			response, body := do(t, app, http.MethodGet, test.path, nil, "")
+			if response.Code != http.StatusOK {
+				t.Fatalf("status %d: %v", response.Code, body)
+			}
+
+			header := response.Header()
+			if deprecated := header.Get("Deprecation") != "" && header.Get("Sunset") != ""; deprecated != test.wantDeprecated {
+				t.Errorf("Deprecation %q and Sunset %q, want deprecated %v", header.Get("Deprecation"), header.Get("Sunset"), test.wantDeprecated)
+			}
+			if calls := len(deprecationCalls(app, "/v1")); (calls > 0) != test.wantDeprecated {
+				t.Errorf("%d clients counted on /v1, want deprecated %v", calls, test.wantDeprecated)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/store/cache"
+)
+
+// warmCaches preloads the keys every instance needs right after a deploy: the role
+// table in process memory and the admin accounts in the user cache. A failure only costs the
+// first requests a cache miss, so it is logged and startup goes on.
+func (app *application) warmCaches(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, app.config.cacheWarmup.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	roles, err := app.store.Roles.List(ctx)
+	if err != nil {
+		app.logger.Warnw("cache warm-up: could not load roles", "error", err)
+	} else {
+		app.cacheStorage.Roles.SetAll(roles)
+	}
+
+	admins := 0
+	if app.cacheStorage.Backend != cache.BackendNone {
+		users, err := app.store.Users.ListByRole(ctx, "admin")
+		if err != nil {
+			app.logger.Warnw("cache warm-up: could not load admin users", "error", err)
+		} else {
+			entries := make([]cache.UserEntry, len(users))
+			for i, user := range users {
+				entries[i] = cache.UserEntry{User: user}
+			}
+
+			if err := app.cacheStorage.Users.SetMany(ctx, entries); err != nil {
+				app.logger.Warnw("cache warm-up: could not cache admin users", "error", err)
+			} else {
+				admins = len(users)
+			}
+		}
+	}
+
+	app.logger.Infow("cache warm-up completed", "roles", len(roles), "admins", admins, "duration", time.Since(start))
+}
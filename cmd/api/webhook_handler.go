@@ -0,0 +1,364 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/pagination"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+	"godsendjoseph.dev/sandbox-api/internal/utils"
+	"godsendjoseph.dev/sandbox-api/internal/webhook"
+)
+
+type CreateWebhookPayload struct {
+	URL         string   `json:"url" validate:"required,url,max=2048"`
+	Events      []string `json:"events" validate:"required,min=1,max=20,dive,max=100"`
+	Description string   `json:"description" validate:"max=255"`
+}
+
+type UpdateWebhookPayload struct {
+	URL         *string  `json:"url" validate:"omitempty,url,max=2048"`
+	Events      []string `json:"events" validate:"omitempty,min=1,max=20,dive,max=100"`
+	Description *string  `json:"description" validate:"omitempty,max=255"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// WebhookList is the webhooks with the events they can subscribe to
+type WebhookList struct {
+	Webhooks []*models.Webhook `json:"webhooks"`
+	Events   []string          `json:"events"`
+}
+
+// CreatedWebhook is a new webhook with its signing secret, which is only shown once
+type CreatedWebhook struct {
+	Webhook *models.Webhook `json:"webhook"`
+	Secret  string          `json:"secret"`
+}
+
+// @Summary  List the webhooks
+// @Tags     admin
+// @Produce  json
+// @Success  200 {object} Response[WebhookList]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/webhooks [get]
+func (app *application) listWebhooksHandler(writer http.ResponseWriter, request *http.Request) {
+	webhooks, err := app.store.Webhooks.List(request.Context())
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	list := WebhookList{Webhooks: orEmpty(webhooks), Events: webhook.Events}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Webhooks retrieved", list); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// createWebhookHandler subscribes a URL to events. The signing secret is in the response
+// and never shown again.
+//
+// @Summary  Create a webhook
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    payload body CreateWebhookPayload true "Request body"
+// @Success  201 {object} Response[CreatedWebhook]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/webhooks [post]
+func (app *application) createWebhookHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload CreateWebhookPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	if err := app.checkWebhook(payload.URL, payload.Events); err != nil {
+		app.unprocessableEntityResponse(writer, request, err)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	admin := getUserFromCtx(request)
+
+	hook := &models.Webhook{
+		URL:         payload.URL,
+		Secret:      secret,
+		Events:      utils.StringSlice(payload.Events),
+		Description: payload.Description,
+		Enabled:     true,
+		CreatedBy:   &admin.ID,
+	}
+
+	if err := app.store.Webhooks.Create(request.Context(), hook); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	created := CreatedWebhook{Webhook: hook, Secret: secret}
+
+	if err := writeJSON(writer, request, http.StatusCreated, "Webhook created, store the secret now, it is not shown again", created); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// @Summary  Get a webhook
+// @Tags     admin
+// @Produce  json
+// @Param    webhookID path int true "Webhook ID"
+// @Success  200 {object} Response[models.Webhook]
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/webhooks/{webhookID} [get]
+func (app *application) getWebhookHandler(writer http.ResponseWriter, request *http.Request) {
+	hook, ok := app.loadWebhook(writer, request)
+	if !ok {
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Webhook retrieved", hook); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// updateWebhookHandler changes the URL, the events, the description or pauses the webhook.
+// Deliveries already queued keep going to the webhook.
+//
+// @Summary  Update a webhook
+// @Tags     admin
+// @Accept   json
+// @Produce  json
+// @Param    webhookID path int true "Webhook ID"
+// @Param    payload body UpdateWebhookPayload true "Request body"
+// @Success  200 {object} Response[models.Webhook]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  422 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/webhooks/{webhookID} [patch]
+func (app *application) updateWebhookHandler(writer http.ResponseWriter, request *http.Request) {
+	var payload UpdateWebhookPayload
+
+	if err := readJSON(writer, request, &payload); err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isPayloadValid := validatePayload(writer, request, payload)
+	if !isPayloadValid {
+		return
+	}
+
+	hook, ok := app.loadWebhook(writer, request)
+	if !ok {
+		return
+	}
+
+	if payload.URL != nil {
+		hook.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		hook.Events = utils.StringSlice(payload.Events)
+	}
+	if payload.Description != nil {
+		hook.Description = *payload.Description
+	}
+	if payload.Enabled != nil {
+		hook.Enabled = *payload.Enabled
+	}
+
+	if err := app.checkWebhook(hook.URL, hook.Events); err != nil {
+		app.unprocessableEntityResponse(writer, request, err)
+		return
+	}
+
+	if err := app.store.Webhooks.Update(request.Context(), hook); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if err := writeJSON(writer, request, http.StatusOK, "Webhook updated", hook); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// deleteWebhookHandler unsubscribes the webhook and drops its queued deliveries
+//
+// @Summary  Delete a webhook
+// @Tags     admin
+// @Produce  json
+// @Param    webhookID path int true "Webhook ID"
+// @Success  200 {object} Response[any]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/webhooks/{webhookID} [delete]
+func (app *application) deleteWebhookHandler(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(request, "webhookID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	if err := app.store.Webhooks.Delete(request.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return
+	}
+
+	if err := writeMessage(writer, request, http.StatusOK, "Webhook deleted"); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// listWebhookDeliveriesHandler pages through the deliveries of a webhook, newest first
+//
+// @Summary  List the deliveries of a webhook
+// @Tags     admin
+// @Produce  json
+// @Param    webhookID path int true "Webhook ID"
+// @Param    limit query int false "Page size"
+// @Param    cursor query string false "next_cursor of the previous page"
+// @Param    status query string false "Delivery status"
+// @Success  200 {object} Response[List[models.WebhookDelivery]]
+// @Failure  400 {object} ErrorResponse
+// @Failure  401 {object} ErrorResponse
+// @Failure  403 {object} ErrorResponse
+// @Failure  404 {object} ErrorResponse
+// @Failure  500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router   /admin/webhooks/{webhookID}/deliveries [get]
+func (app *application) listWebhookDeliveriesHandler(writer http.ResponseWriter, request *http.Request) {
+	hook, ok := app.loadWebhook(writer, request)
+	if !ok {
+		return
+	}
+
+	params, offset, err := parseOffsetPage(request, pagination.Options{DefaultLimit: 50, MaxLimit: 100})
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	query := store.WebhookDeliveryQuery{
+		Limit:  params.Limit,
+		Offset: offset,
+	}
+
+	query, err = query.Parse(request)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return
+	}
+
+	isQueryValid := validatePayload(writer, request, query)
+	if !isQueryValid {
+		return
+	}
+
+	deliveries, err := app.store.Webhooks.ListDeliveries(request.Context(), hook.ID, query)
+	if err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+
+	page := pagination.OffsetPage(query.Limit, query.Offset, len(deliveries))
+
+	if err := writeList(writer, request, "Webhook deliveries retrieved", deliveries, page); err != nil {
+		app.internalServerError(writer, request, err)
+		return
+	}
+}
+
+// checkWebhook rejects unknown events, and plain http URLs in production since the
+// payloads carry user data
+func (app *application) checkWebhook(rawURL string, events []string) error {
+	for _, event := range events {
+		if !webhook.IsEvent(event) {
+			return fmt.Errorf("unknown event %q, subscribe to any of %v", event, webhook.Events)
+		}
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case parsed.Scheme == "https":
+	case parsed.Scheme == "http" && app.config.env != "production":
+	default:
+		return errors.New("webhook URL must use https")
+	}
+
+	return nil
+}
+
+func (app *application) loadWebhook(writer http.ResponseWriter, request *http.Request) (*models.Webhook, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(request, "webhookID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(writer, request, err)
+		return nil, false
+	}
+
+	hook, err := app.store.Webhooks.GetByID(request.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(writer, request, err)
+		default:
+			app.internalServerError(writer, request, err)
+		}
+		return nil, false
+	}
+
+	return hook, true
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	appconfig "godsendjoseph.dev/sandbox-api/internal/config"
+	"godsendjoseph.dev/sandbox-api/internal/db"
+	"godsendjoseph.dev/sandbox-api/internal/env"
+	"godsendjoseph.dev/sandbox-api/internal/migrations"
+)
+
+const usage = `usage: migrate <command> [flags]
+
+commands:
+  up [N]             apply the pending migrations, or only the next N
+  down N             roll back the last N migrations, -all rolls back every one
+  steps N            apply the next N migrations, or roll back N when negative
+  force VERSION      set the version without running anything, after fixing a failed migration
+  version            print the current version
+  status             list the migrations and whether they are applied
+  create NAME        write an empty timestamped up and down migration
+
+up, down and steps refuse destructive statements unless -allow-destructive is given.
+The database settings are read like the API's: .env, CONFIG_FILE or --config=path, flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	_ = godotenv.Load()
+
+	// --name=value arguments are settings, see config.Load, the rest belongs to the command
+	loaded, err := appconfig.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	command, args := os.Args[1], commandArgs(os.Args[2:])
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	allowDestructive := flags.Bool("allow-destructive", false, "apply migrations that drop, truncate or change columns")
+	all := flags.Bool("all", false, "with down, roll back every migration")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	positional := parseInterspersed(flags, args)
+
+	dir := migrations.Dir()
+
+	// creating a migration does not need the database
+	if command == "create" {
+		if len(positional) != 1 {
+			log.Fatal("create: expected the migration name, e.g. create add_posts_index")
+		}
+		paths, err := migrations.Create(dir, positional[0], time.Now())
+		if err != nil {
+			log.Fatalf("create: %v", err)
+		}
+		for _, path := range paths {
+			fmt.Println("created", path)
+		}
+		return
+	}
+
+	if err := loaded.ResolveSecrets(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	conn, err := db.New(
+		fmt.Sprintf("%s:%s", env.GetString("DB_HOST", "127.0.0.1"), env.GetString("DB_PORT", "3306")),
+		env.GetString("DB_USER", "root"),
+		env.GetString("DB_PASSWORD", "root"),
+		env.GetString("DB_NAME", "testdb"),
+		2,
+		2,
+		env.GetString("DB_MAX_IDLE_TIME", "15m"),
+		nil,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	runner, err := migrations.New(conn, dir, os.Stdout)
+	if err != nil {
+		conn.Close()
+		log.Fatal(err)
+	}
+	defer runner.Close()
+
+	if err := run(runner, command, positional, *allowDestructive, *all); err != nil {
+		runner.Close()
+		log.Fatalf("%s: %v", command, err)
+	}
+}
+
+func run(runner *migrations.Runner, command string, positional []string, allowDestructive, all bool) error {
+	switch command {
+	case "up":
+		n, err := optionalCount(positional)
+		if err != nil {
+			return err
+		}
+		applied, err := runner.Up(n, allowDestructive)
+		if err != nil {
+			return err
+		}
+		return printChange("applied", applied, runner)
+
+	case "down":
+		n, err := optionalCount(positional)
+		if err != nil {
+			return err
+		}
+		if n == 0 && !all {
+			return fmt.Errorf("expected how many migrations to roll back, or -all")
+		}
+		rolledBack, err := runner.Down(n, allowDestructive)
+		if err != nil {
+			return err
+		}
+		return printChange("rolled back", rolledBack, runner)
+
+	case "steps":
+		if len(positional) != 1 {
+			return fmt.Errorf("expected the number of steps, negative to roll back")
+		}
+		n, err := strconv.Atoi(positional[0])
+		if err != nil || n == 0 {
+			return migrations.ErrNoSteps
+		}
+		if n < 0 {
+			rolledBack, err := runner.Down(-n, allowDestructive)
+			if err != nil {
+				return err
+			}
+			return printChange("rolled back", rolledBack, runner)
+		}
+		applied, err := runner.Up(n, allowDestructive)
+		if err != nil {
+			return err
+		}
+		return printChange("applied", applied, runner)
+
+	case "force":
+		if len(positional) != 1 {
+			return fmt.Errorf("expected the version to force")
+		}
+		version, err := strconv.Atoi(positional[0])
+		if err != nil {
+			return fmt.Errorf("invalid version number: %v", err)
+		}
+		if err := runner.Force(version); err != nil {
+			return err
+		}
+		return printChange("forced", 0, runner)
+
+	case "version":
+		version, dirty, err := runner.Version()
+		if err != nil {
+			return err
+		}
+		fmt.Println(versionLabel(version, dirty))
+		return nil
+
+	case "status":
+		return printStatus(runner)
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	return nil
+}
+
+func printChange(action string, count int, runner *migrations.Runner) error {
+	version, dirty, err := runner.Version()
+	if err != nil {
+		return err
+	}
+
+	if action == "forced" {
+		fmt.Printf("forced, now at %s\n", versionLabel(version, dirty))
+		return nil
+	}
+	if count == 0 {
+		fmt.Printf("no change, at %s\n", versionLabel(version, dirty))
+		return nil
+	}
+
+	fmt.Printf("%s %d migration(s), now at %s\n", action, count, versionLabel(version, dirty))
+	return nil
+}
+
+func printStatus(runner *migrations.Runner) error {
+	version, dirty, err := runner.Version()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := runner.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("database at %s\n\n", versionLabel(version, dirty))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS")
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Version == version && dirty:
+			state = "dirty"
+		case status.Applied:
+			state = "applied"
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, state)
+	}
+
+	return writer.Flush()
+}
+
+func versionLabel(version uint, dirty bool) string {
+	switch {
+	case version == 0:
+		return "no version"
+	case dirty:
+		return fmt.Sprintf("version %d (dirty)", version)
+	default:
+		return fmt.Sprintf("version %d", version)
+	}
+}
+
+// optionalCount reads the N of up [N] and down N, 0 when it is left out
+func optionalCount(positional []string) (int, error) {
+	switch len(positional) {
+	case 0:
+		return 0, nil
+	case 1:
+		n, err := strconv.Atoi(positional[0])
+		if err != nil || n <= 0 {
+			return 0, migrations.ErrNoSteps
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unexpected arguments %s", strings.Join(positional[1:], " "))
+	}
+}
+
+// commandArgs drops the settings config.Load already applied
+func commandArgs(args []string) []string {
+	kept := []string{}
+	for _, arg := range args {
+		if arg == "--print-config" || (strings.HasPrefix(arg, "--") && strings.Contains(arg, "=")) {
+			continue
+		}
+		kept = append(kept, arg)
+	}
+	return kept
+}
+
+// parseInterspersed parses flags wherever they appear, so down 2 -allow-destructive works
+// like down -allow-destructive 2, and returns the positional arguments. Numbers are always
+// positional, steps -2 is not a flag.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	positional, rest := []string{}, []string{}
+	for _, arg := range args {
+		if _, err := strconv.Atoi(arg); err == nil {
+			positional = append(positional, arg)
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	for {
+		flags.Parse(rest)
+		rest = flags.Args()
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		rest = rest[1:]
+	}
+}
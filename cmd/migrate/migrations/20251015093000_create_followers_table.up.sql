@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS followers (
+    user_id INT UNSIGNED NOT NULL,
+    follower_id INT UNSIGNED NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, follower_id),
+    KEY idx_followers_follower_id (follower_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE posts
+    DROP FOREIGN KEY fk_posts_user,
+    ADD CONSTRAINT posts_ibfk_1 FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
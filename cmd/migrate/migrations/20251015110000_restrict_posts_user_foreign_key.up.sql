@@ -0,0 +1,3 @@
+ALTER TABLE posts
+    DROP FOREIGN KEY posts_ibfk_1,
+    ADD CONSTRAINT fk_posts_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
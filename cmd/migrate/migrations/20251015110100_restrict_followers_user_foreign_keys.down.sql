@@ -0,0 +1,5 @@
+ALTER TABLE followers
+    DROP FOREIGN KEY fk_followers_user,
+    DROP FOREIGN KEY fk_followers_follower,
+    ADD CONSTRAINT followers_ibfk_1 FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    ADD CONSTRAINT followers_ibfk_2 FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+ALTER TABLE followers
+    DROP FOREIGN KEY followers_ibfk_1,
+    DROP FOREIGN KEY followers_ibfk_2,
+    ADD CONSTRAINT fk_followers_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT,
+    ADD CONSTRAINT fk_followers_follower FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE RESTRICT;
@@ -0,0 +1,2 @@
+ALTER TABLE user_invitations
+    DROP FOREIGN KEY fk_user_invitations_user;
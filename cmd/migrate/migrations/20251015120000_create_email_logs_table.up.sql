@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS email_logs (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    provider VARCHAR(50) NOT NULL,
+    template VARCHAR(255) NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    provider_response TEXT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_email_logs_recipient (recipient),
+    KEY idx_email_logs_status_created_at (status, created_at),
+    KEY idx_email_logs_created_at (created_at)
+);
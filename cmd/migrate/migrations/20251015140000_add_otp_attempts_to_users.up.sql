@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN otp_attempts INT UNSIGNED NOT NULL DEFAULT 0 AFTER otp_expires_at;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS user_backup_codes (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id INT UNSIGNED NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_user_backup_codes_user_code (user_id, code_hash),
+    CONSTRAINT fk_user_backup_codes_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT
+);
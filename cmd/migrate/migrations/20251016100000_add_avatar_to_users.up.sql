@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN avatar_key VARCHAR(512) NULL DEFAULT NULL,
+    ADD COLUMN avatar_url VARCHAR(1024) NULL DEFAULT NULL;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS files (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    storage_key VARCHAR(512) NOT NULL,
+    user_id INT UNSIGNED NULL DEFAULT NULL,
+    size BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    content_type VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NULL DEFAULT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_files_storage_key (storage_key),
+    KEY idx_files_user_id (user_id),
+    KEY idx_files_status_created_at (status, created_at),
+    CONSTRAINT fk_files_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+-- avatars are the only uploads referenced from another table, track them so the orphan cleanup keeps them
+INSERT IGNORE INTO files (storage_key, user_id, content_type, status)
+SELECT avatar_key, id, IF(avatar_key LIKE '%.jpg', 'image/jpeg', 'image/png'), 'active'
+FROM users
+WHERE avatar_key IS NOT NULL AND avatar_key <> '';
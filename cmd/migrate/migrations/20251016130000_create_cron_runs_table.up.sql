@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS cron_runs (
+    job_name VARCHAR(100) NOT NULL,
+    run_at TIMESTAMP NOT NULL,
+    instance VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (job_name, run_at)
+);
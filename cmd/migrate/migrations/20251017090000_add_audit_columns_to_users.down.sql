@@ -0,0 +1,3 @@
+ALTER TABLE users
+    DROP COLUMN created_by,
+    DROP COLUMN updated_by;
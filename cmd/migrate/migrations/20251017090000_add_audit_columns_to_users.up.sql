@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN created_by INT UNSIGNED NULL DEFAULT NULL,
+    ADD COLUMN updated_by INT UNSIGNED NULL DEFAULT NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id INT UNSIGNED NULL DEFAULT NULL,
+    actor_id INT UNSIGNED NULL DEFAULT NULL,
+    action VARCHAR(50) NOT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    metadata JSON NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_audit_logs_user_id (user_id, created_at),
+    KEY idx_audit_logs_action (action, created_at),
+    KEY idx_audit_logs_created_at (created_at)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN verification_reminded_at TIMESTAMP NULL DEFAULT NULL,
+    ADD KEY idx_users_unverified (is_active, created_at);
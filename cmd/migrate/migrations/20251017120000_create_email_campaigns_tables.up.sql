@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS email_campaigns (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    template VARCHAR(100) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    audience VARCHAR(20) NOT NULL,
+    role VARCHAR(50) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'sending',
+    created_by INT UNSIGNED NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (id),
+    KEY idx_email_campaigns_status (status),
+    CONSTRAINT fk_email_campaigns_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS email_campaign_recipients (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    campaign_id BIGINT UNSIGNED NOT NULL,
+    user_id INT UNSIGNED NULL DEFAULT NULL,
+    username VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    last_error VARCHAR(1000) NULL DEFAULT NULL,
+    queued_at TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_email_campaign_recipients_email (campaign_id, email),
+    KEY idx_email_campaign_recipients_status (campaign_id, status, id),
+    CONSTRAINT fk_email_campaign_recipients_campaign FOREIGN KEY (campaign_id) REFERENCES email_campaigns(id) ON DELETE CASCADE,
+    CONSTRAINT fk_email_campaign_recipients_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
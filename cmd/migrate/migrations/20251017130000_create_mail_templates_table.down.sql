@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mail_templates;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS mail_templates (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    version INT UNSIGNED NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by INT UNSIGNED NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_mail_templates_name_version (name, version),
+    KEY idx_mail_templates_active (active, name),
+    CONSTRAINT fk_mail_templates_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id INT UNSIGNED NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    locale VARCHAR(10) NOT NULL DEFAULT '',
+    theme VARCHAR(10) NOT NULL DEFAULT 'system',
+    email_opt_outs VARCHAR(255) NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_user_settings_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
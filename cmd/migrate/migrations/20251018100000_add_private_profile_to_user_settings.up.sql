@@ -0,0 +1 @@
+ALTER TABLE user_settings ADD COLUMN private_profile BOOLEAN NOT NULL DEFAULT FALSE AFTER email_opt_outs;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    normalized_email VARCHAR(255) NOT NULL,
+    role_id INT UNSIGNED NOT NULL,
+    invited_by INT UNSIGNED NULL DEFAULT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL DEFAULT NULL,
+    accepted_by INT UNSIGNED NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_invitations_normalized_email (normalized_email),
+    CONSTRAINT fk_invitations_role FOREIGN KEY (role_id) REFERENCES roles(id),
+    CONSTRAINT fk_invitations_invited_by FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_invitations_accepted_by FOREIGN KEY (accepted_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    job_id CHAR(36) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    priority TINYINT NOT NULL DEFAULT 0,
+    payload JSON NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    max_attempts INT UNSIGNED NOT NULL DEFAULT 1,
+    run_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    locked_by VARCHAR(255) NULL DEFAULT NULL,
+    last_error VARCHAR(1000) NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_jobs_job_id (job_id),
+    KEY idx_jobs_status_run_at (status, run_at)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS scheduled_emails (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    template VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    data JSON NOT NULL,
+    is_sandbox BOOLEAN NOT NULL DEFAULT FALSE,
+    send_at TIMESTAMP(3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_scheduled_emails_send_at (send_at)
+);
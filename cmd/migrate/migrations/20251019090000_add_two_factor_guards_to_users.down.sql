@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN totp_last_step,
+    DROP COLUMN two_factor_attempts,
+    DROP COLUMN two_factor_locked_until;
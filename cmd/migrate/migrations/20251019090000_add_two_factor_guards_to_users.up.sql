@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN two_factor_attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    ADD COLUMN two_factor_locked_until TIMESTAMP NULL DEFAULT NULL;
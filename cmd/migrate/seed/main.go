@@ -1,23 +1,52 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
 
 	"godsendjoseph.dev/sandbox-api/internal/db"
 	"godsendjoseph.dev/sandbox-api/internal/env"
-	"godsendjoseph.dev/sandbox-api/internal/store"
 )
 
 func main() {
+	load := flag.Bool("load", false, "generate load-test data instead of the default seed")
+	teardown := flag.Bool("teardown", false, "delete the data created with -load")
+	profile := flag.String("profile", "dev", "seed preset: "+strings.Join(profileNames(), ", "))
+	users := flag.Int("users", 100000, "users to create, 100000 with -load")
+	posts := flag.Bool("posts", true, "create posts for the seeded users")
+	postsPerUser := flag.Int("posts-per-user", 5, "posts per generated user")
+	followsPerUser := flag.Int("follows-per-user", 20, "accounts each generated user follows")
+	adminEmail := flag.String("admin-email", env.GetString("SEED_ADMIN_EMAIL", ""), "create this admin, or promote the account with this email")
+	adminUsername := flag.String("admin-username", "", "username of a new admin, the email's local part by default")
+	adminPassword := flag.String("admin-password", env.GetString("SEED_ADMIN_PASSWORD", ""), "password of the admin, a new admin without one gets a random password")
+	randomSeed := flag.Int64("seed", 0, "seed of the generated names and posts, the same seed gives the same data")
+	batchSize := flag.Int("batch", 1000, "rows per INSERT with -load")
+	workers := flag.Int("workers", 8, "batches inserted concurrently with -load")
+	flag.Parse()
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	maxOpenConns := env.GetInt("DB_MAX_OPEN_CONNS", 25)
+	if *workers > maxOpenConns {
+		maxOpenConns = *workers
+	}
+
 	conn, err := db.New(
 		fmt.Sprintf("%s:%s", env.GetString("DB_HOST", "127.0.0.1"), env.GetString("DB_PORT", "3306")),
 		env.GetString("DB_USER", "root"),
 		env.GetString("DB_PASSWORD", "password"),
 		env.GetString("DB_NAME", "social_api_db"),
-		env.GetInt("DB_MAX_OPEN_CONNS", 25),
+		maxOpenConns,
 		env.GetInt("DB_MAX_IDLE_CONNS", 25),
 		env.GetString("DB_MAX_IDLE_TIME", "15m"),
+		nil,
 	)
 
 	if err != nil {
@@ -26,6 +55,67 @@ func main() {
 
 	defer conn.Close()
 
-	store := store.NewStorage(conn)
-	db.Seed(store, conn)
+	// Ctrl+C stops the generator after the batches in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch {
+	case *teardown:
+		if err := db.Teardown(ctx, conn, *batchSize); err != nil {
+			log.Panic(err)
+		}
+	case *load:
+		err := db.GenerateLoad(ctx, conn, db.LoadConfig{
+			Users:          *users,
+			PostsPerUser:   *postsPerUser,
+			FollowsPerUser: *followsPerUser,
+			BatchSize:      *batchSize,
+			Workers:        *workers,
+		})
+		if err != nil {
+			log.Panic(err)
+		}
+	default:
+		cfg, ok := db.SeedProfiles[*profile]
+		if !ok {
+			log.Fatalf("unknown profile %q, use one of %s", *profile, strings.Join(profileNames(), ", "))
+		}
+
+		// flags given on the command line override the profile
+		if set["users"] {
+			cfg.Users = *users
+		}
+		if set["posts-per-user"] {
+			cfg.PostsPerUser = *postsPerUser
+		}
+		if set["posts"] {
+			switch {
+			case !*posts:
+				cfg.PostsPerUser = 0
+			case cfg.PostsPerUser == 0:
+				cfg.PostsPerUser = *postsPerUser
+			}
+		}
+		if set["follows-per-user"] {
+			cfg.FollowsPerUser = *followsPerUser
+		}
+		cfg.AdminEmail = *adminEmail
+		cfg.AdminUsername = *adminUsername
+		cfg.AdminPassword = *adminPassword
+		cfg.RandomSeed = *randomSeed
+
+		log.Printf("seeding profile %s: %d users, %d posts and %d follows each", *profile, cfg.Users, cfg.PostsPerUser, cfg.FollowsPerUser)
+		if err := db.Seed(ctx, conn, cfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func profileNames() []string {
+	names := make([]string, 0, len(db.SeedProfiles))
+	for name := range db.SeedProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
@@ -7,4 +7,6 @@ import (
 type Authenticator interface {
 	GenerateToken(claims jwt.Claims) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
+	// PublicKeys lists the keys other services can verify tokens with, none for HMAC
+	PublicKeys() []JWK
 }
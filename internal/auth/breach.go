@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBreachAPIURL is the Have I Been Pwned range API
+const DefaultBreachAPIURL = "https://api.pwnedpasswords.com/range/"
+
+const breachCheckTimeout = 3 * time.Second
+
+// BreachChecker looks passwords up in the Have I Been Pwned corpus with k-anonymity: only
+// the first 5 characters of the SHA-1 hash leave the server, the match is made locally
+// against every suffix sharing that prefix.
+type BreachChecker struct {
+	apiURL string
+	client *http.Client
+}
+
+func NewBreachChecker(apiURL string) *BreachChecker {
+	if apiURL == "" {
+		apiURL = DefaultBreachAPIURL
+	}
+	if !strings.HasSuffix(apiURL, "/") {
+		apiURL += "/"
+	}
+
+	return &BreachChecker{
+		apiURL: apiURL,
+		client: &http.Client{Timeout: breachCheckTimeout},
+	}
+}
+
+// Breaches returns how many times password appears in known breaches, 0 when it does not
+func (checker *BreachChecker) Breaches(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, checker.apiURL+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// padding hides from observers how many suffixes the prefix has
+	request.Header.Set("Add-Padding", "true")
+
+	resp, err := checker.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("breach API answered %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found || candidate != suffix {
+			continue
+		}
+
+		// padding entries carry a count of 0
+		return strconv.Atoi(count)
+	}
+
+	return 0, scanner.Err()
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidDeviceToken = errors.New("device report token is invalid")
+
+// DeviceToken signs the id of a device together with its user and the time it was first
+// seen, so the "this wasn't me" link of one sign-in cannot report another. It reads
+// <id>.<signature>.
+func DeviceToken(secret string, id, userID int64, firstSeenAt time.Time) string {
+	return strconv.FormatInt(id, 10) + "." + deviceSignature(secret, id, userID, firstSeenAt)
+}
+
+// ParseDeviceToken returns the id of the device token claims to be for. Load the device
+// and check the token with VerifyDeviceToken before trusting it.
+func ParseDeviceToken(token string) (int64, error) {
+	idPart, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidDeviceToken
+	}
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidDeviceToken
+	}
+
+	return id, nil
+}
+
+// VerifyDeviceToken reports whether token was signed for the device with id, userID and
+// firstSeenAt
+func VerifyDeviceToken(secret, token string, id, userID int64, firstSeenAt time.Time) bool {
+	expected := DeviceToken(secret, id, userID, firstSeenAt)
+	return hmac.Equal([]byte(token), []byte(expected))
+}
+
+func deviceSignature(secret string, id, userID int64, firstSeenAt time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("device."))
+	mac.Write([]byte(strconv.FormatInt(id, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(userID, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(firstSeenAt.Unix(), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidInvitationToken = errors.New("invitation token is invalid")
+
+// InvitationToken signs the id of an invitation together with its email and expiry, so a
+// token cannot be reused for another address or outlive its invitation. It reads
+// <id>.<signature>.
+func InvitationToken(secret string, id int64, email string, expiresAt time.Time) string {
+	return strconv.FormatInt(id, 10) + "." + invitationSignature(secret, id, email, expiresAt)
+}
+
+// ParseInvitationToken returns the id of the invitation token claims to be for. Load the
+// invitation and check the token with VerifyInvitationToken before trusting it.
+func ParseInvitationToken(token string) (int64, error) {
+	idPart, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidInvitationToken
+	}
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidInvitationToken
+	}
+
+	return id, nil
+}
+
+// VerifyInvitationToken reports whether token was signed for the invitation with id,
+// email and expiresAt
+func VerifyInvitationToken(secret, token string, id int64, email string, expiresAt time.Time) bool {
+	expected := InvitationToken(secret, id, email, expiresAt)
+	return hmac.Equal([]byte(token), []byte(expected))
+}
+
+func invitationSignature(secret string, id int64, email string, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(id, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(email))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(expiresAt.Unix(), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
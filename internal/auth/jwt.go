@@ -45,3 +45,8 @@ func (auth *JWTAuthenticator) ValidateToken(tokenString string) (*jwt.Token, err
 		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
 	)
 }
+
+// PublicKeys is empty, an HMAC secret cannot be published
+func (auth *JWTAuthenticator) PublicKeys() []JWK {
+	return []JWK{}
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK is the public half of a signing key as published in /.well-known/jwks.json
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// ECDSA
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+// KeyAuthenticator signs with an RSA or ECDSA key and verifies with every key in its
+// directory. Each file <kid>.pem holds a private key. To rotate, add the new key, make it
+// the active one, and remove the old file once the tokens it signed have expired.
+type KeyAuthenticator struct {
+	dir      string
+	activeID string
+	audience string
+	issuer   string
+
+	mutex  sync.RWMutex
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// NewKeyAuthenticator loads the keys in dir. activeID picks the signing key, empty means
+// the last file in name order, so date prefixed names rotate by just adding a file.
+func NewKeyAuthenticator(dir, activeID, audience, issuer string) (*KeyAuthenticator, error) {
+	auth := &KeyAuthenticator{
+		dir:      dir,
+		activeID: activeID,
+		audience: audience,
+		issuer:   issuer,
+	}
+
+	if err := auth.Reload(); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// Reload reads the key directory again. On error the keys loaded before are kept.
+func (auth *KeyAuthenticator) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(auth.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no *.pem signing keys in %s", auth.dir)
+	}
+	sort.Strings(paths)
+
+	keys := make(map[string]*signingKey, len(paths))
+	var active *signingKey
+
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		keys[key.id] = key
+		if auth.activeID == "" || key.id == auth.activeID {
+			active = key
+		}
+	}
+
+	if active == nil {
+		return fmt.Errorf("active signing key %q not found in %s", auth.activeID, auth.dir)
+	}
+
+	auth.mutex.Lock()
+	auth.keys = keys
+	auth.active = active
+	auth.mutex.Unlock()
+
+	return nil
+}
+
+func (auth *KeyAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	auth.mutex.RLock()
+	key := auth.active
+	auth.mutex.RUnlock()
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+
+	return token.SignedString(key.signer)
+}
+
+func (auth *KeyAuthenticator) ValidateToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+
+		auth.mutex.RLock()
+		key, ok := auth.keys[id]
+		auth.mutex.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", id)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return key.signer.Public(), nil
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(auth.audience),
+		jwt.WithIssuer(auth.issuer),
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodRS256.Name,
+			jwt.SigningMethodES256.Name,
+			jwt.SigningMethodES384.Name,
+		}),
+	)
+}
+
+// PublicKeys returns every key that tokens may be signed with, the active one first
+func (auth *KeyAuthenticator) PublicKeys() []JWK {
+	auth.mutex.RLock()
+	defer auth.mutex.RUnlock()
+
+	ids := make([]string, 0, len(auth.keys))
+	for id := range auth.keys {
+		if id != auth.active.id {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	jwks := []JWK{publicJWK(auth.active)}
+	for _, id := range ids {
+		jwks = append(jwks, publicJWK(auth.keys[id]))
+	}
+
+	return jwks
+}
+
+// loadSigningKey reads a PKCS#8, PKCS#1 or SEC 1 private key, the file name is the key id
+func loadSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{id: strings.TrimSuffix(filepath.Base(path), ".pem")}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys need at least 2048 bits")
+		}
+		key.method, key.signer = jwt.SigningMethodRS256, private
+	case *ecdsa.PrivateKey:
+		switch private.Curve {
+		case elliptic.P256():
+			key.method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.method = jwt.SigningMethodES384
+		default:
+			return nil, errors.New("ECDSA keys must use P-256 or P-384")
+		}
+		key.signer = private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or ECDSA", parsed)
+	}
+
+	return key, nil
+}
+
+func publicJWK(key *signingKey) JWK {
+	jwk := JWK{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+
+	switch public := key.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64URL(public.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = public.Curve.Params().Name
+		jwk.X = base64URL(public.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64URL(public.Y.FillBytes(make([]byte, size)))
+	}
+
+	return jwk
+}
+
+func base64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Password scores run from 0 (guessed instantly) to 4 (out of reach of offline attacks),
+// the same scale zxcvbn uses so clients can show a matching meter
+const (
+	PasswordScoreMin = 0
+	PasswordScoreMax = 4
+)
+
+// passwordScoreBits are the estimated bits of entropy needed for scores 1 to 4
+var passwordScoreBits = [PasswordScoreMax]float64{25, 35, 50, 65}
+
+// commonPasswords are rejected outright, and count as a single character when they appear
+// inside a longer password
+var commonPasswords = []string{
+	"123456", "12345678", "123456789", "1234567890", "111111", "000000", "654321", "121212",
+	"password", "passw0rd", "p@ssword", "p@ssw0rd", "qwerty", "qwertyuiop", "asdfgh", "asdfghjkl",
+	"zxcvbn", "zxcvbnm", "1q2w3e", "1qaz2wsx", "abc123", "letmein", "welcome", "monkey",
+	"dragon", "master", "sunshine", "princess", "football", "baseball", "iloveyou", "trustno1",
+	"superman", "batman", "shadow", "michael", "jennifer", "starwars", "whatever", "freedom",
+	"hello", "charlie", "donald", "login", "admin", "administrator", "secret", "changeme",
+	"default", "access", "mustang", "flower", "cheese", "computer", "internet", "summer",
+	"winter", "spring", "autumn", "killer", "pepper", "ginger", "hunter", "soccer", "hockey",
+	"ranger", "buster", "tigger", "jordan", "harley", "robert", "thomas", "daniel", "andrew",
+}
+
+// PasswordStrength estimates how hard password is to guess and returns its score with the
+// main reason it falls short of PasswordScoreMax, empty when it does not
+func PasswordStrength(password string) (int, string) {
+	lower := strings.ToLower(password)
+	for _, common := range commonPasswords {
+		if lower == common {
+			return PasswordScoreMin, "is one of the most commonly used passwords"
+		}
+	}
+
+	// a common password inside a longer one adds about as much as one more character
+	reduced := lower
+	containsCommon := false
+	for _, common := range commonPasswords {
+		if len(common) >= 4 && strings.Contains(reduced, common) {
+			reduced = strings.ReplaceAll(reduced, common, "\x00")
+			containsCommon = true
+		}
+	}
+
+	length, predictable := effectiveLength(reduced)
+	bits := length * math.Log2(float64(characterPool(password)))
+
+	score := PasswordScoreMin
+	for score < PasswordScoreMax && bits >= passwordScoreBits[score] {
+		score++
+	}
+
+	switch {
+	case score == PasswordScoreMax:
+		return score, ""
+	case containsCommon:
+		return score, "contains a commonly used password"
+	case predictable:
+		return score, "is too predictable, avoid repeated characters and sequences such as abc or 123"
+	default:
+		return score, "is too weak, use a longer password or mix in upper case letters, digits and symbols"
+	}
+}
+
+// effectiveLength counts the characters of password that add to its entropy, a character
+// repeating or continuing a sequence from the one before it only counts for a quarter.
+// predictable reports whether those make up at least half of the password.
+func effectiveLength(password string) (float64, bool) {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0, false
+	}
+
+	length := 1.0
+	repeats := 0
+	for i := 1; i < len(runes); i++ {
+		delta := runes[i] - runes[i-1]
+		if delta >= -1 && delta <= 1 {
+			length += 0.25
+			repeats++
+			continue
+		}
+		length++
+	}
+
+	return length, repeats*2 >= len(runes)
+}
+
+// characterPool is the size of the alphabet password draws from
+func characterPool(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool < 2 {
+		pool = 2
+	}
+	return pool
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	step := now.Unix() / int64(totpPeriod.Seconds())
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current code", totpCode(key, step), 0, step, true},
+		{"previous code within the skew", totpCode(key, step-1), 0, step - 1, true},
+		{"next code within the skew", totpCode(key, step+1), 0, step + 1, true},
+		{"code outside the skew", totpCode(key, step-2), 0, 0, false},
+		{"replayed code", totpCode(key, step), step, 0, false},
+		{"code older than the last accepted", totpCode(key, step-1), step, 0, false},
+		{"newer code after an accepted one", totpCode(key, step+1), step, step + 1, true},
+		{"wrong length", "12345", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(secret, test.code, now, test.lastStep)
+			if ok != test.wantOK || gotStep != test.wantStep {
+				t.Errorf("ValidateTOTP = %d, %v, want %d, %v", gotStep, ok, test.wantStep, test.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Package captcha verifies the tokens that CAPTCHA widgets hand to the browser.
+// Turnstile, hCaptcha and reCAPTCHA share the same siteverify API.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderTurnstile = "turnstile"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderReCaptcha = "recaptcha"
+)
+
+var verifyURLs = map[string]string{
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderReCaptcha: "https://www.google.com/recaptcha/api/siteverify",
+}
+
+var (
+	// ErrMissingToken is returned when the client sent no token at all
+	ErrMissingToken = errors.New("captcha token is required")
+	// ErrFailed is returned when the provider rejected the token
+	ErrFailed = errors.New("captcha verification failed")
+)
+
+type Verifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// New returns the verifier of provider, or nil when provider is empty, which disables CAPTCHAs
+func New(provider, secret string) (Verifier, error) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if provider == "" {
+		return nil, nil
+	}
+
+	verifyURL, ok := verifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown captcha provider %q, use turnstile, hcaptcha or recaptcha", provider)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("captcha provider %s needs a secret", provider)
+	}
+
+	return &siteVerifier{
+		url:    verifyURL,
+		secret: secret,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+type siteVerifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (verifier *siteVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if strings.TrimSpace(token) == "" {
+		return ErrMissingToken
+	}
+
+	form := url.Values{"secret": {verifier.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, verifier.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := verifier.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("captcha provider unreachable: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha provider returned %s", response.Status)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha provider sent an invalid response: %w", err)
+	}
+
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrFailed, strings.Join(result.ErrorCodes, ", "))
+	}
+
+	return nil
+}
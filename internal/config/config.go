@@ -0,0 +1,221 @@
+// Package config layers the settings of the API: a YAML config file, the environment and
+// command-line flags, each overriding the one before. Every layer ends up in the process
+// environment, so the API keeps reading its settings with the env package.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"godsendjoseph.dev/sandbox-api/internal/configbackup"
+	"godsendjoseph.dev/sandbox-api/internal/env"
+)
+
+// Where a setting came from, in order of precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+const (
+	fileFlag  = "--config="
+	printFlag = "--print-config"
+	// FileVar names the config file when --config is not given
+	FileVar = "CONFIG_FILE"
+)
+
+// Loaded is the outcome of Load
+type Loaded struct {
+	// File is the config file that was applied, empty without one
+	File string
+	// PrintConfig asks to print the settings instead of starting
+	PrintConfig bool
+	// Command is the first positional argument, such as doctor, empty without one
+	Command string
+	// sources remembers the variables set by the file or a flag
+	sources map[string]string
+}
+
+// Load applies the config file and the flags in args to the environment. The file is
+// --config=path, or CONFIG_FILE. Variables already in the environment win over the file and
+// flags win over both. A flag --db-host=mysql sets DB_HOST. Flags without a value, such as
+// --allow-destructive, are left to their command. The first positional argument is the
+// Command, the ones after it belong to the command.
+func Load(args []string) (*Loaded, error) {
+	loaded := &Loaded{sources: map[string]string{}}
+
+	flags := map[string]string{}
+	for _, arg := range args {
+		switch {
+		case arg == printFlag:
+			loaded.PrintConfig = true
+		case strings.HasPrefix(arg, fileFlag):
+			loaded.File = strings.TrimPrefix(arg, fileFlag)
+		case strings.HasPrefix(arg, "--") && strings.Contains(arg, "="):
+			name, value, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			flags[variableName(name)] = value
+		case !strings.HasPrefix(arg, "-") && loaded.Command == "":
+			loaded.Command = arg
+		}
+	}
+
+	if loaded.File == "" {
+		loaded.File = os.Getenv(FileVar)
+	}
+
+	if loaded.File != "" {
+		values, err := readFile(loaded.File)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range values {
+			if _, set := os.LookupEnv(key); set {
+				continue
+			}
+			if err := os.Setenv(key, value); err != nil {
+				return nil, err
+			}
+			loaded.sources[key] = SourceFile
+		}
+	}
+
+	for key, value := range flags {
+		if err := os.Setenv(key, value); err != nil {
+			return nil, err
+		}
+		loaded.sources[key] = SourceFlag
+	}
+
+	return loaded, nil
+}
+
+// Source says where the current value of the variable key came from
+func (loaded *Loaded) Source(key string) string {
+	if source, ok := loaded.sources[key]; ok {
+		return source
+	}
+	if _, ok := os.LookupEnv(key); ok {
+		return SourceEnv
+	}
+	return SourceDefault
+}
+
+// Print writes every setting the API read as KEY=value with its source, secrets redacted.
+// Call it once the config is built, env.Reads only knows the variables looked up so far.
+// Variables from the file or a flag that the API never read are listed last, they are
+// usually typos.
+func (loaded *Loaded) Print(writer io.Writer) error {
+	read := map[string]bool{}
+
+	for _, setting := range env.Reads() {
+		read[setting.Key] = true
+
+		value, ok := os.LookupEnv(setting.Key)
+		if !ok {
+			value = setting.Fallback
+		}
+
+		if _, err := fmt.Fprintf(writer, "%s=%s # %s\n", setting.Key, redact(setting.Key, value), loaded.Source(setting.Key)); err != nil {
+			return err
+		}
+	}
+
+	var unused []string
+	for key := range loaded.sources {
+		if !read[key] {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+
+	for _, key := range unused {
+		if _, err := fmt.Fprintf(writer, "# %s is set by %s but not used\n", key, loaded.sources[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readFile reads a YAML config file into variables. Nested keys are joined with an
+// underscore, so db: {host: mysql} sets DB_HOST, and lists are joined with commas.
+func readFile(path string) (map[string]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return nil, fmt.Errorf("unsupported config file %q, use .yaml or .yml", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var document map[string]any
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flatten("", document, values); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+func flatten(prefix string, node any, values map[string]string) error {
+	switch node := node.(type) {
+	case map[string]any:
+		for name, child := range node {
+			key := variableName(name)
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			if err := flatten(key, child, values); err != nil {
+				return err
+			}
+		}
+	case []any:
+		items := make([]string, 0, len(node))
+		for _, item := range node {
+			switch item.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("%s: lists may only hold plain values", prefix)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[prefix] = strings.Join(items, ",")
+	case nil:
+		values[prefix] = ""
+	default:
+		if prefix == "" {
+			return errors.New("the file must be a mapping of settings")
+		}
+		values[prefix] = fmt.Sprint(node)
+	}
+
+	return nil
+}
+
+// variableName turns a flag or YAML key such as db-host into DB_HOST
+func variableName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), "-", "_"))
+}
+
+func redact(key, value string) string {
+	if value != "" && configbackup.IsSecret(key) {
+		return "<redacted>"
+	}
+	return value
+}
@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestLoadCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no arguments", nil, ""},
+		{"command", []string{"doctor"}, "doctor"},
+		{"command after the settings", []string{"--addr=:8081", "--print-config", "doctor"}, "doctor"},
+		{"arguments after the command", []string{"doctor", "extra"}, "doctor"},
+		{"a setting whose value is a command name", []string{"--env=doctor"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(FileVar, "")
+			t.Setenv("ADDR", "")
+			t.Setenv("ENV", "")
+
+			loaded, err := Load(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Command != test.want {
+				t.Errorf("Command = %q, want %q", loaded.Command, test.want)
+			}
+		})
+	}
+}
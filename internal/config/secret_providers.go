@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// secretTimeout bounds one call to a secrets manager
+const secretTimeout = 10 * time.Second
+
+// awsSecretsManager reads SecretString values with the GetSecretValue API. Credentials
+// come from the default AWS chain, e.g. the instance or task role.
+type awsSecretsManager struct {
+	region      string
+	endpoint    string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	httpClient  *http.Client
+}
+
+func newAWSSecretsManager(ctx context.Context) (SecretProvider, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS credentials: %w", err)
+	}
+
+	region := os.Getenv("SECRETS_AWS_REGION")
+	if region == "" {
+		region = awsCfg.Region
+	}
+	if region == "" {
+		return nil, errors.New("aws-sm references need SECRETS_AWS_REGION or AWS_REGION")
+	}
+
+	return &awsSecretsManager{
+		region:      region,
+		endpoint:    fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region),
+		credentials: awsCfg.Credentials,
+		signer:      v4.NewSigner(),
+		httpClient:  &http.Client{Timeout: secretTimeout},
+	}, nil
+}
+
+func (manager *awsSecretsManager) Fetch(ctx context.Context, id string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, manager.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	credentials, err := manager.credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("retrieving AWS credentials: %w", err)
+	}
+
+	hash := sha256.Sum256(payload)
+	if err := manager.signer.SignHTTP(ctx, credentials, request, hex.EncodeToString(hash[:]), "secretsmanager", manager.region, time.Now()); err != nil {
+		return "", fmt.Errorf("signing request: %w", err)
+	}
+
+	body, err := doSecretRequest(manager.httpClient, request)
+	if err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("decoding response: %w", err)
+	}
+	if secret.SecretString == nil {
+		return "", errors.New("secret has no SecretString, binary secrets are not supported")
+	}
+
+	return *secret.SecretString, nil
+}
+
+// vault reads KV secrets from HashiCorp Vault with a token. The id is the API path, e.g.
+// secret/data/sandbox-api for a KV v2 mount. The secret is returned as a JSON object, so
+// references pick a key with #, vault://secret/data/sandbox-api#db_password.
+type vault struct {
+	addr       string
+	token      string
+	namespace  string
+	httpClient *http.Client
+}
+
+func newVault(_ context.Context) (SecretProvider, error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("vault references need VAULT_ADDR and VAULT_TOKEN")
+	}
+
+	return &vault{
+		addr:       addr,
+		token:      token,
+		namespace:  os.Getenv("VAULT_NAMESPACE"),
+		httpClient: &http.Client{Timeout: secretTimeout},
+	}, nil
+}
+
+func (vault *vault) Fetch(ctx context.Context, id string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, vault.addr+"/v1/"+strings.TrimPrefix(id, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("X-Vault-Token", vault.token)
+	if vault.namespace != "" {
+		request.Header.Set("X-Vault-Namespace", vault.namespace)
+	}
+
+	body, err := doSecretRequest(vault.httpClient, request)
+	if err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("decoding response: %w", err)
+	}
+
+	// KV v2 nests the values under data.data, next to data.metadata
+	if nested, ok := secret.Data["data"]; ok {
+		if _, hasMetadata := secret.Data["metadata"]; hasMetadata {
+			return string(nested), nil
+		}
+	}
+
+	values, err := json.Marshal(secret.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(values), nil
+}
+
+func doSecretRequest(client *http.Client, request *http.Request) ([]byte, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
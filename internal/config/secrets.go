@@ -0,0 +1,149 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"godsendjoseph.dev/sandbox-api/internal/configbackup"
+)
+
+// SourceSecret marks the settings resolved from a secret file or a secrets manager
+const SourceSecret = "secret"
+
+// fileSuffix is the Docker secrets convention, DB_PASSWORD_FILE holds the path of the
+// file with the value of DB_PASSWORD
+const fileSuffix = "_FILE"
+
+// SecretProvider fetches the secret a reference such as vault://secret/data/api points at.
+// The part after # picks a key out of a JSON secret and is handled by ResolveSecrets.
+type SecretProvider interface {
+	Fetch(ctx context.Context, id string) (string, error)
+}
+
+var (
+	providersMu sync.Mutex
+	// providers are built on first use, so their settings are only needed when referenced
+	providers = map[string]func(ctx context.Context) (SecretProvider, error){
+		"aws-sm": newAWSSecretsManager,
+		"vault":  newVault,
+	}
+)
+
+// RegisterSecretProvider makes references with scheme resolve through the provider that
+// newProvider builds
+func RegisterSecretProvider(scheme string, newProvider func(ctx context.Context) (SecretProvider, error)) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[scheme] = newProvider
+}
+
+// ResolveSecrets replaces the secret settings (see configbackup.IsSecret) that point at a
+// secret with its value, before any client is built. A setting is resolved from
+//   - NAME_FILE, the path of a file holding the value, as Docker and Kubernetes mount them
+//   - a reference scheme://id or scheme://id#key, e.g. aws-sm://prod/api#db_password
+//
+// Files are read first, so a provider's own token can come from a file. Any secret that
+// cannot be resolved is an error, the API must not start with a reference as its password.
+func (loaded *Loaded) ResolveSecrets(ctx context.Context) error {
+	for _, entry := range os.Environ() {
+		key, path, _ := strings.Cut(entry, "=")
+		name, isFile := strings.CutSuffix(key, fileSuffix)
+		if !isFile || !configbackup.IsSecret(name) {
+			continue
+		}
+
+		if _, set := os.LookupEnv(name); set {
+			return fmt.Errorf("both %s and %s are set, keep one", name, key)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+		if err := loaded.setSecret(name, strings.TrimRight(string(content), "\r\n")); err != nil {
+			return err
+		}
+	}
+
+	fetched := map[string]string{}
+	built := map[string]SecretProvider{}
+
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if !configbackup.IsSecret(key) {
+			continue
+		}
+
+		scheme, ref, isRef := strings.Cut(value, "://")
+		providersMu.Lock()
+		newProvider, known := providers[scheme]
+		providersMu.Unlock()
+		if !isRef || !known {
+			continue
+		}
+
+		provider, ok := built[scheme]
+		if !ok {
+			var err error
+			if provider, err = newProvider(ctx); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			built[scheme] = provider
+		}
+
+		id, field, _ := strings.Cut(ref, "#")
+
+		secret, ok := fetched[scheme+"://"+id]
+		if !ok {
+			var err error
+			if secret, err = provider.Fetch(ctx, id); err != nil {
+				return fmt.Errorf("%s: fetching %s://%s: %w", key, scheme, id, err)
+			}
+			fetched[scheme+"://"+id] = secret
+		}
+
+		if field != "" {
+			var err error
+			if secret, err = secretField(secret, field); err != nil {
+				return fmt.Errorf("%s: %s://%s: %w", key, scheme, id, err)
+			}
+		}
+
+		if err := loaded.setSecret(key, secret); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (loaded *Loaded) setSecret(key, value string) error {
+	if err := os.Setenv(key, value); err != nil {
+		return err
+	}
+	loaded.sources[key] = SourceSecret
+	return nil
+}
+
+// secretField picks field out of a secret holding a JSON object
+func secretField(secret, field string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, cannot pick %q", field)
+	}
+
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no %q", field)
+	}
+
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,275 @@
+// Package configbackup keeps versioned copies of the runtime configuration in object storage.
+// Each version is a readable manifest with the secrets redacted, next to the full
+// configuration encrypted with a key that lives outside the bucket.
+package configbackup
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/storage"
+)
+
+// Prefix is where the versions live in the bucket
+const Prefix = "backups/config/"
+
+// versionFormat sorts lexically in time order, so the last listed version is the newest
+const versionFormat = "20060102T150405Z"
+
+const (
+	manifestFile = "manifest.json"
+	secretsFile  = "secrets.enc"
+)
+
+// secretMarkers flag the keys whose values are redacted in the manifest
+var secretMarkers = []string{"PASSWORD", "SECRET", "TOKEN", "KEY", "WEBHOOK", "DSN", "CREDENTIAL"}
+
+var ErrNoBackups = errors.New("no configuration backups found")
+
+// Manifest is the readable half of a version. Redacted values are replaced by a short
+// fingerprint, so two versions show which secrets changed without revealing them.
+type Manifest struct {
+	Version   string            `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+	Source    string            `json:"source"`
+	Note      string            `json:"note,omitempty"`
+	Values    map[string]string `json:"values"`
+	Redacted  []string          `json:"redacted"`
+}
+
+// GenerateKey returns a new base64 encoded AES-256 key
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Backup uploads values as a new version and returns its manifest
+func Backup(ctx context.Context, client storage.Client, encodedKey string, values map[string]string, source, note string, now time.Time) (*Manifest, error) {
+	key, err := decodeKey(encodedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	version := now.UTC().Format(versionFormat)
+
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(key, plain, version)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Version:   version,
+		CreatedAt: now.UTC(),
+		Source:    source,
+		Note:      note,
+		Values:    make(map[string]string, len(values)),
+		Redacted:  []string{},
+	}
+	for name, value := range values {
+		if IsSecret(name) {
+			manifest.Values[name] = fingerprint(key, value)
+			manifest.Redacted = append(manifest.Redacted, name)
+			continue
+		}
+		manifest.Values[name] = value
+	}
+	sort.Strings(manifest.Redacted)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	// the secrets go first, a manifest without them would list a version that cannot be restored
+	if err := upload(ctx, client, version, secretsFile, sealed, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+	if err := upload(ctx, client, version, manifestFile, manifestJSON, "application/json"); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Restore decrypts the values of version, "latest" or empty picks the newest one
+func Restore(ctx context.Context, client storage.Client, encodedKey, version string) (map[string]string, *Manifest, error) {
+	key, err := decodeKey(encodedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if version == "" || version == "latest" {
+		versions, err := Versions(ctx, client)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(versions) == 0 {
+			return nil, nil, ErrNoBackups
+		}
+		version = versions[len(versions)-1]
+	}
+
+	manifest, err := ReadManifest(ctx, client, version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed, err := download(ctx, client, version, secretsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plain, err := open(key, sealed, version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]string{}
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, nil, err
+	}
+
+	return values, manifest, nil
+}
+
+// Versions lists the complete versions, oldest first
+func Versions(ctx context.Context, client storage.Client) ([]string, error) {
+	keys, err := client.ListFiles(ctx, Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, key := range keys {
+		version, file, ok := strings.Cut(strings.TrimPrefix(key, Prefix), "/")
+		if ok && file == manifestFile {
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+
+	return versions, nil
+}
+
+// ReadManifest loads the readable half of version
+func ReadManifest(ctx context.Context, client storage.Client, version string) (*Manifest, error) {
+	data, err := download(ctx, client, version, manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("version %s has an invalid manifest: %w", version, err)
+	}
+
+	return manifest, nil
+}
+
+// IsSecret reports whether the value of the variable name is redacted in the manifest
+func IsSecret(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, marker := range secretMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// fingerprint is keyed, a plain hash of a short password could be reversed by brute force
+func fingerprint(key []byte, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return "redacted:" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("the backup key must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// seal encrypts with AES-256-GCM. The version is authenticated as well, so a bundle
+// copied under another version fails to decrypt instead of restoring the wrong config.
+func seal(key, plain []byte, version string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plain, []byte(version)), nil
+}
+
+func open(key, sealed []byte, version string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted bundle is truncated")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(version))
+	if err != nil {
+		return nil, errors.New("could not decrypt the bundle, wrong key or tampered backup")
+	}
+
+	return plain, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func upload(ctx context.Context, client storage.Client, version, file string, data []byte, contentType string) error {
+	return client.UploadPrivateFile(ctx, Prefix+version+"/"+file, bytes.NewReader(data), contentType, int64(len(data)))
+}
+
+func download(ctx context.Context, client storage.Client, version, file string) ([]byte, error) {
+	body, err := client.DownloadFile(ctx, Prefix+version+"/"+file)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
@@ -2,22 +2,40 @@
 package cron
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	"go.uber.org/zap"
 
+	"godsendjoseph.dev/sandbox-api/internal/db"
 	"godsendjoseph.dev/sandbox-api/internal/mailer"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/storage"
+	"godsendjoseph.dev/sandbox-api/internal/store"
 )
 
 // JobManager holds all available cron jobs
 type JobManager struct {
-	logger *zap.SugaredLogger
-	mailer mailer.Client
+	logger        *zap.SugaredLogger
+	mailer        mailer.Client
+	store         store.Storage
+	storageClient storage.Client
 }
 
 // NewJobManager creates a new job manager
-func NewJobManager(logger *zap.SugaredLogger, mailer mailer.Client) *JobManager {
+func NewJobManager(logger *zap.SugaredLogger, mailer mailer.Client, store store.Storage, storageClient storage.Client) *JobManager {
 	return &JobManager{
-		logger: logger,
-		mailer: mailer,
+		logger:        logger,
+		mailer:        mailer,
+		store:         store,
+		storageClient: storageClient,
 	}
 }
 
@@ -42,3 +60,530 @@ func (j *JobManager) SendTestEmail(isProdEnv string) func() {
 
 	}
 }
+
+// PurgeDeletedAccounts hard deletes accounts whose deletion grace period is over, along with their uploads
+func (j *JobManager) PurgeDeletedAccounts() func() {
+	return func() {
+		ctx := context.Background()
+		cutoff := time.Now().Add(-store.DeletedAccountGracePeriod)
+
+		userIDs, err := j.store.Users.ListDeletedBefore(ctx, cutoff)
+		if err != nil {
+			j.logger.Errorw("error listing deleted accounts", "error", err)
+			return
+		}
+
+		for _, userID := range userIDs {
+			// remove the files first so a failure leaves the account around to retry on the next run
+			if j.storageClient != nil {
+				if err := j.storageClient.DeleteFolder(ctx, storage.UserFolder(userID)); err != nil {
+					j.logger.Errorw("error deleting account uploads", "userID", userID, "error", err)
+					continue
+				}
+			}
+
+			if err := j.store.Users.Delete(ctx, userID); err != nil {
+				j.logger.Errorw("error purging account", "userID", userID, "error", err)
+				continue
+			}
+
+			j.logger.Infow("purged deleted account", "userID", userID)
+		}
+	}
+}
+
+// ClearExpiredOTPs blanks the OTP codes nobody used before they expired. Access and reset
+// tokens are stateless JWTs and OTPs, there is no token table to purge.
+func (j *JobManager) ClearExpiredOTPs() func() {
+	return func() {
+		cleared, err := j.store.Users.ClearExpiredOTPs(context.Background())
+		if err != nil {
+			j.logger.Errorw("error clearing expired OTPs", "error", err)
+			return
+		}
+
+		j.logger.Infow("expired OTPs cleared", "cleared", cleared)
+	}
+}
+
+// UnverifiedAccountPolicy configures RemindUnverifiedAccounts
+type UnverifiedAccountPolicy struct {
+	// RemindAfter is how old an unverified account gets before its one reminder
+	RemindAfter time.Duration
+	// DeleteAfter is how old an unverified account gets before it is deleted, 0 keeps them
+	DeleteAfter time.Duration
+	// OTPExpiry is how long the code in the reminder stays valid
+	OTPExpiry time.Duration
+	IsSandbox bool
+}
+
+// reminderBatchSize caps the reminders of one run, the rest go out on the next runs
+const reminderBatchSize = 500
+
+// RemindUnverifiedAccounts deletes the accounts that stayed unverified for longer than
+// policy.DeleteAfter, then emails a fresh OTP to the ones unverified after policy.RemindAfter
+func (j *JobManager) RemindUnverifiedAccounts(policy UnverifiedAccountPolicy) func() {
+	return func() {
+		ctx := context.Background()
+		now := time.Now()
+
+		if policy.DeleteAfter > 0 {
+			userIDs, err := j.store.Users.ListUnverifiedBefore(ctx, now.Add(-policy.DeleteAfter))
+			if err != nil {
+				j.logger.Errorw("error listing unverified accounts", "error", err)
+				return
+			}
+
+			for _, userID := range userIDs {
+				if err := j.store.Users.Delete(ctx, userID); err != nil {
+					j.logger.Errorw("error deleting unverified account", "userID", userID, "error", err)
+					continue
+				}
+				j.logger.Infow("deleted unverified account", "userID", userID)
+			}
+		}
+
+		users, err := j.store.Users.ListUnremindedBefore(ctx, now.Add(-policy.RemindAfter), reminderBatchSize)
+		if err != nil {
+			j.logger.Errorw("error listing accounts to remind", "error", err)
+			return
+		}
+
+		reminded := 0
+		for _, user := range users {
+			err := j.remindUnverifiedAccount(ctx, user, policy)
+			if errors.Is(err, mailer.ErrOptedOut) {
+				continue
+			}
+			if err != nil {
+				j.logger.Errorw("error reminding unverified account", "userID", user.ID, "error", err)
+				continue
+			}
+			reminded++
+		}
+
+		j.logger.Infow("unverified account reminders sent", "reminded", reminded, "due", len(users))
+	}
+}
+
+func (j *JobManager) remindUnverifiedAccount(ctx context.Context, user *models.User, policy UnverifiedAccountPolicy) error {
+	otpCode, err := models.GenerateOTP()
+	if err != nil {
+		return err
+	}
+	otpExp := time.Now().Add(policy.OTPExpiry)
+
+	// the code is stored first, a reminder whose code does not work is worse than none
+	if err := j.store.Users.RemindVerification(ctx, user, otpCode, otpExp.Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	subject := "Verify your email to keep your account"
+	vars := struct {
+		Username string
+		OtpCode  string
+		OTPExp   string
+		DeleteAt string
+		Subject  string
+	}{
+		Username: user.Username,
+		OtpCode:  otpCode,
+		OTPExp:   otpExp.UTC().Format(time.RFC1123),
+		Subject:  subject,
+	}
+	if createdAt, err := time.Parse(time.RFC3339, user.CreatedAt); err == nil && policy.DeleteAfter > 0 {
+		vars.DeleteAt = createdAt.Add(policy.DeleteAfter).UTC().Format(time.RFC1123)
+	}
+
+	return j.mailer.SendWithOptions(
+		mailer.VerificationReminderTemplate,
+		user.Username,
+		user.Email,
+		subject,
+		vars,
+		mailer.AsyncInMemory,
+		policy.IsSandbox,
+	)
+}
+
+// SendEmailCampaigns hands up to perRun pending campaign recipients to the mail queue,
+// which throttles campaigns to perRun emails per run. A full queue leaves the rest for the
+// next run.
+func (j *JobManager) SendEmailCampaigns(perRun int, isSandbox bool) func() {
+	return func() {
+		ctx := context.Background()
+
+		recipients, err := j.store.EmailCampaigns.ListPending(ctx, perRun)
+		if err != nil {
+			j.logger.Errorw("error listing campaign recipients", "error", err)
+			return
+		}
+
+		campaigns := map[int64]*models.EmailCampaign{}
+		queued := 0
+		for _, recipient := range recipients {
+			campaign, ok := campaigns[recipient.CampaignID]
+			if !ok {
+				campaign, err = j.store.EmailCampaigns.GetByID(ctx, recipient.CampaignID)
+				if err != nil {
+					j.logger.Errorw("error loading campaign", "campaignID", recipient.CampaignID, "error", err)
+					return
+				}
+				campaigns[campaign.ID] = campaign
+			}
+
+			vars := struct {
+				Username string
+				Subject  string
+				Message  string
+			}{
+				Username: recipient.Username,
+				Subject:  campaign.Subject,
+				Message:  campaign.Message,
+			}
+
+			err := j.mailer.SendWithOptions(
+				campaign.Template,
+				recipient.Username,
+				recipient.Email,
+				campaign.Subject,
+				vars,
+				mailer.AsyncInMemory,
+				isSandbox,
+			)
+			if errors.Is(err, mailer.ErrQueueFull) {
+				j.logger.Warnw("mail queue is full, campaign recipients left for the next run", "queued", queued, "due", len(recipients))
+				break
+			}
+
+			status, lastError := models.RecipientQueued, ""
+			switch {
+			case errors.Is(err, mailer.ErrOptedOut):
+				status = models.RecipientOptedOut
+			case err != nil:
+				status, lastError = models.RecipientFailed, err.Error()
+			}
+			if err := j.store.EmailCampaigns.MarkRecipient(ctx, recipient.ID, status, lastError); err != nil {
+				j.logger.Errorw("error recording campaign recipient", "recipientID", recipient.ID, "error", err)
+				continue
+			}
+			if status == models.RecipientQueued {
+				queued++
+			}
+		}
+
+		completed, err := j.store.EmailCampaigns.CompleteFinished(ctx)
+		if err != nil {
+			j.logger.Errorw("error completing campaigns", "error", err)
+			return
+		}
+
+		if len(recipients) > 0 || completed > 0 {
+			j.logger.Infow("campaign emails queued", "queued", queued, "due", len(recipients), "completed", completed)
+		}
+	}
+}
+
+// DispatchScheduledEmails hands up to perRun emails whose time has come to the mail queue
+// and deletes them. A full queue leaves the rest for the next run.
+func (j *JobManager) DispatchScheduledEmails(perRun int) func() {
+	return func() {
+		ctx := context.Background()
+
+		emails, err := j.store.ScheduledEmails.ListDue(ctx, time.Now().UTC(), perRun)
+		if err != nil {
+			j.logger.Errorw("error listing scheduled emails", "error", err)
+			return
+		}
+
+		queued := 0
+		for _, email := range emails {
+			// numbers stay json.Number, as in the jobs the queue decodes
+			var data any
+			decoder := json.NewDecoder(bytes.NewReader(email.Data))
+			decoder.UseNumber()
+			err := decoder.Decode(&data)
+			if err == nil {
+				err = j.mailer.SendWithOptions(
+					email.Template,
+					email.Username,
+					email.Email,
+					email.Subject,
+					data,
+					mailer.AsyncInMemory,
+					email.IsSandbox,
+				)
+			}
+			if errors.Is(err, mailer.ErrQueueFull) {
+				j.logger.Warnw("mail queue is full, scheduled emails left for the next run", "queued", queued, "due", len(emails))
+				break
+			}
+			switch {
+			case errors.Is(err, mailer.ErrOptedOut):
+				j.logger.Infow("scheduled email skipped, the recipient opted out", "scheduledEmailID", email.ID, "template", email.Template)
+			case err != nil:
+				j.logger.Errorw("error queueing scheduled email, dropping it", "scheduledEmailID", email.ID, "error", err)
+			default:
+				queued++
+			}
+
+			if err := j.store.ScheduledEmails.Delete(ctx, email.ID); err != nil {
+				j.logger.Errorw("error deleting scheduled email", "scheduledEmailID", email.ID, "error", err)
+			}
+		}
+
+		if len(emails) > 0 {
+			j.logger.Infow("scheduled emails queued", "queued", queued, "due", len(emails))
+		}
+	}
+}
+
+// digestPeriod is how far back a digest looks, the job runs once per period
+const digestPeriod = 7 * 24 * time.Hour
+
+// SendWeeklyDigests emails every verified user who did not opt out a summary of their week,
+// reading batchSize users at a time. Users with a quiet week get nothing. The emails are
+// scheduled a minute out, so the dispatch-scheduled-emails job feeds them to the queue at its
+// own pace instead of filling it at once.
+func (j *JobManager) SendWeeklyDigests(batchSize int, isSandbox bool) func() {
+	return func() {
+		ctx := context.Background()
+		end := time.Now().UTC()
+		start := end.Add(-digestPeriod)
+		sendAt := end.Add(time.Minute)
+
+		var afterID int64
+		sent, quiet := 0, 0
+		for {
+			activities, err := j.store.Digests.ListActivity(ctx, start, mailer.CategoryDigest, afterID, batchSize)
+			if err != nil {
+				j.logger.Errorw("error listing weekly activity", "afterID", afterID, "error", err)
+				return
+			}
+
+			for _, activity := range activities {
+				afterID = activity.UserID
+				if activity.Quiet() {
+					quiet++
+					continue
+				}
+
+				vars := struct {
+					Username     string
+					Subject      string
+					PeriodStart  string
+					PeriodEnd    string
+					NewFollowers int64
+					NewPosts     int64
+					Followers    int64
+					Posts        int64
+				}{
+					Username:     activity.Username,
+					Subject:      "Your week in review",
+					PeriodStart:  start.Format("Jan 2"),
+					PeriodEnd:    end.Format("Jan 2, 2006"),
+					NewFollowers: activity.NewFollowers,
+					NewPosts:     activity.NewPosts,
+					Followers:    activity.Followers,
+					Posts:        activity.Posts,
+				}
+
+				err := j.mailer.SendAt(sendAt, mailer.WeeklyDigestTemplate, activity.Username, activity.Email, vars.Subject, vars, isSandbox)
+				switch {
+				case errors.Is(err, mailer.ErrOptedOut):
+					quiet++
+				case err != nil:
+					j.logger.Errorw("error scheduling weekly digest", "userID", activity.UserID, "error", err)
+				default:
+					sent++
+				}
+			}
+
+			if len(activities) < batchSize {
+				break
+			}
+		}
+
+		j.logger.Infow("weekly digests scheduled", "scheduled", sent, "skipped", quiet)
+	}
+}
+
+// orphanGracePeriod spares objects and pending rows that are younger, an upload is stored
+// before its row is written and a presigned URL stays valid for a while after it is issued
+const orphanGracePeriod = time.Hour
+
+// CleanupOrphanedFiles deletes uploads that have no row in the files table and settles the
+// pending presigned uploads, activating those that arrived and dropping those that never did.
+// With dryRun the orphans are only logged, uploads from before the files table have no row.
+func (j *JobManager) CleanupOrphanedFiles(dryRun bool) func() {
+	return func() {
+		if j.storageClient == nil {
+			return
+		}
+
+		ctx := context.Background()
+		cutoff := time.Now().Add(-orphanGracePeriod)
+
+		objects := map[string]storage.ObjectInfo{}
+		for _, prefix := range storage.UploadPrefixes {
+			list, err := j.storageClient.ListObjects(ctx, prefix)
+			if err != nil {
+				j.logger.Errorw("error listing uploads", "prefix", prefix, "error", err)
+				return
+			}
+			for _, object := range list {
+				objects[object.Key] = object
+			}
+		}
+
+		keys := make([]string, 0, len(objects))
+		for key := range objects {
+			keys = append(keys, key)
+		}
+
+		tracked, err := j.store.Files.ExistingKeys(ctx, keys)
+		if err != nil {
+			j.logger.Errorw("error looking up tracked files", "error", err)
+			return
+		}
+
+		deleted := 0
+		for key, object := range objects {
+			if tracked[key] || object.LastModified.After(cutoff) {
+				continue
+			}
+
+			if dryRun {
+				j.logger.Infow("would delete orphaned file", "key", key, "size", object.Size, "lastModified", object.LastModified)
+				deleted++
+				continue
+			}
+
+			if err := j.storageClient.DeleteFile(ctx, key); err != nil {
+				j.logger.Errorw("error deleting orphaned file", "key", key, "error", err)
+				continue
+			}
+			deleted++
+		}
+
+		pending, err := j.store.Files.ListPendingBefore(ctx, cutoff)
+		if err != nil {
+			j.logger.Errorw("error listing pending uploads", "error", err)
+			return
+		}
+
+		activated, abandoned := 0, 0
+		for _, file := range pending {
+			if object, ok := objects[file.Key]; ok {
+				if err := j.store.Files.MarkActive(ctx, file.Key, object.Size); err != nil {
+					j.logger.Errorw("error activating upload", "key", file.Key, "error", err)
+					continue
+				}
+				activated++
+				continue
+			}
+
+			if err := j.store.Files.DeleteByKey(ctx, file.Key); err != nil {
+				j.logger.Errorw("error dropping abandoned upload", "key", file.Key, "error", err)
+				continue
+			}
+			abandoned++
+		}
+
+		j.logger.Infow("orphaned file cleanup complete", "objects", len(objects), "orphaned", deleted, "dryRun", dryRun, "activated", activated, "abandoned", abandoned)
+	}
+}
+
+// AnalyticsSnapshotPrefix holds one folder per snapshot, <version>/<table>.jsonl.gz and a
+// manifest.json that is written last, so a folder without it is an interrupted run
+const AnalyticsSnapshotPrefix = "snapshots/analytics/"
+
+// AnalyticsSnapshotManifest lists what a snapshot contains
+type AnalyticsSnapshotManifest struct {
+	Version   string         `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Format    string         `json:"format"`
+	Tables    map[string]int `json:"tables"`
+}
+
+// ExportAnalyticsSnapshot uploads an anonymized export of the core tables and removes
+// all but the newest keep snapshots
+func (j *JobManager) ExportAnalyticsSnapshot(database *sql.DB, salt string, keep int) func() {
+	return func() {
+		if j.storageClient == nil {
+			j.logger.Warn("skipping analytics snapshot, object storage is disabled")
+			return
+		}
+
+		ctx := context.Background()
+		started := time.Now().UTC()
+		version := started.Format("20060102T150405Z")
+		folder := AnalyticsSnapshotPrefix + version + "/"
+
+		manifest := AnalyticsSnapshotManifest{
+			Version:   version,
+			CreatedAt: started,
+			Format:    "gzipped JSON lines",
+			Tables:    map[string]int{},
+		}
+
+		err := db.ExportAnonymized(ctx, database, salt, func(table string, rows int, data []byte) error {
+			manifest.Tables[table] = rows
+			return j.storageClient.UploadPrivateFile(ctx, folder+table+".jsonl.gz", bytes.NewReader(data), "application/gzip", int64(len(data)))
+		})
+		if err != nil {
+			j.logger.Errorw("error exporting analytics snapshot", "version", version, "error", err)
+			return
+		}
+
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			j.logger.Errorw("error encoding analytics snapshot manifest", "version", version, "error", err)
+			return
+		}
+
+		if err := j.storageClient.UploadPrivateFile(ctx, folder+"manifest.json", bytes.NewReader(data), "application/json", int64(len(data))); err != nil {
+			j.logger.Errorw("error uploading analytics snapshot manifest", "version", version, "error", err)
+			return
+		}
+
+		j.logger.Infow("analytics snapshot exported", "version", version, "tables", manifest.Tables, "duration", time.Since(started).Round(time.Millisecond))
+
+		if err := j.pruneAnalyticsSnapshots(ctx, keep); err != nil {
+			j.logger.Errorw("error pruning analytics snapshots", "error", err)
+		}
+	}
+}
+
+// pruneAnalyticsSnapshots deletes the snapshot folders older than the newest keep
+func (j *JobManager) pruneAnalyticsSnapshots(ctx context.Context, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	keys, err := j.storageClient.ListFiles(ctx, AnalyticsSnapshotPrefix)
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	versions := []string{}
+	for _, key := range keys {
+		version, _, ok := strings.Cut(strings.TrimPrefix(key, AnalyticsSnapshotPrefix), "/")
+		if ok && !seen[version] {
+			seen[version] = true
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+
+	for len(versions) > keep {
+		if err := j.storageClient.DeleteFolder(ctx, AnalyticsSnapshotPrefix+versions[0]+"/"); err != nil {
+			return fmt.Errorf("deleting snapshot %s: %w", versions[0], err)
+		}
+		j.logger.Infow("deleted old analytics snapshot", "version", versions[0])
+		versions = versions[1:]
+	}
+
+	return nil
+}
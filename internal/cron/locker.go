@@ -0,0 +1,61 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Lockers picked with CRON_LOCKER, none runs every job on every instance
+const (
+	LockerRedis = "redis"
+	LockerDB    = "db"
+	LockerNone  = "none"
+)
+
+// redisLockTTL keeps a claimed run around long enough for every instance to see it
+const redisLockTTL = time.Hour
+
+// Locker claims one run of a job. Instances sharing a Locker run every job once per
+// scheduled time, whichever claims it first.
+type Locker interface {
+	// Claim returns false when another instance already claimed the run of job at runAt
+	Claim(ctx context.Context, job string, runAt time.Time) (bool, error)
+}
+
+// RunClaimer records claimed runs in the database, store.CronRunStore implements it
+type RunClaimer interface {
+	Claim(ctx context.Context, job string, runAt time.Time, instance string) (bool, error)
+}
+
+// RedisLocker claims a run with SET NX. The key is never released early, so an instance
+// whose clock is a little behind cannot claim the same run after the first one finished.
+type RedisLocker struct {
+	rdb      *redis.Client
+	instance string
+}
+
+func NewRedisLocker(rdb *redis.Client, instance string) *RedisLocker {
+	return &RedisLocker{rdb: rdb, instance: instance}
+}
+
+func (locker *RedisLocker) Claim(ctx context.Context, job string, runAt time.Time) (bool, error) {
+	key := fmt.Sprintf("cron-lock-%s-%d", job, runAt.Unix())
+	return locker.rdb.SetNX(ctx, key, locker.instance, redisLockTTL).Result()
+}
+
+// DBLocker claims a run by inserting it, the primary key rejects the other instances
+type DBLocker struct {
+	runs     RunClaimer
+	instance string
+}
+
+func NewDBLocker(runs RunClaimer, instance string) *DBLocker {
+	return &DBLocker{runs: runs, instance: instance}
+}
+
+func (locker *DBLocker) Claim(ctx context.Context, job string, runAt time.Time) (bool, error) {
+	return locker.runs.Claim(ctx, job, runAt, locker.instance)
+}
@@ -2,18 +2,27 @@
 package cron
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
+	"github.com/google/uuid"
+	robfigcron "github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 )
 
-// Scheduler represents the application's scheduler service
+// Scheduler represents the application's scheduler service. Jobs can be added, removed
+// and configured at any time, the mutex guards jobs and started.
 type Scheduler struct {
+	sync.Mutex
 	scheduler gocron.Scheduler
 	logger    *zap.SugaredLogger
 	jobs      []Job
+	started   bool
+	// locker makes the jobs that are not PerInstance run on one instance only
+	locker Locker
 }
 
 // Job represents a scheduled job
@@ -21,7 +30,30 @@ type Job struct {
 	Name     string
 	Schedule string
 	Task     func()
-	JobID    string
+	// JobID is assigned when the job is added and stays the same when it is rescheduled
+	JobID string
+	// Disabled jobs stay registered but are not scheduled
+	Disabled bool
+	// PerInstance jobs run on every instance, for work on the instance's own state.
+	// The others run once per scheduled time across all instances when a Locker is set.
+	PerInstance bool
+	// scheduled is true while gocron holds the job
+	scheduled bool
+}
+
+// JobConfig overrides the schedule of a job registered in code
+type JobConfig struct {
+	Name     string
+	Schedule string
+	Enabled  bool
+}
+
+// ValidateSchedule checks a standard 5 field cron expression
+func ValidateSchedule(schedule string) error {
+	if _, err := robfigcron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", schedule, err)
+	}
+	return nil
 }
 
 // NewScheduler creates a new scheduler with the given timezone
@@ -49,10 +81,21 @@ func NewScheduler(logger *zap.SugaredLogger, timezone string) *Scheduler {
 	}
 }
 
+// SetLocker shares the jobs with the other instances using locker, call it before Start
+func (s *Scheduler) SetLocker(locker Locker) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.locker = locker
+}
+
 // Start begins the scheduler
 func (s *Scheduler) Start() {
+	s.Lock()
 	// Register all jobs first
 	s.RegisterJobs()
+	s.started = true
+	s.Unlock()
 
 	// Start the scheduler
 	s.scheduler.Start()
@@ -61,88 +104,268 @@ func (s *Scheduler) Start() {
 
 // Stop halts the scheduler
 func (s *Scheduler) Stop() {
+	s.Lock()
+	s.started = false
+	s.Unlock()
+
 	// Shutdown the scheduler
 	s.scheduler.Shutdown()
 	s.logger.Info("Scheduler stopped")
 }
 
-// RegisterJobs adds all jobs to the scheduler
+// RegisterJobs adds all jobs to the scheduler, callers must hold the lock
 func (s *Scheduler) RegisterJobs() {
-	for i, job := range s.jobs {
-		s.logger.Infof("Registering job: %s with schedule %s", job.Name, job.Schedule)
+	for i := range s.jobs {
+		if err := s.register(i); err != nil {
+			s.logger.Errorf("Failed to schedule job %s: %v", s.jobs[i].Name, err)
+		}
+	}
+}
 
-		// Create a wrapped task that includes logging
-		task := func() {
-			s.logger.Infof("Executing job: %s", job.Name)
-			startTime := time.Now()
+// register hands the job to gocron, callers must hold the lock
+func (s *Scheduler) register(i int) error {
+	job := s.jobs[i]
+	if job.Disabled {
+		s.logger.Infof("Skipping disabled job: %s", job.Name)
+		return nil
+	}
 
-			defer func() {
-				if r := recover(); r != nil {
-					s.logger.Errorf("Job %s panicked: %v", job.Name, r)
-				}
-			}()
+	id, err := uuid.Parse(job.JobID)
+	if err != nil {
+		return err
+	}
 
-			job.Task()
+	s.logger.Infof("Registering job: %s with schedule %s", job.Name, job.Schedule)
 
-			s.logger.Infof("Job %s completed in %v", job.Name, time.Since(startTime))
+	locker := s.locker
+	if job.PerInstance {
+		locker = nil
+	}
+
+	// Create a wrapped task that includes logging
+	task := func() {
+		if locker != nil && !s.claim(locker, job.Name) {
+			return
 		}
 
-		// Schedule based on the provided cron expression
-		j, err := s.scheduler.NewJob(
-			gocron.CronJob(
-				job.Schedule,
-				false, // Don't use seconds field
-			),
-			gocron.NewTask(
-				task,
-			),
-			gocron.WithName(job.Name),
-		)
-
-		if err != nil {
-			s.logger.Errorf("Failed to schedule job %s: %v", job.Name, err)
+		s.logger.Infof("Executing job: %s", job.Name)
+		startTime := time.Now()
+
+		defer func() {
+			if r := recover(); r != nil {
+				s.logger.Errorf("Job %s panicked: %v", job.Name, r)
+			}
+		}()
+
+		job.Task()
+
+		s.logger.Infof("Job %s completed in %v", job.Name, time.Since(startTime))
+	}
+
+	// Schedule based on the provided cron expression
+	_, err = s.scheduler.NewJob(
+		gocron.CronJob(
+			job.Schedule,
+			false, // Don't use seconds field
+		),
+		gocron.NewTask(
+			task,
+		),
+		gocron.WithName(job.Name),
+		gocron.WithIdentifier(id),
+	)
+	if err != nil {
+		return err
+	}
+
+	s.jobs[i].scheduled = true
+	return nil
+}
+
+// claim asks locker for the current run of job. Runs are identified by their minute,
+// the finest a cron expression gets, so instances agree on it despite small clock skew.
+// When the locker fails the run is skipped, a missed run is easier to recover from than
+// emails sent twice.
+func (s *Scheduler) claim(locker Locker, name string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	runAt := time.Now().UTC().Truncate(time.Minute)
+
+	claimed, err := locker.Claim(ctx, name, runAt)
+	if err != nil {
+		s.logger.Errorf("Skipping job %s, could not claim the run at %s: %v", name, runAt.Format(time.RFC3339), err)
+		return false
+	}
+	if !claimed {
+		s.logger.Debugf("Skipping job %s, the run at %s is claimed by another instance", name, runAt.Format(time.RFC3339))
+	}
+
+	return claimed
+}
+
+// unregister removes the job from gocron, callers must hold the lock
+func (s *Scheduler) unregister(i int) error {
+	job := s.jobs[i]
+	if !s.started || !job.scheduled {
+		return nil
+	}
+
+	id, err := uuid.Parse(job.JobID)
+	if err == nil {
+		err = s.scheduler.RemoveJob(id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unschedule job %s: %w", job.Name, err)
+	}
+
+	s.jobs[i].scheduled = false
+	return nil
+}
+
+// Configure changes the schedule of a job or disables it. Before Start it only
+// records the change, afterwards the job is rescheduled right away.
+func (s *Scheduler) Configure(config JobConfig) error {
+	if err := ValidateSchedule(config.Schedule); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for i, job := range s.jobs {
+		if job.Name != config.Name {
 			continue
 		}
 
-		// Store the job ID as string
-		s.jobs[i].JobID = j.ID().String()
+		if job.Schedule == config.Schedule && job.Disabled == !config.Enabled {
+			return nil
+		}
+
+		if err := s.unregister(i); err != nil {
+			return err
+		}
+
+		s.jobs[i].Schedule = config.Schedule
+		s.jobs[i].Disabled = !config.Enabled
+		s.logger.Infof("Job %s configured with schedule %s (enabled: %t)", job.Name, config.Schedule, config.Enabled)
+
+		if s.started {
+			return s.register(i)
+		}
+		return nil
 	}
+
+	return fmt.Errorf("job not found: %s", config.Name)
 }
 
-// AddJob adds a new job to the scheduler
-func (s *Scheduler) AddJob(name string, schedule string, task func()) {
-	s.jobs = append(s.jobs, Job{
+// AddJob adds a new job to the scheduler and returns its ID. Once the scheduler is running
+// the job is scheduled right away. Names are unique, a second job with a taken name is
+// rejected, as is an invalid schedule. Cancel the job with RemoveJob or RemoveJobByID.
+func (s *Scheduler) AddJob(name string, schedule string, task func()) (string, error) {
+	return s.add(Job{
 		Name:     name,
 		Schedule: schedule,
 		Task:     task,
 	})
 }
 
+// PerInstance adds a job that runs on every instance, even when a Locker is set
+func (s *Scheduler) PerInstance(name string, schedule string, task func()) (string, error) {
+	return s.add(Job{
+		Name:        name,
+		Schedule:    schedule,
+		Task:        task,
+		PerInstance: true,
+	})
+}
+
+func (s *Scheduler) add(newJob Job) (string, error) {
+	if err := ValidateSchedule(newJob.Schedule); err != nil {
+		s.logger.Errorf("Failed to add job %s: %v", newJob.Name, err)
+		return "", err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, job := range s.jobs {
+		if job.Name == newJob.Name {
+			s.logger.Errorf("Failed to add job %s: a job with this name already exists", newJob.Name)
+			return "", fmt.Errorf("job %s already exists", newJob.Name)
+		}
+	}
+
+	newJob.JobID = uuid.New().String()
+	s.jobs = append(s.jobs, newJob)
+
+	if s.started {
+		if err := s.register(len(s.jobs) - 1); err != nil {
+			s.jobs = s.jobs[:len(s.jobs)-1]
+			s.logger.Errorf("Failed to schedule job %s: %v", newJob.Name, err)
+			return "", err
+		}
+	}
+
+	return newJob.JobID, nil
+}
+
+// RemoveJob unschedules the job and forgets it, a run in progress is not interrupted
+func (s *Scheduler) RemoveJob(name string) error {
+	return s.remove(func(job Job) bool { return job.Name == name }, name)
+}
+
+// RemoveJobByID is RemoveJob for the ID AddJob returned
+func (s *Scheduler) RemoveJobByID(id string) error {
+	return s.remove(func(job Job) bool { return job.JobID == id }, id)
+}
+
+func (s *Scheduler) remove(match func(Job) bool, ref string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, job := range s.jobs {
+		if !match(job) {
+			continue
+		}
+
+		if err := s.unregister(i); err != nil {
+			return err
+		}
+
+		s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+		s.logger.Infof("Removed job: %s", job.Name)
+		return nil
+	}
+
+	return fmt.Errorf("job not found: %s", ref)
+}
+
 // Daily schedules a job to run daily at a specific time
-func (s *Scheduler) Daily(name string, timeStr string, task func()) {
+func (s *Scheduler) Daily(name string, timeStr string, task func()) (string, error) {
 	// Convert time (like "08:00") to cron syntax
 	// Parse the timeStr into hours and minutes
 	var hours, minutes int
 	_, err := fmt.Sscanf(timeStr, "%d:%d", &hours, &minutes)
 	if err != nil {
 		s.logger.Errorf("Invalid time format for daily job %s: %v", name, err)
-		return
+		return "", err
 	}
 
 	schedule := fmt.Sprintf("%d %d * * *", minutes, hours)
-	s.AddJob(name, schedule, task)
+	return s.AddJob(name, schedule, task)
 }
 
 // Hourly schedules a job to run at the specified minute of every hour
-func (s *Scheduler) Hourly(name string, minute int, task func()) {
+func (s *Scheduler) Hourly(name string, minute int, task func()) (string, error) {
 	// Ensure minute is within valid range
 	minute = minute % 60
 	schedule := fmt.Sprintf("%d * * * *", minute)
-	s.AddJob(name, schedule, task)
+	return s.AddJob(name, schedule, task)
 }
 
 // Weekly schedules a job to run weekly on a specific day
-func (s *Scheduler) Weekly(name string, day int, timeStr string, task func()) {
+func (s *Scheduler) Weekly(name string, day int, timeStr string, task func()) (string, error) {
 	// In cron, 0 = Sunday, 1 = Monday, etc.
 	// Ensure day is within valid range
 	day = day % 7
@@ -152,15 +375,15 @@ func (s *Scheduler) Weekly(name string, day int, timeStr string, task func()) {
 	_, err := fmt.Sscanf(timeStr, "%d:%d", &hours, &minutes)
 	if err != nil {
 		s.logger.Errorf("Invalid time format for weekly job %s: %v", name, err)
-		return
+		return "", err
 	}
 
 	schedule := fmt.Sprintf("%d %d * * %d", minutes, hours, day)
-	s.AddJob(name, schedule, task)
+	return s.AddJob(name, schedule, task)
 }
 
 // Monthly schedules a job to run monthly on a specific day
-func (s *Scheduler) Monthly(name string, dayOfMonth int, timeStr string, task func()) {
+func (s *Scheduler) Monthly(name string, dayOfMonth int, timeStr string, task func()) (string, error) {
 	// Ensure dayOfMonth is within valid range
 	if dayOfMonth < 1 {
 		dayOfMonth = 1
@@ -173,26 +396,29 @@ func (s *Scheduler) Monthly(name string, dayOfMonth int, timeStr string, task fu
 	_, err := fmt.Sscanf(timeStr, "%d:%d", &hours, &minutes)
 	if err != nil {
 		s.logger.Errorf("Invalid time format for monthly job %s: %v", name, err)
-		return
+		return "", err
 	}
 
 	schedule := fmt.Sprintf("%d %d %d * *", minutes, hours, dayOfMonth)
-	s.AddJob(name, schedule, task)
+	return s.AddJob(name, schedule, task)
 }
 
 // Custom allows for advanced scheduling options
-func (s *Scheduler) Custom(name string, schedule string, task func()) {
-	s.AddJob(name, schedule, task)
+func (s *Scheduler) Custom(name string, schedule string, task func()) (string, error) {
+	return s.AddJob(name, schedule, task)
 }
 
-// GetJobs returns all registered jobs
+// GetJobs returns a copy of all registered jobs
 func (s *Scheduler) GetJobs() []Job {
-	return s.jobs
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]Job(nil), s.jobs...)
 }
 
 // RunJobByName finds and runs a job by name immediately
 func (s *Scheduler) RunJobByName(name string) error {
-	for _, job := range s.jobs {
+	for _, job := range s.GetJobs() {
 		if job.Name == name {
 			// Run the job in a goroutine to avoid blocking
 			go job.Task()
@@ -10,23 +10,24 @@ import (
 	"github.com/go-sql-driver/mysql"
 )
 
-func New(addr, user, password, dbName string, maxOpenConns, maxIdleConns int, maxIdleTime string) (*sql.DB, error) {
-	dbConfig := mysql.Config{
-		User:                 user,
-		Passwd:               password,
-		Addr:                 addr,
-		DBName:               dbName,
-		Net:                  "tcp",
-		AllowNativePasswords: true,
-		ParseTime:            true,
-	}
+// Instrumentation times the queries of a pool and keeps their statements prepared
+type Instrumentation struct {
+	Metrics *QueryMetrics
+	// StatementCache is how many prepared statements each connection keeps, 0 prepares every
+	// query with arguments again, as database/sql does
+	StatementCache int
+}
+
+// New connects to the database, retrying while it starts up. instrument may be nil.
+func New(addr, user, password, dbName string, maxOpenConns, maxIdleConns int, maxIdleTime string, instrument *Instrumentation) (*sql.DB, error) {
+	dbConfig := newConfig(addr, user, password, dbName)
 
 	var db *sql.DB
 	var err error
 
 	// Retry logic
 	for i := 0; i < 10; i++ {
-		db, err = sql.Open("mysql", dbConfig.FormatDSN())
+		db, err = open(dbConfig, instrument)
 		if err == nil {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
@@ -50,3 +51,67 @@ func New(addr, user, password, dbName string, maxOpenConns, maxIdleConns int, ma
 	}
 	return nil, fmt.Errorf("could not connect to the database after multiple attempts: %v", err)
 }
+
+// Open sets up a pool without waiting for the database to answer, for read replicas that may
+// come up after the API. Their health is checked by store.Replicas.
+func Open(addr, user, password, dbName string, maxOpenConns, maxIdleConns int, maxIdleTime string, instrument *Instrumentation) (*sql.DB, error) {
+	duration, err := time.ParseDuration(maxIdleTime)
+	if err != nil {
+		return nil, err
+	}
+
+	dbConfig := newConfig(addr, user, password, dbName)
+
+	db, err := open(dbConfig, instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxIdleTime(duration)
+
+	return db, nil
+}
+
+// Ping opens a single connection and pings it once, without the retry loop used by New
+func Ping(ctx context.Context, addr, user, password, dbName string) error {
+	dbConfig := newConfig(addr, user, password, dbName)
+
+	db, err := sql.Open("mysql", dbConfig.FormatDSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.PingContext(ctx)
+}
+
+func open(dbConfig mysql.Config, instrument *Instrumentation) (*sql.DB, error) {
+	if instrument == nil {
+		return sql.Open("mysql", dbConfig.FormatDSN())
+	}
+
+	connector, err := mysql.NewConnector(&dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.OpenDB(&instrumentedConnector{
+		Connector:      connector,
+		metrics:        instrument.Metrics,
+		statementCache: instrument.StatementCache,
+	}), nil
+}
+
+func newConfig(addr, user, password, dbName string) mysql.Config {
+	return mysql.Config{
+		User:                 user,
+		Passwd:               password,
+		Addr:                 addr,
+		DBName:               dbName,
+		Net:                  "tcp",
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	}
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTrackedQueries bounds the queries QueryMetrics keeps apart, the rest are counted as otherQuery
+const maxTrackedQueries = 500
+
+const otherQuery = "(other)"
+
+// placeholderList collapses IN (?, ?, ?) of any length so it is tracked as one query
+var placeholderList = regexp.MustCompile(`(?i)\bIN \(\s*\?(\s*,\s*\?)*\s*\)`)
+
+// QueryStats is the record of one query since startup
+type QueryStats struct {
+	Query     string  `json:"query"`
+	Count     uint64  `json:"count"`
+	Errors    uint64  `json:"errors"`
+	Slow      uint64  `json:"slow"`
+	TotalMs   float64 `json:"total_ms"`
+	AverageMs float64 `json:"average_ms"`
+	MaxMs     float64 `json:"max_ms"`
+}
+
+type queryRecord struct {
+	count, errors, slow uint64
+	total, max          time.Duration
+}
+
+// SlowQuery is told to QueryMetrics.OnSlow for every query above the threshold
+type SlowQuery struct {
+	Query    string
+	Duration time.Duration
+	Err      error
+}
+
+// QueryMetrics times every query of the pools it is passed to. Reads are timed until the
+// first row, not while the rows are read.
+type QueryMetrics struct {
+	// SlowThreshold is the duration above which a query is slow, 0 turns it off
+	SlowThreshold time.Duration
+	// OnSlow is called with every slow query, e.g. to log it
+	OnSlow func(SlowQuery)
+
+	mu      sync.Mutex
+	queries map[string]*queryRecord
+}
+
+func NewQueryMetrics(slowThreshold time.Duration, onSlow func(SlowQuery)) *QueryMetrics {
+	return &QueryMetrics{
+		SlowThreshold: slowThreshold,
+		OnSlow:        onSlow,
+		queries:       map[string]*queryRecord{},
+	}
+}
+
+func (metrics *QueryMetrics) observe(query string, duration time.Duration, err error) {
+	if metrics == nil {
+		return
+	}
+
+	// the driver hands the query back to database/sql, nothing ran
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+
+	key := normalizeQuery(query)
+	slow := metrics.SlowThreshold > 0 && duration > metrics.SlowThreshold
+
+	metrics.mu.Lock()
+	record, ok := metrics.queries[key]
+	if !ok {
+		if len(metrics.queries) >= maxTrackedQueries {
+			key = otherQuery
+			record = metrics.queries[key]
+		}
+		if record == nil {
+			record = &queryRecord{}
+			metrics.queries[key] = record
+		}
+	}
+
+	record.count++
+	record.total += duration
+	if duration > record.max {
+		record.max = duration
+	}
+	if err != nil {
+		record.errors++
+	}
+	if slow {
+		record.slow++
+	}
+	metrics.mu.Unlock()
+
+	if slow && metrics.OnSlow != nil {
+		metrics.OnSlow(SlowQuery{Query: key, Duration: duration, Err: err})
+	}
+}
+
+// Snapshot returns the queries by the total time spent in them, the hot spots first
+func (metrics *QueryMetrics) Snapshot() []QueryStats {
+	if metrics == nil {
+		return []QueryStats{}
+	}
+
+	metrics.mu.Lock()
+	stats := make([]QueryStats, 0, len(metrics.queries))
+	for query, record := range metrics.queries {
+		stats = append(stats, QueryStats{
+			Query:     query,
+			Count:     record.count,
+			Errors:    record.errors,
+			Slow:      record.slow,
+			TotalMs:   milliseconds(record.total),
+			AverageMs: milliseconds(record.total / time.Duration(record.count)),
+			MaxMs:     milliseconds(record.max),
+		})
+	}
+	metrics.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].TotalMs > stats[j].TotalMs })
+
+	return stats
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
+
+func normalizeQuery(query string) string {
+	return placeholderList.ReplaceAllString(strings.Join(strings.Fields(query), " "), "IN (?, ...)")
+}
+
+// instrumentedConnector hands out connections that time their queries and keep the
+// statements of the queries with arguments prepared, up to statementCache per connection
+type instrumentedConnector struct {
+	driver.Connector
+	metrics        *QueryMetrics
+	statementCache int
+}
+
+func (connector *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedConn{
+		Conn:           conn,
+		metrics:        connector.metrics,
+		statementCache: connector.statementCache,
+		statements:     map[string]driver.Stmt{},
+	}, nil
+}
+
+// instrumentedConn wraps a mysql connection, which implements every optional interface of
+// database/sql/driver. database/sql uses a connection from one goroutine at a time, so the
+// statements need no lock.
+type instrumentedConn struct {
+	driver.Conn
+	metrics        *QueryMetrics
+	statementCache int
+	statements     map[string]driver.Stmt
+}
+
+func (conn *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := conn.query(ctx, query, args)
+	conn.metrics.observe(query, time.Since(start), err)
+	return rows, err
+}
+
+func (conn *instrumentedConn) query(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) > 0 && conn.statementCache > 0 {
+		stmt, err := conn.prepared(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		return stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	}
+
+	return conn.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (conn *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := conn.exec(ctx, query, args)
+	conn.metrics.observe(query, time.Since(start), err)
+	return result, err
+}
+
+func (conn *instrumentedConn) exec(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) > 0 && conn.statementCache > 0 {
+		stmt, err := conn.prepared(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		return stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	}
+
+	return conn.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+// prepared returns the statement of query, preparing it on first use. When the cache is
+// full one statement is closed to make room, MySQL caps the statements of the server.
+func (conn *instrumentedConn) prepared(ctx context.Context, query string) (driver.Stmt, error) {
+	if stmt, ok := conn.statements[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := conn.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conn.statements) >= conn.statementCache {
+		for cached, evicted := range conn.statements {
+			evicted.Close()
+			delete(conn.statements, cached)
+			break
+		}
+	}
+	conn.statements[query] = stmt
+
+	return stmt, nil
+}
+
+func (conn *instrumentedConn) Close() error {
+	for _, stmt := range conn.statements {
+		stmt.Close()
+	}
+	conn.statements = nil
+
+	return conn.Conn.Close()
+}
+
+func (conn *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return conn.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (conn *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return conn.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (conn *instrumentedConn) Ping(ctx context.Context) error {
+	return conn.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (conn *instrumentedConn) ResetSession(ctx context.Context) error {
+	return conn.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (conn *instrumentedConn) IsValid() bool {
+	return conn.Conn.(driver.Validator).IsValid()
+}
+
+func (conn *instrumentedConn) CheckNamedValue(value *driver.NamedValue) error {
+	return conn.Conn.(driver.NamedValueChecker).CheckNamedValue(value)
+}
@@ -0,0 +1,379 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/icrowley/fake"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// Generated accounts use this username prefix and email domain so Teardown can find them again
+const (
+	loadUsernamePrefix = "loadgen_"
+	loadEmailDomain    = "loadgen.test"
+)
+
+// maxLoadBatchSize keeps an INSERT under MySQL's 65535 placeholders, users take 8 per row
+const maxLoadBatchSize = 8000
+
+// LoadConfig sizes the data written by GenerateLoad
+type LoadConfig struct {
+	Users          int
+	PostsPerUser   int
+	FollowsPerUser int
+	// BatchSize is the number of rows per INSERT
+	BatchSize int
+	// Workers is the number of batches inserted at the same time, keep it below DB_MAX_OPEN_CONNS
+	Workers int
+	// ProgressEvery is how often progress is logged
+	ProgressEvery time.Duration
+}
+
+func (cfg LoadConfig) withDefaults() LoadConfig {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.BatchSize > maxLoadBatchSize {
+		cfg.BatchSize = maxLoadBatchSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.ProgressEvery <= 0 {
+		cfg.ProgressEvery = 2 * time.Second
+	}
+	return cfg
+}
+
+// GenerateLoad creates cfg.Users users, then their posts and follows, with batched
+// multi-row inserts spread over cfg.Workers connections. Every account shares the
+// password "password" and an @loadgen.test email, which is what Teardown deletes.
+// Rows are written outside the stores on purpose, one INSERT per row is far too
+// slow for hundreds of thousands of rows.
+func GenerateLoad(ctx context.Context, db *sql.DB, cfg LoadConfig) error {
+	cfg = cfg.withDefaults()
+	if cfg.Users <= 0 {
+		return fmt.Errorf("users must be positive")
+	}
+	if cfg.FollowsPerUser >= cfg.Users {
+		return fmt.Errorf("follows per user must be below the number of users")
+	}
+
+	// bcrypt is slow on purpose, hashing once keeps it out of the insert loop
+	var pwd models.PasswordHash
+	if err := pwd.Set("password"); err != nil {
+		return err
+	}
+
+	var roleID int64
+	if err := db.QueryRowContext(ctx, `SELECT id FROM roles WHERE name = ?`, "user").Scan(&roleID); err != nil {
+		return fmt.Errorf("looking up the user role: %w", err)
+	}
+
+	// The run id keeps usernames unique when the generator runs more than once
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	prefix := fmt.Sprintf("%s%s_", loadUsernamePrefix, run)
+
+	started := time.Now()
+
+	err := runBatches(ctx, db, "users", cfg.Users, cfg, func(offset, count int) (string, []any) {
+		return userBatch(prefix, offset, count, pwd.Hash, roleID)
+	})
+	if err != nil {
+		return err
+	}
+
+	userIDs, err := loadUserIDs(ctx, db, prefix)
+	if err != nil {
+		return err
+	}
+
+	if cfg.PostsPerUser > 0 {
+		err = runBatches(ctx, db, "posts", len(userIDs)*cfg.PostsPerUser, cfg, func(offset, count int) (string, []any) {
+			return postBatch(userIDs, cfg.PostsPerUser, offset, count)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.FollowsPerUser > 0 {
+		err = runBatches(ctx, db, "follows", len(userIDs)*cfg.FollowsPerUser, cfg, func(offset, count int) (string, []any) {
+			return followBatch(userIDs, cfg.FollowsPerUser, offset, count)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("load generation complete in %s", time.Since(started).Round(time.Second))
+	return nil
+}
+
+// Teardown deletes every generated account with its posts and follows, batchSize users at a time
+func Teardown(ctx context.Context, db *sql.DB, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	deleted := 0
+	for {
+		// The username prefix narrows the scan through its unique index, the domain makes sure
+		// no real account that happens to share the prefix is touched
+		rows, err := db.QueryContext(
+			ctx,
+			`SELECT id FROM users WHERE username LIKE ? AND email LIKE ? ORDER BY id LIMIT ?`,
+			strings.ReplaceAll(loadUsernamePrefix, "_", `\_`)+"%",
+			"%@"+loadEmailDomain,
+			batchSize,
+		)
+		if err != nil {
+			return err
+		}
+
+		var ids []any
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			break
+		}
+
+		if err := deleteUsers(ctx, db, ids); err != nil {
+			return err
+		}
+
+		deleted += len(ids)
+		log.Printf("teardown: deleted %d users", deleted)
+	}
+
+	log.Printf("teardown complete, %d users removed", deleted)
+	return nil
+}
+
+// ================== Private methods ======================//
+
+// batchBuilder returns the INSERT for rows [offset, offset+count) of a phase
+type batchBuilder func(offset, count int) (string, []any)
+
+// runBatches inserts total rows in batches of cfg.BatchSize on cfg.Workers goroutines
+// and stops at the first error
+func runBatches(ctx context.Context, db *sql.DB, phase string, total int, cfg LoadConfig, build batchBuilder) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	offsets := make(chan int)
+	progress := newLoadProgress(phase, total)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for offset := range offsets {
+				count := min(cfg.BatchSize, total-offset)
+				query, args := build(offset, count)
+
+				if _, err := db.ExecContext(ctx, query, args...); err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("inserting %s %d-%d: %w", phase, offset, offset+count, err)
+						cancel()
+					})
+					return
+				}
+				progress.add(count)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(cfg.ProgressEvery)
+	defer ticker.Stop()
+
+	go func() {
+		defer close(offsets)
+		for offset := 0; offset < total; offset += cfg.BatchSize {
+			select {
+			case offsets <- offset:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			progress.report()
+		case <-done:
+			if firstErr != nil {
+				return firstErr
+			}
+			if err := ctx.Err(); err != nil && progress.completed() < total {
+				return err
+			}
+			progress.report()
+			return nil
+		}
+	}
+}
+
+type loadProgress struct {
+	phase   string
+	total   int
+	done    atomic.Int64
+	started time.Time
+}
+
+func newLoadProgress(phase string, total int) *loadProgress {
+	return &loadProgress{phase: phase, total: total, started: time.Now()}
+}
+
+func (p *loadProgress) add(n int) {
+	p.done.Add(int64(n))
+}
+
+func (p *loadProgress) completed() int {
+	return int(p.done.Load())
+}
+
+func (p *loadProgress) report() {
+	done := p.completed()
+	elapsed := time.Since(p.started).Seconds()
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(done) / elapsed
+	}
+
+	log.Printf("%s: %d/%d (%.1f%%), %.0f rows/s", p.phase, done, p.total, float64(done)*100/float64(max(p.total, 1)), rate)
+}
+
+func userBatch(prefix string, offset, count int, passwordHash []byte, roleID int64) (string, []any) {
+	placeholders := make([]string, count)
+	args := make([]any, 0, count*8)
+
+	for i := 0; i < count; i++ {
+		username := fmt.Sprintf("%s%d", prefix, offset+i)
+		email := username + "@" + loadEmailDomain
+
+		placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?)"
+		args = append(args, fake.FirstName(), fake.LastName(), username, email, email, passwordHash, true, roleID)
+	}
+
+	query := `INSERT INTO users (first_name, last_name, username, email, normalized_email, password, is_active, role_id) VALUES ` +
+		strings.Join(placeholders, ", ")
+	return query, args
+}
+
+// postBatch spreads created_at over the last 90 days so feeds and pagination see realistic ordering
+func postBatch(userIDs []int64, perUser, offset, count int) (string, []any) {
+	placeholders := make([]string, count)
+	args := make([]any, 0, count*5)
+	now := time.Now()
+
+	for i := 0; i < count; i++ {
+		userID := userIDs[(offset+i)/perUser]
+		createdAt := now.Add(-time.Duration(rand.Int63n(int64(90 * 24 * time.Hour))))
+
+		placeholders[i] = "(?, ?, ?, ?, ?, ?)"
+		args = append(args, fake.Sentence(), fake.Paragraph(), userID, strings.ToLower(fake.Word()), createdAt, createdAt)
+	}
+
+	query := `INSERT INTO posts (title, content, user_id, tags, created_at, updated_at) VALUES ` +
+		strings.Join(placeholders, ", ")
+	return query, args
+}
+
+// followBatch has follower k of a user follow the user k+1..perUser places after them,
+// so every pair is distinct without tracking what was already inserted
+func followBatch(userIDs []int64, perUser, offset, count int) (string, []any) {
+	placeholders := make([]string, count)
+	args := make([]any, 0, count*2)
+
+	for i := 0; i < count; i++ {
+		index := offset + i
+		follower := index / perUser
+		step := index%perUser + 1
+
+		placeholders[i] = "(?, ?)"
+		args = append(args, userIDs[(follower+step)%len(userIDs)], userIDs[follower])
+	}
+
+	query := `INSERT IGNORE INTO followers (user_id, follower_id) VALUES ` + strings.Join(placeholders, ", ")
+	return query, args
+}
+
+func loadUserIDs(ctx context.Context, db *sql.DB, prefix string) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM users WHERE username LIKE ? ORDER BY id`, strings.ReplaceAll(prefix, "_", `\_`)+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// deleteUsers clears the rows referencing ids first, the foreign keys are ON DELETE RESTRICT
+func deleteUsers(ctx context.Context, db *sql.DB, ids []any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{fmt.Sprintf(`DELETE FROM followers WHERE user_id IN (%s) OR follower_id IN (%s)`, in, in), append(append([]any{}, ids...), ids...)},
+		{fmt.Sprintf(`DELETE FROM user_invitations WHERE user_id IN (%s)`, in), ids},
+		{fmt.Sprintf(`DELETE FROM posts WHERE user_id IN (%s)`, in), ids},
+		{fmt.Sprintf(`DELETE FROM users WHERE id IN (%s)`, in), ids},
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement.query, statement.args...); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -2,65 +2,379 @@ package db
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
+	mathrand "math/rand"
+	"strings"
+	"time"
 
 	"github.com/icrowley/fake"
 
 	"godsendjoseph.dev/sandbox-api/internal/models"
-	"godsendjoseph.dev/sandbox-api/internal/store"
 )
 
-func Seed(store store.Storage, db *sql.DB) {
-	ctx := context.Background()
+// Seeded accounts use this username prefix and email domain, running the seeder again
+// updates them instead of adding more
+const (
+	seedUsernamePrefix = "seed_user_"
+	seedEmailDomain    = "seed.test"
+	// SeedPassword is the password of every seeded user, the admin has its own
+	SeedPassword = "password"
+)
+
+// seedBatchSize keeps the upserts well under MySQL's placeholder limit
+const seedBatchSize = 500
+
+// seedRoles are the roles the API checks for, kept in step with the roles migration
+var seedRoles = []models.Role{
+	{Name: "user", Level: 1, Description: "A User can only create posts"},
+	{Name: "moderator", Level: 2, Description: "A Moderator can update and not delete posts"},
+	{Name: "admin", Level: 3, Description: "An Admin can do anything"},
+}
+
+// SeedConfig sizes the data written by Seed
+type SeedConfig struct {
+	Users          int
+	PostsPerUser   int
+	FollowsPerUser int
+	// AdminEmail is the admin account to create or promote, none when empty
+	AdminEmail    string
+	AdminUsername string
+	// AdminPassword is set on a new admin, or on an existing one when given. A new admin
+	// without one gets a random password, printed once.
+	AdminPassword string
+	// RandomSeed makes the generated names and posts the same on every run, 0 picks one
+	RandomSeed int64
+}
+
+// SeedProfiles are the presets of the seed command, flags override their fields
+var SeedProfiles = map[string]SeedConfig{
+	// roles and the admin only, for a fresh staging or production database
+	"minimal": {},
+	"dev":     {Users: 50, PostsPerUser: 3, FollowsPerUser: 5},
+	"demo":    {Users: 500, PostsPerUser: 10, FollowsPerUser: 20},
+}
+
+// Seed writes the roles, the admin and cfg.Users users with their posts and follows. Every
+// step is an upsert, so running it again with the same config changes nothing and a larger
+// config tops the data up. Users are seed_user_N@seed.test with the password "password".
+func Seed(ctx context.Context, db *sql.DB, cfg SeedConfig) error {
+	if cfg.Users < 0 || cfg.PostsPerUser < 0 || cfg.FollowsPerUser < 0 {
+		return errors.New("users, posts and follows cannot be negative")
+	}
+	if cfg.Users > 0 && cfg.FollowsPerUser >= cfg.Users {
+		return errors.New("follows per user must be below the number of users")
+	}
+
+	if cfg.RandomSeed == 0 {
+		cfg.RandomSeed = time.Now().UnixNano()
+	}
+	fake.Seed(cfg.RandomSeed)
+	random := mathrand.New(mathrand.NewSource(cfg.RandomSeed))
 
-	// Create users and store them with their DB IDs
-	var createdUsers []models.User
-	users := generateUsers(50)
-	tx, _ := db.BeginTx(ctx, nil)
-	for _, user := range users {
-		newUser := user // Create a copy to avoid pointer issues
-		if err := store.Users.Create(ctx, tx, &newUser); err != nil {
-			_ = tx.Rollback()
-			log.Printf("error creating user: %v", err)
-			return
+	roleIDs, err := seedRolesTable(ctx, db)
+	if err != nil {
+		return err
+	}
+	log.Printf("roles: %d up to date", len(roleIDs))
+
+	if cfg.AdminEmail != "" {
+		if err := seedAdmin(ctx, db, cfg, roleIDs["admin"]); err != nil {
+			return err
 		}
-		createdUsers = append(createdUsers, newUser)
 	}
 
-	if err := tx.Commit(); err != nil {
-		log.Printf("error committing transaction: %v", err)
-		return
+	if cfg.Users == 0 {
+		log.Println("seeding complete")
+		return nil
 	}
 
-	log.Printf("Created %d users", len(createdUsers))
+	userIDs, err := seedUsers(ctx, db, cfg.Users, roleIDs["user"])
+	if err != nil {
+		return err
+	}
+
+	if cfg.PostsPerUser > 0 {
+		if err := seedPosts(ctx, db, userIDs, cfg.PostsPerUser, random); err != nil {
+			return err
+		}
+	}
+
+	if cfg.FollowsPerUser > 0 {
+		if err := seedFollows(ctx, db, userIDs, cfg.FollowsPerUser); err != nil {
+			return err
+		}
+	}
 
 	log.Println("seeding complete")
+	return nil
+}
+
+// seedRolesTable adds the missing roles and resets the level and description of the others.
+// roles.name has no unique key, so the upsert is a conditional insert and an update.
+func seedRolesTable(ctx context.Context, db *sql.DB) (map[string]int64, error) {
+	ids := map[string]int64{}
+
+	for _, role := range seedRoles {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO roles (name, level, description)
+			SELECT ?, ?, ? FROM DUAL
+			WHERE NOT EXISTS (SELECT 1 FROM roles WHERE name = ?)`,
+			role.Name, role.Level, role.Description, role.Name)
+		if err != nil {
+			return nil, fmt.Errorf("seeding role %s: %w", role.Name, err)
+		}
+
+		if _, err := db.ExecContext(ctx, `UPDATE roles SET level = ?, description = ? WHERE name = ?`, role.Level, role.Description, role.Name); err != nil {
+			return nil, fmt.Errorf("updating role %s: %w", role.Name, err)
+		}
+
+		var id int64
+		if err := db.QueryRowContext(ctx, `SELECT MIN(id) FROM roles WHERE name = ?`, role.Name).Scan(&id); err != nil {
+			return nil, fmt.Errorf("looking up role %s: %w", role.Name, err)
+		}
+		ids[role.Name] = id
+	}
+
+	return ids, nil
 }
 
-func generateUsers(num int64) []models.User {
-	users := make([]models.User, num)
+// seedAdmin creates the admin account, or makes the existing account with that email an
+// active admin
+func seedAdmin(ctx context.Context, db *sql.DB, cfg SeedConfig, roleID int64) error {
+	email := strings.ToLower(strings.TrimSpace(cfg.AdminEmail))
+	normalized := email
+	if local, domain, ok := strings.Cut(email, "@"); ok {
+		local, _, _ = strings.Cut(local, "+")
+		normalized = local + "@" + domain
+	}
+
+	var id int64
+	err := db.QueryRowContext(ctx, `SELECT id FROM users WHERE email = ?`, email).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		password, generated := cfg.AdminPassword, false
+		if password == "" {
+			if password, err = randomPassword(); err != nil {
+				return err
+			}
+			generated = true
+		}
 
-	for i := 0; i < int(num); i++ {
-		var pwd models.PasswordHash
-		err := pwd.Set("password")
+		var hash models.PasswordHash
+		if err := hash.Set(password); err != nil {
+			return err
+		}
+
+		username := cfg.AdminUsername
+		if username == "" {
+			username, _, _ = strings.Cut(email, "@")
+		}
 
+		_, err = db.ExecContext(ctx, `
+			INSERT INTO users (first_name, last_name, username, email, normalized_email, password, is_active, role_id)
+			VALUES (?, ?, ?, ?, ?, ?, TRUE, ?)`,
+			"Admin", "", username, email, normalized, hash.Hash, roleID)
 		if err != nil {
-			// Handle the error appropriately
-			panic(err)
+			return fmt.Errorf("creating admin %s: %w", email, err)
 		}
-		users[i] = models.User{
-			FirstName: fake.FirstName(),
-			LastName:  fake.LastName(),
-			Username:  fake.UserName(),
-			Email:     fake.EmailAddress(),
-			IsActive:  true,
-			Role: models.Role{
-				Name: "user",
-			},
-			Password: pwd,
+
+		log.Printf("admin: created %s (%s)", email, username)
+		if generated {
+			log.Printf("admin: generated password %s, it is not shown again", password)
+		}
+	case err != nil:
+		return fmt.Errorf("looking up admin %s: %w", email, err)
+	default:
+		if _, err := db.ExecContext(ctx, `UPDATE users SET role_id = ?, is_active = TRUE, deleted_at = NULL WHERE id = ?`, roleID, id); err != nil {
+			return fmt.Errorf("promoting admin %s: %w", email, err)
+		}
+
+		if cfg.AdminPassword != "" {
+			var hash models.PasswordHash
+			if err := hash.Set(cfg.AdminPassword); err != nil {
+				return err
+			}
+			if _, err := db.ExecContext(ctx, `UPDATE users SET password = ?, password_changed_at = NOW() WHERE id = ?`, hash.Hash, id); err != nil {
+				return fmt.Errorf("setting admin password: %w", err)
+			}
 		}
+
+		log.Printf("admin: %s is an active admin", email)
 	}
 
-	return users
+	return nil
+}
+
+// seedUsers upserts seed_user_1 to seed_user_<count> and returns their IDs in that order
+func seedUsers(ctx context.Context, db *sql.DB, count int, roleID int64) ([]int64, error) {
+	// bcrypt is slow on purpose, hashing once keeps it out of the loop
+	var pwd models.PasswordHash
+	if err := pwd.Set(SeedPassword); err != nil {
+		return nil, err
+	}
+
+	progress := newSeedProgress("users", count)
+	for offset := 0; offset < count; offset += seedBatchSize {
+		size := min(seedBatchSize, count-offset)
+
+		placeholders := make([]string, size)
+		args := make([]any, 0, size*8)
+		for i := 0; i < size; i++ {
+			username := fmt.Sprintf("%s%d", seedUsernamePrefix, offset+i+1)
+			email := username + "@" + seedEmailDomain
+
+			placeholders[i] = "(?, ?, ?, ?, ?, ?, TRUE, ?)"
+			args = append(args, fake.FirstName(), fake.LastName(), username, email, email, pwd.Hash, roleID)
+		}
+
+		// the names are regenerated, with a fixed seed they come out the same
+		query := `INSERT INTO users (first_name, last_name, username, email, normalized_email, password, is_active, role_id) VALUES ` +
+			strings.Join(placeholders, ", ") + `
+			ON DUPLICATE KEY UPDATE first_name = VALUES(first_name), last_name = VALUES(last_name), is_active = TRUE, deleted_at = NULL`
+		if _, err := db.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("seeding users: %w", err)
+		}
+
+		progress.add(size)
+	}
+
+	ids := make([]int64, 0, count)
+	rows, err := db.QueryContext(ctx, `
+		SELECT id FROM users
+		WHERE email LIKE ?
+		ORDER BY CAST(SUBSTRING(username, ?) AS UNSIGNED)
+		LIMIT ?`,
+		strings.ReplaceAll(seedUsernamePrefix, "_", `\_`)+"%@"+seedEmailDomain, len(seedUsernamePrefix)+1, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// seedPosts tops every user up to perUser posts, so a second run adds none
+func seedPosts(ctx context.Context, db *sql.DB, userIDs []int64, perUser int, random *mathrand.Rand) error {
+	existing := map[int64]int{}
+	for offset := 0; offset < len(userIDs); offset += seedBatchSize {
+		batch := userIDs[offset:min(offset+seedBatchSize, len(userIDs))]
+
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		rows, err := db.QueryContext(ctx, `SELECT user_id, COUNT(*) FROM posts WHERE user_id IN (`+placeholders(len(batch))+`) GROUP BY user_id`, args...)
+		if err != nil {
+			return fmt.Errorf("counting posts: %w", err)
+		}
+		for rows.Next() {
+			var userID int64
+			var count int
+			if err := rows.Scan(&userID, &count); err != nil {
+				rows.Close()
+				return err
+			}
+			existing[userID] = count
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	var missing []int64
+	for _, userID := range userIDs {
+		for i := existing[userID]; i < perUser; i++ {
+			missing = append(missing, userID)
+		}
+	}
+
+	progress := newSeedProgress("posts", len(missing))
+	now := time.Now()
+	for offset := 0; offset < len(missing); offset += seedBatchSize {
+		batch := missing[offset:min(offset+seedBatchSize, len(missing))]
+
+		rows := make([]string, len(batch))
+		args := make([]any, 0, len(batch)*6)
+		for i, userID := range batch {
+			// spread over the last 90 days so feeds and pagination see realistic ordering
+			createdAt := now.Add(-time.Duration(random.Int63n(int64(90 * 24 * time.Hour))))
+
+			rows[i] = "(?, ?, ?, ?, ?, ?)"
+			args = append(args, fake.Sentence(), fake.Paragraph(), userID, strings.ToLower(fake.Word()), createdAt, createdAt)
+		}
+
+		query := `INSERT INTO posts (title, content, user_id, tags, created_at, updated_at) VALUES ` + strings.Join(rows, ", ")
+		if _, err := db.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("seeding posts: %w", err)
+		}
+
+		progress.add(len(batch))
+	}
+
+	return nil
+}
+
+// seedFollows has user k follow the perUser users after them, the same pairs on every run
+func seedFollows(ctx context.Context, db *sql.DB, userIDs []int64, perUser int) error {
+	total := len(userIDs) * perUser
+	progress := newSeedProgress("follows", total)
+
+	for offset := 0; offset < total; offset += seedBatchSize {
+		size := min(seedBatchSize, total-offset)
+		query, args := followBatch(userIDs, perUser, offset, size)
+
+		if _, err := db.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("seeding follows: %w", err)
+		}
+
+		progress.add(size)
+	}
+
+	return nil
+}
+
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// seedProgress prints a line per batch, the seeder is small enough for that
+type seedProgress struct {
+	phase string
+	total int
+	done  int
+}
+
+func newSeedProgress(phase string, total int) *seedProgress {
+	if total == 0 {
+		log.Printf("%s: nothing to add", phase)
+	}
+	return &seedProgress{phase: phase, total: total}
+}
+
+func (progress *seedProgress) add(count int) {
+	progress.done += count
+	log.Printf("%s: %d/%d (%.0f%%)", progress.phase, progress.done, progress.total, float64(progress.done)/float64(progress.total)*100)
 }
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/icrowley/fake"
+)
+
+// anonymousEmailDomain is reserved, an exported address can never reach a real mailbox
+const anonymousEmailDomain = "anonymized.invalid"
+
+// SnapshotTables are the tables ExportAnonymized writes, in that order. Everything else,
+// email logs, support tickets and 2FA codes, stays out of the snapshot.
+var SnapshotTables = []string{"roles", "users", "posts", "followers"}
+
+// SnapshotWriter receives one table as gzipped JSON lines
+type SnapshotWriter func(table string, rows int, data []byte) error
+
+// ExportAnonymized reads the core tables and hands each one to write once it is complete,
+// so only one table is held in memory. Ids and timestamps are kept, which leaves the
+// relations and the growth curves intact. Names and usernames are replaced with fakes,
+// post text with lorem ipsum of the same length, and emails with an HMAC of salt, which is
+// stable between snapshots so analysts can count and join on it without seeing the address.
+// Credentials, OTPs and avatars are dropped.
+func ExportAnonymized(ctx context.Context, db *sql.DB, salt string, write SnapshotWriter) error {
+	if salt == "" {
+		return errors.New("a salt is required, unsalted email hashes can be reversed with a list of addresses")
+	}
+
+	exports := map[string]func(context.Context, *sql.DB, *snapshotEncoder, string) error{
+		"roles":     exportRoles,
+		"users":     exportUsers,
+		"posts":     exportPosts,
+		"followers": exportFollowers,
+	}
+
+	for _, table := range SnapshotTables {
+		encoder := newSnapshotEncoder()
+		if err := exports[table](ctx, db, encoder, salt); err != nil {
+			return fmt.Errorf("exporting %s: %w", table, err)
+		}
+
+		data, err := encoder.close()
+		if err != nil {
+			return err
+		}
+
+		if err := write(table, encoder.rows, data); err != nil {
+			return fmt.Errorf("writing %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// AnonymizeEmail is the pseudonym ExportAnonymized puts in place of email
+func AnonymizeEmail(email, salt string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))[:24] + "@" + anonymousEmailDomain
+}
+
+// ================== Private methods ======================//
+
+type snapshotEncoder struct {
+	buf  bytes.Buffer
+	gz   *gzip.Writer
+	json *json.Encoder
+	rows int
+}
+
+func newSnapshotEncoder() *snapshotEncoder {
+	encoder := &snapshotEncoder{}
+	encoder.gz = gzip.NewWriter(&encoder.buf)
+	encoder.json = json.NewEncoder(encoder.gz)
+	return encoder
+}
+
+func (encoder *snapshotEncoder) add(row any) error {
+	encoder.rows++
+	return encoder.json.Encode(row)
+}
+
+func (encoder *snapshotEncoder) close() ([]byte, error) {
+	if err := encoder.gz.Close(); err != nil {
+		return nil, err
+	}
+	return encoder.buf.Bytes(), nil
+}
+
+// snapshotRows runs query and calls scan for every row
+func snapshotRows(ctx context.Context, db *sql.DB, query string, scan func(*sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// fakeText returns lorem ipsum of roughly length characters, empty text stays empty
+func fakeText(length int, generate func() string) string {
+	if length == 0 {
+		return ""
+	}
+
+	var text strings.Builder
+	for text.Len() < length {
+		if text.Len() > 0 {
+			text.WriteString(" ")
+		}
+		text.WriteString(generate())
+	}
+
+	return text.String()[:length]
+}
+
+func exportRoles(ctx context.Context, db *sql.DB, encoder *snapshotEncoder, _ string) error {
+	type role struct {
+		ID          int64     `json:"id"`
+		Name        string    `json:"name"`
+		Level       int       `json:"level"`
+		Description string    `json:"description"`
+		CreatedAt   time.Time `json:"created_at"`
+	}
+
+	return snapshotRows(ctx, db, `SELECT id, name, level, description, created_at FROM roles ORDER BY id`, func(rows *sql.Rows) error {
+		var r role
+		if err := rows.Scan(&r.ID, &r.Name, &r.Level, &r.Description, &r.CreatedAt); err != nil {
+			return err
+		}
+		return encoder.add(r)
+	})
+}
+
+func exportUsers(ctx context.Context, db *sql.DB, encoder *snapshotEncoder, salt string) error {
+	type user struct {
+		ID               int64      `json:"id"`
+		RoleID           *int64     `json:"role_id"`
+		FirstName        string     `json:"first_name"`
+		LastName         string     `json:"last_name"`
+		Username         string     `json:"username"`
+		Email            string     `json:"email"`
+		IsActive         bool       `json:"is_active"`
+		TwoFactorEnabled bool       `json:"two_factor_enabled"`
+		HasAvatar        bool       `json:"has_avatar"`
+		CreatedAt        time.Time  `json:"created_at"`
+		UpdatedAt        time.Time  `json:"updated_at"`
+		DeletedAt        *time.Time `json:"deleted_at"`
+	}
+
+	query := `
+		SELECT id, role_id, email, is_active, totp_enabled_at IS NOT NULL, avatar_key IS NOT NULL,
+			created_at, updated_at, deleted_at
+		FROM users
+		ORDER BY id`
+
+	return snapshotRows(ctx, db, query, func(rows *sql.Rows) error {
+		var u user
+		var roleID sql.NullInt64
+		var deletedAt sql.NullTime
+
+		err := rows.Scan(&u.ID, &roleID, &u.Email, &u.IsActive, &u.TwoFactorEnabled, &u.HasAvatar,
+			&u.CreatedAt, &u.UpdatedAt, &deletedAt)
+		if err != nil {
+			return err
+		}
+
+		if roleID.Valid {
+			u.RoleID = &roleID.Int64
+		}
+		if deletedAt.Valid {
+			u.DeletedAt = &deletedAt.Time
+		}
+
+		u.Email = AnonymizeEmail(u.Email, salt)
+		u.FirstName = fake.FirstName()
+		u.LastName = fake.LastName()
+		// the id keeps the fake usernames as unique as the real ones
+		u.Username = fmt.Sprintf("%s_%d", fake.UserName(), u.ID)
+
+		return encoder.add(u)
+	})
+}
+
+func exportPosts(ctx context.Context, db *sql.DB, encoder *snapshotEncoder, _ string) error {
+	type post struct {
+		ID        int64     `json:"id"`
+		UserID    int64     `json:"user_id"`
+		Title     string    `json:"title"`
+		Content   string    `json:"content"`
+		Tags      []string  `json:"tags"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	// only the lengths are read, the text itself never leaves the database
+	query := `
+		SELECT id, user_id, CHAR_LENGTH(title), CHAR_LENGTH(content), COALESCE(tags, ''), created_at, updated_at
+		FROM posts
+		ORDER BY id`
+
+	return snapshotRows(ctx, db, query, func(rows *sql.Rows) error {
+		var p post
+		var titleLength, contentLength int
+		var tags string
+
+		if err := rows.Scan(&p.ID, &p.UserID, &titleLength, &contentLength, &tags, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return err
+		}
+
+		p.Title = fakeText(titleLength, fake.Title)
+		p.Content = fakeText(contentLength, fake.Sentence)
+		p.Tags = []string{}
+		if tags != "" {
+			p.Tags = strings.Split(tags, ",")
+		}
+
+		return encoder.add(p)
+	})
+}
+
+func exportFollowers(ctx context.Context, db *sql.DB, encoder *snapshotEncoder, _ string) error {
+	type follower struct {
+		UserID     int64     `json:"user_id"`
+		FollowerID int64     `json:"follower_id"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+
+	return snapshotRows(ctx, db, `SELECT user_id, follower_id, created_at FROM followers ORDER BY user_id, follower_id`, func(rows *sql.Rows) error {
+		var f follower
+		if err := rows.Scan(&f.UserID, &f.FollowerID, &f.CreatedAt); err != nil {
+			return err
+		}
+		return encoder.add(f)
+	})
+}
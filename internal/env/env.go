@@ -1,13 +1,54 @@
 package env
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 )
 
+// Read is one variable the API looked up, with the default it falls back to
+type Read struct {
+	Key      string
+	Fallback string
+}
+
+var (
+	readsMu sync.Mutex
+	reads   = map[string]string{}
+)
+
+// Reads returns every variable looked up so far, sorted by key. Once the config is built it
+// lists all the settings of the API, see config.Print.
+func Reads() []Read {
+	readsMu.Lock()
+	defer readsMu.Unlock()
+
+	list := make([]Read, 0, len(reads))
+	for key, fallback := range reads {
+		list = append(list, Read{Key: key, Fallback: fallback})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+
+	return list
+}
+
+// lookup is os.LookupEnv that remembers the key and its default
+func lookup(key string, fallback any) (string, bool) {
+	readsMu.Lock()
+	if _, seen := reads[key]; !seen {
+		reads[key] = fmt.Sprint(fallback)
+	}
+	readsMu.Unlock()
+
+	return os.LookupEnv(key)
+}
+
 func GetString(key, fallback string) string {
-	value, ok := os.LookupEnv(key)
+	value, ok := lookup(key, fallback)
 
 	if !ok {
 		log.Printf("%s not found, defaulting to %s", key, fallback)
@@ -18,7 +59,7 @@ func GetString(key, fallback string) string {
 }
 
 func GetInt(key string, fallback int) int {
-	value, ok := os.LookupEnv(key)
+	value, ok := lookup(key, fallback)
 
 	if !ok {
 		return fallback
@@ -34,7 +75,7 @@ func GetInt(key string, fallback int) int {
 }
 
 func GetBool(key string, fallback bool) bool {
-	value, ok := os.LookupEnv(key)
+	value, ok := lookup(key, fallback)
 
 	if !ok {
 		return fallback
@@ -48,3 +89,35 @@ func GetBool(key string, fallback bool) bool {
 
 	return valueAsBool
 }
+
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := lookup(key, fallback)
+
+	if !ok {
+		return fallback
+	}
+
+	valueAsDuration, err := time.ParseDuration(value)
+
+	if err != nil {
+		return fallback
+	}
+
+	return valueAsDuration
+}
+
+func GetFloat(key string, fallback float64) float64 {
+	value, ok := lookup(key, fallback)
+
+	if !ok {
+		return fallback
+	}
+
+	valueAsFloat, err := strconv.ParseFloat(value, 64)
+
+	if err != nil {
+		return fallback
+	}
+
+	return valueAsFloat
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Publishers picked with EVENTS_PUBLISHER
+const (
+	PublisherInProcess = "inprocess"
+	PublisherRedis     = "redis"
+	PublisherKafka     = "kafka"
+)
+
+// consumeRetryDelay is the pause before a publisher that stopped consuming is restarted
+const consumeRetryDelay = time.Second * 5
+
+var ErrQueueFull = errors.New("event queue is full")
+
+// Event is something that happened, its name is the same for every value of the type
+type Event interface {
+	EventName() string
+}
+
+// Envelope is an event on its way to the subscribers, Data holds the JSON of the event
+type Envelope struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Publisher carries envelopes from Publish to Consume. Publishers backed by a shared
+// service hand every envelope to one consumer of the group, whichever instance runs it.
+type Publisher interface {
+	Publish(ctx context.Context, envelope Envelope) error
+	// Consume calls handle for every envelope until ctx is done
+	Consume(ctx context.Context, handle func(context.Context, Envelope) error) error
+}
+
+type handlerFunc func(ctx context.Context, data json.RawMessage) error
+
+// Bus publishes typed events and runs the handlers subscribed to them. Handlers run after
+// the request that published the event has answered, their errors are logged and not
+// retried, a side effect that must not be lost keeps its own queue.
+type Bus struct {
+	publisher Publisher
+	logger    *zap.SugaredLogger
+	mu        sync.RWMutex
+	handlers  map[string][]handlerFunc
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewBus(publisher Publisher, logger *zap.SugaredLogger) *Bus {
+	return &Bus{
+		publisher: publisher,
+		logger:    logger,
+		handlers:  map[string][]handlerFunc{},
+	}
+}
+
+// Subscribe runs handler for every published E
+func Subscribe[E Event](bus *Bus, handler func(context.Context, E) error) {
+	var zero E
+	name := zero.EventName()
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	bus.handlers[name] = append(bus.handlers[name], func(ctx context.Context, data json.RawMessage) error {
+		var event E
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("decoding %s: %w", name, err)
+		}
+		return handler(ctx, event)
+	})
+}
+
+// Publish hands event to the publisher, it does not wait for the handlers
+func (bus *Bus) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return bus.publisher.Publish(ctx, Envelope{
+		ID:         uuid.NewString(),
+		Name:       event.EventName(),
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+}
+
+// Start consumes the published events until Stop is called
+func (bus *Bus) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	bus.cancel = cancel
+	bus.done = make(chan struct{})
+
+	go bus.run(ctx)
+}
+
+// Stop ends consuming and waits for the handlers in flight
+func (bus *Bus) Stop() {
+	if bus.cancel == nil {
+		return
+	}
+
+	bus.cancel()
+	<-bus.done
+}
+
+func (bus *Bus) run(ctx context.Context) {
+	defer close(bus.done)
+
+	for {
+		err := bus.publisher.Consume(ctx, bus.dispatch)
+		if ctx.Err() != nil {
+			return
+		}
+
+		bus.logger.Errorw("event consumer stopped, restarting", "error", err, "retryIn", consumeRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(consumeRetryDelay):
+		}
+	}
+}
+
+// dispatch runs every handler of the envelope, one failing does not stop the others
+func (bus *Bus) dispatch(ctx context.Context, envelope Envelope) error {
+	bus.mu.RLock()
+	handlers := bus.handlers[envelope.Name]
+	bus.mu.RUnlock()
+
+	// handlers finish even when the bus is stopping
+	ctx = context.WithoutCancel(ctx)
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, envelope.Data); err != nil {
+			bus.logger.Errorw("event handler failed", "event", envelope.Name, "eventID", envelope.ID, "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
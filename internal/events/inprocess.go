@@ -0,0 +1,48 @@
+package events
+
+import (
+	"context"
+)
+
+// InProcessPublisher queues events in memory, they are handled by the instance that
+// published them and lost if it stops before draining the queue
+type InProcessPublisher struct {
+	queue chan Envelope
+}
+
+func NewInProcessPublisher(queueSize int) *InProcessPublisher {
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+
+	return &InProcessPublisher{queue: make(chan Envelope, queueSize)}
+}
+
+// Publish never blocks, a full queue is ErrQueueFull
+func (publisher *InProcessPublisher) Publish(_ context.Context, envelope Envelope) error {
+	select {
+	case publisher.queue <- envelope:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Consume handles the queue until ctx is done, then drains what is left
+func (publisher *InProcessPublisher) Consume(ctx context.Context, handle func(context.Context, Envelope) error) error {
+	for {
+		select {
+		case envelope := <-publisher.queue:
+			_ = handle(ctx, envelope)
+		case <-ctx.Done():
+			for {
+				select {
+				case envelope := <-publisher.queue:
+					_ = handle(ctx, envelope)
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Content types of the Kafka REST Proxy v2 API
+const (
+	kafkaJSONContentType = "application/vnd.kafka.json.v2+json"
+	kafkaContentType     = "application/vnd.kafka.v2+json"
+)
+
+// kafkaPollTimeout is how long the proxy holds one records request open
+const kafkaPollTimeout = time.Second * 5
+
+// KafkaPublisher produces events to a Kafka topic through a REST Proxy (Confluent REST
+// Proxy, Redpanda's HTTP Proxy, or anything else speaking the v2 API), which keeps the
+// Kafka client out of the API. Each instance consumes as a member of one group, so each
+// event is handled by one of them.
+type KafkaPublisher struct {
+	baseURL  string
+	topic    string
+	group    string
+	consumer string
+	client   *http.Client
+}
+
+func NewKafkaPublisher(baseURL, topic, group, consumer string) *KafkaPublisher {
+	return &KafkaPublisher{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		topic:    topic,
+		group:    group,
+		consumer: consumer,
+		client:   &http.Client{Timeout: kafkaPollTimeout * 3},
+	}
+}
+
+// Publish keys the record by event name, so events of one kind stay in order
+func (publisher *KafkaPublisher) Publish(ctx context.Context, envelope Envelope) error {
+	body := map[string]any{
+		"records": []map[string]any{{"key": envelope.Name, "value": envelope}},
+	}
+
+	var response struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+
+	endpoint := publisher.baseURL + "/topics/" + url.PathEscape(publisher.topic)
+	if err := publisher.do(ctx, http.MethodPost, endpoint, kafkaJSONContentType, body, &response); err != nil {
+		return err
+	}
+
+	for _, offset := range response.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("kafka rejected the event: %s", offset.Error)
+		}
+	}
+
+	return nil
+}
+
+// Consume registers the consumer instance, polls its records and commits them once
+// handled. The instance is deleted again when ctx is done.
+func (publisher *KafkaPublisher) Consume(ctx context.Context, handle func(context.Context, Envelope) error) error {
+	instanceURL, err := publisher.createConsumer(ctx)
+	if err != nil {
+		return err
+	}
+	defer publisher.do(context.WithoutCancel(ctx), http.MethodDelete, instanceURL, kafkaContentType, nil, nil)
+
+	subscription := map[string]any{"topics": []string{publisher.topic}}
+	if err := publisher.do(ctx, http.MethodPost, instanceURL+"/subscription", kafkaContentType, subscription, nil); err != nil {
+		return err
+	}
+
+	recordsURL := fmt.Sprintf("%s/records?timeout=%d", instanceURL, kafkaPollTimeout.Milliseconds())
+
+	for ctx.Err() == nil {
+		var records []struct {
+			Value Envelope `json:"value"`
+		}
+
+		err := publisher.do(ctx, http.MethodGet, recordsURL, kafkaJSONContentType, nil, &records)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			return err
+		case len(records) == 0:
+			continue
+		}
+
+		for _, record := range records {
+			_ = handle(ctx, record.Value)
+		}
+
+		// an empty body commits everything this instance fetched so far
+		if err := publisher.do(context.WithoutCancel(ctx), http.MethodPost, instanceURL+"/offsets", kafkaContentType, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createConsumer returns the URL of this instance's consumer, reusing one left behind by
+// a previous run with the same name
+func (publisher *KafkaPublisher) createConsumer(ctx context.Context) (string, error) {
+	body := map[string]any{
+		"name":               publisher.consumer,
+		"format":             "json",
+		"auto.offset.reset":  "latest",
+		"auto.commit.enable": "false",
+	}
+
+	var response struct {
+		BaseURI string `json:"base_uri"`
+	}
+
+	endpoint := publisher.baseURL + "/consumers/" + url.PathEscape(publisher.group)
+	err := publisher.do(ctx, http.MethodPost, endpoint, kafkaContentType, body, &response)
+	if statusErr, ok := err.(*kafkaStatusError); ok && statusErr.status == http.StatusConflict {
+		return endpoint + "/instances/" + url.PathEscape(publisher.consumer), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return response.BaseURI, nil
+}
+
+type kafkaStatusError struct {
+	status int
+	body   string
+}
+
+func (err *kafkaStatusError) Error() string {
+	return fmt.Sprintf("kafka rest proxy answered %d: %s", err.status, err.body)
+}
+
+// do sends body as JSON and decodes the answer into out when it is not nil
+func (publisher *KafkaPublisher) do(ctx context.Context, method, endpoint, contentType string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("Accept", contentType)
+
+	response, err := publisher.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return &kafkaStatusError{status: response.StatusCode, body: string(bytes.TrimSpace(text))}
+	}
+
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(out)
+}
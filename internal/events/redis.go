@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// redisStreamMaxLen trims the stream, handled entries are only kept for debugging
+	redisStreamMaxLen = 10000
+	// redisReadBlock is how long one read waits for new entries
+	redisReadBlock = time.Second * 5
+	// redisClaimIdle is how long an entry may stay unacknowledged before another
+	// consumer takes it over from an instance that died while handling it
+	redisClaimIdle = time.Minute
+	redisBatchSize = 10
+	redisField     = "envelope"
+)
+
+// RedisPublisher appends events to a Redis stream. The instances read it as one consumer
+// group, so each event is handled once by whichever instance reads it first.
+type RedisPublisher struct {
+	rdb      *redis.Client
+	stream   string
+	group    string
+	consumer string
+}
+
+func NewRedisPublisher(rdb *redis.Client, stream, group, consumer string) *RedisPublisher {
+	return &RedisPublisher{rdb: rdb, stream: stream, group: group, consumer: consumer}
+}
+
+func (publisher *RedisPublisher) Publish(ctx context.Context, envelope Envelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: publisher.stream,
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: map[string]any{redisField: data},
+	}).Err()
+}
+
+// Consume reads new entries as publisher.consumer, after taking over the ones other
+// consumers left unacknowledged. An entry is acknowledged once handled, failed or not.
+func (publisher *RedisPublisher) Consume(ctx context.Context, handle func(context.Context, Envelope) error) error {
+	err := publisher.rdb.XGroupCreateMkStream(ctx, publisher.stream, publisher.group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		claimed, _, err := publisher.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   publisher.stream,
+			Group:    publisher.group,
+			Consumer: publisher.consumer,
+			MinIdle:  redisClaimIdle,
+			Start:    "0-0",
+			Count:    redisBatchSize,
+		}).Result()
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		publisher.handle(ctx, claimed, handle)
+
+		streams, err := publisher.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    publisher.group,
+			Consumer: publisher.consumer,
+			Streams:  []string{publisher.stream, ">"},
+			Count:    redisBatchSize,
+			Block:    redisReadBlock,
+		}).Result()
+		switch {
+		case errors.Is(err, redis.Nil), ctx.Err() != nil:
+			continue
+		case err != nil:
+			return err
+		}
+
+		for _, stream := range streams {
+			publisher.handle(ctx, stream.Messages, handle)
+		}
+	}
+
+	return nil
+}
+
+func (publisher *RedisPublisher) handle(ctx context.Context, messages []redis.XMessage, handle func(context.Context, Envelope) error) {
+	for _, message := range messages {
+		var envelope Envelope
+		if raw, ok := message.Values[redisField].(string); ok && json.Unmarshal([]byte(raw), &envelope) == nil {
+			_ = handle(ctx, envelope)
+		}
+
+		// acknowledged with a context of its own, an entry handled during shutdown
+		// must not be handled again by the next instance
+		publisher.rdb.XAck(context.WithoutCancel(ctx), publisher.stream, publisher.group, message.ID)
+	}
+}
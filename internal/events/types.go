@@ -0,0 +1,93 @@
+package events
+
+import "time"
+
+// UserRegistered is published once the account exists, the outbox sends its verification code
+type UserRegistered struct {
+	UserID   int64  `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func (UserRegistered) EventName() string { return "user.registered" }
+
+// UserVerified is published when the account confirmed its email
+type UserVerified struct {
+	UserID   int64  `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func (UserVerified) EventName() string { return "user.verified" }
+
+// UserFollowed is published when FollowerID starts following UserID
+type UserFollowed struct {
+	UserID           int64  `json:"user_id"`
+	FollowerID       int64  `json:"follower_id"`
+	FollowerUsername string `json:"follower_username"`
+}
+
+func (UserFollowed) EventName() string { return "user.followed" }
+
+type PostCreated struct {
+	PostID    int64    `json:"id"`
+	UserID    int64    `json:"user_id"`
+	Title     string   `json:"title"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+}
+
+func (PostCreated) EventName() string { return "post.created" }
+
+// SupportTicketOpened carries the ticket as submitted, Name and Email are the requester
+type SupportTicketOpened struct {
+	TicketID int64  `json:"ticket_id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Subject  string `json:"subject"`
+	Message  string `json:"message"`
+}
+
+func (SupportTicketOpened) EventName() string { return "support.ticket_opened" }
+
+// SupportTicketAnswered carries the admin's response and the original message. UserID is
+// nil when the ticket was opened without an account.
+type SupportTicketAnswered struct {
+	TicketID int64  `json:"ticket_id"`
+	UserID   *int64 `json:"user_id,omitempty"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Subject  string `json:"subject"`
+	Message  string `json:"message"`
+	Response string `json:"response"`
+	Status   string `json:"status"`
+}
+
+func (SupportTicketAnswered) EventName() string { return "support.ticket_answered" }
+
+// NewSignIn is published when a user signs in from an IP and user agent they never used
+// before. Locale is the one of the sign-in request, the email is sent in it.
+type NewSignIn struct {
+	UserID      int64     `json:"user_id"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	DeviceID    int64     `json:"device_id"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	Locale      string    `json:"locale"`
+}
+
+func (NewSignIn) EventName() string { return "user.new_sign_in" }
+
+// SignInReported is published when a user says a sign-in from a new device was not them,
+// the password is reset by then
+type SignInReported struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	DeviceID  int64  `json:"device_id"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+func (SignInReported) EventName() string { return "user.sign_in_reported" }
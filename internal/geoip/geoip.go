@@ -0,0 +1,139 @@
+// Package geoip looks client addresses up in MaxMind databases, GeoLite2 or GeoIP2, for the
+// country and the network (ASN) they come from. The databases are read-only files the
+// operator downloads and keeps up to date, nothing is fetched at runtime.
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is where an address is registered. Fields the databases do not know are empty.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code, such as DE
+	Country      string `json:"country,omitempty"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// Empty reports whether nothing is known about the address, as for private networks
+func (location Location) Empty() bool {
+	return location.Country == "" && location.ASN == 0
+}
+
+// Network renders the ASN as AS3320 Deutsche Telekom AG, empty when it is unknown
+func (location Location) Network() string {
+	if location.ASN == 0 {
+		return ""
+	}
+	if location.Organization == "" {
+		return fmt.Sprintf("AS%d", location.ASN)
+	}
+	return fmt.Sprintf("AS%d %s", location.ASN, location.Organization)
+}
+
+// AddFields adds Country and ASN to the fields of a notification, the known ones only
+func (location Location) AddFields(fields map[string]string) {
+	if location.Country != "" {
+		fields["Country"] = location.Country
+	}
+	if network := location.Network(); network != "" {
+		fields["ASN"] = network
+	}
+}
+
+// Reader answers lookups from a country database (GeoLite2-Country or GeoLite2-City) and an
+// ASN database (GeoLite2-ASN). A nil Reader finds nothing, so callers need not check
+// whether Geo-IP is configured.
+type Reader struct {
+	country *maxminddb.Reader
+	asn     *maxminddb.Reader
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Open opens the databases at countryPath and asnPath, either may be empty. It returns nil
+// when both are, which turns Geo-IP off.
+func Open(countryPath, asnPath string) (*Reader, error) {
+	if countryPath == "" && asnPath == "" {
+		return nil, nil
+	}
+
+	reader := &Reader{}
+	if countryPath != "" {
+		db, err := maxminddb.Open(countryPath)
+		if err != nil {
+			return nil, fmt.Errorf("opening GeoIP country database: %w", err)
+		}
+		reader.country = db
+	}
+
+	if asnPath != "" {
+		db, err := maxminddb.Open(asnPath)
+		if err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("opening GeoIP ASN database: %w", err)
+		}
+		reader.asn = db
+	}
+
+	return reader, nil
+}
+
+// Lookup returns what the databases know about ip. An address that does not parse, or that
+// they have no record of, gives an empty Location.
+func (reader *Reader) Lookup(ip string) Location {
+	location := Location{}
+	if reader == nil {
+		return location
+	}
+
+	address := net.ParseIP(ip)
+	if address == nil {
+		return location
+	}
+
+	if reader.country != nil {
+		var record countryRecord
+		if err := reader.country.Lookup(address, &record); err == nil {
+			location.Country = record.Country.ISOCode
+		}
+	}
+
+	if reader.asn != nil {
+		var record asnRecord
+		if err := reader.asn.Lookup(address, &record); err == nil {
+			location.ASN, location.Organization = record.Number, record.Organization
+		}
+	}
+
+	return location
+}
+
+// Close releases the databases
+func (reader *Reader) Close() error {
+	if reader == nil {
+		return nil
+	}
+
+	var errs []error
+	if reader.country != nil {
+		errs = append(errs, reader.country.Close())
+	}
+	if reader.asn != nil {
+		errs = append(errs, reader.asn.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,167 @@
+// Package i18n translates API messages and email subjects. Each locale is a flat JSON
+// bundle in locales/ mapping a key to its text. A key is either an id such as
+// "validation.required" or the English text itself, so untranslated text falls back to
+// English without an entry in en.json.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is used when the client asks for no supported locale
+const DefaultLocale = "en"
+
+//go:embed locales
+var localesFS embed.FS
+
+type localeKey struct{}
+
+// Bundle holds the translations of every locale
+type Bundle struct {
+	messages map[string]map[string]string
+	locales  []string
+	matcher  language.Matcher
+}
+
+// bundle is loaded from the embedded locales, a broken file fails every build's tests and startup
+var bundle = mustLoad(localesFS, "locales")
+
+// Load reads every <locale>.json in dir. The default locale must be among them.
+func Load(fsys fs.FS, dir string) (*Bundle, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := &Bundle{messages: make(map[string]map[string]string, len(files))}
+
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		messages := map[string]string{}
+		if err := json.Unmarshal(content, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		locale := strings.TrimSuffix(path.Base(file), ".json")
+		loaded.messages[locale] = messages
+		loaded.locales = append(loaded.locales, locale)
+	}
+
+	if _, ok := loaded.messages[DefaultLocale]; !ok {
+		return nil, fmt.Errorf("no %s.json in %s", DefaultLocale, dir)
+	}
+
+	// the default goes first, the matcher falls back to the first tag
+	sort.Slice(loaded.locales, func(i, j int) bool {
+		if loaded.locales[i] == DefaultLocale || loaded.locales[j] == DefaultLocale {
+			return loaded.locales[i] == DefaultLocale
+		}
+		return loaded.locales[i] < loaded.locales[j]
+	})
+
+	tags := make([]language.Tag, 0, len(loaded.locales))
+	for _, locale := range loaded.locales {
+		tags = append(tags, language.Make(locale))
+	}
+	loaded.matcher = language.NewMatcher(tags)
+
+	return loaded, nil
+}
+
+func mustLoad(fsys fs.FS, dir string) *Bundle {
+	loaded, err := Load(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+// Locales lists the supported locales, the default first
+func (b *Bundle) Locales() []string {
+	return b.locales
+}
+
+// Match picks the supported locale that fits an Accept-Language header best
+func (b *Bundle) Match(acceptLanguage string) string {
+	_, index := language.MatchStrings(b.matcher, acceptLanguage)
+	return b.locales[index]
+}
+
+// T translates key into locale, falling back to the default locale and then to key itself.
+// args are name, value pairs replacing {name} in the text.
+func (b *Bundle) T(locale, key string, args ...string) string {
+	text, ok := b.messages[locale][key]
+	if !ok {
+		text, ok = b.messages[DefaultLocale][key]
+	}
+	if !ok {
+		text = key
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+args[i]+"}", args[i+1])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Has reports whether locale translates key itself, without falling back
+func (b *Bundle) Has(locale, key string) bool {
+	_, ok := b.messages[locale][key]
+	return ok
+}
+
+// Locales lists the locales of the embedded bundle
+func Locales() []string {
+	return bundle.Locales()
+}
+
+// Match picks the embedded locale that fits an Accept-Language header best
+func Match(acceptLanguage string) string {
+	return bundle.Match(acceptLanguage)
+}
+
+// T translates key with the embedded bundle, see Bundle.T
+func T(locale, key string, args ...string) string {
+	return bundle.T(locale, key, args...)
+}
+
+// Has reports whether the embedded bundle translates key into locale
+func Has(locale, key string) bool {
+	return bundle.Has(locale, key)
+}
+
+// WithLocale returns a copy of ctx carrying the locale of the request
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// FromContext returns the locale of ctx, DefaultLocale when there is none
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// Translate translates key into the locale of ctx
+func Translate(ctx context.Context, key string, args ...string) string {
+	return bundle.T(FromContext(ctx), key, args...)
+}
@@ -0,0 +1,60 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Thumbnail center crops src to a square and scales it to size x size. Each output pixel
+// averages the source pixels it covers, which keeps downscaled photos free of aliasing.
+func Thumbnail(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	// Working on RGBA keeps the inner loop free of interface calls
+	rgba := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(rgba, rgba.Bounds(), src, crop.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	scale := float64(side) / float64(size)
+
+	for y := 0; y < size; y++ {
+		y0 := int(float64(y) * scale)
+		y1 := max(int(float64(y+1)*scale), y0+1)
+
+		for x := 0; x < size; x++ {
+			x0 := int(float64(x) * scale)
+			x1 := max(int(float64(x+1)*scale), x0+1)
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1 && sy < side; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1 && sx < side; sx++ {
+					r += uint64(rgba.Pix[offset])
+					g += uint64(rgba.Pix[offset+1])
+					b += uint64(rgba.Pix[offset+2])
+					a += uint64(rgba.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+
+			if count == 0 {
+				continue
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / count),
+				G: uint8(g / count),
+				B: uint8(b / count),
+				A: uint8(a / count),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,270 @@
+// Package ipaccess decides which client addresses may reach the API. The deny list refuses
+// abusive networks on every route, the allow list limits the admin routes to known ones.
+// Both combine networks from the environment with rules added at runtime, which a Store
+// keeps so every instance sees them.
+package ipaccess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// List names one of the two lists
+type List string
+
+const (
+	// Allow limits the admin routes to its networks, nobody is limited while it is empty
+	Allow List = "allow"
+	// Deny refuses its networks on every route
+	Deny List = "deny"
+)
+
+var (
+	ErrUnknownList    = errors.New("ip list must be allow or deny")
+	ErrInvalidNetwork = errors.New("network must be an IP address or a CIDR such as 203.0.113.0/24")
+)
+
+// ParseList checks the name of a list
+func ParseList(value string) (List, error) {
+	switch list := List(value); list {
+	case Allow, Deny:
+		return list, nil
+	default:
+		return "", ErrUnknownList
+	}
+}
+
+// Rule is a network added to a list at runtime
+type Rule struct {
+	// Network is in canonical CIDR form, a single address is a /32 or a /128
+	Network   string     `json:"network"`
+	Note      string     `json:"note,omitempty"`
+	CreatedBy int64      `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the rule no longer applies at now
+func (rule Rule) Expired(now time.Time) bool {
+	return rule.ExpiresAt != nil && !now.Before(*rule.ExpiresAt)
+}
+
+// Store keeps the runtime rules of both lists
+type Store interface {
+	// Rules returns the rules of list that have not expired, oldest first
+	Rules(ctx context.Context, list List) ([]Rule, error)
+	// Add adds rule to list, replacing a rule for the same network
+	Add(ctx context.Context, list List, rule Rule) error
+	// Remove removes the rule for network and reports whether there was one
+	Remove(ctx context.Context, list List, network string) (bool, error)
+}
+
+// ParseNetwork reads a CIDR or a single address. The network comes back masked, so
+// 10.1.2.3/8 and 10.0.0.0/8 are the same rule.
+func ParseNetwork(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+
+	if !strings.Contains(value, "/") {
+		address, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%w: %q", ErrInvalidNetwork, value)
+		}
+		address = address.Unmap()
+		return netip.PrefixFrom(address, address.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w: %q", ErrInvalidNetwork, value)
+	}
+	prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-unmappedBits(prefix.Addr()))
+	if !prefix.IsValid() {
+		return netip.Prefix{}, fmt.Errorf("%w: %q", ErrInvalidNetwork, value)
+	}
+	return prefix.Masked(), nil
+}
+
+// unmappedBits is what unmapping an IPv4-mapped IPv6 address takes off the prefix length
+func unmappedBits(address netip.Addr) int {
+	if address.Is4In6() {
+		return 96
+	}
+	return 0
+}
+
+// entry is a network the Checker matches, with the expiry of its rule
+type entry struct {
+	prefix    netip.Prefix
+	expiresAt *time.Time
+}
+
+func (e entry) contains(address netip.Addr, now time.Time) bool {
+	if e.expiresAt != nil && !now.Before(*e.expiresAt) {
+		return false
+	}
+	return e.prefix.Contains(address)
+}
+
+// Checker matches client addresses against the lists. The networks from the environment
+// are fixed, the runtime rules are copied from the Store by Reload so requests never wait
+// on it.
+type Checker struct {
+	store      Store
+	configured map[List][]netip.Prefix
+
+	mu    sync.RWMutex
+	rules map[List][]entry
+}
+
+// NewChecker returns a Checker for store with the configured allow and deny networks
+func NewChecker(store Store, allow, deny []string) (*Checker, error) {
+	checker := &Checker{
+		store:      store,
+		configured: map[List][]netip.Prefix{},
+		rules:      map[List][]entry{},
+	}
+
+	for list, values := range map[List][]string{Allow: allow, Deny: deny} {
+		for _, value := range values {
+			prefix, err := ParseNetwork(value)
+			if err != nil {
+				return nil, err
+			}
+			checker.configured[list] = append(checker.configured[list], prefix)
+		}
+	}
+
+	return checker, nil
+}
+
+// Store is where the runtime rules are kept
+func (checker *Checker) Store() Store {
+	return checker.store
+}
+
+// Configured returns the networks of list that come from the environment
+func (checker *Checker) Configured(list List) []string {
+	networks := make([]string, 0, len(checker.configured[list]))
+	for _, prefix := range checker.configured[list] {
+		networks = append(networks, prefix.String())
+	}
+	return networks
+}
+
+// Reload copies the runtime rules from the Store. When it fails the previous rules stay.
+func (checker *Checker) Reload(ctx context.Context) error {
+	rules := map[List][]entry{}
+
+	for _, list := range []List{Allow, Deny} {
+		listRules, err := checker.store.Rules(ctx, list)
+		if err != nil {
+			return fmt.Errorf("loading the %s list: %w", list, err)
+		}
+
+		for _, rule := range listRules {
+			prefix, err := ParseNetwork(rule.Network)
+			if err != nil {
+				continue
+			}
+			rules[list] = append(rules[list], entry{prefix: prefix, expiresAt: rule.ExpiresAt})
+		}
+	}
+
+	checker.mu.Lock()
+	checker.rules = rules
+	checker.mu.Unlock()
+
+	return nil
+}
+
+// Denied reports whether ip is on the deny list
+func (checker *Checker) Denied(ip string) bool {
+	address, ok := ParseAddr(ip)
+	if !ok {
+		return false
+	}
+	return checker.matches(Deny, address, netip.Prefix{})
+}
+
+// Allowed reports whether ip may reach the admin routes, which everybody may while the
+// allow list is empty. An address that does not parse is only allowed then.
+func (checker *Checker) Allowed(ip string) bool {
+	return checker.AllowedWithout(ip, netip.Prefix{})
+}
+
+// AllowedWith is Allowed as if network had been added to the allow list
+func (checker *Checker) AllowedWith(ip string, network netip.Prefix) bool {
+	address, ok := ParseAddr(ip)
+	if !ok {
+		return false
+	}
+	return network.Contains(address) || checker.matches(Allow, address, netip.Prefix{})
+}
+
+// AllowedWithout is Allowed as if the rule for network had been removed, so an admin can
+// be kept from locking themselves out
+func (checker *Checker) AllowedWithout(ip string, network netip.Prefix) bool {
+	if checker.empty(Allow, network) {
+		return true
+	}
+
+	address, ok := ParseAddr(ip)
+	if !ok {
+		return false
+	}
+	return checker.matches(Allow, address, network)
+}
+
+// matches reports whether a network of list other than skip contains address
+func (checker *Checker) matches(list List, address netip.Addr, skip netip.Prefix) bool {
+	for _, prefix := range checker.configured[list] {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+
+	now := time.Now()
+
+	checker.mu.RLock()
+	defer checker.mu.RUnlock()
+
+	for _, rule := range checker.rules[list] {
+		if rule.prefix != skip && rule.contains(address, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// empty reports whether list has no network in force other than skip
+func (checker *Checker) empty(list List, skip netip.Prefix) bool {
+	if len(checker.configured[list]) > 0 {
+		return false
+	}
+
+	now := time.Now()
+
+	checker.mu.RLock()
+	defer checker.mu.RUnlock()
+
+	for _, rule := range checker.rules[list] {
+		if rule.prefix != skip && (rule.expiresAt == nil || now.Before(*rule.expiresAt)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAddr reads a client address, an IPv4-mapped IPv6 one as IPv4
+func ParseAddr(ip string) (netip.Addr, bool) {
+	address, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return address.Unmap(), true
+}
@@ -0,0 +1,69 @@
+package ipaccess
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the rules in the process, for a single instance without Redis. They
+// are lost on restart.
+type MemoryStore struct {
+	mu    sync.Mutex
+	rules map[List]map[string]Rule
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{rules: map[List]map[string]Rule{}}
+}
+
+func (store *MemoryStore) Rules(_ context.Context, list List) ([]Rule, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	rules := []Rule{}
+	for network, rule := range store.rules[list] {
+		if rule.Expired(now) {
+			delete(store.rules[list], network)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	sortRules(rules)
+	return rules, nil
+}
+
+func (store *MemoryStore) Add(_ context.Context, list List, rule Rule) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.rules[list] == nil {
+		store.rules[list] = map[string]Rule{}
+	}
+	store.rules[list][rule.Network] = rule
+	return nil
+}
+
+func (store *MemoryStore) Remove(_ context.Context, list List, network string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.rules[list][network]; !ok {
+		return false, nil
+	}
+	delete(store.rules[list], network)
+	return true, nil
+}
+
+// sortRules orders rules oldest first, by network when they were added at the same time
+func sortRules(rules []Rule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if !rules[i].CreatedAt.Equal(rules[j].CreatedAt) {
+			return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+		}
+		return rules[i].Network < rules[j].Network
+	})
+}
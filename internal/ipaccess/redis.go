@@ -0,0 +1,72 @@
+package ipaccess
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore keeps each list in a hash of JSON encoded rules keyed by network, shared by
+// every instance. Expired rules are dropped when the list is read.
+type RedisStore struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+func NewRedisStore(rdb *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{rdb: rdb, prefix: prefix}
+}
+
+func (store *RedisStore) Rules(ctx context.Context, list List) ([]Rule, error) {
+	values, err := store.rdb.HGetAll(ctx, store.key(list)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rules := []Rule{}
+	var expired []string
+	for network, value := range values {
+		var rule Rule
+		if err := json.Unmarshal([]byte(value), &rule); err != nil {
+			return nil, err
+		}
+		if rule.Expired(now) {
+			expired = append(expired, network)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	if len(expired) > 0 {
+		if err := store.rdb.HDel(ctx, store.key(list), expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sortRules(rules)
+	return rules, nil
+}
+
+func (store *RedisStore) Add(ctx context.Context, list List, rule Rule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	return store.rdb.HSet(ctx, store.key(list), rule.Network, data).Err()
+}
+
+func (store *RedisStore) Remove(ctx context.Context, list List, network string) (bool, error) {
+	removed, err := store.rdb.HDel(ctx, store.key(list), network).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+func (store *RedisStore) key(list List) string {
+	return store.prefix + string(list)
+}
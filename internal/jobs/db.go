@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// Store keeps the jobs table, store.JobStore implements it
+type Store interface {
+	Enqueue(ctx context.Context, job *models.Job) error
+	ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.Job, error)
+	MarkDone(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration) error
+	// CountByStatus counts the jobs by models.Job* status
+	CountByStatus(ctx context.Context) (map[string]int64, error)
+}
+
+// DBQueue keeps the jobs in the database. Every instance claims from the same table, and
+// the failed jobs stay in it with their last error.
+type DBQueue struct {
+	store Store
+}
+
+func NewDBQueue(store Store) *DBQueue {
+	return &DBQueue{store: store}
+}
+
+func (queue *DBQueue) Push(ctx context.Context, envelope Envelope) error {
+	return queue.store.Enqueue(ctx, &models.Job{
+		JobID:       envelope.ID,
+		Name:        envelope.Name,
+		Priority:    int(envelope.Priority),
+		Payload:     envelope.Payload,
+		MaxAttempts: envelope.MaxAttempts,
+		RunAt:       envelope.RunAt,
+	})
+}
+
+func (queue *DBQueue) Claim(ctx context.Context, lease time.Duration) (*Envelope, error) {
+	claimed, err := queue.store.ClaimDue(ctx, uuid.NewString(), 1, lease)
+	if err != nil || len(claimed) == 0 {
+		return nil, err
+	}
+
+	job := claimed[0]
+	return &Envelope{
+		ID:          job.JobID,
+		Name:        job.Name,
+		Priority:    Priority(job.Priority),
+		Attempts:    job.Attempts,
+		MaxAttempts: job.MaxAttempts,
+		RunAt:       job.RunAt,
+		Payload:     job.Payload,
+		LastError:   job.LastError,
+		receipt:     strconv.FormatInt(job.ID, 10),
+	}, nil
+}
+
+func (queue *DBQueue) Done(ctx context.Context, envelope *Envelope) error {
+	id, err := strconv.ParseInt(envelope.receipt, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	return queue.store.MarkDone(ctx, id)
+}
+
+func (queue *DBQueue) Retry(ctx context.Context, envelope *Envelope, retryIn time.Duration) error {
+	id, err := strconv.ParseInt(envelope.receipt, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	return queue.store.MarkFailed(ctx, id, envelope.LastError, retryIn)
+}
+
+// Fail keeps the job in the table as failed
+func (queue *DBQueue) Fail(ctx context.Context, envelope *Envelope) error {
+	id, err := strconv.ParseInt(envelope.receipt, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	return queue.store.MarkFailed(ctx, id, envelope.LastError, 0)
+}
+
+func (queue *DBQueue) Persistent() bool {
+	return true
+}
+
+func (queue *DBQueue) Depth(ctx context.Context) (Depth, error) {
+	counts, err := queue.store.CountByStatus(ctx)
+	if err != nil {
+		return Depth{}, err
+	}
+
+	return Depth{
+		Pending: counts[models.JobPending],
+		Running: counts[models.JobRunning],
+		Failed:  counts[models.JobFailed],
+	}, nil
+}
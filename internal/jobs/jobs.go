@@ -0,0 +1,428 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Backends picked with JOBS_BACKEND
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+	BackendDB     = "db"
+)
+
+// Priority orders the due jobs, the higher ones run first
+type Priority int
+
+const (
+	PriorityLow    Priority = 0
+	PriorityNormal Priority = 1
+	PriorityHigh   Priority = 2
+)
+
+const (
+	// DefaultMaxAttempts applies to the job types registered without MaxAttempts
+	DefaultMaxAttempts = 5
+	// DefaultTimeout bounds one attempt of the job types registered without Timeout
+	DefaultTimeout = time.Minute
+	// leaseDuration is how long a claimed job stays with this instance before another one
+	// may run it again, well above the longest Timeout a job type should have
+	leaseDuration = time.Minute * 10
+	// pollInterval is how often the pool looks for jobs pushed by other instances or
+	// becoming due. Jobs enqueued on this instance wake it up right away.
+	pollInterval = time.Second
+	// drainTimeout bounds how long Stop keeps running the jobs of a queue that is not
+	// persistent
+	drainTimeout = time.Second * 10
+)
+
+// Backoff is the wait after each failed attempt, the last entry repeats for the attempts
+// beyond it
+var Backoff = []time.Duration{
+	time.Second * 10,
+	time.Minute,
+	time.Minute * 5,
+	time.Minute * 30,
+}
+
+var (
+	ErrQueueFull  = errors.New("job queue is full")
+	ErrUnknownJob = errors.New("no handler registered for job")
+	errPermanent  = errors.New("permanent failure")
+)
+
+// Job is a unit of background work, its name is the same for every value of the type.
+// It is stored as JSON, so it must survive a round trip through encoding/json.
+type Job interface {
+	JobName() string
+}
+
+// Envelope is a job on its way to its handler, Payload holds the JSON of the job
+type Envelope struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Priority    Priority        `json:"priority"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	Payload     json.RawMessage `json:"payload"`
+	LastError   string          `json:"last_error,omitempty"`
+
+	// receipt is what the queue needs to settle the claimed envelope, the member in Redis
+	// or the row id in the database
+	receipt string
+}
+
+// Queue keeps the envelopes until a pool claims them. Claim counts the attempt and
+// leases the envelope: one that is not settled with Done, Retry or Fail before the lease
+// ends is claimed again.
+type Queue interface {
+	Push(ctx context.Context, envelope Envelope) error
+	// Claim returns the next due envelope, the highest priority first, or nil when none is due
+	Claim(ctx context.Context, lease time.Duration) (*Envelope, error)
+	Done(ctx context.Context, envelope *Envelope) error
+	Retry(ctx context.Context, envelope *Envelope, retryIn time.Duration) error
+	Fail(ctx context.Context, envelope *Envelope) error
+	// Persistent reports whether the envelopes outlive the instance
+	Persistent() bool
+	// Depth counts the envelopes in the queue, of every instance for a shared queue
+	Depth(ctx context.Context) (Depth, error)
+}
+
+// Depth counts the envelopes of a queue by state
+type Depth struct {
+	// Pending are waiting to be claimed, due or not
+	Pending int64 `json:"pending"`
+	// Running are claimed and leased
+	Running int64 `json:"running"`
+	// Failed ran out of attempts and are kept for debugging, a queue that drops them has none
+	Failed int64 `json:"failed"`
+}
+
+// Options apply to every job of a type
+type Options struct {
+	// Priority is used when Enqueue is not given one
+	Priority Priority
+	// MaxAttempts counts the first attempt, 1 never retries
+	MaxAttempts int
+	// Timeout bounds one attempt through the context of the handler
+	Timeout time.Duration
+}
+
+type handlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+type registration struct {
+	handle  handlerFunc
+	options Options
+}
+
+// EnqueueOption changes one job, see WithPriority and WithDelay
+type EnqueueOption func(*Envelope)
+
+// WithPriority overrides the priority the job type was registered with
+func WithPriority(priority Priority) EnqueueOption {
+	return func(envelope *Envelope) {
+		envelope.Priority = priority
+	}
+}
+
+// WithDelay makes the job due after delay
+func WithDelay(delay time.Duration) EnqueueOption {
+	return func(envelope *Envelope) {
+		envelope.RunAt = envelope.RunAt.Add(delay)
+	}
+}
+
+// Permanent wraps an error a retry cannot fix, the job fails without further attempts
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", errPermanent, err)
+}
+
+// Pool runs the jobs of a queue on up to workers goroutines. With a shared queue every
+// instance can run a pool and each job is run by whichever claims it.
+type Pool struct {
+	queue    Queue
+	workers  int
+	logger   *zap.SugaredLogger
+	mu       sync.RWMutex
+	handlers map[string]registration
+	running  bool
+	idle     chan int
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stats    *poolStats
+}
+
+func NewPool(queue Queue, workers int, logger *zap.SugaredLogger) *Pool {
+	if workers <= 0 {
+		workers = 3
+	}
+
+	return &Pool{
+		queue:    queue,
+		workers:  workers,
+		logger:   logger,
+		handlers: map[string]registration{},
+		wake:     make(chan struct{}, 1),
+		stats:    newPoolStats(workers),
+	}
+}
+
+// Register runs handler for every J the pool claims. Register every job type before
+// Start, a job claimed before its type is registered fails.
+func Register[J Job](pool *Pool, options Options, handler func(context.Context, J) error) {
+	var zero J
+	name := zero.JobName()
+
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultMaxAttempts
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.handlers[name] = registration{
+		options: options,
+		handle: func(ctx context.Context, payload json.RawMessage) error {
+			var job J
+			// numbers stay json.Number, so the ones in untyped fields print as they were
+			decoder := json.NewDecoder(bytes.NewReader(payload))
+			decoder.UseNumber()
+			if err := decoder.Decode(&job); err != nil {
+				return Permanent(fmt.Errorf("decoding %s: %w", name, err))
+			}
+			return handler(ctx, job)
+		},
+	}
+}
+
+// Enqueue queues job with the options of its type. The job runs after the caller
+// returns, it does not see the context of the request that queued it.
+func (pool *Pool) Enqueue(ctx context.Context, job Job, opts ...EnqueueOption) error {
+	name := job.JobName()
+
+	pool.mu.RLock()
+	registered, ok := pool.handlers[name]
+	pool.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownJob, name)
+	}
+
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	envelope := Envelope{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Priority:    registered.options.Priority,
+		MaxAttempts: registered.options.MaxAttempts,
+		RunAt:       time.Now().UTC(),
+		Payload:     payload,
+	}
+	for _, opt := range opts {
+		opt(&envelope)
+	}
+	envelope.Priority = min(max(envelope.Priority, PriorityLow), PriorityHigh)
+
+	if err := pool.queue.Push(ctx, envelope); err != nil {
+		return fmt.Errorf("queueing %s: %w", name, err)
+	}
+
+	select {
+	case pool.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Start claims and runs jobs until Stop is called
+func (pool *Pool) Start() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.running {
+		return
+	}
+
+	pool.running = true
+	pool.stop = make(chan struct{})
+	pool.done = make(chan struct{})
+	pool.idle = make(chan int, pool.workers)
+	for worker := range pool.workers {
+		pool.idle <- worker
+	}
+
+	go pool.loop()
+}
+
+// Stop ends claiming and waits for the jobs in flight. The due jobs of a queue that is
+// not persistent are run first, for up to drainTimeout.
+func (pool *Pool) Stop() {
+	pool.mu.Lock()
+	if !pool.running {
+		pool.mu.Unlock()
+		return
+	}
+	pool.running = false
+	close(pool.stop)
+	pool.mu.Unlock()
+
+	<-pool.done
+	pool.wg.Wait()
+}
+
+func (pool *Pool) loop() {
+	defer close(pool.done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var worker int
+	for {
+		select {
+		case <-pool.stop:
+			if !pool.queue.Persistent() {
+				pool.drain()
+			}
+			return
+		case worker = <-pool.idle:
+		}
+
+		envelope, err := pool.queue.Claim(context.Background(), leaseDuration)
+		if err != nil {
+			pool.logger.Errorw("failed to claim job", "error", err)
+		}
+		if envelope == nil {
+			pool.idle <- worker
+			select {
+			case <-pool.stop:
+			case <-pool.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		pool.wg.Add(1)
+		go func(worker int) {
+			defer pool.wg.Done()
+			defer func() { pool.idle <- worker }()
+			pool.run(worker, envelope)
+		}(worker)
+	}
+}
+
+// drain runs the jobs that are due until none is left or drainTimeout passes
+func (pool *Pool) drain() {
+	deadline := time.Now().Add(drainTimeout)
+
+	for time.Now().Before(deadline) {
+		var worker int
+		select {
+		case worker = <-pool.idle:
+		case <-time.After(time.Until(deadline)):
+			return
+		}
+
+		envelope, err := pool.queue.Claim(context.Background(), leaseDuration)
+		if err != nil || envelope == nil {
+			pool.idle <- worker
+			return
+		}
+
+		pool.wg.Add(1)
+		go func(worker int) {
+			defer pool.wg.Done()
+			defer func() { pool.idle <- worker }()
+			pool.run(worker, envelope)
+		}(worker)
+	}
+}
+
+// run makes one attempt on worker, Attempts already counts it, and settles the envelope
+func (pool *Pool) run(worker int, envelope *Envelope) {
+	ctx := context.Background()
+
+	started := time.Now()
+	pool.stats.start(worker)
+
+	pool.mu.RLock()
+	registered, ok := pool.handlers[envelope.Name]
+	pool.mu.RUnlock()
+
+	var err error
+	if ok {
+		err = pool.handle(registered, envelope)
+	} else {
+		err = Permanent(ErrUnknownJob)
+	}
+
+	if err == nil {
+		pool.stats.finish(worker, envelope.Name, outcomeSucceeded, time.Since(started), nil)
+		if err := pool.queue.Done(ctx, envelope); err != nil {
+			pool.logger.Errorw("failed to record finished job", "jobID", envelope.ID, "job", envelope.Name, "error", err)
+		}
+		return
+	}
+
+	envelope.LastError = err.Error()
+
+	if errors.Is(err, errPermanent) || envelope.Attempts >= envelope.MaxAttempts {
+		pool.stats.finish(worker, envelope.Name, outcomeFailed, time.Since(started), err)
+		pool.logger.Errorw("job failed",
+			"jobID", envelope.ID,
+			"job", envelope.Name,
+			"attempts", envelope.Attempts,
+			"error", err,
+		)
+		if err := pool.queue.Fail(ctx, envelope); err != nil {
+			pool.logger.Errorw("failed to record failed job", "jobID", envelope.ID, "job", envelope.Name, "error", err)
+		}
+		return
+	}
+
+	retryIn := Backoff[min(envelope.Attempts, len(Backoff))-1]
+	pool.stats.finish(worker, envelope.Name, outcomeRetried, time.Since(started), err)
+
+	pool.logger.Warnw("job attempt failed",
+		"jobID", envelope.ID,
+		"job", envelope.Name,
+		"attempt", envelope.Attempts,
+		"retryIn", retryIn,
+		"error", err,
+	)
+
+	if err := pool.queue.Retry(ctx, envelope, retryIn); err != nil {
+		pool.logger.Errorw("failed to record job retry", "jobID", envelope.ID, "job", envelope.Name, "error", err)
+	}
+}
+
+// handle runs the handler within the timeout of its type, a panic counts as a failure
+func (pool *Pool) handle(registered registration, envelope *Envelope) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), registered.options.Timeout)
+	defer cancel()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+
+	return registered.handle(ctx, envelope.Payload)
+}
@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryQueue keeps the jobs in memory, they are run by the instance that queued them
+// and lost if it stops before running them
+type MemoryQueue struct {
+	mu        sync.Mutex
+	size      int
+	envelopes []*Envelope
+	// running counts the claimed envelopes that are not settled yet
+	running int64
+}
+
+func NewMemoryQueue(size int) *MemoryQueue {
+	if size <= 0 {
+		size = 100
+	}
+
+	return &MemoryQueue{size: size}
+}
+
+// Push never blocks, a full queue is ErrQueueFull
+func (queue *MemoryQueue) Push(_ context.Context, envelope Envelope) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if len(queue.envelopes) >= queue.size {
+		return ErrQueueFull
+	}
+	queue.envelopes = append(queue.envelopes, &envelope)
+
+	return nil
+}
+
+// Claim takes the due envelope with the highest priority, the one due first among equals.
+// Nothing else can claim it, so the lease is not needed.
+func (queue *MemoryQueue) Claim(_ context.Context, _ time.Duration) (*Envelope, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	current := time.Now()
+	next := -1
+	for i, envelope := range queue.envelopes {
+		if envelope.RunAt.After(current) {
+			continue
+		}
+		if next == -1 || envelope.Priority > queue.envelopes[next].Priority ||
+			(envelope.Priority == queue.envelopes[next].Priority && envelope.RunAt.Before(queue.envelopes[next].RunAt)) {
+			next = i
+		}
+	}
+	if next == -1 {
+		return nil, nil
+	}
+
+	envelope := queue.envelopes[next]
+	queue.envelopes = append(queue.envelopes[:next], queue.envelopes[next+1:]...)
+	envelope.Attempts++
+	queue.running++
+
+	return envelope, nil
+}
+
+func (queue *MemoryQueue) Done(context.Context, *Envelope) error {
+	queue.settle()
+	return nil
+}
+
+// Retry queues the envelope again even when the queue is full, it was in it already
+func (queue *MemoryQueue) Retry(_ context.Context, envelope *Envelope, retryIn time.Duration) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	envelope.RunAt = time.Now().UTC().Add(retryIn)
+	queue.envelopes = append(queue.envelopes, envelope)
+	queue.running--
+
+	return nil
+}
+
+// Fail drops the envelope, the pool has logged it
+func (queue *MemoryQueue) Fail(context.Context, *Envelope) error {
+	queue.settle()
+	return nil
+}
+
+func (queue *MemoryQueue) Persistent() bool {
+	return false
+}
+
+// Depth has no failed envelopes, Fail drops them
+func (queue *MemoryQueue) Depth(context.Context) (Depth, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	return Depth{Pending: int64(len(queue.envelopes)), Running: queue.running}, nil
+}
+
+func (queue *MemoryQueue) settle() {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	queue.running--
+}
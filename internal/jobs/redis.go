@@ -0,0 +1,171 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// redisCandidates is how many due jobs one claim looks at to find the highest priority
+	redisCandidates = 50
+	// redisFailedKeep is how many failed jobs are kept for debugging
+	redisFailedKeep = 1000
+)
+
+// moveScript moves ARGV[1] from the sorted set KEYS[1] to KEYS[2] as ARGV[3] with the score
+// ARGV[2]. Only the caller that still finds the member moves it, so two instances never
+// claim the same job.
+var moveScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[3])
+return 1
+`)
+
+// RedisQueue keeps the jobs in sorted sets scored by when they are due. The instances
+// share the queue, each job is run by whichever claims it.
+type RedisQueue struct {
+	rdb    *redis.Client
+	ready  string
+	leased string
+	failed string
+}
+
+func NewRedisQueue(rdb *redis.Client, prefix string) *RedisQueue {
+	return &RedisQueue{
+		rdb:    rdb,
+		ready:  prefix + ":ready",
+		leased: prefix + ":leased",
+		failed: prefix + ":failed",
+	}
+}
+
+func (queue *RedisQueue) Push(ctx context.Context, envelope Envelope) error {
+	member, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return queue.rdb.ZAdd(ctx, queue.ready, &redis.Z{Score: score(envelope.RunAt), Member: string(member)}).Err()
+}
+
+// Claim first puts the jobs whose lease ran out back in the queue, then leases the due job
+// with the highest priority
+func (queue *RedisQueue) Claim(ctx context.Context, lease time.Duration) (*Envelope, error) {
+	current := time.Now()
+	due := &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(current.UnixMilli(), 10), Count: redisCandidates}
+
+	expired, err := queue.rdb.ZRangeByScore(ctx, queue.leased, due).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range expired {
+		if err := queue.move(ctx, queue.leased, queue.ready, member, current, member); err != nil {
+			return nil, err
+		}
+	}
+
+	members, err := queue.rdb.ZRangeByScore(ctx, queue.ready, due).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]*Envelope, 0, len(members))
+	for _, member := range members {
+		envelope := &Envelope{}
+		if err := json.Unmarshal([]byte(member), envelope); err != nil {
+			// not something Push wrote, leave it out of the queue
+			queue.rdb.ZRem(ctx, queue.ready, member)
+			continue
+		}
+		envelope.receipt = member
+		candidates = append(candidates, envelope)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Priority > candidates[j].Priority
+	})
+
+	for _, envelope := range candidates {
+		envelope.Attempts++
+		leasedMember, err := json.Marshal(envelope)
+		if err != nil {
+			return nil, err
+		}
+
+		moved, err := moveScript.Run(ctx, queue.rdb, []string{queue.ready, queue.leased},
+			envelope.receipt, score(current.Add(lease)), string(leasedMember)).Int()
+		if err != nil {
+			return nil, err
+		}
+		if moved == 0 {
+			// another instance claimed it first
+			continue
+		}
+
+		envelope.receipt = string(leasedMember)
+		return envelope, nil
+	}
+
+	return nil, nil
+}
+
+func (queue *RedisQueue) Done(ctx context.Context, envelope *Envelope) error {
+	return queue.rdb.ZRem(ctx, queue.leased, envelope.receipt).Err()
+}
+
+func (queue *RedisQueue) Retry(ctx context.Context, envelope *Envelope, retryIn time.Duration) error {
+	envelope.RunAt = time.Now().UTC().Add(retryIn)
+
+	member, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return queue.move(ctx, queue.leased, queue.ready, envelope.receipt, envelope.RunAt, string(member))
+}
+
+// Fail keeps the job with its last error in the failed set, trimmed to redisFailedKeep
+func (queue *RedisQueue) Fail(ctx context.Context, envelope *Envelope) error {
+	member, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	if err := queue.move(ctx, queue.leased, queue.failed, envelope.receipt, time.Now(), string(member)); err != nil {
+		return err
+	}
+
+	return queue.rdb.ZRemRangeByRank(ctx, queue.failed, 0, -redisFailedKeep-1).Err()
+}
+
+func (queue *RedisQueue) Persistent() bool {
+	return true
+}
+
+// Depth counts the sorted sets in one round trip, the failed ones are capped at redisFailedKeep
+func (queue *RedisQueue) Depth(ctx context.Context) (Depth, error) {
+	pipe := queue.rdb.Pipeline()
+	pending := pipe.ZCard(ctx, queue.ready)
+	running := pipe.ZCard(ctx, queue.leased)
+	failed := pipe.ZCard(ctx, queue.failed)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Depth{}, err
+	}
+
+	return Depth{Pending: pending.Val(), Running: running.Val(), Failed: failed.Val()}, nil
+}
+
+func (queue *RedisQueue) move(ctx context.Context, from, to, member string, at time.Time, moved string) error {
+	return moveScript.Run(ctx, queue.rdb, []string{from, to}, member, score(at), moved).Err()
+}
+
+// score orders the sorted sets by time, in milliseconds
+func score(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
@@ -0,0 +1,134 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// outcome is how one attempt ended
+type outcome int
+
+const (
+	outcomeSucceeded outcome = iota
+	outcomeRetried
+	outcomeFailed
+)
+
+// WorkerStats counts the attempts one worker of this instance made
+type WorkerStats struct {
+	ID        int  `json:"id"`
+	Busy      bool `json:"busy"`
+	Processed int  `json:"processed"`
+}
+
+// JobStats counts the attempts at one job type on this instance since it started
+type JobStats struct {
+	Name      string `json:"name"`
+	Succeeded int    `json:"succeeded"`
+	// Retried failed and were queued again
+	Retried int `json:"retried"`
+	// Failed ran out of attempts or failed permanently
+	Failed          int        `json:"failed"`
+	AverageDuration int64      `json:"average_duration_ms"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+
+	totalDuration time.Duration
+}
+
+// Stats are the counters of a pool, they start over with the instance
+type Stats struct {
+	Workers []WorkerStats `json:"workers"`
+	Jobs    []JobStats    `json:"jobs"`
+}
+
+// Job returns the counters of the job type called name, zero when none ran yet
+func (stats Stats) Job(name string) JobStats {
+	for _, job := range stats.Jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return JobStats{Name: name}
+}
+
+type poolStats struct {
+	mu      sync.Mutex
+	workers []WorkerStats
+	jobs    map[string]*JobStats
+}
+
+func newPoolStats(workers int) *poolStats {
+	stats := &poolStats{
+		workers: make([]WorkerStats, workers),
+		jobs:    map[string]*JobStats{},
+	}
+	for worker := range stats.workers {
+		stats.workers[worker].ID = worker
+	}
+	return stats
+}
+
+func (stats *poolStats) start(worker int) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.workers[worker].Busy = true
+}
+
+func (stats *poolStats) finish(worker int, name string, result outcome, duration time.Duration, err error) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.workers[worker].Busy = false
+	stats.workers[worker].Processed++
+
+	job, ok := stats.jobs[name]
+	if !ok {
+		job = &JobStats{Name: name}
+		stats.jobs[name] = job
+	}
+
+	switch result {
+	case outcomeSucceeded:
+		job.Succeeded++
+	case outcomeRetried:
+		job.Retried++
+	case outcomeFailed:
+		job.Failed++
+	}
+
+	job.totalDuration += duration
+	job.AverageDuration = (job.totalDuration / time.Duration(job.Succeeded+job.Retried+job.Failed)).Milliseconds()
+
+	if err != nil {
+		failedAt := time.Now().UTC()
+		job.LastError, job.LastErrorAt = err.Error(), &failedAt
+	}
+}
+
+// Stats returns a copy of the counters, the job types by name
+func (pool *Pool) Stats() Stats {
+	pool.stats.mu.Lock()
+	defer pool.stats.mu.Unlock()
+
+	stats := Stats{
+		Workers: append([]WorkerStats(nil), pool.stats.workers...),
+		Jobs:    make([]JobStats, 0, len(pool.stats.jobs)),
+	}
+	for _, job := range pool.stats.jobs {
+		stats.Jobs = append(stats.Jobs, *job)
+	}
+	sort.Slice(stats.Jobs, func(i, j int) bool {
+		return stats.Jobs[i].Name < stats.Jobs[j].Name
+	})
+
+	return stats
+}
+
+// Depth counts the envelopes in the queue of the pool
+func (pool *Pool) Depth(ctx context.Context) (Depth, error) {
+	return pool.queue.Depth(ctx)
+}
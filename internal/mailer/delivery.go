@@ -0,0 +1,48 @@
+package mailer
+
+// Delivery statuses reported to a DeliveryObserver
+const (
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliverySandbox = "sandbox"
+)
+
+// Delivery is the outcome of one email after the provider gave up retrying or succeeded
+type Delivery struct {
+	Provider  string
+	Template  string
+	Recipient string
+	Subject   string
+	Status    string
+	Attempts  int
+	// Response is what the provider answered, or the last error
+	Response string
+}
+
+// DeliveryObserver is called once per email, from the goroutine that sent it
+type DeliveryObserver func(Delivery)
+
+// deliveryReporter is embedded by providers to let callers observe every delivery
+type deliveryReporter struct {
+	observer DeliveryObserver
+}
+
+// Observe sets the function called after every delivery
+func (reporter *deliveryReporter) Observe(observer DeliveryObserver) {
+	reporter.observer = observer
+}
+
+func (reporter *deliveryReporter) report(delivery Delivery) {
+	if reporter.observer != nil {
+		reporter.observer(delivery)
+	}
+}
+
+func failedDelivery(delivery Delivery, attempts int, err error) Delivery {
+	delivery.Status = DeliveryFailed
+	delivery.Attempts = attempts
+	if err != nil {
+		delivery.Response = err.Error()
+	}
+	return delivery
+}
@@ -0,0 +1,233 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailoverConfig tunes the chain built when MAIL_DRIVER lists several drivers
+type FailoverConfig struct {
+	// Threshold is how many failures in a row take a provider out of rotation
+	Threshold int
+	// Cooldown is how long a provider stays out before it is tried again
+	Cooldown time.Duration
+}
+
+// ProviderStats is the health and the counters of one provider in a FailoverMailer
+type ProviderStats struct {
+	Driver              string     `json:"driver"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DownUntil           *time.Time `json:"down_until,omitempty"`
+	Sent                int64      `json:"sent"`
+	Failed              int64      `json:"failed"`
+	// Skipped counts emails that went to a lower priority provider while this one was down
+	Skipped int64 `json:"skipped"`
+}
+
+// FailoverMailer sends through the first healthy provider in priority order. A provider
+// failing Threshold times in a row is skipped for Cooldown, then gets traffic again,
+// so mail fails back to the primary on its own once it recovers.
+type FailoverMailer struct {
+	providers []*failoverProvider
+	threshold int
+	cooldown  time.Duration
+}
+
+type failoverProvider struct {
+	Provider
+	driver string
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	downUntil           time.Time
+	sent                int64
+	failed              int64
+	skipped             int64
+}
+
+// NewFailoverMailer chains providers, drivers[i] naming providers[i] in stats and logs
+func NewFailoverMailer(drivers []string, providers []Provider, cfg FailoverConfig) *FailoverMailer {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 3
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = time.Minute
+	}
+
+	chain := make([]*failoverProvider, len(providers))
+	for i, provider := range providers {
+		chain[i] = &failoverProvider{Provider: provider, driver: drivers[i]}
+	}
+
+	return &FailoverMailer{
+		providers: chain,
+		threshold: cfg.Threshold,
+		cooldown:  cfg.Cooldown,
+	}
+}
+
+func (failover *FailoverMailer) Send(templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return failover.SendWithOptions(templateFile, username, email, subject, data, SyncDelivery, isSandBox)
+}
+
+func (failover *FailoverMailer) SendWithOptions(templateFile, username, email, subject string, data any, deliveryMode string, isSandBox bool) error {
+	return failover.SendWithAttachments(templateFile, username, email, subject, data, nil, deliveryMode, isSandBox)
+}
+
+// SendAt sends an email that is due already, it cannot hold one back
+func (failover *FailoverMailer) SendAt(sendAt time.Time, templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return sendDue(sendAt, func() error {
+		return failover.Send(templateFile, username, email, subject, data, isSandBox)
+	})
+}
+
+// SendWithAttachments tries the healthy providers in order. When all of them are down it
+// tries every provider anyway rather than dropping the email.
+func (failover *FailoverMailer) SendWithAttachments(templateFile, username, email, subject string, data any, attachments []Attachment, deliveryMode string, isSandBox bool) error {
+	var errs []error
+
+	send := func(provider *failoverProvider) bool {
+		err := provider.SendWithAttachments(templateFile, username, email, subject, data, attachments, SyncDelivery, isSandBox)
+		if err == nil {
+			provider.succeeded()
+			return true
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", provider.driver, err))
+
+		// Not the provider's fault, the next one may support what this email needs
+		if errors.Is(err, ErrAttachmentsUnsupported) {
+			return false
+		}
+
+		if failures, down := provider.failedOnce(failover.threshold, failover.cooldown); down {
+			log.Printf("WARNING: mail driver %s failed %d times in a row, skipping it for %s", provider.driver, failures, failover.cooldown)
+		}
+		return false
+	}
+
+	now := time.Now()
+	attempted := false
+	for _, provider := range failover.providers {
+		if !provider.available(now) {
+			provider.skip()
+			continue
+		}
+
+		attempted = true
+		if send(provider) {
+			return nil
+		}
+	}
+
+	if !attempted {
+		log.Printf("WARNING: every mail driver is down, trying all of them for %s", email)
+		for _, provider := range failover.providers {
+			if send(provider) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("every mail driver failed: %w", errors.Join(errs...))
+}
+
+// Ping checks every provider in the chain
+func (failover *FailoverMailer) Ping() error {
+	var errs []error
+	for _, provider := range failover.providers {
+		if err := provider.Ping(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.driver, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Observe passes the observer to every provider, each reports its own deliveries
+func (failover *FailoverMailer) Observe(observer DeliveryObserver) {
+	for _, provider := range failover.providers {
+		provider.Observe(observer)
+	}
+}
+
+// Stats returns the health and the counters of each provider in priority order
+func (failover *FailoverMailer) Stats() []ProviderStats {
+	now := time.Now()
+	stats := make([]ProviderStats, len(failover.providers))
+
+	for i, provider := range failover.providers {
+		provider.mu.Lock()
+		stats[i] = ProviderStats{
+			Driver:              provider.driver,
+			Healthy:             !now.Before(provider.downUntil),
+			ConsecutiveFailures: provider.consecutiveFailures,
+			Sent:                provider.sent,
+			Failed:              provider.failed,
+			Skipped:             provider.skipped,
+		}
+		if !stats[i].Healthy {
+			downUntil := provider.downUntil
+			stats[i].DownUntil = &downUntil
+		}
+		provider.mu.Unlock()
+	}
+
+	return stats
+}
+
+func (provider *failoverProvider) available(now time.Time) bool {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	return !now.Before(provider.downUntil)
+}
+
+func (provider *failoverProvider) skip() {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	provider.skipped++
+}
+
+func (provider *failoverProvider) succeeded() {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if !provider.downUntil.IsZero() {
+		log.Printf("mail driver %s recovered", provider.driver)
+	}
+	provider.sent++
+	provider.consecutiveFailures = 0
+	provider.downUntil = time.Time{}
+}
+
+// failedOnce records a failure and reports whether it took the provider out of rotation.
+// Past the threshold a single failure is enough, so a provider that is still broken
+// after its cooldown goes straight back out.
+func (provider *failoverProvider) failedOnce(threshold int, cooldown time.Duration) (int, bool) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	provider.failed++
+	provider.consecutiveFailures++
+	if provider.consecutiveFailures < threshold {
+		return provider.consecutiveFailures, false
+	}
+
+	provider.downUntil = time.Now().Add(cooldown)
+	return provider.consecutiveFailures, true
+}
+
+// Chain lists the drivers of a comma separated MAIL_DRIVER value in priority order
+func Chain(driver string) []string {
+	var drivers []string
+	for _, name := range strings.Split(driver, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			drivers = append(drivers, name)
+		}
+	}
+	return drivers
+}
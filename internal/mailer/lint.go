@@ -0,0 +1,134 @@
+package mailer
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Opt-out categories, users can turn off the emails of a category in their settings
+const (
+	CategoryCampaigns = "campaigns"
+	CategoryReminders = "reminders"
+	CategoryDigest    = "digest"
+)
+
+// OptOutCategories lists every category, emails without one are always sent
+var OptOutCategories = []string{CategoryCampaigns, CategoryReminders, CategoryDigest}
+
+// TemplateSpec is what the callers of a template pass in, the template may only use these fields
+type TemplateSpec struct {
+	Fields []string
+	// Category is the opt-out category of the emails, empty for the ones users cannot turn off
+	Category string
+}
+
+// Templates lists every template in FS with the data fields its callers provide. Add an
+// entry with each new template, LintTemplates reports the ones missing here.
+var Templates = map[string]TemplateSpec{
+	UserWelcomeTemplate:          {Fields: []string{"Username", "OtpCode", "OTPExp", "Subject"}},
+	PasswordChangedTemplate:      {Fields: []string{"Username", "ChangedAt", "Subject"}},
+	SupportTicketTemplate:        {Fields: []string{"TicketID", "Name", "Email", "Subject", "Message"}},
+	SupportResponseTemplate:      {Fields: []string{"TicketID", "Username", "Subject", "Response", "Message"}},
+	VerificationReminderTemplate: {Fields: []string{"Username", "OtpCode", "OTPExp", "DeleteAt", "Subject"}, Category: CategoryReminders},
+	AnnouncementTemplate:         {Fields: []string{"Username", "Subject", "Message"}, Category: CategoryCampaigns},
+	InvitationTemplate:           {Fields: []string{"Email", "Role", "InviteURL", "ExpiresAt", "Subject"}},
+	WeeklyDigestTemplate:         {Fields: []string{"Username", "Subject", "PeriodStart", "PeriodEnd", "NewFollowers", "NewPosts", "Followers", "Posts"}, Category: CategoryDigest},
+	NewSignInTemplate:            {Fields: []string{"Username", "Subject", "SignedInAt", "IP", "UserAgent", "ReportURL"}},
+}
+
+// CampaignTemplates are the templates an email campaign can use, each renders only the
+// Username, Subject and Message fields a campaign provides
+var CampaignTemplates = []string{AnnouncementTemplate}
+
+// requiredBlocks must be defined by every template, without "subject" the email goes out
+// as "Message for <username>"
+var requiredBlocks = []string{"subject", "body"}
+
+// LintTemplates checks every embedded template and translation against Templates: it must be
+// registered, define the required blocks, render a non-empty subject and only use fields callers
+// provide.
+func LintTemplates() []error {
+	files, err := fs.Glob(FS, "templates/*.tmpl")
+	if err != nil {
+		return []error{err}
+	}
+
+	// translations live in templates/<locale>/ under the name of the template they translate
+	localized, err := fs.Glob(FS, "templates/*/*.tmpl")
+	if err != nil {
+		return []error{err}
+	}
+
+	embedded := make(map[string]bool, len(files))
+	var errs []error
+
+	for _, file := range append(files, localized...) {
+		name := strings.TrimPrefix(file, "templates/")
+		embedded[name] = true
+
+		spec, ok := Templates[path.Base(name)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: not registered in mailer.Templates", name))
+			continue
+		}
+
+		errs = append(errs, lintTemplate(name, spec)...)
+	}
+
+	for name := range Templates {
+		if !embedded[name] {
+			errs = append(errs, fmt.Errorf("%s: registered but not found in templates/", name))
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	return errs
+}
+
+func lintTemplate(name string, spec TemplateSpec) []error {
+	t, err := template.ParseFS(FS, path.Join("templates", name))
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", name, err)}
+	}
+
+	return lintParsed(name, t, spec)
+}
+
+func lintParsed(name string, t *template.Template, spec TemplateSpec) []error {
+	// a map with exactly the promised fields, any other field fails to render
+	sample := make(map[string]string, len(spec.Fields))
+	for _, field := range spec.Fields {
+		sample[field] = "sample"
+	}
+	t.Option("missingkey=error")
+
+	var errs []error
+	for _, block := range requiredBlocks {
+		if t.Lookup(block) == nil {
+			errs = append(errs, fmt.Errorf("%s: missing %q block", name, block))
+		}
+	}
+
+	for _, block := range t.Templates() {
+		if block.Name() == path.Base(name) {
+			continue
+		}
+
+		var rendered strings.Builder
+		if err := t.ExecuteTemplate(&rendered, block.Name(), sample); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %q block uses data callers do not provide: %w", name, block.Name(), err))
+			continue
+		}
+
+		if block.Name() == "subject" && strings.TrimSpace(rendered.String()) == "" {
+			errs = append(errs, fmt.Errorf("%s: \"subject\" block renders empty", name))
+		}
+	}
+
+	return errs
+}
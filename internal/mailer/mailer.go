@@ -3,12 +3,23 @@ package mailer
 import (
 	"embed"
 	"errors"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/jobs"
 )
 
 const (
-	UserWelcomeTemplate = "welcome_mail.tmpl"
+	UserWelcomeTemplate          = "welcome_mail.tmpl"
+	PasswordChangedTemplate      = "password_changed.tmpl"
+	SupportTicketTemplate        = "support_ticket.tmpl"
+	SupportResponseTemplate      = "support_response.tmpl"
+	VerificationReminderTemplate = "verification_reminder.tmpl"
+	AnnouncementTemplate         = "announcement.tmpl"
+	InvitationTemplate           = "invitation.tmpl"
+	WeeklyDigestTemplate         = "weekly_digest.tmpl"
+	NewSignInTemplate            = "new_sign_in.tmpl"
 
-	// Mail delivery modes
+	// Mail delivery modes, AsyncInMemory queues the email on the jobs pool of QueuedMailer
 	SyncDelivery    = "sync"
 	AsyncInMemory   = "async_memory"
 	AsyncPersistent = "async_db"
@@ -21,34 +32,45 @@ type Client interface {
 	Send(templateFile, username, email, subject string, data any, isSandBox bool) error
 
 	SendWithOptions(templateFile, username, email, subject string, data any, deliveryMode string, isSandBox bool) error
+
+	SendWithAttachments(templateFile, username, email, subject string, data any, attachments []Attachment, deliveryMode string, isSandBox bool) error
+
+	// SendAt sends the email once sendAt has come, right away when it already has
+	SendAt(sendAt time.Time, templateFile, username, email, subject string, data any, isSandBox bool) error
 }
 
 // Error definitions
 var (
-	ErrQueueNotRunning = errors.New("mail queue is not running")
-	ErrQueueFull       = errors.New("mail queue is full")
+	// ErrQueueFull is returned when the in-memory job queue cannot take the email
+	ErrQueueFull = jobs.ErrQueueFull
+	// ErrAttachmentsUnsupported is returned by providers whose API cannot carry files
+	ErrAttachmentsUnsupported = errors.New("mail provider does not support attachments")
+	// ErrOptedOut is returned instead of sending an email the recipient turned off
+	ErrOptedOut = errors.New("recipient opted out of these emails")
+	// ErrSchedulingUnsupported is returned by providers asked to hold an email back, only
+	// QueuedMailer can
+	ErrSchedulingUnsupported = errors.New("mail provider cannot schedule emails")
 )
 
+// sendDue lets a provider send an email that is due already, it has nowhere to keep one
+// that is not
+func sendDue(sendAt time.Time, send func() error) error {
+	if sendAt.After(time.Now()) {
+		return ErrSchedulingUnsupported
+	}
+	return send()
+}
 
-// MailJob represents a mail to be sent
+// MailJob is an email queued by QueuedMailer. Data is stored as JSON, a template reads
+// it the same with struct fields or map keys.
 type MailJob struct {
-    ID           string
-    TemplateFile string
-    Username     string
-    Email        string
-    Subject      string
-    Data         interface{}
-    IsSandbox    bool
-    Status       string
-    Attempts     int
-    CreatedAt    string
-    UpdatedAt    string
+	TemplateFile string       `json:"template_file"`
+	Username     string       `json:"username"`
+	Email        string       `json:"email"`
+	Subject      string       `json:"subject"`
+	Data         any          `json:"data"`
+	IsSandbox    bool         `json:"is_sandbox"`
+	Attachments  []Attachment `json:"attachments,omitempty"`
 }
 
-// Queue interface for mail queue operations
-type Queue interface {
-    Enqueue(job MailJob) error
-    ProcessQueue()
-    Start()
-    Stop()
-}
+func (MailJob) JobName() string { return "mail.send" }
@@ -0,0 +1,214 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Attachment is a file sent along with an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// Message is a rendered template, HTML is the "body" block and Text the "text" block
+type Message struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// renderTemplate renders the subject, body and text blocks of templateFile, the edited
+// version when there is one. Templates without a text block get a plaintext version derived
+// from the HTML.
+func renderTemplate(templateFile, username, subject string, data any) (Message, error) {
+	t, err := parseTemplate(templateFile)
+	if err != nil {
+		return Message{}, fmt.Errorf("error parsing template from FS: %w", err)
+	}
+
+	return renderParsed(t, username, subject, data)
+}
+
+func renderParsed(t *template.Template, username, subject string, data any) (Message, error) {
+	// Render the template with data
+	var body bytes.Buffer
+	if err := t.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, fmt.Errorf("error executing template: %w", err)
+	}
+
+	message := Message{Subject: subject, HTML: body.String()}
+
+	if t.Lookup("text") != nil {
+		var text bytes.Buffer
+		if err := t.ExecuteTemplate(&text, "text", data); err != nil {
+			return Message{}, fmt.Errorf("error executing text template: %w", err)
+		}
+		message.Text = strings.TrimSpace(text.String())
+	} else {
+		message.Text = htmlToText(message.HTML)
+	}
+
+	// If subject is empty, try to get it from the template
+	if message.Subject == "" {
+		var subjectBuf bytes.Buffer
+		if err := t.ExecuteTemplate(&subjectBuf, "subject", data); err == nil {
+			message.Subject = strings.TrimSpace(subjectBuf.String())
+		} else {
+			// Fallback subject if template doesn't have a subject block
+			message.Subject = fmt.Sprintf("Message for %s", username)
+		}
+	}
+
+	return message, nil
+}
+
+var (
+	htmlHiddenPattern = regexp.MustCompile(`(?is)<(head|style|script)[^>]*>.*?</(head|style|script)>`)
+	htmlBreakPattern  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|li|tr)>`)
+	htmlTagPattern    = regexp.MustCompile(`<[^>]+>`)
+	blankLinesPattern = regexp.MustCompile(`\n\s*\n+`)
+	spaceRunPattern   = regexp.MustCompile(`[ \t]+`)
+)
+
+// htmlToText is a rough fallback for templates that have no text block
+func htmlToText(source string) string {
+	text := htmlHiddenPattern.ReplaceAllString(source, "")
+	text = htmlBreakPattern.ReplaceAllString(text, "\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = spaceRunPattern.ReplaceAllString(text, " ")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return strings.TrimSpace(blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// buildMIMEMessage writes a multipart/alternative message with the text and HTML parts,
+// wrapped in multipart/mixed when there are attachments
+func buildMIMEMessage(from, to string, message Message, attachments []Attachment) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	buf.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	buf.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", message.Subject)))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(attachments) == 0 {
+		alternative := multipart.NewWriter(&buf)
+		buf.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%s\r\n\r\n", alternative.Boundary()))
+
+		if err := writeAlternativeParts(alternative, message); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	buf.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary()))
+
+	var alternativeBody bytes.Buffer
+	alternative := multipart.NewWriter(&alternativeBody)
+	if err := writeAlternativeParts(alternative, message); err != nil {
+		return nil, err
+	}
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%s", alternative.Boundary())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(alternativeBody.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64Lines(part, attachment.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeAlternativeParts(writer *multipart.Writer, message Message) error {
+	// Clients show the last part they understand, so the HTML goes last
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", message.Text},
+		{"text/html; charset=UTF-8", message.HTML},
+	}
+
+	for _, p := range parts {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+
+		encoder := quotedprintable.NewWriter(part)
+		if _, err := encoder.Write([]byte(p.content)); err != nil {
+			return err
+		}
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// writeBase64Lines encodes content in 76 character lines as RFC 2045 requires
+func writeBase64Lines(writer io.Writer, content []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(content)
+
+	for len(encoded) > 76 {
+		if _, err := writer.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+
+	_, err := writer.Write([]byte(encoded + "\r\n"))
+	return err
+}
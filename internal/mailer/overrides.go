@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sync"
+	"text/template"
+)
+
+// ErrUnknownTemplate is returned for a name that is not registered in Templates
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// overrides holds the templates edited through the admin API, they win over the
+// embedded ones of the same name
+var overrides struct {
+	sync.RWMutex
+	templates map[string]string
+}
+
+// SetTemplateOverrides replaces the edited templates, keyed by template name. Templates
+// missing from it render from FS again.
+func SetTemplateOverrides(templates map[string]string) {
+	overrides.Lock()
+	defer overrides.Unlock()
+
+	overrides.templates = templates
+}
+
+// EmbeddedTemplate returns the source of a template as it was built into the binary
+func EmbeddedTemplate(name string) (string, error) {
+	if _, ok := Templates[name]; !ok {
+		return "", ErrUnknownTemplate
+	}
+
+	content, err := fs.ReadFile(FS, path.Join("templates", name))
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// LintContent checks an edited version of a registered template the same way
+// LintTemplates checks the embedded ones
+func LintContent(name, content string) []error {
+	spec, ok := Templates[name]
+	if !ok {
+		return []error{ErrUnknownTemplate}
+	}
+
+	t, err := template.New(name).Parse(content)
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", name, err)}
+	}
+
+	return lintParsed(name, t, spec)
+}
+
+// Preview renders content as template name would be sent, the template in use when content
+// is empty. Fields data does not set are filled with their name in brackets.
+func Preview(name, content string, data map[string]string) (Message, error) {
+	spec, ok := Templates[name]
+	if !ok {
+		return Message{}, ErrUnknownTemplate
+	}
+
+	var t *template.Template
+	var err error
+	if content == "" {
+		t, err = parseTemplate(name)
+	} else {
+		t, err = template.New(name).Parse(content)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	sample := make(map[string]string, len(spec.Fields))
+	for _, field := range spec.Fields {
+		sample[field] = "[" + field + "]"
+	}
+	for field, value := range data {
+		sample[field] = value
+	}
+
+	return renderParsed(t, sample["Username"], "", sample)
+}
+
+// Localized returns the translation of template name into locale, templates/<locale>/<name>,
+// and name itself when there is none
+func Localized(name, locale string) string {
+	if locale == "" {
+		return name
+	}
+
+	localized := path.Join(locale, name)
+	if _, err := fs.Stat(FS, path.Join("templates", localized)); err != nil {
+		return name
+	}
+
+	return localized
+}
+
+// parseTemplate parses the edited version of templateFile when there is one. An edited
+// version is linted before it is saved, if it still fails to parse the embedded one is used.
+func parseTemplate(templateFile string) (*template.Template, error) {
+	overrides.RLock()
+	content, ok := overrides.templates[templateFile]
+	overrides.RUnlock()
+
+	if ok {
+		if t, err := template.New(templateFile).Parse(content); err == nil {
+			return t, nil
+		}
+	}
+
+	return template.ParseFS(FS, path.Join("templates", templateFile))
+}
@@ -7,14 +7,12 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"path/filepath"
-	"strings"
-	"text/template"
 	"time"
 )
 
 // HttpMailer implements the Client interface using HTTP API calls
 type HttpMailer struct {
+	deliveryReporter
 	apiKey          string
 	apiURL          string
 	mailFromAddress string
@@ -66,45 +64,49 @@ func (httpMailer *HttpMailer) Send(templateFile, username, email, subject string
 }
 
 func (httpMailer *HttpMailer) SendWithOptions(templateFile, username, email, subject string, data any, deliveryMode string, isSandBox bool) error {
-	// Construct the full template path
-	templatePath := filepath.Join("templates", templateFile)
+	return httpMailer.SendWithAttachments(templateFile, username, email, subject, data, nil, deliveryMode, isSandBox)
+}
 
-	// Parse the template from the embedded filesystem
-	t, err := template.ParseFS(FS, templatePath)
-	if err != nil {
-		return fmt.Errorf("error parsing template from FS: %w", err)
-	}
+// SendAt sends an email that is due already, it cannot hold one back
+func (httpMailer *HttpMailer) SendAt(sendAt time.Time, templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return sendDue(sendAt, func() error {
+		return httpMailer.Send(templateFile, username, email, subject, data, isSandBox)
+	})
+}
 
-	// Render the template with data
-	var body bytes.Buffer
-	if err := t.ExecuteTemplate(&body, "body", data); err != nil {
-		return fmt.Errorf("error executing template: %w", err)
+// SendWithAttachments renders both versions of the template, but Plunk builds the message
+// itself from the HTML body and cannot take a plaintext part or files
+func (httpMailer *HttpMailer) SendWithAttachments(templateFile, username, email, subject string, data any, attachments []Attachment, deliveryMode string, isSandBox bool) error {
+	delivery := Delivery{Provider: DriverPlunk, Template: templateFile, Recipient: email, Subject: subject}
+
+	if len(attachments) > 0 {
+		httpMailer.report(failedDelivery(delivery, 0, ErrAttachmentsUnsupported))
+		return ErrAttachmentsUnsupported
 	}
 
-	// If subject is empty, try to get it from the template
-	if subject == "" {
-		var subjectBuf bytes.Buffer
-		if err := t.ExecuteTemplate(&subjectBuf, "subject", data); err == nil {
-			subject = strings.TrimSpace(subjectBuf.String())
-		} else {
-			// Fallback subject if template doesn't have a subject block
-			subject = fmt.Sprintf("Message for %s", username)
-		}
+	rendered, err := renderTemplate(templateFile, username, subject, data)
+	if err != nil {
+		httpMailer.report(failedDelivery(delivery, 0, err))
+		return err
 	}
+	delivery.Subject = rendered.Subject
 
 	// If in sandbox mode, just log the email
 	if isSandBox {
 		log.Printf("SANDBOX MODE: Would send email to %s with template %s", email, templateFile)
-		log.Printf("Subject: %s", subject)
-		log.Printf("Content: %s", body.String())
+		log.Printf("Subject: %s", rendered.Subject)
+		log.Printf("Content: %s", rendered.HTML)
+		log.Printf("Text: %s", rendered.Text)
+		delivery.Status = DeliverySandbox
+		httpMailer.report(delivery)
 		return nil
 	}
 
 	// Prepare the request payload
 	request := PlunkRequest{
 		To:      email,
-		Subject: subject,
-		Body:    body.String(),
+		Subject: rendered.Subject,
+		Body:    rendered.HTML,
 		Name:    httpMailer.mailFromName,
 		From:    httpMailer.mailFromAddress,
 	}
@@ -114,9 +116,13 @@ func (httpMailer *HttpMailer) SendWithOptions(templateFile, username, email, sub
 	for attempt := 1; attempt <= httpMailer.maxRetries; attempt++ {
 		log.Printf("Attempt %d/%d to send email to %s via HTTP", attempt, httpMailer.maxRetries, email)
 
-		err := httpMailer.sendHTTPRequest(request)
+		response, err := httpMailer.sendHTTPRequest(request)
 		if err == nil {
 			log.Printf("Email sent successfully to %s via HTTP", email)
+			delivery.Status = DeliverySent
+			delivery.Attempts = attempt
+			delivery.Response = response
+			httpMailer.report(delivery)
 			return nil
 		}
 
@@ -129,21 +135,51 @@ func (httpMailer *HttpMailer) SendWithOptions(templateFile, username, email, sub
 		}
 	}
 
+	httpMailer.report(failedDelivery(delivery, httpMailer.maxRetries, lastErr))
 	return fmt.Errorf("failed to send email via HTTP after %d attempts: %w", httpMailer.maxRetries, lastErr)
 }
 
-// sendHTTPRequest sends the email via HTTP API
-func (httpMailer *HttpMailer) sendHTTPRequest(request PlunkRequest) error {
+// Ping checks that the Plunk API is reachable and accepts the configured API key
+func (httpMailer *HttpMailer) Ping() error {
+	if httpMailer.apiKey == "" {
+		return fmt.Errorf("API key is not set")
+	}
+
+	req, err := http.NewRequest("GET", httpMailer.apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+httpMailer.apiKey)
+
+	resp, err := httpMailer.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("API key was rejected (status: %d)", resp.StatusCode)
+	}
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("API is unavailable (status: %d)", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// sendHTTPRequest sends the email via HTTP API and returns the response body
+func (httpMailer *HttpMailer) sendHTTPRequest(request PlunkRequest) (string, error) {
 	// Marshal the request to JSON
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create HTTP request
 	req, err := http.NewRequest("POST", httpMailer.apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	// Set headers
@@ -153,14 +189,14 @@ func (httpMailer *HttpMailer) sendHTTPRequest(request PlunkRequest) error {
 	// Send the request
 	resp, err := httpMailer.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send HTTP request: %w", err)
+		return "", fmt.Errorf("failed to send HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return "", fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	// Parse the response
@@ -169,14 +205,14 @@ func (httpMailer *HttpMailer) sendHTTPRequest(request PlunkRequest) error {
 		// If we can't parse the response, but got a success status code, consider it successful
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 			log.Printf("Email sent successfully but couldn't parse response: %s", string(body))
-			return nil
+			return string(body), nil
 		}
-		return fmt.Errorf("failed to parse response (status: %d): %w, body: %s", resp.StatusCode, err, string(body))
+		return "", fmt.Errorf("failed to parse response (status: %d): %w, body: %s", resp.StatusCode, err, string(body))
 	}
 
 	// Check if the request was successful
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 && plunkResp.Success {
-		return nil
+		return string(body), nil
 	}
 
 	// Handle error response
@@ -191,5 +227,5 @@ func (httpMailer *HttpMailer) sendHTTPRequest(request PlunkRequest) error {
 
 	log.Printf("Plunk Response Body: %s", string(body))
 
-	return fmt.Errorf("API request failed: %s", errorMsg)
+	return "", fmt.Errorf("API request failed: %s", errorMsg)
 }
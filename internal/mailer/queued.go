@@ -0,0 +1,215 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/jobs"
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// QueuedMailer wraps any provider and sends the async emails as jobs of a jobs.Pool
+type QueuedMailer struct {
+	baseMailer Client
+	pool       *jobs.Pool
+	mu         sync.Mutex
+	optOuts    OptOutChecker
+	schedule   ScheduleStore
+}
+
+// OptOutChecker reports whether the owner of email turned off the emails of category
+type OptOutChecker func(email, category string) (bool, error)
+
+// ScheduleStore keeps the emails sent with SendAt until they are due, store.ScheduledEmailStore
+// implements it
+type ScheduleStore interface {
+	Create(ctx context.Context, email *models.ScheduledEmail) error
+}
+
+// NewQueuedMailer registers the MailJob handler on pool. The provider retries on its own,
+// so a job that still fails is only retried a couple of times by the pool.
+func NewQueuedMailer(baseMailer Client, pool *jobs.Pool) *QueuedMailer {
+	m := &QueuedMailer{
+		baseMailer: baseMailer,
+		pool:       pool,
+	}
+
+	jobs.Register(pool, jobs.Options{Priority: jobs.PriorityHigh, MaxAttempts: 3}, m.deliver)
+
+	return m
+}
+
+// Send implements the Client interface, but queues the email
+func (m *QueuedMailer) Send(templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return m.SendWithAttachments(templateFile, username, email, subject, data, nil, AsyncInMemory, isSandBox)
+}
+
+// SendWithOptions implements the extended Client interface
+func (m *QueuedMailer) SendWithOptions(templateFile, username, email, subject string, data any, deliveryMode string, isSandBox bool) error {
+	return m.SendWithAttachments(templateFile, username, email, subject, data, nil, deliveryMode, isSandBox)
+}
+
+// CheckOptOuts makes every email of an opt-out category ask checker first, see TemplateSpec.Category
+func (m *QueuedMailer) CheckOptOuts(checker OptOutChecker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.optOuts = checker
+}
+
+// ScheduleWith keeps the emails sent with SendAt in store until a dispatcher queues them.
+// Without a store they wait in the job queue, which the memory backend loses on restart.
+func (m *QueuedMailer) ScheduleWith(store ScheduleStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.schedule = store
+}
+
+// SendAt queues an email that is due already, and holds back one that is not. The opt-out
+// is checked now, and again when a stored email is queued.
+func (m *QueuedMailer) SendAt(sendAt time.Time, templateFile, username, email, subject string, data any, isSandBox bool) error {
+	if err := m.checkOptOut(templateFile, email); err != nil {
+		return err
+	}
+
+	delay := time.Until(sendAt)
+	if delay <= 0 {
+		return m.SendWithOptions(templateFile, username, email, subject, data, AsyncInMemory, isSandBox)
+	}
+
+	m.mu.Lock()
+	schedule := m.schedule
+	m.mu.Unlock()
+
+	if schedule == nil {
+		opts := []jobs.EnqueueOption{jobs.WithDelay(delay)}
+		if Templates[path.Base(templateFile)].Category != "" {
+			opts = append(opts, jobs.WithPriority(jobs.PriorityLow))
+		}
+
+		return m.pool.Enqueue(context.Background(), MailJob{
+			TemplateFile: templateFile,
+			Username:     username,
+			Email:        email,
+			Subject:      subject,
+			Data:         data,
+			IsSandbox:    isSandBox,
+		}, opts...)
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding email data: %w", err)
+	}
+
+	return schedule.Create(context.Background(), &models.ScheduledEmail{
+		Template:  templateFile,
+		Username:  username,
+		Email:     email,
+		Subject:   subject,
+		Data:      payload,
+		IsSandbox: isSandBox,
+		SendAt:    sendAt.UTC(),
+	})
+}
+
+// SendWithAttachments queues the mail with its attachments unless sync delivery is requested.
+// The emails users can opt out of wait behind the others. An email the recipient opted out
+// of is not sent and returns ErrOptedOut.
+func (m *QueuedMailer) SendWithAttachments(templateFile, username, email, subject string, data any, attachments []Attachment, deliveryMode string, isSandBox bool) error {
+	if err := m.checkOptOut(templateFile, email); err != nil {
+		return err
+	}
+
+	// If sync is requested, use the base mailer directly
+	if deliveryMode == SyncDelivery {
+		return m.baseMailer.SendWithAttachments(templateFile, username, email, subject, data, attachments, SyncDelivery, isSandBox)
+	}
+
+	var opts []jobs.EnqueueOption
+	if Templates[path.Base(templateFile)].Category != "" {
+		opts = append(opts, jobs.WithPriority(jobs.PriorityLow))
+	}
+
+	return m.pool.Enqueue(context.Background(), MailJob{
+		TemplateFile: templateFile,
+		Username:     username,
+		Email:        email,
+		Subject:      subject,
+		Data:         data,
+		IsSandbox:    isSandBox,
+		Attachments:  attachments,
+	}, opts...)
+}
+
+// checkOptOut fails closed, an email of a category the lookup could not clear is not sent
+func (m *QueuedMailer) checkOptOut(templateFile, email string) error {
+	m.mu.Lock()
+	checker := m.optOuts
+	m.mu.Unlock()
+
+	category := Templates[path.Base(templateFile)].Category
+	if checker == nil || category == "" {
+		return nil
+	}
+
+	optedOut, err := checker(email, category)
+	if err != nil {
+		return fmt.Errorf("checking email opt-outs: %w", err)
+	}
+	if optedOut {
+		return ErrOptedOut
+	}
+
+	return nil
+}
+
+// deliver sends a queued email with the base mailer
+func (m *QueuedMailer) deliver(_ context.Context, job MailJob) error {
+	err := m.baseMailer.SendWithAttachments(
+		job.TemplateFile,
+		job.Username,
+		job.Email,
+		job.Subject,
+		job.Data,
+		job.Attachments,
+		SyncDelivery,
+		job.IsSandbox,
+	)
+	if errors.Is(err, ErrAttachmentsUnsupported) {
+		return jobs.Permanent(err)
+	}
+
+	return err
+}
+
+// QueueStats describes the queue the emails wait in and how sending them went on this
+// instance since it started
+type QueueStats struct {
+	// Depth counts every job of the queue, the emails share it with the other job types
+	Depth jobs.Depth    `json:"depth"`
+	Email jobs.JobStats `json:"email"`
+	// Workers are shared with the other job types too
+	Workers []jobs.WorkerStats `json:"workers"`
+}
+
+// Stats reports the depth of the queue and the counters of the email jobs
+func (m *QueuedMailer) Stats(ctx context.Context) (QueueStats, error) {
+	depth, err := m.pool.Depth(ctx)
+	if err != nil {
+		return QueueStats{}, fmt.Errorf("counting queued jobs: %w", err)
+	}
+
+	stats := m.pool.Stats()
+	return QueueStats{
+		Depth:   depth,
+		Email:   stats.Job(MailJob{}.JobName()),
+		Workers: stats.Workers,
+	}, nil
+}
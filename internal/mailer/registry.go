@@ -0,0 +1,158 @@
+package mailer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mail drivers selectable with MAIL_DRIVER
+const (
+	DriverSMTP  = "smtp"
+	DriverPlunk = "plunk"
+	DriverSES   = "ses"
+)
+
+// Provider is a Client that can also check its connection, used by the doctor command,
+// and report the outcome of every email
+type Provider interface {
+	Client
+	Ping() error
+	Observe(DeliveryObserver)
+}
+
+type SMTPConfig struct {
+	Host        string
+	Port        string
+	Username    string
+	Password    string
+	Encryption  string
+	FromAddress string
+	FromName    string
+	// TLSVerify checks the server certificate, against TLSCAFile when it is set
+	TLSVerify bool
+	TLSCAFile string
+	// PoolSize is how many authenticated sessions are kept open, 0 dials for every email
+	PoolSize    int
+	IdleTimeout time.Duration
+}
+
+type PlunkConfig struct {
+	APIKey      string
+	FromAddress string
+	FromName    string
+}
+
+type SESConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	FromAddress     string
+	FromName        string
+}
+
+// Config holds the settings of every driver, a factory only reads its own
+type Config struct {
+	SMTP  SMTPConfig
+	Plunk PlunkConfig
+	SES   SESConfig
+	// Failover applies when several drivers are chained
+	Failover FailoverConfig
+}
+
+// Factory builds a provider from the configuration
+type Factory func(cfg Config) (Provider, error)
+
+var factories = map[string]Factory{
+	DriverSMTP: func(cfg Config) (Provider, error) {
+		provider := NewSendSMTP(
+			cfg.SMTP.Host,
+			cfg.SMTP.Port,
+			cfg.SMTP.Username,
+			cfg.SMTP.Password,
+			cfg.SMTP.Encryption,
+			cfg.SMTP.FromAddress,
+			cfg.SMTP.FromName,
+		)
+		if err := provider.ConfigureTLS(cfg.SMTP.TLSVerify, cfg.SMTP.TLSCAFile); err != nil {
+			return nil, err
+		}
+		provider.KeepAlive(cfg.SMTP.PoolSize, cfg.SMTP.IdleTimeout)
+		return provider, nil
+	},
+	DriverPlunk: func(cfg Config) (Provider, error) {
+		return NewHttpMailer(
+			cfg.Plunk.APIKey,
+			cfg.Plunk.FromAddress,
+			cfg.Plunk.FromName,
+		), nil
+	},
+	DriverSES: func(cfg Config) (Provider, error) {
+		if cfg.SES.Region == "" {
+			return nil, fmt.Errorf("SES region is required")
+		}
+		return NewSESMailer(
+			cfg.SES.Region,
+			cfg.SES.AccessKeyID,
+			cfg.SES.SecretAccessKey,
+			cfg.SES.FromAddress,
+			cfg.SES.FromName,
+		), nil
+	},
+}
+
+// aliases keeps the names accepted by the old MAILER_TYPE setting working
+var aliases = map[string]string{
+	"http": DriverPlunk,
+}
+
+// Register adds a driver, or replaces an existing one. Call it from an init function
+// before New, the registry is not safe for concurrent use.
+func Register(driver string, factory Factory) {
+	factories[strings.ToLower(driver)] = factory
+}
+
+// Drivers lists the registered driver names
+func Drivers() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New builds the provider registered for driver. A comma separated list, e.g. "plunk,smtp",
+// builds a FailoverMailer that tries the drivers in that order.
+func New(driver string, cfg Config) (Provider, error) {
+	drivers := Chain(driver)
+	if len(drivers) <= 1 {
+		return newProvider(driver, cfg)
+	}
+
+	providers := make([]Provider, len(drivers))
+	for i, name := range drivers {
+		provider, err := newProvider(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		providers[i] = provider
+	}
+
+	return NewFailoverMailer(drivers, providers, cfg.Failover), nil
+}
+
+func newProvider(driver string, cfg Config) (Provider, error) {
+	name := strings.ToLower(strings.TrimSpace(driver))
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mail driver %q, use one of %s", driver, strings.Join(Drivers(), ", "))
+	}
+
+	return factory(cfg)
+}
@@ -0,0 +1,194 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// SESMailer implements the Client interface with the Amazon SES v2 HTTP API
+type SESMailer struct {
+	deliveryReporter
+	region          string
+	endpoint        string
+	credentials     aws.CredentialsProvider
+	signer          *v4.Signer
+	mailFromAddress string
+	mailFromName    string
+	maxRetries      int
+	retryDelay      time.Duration
+	httpClient      *http.Client
+}
+
+// sesSendEmailRequest sends a raw MIME message so the plaintext part and attachments survive
+type sesSendEmailRequest struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses []string `json:"ToAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Raw struct {
+			// Data is base64 encoded by encoding/json
+			Data []byte `json:"Data"`
+		} `json:"Raw"`
+	} `json:"Content"`
+}
+
+// NewSESMailer creates a new mailer that sends through Amazon SES
+func NewSESMailer(
+	region,
+	accessKeyID,
+	secretAccessKey,
+	mailFromAddress,
+	mailFromName string) *SESMailer {
+
+	return &SESMailer{
+		region:          region,
+		endpoint:        fmt.Sprintf("https://email.%s.amazonaws.com", region),
+		credentials:     credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""),
+		signer:          v4.NewSigner(),
+		mailFromAddress: mailFromAddress,
+		mailFromName:    mailFromName,
+		maxRetries:      3,
+		retryDelay:      5 * time.Second,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (sesMailer *SESMailer) Send(templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return sesMailer.SendWithOptions(templateFile, username, email, subject, data, SyncDelivery, isSandBox)
+}
+
+func (sesMailer *SESMailer) SendWithOptions(templateFile, username, email, subject string, data any, deliveryMode string, isSandBox bool) error {
+	return sesMailer.SendWithAttachments(templateFile, username, email, subject, data, nil, deliveryMode, isSandBox)
+}
+
+// SendAt sends an email that is due already, it cannot hold one back
+func (sesMailer *SESMailer) SendAt(sendAt time.Time, templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return sendDue(sendAt, func() error {
+		return sesMailer.Send(templateFile, username, email, subject, data, isSandBox)
+	})
+}
+
+func (sesMailer *SESMailer) SendWithAttachments(templateFile, username, email, subject string, data any, attachments []Attachment, deliveryMode string, isSandBox bool) error {
+	log.Printf("Sending email to %s with template %s via SES", email, templateFile)
+
+	delivery := Delivery{Provider: DriverSES, Template: templateFile, Recipient: email, Subject: subject}
+
+	rendered, err := renderTemplate(templateFile, username, subject, data)
+	if err != nil {
+		sesMailer.report(failedDelivery(delivery, 0, err))
+		return err
+	}
+	delivery.Subject = rendered.Subject
+
+	from := fmt.Sprintf("%s <%s>", sesMailer.mailFromName, sesMailer.mailFromAddress)
+
+	message, err := buildMIMEMessage(from, email, rendered, attachments)
+	if err != nil {
+		sesMailer.report(failedDelivery(delivery, 0, err))
+		return fmt.Errorf("error building message: %w", err)
+	}
+
+	// If in sandbox mode, just log the email
+	if isSandBox {
+		log.Printf("SANDBOX MODE: Would send email to %s with template %s", email, templateFile)
+		log.Printf("Content: %s", string(message))
+		delivery.Status = DeliverySandbox
+		sesMailer.report(delivery)
+		return nil
+	}
+
+	var request sesSendEmailRequest
+	request.FromEmailAddress = from
+	request.Destination.ToAddresses = []string{email}
+	request.Content.Raw.Data = message
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		sesMailer.report(failedDelivery(delivery, 0, err))
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Attempt to send with retries
+	var lastErr error
+	for attempt := 1; attempt <= sesMailer.maxRetries; attempt++ {
+		log.Printf("Attempt %d/%d to send email to %s via SES", attempt, sesMailer.maxRetries, email)
+
+		response, err := sesMailer.do(http.MethodPost, "/v2/email/outbound-emails", payload)
+		if err == nil {
+			log.Printf("Email sent successfully to %s via SES", email)
+			delivery.Status = DeliverySent
+			delivery.Attempts = attempt
+			delivery.Response = response
+			sesMailer.report(delivery)
+			return nil
+		}
+
+		lastErr = err
+		log.Printf("SES send attempt %d failed: %v", attempt, err)
+
+		if attempt < sesMailer.maxRetries {
+			log.Printf("Retrying in %v...", sesMailer.retryDelay)
+			time.Sleep(sesMailer.retryDelay)
+		}
+	}
+
+	sesMailer.report(failedDelivery(delivery, sesMailer.maxRetries, lastErr))
+	return fmt.Errorf("failed to send email via SES after %d attempts: %w", sesMailer.maxRetries, lastErr)
+}
+
+// Ping checks that SES is reachable and accepts the configured credentials
+func (sesMailer *SESMailer) Ping() error {
+	_, err := sesMailer.do(http.MethodGet, "/v2/email/account", nil)
+	return err
+}
+
+// do sends a SigV4 signed request to the SES API and returns the response body
+func (sesMailer *SESMailer) do(method, path string, payload []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sesMailer.httpClient.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, sesMailer.endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	creds, err := sesMailer.credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS credentials: %w", err)
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	if err := sesMailer.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "ses", sesMailer.region, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	resp, err := sesMailer.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return string(body), nil
+	}
+
+	return "", fmt.Errorf("SES API error (status: %d): %s", resp.StatusCode, string(body))
+}
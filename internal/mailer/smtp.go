@@ -1,18 +1,15 @@
 package mailer
 
 import (
-	"bytes"
 	"crypto/tls"
 	"fmt"
 	"log"
 	"net/smtp"
-	"path/filepath"
-	"strings"
-	"text/template"
 	"time"
 )
 
 type SmtpMailer struct {
+	deliveryReporter
 	mailHost        string
 	mailPort        string
 	mailUsername    string
@@ -22,6 +19,11 @@ type SmtpMailer struct {
 	mailFromName    string
 	maxRetries      int
 	retryDelay      time.Duration
+	// encryption is one of the Encryption modes, resolved from mailEncryption and the port
+	encryption string
+	tlsConfig  *tls.Config
+	// pool keeps sessions open between emails, nil dials for every one
+	pool *smtpPool
 }
 
 func NewSendSMTP(
@@ -32,6 +34,12 @@ func NewSendSMTP(
 	mailEncryption,
 	mailFromAddress,
 	mailFromName string) *SmtpMailer {
+	encryption, err := encryptionMode(mailEncryption, mailPort)
+	if err != nil {
+		// ConfigureTLS reports the bad value, until then the safe mode is used
+		encryption = EncryptionSTARTTLS
+	}
+
 	return &SmtpMailer{
 		mailHost:        mailHost,
 		mailPort:        mailPort,
@@ -42,61 +50,81 @@ func NewSendSMTP(
 		mailFromName:    mailFromName,
 		maxRetries:      3,
 		retryDelay:      5 * time.Second,
+		encryption:      encryption,
+		tlsConfig:       &tls.Config{ServerName: mailHost, MinVersion: tls.VersionTLS12},
+	}
+}
+
+// ConfigureTLS checks the encryption mode and sets how the server certificate is verified,
+// against caFile when it is set or the system roots otherwise
+func (s *SmtpMailer) ConfigureTLS(verify bool, caFile string) error {
+	encryption, err := encryptionMode(s.mailEncryption, s.mailPort)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := smtpTLSConfig(s.mailHost, verify, caFile)
+	if err != nil {
+		return err
+	}
+
+	s.encryption = encryption
+	s.tlsConfig = tlsConfig
+	return nil
+}
+
+// KeepAlive reuses up to size authenticated sessions across emails, each for as long as it
+// has been idle less than idleTimeout. A size of 0 dials for every email.
+func (s *SmtpMailer) KeepAlive(size int, idleTimeout time.Duration) {
+	if size <= 0 || idleTimeout <= 0 {
+		s.pool = nil
+		return
 	}
+
+	s.pool = &smtpPool{size: size, idleTimeout: idleTimeout}
 }
 
 // Send sends an email with retry logic and proper TLS handling
 func (s *SmtpMailer) Send(templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return s.SendWithAttachments(templateFile, username, email, subject, data, nil, SyncDelivery, isSandBox)
+}
+
+// SendAt sends an email that is due already, it cannot hold one back
+func (s *SmtpMailer) SendAt(sendAt time.Time, templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return sendDue(sendAt, func() error {
+		return s.Send(templateFile, username, email, subject, data, isSandBox)
+	})
+}
+
+// SendWithAttachments sends a multipart/alternative message with the HTML and plaintext
+// versions of the template, plus any attachments
+func (s *SmtpMailer) SendWithAttachments(templateFile, username, email, subject string, data any, attachments []Attachment, deliveryMode string, isSandBox bool) error {
 	log.Printf("Sending email to %s with template %s", email, templateFile)
 
-	// Construct the full template path
-	templatePath := filepath.Join("templates", templateFile)
+	delivery := Delivery{Provider: DriverSMTP, Template: templateFile, Recipient: email, Subject: subject}
 
-	// Parse the template from the embedded filesystem
-	t, err := template.ParseFS(FS, templatePath)
+	rendered, err := renderTemplate(templateFile, username, subject, data)
 	if err != nil {
-		return fmt.Errorf("error parsing template from FS: %w", err)
-	}
-
-	// Render the template with data
-	var body bytes.Buffer
-	if err := t.ExecuteTemplate(&body, "body", data); err != nil {
-		return fmt.Errorf("error executing template: %w", err)
+		s.report(failedDelivery(delivery, 0, err))
+		return err
 	}
+	delivery.Subject = rendered.Subject
 
 	// Set up email headers
 	from := fmt.Sprintf("%s <%s>", s.mailFromName, s.mailFromAddress)
 
-	// If subject is empty, try to get it from the template
-	if subject == "" {
-		var subjectBuf bytes.Buffer
-		if err := t.ExecuteTemplate(&subjectBuf, "subject", data); err == nil {
-			subject = strings.TrimSpace(subjectBuf.String())
-		} else {
-			// Fallback subject if template doesn't have a subject block
-			subject = fmt.Sprintf("Message for %s", username)
-		}
-	}
-
-	headers := make(map[string]string)
-	headers["From"] = from
-	headers["To"] = email
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=UTF-8"
-
-	// Compose message
-	var message bytes.Buffer
-	for k, v := range headers {
-		message.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+	message, err := buildMIMEMessage(from, email, rendered, attachments)
+	if err != nil {
+		s.report(failedDelivery(delivery, 0, err))
+		return fmt.Errorf("error building message: %w", err)
 	}
-	message.WriteString("\r\n")
-	message.Write(body.Bytes())
 
 	// If in sandbox mode, just log the email
 	if isSandBox {
 		log.Printf("SANDBOX MODE: Would send email to %s with template %s", email, templateFile)
-		log.Printf("Content: %s", message.String())
+		log.Printf("Content: %s", string(message))
+		delivery.Status = DeliverySandbox
+		s.report(delivery)
 		return nil
 	}
 
@@ -108,9 +136,12 @@ func (s *SmtpMailer) Send(templateFile, username, email, subject string, data an
 	for attempt := 1; attempt <= s.maxRetries; attempt++ {
 		log.Printf("Attempt %d/%d to send email to %s", attempt, s.maxRetries, email)
 
-		err := s.sendMailWithTLS(addr, email, message.Bytes())
+		err := s.sendMailWithTLS(addr, email, message)
 		if err == nil {
 			log.Printf("Email sent successfully to %s", email)
+			delivery.Status = DeliverySent
+			delivery.Attempts = attempt
+			s.report(delivery)
 			return nil
 		}
 
@@ -124,35 +155,51 @@ func (s *SmtpMailer) Send(templateFile, username, email, subject string, data an
 	}
 
 	log.Printf("SMTP config - Host: %s, Port: %s, Username: %s", s.mailHost, s.mailPort, s.mailUsername)
+	s.report(failedDelivery(delivery, s.maxRetries, lastErr))
 	return fmt.Errorf("failed to send email after %d attempts: %w", s.maxRetries, lastErr)
 }
 
-func (s *SmtpMailer) sendMailWithTLS(addr, to string, message []byte) error {
-	log.Printf("Connecting to SMTP server at %s", addr)
+// SendWithOptions sends right away, queuing is left to QueuedMailer
+func (s *SmtpMailer) SendWithOptions(templateFile, username, email, subject string, data any, deliveryMode string, isSandBox bool) error {
+	return s.SendWithAttachments(templateFile, username, email, subject, data, nil, deliveryMode, isSandBox)
+}
 
-	// Connect to the SMTP server
-	client, err := smtp.Dial(addr)
+// Ping connects, negotiates TLS and authenticates against the SMTP server without sending anything
+func (s *SmtpMailer) Ping() error {
+	client, err := s.dial(fmt.Sprintf("%s:%s", s.mailHost, s.mailPort))
 	if err != nil {
-		return fmt.Errorf("failed to dial SMTP server: %w", err)
+		return err
 	}
 	defer client.Close()
 
+	return client.Quit()
+}
+
+// dial opens an SMTP session that is ready to accept MAIL FROM
+func (s *SmtpMailer) dial(addr string) (*smtp.Client, error) {
+	log.Printf("Connecting to SMTP server at %s", addr)
+
+	client, err := s.connect(addr)
+	if err != nil {
+		return nil, err
+	}
+
 	// Set the hostname for HELO/EHLO
 	if err = client.Hello("localhost"); err != nil {
-		return fmt.Errorf("failed HELO/EHLO: %w", err)
+		client.Close()
+		return nil, fmt.Errorf("failed HELO/EHLO: %w", err)
 	}
 
-	// Check if the server supports STARTTLS
-	if ok, _ := client.Extension("STARTTLS"); ok {
-		// Configure TLS
-		tlsConfig := &tls.Config{
-			ServerName: s.mailHost,
-			MinVersion: tls.VersionTLS12,
+	if s.encryption == EncryptionSTARTTLS {
+		// Refuse to go on in plaintext, that would send the credentials in the clear
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("server does not offer STARTTLS, set MAIL_ENCRYPTION=%s if it should not be encrypted", EncryptionNone)
 		}
 
-		// Start TLS
-		if err = client.StartTLS(tlsConfig); err != nil {
-			return fmt.Errorf("failed STARTTLS: %w", err)
+		if err = client.StartTLS(s.tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed STARTTLS: %w", err)
 		}
 	}
 
@@ -160,17 +207,73 @@ func (s *SmtpMailer) sendMailWithTLS(addr, to string, message []byte) error {
 	if s.mailUsername != "" && s.mailPassword != "" {
 		auth := smtp.PlainAuth("", s.mailUsername, s.mailPassword, s.mailHost)
 		if err = client.Auth(auth); err != nil {
-			return fmt.Errorf("failed authentication: %w", err)
+			client.Close()
+			return nil, fmt.Errorf("failed authentication: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// connect opens the connection, wrapped in TLS right away for implicit TLS
+func (s *SmtpMailer) connect(addr string) (*smtp.Client, error) {
+	if s.encryption != EncryptionImplicit {
+		client, err := smtp.Dial(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial SMTP server: %w", err)
 		}
+		return client, nil
+	}
+
+	conn, err := tls.Dial("tcp", addr, s.tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial SMTP server over TLS: %w", err)
 	}
 
+	client, err := smtp.NewClient(conn, s.mailHost)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	return client, nil
+}
+
+func (s *SmtpMailer) sendMailWithTLS(addr, to string, message []byte) error {
+	var client *smtp.Client
+	if s.pool != nil {
+		client = s.pool.get()
+	}
+	if client == nil {
+		var err error
+		client, err = s.dial(addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.transmit(client, to, message); err != nil {
+		// the session may be in any state, it is not reused
+		client.Close()
+		return err
+	}
+
+	if s.pool != nil {
+		s.pool.put(client)
+		return nil
+	}
+
+	return client.Quit()
+}
+
+// transmit runs one mail transaction on an open session
+func (s *SmtpMailer) transmit(client *smtp.Client, to string, message []byte) error {
 	// Set the sender
-	if err = client.Mail(s.mailFromAddress); err != nil {
+	if err := client.Mail(s.mailFromAddress); err != nil {
 		return fmt.Errorf("failed MAIL FROM: %w", err)
 	}
 
 	// Set the recipient
-	if err = client.Rcpt(to); err != nil {
+	if err := client.Rcpt(to); err != nil {
 		return fmt.Errorf("failed RCPT TO: %w", err)
 	}
 
@@ -190,5 +293,5 @@ func (s *SmtpMailer) sendMailWithTLS(addr, to string, message []byte) error {
 		return fmt.Errorf("failed to close data writer: %w", err)
 	}
 
-	return client.Quit()
+	return nil
 }
@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"net/smtp"
+	"sync"
+	"time"
+)
+
+// smtpSession is an authenticated connection waiting in the pool
+type smtpSession struct {
+	client    *smtp.Client
+	idleSince time.Time
+}
+
+// smtpPool keeps up to size authenticated sessions, so sending does not dial, STARTTLS and
+// authenticate for every email. The most recently used session is reused first.
+type smtpPool struct {
+	mu          sync.Mutex
+	size        int
+	idleTimeout time.Duration
+	idle        []smtpSession
+}
+
+// get returns an idle session that still answers NOOP, or nil when there is none
+func (pool *smtpPool) get() *smtp.Client {
+	for {
+		pool.mu.Lock()
+		expired := pool.expire()
+		if len(pool.idle) == 0 {
+			pool.mu.Unlock()
+			closeSessions(expired)
+			return nil
+		}
+		session := pool.idle[len(pool.idle)-1]
+		pool.idle = pool.idle[:len(pool.idle)-1]
+		pool.mu.Unlock()
+
+		closeSessions(expired)
+
+		// the server may have dropped the connection while it was idle
+		if err := session.client.Noop(); err != nil {
+			session.client.Close()
+			continue
+		}
+
+		return session.client
+	}
+}
+
+// put keeps a session that just finished a mail transaction, or ends it when the pool is full
+func (pool *smtpPool) put(client *smtp.Client) {
+	pool.mu.Lock()
+	expired := pool.expire()
+	if len(pool.idle) >= pool.size {
+		pool.mu.Unlock()
+		closeSessions(expired)
+		quit(client)
+		return
+	}
+	pool.idle = append(pool.idle, smtpSession{client: client, idleSince: time.Now()})
+	pool.mu.Unlock()
+
+	closeSessions(expired)
+}
+
+// expire takes the sessions idle for longer than idleTimeout out of the pool, the caller
+// holds mu and quits them after unlocking
+func (pool *smtpPool) expire() []smtpSession {
+	cutoff := time.Now().Add(-pool.idleTimeout)
+
+	kept := pool.idle[:0]
+	var expired []smtpSession
+	for _, session := range pool.idle {
+		if session.idleSince.Before(cutoff) {
+			expired = append(expired, session)
+			continue
+		}
+		kept = append(kept, session)
+	}
+	pool.idle = kept
+
+	return expired
+}
+
+func closeSessions(sessions []smtpSession) {
+	for _, session := range sessions {
+		quit(session.client)
+	}
+}
+
+// quit ends a session politely, and closes the connection when the server does not answer
+func quit(client *smtp.Client) {
+	if err := client.Quit(); err != nil {
+		client.Close()
+	}
+}
@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// SMTP encryption modes selectable with MAIL_ENCRYPTION
+const (
+	// EncryptionSTARTTLS connects in plaintext and requires the server to upgrade with STARTTLS
+	EncryptionSTARTTLS = "tls"
+	// EncryptionImplicit speaks TLS from the first byte, as on port 465
+	EncryptionImplicit = "ssl"
+	// EncryptionNone never encrypts, only meant for local mail catchers
+	EncryptionNone = "none"
+)
+
+// implicitTLSPort is the submission port that speaks TLS from the start
+const implicitTLSPort = "465"
+
+// encryptionMode maps MAIL_ENCRYPTION onto a mode. "starttls" and "implicit" are accepted as
+// aliases, and port 465 always uses implicit TLS since STARTTLS cannot work there.
+func encryptionMode(encryption, port string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(encryption))
+	switch mode {
+	case "", EncryptionSTARTTLS, "starttls":
+		mode = EncryptionSTARTTLS
+	case EncryptionImplicit, "implicit":
+		mode = EncryptionImplicit
+	case EncryptionNone:
+		return EncryptionNone, nil
+	default:
+		return "", fmt.Errorf("unknown MAIL_ENCRYPTION %q, use %s, %s or %s", encryption, EncryptionSTARTTLS, EncryptionImplicit, EncryptionNone)
+	}
+
+	if port == implicitTLSPort {
+		return EncryptionImplicit, nil
+	}
+	return mode, nil
+}
+
+// smtpTLSConfig verifies the server certificate against caFile, or the system roots when it
+// is empty. Turning verify off is only meant for test servers with self-signed certificates.
+func smtpTLSConfig(host string, verify bool, caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading MAIL_TLS_CA_FILE: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("MAIL_TLS_CA_FILE %s holds no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if !verify {
+		log.Printf("WARNING: MAIL_TLS_VERIFY is off, the certificate of %s is not checked", host)
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/mail"
+	"strings"
+)
+
+// Verdicts returned by VerifyAddress
+const (
+	VerdictValid      = "valid"
+	VerdictInvalid    = "invalid"
+	VerdictDisposable = "disposable"
+	VerdictNoMX       = "no_mx"
+	VerdictUnknown    = "unknown"
+)
+
+// disposableDomains are throwaway inbox providers that should not be mailed
+var disposableDomains = map[string]bool{
+	"10minutemail.com":  true,
+	"dispostable.com":   true,
+	"getnada.com":       true,
+	"guerrillamail.com": true,
+	"mailinator.com":    true,
+	"maildrop.cc":       true,
+	"sharklasers.com":   true,
+	"temp-mail.org":     true,
+	"throwawaymail.com": true,
+	"trashmail.com":     true,
+	"yopmail.com":       true,
+}
+
+type AddressVerdict struct {
+	Email   string `json:"email"`
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// VerifyAddress checks the syntax of email, that its domain is not a disposable
+// inbox provider and that the domain accepts mail. It never contacts the mailbox itself.
+func VerifyAddress(ctx context.Context, resolver *net.Resolver, email string) AddressVerdict {
+	verdict := AddressVerdict{Email: email}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		verdict.Verdict = VerdictInvalid
+		verdict.Reason = "not a valid email address"
+		return verdict
+	}
+
+	at := strings.LastIndex(email, "@")
+	domain := strings.ToLower(email[at+1:])
+
+	if disposableDomains[domain] {
+		verdict.Verdict = VerdictDisposable
+		verdict.Reason = domain + " is a disposable email provider"
+		return verdict
+	}
+
+	records, err := resolver.LookupMX(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			verdict.Verdict = VerdictNoMX
+			verdict.Reason = domain + " does not accept email"
+			return verdict
+		}
+
+		verdict.Verdict = VerdictUnknown
+		verdict.Reason = "could not look up " + domain + ": " + err.Error()
+		return verdict
+	}
+
+	// a single "." record is a null MX, the domain explicitly accepts no mail
+	if len(records) == 0 || (len(records) == 1 && records[0].Host == ".") {
+		verdict.Verdict = VerdictNoMX
+		verdict.Reason = domain + " does not accept email"
+		return verdict
+	}
+
+	verdict.Verdict = VerdictValid
+	return verdict
+}
@@ -0,0 +1,277 @@
+// Package migrations applies the SQL migrations in cmd/migrate/migrations with golang-migrate.
+// The migrations about to run are checked for destructive statements first, and every change
+// runs under a MySQL advisory lock so replicas migrate one after another.
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/mysql"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// versionFormat matches the timestamps of the existing migrations
+const versionFormat = "20060102150405"
+
+var (
+	ErrInvalidName = errors.New("migration names may only hold letters, digits and underscores")
+	ErrNoSteps     = errors.New("the number of migrations must be positive")
+	// ErrDirtyVersion means a migration failed half way, the schema is somewhere between two
+	// versions and nothing should run against it until it is fixed
+	ErrDirtyVersion = errors.New("the database is at a dirty migration version, fix the failed migration by hand and run migrate force VERSION")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Runner runs the migrations of one directory against one database
+type Runner struct {
+	db      *sql.DB
+	dir     string
+	migrate *migrate.Migrate
+	// out receives the destructive statements found by the preflight
+	out io.Writer
+}
+
+// Status is one migration file and whether the database has it
+type Status struct {
+	Version uint
+	Name    string
+	Applied bool
+}
+
+// New prepares the migrations in dir. Closing the runner closes db.
+func New(db *sql.DB, dir string, out io.Writer) (*Runner, error) {
+	driver, err := mysql.WithInstance(db, &mysql.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("could not create driver instance: %v", err)
+	}
+
+	m, err := migrate.NewWithDatabaseInstance("file://"+dir, "mysql", driver)
+	if err != nil {
+		return nil, fmt.Errorf("could not create migration instance: %v", err)
+	}
+
+	return &Runner{db: db, dir: dir, migrate: m, out: out}, nil
+}
+
+func (runner *Runner) Close() error {
+	sourceErr, dbErr := runner.migrate.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+// Version returns the version of the database, 0 before the first migration. A dirty
+// version failed half way and has to be fixed by hand and forced.
+func (runner *Runner) Version() (uint, bool, error) {
+	version, dirty, err := runner.migrate.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("could not read migration version: %v", err)
+	}
+
+	return version, dirty, nil
+}
+
+// Status lists every migration file, oldest first
+func (runner *Runner) Status() ([]Status, error) {
+	current, _, err := runner.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := listMigrationFiles(runner.dir, ".up.sql", func(uint) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(files))
+	for _, file := range files {
+		statuses = append(statuses, Status{
+			Version: file.version,
+			Name:    migrationName(file.path),
+			Applied: file.version <= current,
+		})
+	}
+
+	return statuses, nil
+}
+
+// Up applies the next n pending migrations, all of them when n is 0. It returns how many
+// it applied.
+func (runner *Runner) Up(n int, allowDestructive bool) (int, error) {
+	if n < 0 {
+		return 0, ErrNoSteps
+	}
+
+	applied := 0
+	err := withMigrationLock(runner.db, func() error {
+		var err error
+		applied, err = runner.up(n, allowDestructive)
+		return err
+	})
+
+	return applied, err
+}
+
+// Startup is the migration step of a service starting up. It runs under the lock, so a
+// replica that is migrating is waited for rather than seen at a dirty version half way
+// through. A dirty version is refused with ErrDirtyVersion, then the pending migrations are
+// applied when apply is set. Destructive ones are refused, they are left to the migrate CLI.
+func (runner *Runner) Startup(apply bool) (int, error) {
+	applied := 0
+	err := withMigrationLock(runner.db, func() error {
+		version, dirty, err := runner.Version()
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w (version %d)", ErrDirtyVersion, version)
+		}
+
+		if !apply {
+			return nil
+		}
+
+		applied, err = runner.up(0, false)
+		return err
+	})
+
+	return applied, err
+}
+
+// up applies the next n pending migrations, the caller holds the lock
+func (runner *Runner) up(n int, allowDestructive bool) (int, error) {
+	current, _, err := runner.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	files, err := listMigrationFiles(runner.dir, ".up.sql", func(version uint) bool { return version > current })
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 && n < len(files) {
+		files = files[:n]
+	}
+	if len(files) == 0 {
+		return 0, nil
+	}
+
+	if err := runner.preflight(files, allowDestructive); err != nil {
+		return 0, err
+	}
+
+	if err := runner.migrate.Steps(len(files)); err != nil {
+		return 0, fmt.Errorf("could not run up migration: %v", err)
+	}
+
+	return len(files), nil
+}
+
+// Down rolls back the last n applied migrations, all of them when n is 0. It returns how
+// many it rolled back.
+func (runner *Runner) Down(n int, allowDestructive bool) (int, error) {
+	if n < 0 {
+		return 0, ErrNoSteps
+	}
+
+	rolledBack := 0
+	err := withMigrationLock(runner.db, func() error {
+		current, _, err := runner.Version()
+		if err != nil {
+			return err
+		}
+
+		files, err := listMigrationFiles(runner.dir, ".down.sql", func(version uint) bool { return version <= current })
+		if err != nil {
+			return err
+		}
+		// newest first, that is the order they are rolled back in
+		for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+			files[i], files[j] = files[j], files[i]
+		}
+		if n > 0 && n < len(files) {
+			files = files[:n]
+		}
+		if len(files) == 0 {
+			return nil
+		}
+
+		if err := runner.preflight(files, allowDestructive); err != nil {
+			return err
+		}
+
+		if err := runner.migrate.Steps(-len(files)); err != nil {
+			return fmt.Errorf("could not run down migration: %v", err)
+		}
+		rolledBack = len(files)
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Force sets the version without running anything, to clear a dirty version once the
+// failed migration was fixed by hand
+func (runner *Runner) Force(version int) error {
+	return withMigrationLock(runner.db, func() error {
+		if err := runner.migrate.Force(version); err != nil {
+			return fmt.Errorf("could not force version: %v", err)
+		}
+		return nil
+	})
+}
+
+// Dir is MIGRATIONS_DIR, or where the migrations live in the repository or the Docker image
+func Dir() string {
+	if dir := os.Getenv("MIGRATIONS_DIR"); dir != "" {
+		return dir
+	}
+	if os.Getenv("DOCKER_ENV") == "true" {
+		return "/app/cmd/migrate/migrations"
+	}
+	return "cmd/migrate/migrations"
+}
+
+// Create writes an empty up and down migration for name in dir, versioned with the
+// timestamp of now, and returns their paths
+func Create(dir, name string, now time.Time) ([]string, error) {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+	name = strings.ReplaceAll(name, "-", "_")
+	if !namePattern.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+
+	base := filepath.Join(dir, now.UTC().Format(versionFormat)+"_"+name)
+	paths := []string{base + ".up.sql", base + ".down.sql"}
+
+	for _, path := range paths {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		if err := file.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+// migrationName is the file name without the version and the suffix
+func migrationName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".up.sql")
+	_, name, _ = strings.Cut(name, "_")
+	return name
+}
@@ -0,0 +1,195 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	migrationLockName    = "sandbox_api_migrations"
+	migrationLockTimeout = 60 // seconds
+)
+
+var ErrDestructiveMigration = errors.New("pending migrations contain destructive statements, re-run with -allow-destructive to apply them")
+
+// destructivePatterns matches statements that can lose data when applied to a live database
+var destructivePatterns = map[string]*regexp.Regexp{
+	"drop table":    regexp.MustCompile(`(?i)\bDROP\s+TABLE\b`),
+	"drop database": regexp.MustCompile(`(?i)\bDROP\s+(DATABASE|SCHEMA)\b`),
+	"truncate":      regexp.MustCompile(`(?i)\bTRUNCATE\b`),
+	"delete":        regexp.MustCompile(`(?i)\bDELETE\s+FROM\b`),
+	"rename":        regexp.MustCompile(`(?i)\bRENAME\s+(TABLE|COLUMN|TO)\b`),
+}
+
+// alterPatterns only apply inside ALTER TABLE statements
+var (
+	alterStatement   = regexp.MustCompile(`(?i)^\s*ALTER\s+TABLE\b`)
+	alterDropPattern = regexp.MustCompile("(?i)\\bDROP\\s+(?:COLUMN\\s+)?`?(\\w+)`?")
+	alterTypePattern = regexp.MustCompile(`(?i)\b(MODIFY|CHANGE)\s+(COLUMN\s+)?\w+`)
+)
+
+// dropping these keeps the data, so they are not treated as a dropped column
+var nonColumnDrops = map[string]bool{
+	"INDEX":      true,
+	"KEY":        true,
+	"FOREIGN":    true,
+	"PRIMARY":    true,
+	"CONSTRAINT": true,
+	"CHECK":      true,
+	"DEFAULT":    true,
+	"PARTITION":  true,
+}
+
+type migrationFile struct {
+	version uint
+	path    string
+}
+
+type destructiveStatement struct {
+	file      string
+	operation string
+}
+
+// preflight scans the SQL files that are about to run and refuses destructive statements
+// unless they were explicitly allowed
+func (runner *Runner) preflight(files []migrationFile, allowDestructive bool) error {
+	statements, err := findDestructiveStatements(files)
+	if err != nil {
+		return err
+	}
+
+	if len(statements) == 0 {
+		return nil
+	}
+
+	for _, statement := range statements {
+		fmt.Fprintf(runner.out, "destructive migration: %s (%s)\n", statement.file, statement.operation)
+	}
+
+	if !allowDestructive {
+		return ErrDestructiveMigration
+	}
+
+	return nil
+}
+
+func listMigrationFiles(dir string, suffix string, include func(version uint) bool) ([]migrationFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations directory: %v", err)
+	}
+
+	files := []migrationFile{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		prefix, _, found := strings.Cut(name, "_")
+		if !found {
+			continue
+		}
+
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if include(uint(version)) {
+			files = append(files, migrationFile{version: uint(version), path: filepath.Join(dir, name)})
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].version < files[j].version
+	})
+
+	return files, nil
+}
+
+func findDestructiveStatements(files []migrationFile) ([]destructiveStatement, error) {
+	statements := []destructiveStatement{}
+
+	for _, file := range files {
+		content, err := os.ReadFile(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %s: %v", file.path, err)
+		}
+
+		for _, statement := range strings.Split(string(content), ";") {
+			for _, operation := range statementOperations(statement) {
+				statements = append(statements, destructiveStatement{
+					file:      filepath.Base(file.path),
+					operation: operation,
+				})
+			}
+		}
+	}
+
+	return statements, nil
+}
+
+// statementOperations returns the destructive operations found in a single SQL statement
+func statementOperations(statement string) []string {
+	operations := []string{}
+
+	for operation, pattern := range destructivePatterns {
+		if pattern.MatchString(statement) {
+			operations = append(operations, operation)
+		}
+	}
+
+	if !alterStatement.MatchString(statement) {
+		return operations
+	}
+
+	for _, match := range alterDropPattern.FindAllStringSubmatch(statement, -1) {
+		if !nonColumnDrops[strings.ToUpper(match[1])] {
+			operations = append(operations, "drop column")
+			break
+		}
+	}
+
+	if alterTypePattern.MatchString(statement) {
+		operations = append(operations, "column type change")
+	}
+
+	return operations
+}
+
+// withMigrationLock holds a MySQL advisory lock while fn runs so that
+// replicas starting at the same time apply migrations one after another
+func withMigrationLock(db *sql.DB, fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), (migrationLockTimeout+5)*time.Second)
+	defer cancel()
+
+	// advisory locks belong to a session, so the lock and unlock must use the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get connection for migration lock: %v", err)
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeout).Scan(&acquired); err != nil {
+		return fmt.Errorf("could not acquire migration lock: %v", err)
+	}
+
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return fmt.Errorf("timed out after %ds waiting for migration lock held by another instance", migrationLockTimeout)
+	}
+
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName)
+
+	return fn()
+}
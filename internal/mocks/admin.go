@@ -0,0 +1,463 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+type SupportTicketStore struct {
+	*data
+}
+
+func (storage *SupportTicketStore) Create(ctx context.Context, ticket *models.SupportTicket) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if ticket.Status == "" {
+		ticket.Status = models.TicketOpen
+	}
+	ticket.ID = storage.id()
+	ticket.CreatedAt = now()
+	ticket.UpdatedAt = ticket.CreatedAt
+
+	stored := *ticket
+	storage.tickets[ticket.ID] = &stored
+
+	return nil
+}
+
+func (storage *SupportTicketStore) GetByID(ctx context.Context, id int64) (*models.SupportTicket, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	ticket, ok := storage.tickets[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	copied := *ticket
+	return &copied, nil
+}
+
+// List returns a page of tickets, newest first unless sorted ascending
+func (storage *SupportTicketStore) List(ctx context.Context, query store.SupportTicketQuery) ([]*models.SupportTicket, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	tickets := []*models.SupportTicket{}
+	for _, ticket := range storage.tickets {
+		if query.Status == "" || ticket.Status == query.Status {
+			copied := *ticket
+			tickets = append(tickets, &copied)
+		}
+	}
+	newestFirst(tickets, query.Sort, func(ticket *models.SupportTicket) int64 { return ticket.ID })
+
+	return page(tickets, query.Offset, query.Limit), nil
+}
+
+// Respond stores the answer of adminID and moves the ticket to status
+func (storage *SupportTicketStore) Respond(ctx context.Context, id, adminID int64, response, status string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	ticket, ok := storage.tickets[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	respondedAt := time.Now().UTC()
+	ticket.Response, ticket.Status = response, status
+	ticket.RespondedBy, ticket.RespondedAt = &adminID, &respondedAt
+	ticket.UpdatedAt = now()
+
+	return nil
+}
+
+type FileStore struct {
+	*data
+}
+
+// Create records an upload, a second one for the same key is store.ErrConflict
+func (storage *FileStore) Create(ctx context.Context, file *models.File) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if _, ok := storage.files[file.Key]; ok {
+		return store.ErrConflict
+	}
+
+	if file.Status == "" {
+		file.Status = models.FileActive
+	}
+	file.ID = storage.id()
+	file.CreatedAt = now()
+	file.UpdatedAt = file.CreatedAt
+
+	stored := *file
+	storage.files[file.Key] = &stored
+
+	return nil
+}
+
+// MarkActive confirms a pending upload once its object exists, with the size found in storage
+func (storage *FileStore) MarkActive(ctx context.Context, key string, size int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	file, ok := storage.files[key]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	file.Status, file.Size = models.FileActive, size
+	file.UpdatedAt = now()
+
+	return nil
+}
+
+// DeleteByKey forgets an object, store.ErrNotFound when it was never recorded
+func (storage *FileStore) DeleteByKey(ctx context.Context, key string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if _, ok := storage.files[key]; !ok {
+		return store.ErrNotFound
+	}
+	delete(storage.files, key)
+
+	return nil
+}
+
+// ListPendingBefore returns the uploads still pending that were started before cutoff
+func (storage *FileStore) ListPendingBefore(ctx context.Context, cutoff time.Time) ([]*models.File, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	files := []*models.File{}
+	for _, file := range storage.files {
+		if file.Status == models.FilePending && createdBetween(file.CreatedAt, nil, &cutoff) {
+			copied := *file
+			files = append(files, &copied)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+
+	return files, nil
+}
+
+// ExistingKeys reports which of keys have a row, in any status
+func (storage *FileStore) ExistingKeys(ctx context.Context, keys []string) (map[string]bool, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	existing := map[string]bool{}
+	for _, key := range keys {
+		if _, ok := storage.files[key]; ok {
+			existing[key] = true
+		}
+	}
+
+	return existing, nil
+}
+
+// delivery is a webhook delivery with the instance that leased it
+type delivery struct {
+	models.WebhookDelivery
+	lockedBy string
+}
+
+type WebhookStore struct {
+	*data
+}
+
+func (storage *WebhookStore) Create(ctx context.Context, webhook *models.Webhook) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	webhook.ID = storage.id()
+	webhook.CreatedAt = now()
+	webhook.UpdatedAt = webhook.CreatedAt
+
+	stored := *webhook
+	storage.webhooks[webhook.ID] = &stored
+
+	return nil
+}
+
+func (storage *WebhookStore) GetByID(ctx context.Context, id int64) (*models.Webhook, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	webhook, ok := storage.webhooks[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	copied := *webhook
+	return &copied, nil
+}
+
+// List returns every webhook
+func (storage *WebhookStore) List(ctx context.Context) ([]*models.Webhook, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	webhooks := []*models.Webhook{}
+	for _, webhook := range storage.webhooks {
+		copied := *webhook
+		webhooks = append(webhooks, &copied)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+
+	return webhooks, nil
+}
+
+// Update saves the url, events, description and enabled flag, the secret never changes
+func (storage *WebhookStore) Update(ctx context.Context, webhook *models.Webhook) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	stored, ok := storage.webhooks[webhook.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	stored.URL, stored.Events, stored.Description, stored.Enabled = webhook.URL, webhook.Events, webhook.Description, webhook.Enabled
+	stored.UpdatedAt = now()
+	webhook.UpdatedAt = stored.UpdatedAt
+
+	return nil
+}
+
+// Delete removes the webhook together with its deliveries
+func (storage *WebhookStore) Delete(ctx context.Context, id int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if _, ok := storage.webhooks[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(storage.webhooks, id)
+	storage.deliveries = slices.DeleteFunc(storage.deliveries, func(delivery *delivery) bool { return delivery.WebhookID == id })
+
+	return nil
+}
+
+// Enqueue queues payload for every enabled webhook subscribed to event and returns how
+// many deliveries were created
+func (storage *WebhookStore) Enqueue(ctx context.Context, event, eventID string, payload []byte) (int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	var queued int64
+	dueAt := time.Now()
+	for _, webhook := range storage.webhooks {
+		if !webhook.Enabled || !slices.Contains(webhook.Events, event) {
+			continue
+		}
+
+		storage.deliveries = append(storage.deliveries, &delivery{WebhookDelivery: models.WebhookDelivery{
+			ID:            storage.id(),
+			WebhookID:     webhook.ID,
+			EventID:       eventID,
+			Event:         event,
+			Payload:       slices.Clone(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &dueAt,
+			CreatedAt:     now(),
+		}})
+		queued++
+	}
+
+	return queued, nil
+}
+
+// ClaimDue leases up to limit deliveries that are due to token and counts the attempt.
+// A delivery whose lease ran out is due again.
+func (storage *WebhookStore) ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	claimed := []*models.WebhookDelivery{}
+	current := time.Now()
+	for _, delivery := range storage.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if delivery.Status != models.DeliveryPending && delivery.Status != models.DeliverySending {
+			continue
+		}
+		if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(current) {
+			continue
+		}
+
+		leaseEnd := current.Add(lease)
+		delivery.Status, delivery.lockedBy = models.DeliverySending, token
+		delivery.Attempts++
+		delivery.NextAttemptAt = &leaseEnd
+
+		copied := delivery.WebhookDelivery
+		webhook := storage.webhooks[delivery.WebhookID]
+		copied.URL, copied.Secret = webhook.URL, webhook.Secret
+		claimed = append(claimed, &copied)
+	}
+
+	return claimed, nil
+}
+
+// MarkDelivered records the successful attempt of a delivery
+func (storage *WebhookStore) MarkDelivered(ctx context.Context, id int64, responseStatus int) error {
+	return storage.mark(id, func(delivery *delivery) {
+		deliveredAt := time.Now().UTC()
+		delivery.Status = models.DeliveryDelivered
+		delivery.ResponseStatus = &responseStatus
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &deliveredAt
+	})
+}
+
+// MarkFailed records a failed attempt. The delivery is retried after retryIn, or given
+// up on for good when retryIn is zero.
+func (storage *WebhookStore) MarkFailed(ctx context.Context, id int64, responseStatus *int, lastError string, retryIn time.Duration) error {
+	return storage.mark(id, func(delivery *delivery) {
+		delivery.Status = models.DeliveryPending
+		if retryIn <= 0 {
+			delivery.Status = models.DeliveryFailed
+		}
+		nextAttemptAt := time.Now().Add(retryIn)
+		delivery.ResponseStatus = responseStatus
+		delivery.LastError = lastError
+		delivery.NextAttemptAt = &nextAttemptAt
+	})
+}
+
+// ListDeliveries returns a page of the deliveries of a webhook, newest first
+func (storage *WebhookStore) ListDeliveries(ctx context.Context, webhookID int64, query store.WebhookDeliveryQuery) ([]*models.WebhookDelivery, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for _, delivery := range storage.deliveries {
+		if delivery.WebhookID != webhookID || (query.Status != "" && delivery.Status != query.Status) {
+			continue
+		}
+		copied := delivery.WebhookDelivery
+		deliveries = append(deliveries, &copied)
+	}
+	newestFirst(deliveries, "desc", func(delivery *models.WebhookDelivery) int64 { return delivery.ID })
+
+	return page(deliveries, query.Offset, query.Limit), nil
+}
+
+func (storage *WebhookStore) mark(id int64, change func(delivery *delivery)) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, delivery := range storage.deliveries {
+		if delivery.ID == id {
+			change(delivery)
+			delivery.lockedBy = ""
+		}
+	}
+
+	return nil
+}
+
+// cronRun is a row of cron_runs, unique on the job and its schedule time
+type cronRun struct {
+	job   string
+	runAt time.Time
+}
+
+type CronRunStore struct {
+	*data
+}
+
+// Claim records that instance runs job for the schedule time runAt. It returns false
+// when another instance recorded the same run first.
+func (storage *CronRunStore) Claim(ctx context.Context, job string, runAt time.Time, instance string) (bool, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	key := cronRun{job: job, runAt: runAt.UTC()}
+	if _, ok := storage.cronRuns[key]; ok {
+		return false, nil
+	}
+	storage.cronRuns[key] = instance
+
+	return true, nil
+}
+
+type ScheduledJobStore struct {
+	*data
+}
+
+// List returns every job by name
+func (storage *ScheduledJobStore) List(ctx context.Context) ([]*models.ScheduledJob, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	jobs := []*models.ScheduledJob{}
+	for _, job := range storage.scheduledJobs {
+		copied := *job
+		jobs = append(jobs, &copied)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+
+	return jobs, nil
+}
+
+func (storage *ScheduledJobStore) GetByName(ctx context.Context, name string) (*models.ScheduledJob, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	job, ok := storage.scheduledJobs[name]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	copied := *job
+	return &copied, nil
+}
+
+// CreateMissing inserts the jobs that are not stored yet and leaves the others untouched
+func (storage *ScheduledJobStore) CreateMissing(ctx context.Context, jobs []*models.ScheduledJob) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, job := range jobs {
+		if _, ok := storage.scheduledJobs[job.Name]; ok {
+			continue
+		}
+
+		stored := *job
+		stored.ID = storage.id()
+		stored.CreatedAt = now()
+		stored.UpdatedAt = stored.CreatedAt
+		storage.scheduledJobs[job.Name] = &stored
+	}
+
+	return nil
+}
+
+func (storage *ScheduledJobStore) Update(ctx context.Context, job *models.ScheduledJob) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	stored, ok := storage.scheduledJobs[job.Name]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	stored.CronExpr, stored.Enabled, stored.Payload = job.CronExpr, job.Enabled, job.Payload
+	stored.UpdatedAt = now()
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package mocks
+
+import (
+	"godsendjoseph.dev/sandbox-api/internal/store/cache"
+)
+
+// NewCache returns a cache.Storage on the in-memory backend, the one used when Redis is off
+func NewCache() cache.Storage {
+	return cache.NewStorage(nil, cache.Config{
+		Users:          cache.EntityConfig{TTL: cache.UserExpTime, Size: 1000},
+		Feeds:          cache.EntityConfig{TTL: cache.FeedExpTime, Size: 1000},
+		MemoryFallback: true,
+	})
+}
@@ -0,0 +1,286 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+type EmailCampaignStore struct {
+	*data
+}
+
+// Create saves the campaign and picks its recipients from the audience. A campaign
+// without recipients is completed right away.
+func (storage *EmailCampaignStore) Create(ctx context.Context, campaign *models.EmailCampaign) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	campaign.ID = storage.id()
+	campaign.Status = models.CampaignSending
+	campaign.CreatedBy = actor(ctx)
+	campaign.CreatedAt = now()
+	campaign.UpdatedAt = campaign.CreatedAt
+
+	stored := *campaign
+	storage.campaigns[campaign.ID] = &stored
+
+	// soft deleted accounts never get a campaign
+	var total int
+	for _, id := range sortedUserIDs(storage.data) {
+		user := storage.users[id].user
+		if user.DeletedAt != nil {
+			continue
+		}
+		if campaign.Audience != models.AudienceAll && !user.IsActive {
+			continue
+		}
+		if campaign.Audience == models.AudienceRole {
+			if role := storage.role(campaign.Role); role == nil || role.ID != user.RoleID {
+				continue
+			}
+		}
+
+		userID := user.ID
+		storage.recipients = append(storage.recipients, &models.CampaignRecipient{
+			ID:         storage.id(),
+			CampaignID: campaign.ID,
+			UserID:     &userID,
+			Username:   user.Username,
+			Email:      user.Email,
+			Status:     models.RecipientPending,
+		})
+		total++
+	}
+
+	if total == 0 {
+		stored.Status = models.CampaignCompleted
+		stored.CompletedAt = now()
+	}
+
+	*campaign = *storage.withProgress(&stored)
+	return nil
+}
+
+func (storage *EmailCampaignStore) GetByID(ctx context.Context, id int64) (*models.EmailCampaign, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	campaign, ok := storage.campaigns[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return storage.withProgress(campaign), nil
+}
+
+// List returns a page of the campaigns with their progress, newest first
+func (storage *EmailCampaignStore) List(ctx context.Context, query store.EmailCampaignQuery) ([]*models.EmailCampaign, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	campaigns := []*models.EmailCampaign{}
+	for _, campaign := range storage.campaigns {
+		if query.Status == "" || campaign.Status == query.Status {
+			campaigns = append(campaigns, storage.withProgress(campaign))
+		}
+	}
+	newestFirst(campaigns, "desc", func(campaign *models.EmailCampaign) int64 { return campaign.ID })
+
+	return page(campaigns, query.Offset, query.Limit), nil
+}
+
+// Cancel stops a campaign that is still sending, store.ErrConflict when it already finished
+func (storage *EmailCampaignStore) Cancel(ctx context.Context, id int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	campaign, ok := storage.campaigns[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if campaign.Status != models.CampaignSending {
+		return store.ErrConflict
+	}
+
+	campaign.Status = models.CampaignCancelled
+	campaign.CompletedAt = now()
+	for _, recipient := range storage.recipients {
+		if recipient.CampaignID == id && recipient.Status == models.RecipientPending {
+			recipient.Status = models.RecipientCancelled
+		}
+	}
+
+	return nil
+}
+
+// ListPending returns up to limit recipients waiting to be emailed, the oldest campaign first
+func (storage *EmailCampaignStore) ListPending(ctx context.Context, limit int) ([]*models.CampaignRecipient, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	recipients := []*models.CampaignRecipient{}
+	for _, recipient := range storage.recipients {
+		campaign := storage.campaigns[recipient.CampaignID]
+		if campaign.Status == models.CampaignSending && recipient.Status == models.RecipientPending {
+			copied := *recipient
+			recipients = append(recipients, &copied)
+		}
+	}
+	sort.SliceStable(recipients, func(i, j int) bool { return recipients[i].CampaignID < recipients[j].CampaignID })
+
+	return page(recipients, 0, limit), nil
+}
+
+// MarkRecipient records that a pending recipient was queued, opted out or failed
+func (storage *EmailCampaignStore) MarkRecipient(ctx context.Context, id int64, status, lastError string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, recipient := range storage.recipients {
+		if recipient.ID == id && recipient.Status == models.RecipientPending {
+			recipient.Status, recipient.LastError = status, lastError
+		}
+	}
+
+	return nil
+}
+
+// CompleteFinished completes the sending campaigns without pending recipients and returns
+// how many it completed
+func (storage *EmailCampaignStore) CompleteFinished(ctx context.Context) (int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	var completed int64
+	for _, campaign := range storage.campaigns {
+		if campaign.Status != models.CampaignSending || storage.withProgress(campaign).Progress.Pending > 0 {
+			continue
+		}
+		campaign.Status = models.CampaignCompleted
+		campaign.CompletedAt = now()
+		completed++
+	}
+
+	return completed, nil
+}
+
+// withProgress copies the campaign with its recipients counted, the caller holds mu
+func (storage *EmailCampaignStore) withProgress(campaign *models.EmailCampaign) *models.EmailCampaign {
+	copied := *campaign
+	copied.Progress = models.CampaignProgress{}
+
+	for _, recipient := range storage.recipients {
+		if recipient.CampaignID != campaign.ID {
+			continue
+		}
+
+		copied.Progress.Total++
+		switch recipient.Status {
+		case models.RecipientPending:
+			copied.Progress.Pending++
+		case models.RecipientQueued:
+			copied.Progress.Queued++
+		case models.RecipientFailed:
+			copied.Progress.Failed++
+		case models.RecipientCancelled:
+			copied.Progress.Cancelled++
+		case models.RecipientOptedOut:
+			copied.Progress.OptedOut++
+		}
+	}
+
+	return &copied
+}
+
+// MailTemplateStore keeps every version of the edited email templates
+type MailTemplateStore struct {
+	*data
+}
+
+// Create saves content as the next version of the template and makes it the active one
+func (storage *MailTemplateStore) Create(ctx context.Context, mailTemplate *models.MailTemplate) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	version := 0
+	for _, saved := range storage.mailTemplates {
+		if saved.Name == mailTemplate.Name {
+			version = max(version, saved.Version)
+			saved.Active = false
+		}
+	}
+
+	mailTemplate.ID = storage.id()
+	mailTemplate.Version = version + 1
+	mailTemplate.Active = true
+	mailTemplate.CreatedBy = actor(ctx)
+	mailTemplate.CreatedAt = now()
+
+	stored := *mailTemplate
+	storage.mailTemplates = append(storage.mailTemplates, &stored)
+
+	return nil
+}
+
+// ListVersions returns every version of a template, newest first
+func (storage *MailTemplateStore) ListVersions(ctx context.Context, name string) ([]*models.MailTemplate, error) {
+	return storage.list(func(mailTemplate *models.MailTemplate) bool { return mailTemplate.Name == name }), nil
+}
+
+// ListActive returns the active version of every edited template
+func (storage *MailTemplateStore) ListActive(ctx context.Context) ([]*models.MailTemplate, error) {
+	return storage.list(func(mailTemplate *models.MailTemplate) bool { return mailTemplate.Active }), nil
+}
+
+// Activate makes version the one that is sent, 0 goes back to the embedded template
+func (storage *MailTemplateStore) Activate(ctx context.Context, name string, version int) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	found := version == 0
+	for _, saved := range storage.mailTemplates {
+		if saved.Name == name && saved.Version == version {
+			found = true
+		}
+	}
+	if !found {
+		return store.ErrNotFound
+	}
+
+	for _, saved := range storage.mailTemplates {
+		if saved.Name == name {
+			saved.Active = saved.Version == version
+		}
+	}
+
+	return nil
+}
+
+func (storage *MailTemplateStore) list(keep func(*models.MailTemplate) bool) []*models.MailTemplate {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	mailTemplates := []*models.MailTemplate{}
+	for _, saved := range storage.mailTemplates {
+		if keep(saved) {
+			copied := *saved
+			mailTemplates = append(mailTemplates, &copied)
+		}
+	}
+	newestFirst(mailTemplates, "desc", func(mailTemplate *models.MailTemplate) int64 { return mailTemplate.ID })
+
+	return mailTemplates
+}
+
+// sortedUserIDs returns the ids of every user in order, the caller holds mu
+func sortedUserIDs(state *data) []int64 {
+	ids := make([]int64, 0, len(state.users))
+	for id := range state.users {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,74 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+type DeviceStore struct {
+	*data
+}
+
+// Record stores a sign-in from device and reports whether the device is new, the first
+// device of an account never is
+func (storage *DeviceStore) Record(ctx context.Context, device *models.UserDevice) (bool, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	seenAt := time.Now().UTC()
+	known := false
+	for _, stored := range storage.devices {
+		if stored.UserID != device.UserID {
+			continue
+		}
+		known = true
+
+		if stored.Fingerprint() == device.Fingerprint() {
+			stored.LastSeenAt = seenAt
+			*device = *stored
+			return false, nil
+		}
+	}
+
+	device.ID = storage.id()
+	device.FirstSeenAt, device.LastSeenAt, device.ReportedAt = seenAt, seenAt, nil
+
+	stored := *device
+	storage.devices[device.ID] = &stored
+
+	return known, nil
+}
+
+// GetByID returns the device, reported or not
+func (storage *DeviceStore) GetByID(ctx context.Context, id int64) (*models.UserDevice, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	device, ok := storage.devices[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	copied := *device
+	return &copied, nil
+}
+
+// MarkReported records that the user did not sign in from the device, ErrDeviceReported
+// the second time
+func (storage *DeviceStore) MarkReported(ctx context.Context, id int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	device, ok := storage.devices[id]
+	if !ok || device.ReportedAt != nil {
+		return store.ErrDeviceReported
+	}
+
+	reportedAt := time.Now().UTC()
+	device.ReportedAt = &reportedAt
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type DigestStore struct {
+	*data
+}
+
+// ListActivity returns the activity since since of up to limit verified users with an id
+// above afterID, in id order, leaving out those who opted out of category
+func (storage *DigestStore) ListActivity(ctx context.Context, since time.Time, category string, afterID int64, limit int) ([]*models.UserActivity, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	activities := []*models.UserActivity{}
+	for id, row := range storage.users {
+		if id <= afterID || !row.user.IsActive || row.user.DeletedAt != nil {
+			continue
+		}
+		if settings, ok := storage.settings[id]; ok && slices.Contains(settings.EmailOptOuts, category) {
+			continue
+		}
+
+		activity := &models.UserActivity{UserID: id, Username: row.user.Username, Email: row.user.Email}
+		for key, followedAt := range storage.followers {
+			if key.userID != id {
+				continue
+			}
+			activity.Followers++
+			if !followedAt.Before(since) {
+				activity.NewFollowers++
+			}
+		}
+		for _, post := range storage.posts {
+			if post.UserID != id {
+				continue
+			}
+			activity.Posts++
+			if createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt); err == nil && !createdAt.Before(since) {
+				activity.NewPosts++
+			}
+		}
+		activities = append(activities, activity)
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		return activities[i].UserID < activities[j].UserID
+	})
+
+	if len(activities) > limit {
+		activities = activities[:limit]
+	}
+	return activities, nil
+}
@@ -0,0 +1,62 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+type InvitationStore struct {
+	*data
+}
+
+func (storage *InvitationStore) Create(ctx context.Context, invitation *models.Invitation) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	invitation.ID = storage.id()
+	invitation.NormalizedEmail = normalizeEmail(invitation.Email)
+	invitation.CreatedAt = now()
+
+	stored := *invitation
+	storage.invitations[invitation.ID] = &stored
+
+	return nil
+}
+
+// GetByID returns the invitation with its role, accepted or not
+func (storage *InvitationStore) GetByID(ctx context.Context, id int64) (*models.Invitation, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	invitation, ok := storage.invitations[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	copied := *invitation
+	for _, role := range storage.roles {
+		if role.ID == invitation.RoleID {
+			copied.Role = *role
+		}
+	}
+	return &copied, nil
+}
+
+// Accept marks the invitation used by userID, ErrInvitationUsed once it was or it expired
+func (storage *InvitationStore) Accept(ctx context.Context, id, userID int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	invitation, ok := storage.invitations[id]
+	if !ok || invitation.AcceptedAt != nil || invitation.Expired(time.Now()) {
+		return store.ErrInvitationUsed
+	}
+
+	acceptedAt := time.Now().UTC()
+	invitation.AcceptedAt, invitation.AcceptedBy = &acceptedAt, &userID
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// job is a background job with the instance that leased it
+type job struct {
+	models.Job
+	lockedBy string
+}
+
+type JobStore struct {
+	*data
+}
+
+// Enqueue stores a pending job, due at job.RunAt
+func (storage *JobStore) Enqueue(ctx context.Context, queued *models.Job) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	queued.ID = storage.id()
+	queued.Status = models.JobPending
+	queued.CreatedAt = now()
+
+	stored := *queued
+	stored.Payload = slices.Clone(queued.Payload)
+	storage.jobs = append(storage.jobs, &job{Job: stored})
+
+	return nil
+}
+
+// ClaimDue leases up to limit due jobs to token, the highest priority first, and counts
+// the attempt. A job whose lease ran out is due again.
+func (storage *JobStore) ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.Job, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	current := time.Now()
+	due := []*job{}
+	for _, queued := range storage.jobs {
+		if queued.Status != models.JobPending && queued.Status != models.JobRunning {
+			continue
+		}
+		if queued.RunAt.After(current) {
+			continue
+		}
+		due = append(due, queued)
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		if due[i].Priority != due[j].Priority {
+			return due[i].Priority > due[j].Priority
+		}
+		return due[i].RunAt.Before(due[j].RunAt)
+	})
+
+	claimed := []*models.Job{}
+	for _, queued := range due {
+		if len(claimed) == limit {
+			break
+		}
+
+		queued.Status, queued.lockedBy = models.JobRunning, token
+		queued.Attempts++
+		queued.RunAt = current.Add(lease)
+
+		copied := queued.Job
+		claimed = append(claimed, &copied)
+	}
+
+	return claimed, nil
+}
+
+// MarkDone deletes a job that succeeded
+func (storage *JobStore) MarkDone(ctx context.Context, id int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	storage.jobs = slices.DeleteFunc(storage.jobs, func(queued *job) bool { return queued.ID == id })
+
+	return nil
+}
+
+// MarkFailed records a failed attempt. The job is retried after retryIn, or kept as failed
+// when retryIn is zero.
+func (storage *JobStore) MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, queued := range storage.jobs {
+		if queued.ID != id {
+			continue
+		}
+
+		queued.Status = models.JobPending
+		if retryIn <= 0 {
+			queued.Status = models.JobFailed
+		}
+		queued.LastError, queued.lockedBy = lastError, ""
+		queued.RunAt = time.Now().Add(retryIn)
+	}
+
+	return nil
+}
+
+// CountByStatus counts the jobs by status, a status without jobs is missing
+func (storage *JobStore) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	counts := map[string]int64{}
+	for _, queued := range storage.jobs {
+		counts[queued.Status]++
+	}
+
+	return counts, nil
+}
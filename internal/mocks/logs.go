@@ -0,0 +1,285 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+type EmailLogStore struct {
+	*data
+}
+
+func (storage *EmailLogStore) Create(ctx context.Context, log *models.EmailLog) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	log.ID = storage.id()
+	log.CreatedAt = now()
+
+	stored := *log
+	storage.emailLogs = append(storage.emailLogs, &stored)
+
+	return nil
+}
+
+// List returns a page of email logs, newest first unless sorted ascending
+func (storage *EmailLogStore) List(ctx context.Context, query store.EmailLogQuery) ([]*models.EmailLog, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	logs := []*models.EmailLog{}
+	for _, log := range storage.emailLogs {
+		if query.Status != "" && log.Status != query.Status {
+			continue
+		}
+		if query.Recipient != "" && log.Recipient != query.Recipient {
+			continue
+		}
+		if query.Template != "" && log.Template != query.Template {
+			continue
+		}
+		if !createdBetween(log.CreatedAt, query.Since, query.Until) {
+			continue
+		}
+
+		copied := *log
+		logs = append(logs, &copied)
+	}
+	newestFirst(logs, query.Sort, func(log *models.EmailLog) int64 { return log.ID })
+
+	return page(logs, query.Offset, query.Limit), nil
+}
+
+// AuditLogStore is append only like the real one
+type AuditLogStore struct {
+	*data
+}
+
+// Create records an entry, ActorID defaults to the actor of ctx (see store.ContextWithActor)
+func (storage *AuditLogStore) Create(ctx context.Context, log *models.AuditLog) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if log.ActorID == nil {
+		log.ActorID = actor(ctx)
+	}
+	log.ID = storage.id()
+	log.CreatedAt = now()
+
+	stored := *log
+	storage.auditLogs = append(storage.auditLogs, &stored)
+
+	return nil
+}
+
+// List returns a page of the trail, newest first unless sorted ascending
+func (storage *AuditLogStore) List(ctx context.Context, query store.AuditLogQuery) ([]*models.AuditLog, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	logs := []*models.AuditLog{}
+	for _, log := range storage.auditLogs {
+		if query.UserID != 0 && (log.UserID == nil || *log.UserID != query.UserID) {
+			continue
+		}
+		if query.Action != "" && log.Action != query.Action {
+			continue
+		}
+		if !createdBetween(log.CreatedAt, query.Since, query.Until) {
+			continue
+		}
+
+		copied := *log
+		logs = append(logs, &copied)
+	}
+	newestFirst(logs, query.Sort, func(log *models.AuditLog) int64 { return log.ID })
+
+	return page(logs, query.Offset, query.Limit), nil
+}
+
+type NotificationStore struct {
+	*data
+}
+
+func (storage *NotificationStore) Create(ctx context.Context, notification *models.Notification) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	notification.ID = storage.id()
+	notification.CreatedAt = now()
+
+	stored := *notification
+	storage.notifications = append(storage.notifications, &stored)
+
+	return nil
+}
+
+// List returns a page of the notifications of userID, newest first
+func (storage *NotificationStore) List(ctx context.Context, userID int64, query store.NotificationQuery) ([]*models.Notification, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	notifications := []*models.Notification{}
+	for _, notification := range storage.notifications {
+		if notification.UserID != userID || (query.Unread && notification.ReadAt != nil) {
+			continue
+		}
+
+		copied := *notification
+		notifications = append(notifications, &copied)
+	}
+	newestFirst(notifications, "desc", func(notification *models.Notification) int64 { return notification.ID })
+
+	return page(notifications, query.Offset, query.Limit), nil
+}
+
+// CountUnread returns how many notifications of userID are not read yet
+func (storage *NotificationStore) CountUnread(ctx context.Context, userID int64) (int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	var count int64
+	for _, notification := range storage.notifications {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// MarkRead marks one notification of userID read, store.ErrNotFound when it belongs to
+// someone else. Marking it again keeps the first read time.
+func (storage *NotificationStore) MarkRead(ctx context.Context, userID, id int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, notification := range storage.notifications {
+		if notification.ID != id || notification.UserID != userID {
+			continue
+		}
+		if notification.ReadAt == nil {
+			readAt := time.Now().UTC()
+			notification.ReadAt = &readAt
+		}
+		return nil
+	}
+
+	return store.ErrNotFound
+}
+
+// MarkAllRead marks every notification of userID read and returns how many were unread
+func (storage *NotificationStore) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	var marked int64
+	readAt := time.Now().UTC()
+	for _, notification := range storage.notifications {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			notification.ReadAt = &readAt
+			marked++
+		}
+	}
+
+	return marked, nil
+}
+
+type SettingsStore struct {
+	*data
+}
+
+// Get returns the settings of a user, the defaults when they never saved any
+func (storage *SettingsStore) Get(ctx context.Context, userID int64) (*models.UserSettings, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	settings, ok := storage.settings[userID]
+	if !ok {
+		return models.DefaultUserSettings(userID), nil
+	}
+
+	copied := *settings
+	copied.EmailOptOuts = slices.Clone(settings.EmailOptOuts)
+	return &copied, nil
+}
+
+// Save stores every field of settings, creating them on the first save
+func (storage *SettingsStore) Save(ctx context.Context, settings *models.UserSettings) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	settings.UpdatedAt = now()
+
+	stored := *settings
+	stored.EmailOptOuts = slices.Clone(settings.EmailOptOuts)
+	storage.settings[settings.UserID] = &stored
+
+	return nil
+}
+
+// OptedOut reports whether the user with email turned off the emails of category
+func (storage *SettingsStore) OptedOut(ctx context.Context, email, category string) (bool, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, row := range storage.users {
+		if row.user.Email != email {
+			continue
+		}
+		if settings, ok := storage.settings[row.user.ID]; ok && slices.Contains(settings.EmailOptOuts, category) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type RoleStore struct {
+	*data
+}
+
+func (storage *RoleStore) GetByName(ctx context.Context, name string) (*models.Role, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	role := storage.role(name)
+	if role == nil {
+		return nil, store.ErrNotFound
+	}
+
+	copied := *role
+	return &copied, nil
+}
+
+func (storage *RoleStore) List(ctx context.Context) ([]*models.Role, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	roles := make([]*models.Role, 0, len(storage.roles))
+	for _, role := range storage.roles {
+		copied := *role
+		roles = append(roles, &copied)
+	}
+
+	return roles, nil
+}
+
+// createdBetween is the since (inclusive) and until (exclusive) filter of the log queries
+func createdBetween(createdAt string, since, until *time.Time) bool {
+	created, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return false
+	}
+	if since != nil && created.Before(*since) {
+		return false
+	}
+	if until != nil && !created.Before(*until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/mailer"
+)
+
+// SentMail is one email handed to Mailer
+type SentMail struct {
+	Template     string
+	Username     string
+	Email        string
+	Subject      string
+	Data         any
+	Attachments  []mailer.Attachment
+	DeliveryMode string
+	IsSandbox    bool
+	// SendAt is set for the emails sent with SendAt, which the fake keeps right away
+	SendAt time.Time
+}
+
+// Mailer is a mailer.Client that keeps the emails instead of sending them. Err, when set,
+// is returned by every send, to exercise the paths where the provider is down.
+type Mailer struct {
+	Err error
+
+	mu   sync.Mutex
+	sent []SentMail
+}
+
+func NewMailer() *Mailer {
+	return &Mailer{}
+}
+
+func (client *Mailer) Send(templateFile, username, email, subject string, data any, isSandBox bool) error {
+	return client.SendWithAttachments(templateFile, username, email, subject, data, nil, mailer.SyncDelivery, isSandBox)
+}
+
+func (client *Mailer) SendWithOptions(templateFile, username, email, subject string, data any, deliveryMode string, isSandBox bool) error {
+	return client.SendWithAttachments(templateFile, username, email, subject, data, nil, deliveryMode, isSandBox)
+}
+
+func (client *Mailer) SendWithAttachments(templateFile, username, email, subject string, data any, attachments []mailer.Attachment, deliveryMode string, isSandBox bool) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.Err != nil {
+		return client.Err
+	}
+
+	client.sent = append(client.sent, SentMail{
+		Template:     templateFile,
+		Username:     username,
+		Email:        email,
+		Subject:      subject,
+		Data:         data,
+		Attachments:  attachments,
+		DeliveryMode: deliveryMode,
+		IsSandbox:    isSandBox,
+	})
+
+	return nil
+}
+
+// SendAt keeps the email with when it should go out, it does not wait for it
+func (client *Mailer) SendAt(sendAt time.Time, templateFile, username, email, subject string, data any, isSandBox bool) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.Err != nil {
+		return client.Err
+	}
+
+	client.sent = append(client.sent, SentMail{
+		Template:     templateFile,
+		Username:     username,
+		Email:        email,
+		Subject:      subject,
+		Data:         data,
+		DeliveryMode: mailer.AsyncInMemory,
+		IsSandbox:    isSandBox,
+		SendAt:       sendAt,
+	})
+
+	return nil
+}
+
+// Sent returns the emails sent so far, oldest first
+func (client *Mailer) Sent() []SentMail {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return append([]SentMail(nil), client.sent...)
+}
+
+// LastTo returns the last email sent to email, false when there is none
+func (client *Mailer) LastTo(email string) (SentMail, bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	for i := len(client.sent) - 1; i >= 0; i-- {
+		if client.sent[i].Email == email {
+			return client.sent[i], true
+		}
+	}
+
+	return SentMail{}, false
+}
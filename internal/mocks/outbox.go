@@ -0,0 +1,93 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type OutboxStore struct {
+	*data
+}
+
+// Create writes a pending message. There is no transaction to join, the message is kept
+// even when the caller's WithTransaction fails.
+func (storage *OutboxStore) Create(ctx context.Context, message *models.OutboxMessage) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	message.ID = storage.id()
+	message.Status = models.OutboxPending
+	message.AvailableAt = time.Now()
+	message.CreatedAt = now()
+
+	stored := *message
+	stored.Payload = slices.Clone(message.Payload)
+	storage.outbox = append(storage.outbox, &stored)
+
+	return nil
+}
+
+// ClaimDue leases up to limit due messages and counts the attempt. A message whose lease
+// ran out is due again.
+func (storage *OutboxStore) ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	claimed := []*models.OutboxMessage{}
+	current := time.Now()
+	for _, message := range storage.outbox {
+		if len(claimed) == limit {
+			break
+		}
+		if message.Status != models.OutboxPending && message.Status != models.OutboxSending {
+			continue
+		}
+		if message.AvailableAt.After(current) {
+			continue
+		}
+
+		message.Status = models.OutboxSending
+		message.Attempts++
+		message.AvailableAt = current.Add(lease)
+
+		copied := *message
+		claimed = append(claimed, &copied)
+	}
+
+	return claimed, nil
+}
+
+// Delete removes a message that was handled
+func (storage *OutboxStore) Delete(ctx context.Context, id int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	storage.outbox = slices.DeleteFunc(storage.outbox, func(message *models.OutboxMessage) bool { return message.ID == id })
+
+	return nil
+}
+
+// MarkFailed records a failed attempt. The message is retried after retryIn, or kept as
+// failed when retryIn is zero.
+func (storage *OutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, message := range storage.outbox {
+		if message.ID != id {
+			continue
+		}
+
+		message.Status = models.OutboxPending
+		if retryIn <= 0 {
+			message.Status = models.OutboxFailed
+		}
+		message.LastError = lastError
+		message.AvailableAt = time.Now().Add(retryIn)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package mocks
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"strconv"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+type PostStore struct {
+	*data
+}
+
+func (storage *PostStore) Create(ctx context.Context, post *models.Post) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	post.ID = storage.id()
+	post.CreatedAt = now()
+	post.UpdatedAt = post.CreatedAt
+
+	stored := *post
+	stored.User = nil
+	storage.posts[post.ID] = &stored
+
+	return nil
+}
+
+func (storage *PostStore) GetByID(ctx context.Context, id int64) (*models.Post, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	post, ok := storage.posts[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return storage.withAuthor(post), nil
+}
+
+// List returns a page of posts, optionally filtered by a search term on title/content and by tags.
+// A post matches the tag filter when it has at least one of the requested tags.
+func (storage *PostStore) List(ctx context.Context, query store.PaginatedQuery) ([]*models.Post, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	posts := []*models.Post{}
+	for _, post := range storage.posts {
+		if query.Search != "" && !contains(post.Title, query.Search) && !contains(post.Content, query.Search) {
+			continue
+		}
+		if len(query.Tags) > 0 && !slices.ContainsFunc(query.Tags, func(tag string) bool { return slices.Contains(post.Tags, tag) }) {
+			continue
+		}
+		posts = append(posts, storage.withAuthor(post))
+	}
+	newestFirst(posts, query.Sort, func(post *models.Post) int64 { return post.ID })
+
+	return page(posts, query.Offset, query.Limit), nil
+}
+
+// GetFeed returns posts written by the users that userID follows, newest first, and the
+// cursor of the next page. The cursor is the id of the last post, the ids grow with time.
+func (storage *PostStore) GetFeed(ctx context.Context, userID int64, query store.FeedQuery) ([]*models.Post, string, error) {
+	var before int64
+	if query.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil {
+			return nil, "", store.ErrInvalidCursor
+		}
+		if before, err = strconv.ParseInt(string(raw), 10, 64); err != nil {
+			return nil, "", store.ErrInvalidCursor
+		}
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	posts := []*models.Post{}
+	for _, post := range storage.posts {
+		if _, ok := storage.followers[follow{userID: post.UserID, followerID: userID}]; !ok {
+			continue
+		}
+		if before != 0 && post.ID >= before {
+			continue
+		}
+		posts = append(posts, storage.withAuthor(post))
+	}
+	newestFirst(posts, "desc", func(post *models.Post) int64 { return post.ID })
+
+	if len(posts) <= query.Limit {
+		return posts, "", nil
+	}
+
+	posts = posts[:query.Limit]
+	nextCursor := base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(posts[len(posts)-1].ID, 10)))
+
+	return posts, nextCursor, nil
+}
+
+func (storage *PostStore) Update(ctx context.Context, post *models.Post) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	stored, ok := storage.posts[post.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	stored.Title, stored.Content, stored.Tags = post.Title, post.Content, post.Tags
+	stored.UpdatedAt = now()
+	post.UpdatedAt = stored.UpdatedAt
+
+	return nil
+}
+
+func (storage *PostStore) Delete(ctx context.Context, postID int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if _, ok := storage.posts[postID]; !ok {
+		return store.ErrNotFound
+	}
+	delete(storage.posts, postID)
+
+	return nil
+}
+
+// withAuthor copies the post with the columns of its author the store joins, the caller holds mu
+func (storage *PostStore) withAuthor(post *models.Post) *models.Post {
+	copied := *post
+	copied.User = &models.User{ID: post.UserID}
+	if row, ok := storage.users[post.UserID]; ok {
+		copied.User.FirstName = row.user.FirstName
+		copied.User.LastName = row.user.LastName
+		copied.User.Username = row.user.Username
+		copied.User.PrivateProfile = storage.privateProfile(post.UserID)
+	}
+	return &copied
+}
+
+// follow is a row of the followers table, followerID follows userID
+type follow struct {
+	userID, followerID int64
+}
+
+type FollowerStore struct {
+	*data
+}
+
+// Follow makes followerID follow userID, store.ErrConflict when it already does
+func (storage *FollowerStore) Follow(ctx context.Context, userID, followerID int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	key := follow{userID: userID, followerID: followerID}
+	if _, ok := storage.followers[key]; ok {
+		return store.ErrConflict
+	}
+	storage.followers[key] = time.Now()
+
+	return nil
+}
+
+// Unfollow removes followerID from the followers of userID
+func (storage *FollowerStore) Unfollow(ctx context.Context, userID, followerID int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	key := follow{userID: userID, followerID: followerID}
+	if _, ok := storage.followers[key]; !ok {
+		return store.ErrNotFound
+	}
+	delete(storage.followers, key)
+
+	return nil
+}
+
+// Counts returns how many users follow userID and how many users userID follows
+func (storage *FollowerStore) Counts(ctx context.Context, userID int64) (int64, int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	var followers, following int64
+	for key := range storage.followers {
+		if key.userID == userID {
+			followers++
+		}
+		if key.followerID == userID {
+			following++
+		}
+	}
+
+	return followers, following, nil
+}
+
+// FollowerIDs returns the IDs of the users following userID
+func (storage *FollowerStore) FollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	ids := []int64{}
+	for key := range storage.followers {
+		if key.userID == userID {
+			ids = append(ids, key.followerID)
+		}
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
@@ -0,0 +1,64 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type ScheduledEmailStore struct {
+	*data
+}
+
+// Create stores an email to send at email.SendAt and fills in its id
+func (storage *ScheduledEmailStore) Create(ctx context.Context, email *models.ScheduledEmail) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	email.ID = storage.id()
+	email.CreatedAt = now()
+
+	stored := *email
+	stored.Data = slices.Clone(email.Data)
+	storage.scheduledEmails = append(storage.scheduledEmails, &stored)
+
+	return nil
+}
+
+// ListDue returns up to limit emails due at now, the ones due first first
+func (storage *ScheduledEmailStore) ListDue(ctx context.Context, now time.Time, limit int) ([]*models.ScheduledEmail, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	due := []*models.ScheduledEmail{}
+	for _, email := range storage.scheduledEmails {
+		if email.SendAt.After(now) {
+			continue
+		}
+		copied := *email
+		due = append(due, &copied)
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].SendAt.Before(due[j].SendAt)
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Delete removes an email once it is queued
+func (storage *ScheduledEmailStore) Delete(ctx context.Context, id int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	storage.scheduledEmails = slices.DeleteFunc(storage.scheduledEmails, func(email *models.ScheduledEmail) bool {
+		return email.ID == id
+	})
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package mocks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/storage"
+)
+
+// FileURL is where the objects of FileStorage are served from
+const FileURL = "https://files.test"
+
+type object struct {
+	content  []byte
+	modified time.Time
+}
+
+// FileStorage is a storage.Client that keeps the objects in memory
+type FileStorage struct {
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+func NewFileStorage() *FileStorage {
+	return &FileStorage{objects: map[string]object{}}
+}
+
+func (client *FileStorage) UploadFile(ctx context.Context, key string, file io.Reader, contentType string, size int64) (*storage.UploadResult, error) {
+	if err := client.put(key, file); err != nil {
+		return nil, err
+	}
+
+	return &storage.UploadResult{Key: key, URL: client.GetFileURL(key)}, nil
+}
+
+func (client *FileStorage) UploadPrivateFile(ctx context.Context, key string, file io.Reader, contentType string, size int64) error {
+	return client.put(key, file)
+}
+
+func (client *FileStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	stored, ok := client.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("object %s does not exist", key)
+	}
+
+	return io.NopCloser(bytes.NewReader(stored.content)), nil
+}
+
+func (client *FileStorage) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	objects, err := client.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+
+	return keys, nil
+}
+
+func (client *FileStorage) ListObjects(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	objects := []storage.ObjectInfo{}
+	for key, stored := range client.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, storage.ObjectInfo{Key: key, Size: int64(len(stored.content)), LastModified: stored.modified})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	return objects, nil
+}
+
+// GeneratePresignedUploadURL returns a URL nothing listens on, the upload has to be
+// simulated with UploadFile
+func (client *FileStorage) GeneratePresignedUploadURL(ctx context.Context, key string, contentType string, size int64, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("%s/upload/%s?expires=%d", FileURL, key, int(expiry.Seconds())), nil
+}
+
+func (client *FileStorage) DeleteFile(ctx context.Context, key string) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	delete(client.objects, key)
+	return nil
+}
+
+func (client *FileStorage) DeleteFolder(ctx context.Context, prefix string) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	for key := range client.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(client.objects, key)
+		}
+	}
+	return nil
+}
+
+func (client *FileStorage) GetFileURL(key string) string {
+	return FileURL + "/" + key
+}
+
+func (client *FileStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// put stores the object, private ones are only told apart by the real buckets
+func (client *FileStorage) put(key string, file io.Reader) error {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.objects[key] = object{content: content, modified: time.Now()}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package mocks holds in-memory fakes of the stores, the cache, the mailer and the file
+// storage, so the handlers can run without MySQL, Redis, SMTP or a bucket. The fakes keep
+// the errors and rules of the real implementations where the handlers depend on them, but
+// not their SQL: there are no transactions to roll back and searches are plain substring
+// matches.
+package mocks
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+// Roles are the roles NewStorage starts with, the ones the roles migration creates
+var Roles = []models.Role{
+	{ID: 1, Name: "user", Level: 1, Description: "A User can only create posts"},
+	{ID: 2, Name: "moderator", Level: 2, Description: "A Moderator can update and not delete posts"},
+	{ID: 3, Name: "admin", Level: 3, Description: "An Admin can do anything"},
+}
+
+// data is the state every fake store of one NewStorage shares, like the tables of one database
+type data struct {
+	mu     sync.Mutex
+	nextID int64
+
+	roles           []*models.Role
+	users           map[int64]*userRow
+	posts           map[int64]*models.Post
+	followers       map[follow]time.Time
+	settings        map[int64]*models.UserSettings
+	invitations     map[int64]*models.Invitation
+	emailLogs       []*models.EmailLog
+	auditLogs       []*models.AuditLog
+	notifications   []*models.Notification
+	tickets         map[int64]*models.SupportTicket
+	files           map[string]*models.File
+	webhooks        map[int64]*models.Webhook
+	deliveries      []*delivery
+	campaigns       map[int64]*models.EmailCampaign
+	recipients      []*models.CampaignRecipient
+	mailTemplates   []*models.MailTemplate
+	cronRuns        map[cronRun]string
+	jobs            []*job
+	outbox          []*models.OutboxMessage
+	scheduledEmails []*models.ScheduledEmail
+	scheduledJobs   map[string]*models.ScheduledJob
+	devices         map[int64]*models.UserDevice
+}
+
+// NewStorage returns a store.Storage kept in memory, empty apart from Roles. Every call
+// starts from scratch, so each test gets a database of its own.
+func NewStorage() store.Storage {
+	state := &data{
+		users:         map[int64]*userRow{},
+		posts:         map[int64]*models.Post{},
+		followers:     map[follow]time.Time{},
+		settings:      map[int64]*models.UserSettings{},
+		invitations:   map[int64]*models.Invitation{},
+		tickets:       map[int64]*models.SupportTicket{},
+		files:         map[string]*models.File{},
+		webhooks:      map[int64]*models.Webhook{},
+		campaigns:     map[int64]*models.EmailCampaign{},
+		cronRuns:      map[cronRun]string{},
+		scheduledJobs: map[string]*models.ScheduledJob{},
+		devices:       map[int64]*models.UserDevice{},
+	}
+	for _, role := range Roles {
+		state.roles = append(state.roles, &role)
+		state.nextID = max(state.nextID, role.ID)
+	}
+
+	return store.Storage{
+		Users:           &UserStore{state},
+		Roles:           &RoleStore{state},
+		Posts:           &PostStore{state},
+		Followers:       &FollowerStore{state},
+		EmailLogs:       &EmailLogStore{state},
+		SupportTickets:  &SupportTicketStore{state},
+		Files:           &FileStore{state},
+		Webhooks:        &WebhookStore{state},
+		Notifications:   &NotificationStore{state},
+		AuditLogs:       &AuditLogStore{state},
+		EmailCampaigns:  &EmailCampaignStore{state},
+		Settings:        &SettingsStore{state},
+		Invitations:     &InvitationStore{state},
+		MailTemplates:   &MailTemplateStore{state},
+		CronRuns:        &CronRunStore{state},
+		Jobs:            &JobStore{state},
+		Outbox:          &OutboxStore{state},
+		ScheduledJobs:   &ScheduledJobStore{state},
+		ScheduledEmails: &ScheduledEmailStore{state},
+		Digests:         &DigestStore{state},
+		Devices:         &DeviceStore{state},
+	}
+}
+
+// id hands out the next id, shared by every table. The caller holds mu.
+func (state *data) id() int64 {
+	state.nextID++
+	return state.nextID
+}
+
+// privateProfile is the setting the store joins onto users, the caller holds mu
+func (state *data) privateProfile(userID int64) bool {
+	settings, ok := state.settings[userID]
+	return ok && settings.PrivateProfile
+}
+
+// timestamp is a created_at or updated_at the way the driver scans it into a string
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func now() string {
+	return timestamp(time.Now())
+}
+
+// page cuts the offset and limit of a query out of items
+func page[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// newestFirst orders items by id, descending unless sort is "asc" like sortDirection of the stores
+func newestFirst[T any](items []T, sortOrder string, id func(T) int64) {
+	ascending := strings.ToLower(sortOrder) == "asc"
+	sort.Slice(items, func(i, j int) bool {
+		if ascending {
+			return id(items[i]) < id(items[j])
+		}
+		return id(items[i]) > id(items[j])
+	})
+}
+
+// actor is the created_by or updated_by of a change made with ctx
+func actor(ctx context.Context) *int64 {
+	userID, ok := store.ActorFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return &userID
+}
+
+// contains is the LIKE '%search%' of the stores, which is case insensitive in MySQL
+func contains(value, search string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(search))
+}
@@ -0,0 +1,534 @@
+package mocks
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+	"godsendjoseph.dev/sandbox-api/internal/store"
+)
+
+// userRow is a user with the columns the model does not carry
+type userRow struct {
+	user models.User
+	// backupCodes maps the hash of every backup code to whether it was used
+	backupCodes map[string]bool
+	reminded    bool
+}
+
+// UserStore is the in-memory store.Storage Users. Passwords and OTPs are hashed the way
+// the real store hashes them, so the handlers compare them exactly as in production.
+type UserStore struct {
+	*data
+}
+
+func (storage *UserStore) CreateUserTx(ctx context.Context, user *models.User) error {
+	return storage.Create(ctx, nil, user)
+}
+
+// Create ignores tx, the fake has no transactions
+func (storage *UserStore) Create(ctx context.Context, tx *sql.Tx, user *models.User) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	user.NormalizedEmail = normalizeEmail(user.Email)
+	for _, row := range storage.users {
+		if row.user.NormalizedEmail == user.NormalizedEmail {
+			return store.ErrDuplicateEmail
+		}
+		if strings.EqualFold(row.user.Username, user.Username) {
+			return store.ErrDuplicateUsername
+		}
+	}
+
+	roleName := user.Role.Name
+	if roleName == "" {
+		roleName = "user"
+	}
+	role := storage.role(roleName)
+	if role == nil {
+		return store.ErrNotFound
+	}
+
+	if user.OtpCode != "" {
+		user.OtpCode = models.HashOTP(user.OtpCode)
+	}
+	user.ID = storage.id()
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+	user.CreatedBy, user.UpdatedBy = actor(ctx), actor(ctx)
+
+	row := &userRow{user: *user, backupCodes: map[string]bool{}}
+	row.user.RoleID = role.ID
+	storage.users[user.ID] = row
+
+	return nil
+}
+
+func (storage *UserStore) GetByID(ctx context.Context, id int64) (*models.User, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	row, ok := storage.users[id]
+	if !ok || !visible(ctx, row.user.DeletedAt) {
+		return nil, store.ErrNotFound
+	}
+
+	user := storage.withRole(row)
+	user.PrivateProfile = storage.privateProfile(id)
+	if !user.IsActive {
+		return nil, store.ErrAccountNotVerified
+	}
+
+	return user, nil
+}
+
+// GetByUsername returns the user with username, compared case-insensitively like the store
+func (storage *UserStore) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	for _, row := range storage.users {
+		if !strings.EqualFold(row.user.Username, username) || !visible(ctx, row.user.DeletedAt) {
+			continue
+		}
+
+		user := storage.withRole(row)
+		user.PrivateProfile = storage.privateProfile(user.ID)
+		if !user.IsActive {
+			return nil, store.ErrAccountNotVerified
+		}
+		return user, nil
+	}
+
+	return nil, store.ErrNotFound
+}
+
+// List returns a page of the users whose username or email contains query.Search
+func (storage *UserStore) List(ctx context.Context, query store.UserListQuery) ([]*models.User, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	users := []*models.User{}
+	for _, row := range storage.users {
+		if !visible(ctx, row.user.DeletedAt) || !row.user.IsActive {
+			continue
+		}
+		if query.Search != "" && !contains(row.user.Username, query.Search) && !(query.SearchEmail && contains(row.user.Email, query.Search)) {
+			continue
+		}
+		user := storage.withRole(row)
+		user.PrivateProfile = storage.privateProfile(user.ID)
+		users = append(users, user)
+	}
+	newestFirst(users, query.Sort, func(user *models.User) int64 { return user.ID })
+
+	return page(users, query.Offset, query.Limit), nil
+}
+
+// ListByRole returns the active users that have exactly the given role
+func (storage *UserStore) ListByRole(ctx context.Context, roleName string) ([]*models.User, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	users := []*models.User{}
+	for _, row := range storage.users {
+		user := storage.withRole(row)
+		if user.Role.Name == roleName && user.IsActive && user.DeletedAt == nil {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (storage *UserStore) GetByEmail(ctx context.Context, email string, isAuth bool) (*models.User, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	normalizedEmail := normalizeEmail(email)
+	for _, row := range storage.users {
+		if row.user.NormalizedEmail != normalizedEmail {
+			continue
+		}
+
+		user := storage.withRole(row)
+		user.PrivateProfile = storage.privateProfile(user.ID)
+		if !user.IsActive && isAuth {
+			return nil, store.ErrAccountNotVerified
+		}
+		return user, nil
+	}
+
+	return nil, store.ErrNotFound
+}
+
+func (storage *UserStore) UpdateUserProfile(ctx context.Context, user *models.User) error {
+	return storage.update(user.ID, func(row *userRow) error {
+		row.user.FirstName, row.user.LastName, row.user.Phone = user.FirstName, user.LastName, user.Phone
+		row.user.UpdatedBy = actor(ctx)
+		return nil
+	})
+}
+
+func (storage *UserStore) Delete(ctx context.Context, userID int64) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	if _, ok := storage.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+
+	delete(storage.users, userID)
+	delete(storage.settings, userID)
+	for id, post := range storage.posts {
+		if post.UserID == userID {
+			delete(storage.posts, id)
+		}
+	}
+	for follow := range storage.followers {
+		if follow.userID == userID || follow.followerID == userID {
+			delete(storage.followers, follow)
+		}
+	}
+	for id, device := range storage.devices {
+		if device.UserID == userID {
+			delete(storage.devices, id)
+		}
+	}
+
+	return nil
+}
+
+// SoftDelete hides the account until it is restored or purged after store.DeletedAccountGracePeriod
+func (storage *UserStore) SoftDelete(ctx context.Context, userID int64) error {
+	deletedAt := time.Now().UTC()
+	return storage.update(userID, func(row *userRow) error {
+		row.user.DeletedAt = &deletedAt
+		row.user.UpdatedBy = actor(ctx)
+		return nil
+	})
+}
+
+func (storage *UserStore) Restore(ctx context.Context, userID int64) error {
+	return storage.update(userID, func(row *userRow) error {
+		row.user.DeletedAt = nil
+		row.user.UpdatedBy = actor(ctx)
+		return nil
+	})
+}
+
+// ListDeletedBefore returns the ids of accounts soft deleted before cutoff
+func (storage *UserStore) ListDeletedBefore(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	return storage.ids(func(row *userRow) bool {
+		return row.user.DeletedAt != nil && row.user.DeletedAt.Before(cutoff)
+	}), nil
+}
+
+// ListUnremindedBefore returns up to limit unverified accounts created before cutoff that
+// have not been reminded to verify their email yet
+func (storage *UserStore) ListUnremindedBefore(ctx context.Context, cutoff time.Time, limit int) ([]*models.User, error) {
+	ids := storage.ids(func(row *userRow) bool {
+		return unverifiedBefore(row, cutoff) && !row.reminded
+	})
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	users := []*models.User{}
+	for _, id := range page(ids, 0, limit) {
+		user := storage.users[id].user
+		users = append(users, &models.User{ID: user.ID, Username: user.Username, Email: user.Email, CreatedAt: user.CreatedAt})
+	}
+
+	return users, nil
+}
+
+// ListUnverifiedBefore returns the ids of accounts created before cutoff that never verified their email
+func (storage *UserStore) ListUnverifiedBefore(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	return storage.ids(func(row *userRow) bool { return unverifiedBefore(row, cutoff) }), nil
+}
+
+// RemindVerification stores a fresh OTP for the reminder email and marks the account reminded
+func (storage *UserStore) RemindVerification(ctx context.Context, user *models.User, otpCode string, otpExp string) error {
+	return storage.update(user.ID, func(row *userRow) error {
+		setOTP(row, otpCode, otpExp)
+		row.reminded = true
+		return nil
+	})
+}
+
+// UpdateOTPCode stores the hash of a new code and resets the attempt counter
+func (storage *UserStore) UpdateOTPCode(ctx context.Context, user *models.User, otpCode string, otpExpiresAt string) error {
+	return storage.update(user.ID, func(row *userRow) error {
+		setOTP(row, otpCode, otpExpiresAt)
+		return nil
+	})
+}
+
+// RecordOTPFailure counts a wrong code and clears the pending one after models.MaxOTPAttempts
+func (storage *UserStore) RecordOTPFailure(ctx context.Context, userID int64) error {
+	return storage.update(userID, func(row *userRow) error {
+		row.user.OtpAttempts++
+		if row.user.OtpAttempts >= models.MaxOTPAttempts {
+			row.user.OtpCode = ""
+		}
+		return nil
+	})
+}
+
+// ClearExpiredOTPs blanks the OTP codes past their expiry and returns how many were cleared
+func (storage *UserStore) ClearExpiredOTPs(ctx context.Context) (int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	var cleared int64
+	for _, row := range storage.users {
+		if row.user.OtpCode == "" {
+			continue
+		}
+
+		// a code without a readable expiry can never be used, it goes too
+		expiresAt, err := time.Parse(time.RFC3339, row.user.OtpExp)
+		if err != nil || expiresAt.Before(time.Now()) {
+			row.user.OtpCode, row.user.OtpAttempts = "", 0
+			cleared++
+		}
+	}
+
+	return cleared, nil
+}
+
+// VerifyEmail activates the account and uses up otpCode, store.ErrInvalidOTP when it does not match
+func (storage *UserStore) VerifyEmail(ctx context.Context, userID int64, otpCode string) error {
+	return storage.update(userID, func(row *userRow) error {
+		if err := consumeOTP(row, otpCode); err != nil {
+			return err
+		}
+		row.user.IsActive = true
+		return nil
+	})
+}
+
+// ResetPassword stores the new password and password_changed_at and uses up otpCode, see VerifyEmail
+func (storage *UserStore) ResetPassword(ctx context.Context, user *models.User, otpCode string) error {
+	return storage.update(user.ID, func(row *userRow) error {
+		if err := consumeOTP(row, otpCode); err != nil {
+			return err
+		}
+		row.user.Password = user.Password
+		row.user.PasswordChangedAt = user.PasswordChangedAt
+		row.user.UpdatedBy = actor(ctx)
+		return nil
+	})
+}
+
+// ChangePassword stores the new hash and password_changed_at
+func (storage *UserStore) ChangePassword(ctx context.Context, user *models.User) error {
+	return storage.update(user.ID, func(row *userRow) error {
+		row.user.Password = user.Password
+		row.user.PasswordChangedAt = user.PasswordChangedAt
+		row.user.UpdatedBy = actor(ctx)
+		return nil
+	})
+}
+
+// UpdateAvatar points the user at a newly uploaded avatar
+func (storage *UserStore) UpdateAvatar(ctx context.Context, userID int64, key, url string) error {
+	return storage.update(userID, func(row *userRow) error {
+		row.user.AvatarKey, row.user.AvatarURL = key, url
+		row.user.UpdatedBy = actor(ctx)
+		return nil
+	})
+}
+
+// UpdateRole moves the user to roleID
+func (storage *UserStore) UpdateRole(ctx context.Context, userID, roleID int64) error {
+	return storage.update(userID, func(row *userRow) error {
+		row.user.RoleID = roleID
+		row.user.UpdatedBy = actor(ctx)
+		return nil
+	})
+}
+
+// SetTOTPSecret stores the secret of a pending enrollment, two-factor stays off until EnableTwoFactor
+func (storage *UserStore) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	return storage.update(userID, func(row *userRow) error {
+		row.user.TOTPSecret, row.user.TOTPEnabledAt = secret, nil
+		row.user.TwoFactorAttempts, row.user.TwoFactorLockedUntil = 0, nil
+		return nil
+	})
+}
+
+// EnableTwoFactor turns on two-factor and replaces the backup codes, store.ErrNotFound
+// without a pending secret
+func (storage *UserStore) EnableTwoFactor(ctx context.Context, userID int64, backupCodes []string) error {
+	return storage.update(userID, func(row *userRow) error {
+		if row.user.TOTPSecret == "" {
+			return store.ErrNotFound
+		}
+
+		enabledAt := time.Now().UTC()
+		row.user.TOTPEnabledAt = &enabledAt
+		row.backupCodes = map[string]bool{}
+		for _, code := range backupCodes {
+			row.backupCodes[models.HashBackupCode(code)] = false
+		}
+		return nil
+	})
+}
+
+// DisableTwoFactor removes the secret and every backup code
+func (storage *UserStore) DisableTwoFactor(ctx context.Context, userID int64) error {
+	return storage.update(userID, func(row *userRow) error {
+		row.user.TOTPSecret, row.user.TOTPEnabledAt = "", nil
+		row.backupCodes = map[string]bool{}
+		return nil
+	})
+}
+
+// UseBackupCode marks the unused backup code matching code as used, store.ErrNotFound when there is none
+func (storage *UserStore) UseBackupCode(ctx context.Context, userID int64, code string) error {
+	return storage.update(userID, func(row *userRow) error {
+		hash := models.HashBackupCode(code)
+		if used, ok := row.backupCodes[hash]; !ok || used {
+			return store.ErrNotFound
+		}
+		row.backupCodes[hash] = true
+		row.user.TwoFactorAttempts, row.user.TwoFactorLockedUntil = 0, nil
+		return nil
+	})
+}
+
+// UseTOTPStep records step as the last accepted TOTP code, store.ErrNotFound when it is not
+// newer than the last one
+func (storage *UserStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	return storage.update(userID, func(row *userRow) error {
+		if step <= row.user.TOTPLastStep {
+			return store.ErrNotFound
+		}
+		row.user.TOTPLastStep = step
+		row.user.TwoFactorAttempts, row.user.TwoFactorLockedUntil = 0, nil
+		return nil
+	})
+}
+
+// RecordTwoFactorFailure counts a wrong second factor and locks two-factor for
+// models.TwoFactorLockout after models.MaxTwoFactorAttempts in a row
+func (storage *UserStore) RecordTwoFactorFailure(ctx context.Context, userID int64) error {
+	return storage.update(userID, func(row *userRow) error {
+		row.user.TwoFactorAttempts++
+		if row.user.TwoFactorAttempts >= models.MaxTwoFactorAttempts {
+			lockedUntil := time.Now().UTC().Add(models.TwoFactorLockout)
+			row.user.TwoFactorAttempts, row.user.TwoFactorLockedUntil = 0, &lockedUntil
+		}
+		return nil
+	})
+}
+
+// ================== Private methods ======================//
+
+// update runs change on the row of userID. Like an UPDATE matching no row, an unknown
+// user is not an error.
+func (storage *UserStore) update(userID int64, change func(row *userRow) error) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	row, ok := storage.users[userID]
+	if !ok {
+		return nil
+	}
+
+	before := *row
+	if err := change(row); err != nil {
+		*row = before
+		return err
+	}
+	row.user.UpdatedAt = now()
+
+	return nil
+}
+
+// ids returns the ids of the users matching keep, oldest first
+func (storage *UserStore) ids(keep func(row *userRow) bool) []int64 {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	ids := []int64{}
+	for id, row := range storage.users {
+		if keep(row) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+// withRole copies the user with its role joined, the caller holds mu
+func (storage *UserStore) withRole(row *userRow) *models.User {
+	user := row.user
+	for _, role := range storage.roles {
+		if role.ID == user.RoleID {
+			user.Role = *role
+		}
+	}
+	return &user
+}
+
+// role is the role called name, the caller holds mu
+func (state *data) role(name string) *models.Role {
+	for _, role := range state.roles {
+		if role.Name == name {
+			return role
+		}
+	}
+	return nil
+}
+
+func setOTP(row *userRow, otpCode, otpExp string) {
+	row.user.OtpCode = models.HashOTP(otpCode)
+	row.user.OtpExp = otpExp
+	row.user.OtpAttempts = 0
+}
+
+// consumeOTP clears the code only if it still matches
+func consumeOTP(row *userRow, otpCode string) error {
+	if !row.user.CompareOTP(otpCode) {
+		return store.ErrInvalidOTP
+	}
+	row.user.OtpCode, row.user.OtpAttempts = "", 0
+	return nil
+}
+
+func unverifiedBefore(row *userRow, cutoff time.Time) bool {
+	createdAt, err := time.Parse(time.RFC3339Nano, row.user.CreatedAt)
+	return err == nil && !row.user.IsActive && row.user.DeletedAt == nil && createdAt.Before(cutoff)
+}
+
+// visible reports whether a row soft deleted at deletedAt is in the scope of ctx
+func visible(ctx context.Context, deletedAt *time.Time) bool {
+	switch store.DeletedFromContext(ctx) {
+	case store.DeletedInclude:
+		return true
+	case store.DeletedOnly:
+		return deletedAt != nil
+	default:
+		return deletedAt == nil
+	}
+}
+
+// normalizeEmail matches the store: the "+tag" is dropped and the address lower cased
+func normalizeEmail(email string) string {
+	username, domain, found := strings.Cut(email, "@")
+	if !found || strings.Contains(domain, "@") {
+		return email
+	}
+
+	username, _, _ = strings.Cut(username, "+")
+	return strings.ToLower(username + "@" + domain)
+}
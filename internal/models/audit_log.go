@@ -0,0 +1,49 @@
+package models
+
+import "encoding/json"
+
+// Audit actions, Metadata carries what each one needs to make sense on its own
+const (
+	// written in the transaction that creates the account, the trail starts with it
+	AuditRegister       = "auth.register"
+	AuditLogin          = "auth.login"
+	AuditLoginFailed    = "auth.login_failed"
+	AuditPasswordReset  = "auth.password_reset"
+	AuditPasswordChange = "user.password_changed"
+	AuditProfileUpdate  = "user.profile_updated"
+	AuditRoleChange     = "user.role_changed"
+
+	// the user said a sign-in from a new device was not them, the metadata names the device.
+	// The password was reset along with it.
+	AuditSignInReported = "auth.sign_in_reported"
+
+	// the metadata names the template and the version that is sent from now on
+	AuditMailTemplateChange = "admin.mail_template_changed"
+
+	// the metadata names the list and the network, and whether it was added or removed
+	AuditIPRuleChange = "admin.ip_rule_changed"
+
+	// the metadata says whether read-only mode was turned on or off
+	AuditReadOnlyChange = "admin.read_only_changed"
+
+	// an impersonated request names the admin as the actor and the impersonated user as the user
+	AuditImpersonationStart  = "admin.impersonation_started"
+	AuditImpersonatedRequest = "admin.impersonated_request"
+
+	// the metadata names the invited email and role, registering with it is an auth.register
+	// whose metadata names the invitation
+	AuditInvitationCreate = "admin.invitation_created"
+)
+
+// AuditLog is one security-relevant action. UserID is the account it concerns, ActorID the
+// signed-in user who did it, both nil when unknown (a failed login for an unknown email).
+type AuditLog struct {
+	ID        int64           `json:"id"`
+	UserID    *int64          `json:"user_id"`
+	ActorID   *int64          `json:"actor_id"`
+	Action    string          `json:"action"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt string          `json:"created_at"`
+}
@@ -0,0 +1,68 @@
+package models
+
+// Campaign audiences, AudienceRole needs the Role of the campaign
+const (
+	AudienceAll      = "all"
+	AudienceVerified = "verified"
+	AudienceRole     = "role"
+)
+
+// Campaign states. A campaign is sending until every recipient was queued or failed, or
+// an admin cancels it.
+const (
+	CampaignSending   = "sending"
+	CampaignCompleted = "completed"
+	CampaignCancelled = "cancelled"
+)
+
+// Recipient states, queued means the email was handed to the mail queue. The outcome of
+// the delivery itself is in the email logs. opted_out recipients turned campaigns off in
+// their settings.
+const (
+	RecipientPending   = "pending"
+	RecipientQueued    = "queued"
+	RecipientFailed    = "failed"
+	RecipientCancelled = "cancelled"
+	RecipientOptedOut  = "opted_out"
+)
+
+// EmailCampaign is one email sent to an audience of users. The recipients are picked
+// when the campaign is created, users who sign up later do not get it.
+type EmailCampaign struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Template    string `json:"template"`
+	Subject     string `json:"subject"`
+	Message     string `json:"message"`
+	Audience    string `json:"audience"`
+	Role        string `json:"role,omitempty"`
+	Status      string `json:"status"`
+	CreatedBy   *int64 `json:"created_by,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	CompletedAt string `json:"completed_at,omitempty"`
+
+	// Progress counts the recipients per recipient state
+	Progress CampaignProgress `json:"progress"`
+}
+
+type CampaignProgress struct {
+	Total     int64 `json:"total"`
+	Pending   int64 `json:"pending"`
+	Queued    int64 `json:"queued"`
+	Failed    int64 `json:"failed"`
+	Cancelled int64 `json:"cancelled"`
+	OptedOut  int64 `json:"opted_out"`
+}
+
+// CampaignRecipient is one user a campaign goes to, the address is copied so the
+// campaign can be reported on after the account is gone
+type CampaignRecipient struct {
+	ID         int64  `json:"id"`
+	CampaignID int64  `json:"campaign_id"`
+	UserID     *int64 `json:"user_id,omitempty"`
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Status     string `json:"status"`
+	LastError  string `json:"last_error,omitempty"`
+}
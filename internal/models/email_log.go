@@ -0,0 +1,13 @@
+package models
+
+type EmailLog struct {
+	ID               int64  `json:"id"`
+	Provider         string `json:"provider"`
+	Template         string `json:"template"`
+	Recipient        string `json:"recipient"`
+	Subject          string `json:"subject"`
+	Status           string `json:"status"`
+	Attempts         int    `json:"attempts"`
+	ProviderResponse string `json:"provider_response"`
+	CreatedAt        string `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// File states. Presigned uploads stay pending until the object shows up in the bucket,
+// everything the API stores itself is active right away.
+const (
+	FilePending = "pending"
+	FileActive  = "active"
+)
+
+// File is an object in storage, UserID is nil for files no account owns
+type File struct {
+	ID          int64  `json:"id"`
+	Key         string `json:"key"`
+	UserID      *int64 `json:"user_id,omitempty"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	// Checksum is the hex SHA-256 of the content, empty until the API has seen the bytes
+	Checksum  string `json:"checksum,omitempty"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
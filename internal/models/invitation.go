@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Invitation lets the person at Email register with Role. It works once, until ExpiresAt,
+// and only with the signed token that was emailed to them.
+type Invitation struct {
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	NormalizedEmail string     `json:"-"`
+	RoleID          int64      `json:"role_id"`
+	Role            Role       `json:"role"`
+	InvitedBy       *int64     `json:"invited_by,omitempty"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	AcceptedAt      *time.Time `json:"accepted_at,omitempty"`
+	AcceptedBy      *int64     `json:"accepted_by,omitempty"`
+	CreatedAt       string     `json:"created_at"`
+}
+
+// Expired reports whether the invitation can no longer be accepted at now
+func (invitation *Invitation) Expired(now time.Time) bool {
+	return !now.Before(invitation.ExpiresAt)
+}
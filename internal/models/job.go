@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job states in the jobs table. Running marks the jobs an instance holds the lease of,
+// a job that succeeds is deleted.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobFailed  = "failed"
+)
+
+// Job is a background job kept in the database for the jobs.DBQueue
+type Job struct {
+	ID          int64           `json:"id"`
+	JobID       string          `json:"job_id"`
+	Name        string          `json:"name"`
+	Priority    int             `json:"priority"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	// RunAt is when the job is due, or when the lease of a running job ends
+	RunAt     time.Time `json:"run_at"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt string    `json:"created_at"`
+}
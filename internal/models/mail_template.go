@@ -0,0 +1,13 @@
+package models
+
+// MailTemplate is one saved version of an email template edited through the admin API.
+// At most one version of a name is active, without one the embedded template is sent.
+type MailTemplate struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Version   int    `json:"version"`
+	Content   string `json:"content"`
+	Active    bool   `json:"active"`
+	CreatedBy *int64 `json:"created_by,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
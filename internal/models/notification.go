@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification types, Data carries the details each one needs to render
+const (
+	NotificationNewFollower    = "follower.new"
+	NotificationTicketAnswered = "support.ticket_answered"
+)
+
+// Notification is shown to a user in the app. ActorID is the user who caused it, nil for
+// the system or once that account is deleted.
+type Notification struct {
+	ID        int64           `json:"id"`
+	UserID    int64           `json:"user_id"`
+	ActorID   *int64          `json:"actor_id,omitempty"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt string          `json:"created_at"`
+}
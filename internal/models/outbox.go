@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Outbox message states, a message that was handled is deleted
+const (
+	OutboxPending = "pending"
+	OutboxSending = "sending"
+	OutboxFailed  = "failed"
+)
+
+// OutboxMessage is a side effect written in the transaction of the change that causes it
+type OutboxMessage struct {
+	ID       int64           `json:"id"`
+	Kind     string          `json:"kind"`
+	Payload  json.RawMessage `json:"payload"`
+	Status   string          `json:"status"`
+	Attempts int             `json:"attempts"`
+	// AvailableAt is when the message is due, or when the lease of one being sent ends
+	AvailableAt time.Time `json:"available_at"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   string    `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"godsendjoseph.dev/sandbox-api/internal/utils"
+)
+
+type Post struct {
+	ID        int64             `json:"id"`
+	Title     string            `json:"title"`
+	Content   string            `json:"content"`
+	UserID    int64             `json:"user_id"`
+	Tags      utils.StringSlice `json:"tags"`
+	CreatedAt string            `json:"created_at"`
+	UpdatedAt string            `json:"updated_at"`
+	User      *User             `json:"user,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ScheduledEmail waits in the scheduled_emails table until SendAt, then the
+// dispatch-scheduled-emails job queues it and deletes the row
+type ScheduledEmail struct {
+	ID        int64           `json:"id"`
+	Template  string          `json:"template"`
+	Username  string          `json:"username"`
+	Email     string          `json:"email"`
+	Subject   string          `json:"subject"`
+	Data      json.RawMessage `json:"data"`
+	IsSandbox bool            `json:"is_sandbox"`
+	SendAt    time.Time       `json:"send_at"`
+	CreatedAt string          `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "encoding/json"
+
+// ScheduledJob overrides the schedule of a cron job registered in code
+type ScheduledJob struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	CronExpr string `json:"cron_expr"`
+	Enabled  bool   `json:"enabled"`
+	// Payload holds job specific options, it is stored as given
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt string          `json:"created_at"`
+	UpdatedAt string          `json:"updated_at"`
+}
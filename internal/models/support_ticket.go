@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Support ticket states, a ticket is answered once an admin responded and closed when nothing is left to do
+const (
+	TicketOpen     = "open"
+	TicketAnswered = "answered"
+	TicketClosed   = "closed"
+)
+
+// SupportTicket is a contact request, UserID is nil for anonymous ones
+type SupportTicket struct {
+	ID          int64      `json:"id"`
+	UserID      *int64     `json:"user_id,omitempty"`
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	Subject     string     `json:"subject"`
+	Message     string     `json:"message"`
+	Status      string     `json:"status"`
+	Response    string     `json:"response,omitempty"`
+	RespondedBy *int64     `json:"responded_by,omitempty"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	CreatedAt   string     `json:"created_at"`
+	UpdatedAt   string     `json:"updated_at"`
+}
@@ -1,24 +1,110 @@
 package models
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID              int64        `json:"id"`
-	FirstName       string       `json:"first_name"`
-	LastName        string       `json:"last_name"`
-	Username        string       `json:"username"`
-	Email           string       `json:"email"`
-	NormalizedEmail string       `json:"normalized_email"`
-	OtpCode         string       `json:"otp_code"`
-	OtpExp          string       `json:"otp_expires_at"`
-	Password        PasswordHash `json:"-"`
-	CreatedAt       string       `json:"created_at"`
-	UpdatedAt       string       `json:"updated_at"`
-	IsActive        bool         `json:"is_active"`
-	RoleID          int64        `json:"role_id"`
-	Role            Role         `json:"role"`
+	ID              int64  `json:"id"`
+	FirstName       string `json:"first_name"`
+	LastName        string `json:"last_name"`
+	Username        string `json:"username"`
+	Email           string `json:"email"`
+	NormalizedEmail string `json:"normalized_email"`
+	// Phone is optional, in E.164 format
+	Phone          string       `json:"phone,omitempty"`
+	OtpCode        string       `json:"-"`
+	OtpExp         string       `json:"-"`
+	OtpAttempts    int          `json:"-"`
+	Password       PasswordHash `json:"-"`
+	CreatedAt      string       `json:"created_at"`
+	UpdatedAt      string       `json:"updated_at"`
+	IsActive       bool         `json:"is_active"`
+	RoleID         int64        `json:"role_id"`
+	Role           Role         `json:"role"`
+	FollowersCount int64        `json:"followers_count"`
+	FollowingCount int64        `json:"following_count"`
+	// PasswordChangedAt revokes every token issued before it
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	// DeletedAt is set while the account waits out its deletion grace period
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// CreatedBy and UpdatedBy are the users behind the last changes, nil when no one was signed in
+	CreatedBy *int64 `json:"created_by,omitempty"`
+	UpdatedBy *int64 `json:"updated_by,omitempty"`
+	// TOTPSecret is set from enrollment on, TOTPEnabledAt once the first code was confirmed
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"two_factor_enabled_at,omitempty"`
+	// TOTPLastStep is the time step of the last accepted code, older and equal ones are refused
+	TOTPLastStep int64 `json:"-"`
+	// TwoFactorAttempts counts wrong second factors in a row, TwoFactorLockedUntil is set once
+	// there were MaxTwoFactorAttempts of them
+	TwoFactorAttempts    int        `json:"-"`
+	TwoFactorLockedUntil *time.Time `json:"-"`
+	// AvatarKey is the storage key of the uploaded avatar, AvatarURL where it is served from
+	AvatarKey string `json:"avatar_key,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	// PrivateProfile mirrors the user's setting, it is loaded with the user for serialization
+	PrivateProfile bool `json:"private_profile"`
+}
+
+// TwoFactorEnabled reports whether logging in needs a TOTP or backup code
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// TwoFactorLocked reports whether second factors are refused at now after too many wrong ones
+func (u *User) TwoFactorLocked(now time.Time) bool {
+	return u.TwoFactorLockedUntil != nil && now.Before(*u.TwoFactorLockedUntil)
+}
+
+// MaxOTPAttempts is how many wrong codes a pending OTP survives
+const MaxOTPAttempts = 5
+
+// MaxTwoFactorAttempts wrong TOTP or backup codes in a row lock two-factor for
+// TwoFactorLockout, even the right code is refused until then
+const (
+	MaxTwoFactorAttempts = 5
+	TwoFactorLockout     = 15 * time.Minute
+)
+
+// GenerateOTP returns a random six digit code, with leading zeros
+func GenerateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// HashOTP is what gets stored in otp_code. Six digits are cheap to brute force offline
+// either way, the expiry and MaxOTPAttempts are what actually protect the code.
+func HashOTP(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// CompareOTP reports whether code matches the pending OTP
+func (u *User) CompareOTP(code string) bool {
+	if u.OtpCode == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(u.OtpCode), []byte(HashOTP(code))) == 1
+}
+
+// HashBackupCode hashes a two-factor backup code, ignoring case, spaces and dashes
+// so the code can be typed the way it was displayed or not
+func HashBackupCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return HashOTP(normalized)
 }
 
 type PasswordHash struct {
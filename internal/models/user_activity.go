@@ -0,0 +1,18 @@
+package models
+
+// UserActivity is what happened around a user over the period of a digest
+type UserActivity struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	// NewFollowers and NewPosts count the period, Followers and Posts the whole account
+	NewFollowers int64 `json:"new_followers"`
+	Followers    int64 `json:"followers"`
+	NewPosts     int64 `json:"new_posts"`
+	Posts        int64 `json:"posts"`
+}
+
+// Quiet reports whether nothing happened in the period, a digest would be empty
+func (activity *UserActivity) Quiet() bool {
+	return activity.NewFollowers == 0 && activity.NewPosts == 0
+}
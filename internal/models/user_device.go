@@ -0,0 +1,25 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// UserDevice is an IP and user agent pair a user signed in from. A pair not seen before is
+// a new device, the user is told about it and can report it with ReportedAt.
+type UserDevice struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	IP          string     `json:"ip"`
+	UserAgent   string     `json:"user_agent"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ReportedAt  *time.Time `json:"reported_at,omitempty"`
+}
+
+// Fingerprint identifies the device among the ones of its user
+func (device *UserDevice) Fingerprint() string {
+	sum := sha256.Sum256([]byte(device.IP + "\n" + device.UserAgent))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,35 @@
+package models
+
+import "godsendjoseph.dev/sandbox-api/internal/utils"
+
+// Themes a client can be asked to render in, system follows the device
+const (
+	ThemeSystem = "system"
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+)
+
+// UserSettings are the preferences of a user. Users who never saved any get
+// DefaultUserSettings, there is no row for them.
+type UserSettings struct {
+	UserID   int64  `json:"user_id"`
+	Timezone string `json:"timezone"`
+	// Locale is empty to follow Accept-Language
+	Locale string `json:"locale"`
+	Theme  string `json:"theme"`
+	// EmailOptOuts are the mailer.OptOutCategories the user does not want emails of
+	EmailOptOuts utils.StringSlice `json:"email_opt_outs"`
+	// PrivateProfile limits what other users see of the profile to the username and avatar
+	PrivateProfile bool   `json:"private_profile"`
+	UpdatedAt      string `json:"updated_at,omitempty"`
+}
+
+// DefaultUserSettings are the settings of a user who never changed them
+func DefaultUserSettings(userID int64) *UserSettings {
+	return &UserSettings{
+		UserID:       userID,
+		Timezone:     "UTC",
+		Theme:        ThemeSystem,
+		EmailOptOuts: utils.StringSlice{},
+	}
+}
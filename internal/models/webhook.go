@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/utils"
+)
+
+// Delivery states. A delivery is retried while pending, sending marks the one an
+// instance is posting right now.
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a partner endpoint subscribed to some events
+type Webhook struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the deliveries, it is only shown when the webhook is created
+	Secret      string            `json:"-"`
+	Events      utils.StringSlice `json:"events"`
+	Description string            `json:"description"`
+	Enabled     bool              `json:"enabled"`
+	CreatedBy   *int64            `json:"created_by,omitempty"`
+	CreatedAt   string            `json:"created_at"`
+	UpdatedAt   string            `json:"updated_at"`
+}
+
+// WebhookDelivery is one event on its way to one webhook
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+
+	// URL and Secret come from the webhook when a delivery is claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
@@ -0,0 +1,87 @@
+package notification
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Discord rejects embeds over these limits
+const (
+	discordTitleLimit  = 256
+	discordTextLimit   = 4096
+	discordFieldLimit  = 1024
+	discordFieldsLimit = 25
+)
+
+// DiscordNotifier posts embeds to a Discord channel webhook
+type DiscordNotifier struct {
+	webhookURL  string
+	username    string
+	minSeverity Severity
+}
+
+func NewDiscordNotifier(webhookURL, username string, minSeverity Severity) *DiscordNotifier {
+	return &DiscordNotifier{webhookURL: webhookURL, username: username, minSeverity: minSeverity}
+}
+
+func (d *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func (d *DiscordNotifier) Notify(msg Message) error {
+	if msg.Severity < d.minSeverity {
+		return nil
+	}
+
+	type field struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Inline bool   `json:"inline"`
+	}
+
+	fields := []field{}
+	for _, name := range sortedKeys(msg.Fields) {
+		if len(fields) == discordFieldsLimit {
+			break
+		}
+		value := msg.Fields[name]
+		fields = append(fields, field{
+			Name:   truncate(name, discordTitleLimit),
+			Value:  truncate(value, discordFieldLimit),
+			Inline: len(value) < 20,
+		})
+	}
+
+	color, _ := strconv.ParseInt(hexColor(msg.Color), 16, 32)
+
+	return postJSON(d.webhookURL, map[string]any{
+		"username": d.username,
+		"embeds": []map[string]any{{
+			"title":       truncate(msg.Title, discordTitleLimit),
+			"description": truncate(msg.Text, discordTextLimit),
+			"color":       color,
+			"fields":      fields,
+		}},
+	}, nil)
+}
+
+// Ping reads the webhook, Discord answers 200 for a live one and 401 or 404 for a deleted one
+func (d *DiscordNotifier) Ping() error {
+	if err := checkWebhookURL(d.webhookURL); err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Get(d.webhookURL)
+	if err != nil {
+		return fmt.Errorf("failed to reach webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook was rejected (status: %d)", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,357 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// notifyTimeout bounds one post to a service
+const notifyTimeout = 10 * time.Second
+
+// Message is one notification, each Notifier renders it in the format of its service
+type Message struct {
+	Category Category
+	Severity Severity
+	Title    string
+	Text     string
+	// Color is "good", "warning", "danger" or a hex code such as #3AA3E3
+	Color  string
+	Fields map[string]string
+}
+
+// Notifier delivers messages to one chat or alerting service
+type Notifier interface {
+	Name() string
+	Notify(msg Message) error
+	// Ping checks the configuration without posting a message where the service allows it
+	Ping() error
+}
+
+// Fanout sends every message to all of its notifiers at once. It carries the helpers the
+// API calls, so adding a service never touches the call sites.
+type Fanout struct {
+	notifiers []Notifier
+	// enrich adds what is known about the client to the fields of HTTP error notifications
+	enrich func(request *http.Request, fields map[string]string)
+}
+
+func NewFanout(notifiers ...Notifier) *Fanout {
+	return &Fanout{notifiers: notifiers}
+}
+
+// EnrichWith has fn add fields about the client, such as where it is, to every HTTP error
+// notification. Call it before the first notification is sent.
+func (f *Fanout) EnrichWith(fn func(request *http.Request, fields map[string]string)) {
+	f.enrich = fn
+}
+
+// Notifiers returns the services messages are sent to
+func (f *Fanout) Notifiers() []Notifier {
+	return f.notifiers
+}
+
+// Notify sends msg to every notifier, one failing does not stop the others
+func (f *Fanout) Notify(msg Message) error {
+	errs := make([]error, len(f.notifiers))
+
+	var wg sync.WaitGroup
+	for i, notifier := range f.notifiers {
+		wg.Add(1)
+		go func(i int, notifier Notifier) {
+			defer wg.Done()
+			if err := notifier.Notify(msg); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", notifier.Name(), err)
+			}
+		}(i, notifier)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// SendNotification sends a plain text message
+func (f *Fanout) SendNotification(message string) error {
+	return f.Notify(Message{Category: CategoryGeneral, Severity: SeverityInfo, Text: message})
+}
+
+// SendRichNotification sends a message with fields to the general category
+func (f *Fanout) SendRichNotification(title, message, color string, fields map[string]string) error {
+	return f.SendCategoryNotification(CategoryGeneral, SeverityInfo, title, message, color, fields)
+}
+
+// SendCategoryNotification sends a message with fields, Slack routes it by category
+func (f *Fanout) SendCategoryNotification(category Category, severity Severity, title, message, color string, fields map[string]string) error {
+	return f.Notify(Message{
+		Category: category,
+		Severity: severity,
+		Title:    title,
+		Text:     message,
+		Color:    color,
+		Fields:   fields,
+	})
+}
+
+// NotifyHTTPError sends an error notification for HTTP errors
+func (f *Fanout) NotifyHTTPError(statusCode int, title string, err error, request *http.Request, context map[string]string) error {
+	if err == nil {
+		return nil
+	}
+
+	// Add error and request details to context
+	if context == nil {
+		context = make(map[string]string)
+	}
+
+	// Add error information
+	context["Error"] = fmt.Sprintf("`%v`", err)
+
+	// Add request details if available
+	if request != nil {
+		context["Method"] = request.Method
+		context["Path"] = request.URL.Path
+		context["User-Agent"] = request.UserAgent()
+		context["Remote IP"] = request.RemoteAddr
+
+		if ref := SupportRefFromContext(request.Context()); ref != "" {
+			context["Support Ref"] = ref
+		}
+		if id := RequestIDFromContext(request.Context()); id != "" {
+			context["Request ID"] = id
+		}
+		if f.enrich != nil {
+			f.enrich(request, context)
+		}
+	}
+
+	// Set color based on status code
+	var color string
+	var emoji string
+
+	switch {
+	case statusCode >= 500:
+		color = "danger" // Red
+		emoji = "🚨"      // Red alert
+	case statusCode >= 400:
+		color = "warning" // Yellow
+		emoji = "⚠️"      // Warning
+	default:
+		color = "#3AA3E3" // Blue
+		emoji = "ℹ️"      // Info
+	}
+
+	return f.SendCategoryNotification(
+		categoryForRequest(statusCode, request),
+		severityForStatus(statusCode),
+		fmt.Sprintf("%s %s (HTTP %d)", emoji, title, statusCode),
+		"",
+		color,
+		context,
+	)
+}
+
+// NotifyServerError for 500-level errors
+func (f *Fanout) NotifyServerError(err error, request *http.Request) error {
+	return f.NotifyHTTPError(
+		http.StatusInternalServerError,
+		"Internal Server Error",
+		err,
+		request,
+		nil,
+	)
+}
+
+// NotifyBadRequest for 400 errors
+func (f *Fanout) NotifyBadRequest(err error, request *http.Request) error {
+	return f.NotifyHTTPError(
+		http.StatusBadRequest,
+		"Bad Request",
+		err,
+		request,
+		nil,
+	)
+}
+
+// NotifyNotFound for 404 errors
+func (f *Fanout) NotifyNotFound(err error, request *http.Request) error {
+	return f.NotifyHTTPError(
+		http.StatusNotFound,
+		"Not Found",
+		err,
+		request,
+		nil,
+	)
+}
+
+// NotifyConflict for 409 errors
+func (f *Fanout) NotifyConflict(err error, request *http.Request) error {
+	return f.NotifyHTTPError(
+		http.StatusConflict,
+		"Resource Conflict",
+		err,
+		request,
+		nil,
+	)
+}
+
+// NotifyForbidden for 403 errors
+func (f *Fanout) NotifyForbidden(request *http.Request) error {
+	dummyErr := fmt.Errorf("access forbidden")
+	return f.NotifyHTTPError(
+		http.StatusForbidden,
+		"Forbidden",
+		dummyErr,
+		request,
+		nil,
+	)
+}
+
+// NotifyUnauthorized for 401 errors
+func (f *Fanout) NotifyUnauthorized(err error, request *http.Request) error {
+	return f.NotifyHTTPError(
+		http.StatusUnauthorized,
+		"Unauthorized",
+		err,
+		request,
+		nil,
+	)
+}
+
+// NotifyRateLimitExceeded for 429 errors
+func (f *Fanout) NotifyRateLimitExceeded(request *http.Request, retryAfter string) error {
+	context := map[string]string{
+		"Retry-After": retryAfter,
+	}
+
+	rateLimitErr := fmt.Errorf("rate limit exceeded")
+	return f.NotifyHTTPError(
+		http.StatusTooManyRequests,
+		"Rate Limit Exceeded",
+		rateLimitErr,
+		request,
+		context,
+	)
+}
+
+// NotifySuccess for successful operations worth logging
+func (f *Fanout) NotifySuccess(title string, message string, context map[string]string) error {
+	return f.SendRichNotification(
+		fmt.Sprintf("✅ %s", title),
+		message,
+		"good",
+		context,
+	)
+}
+
+// NotifyWarning for important warnings not tied to HTTP errors
+func (f *Fanout) NotifyWarning(title string, message string, context map[string]string) error {
+	return f.SendCategoryNotification(
+		CategoryGeneral,
+		SeverityWarning,
+		fmt.Sprintf("⚠️ %s", title),
+		message,
+		"warning",
+		context,
+	)
+}
+
+// NotifyInfo for general informational messages
+func (f *Fanout) NotifyInfo(title string, message string, context map[string]string) error {
+	return f.SendRichNotification(
+		fmt.Sprintf("ℹ️ %s", title),
+		message,
+		"#3AA3E3", // Blue
+		context,
+	)
+}
+
+// sortedKeys orders the fields, maps iterate in a different order every time
+func sortedKeys(fields map[string]string) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hexColor turns a Message color into a hex code without the #
+func hexColor(color string) string {
+	switch color {
+	case "good":
+		return "2EB67D"
+	case "warning":
+		return "ECB22E"
+	case "danger":
+		return "E01E5A"
+	case "":
+		return "3AA3E3"
+	}
+
+	if len(color) == 7 && color[0] == '#' {
+		return color[1:]
+	}
+	return "3AA3E3"
+}
+
+// truncate cuts text to limit runes, the services reject longer values
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// postJSON posts body and fails on any status outside 2xx. headers may be nil.
+func postJSON(webhookURL string, body any, headers map[string]string) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	return postBody(webhookURL, data, headers)
+}
+
+// postBody posts data as JSON and fails on any status outside 2xx
+func postBody(webhookURL string, data []byte, headers map[string]string) error {
+	request, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to reach webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered %d: %s", resp.StatusCode, bytes.TrimSpace(text))
+	}
+
+	return nil
+}
+
+// checkWebhookURL is the Ping of services that have no way to check a webhook without
+// posting to it. The URL is left out of the error, it is a credential.
+func checkWebhookURL(webhookURL string) error {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return fmt.Errorf("webhook URL is not a valid http(s) URL")
+	}
+	return nil
+}
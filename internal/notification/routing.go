@@ -0,0 +1,134 @@
+package notification
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Category groups notifications by the team that should see them
+type Category string
+
+const (
+	CategoryGeneral        Category = "general"
+	CategoryAuth           Category = "auth"
+	CategoryPayments       Category = "payments"
+	CategoryInfrastructure Category = "infrastructure"
+	CategorySupport        Category = "support"
+)
+
+// Severity orders notifications so a route can ignore the noisy ones
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = map[string]Severity{
+	"info":    SeverityInfo,
+	"warning": SeverityWarning,
+	"error":   SeverityError,
+}
+
+// ParseSeverity reads info, warning or error
+func ParseSeverity(name string) (Severity, error) {
+	severity, ok := severityNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return SeverityInfo, fmt.Errorf("unknown severity %q, use info, warning or error", name)
+	}
+	return severity, nil
+}
+
+func (severity Severity) String() string {
+	for name, value := range severityNames {
+		if value == severity {
+			return name
+		}
+	}
+	return "info"
+}
+
+// Route sends a category to one channel. An empty WebhookURL uses the notifier's default webhook.
+type Route struct {
+	Channel     string
+	WebhookURL  string
+	MinSeverity Severity
+}
+
+// Routes maps a category to every channel that should receive it
+type Routes map[Category][]Route
+
+// ParseRoutes reads routes from a spec such as
+//
+//	auth:#security:warning;infrastructure:#ops:error:https://hooks.slack.com/services/...
+//
+// Each rule is category:channel:severity with an optional webhook URL at the end.
+// A category may appear more than once to send it to several channels.
+func ParseRoutes(spec string) (Routes, error) {
+	routes := Routes{}
+
+	for _, rule := range strings.Split(spec, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		parts := strings.SplitN(rule, ":", 4)
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("invalid slack route %q: expected category:channel:severity[:webhook]", rule)
+		}
+
+		category := Category(strings.ToLower(parts[0]))
+		switch category {
+		case CategoryGeneral, CategoryAuth, CategoryPayments, CategoryInfrastructure, CategorySupport:
+		default:
+			return nil, fmt.Errorf("invalid slack route %q: unknown category %q", rule, parts[0])
+		}
+
+		severity, ok := severityNames[strings.ToLower(parts[2])]
+		if !ok {
+			return nil, fmt.Errorf("invalid slack route %q: unknown severity %q", rule, parts[2])
+		}
+
+		route := Route{
+			Channel:     parts[1],
+			MinSeverity: severity,
+		}
+		if len(parts) == 4 {
+			route.WebhookURL = parts[3]
+		}
+
+		routes[category] = append(routes[category], route)
+	}
+
+	return routes, nil
+}
+
+// categoryForRequest decides which team an HTTP error belongs to
+func categoryForRequest(statusCode int, request *http.Request) Category {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return CategoryAuth
+	case request != nil && strings.HasPrefix(request.URL.Path, "/v1/auth"):
+		return CategoryAuth
+	case request != nil && strings.HasPrefix(request.URL.Path, "/v1/payments"):
+		return CategoryPayments
+	case statusCode >= 500:
+		return CategoryInfrastructure
+	default:
+		return CategoryGeneral
+	}
+}
+
+func severityForStatus(statusCode int) Severity {
+	switch {
+	case statusCode >= 500:
+		return SeverityError
+	case statusCode >= 400:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
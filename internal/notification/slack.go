@@ -1,8 +1,11 @@
 package notification
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/slack-go/slack"
 )
@@ -14,6 +17,7 @@ type SlackNotifier struct {
 	username   string
 	iconEmoji  string
 	enabled    bool
+	routes     Routes
 }
 
 // NewSlackNotifier creates a new instance of SlackNotifier
@@ -27,31 +31,81 @@ func NewSlackNotifier(webhookURL, channel, username, iconEmoji string, enabled b
 	}
 }
 
-// SendNotification sends a simple text message to Slack
-func (s *SlackNotifier) SendNotification(message string) error {
-	if !s.enabled {
-		return nil // Silently return if notifications are disabled
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// SetRoutes sends categories to their own channels. Categories without a route
+// keep going to the default channel.
+func (s *SlackNotifier) SetRoutes(routes Routes) {
+	s.routes = routes
+}
+
+// Ping checks that the default webhook and every routed webhook exist without posting a message.
+// Slack answers an empty payload with 400 for a live webhook and 403/404 for a revoked one.
+func (s *SlackNotifier) Ping() error {
+	if s.webhookURL == "" {
+		return fmt.Errorf("webhook URL is not set")
 	}
 
-	msg := &slack.WebhookMessage{
-		Text:      message,
-		Channel:   s.channel,
-		Username:  s.username,
-		IconEmoji: s.iconEmoji,
+	checked := map[string]bool{}
+	for _, webhookURL := range append([]string{s.webhookURL}, s.routedWebhooks()...) {
+		if checked[webhookURL] {
+			continue
+		}
+		checked[webhookURL] = true
+
+		if err := pingWebhook(webhookURL); err != nil {
+			return err
+		}
 	}
 
-	return slack.PostWebhook(s.webhookURL, msg)
+	return nil
 }
 
-// SendRichNotification sends a message with attachments to Slack
-func (s *SlackNotifier) SendRichNotification(title, message, color string, fields map[string]string) error {
+func (s *SlackNotifier) routedWebhooks() []string {
+	webhooks := []string{}
+	for _, routes := range s.routes {
+		for _, route := range routes {
+			if route.WebhookURL != "" {
+				webhooks = append(webhooks, route.WebhookURL)
+			}
+		}
+	}
+	return webhooks
+}
+
+func pingWebhook(webhookURL string) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewBufferString("{}"))
+	if err != nil {
+		return fmt.Errorf("failed to reach webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("webhook was rejected (status: %d)", resp.StatusCode)
+	}
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("webhook is unavailable (status: %d)", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Notify sends msg with attachments to every route of its category whose threshold the
+// severity meets, or to the default channel if the category has no routes
+func (s *SlackNotifier) Notify(msg Message) error {
 	if !s.enabled {
 		return nil
 	}
 
 	// Create attachment fields
 	attachmentFields := []slack.AttachmentField{}
-	for k, v := range fields {
+	for _, k := range sortedKeys(msg.Fields) {
+		v := msg.Fields[k]
 		attachmentFields = append(attachmentFields, slack.AttachmentField{
 			Title: k,
 			Value: v,
@@ -60,178 +114,40 @@ func (s *SlackNotifier) SendRichNotification(title, message, color string, field
 	}
 
 	attachment := slack.Attachment{
-		Title:      title,
-		Text:       message,
-		Color:      color, // Can be "good" (green), "warning" (yellow), "danger" (red), or any hex color code
+		Title:      msg.Title,
+		Text:       msg.Text,
+		Color:      msg.Color, // Can be "good" (green), "warning" (yellow), "danger" (red), or any hex color code
 		Fields:     attachmentFields,
 		MarkdownIn: []string{"text", "fields"},
 	}
 
-	msg := &slack.WebhookMessage{
-		Attachments: []slack.Attachment{attachment},
-		Channel:     s.channel,
-		Username:    s.username,
-		IconEmoji:   s.iconEmoji,
-	}
-
-	return slack.PostWebhook(s.webhookURL, msg)
-}
-
-// NotifyHTTPError sends an error notification for HTTP errors
-func (s *SlackNotifier) NotifyHTTPError(statusCode int, title string, err error, request *http.Request, context map[string]string) error {
-	if !s.enabled || err == nil {
-		return nil
+	routes, ok := s.routes[msg.Category]
+	if !ok {
+		routes = []Route{{Channel: s.channel, WebhookURL: s.webhookURL}}
 	}
 
-	// Add error and request details to context
-	if context == nil {
-		context = make(map[string]string)
-	}
-
-	// Add error information
-	context["Error"] = fmt.Sprintf("`%v`", err)
-
-	// Add request details if available
-	if request != nil {
-		context["Method"] = request.Method
-		context["Path"] = request.URL.Path
-		context["User-Agent"] = request.UserAgent()
-		context["Remote IP"] = request.RemoteAddr
+	var errs []error
+	for _, route := range routes {
+		if msg.Severity < route.MinSeverity {
+			continue
+		}
+
+		webhookURL := route.WebhookURL
+		if webhookURL == "" {
+			webhookURL = s.webhookURL
+		}
+
+		webhookMsg := &slack.WebhookMessage{
+			Attachments: []slack.Attachment{attachment},
+			Channel:     route.Channel,
+			Username:    s.username,
+			IconEmoji:   s.iconEmoji,
+		}
+
+		if err := slack.PostWebhook(webhookURL, webhookMsg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify %s: %w", route.Channel, err))
+		}
 	}
 
-	// Set color based on status code
-	var color string
-	var emoji string
-
-	switch {
-	case statusCode >= 500:
-		color = "danger" // Red
-		emoji = "🚨"      // Red alert
-	case statusCode >= 400:
-		color = "warning" // Yellow
-		emoji = "⚠️"      // Warning
-	default:
-		color = "#3AA3E3" // Blue
-		emoji = "ℹ️"      // Info
-	}
-
-	return s.SendRichNotification(
-		fmt.Sprintf("%s %s (HTTP %d)", emoji, title, statusCode),
-		"",
-		color,
-		context,
-	)
-}
-
-// NotifyServerError for 500-level errors
-func (s *SlackNotifier) NotifyServerError(err error, request *http.Request) error {
-	return s.NotifyHTTPError(
-		http.StatusInternalServerError,
-		"Internal Server Error",
-		err,
-		request,
-		nil,
-	)
-}
-
-// NotifyBadRequest for 400 errors
-func (s *SlackNotifier) NotifyBadRequest(err error, request *http.Request) error {
-	return s.NotifyHTTPError(
-		http.StatusBadRequest,
-		"Bad Request",
-		err,
-		request,
-		nil,
-	)
-}
-
-// NotifyNotFound for 404 errors
-func (s *SlackNotifier) NotifyNotFound(err error, request *http.Request) error {
-	return s.NotifyHTTPError(
-		http.StatusNotFound,
-		"Not Found",
-		err,
-		request,
-		nil,
-	)
-}
-
-// NotifyConflict for 409 errors
-func (s *SlackNotifier) NotifyConflict(err error, request *http.Request) error {
-	return s.NotifyHTTPError(
-		http.StatusConflict,
-		"Resource Conflict",
-		err,
-		request,
-		nil,
-	)
-}
-
-// NotifyForbidden for 403 errors
-func (s *SlackNotifier) NotifyForbidden(request *http.Request) error {
-	dummyErr := fmt.Errorf("access forbidden")
-	return s.NotifyHTTPError(
-		http.StatusForbidden,
-		"Forbidden",
-		dummyErr,
-		request,
-		nil,
-	)
-}
-
-// NotifyUnauthorized for 401 errors
-func (s *SlackNotifier) NotifyUnauthorized(err error, request *http.Request) error {
-	return s.NotifyHTTPError(
-		http.StatusUnauthorized,
-		"Unauthorized",
-		err,
-		request,
-		nil,
-	)
-}
-
-// NotifyRateLimitExceeded for 429 errors
-func (s *SlackNotifier) NotifyRateLimitExceeded(request *http.Request, retryAfter string) error {
-	context := map[string]string{
-		"Retry-After": retryAfter,
-	}
-
-	rateLimitErr := fmt.Errorf("rate limit exceeded")
-	return s.NotifyHTTPError(
-		http.StatusTooManyRequests,
-		"Rate Limit Exceeded",
-		rateLimitErr,
-		request,
-		context,
-	)
-}
-
-// NotifySuccess for successful operations worth logging
-func (s *SlackNotifier) NotifySuccess(title string, message string, context map[string]string) error {
-	return s.SendRichNotification(
-		fmt.Sprintf("✅ %s", title),
-		message,
-		"good",
-		context,
-	)
-}
-
-// NotifyWarning for important warnings not tied to HTTP errors
-func (s *SlackNotifier) NotifyWarning(title string, message string, context map[string]string) error {
-	return s.SendRichNotification(
-		fmt.Sprintf("⚠️ %s", title),
-		message,
-		"warning",
-		context,
-	)
-}
-
-// NotifyInfo for general informational messages
-func (s *SlackNotifier) NotifyInfo(title string, message string, context map[string]string) error {
-	return s.SendRichNotification(
-		fmt.Sprintf("ℹ️ %s", title),
-		message,
-		"#3AA3E3", // Blue
-		context,
-	)
+	return errors.Join(errs...)
 }
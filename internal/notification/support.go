@@ -0,0 +1,29 @@
+package notification
+
+import "context"
+
+type supportRefKey struct{}
+
+// ContextWithSupportRef attaches the reference a user quotes to support, so
+// notifications about the request can be matched to their report
+func ContextWithSupportRef(ctx context.Context, ref string) context.Context {
+	return context.WithValue(ctx, supportRefKey{}, ref)
+}
+
+func SupportRefFromContext(ctx context.Context) string {
+	ref, _ := ctx.Value(supportRefKey{}).(string)
+	return ref
+}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID attaches the request ID, so notifications can be matched to the
+// logs and the response of the request
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
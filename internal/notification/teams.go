@@ -0,0 +1,75 @@
+package notification
+
+// TeamsNotifier posts Adaptive Cards to a Microsoft Teams incoming webhook, the format
+// both the Workflows webhooks and the older connectors accept
+type TeamsNotifier struct {
+	webhookURL  string
+	minSeverity Severity
+}
+
+func NewTeamsNotifier(webhookURL string, minSeverity Severity) *TeamsNotifier {
+	return &TeamsNotifier{webhookURL: webhookURL, minSeverity: minSeverity}
+}
+
+func (t *TeamsNotifier) Name() string {
+	return "teams"
+}
+
+func (t *TeamsNotifier) Notify(msg Message) error {
+	if msg.Severity < t.minSeverity {
+		return nil
+	}
+
+	body := []map[string]any{{
+		"type":   "TextBlock",
+		"text":   msg.Title,
+		"weight": "Bolder",
+		"size":   "Medium",
+		"color":  teamsColor(msg.Color),
+		"wrap":   true,
+	}}
+
+	if msg.Text != "" {
+		body = append(body, map[string]any{"type": "TextBlock", "text": msg.Text, "wrap": true})
+	}
+
+	if len(msg.Fields) > 0 {
+		facts := []map[string]string{}
+		for _, name := range sortedKeys(msg.Fields) {
+			facts = append(facts, map[string]string{"title": name, "value": msg.Fields[name]})
+		}
+		body = append(body, map[string]any{"type": "FactSet", "facts": facts})
+	}
+
+	return postJSON(t.webhookURL, map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}, nil)
+}
+
+// Ping only checks the URL, Teams has no way to check a webhook without posting to it
+func (t *TeamsNotifier) Ping() error {
+	return checkWebhookURL(t.webhookURL)
+}
+
+// teamsColor maps a Message color onto the few colors an Adaptive Card text block has
+func teamsColor(color string) string {
+	switch color {
+	case "good":
+		return "Good"
+	case "warning":
+		return "Warning"
+	case "danger":
+		return "Attention"
+	default:
+		return "Default"
+	}
+}
@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"encoding/json"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/webhook"
+)
+
+// WebhookNotifier posts every message as plain JSON, for PagerDuty, Opsgenie or any
+// in-house tool that takes a webhook. With a secret the body is signed like the partner
+// webhooks, in the X-Webhook-Signature header.
+type WebhookNotifier struct {
+	webhookURL  string
+	secret      string
+	minSeverity Severity
+}
+
+func NewWebhookNotifier(webhookURL, secret string, minSeverity Severity) *WebhookNotifier {
+	return &WebhookNotifier{webhookURL: webhookURL, secret: secret, minSeverity: minSeverity}
+}
+
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookNotifier) Notify(msg Message) error {
+	if msg.Severity < w.minSeverity {
+		return nil
+	}
+
+	fields := msg.Fields
+	if fields == nil {
+		fields = map[string]string{}
+	}
+
+	body := map[string]any{
+		"category": msg.Category,
+		"severity": msg.Severity.String(),
+		"title":    msg.Title,
+		"text":     msg.Text,
+		"color":    "#" + hexColor(msg.Color),
+		"fields":   fields,
+		"sent_at":  time.Now().UTC(),
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var headers map[string]string
+	if w.secret != "" {
+		headers = map[string]string{webhook.SignatureHeader: webhook.Sign(w.secret, time.Now(), data)}
+	}
+
+	return postBody(w.webhookURL, data, headers)
+}
+
+// Ping only checks the URL, posting to an unknown receiver may page someone
+func (w *WebhookNotifier) Ping() error {
+	return checkWebhookURL(w.webhookURL)
+}
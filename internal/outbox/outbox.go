@@ -0,0 +1,226 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+const (
+	// pollInterval is how often the dispatcher looks for due messages, Notify wakes it
+	// up sooner
+	pollInterval = time.Second * 2
+	// batchSize caps the messages one poll handles, they are handled concurrently
+	batchSize = 20
+	// handleTimeout bounds one attempt
+	handleTimeout = time.Second * 30
+	// leaseDuration is how long a claimed message stays with this instance before another
+	// one may pick it up, well above handleTimeout
+	leaseDuration = time.Minute
+)
+
+// Backoff is the wait after each failed attempt. A message still failing after the last
+// one is kept as failed, six attempts over roughly three hours.
+var Backoff = []time.Duration{
+	time.Second * 10,
+	time.Minute,
+	time.Minute * 5,
+	time.Minute * 30,
+	time.Hour * 2,
+}
+
+// Message is a side effect that must not be lost, its kind is the same for every value
+// of the type
+type Message interface {
+	OutboxKind() string
+}
+
+// Store keeps the outbox table, store.OutboxStore implements it
+type Store interface {
+	Create(ctx context.Context, message *models.OutboxMessage) error
+	ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.OutboxMessage, error)
+	Delete(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration) error
+}
+
+type handlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+// Dispatcher writes messages in the transaction of the change that causes them and runs
+// their handlers once committed. Every instance can run a dispatcher, each message is
+// handled by whichever claims it and deleted once its handler succeeds.
+type Dispatcher struct {
+	store    Store
+	logger   *zap.SugaredLogger
+	handlers map[string]handlerFunc
+	running  bool
+	wake     chan struct{}
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+func NewDispatcher(store Store, logger *zap.SugaredLogger) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		logger:   logger,
+		handlers: map[string]handlerFunc{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Subscribe runs handler for every M in the outbox. A handler may run more than once for
+// the same message, when its instance dies before deleting it.
+func Subscribe[M Message](dispatcher *Dispatcher, handler func(context.Context, M) error) {
+	var zero M
+	kind := zero.OutboxKind()
+
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+
+	dispatcher.handlers[kind] = func(ctx context.Context, payload json.RawMessage) error {
+		var message M
+		if err := json.Unmarshal(payload, &message); err != nil {
+			return fmt.Errorf("decoding %s: %w", kind, err)
+		}
+		return handler(ctx, message)
+	}
+}
+
+// Add writes message to the outbox. Call it with the context of store.WithTransaction,
+// then Notify once the transaction is committed.
+func (dispatcher *Dispatcher) Add(ctx context.Context, message Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return dispatcher.store.Create(ctx, &models.OutboxMessage{
+		Kind:    message.OutboxKind(),
+		Payload: payload,
+	})
+}
+
+// Notify makes the dispatcher look for due messages now instead of at the next poll
+func (dispatcher *Dispatcher) Notify() {
+	select {
+	case dispatcher.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start polls for due messages until Stop is called
+func (dispatcher *Dispatcher) Start() {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+
+	if dispatcher.running {
+		return
+	}
+
+	dispatcher.running = true
+	dispatcher.stop = make(chan struct{})
+
+	dispatcher.wg.Add(1)
+	go dispatcher.loop()
+}
+
+// Stop ends polling and waits for the messages in flight
+func (dispatcher *Dispatcher) Stop() {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+
+	if !dispatcher.running {
+		return
+	}
+
+	dispatcher.running = false
+	close(dispatcher.stop)
+
+	dispatcher.wg.Wait()
+}
+
+func (dispatcher *Dispatcher) loop() {
+	defer dispatcher.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dispatcher.stop:
+			return
+		case <-ticker.C:
+		case <-dispatcher.wake:
+		}
+
+		dispatcher.dispatchDue()
+	}
+}
+
+// dispatchDue claims a batch of due messages and handles them
+func (dispatcher *Dispatcher) dispatchDue() {
+	ctx := context.Background()
+
+	messages, err := dispatcher.store.ClaimDue(ctx, uuid.NewString(), batchSize, leaseDuration)
+	if err != nil {
+		dispatcher.logger.Errorw("failed to claim outbox messages", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, message := range messages {
+		wg.Add(1)
+		go func(message *models.OutboxMessage) {
+			defer wg.Done()
+			dispatcher.handle(ctx, message)
+		}(message)
+	}
+	wg.Wait()
+}
+
+// handle makes one attempt and records its outcome, Attempts already counts it
+func (dispatcher *Dispatcher) handle(ctx context.Context, message *models.OutboxMessage) {
+	dispatcher.mu.Lock()
+	handler, ok := dispatcher.handlers[message.Kind]
+	dispatcher.mu.Unlock()
+
+	var err error
+	if ok {
+		handleCtx, cancel := context.WithTimeout(ctx, handleTimeout)
+		err = handler(handleCtx, message.Payload)
+		cancel()
+	} else {
+		err = fmt.Errorf("no handler subscribed to %s", message.Kind)
+	}
+
+	if err == nil {
+		if err := dispatcher.store.Delete(ctx, message.ID); err != nil {
+			dispatcher.logger.Errorw("failed to delete handled outbox message", "messageID", message.ID, "error", err)
+		}
+		return
+	}
+
+	var retryIn time.Duration
+	if message.Attempts <= len(Backoff) {
+		retryIn = Backoff[message.Attempts-1]
+	}
+
+	dispatcher.logger.Warnw("outbox message failed",
+		"messageID", message.ID,
+		"kind", message.Kind,
+		"attempt", message.Attempts,
+		"retryIn", retryIn,
+		"error", err,
+	)
+
+	if err := dispatcher.store.MarkFailed(ctx, message.ID, err.Error(), retryIn); err != nil {
+		dispatcher.logger.Errorw("failed to record outbox failure", "messageID", message.ID, "error", err)
+	}
+}
@@ -0,0 +1,11 @@
+package outbox
+
+// VerificationEmail mails a code to a user who registered and has yet to verify their email
+type VerificationEmail struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+	// Locale is the language the user registered in
+	Locale string `json:"locale"`
+}
+
+func (VerificationEmail) OutboxKind() string { return "email.verification" }
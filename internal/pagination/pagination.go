@@ -0,0 +1,182 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// Encode turns the position after the last item of a page into an opaque cursor. position
+// is any JSON value, typically the sort key of the item and the id breaking ties.
+func Encode(position any) (string, error) {
+	raw, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Decode reads a cursor made by Encode into position, ErrInvalidCursor when it is not one
+func Decode(cursor string, position any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, position); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// ClampLimit keeps limit between 1 and max, a missing or negative limit becomes fallback
+func ClampLimit(limit, fallback, max int) int {
+	switch {
+	case limit <= 0:
+		limit = fallback
+	case limit > max:
+		limit = max
+	}
+	return limit
+}
+
+// Sort is the order of a list, Column comes from a Sorts whitelist and is safe to put in SQL
+type Sort struct {
+	Field  string
+	Column string
+	Desc   bool
+}
+
+// SQL returns the ORDER BY term of the sort
+func (sort Sort) SQL() string {
+	if sort.Desc {
+		return sort.Column + " DESC"
+	}
+	return sort.Column + " ASC"
+}
+
+// Direction is asc or desc, for lists that only let clients choose the direction
+func (sort Sort) Direction() string {
+	if sort.Desc {
+		return "desc"
+	}
+	return "asc"
+}
+
+// Sorts maps the fields clients may sort by onto their columns, anything else is rejected
+type Sorts map[string]string
+
+// Parse reads a sort such as "created_at" or "-created_at" for descending, fallback when
+// value is empty
+func (sorts Sorts) Parse(value string, fallback Sort) (Sort, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fallback, nil
+	}
+
+	field, desc := strings.CutPrefix(value, "-")
+	column, ok := sorts[field]
+	if !ok {
+		return fallback, fmt.Errorf("%w: sort by one of %s", ErrInvalidSort, strings.Join(sorts.fields(), ", "))
+	}
+
+	return Sort{Field: field, Column: column, Desc: desc}, nil
+}
+
+func (sorts Sorts) fields() []string {
+	fields := make([]string, 0, len(sorts))
+	for field := range sorts {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// Options are the defaults and bounds of one list endpoint
+type Options struct {
+	DefaultLimit int
+	MaxLimit     int
+	// Sorts is nil for lists with a single order
+	Sorts       Sorts
+	DefaultSort Sort
+}
+
+// Params are the limit, cursor and sort a client asked for
+type Params struct {
+	Limit  int
+	Cursor string
+	Sort   Sort
+}
+
+// Parse reads limit, cursor and sort from the query string. The limit is clamped rather
+// than rejected, a sort outside options.Sorts is ErrInvalidSort.
+func Parse(request *http.Request, options Options) (Params, error) {
+	values := request.URL.Query()
+	params := Params{
+		Limit:  options.DefaultLimit,
+		Cursor: values.Get("cursor"),
+		Sort:   options.DefaultSort,
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			return params, fmt.Errorf("invalid limit: %w", err)
+		}
+		params.Limit = parsed
+	}
+	params.Limit = ClampLimit(params.Limit, options.DefaultLimit, options.MaxLimit)
+
+	if options.Sorts != nil {
+		sort, err := options.Sorts.Parse(values.Get("sort"), options.DefaultSort)
+		if err != nil {
+			return params, err
+		}
+		params.Sort = sort
+	}
+
+	return params, nil
+}
+
+// Offset is where a list read with LIMIT and OFFSET resumes, from a cursor made by
+// OffsetPage. It is 0 on the first page.
+func (params Params) Offset() (int, error) {
+	if params.Cursor == "" {
+		return 0, nil
+	}
+
+	var offset int
+	if err := Decode(params.Cursor, &offset); err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// OffsetPage is the Page of a list read with LIMIT and OFFSET after count items were read
+// at offset. A full page means there may be more.
+func OffsetPage(limit, offset, count int) Page {
+	if count < limit {
+		return Page{}
+	}
+
+	// an int always encodes
+	cursor, _ := Encode(offset + count)
+	return Page{NextCursor: cursor}
+}
+
+// Page is where a list response stands, NextCursor is empty on the last page and Total is
+// nil when counting would be too expensive. The list envelope is built from it in
+// cmd/api (see writeList), where the items are redacted for the viewer.
+type Page struct {
+	NextCursor string
+	Total      *int64
+}
@@ -0,0 +1,106 @@
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrOverloaded     = errors.New("the server is handling too many requests, please try again shortly")
+	ErrKeyConcurrency = errors.New("you have too many requests in progress, please wait for them to finish")
+)
+
+// ConcurrencyLimiter caps the requests in flight on this instance, in total and per key.
+// Unlike the window limiters it counts what is running right now, so slow handlers piling up
+// are turned away instead of queueing until they time out.
+type ConcurrencyLimiter struct {
+	// limit and perKey are 0 when there is no such cap
+	limit  int64
+	perKey int
+
+	inFlight atomic.Int64
+	peak     atomic.Int64
+	shed     atomic.Int64
+	shedKey  atomic.Int64
+
+	mu   sync.Mutex
+	keys map[string]int
+}
+
+// ConcurrencyStats is a snapshot of a ConcurrencyLimiter
+type ConcurrencyStats struct {
+	InFlight int64
+	// Peak is the most requests that were in flight at once since startup
+	Peak   int64
+	Limit  int64
+	PerKey int
+	// Shed counts the requests turned away for the instance limit, ShedKey the ones for
+	// the per key limit
+	Shed    int64
+	ShedKey int64
+}
+
+func NewConcurrencyLimiter(limit, perKey int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		limit:  int64(limit),
+		perKey: perKey,
+		keys:   make(map[string]int),
+	}
+}
+
+// Acquire takes a slot for a request counted against key. The caller runs the request
+// and calls release when it is done, unless an error says which limit it is over.
+func (limiter *ConcurrencyLimiter) Acquire(key string) (release func(), err error) {
+	inFlight := limiter.inFlight.Add(1)
+	if limiter.limit > 0 && inFlight > limiter.limit {
+		limiter.inFlight.Add(-1)
+		limiter.shed.Add(1)
+		return nil, ErrOverloaded
+	}
+
+	if limiter.perKey <= 0 {
+		limiter.recordPeak(inFlight)
+		return func() { limiter.inFlight.Add(-1) }, nil
+	}
+
+	limiter.mu.Lock()
+	if limiter.keys[key] >= limiter.perKey {
+		limiter.mu.Unlock()
+		limiter.inFlight.Add(-1)
+		limiter.shedKey.Add(1)
+		return nil, ErrKeyConcurrency
+	}
+	limiter.keys[key]++
+	limiter.mu.Unlock()
+	limiter.recordPeak(inFlight)
+
+	return func() {
+		limiter.mu.Lock()
+		if limiter.keys[key]--; limiter.keys[key] <= 0 {
+			delete(limiter.keys, key)
+		}
+		limiter.mu.Unlock()
+		limiter.inFlight.Add(-1)
+	}, nil
+}
+
+func (limiter *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	return ConcurrencyStats{
+		InFlight: limiter.inFlight.Load(),
+		Peak:     limiter.peak.Load(),
+		Limit:    limiter.limit,
+		PerKey:   limiter.perKey,
+		Shed:     limiter.shed.Load(),
+		ShedKey:  limiter.shedKey.Load(),
+	}
+}
+
+func (limiter *ConcurrencyLimiter) recordPeak(inFlight int64) {
+	for {
+		peak := limiter.peak.Load()
+		if inFlight <= peak || limiter.peak.CompareAndSwap(peak, inFlight) {
+			return
+		}
+	}
+}
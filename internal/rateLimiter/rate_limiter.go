@@ -6,8 +6,17 @@ type Limiter interface {
 	Allow(ip string) (bool, time.Duration)
 }
 
+// Key strategies decide which bucket a request is counted against
+const (
+	// KeyByIP counts requests per client host, ignoring the connection's port
+	KeyByIP = "ip"
+	// KeyByUser counts authenticated requests per user and falls back to the client host
+	KeyByUser = "user"
+)
+
 type Config struct {
 	RequestPerTimeForIP int
 	TimeFrame           time.Duration
 	Enabled             bool
+	KeyStrategy         string
 }
@@ -0,0 +1,67 @@
+package ratelimiter
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisLimiterTimeout bounds the Redis round trip so a slow Redis does not hold up requests
+const redisLimiterTimeout = time.Second
+
+// RedisFixedWindowRateLimiter counts in Redis, so the limit holds across every instance
+type RedisFixedWindowRateLimiter struct {
+	rdb    *redis.Client
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+func NewRedisFixedWindowLimiter(rdb *redis.Client, prefix string, limit int, window time.Duration) *RedisFixedWindowRateLimiter {
+	return &RedisFixedWindowRateLimiter{
+		rdb:    rdb,
+		prefix: prefix,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Allow fails open when Redis cannot be reached, the request limiter still applies then
+func (rateLimit *RedisFixedWindowRateLimiter) Allow(key string) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisLimiterTimeout)
+	defer cancel()
+
+	cacheKey := rateLimit.prefix + key
+
+	var incr *redis.IntCmd
+	var ttl *redis.DurationCmd
+	_, err := rateLimit.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, cacheKey)
+		ttl = pipe.TTL(ctx, cacheKey)
+		return nil
+	})
+	if err != nil {
+		log.Printf("redis rate limiter unavailable, allowing %s: %v", cacheKey, err)
+		return true, 0
+	}
+
+	// The window starts with the first hit. A key without expiry is also fixed here, in
+	// case a previous expire got lost.
+	if ttl.Val() < 0 {
+		if err := rateLimit.rdb.Expire(ctx, cacheKey, rateLimit.window).Err(); err != nil {
+			log.Printf("failed to set rate limit window for %s: %v", cacheKey, err)
+		}
+	}
+
+	if incr.Val() <= int64(rateLimit.limit) {
+		return true, 0
+	}
+
+	retryAfter := ttl.Val()
+	if retryAfter <= 0 {
+		retryAfter = rateLimit.window
+	}
+	return false, retryAfter
+}
@@ -0,0 +1,35 @@
+package readonly
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps the mode in the process, for a single instance without Redis. It is
+// lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	enabled *bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (store *MemoryStore) Enabled(context.Context) (bool, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.enabled == nil {
+		return false, false, nil
+	}
+	return *store.enabled, true, nil
+}
+
+func (store *MemoryStore) SetEnabled(_ context.Context, enabled bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.enabled = &enabled
+	return nil
+}
@@ -0,0 +1,59 @@
+// Package readonly holds the read-only switch of the API. It is kept in a Store so that
+// turning it on or off through the admin API reaches every instance, each of which
+// copies it with Reload so requests never wait on the Store.
+package readonly
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Store keeps whether read-only mode is on
+type Store interface {
+	// Enabled returns the stored mode, set is false when it was never switched
+	Enabled(ctx context.Context) (enabled bool, set bool, err error)
+	SetEnabled(ctx context.Context, enabled bool) error
+}
+
+// Switch is the mode of this instance, it falls back to the configured one until the
+// mode is switched at runtime
+type Switch struct {
+	store    Store
+	fallback bool
+	enabled  atomic.Bool
+}
+
+// NewSwitch returns a Switch for store that starts at fallback
+func NewSwitch(store Store, fallback bool) *Switch {
+	readOnly := &Switch{store: store, fallback: fallback}
+	readOnly.enabled.Store(fallback)
+	return readOnly
+}
+
+// Enabled reports whether read-only mode is on for this instance
+func (readOnly *Switch) Enabled() bool {
+	return readOnly.enabled.Load()
+}
+
+// Set stores the mode and applies it on this instance, the others pick it up on their
+// next Reload
+func (readOnly *Switch) Set(ctx context.Context, enabled bool) error {
+	if err := readOnly.store.SetEnabled(ctx, enabled); err != nil {
+		return err
+	}
+	readOnly.enabled.Store(enabled)
+	return nil
+}
+
+// Reload copies the mode from the Store. When it fails the previous mode stays.
+func (readOnly *Switch) Reload(ctx context.Context) error {
+	enabled, set, err := readOnly.store.Enabled(ctx)
+	if err != nil {
+		return err
+	}
+	if !set {
+		enabled = readOnly.fallback
+	}
+	readOnly.enabled.Store(enabled)
+	return nil
+}
@@ -0,0 +1,49 @@
+package readonly
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSwitchSharesTheStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	// two instances started with READ_ONLY_MODE=true
+	first := NewSwitch(store, true)
+	second := NewSwitch(store, true)
+
+	// nothing was switched yet, the configured mode stays
+	if err := second.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !second.Enabled() {
+		t.Fatal("reload without a stored mode dropped the configured one")
+	}
+
+	if err := first.Set(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if first.Enabled() {
+		t.Error("the switching instance is still read-only")
+	}
+	if !second.Enabled() {
+		t.Error("the other instance changed before reloading")
+	}
+
+	if err := second.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if second.Enabled() {
+		t.Error("the other instance is still read-only after reloading")
+	}
+
+	// a restarted instance takes the stored mode over the configured one
+	restarted := NewSwitch(store, true)
+	if err := restarted.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Enabled() {
+		t.Error("a restarted instance ignored the stored mode")
+	}
+}
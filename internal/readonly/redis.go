@@ -0,0 +1,38 @@
+package readonly
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore keeps the mode in a single key shared by every instance. It has no expiry,
+// the mode stays until it is switched again, also across restarts.
+type RedisStore struct {
+	rdb *redis.Client
+	key string
+}
+
+func NewRedisStore(rdb *redis.Client, key string) *RedisStore {
+	return &RedisStore{rdb: rdb, key: key}
+}
+
+func (store *RedisStore) Enabled(ctx context.Context) (bool, bool, error) {
+	value, err := store.rdb.Get(ctx, store.key).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return value == "1", true, nil
+}
+
+func (store *RedisStore) SetEnabled(ctx context.Context, enabled bool) error {
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	return store.rdb.Set(ctx, store.key, value, 0).Err()
+}
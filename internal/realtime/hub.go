@@ -0,0 +1,186 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// clientBuffer is how many messages a slow connection may fall behind before new
+	// ones are dropped for it
+	clientBuffer = 16
+	// listenRetryDelay is the pause before a broadcaster that stopped listening is restarted
+	listenRetryDelay = time.Second * 5
+)
+
+// Message types pushed to the clients
+const (
+	TypeNotification = "notification"
+	TypeFeed         = "feed"
+)
+
+// Message is pushed to every connection of the users in UserIDs, Data holds its JSON
+type Message struct {
+	UserIDs []int64         `json:"user_ids"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Broadcaster carries messages between the instances, every instance receives every
+// message and delivers it to the connections it holds
+type Broadcaster interface {
+	Broadcast(ctx context.Context, msg Message) error
+	// Listen calls deliver for every broadcast message until ctx is done
+	Listen(ctx context.Context, deliver func(Message)) error
+}
+
+// Hub keeps the open connections of this instance by user. Without a broadcaster messages
+// only reach the connections of the instance that published them.
+type Hub struct {
+	broadcaster Broadcaster
+	logger      *zap.SugaredLogger
+	mu          sync.RWMutex
+	clients     map[int64]map[chan Message]struct{}
+	cancel      context.CancelFunc
+	done        chan struct{}
+	// closing is closed by Disconnect
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewHub(broadcaster Broadcaster, logger *zap.SugaredLogger) *Hub {
+	return &Hub{
+		broadcaster: broadcaster,
+		logger:      logger,
+		clients:     map[int64]map[chan Message]struct{}{},
+		closing:     make(chan struct{}),
+	}
+}
+
+// Subscribe opens a connection for userID. The returned func must be called once the
+// connection is gone.
+func (hub *Hub) Subscribe(userID int64) (<-chan Message, func()) {
+	ch := make(chan Message, clientBuffer)
+
+	hub.mu.Lock()
+	if hub.clients[userID] == nil {
+		hub.clients[userID] = map[chan Message]struct{}{}
+	}
+	hub.clients[userID][ch] = struct{}{}
+	hub.mu.Unlock()
+
+	return ch, func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+
+		delete(hub.clients[userID], ch)
+		if len(hub.clients[userID]) == 0 {
+			delete(hub.clients, userID)
+		}
+	}
+}
+
+// Disconnect tells every open connection to end, the server does not wait for
+// streams on its own when it shuts down
+func (hub *Hub) Disconnect() {
+	hub.closeOnce.Do(func() { close(hub.closing) })
+}
+
+// Disconnected is closed once Disconnect was called
+func (hub *Hub) Disconnected() <-chan struct{} {
+	return hub.closing
+}
+
+// Connections returns how many connections this instance holds
+func (hub *Hub) Connections() int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	count := 0
+	for _, clients := range hub.clients {
+		count += len(clients)
+	}
+	return count
+}
+
+// Publish pushes data as a message of kind to the connections of userIDs
+func (hub *Hub) Publish(ctx context.Context, userIDs []int64, kind string, data any) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	msg := Message{UserIDs: userIDs, Type: kind, Data: payload}
+
+	if hub.broadcaster == nil {
+		hub.deliver(msg)
+		return nil
+	}
+	return hub.broadcaster.Broadcast(ctx, msg)
+}
+
+// Start listens to the broadcaster until Stop is called, it does nothing without one
+func (hub *Hub) Start() {
+	if hub.broadcaster == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hub.cancel = cancel
+	hub.done = make(chan struct{})
+
+	go hub.run(ctx)
+}
+
+func (hub *Hub) Stop() {
+	if hub.cancel == nil {
+		return
+	}
+
+	hub.cancel()
+	<-hub.done
+}
+
+func (hub *Hub) run(ctx context.Context) {
+	defer close(hub.done)
+
+	for {
+		err := hub.broadcaster.Listen(ctx, hub.deliver)
+		if ctx.Err() != nil {
+			return
+		}
+
+		hub.logger.Errorw("realtime listener stopped, restarting", "error", err, "retryIn", listenRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+// deliver hands msg to the local connections of its users, a connection whose buffer is
+// full misses it rather than holding up the others
+func (hub *Hub) deliver(msg Message) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	for _, userID := range msg.UserIDs {
+		for ch := range hub.clients[userID] {
+			select {
+			case ch <- msg:
+			default:
+				hub.logger.Warnw("realtime connection is behind, message dropped", "userID", userID, "type", msg.Type)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisBroadcaster carries messages over a Redis pub/sub channel. Pub/sub does not keep
+// messages, an instance that is down misses what was published meanwhile.
+type RedisBroadcaster struct {
+	rdb     *redis.Client
+	channel string
+}
+
+func NewRedisBroadcaster(rdb *redis.Client, channel string) *RedisBroadcaster {
+	return &RedisBroadcaster{rdb: rdb, channel: channel}
+}
+
+func (broadcaster *RedisBroadcaster) Broadcast(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return broadcaster.rdb.Publish(ctx, broadcaster.channel, data).Err()
+}
+
+func (broadcaster *RedisBroadcaster) Listen(ctx context.Context, deliver func(Message)) error {
+	pubsub := broadcaster.rdb.Subscribe(ctx, broadcaster.channel)
+	defer pubsub.Close()
+
+	// wait for the subscription so a broken connection is reported and retried
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case received, ok := <-messages:
+			if !ok {
+				return errors.New("realtime channel closed")
+			}
+
+			var msg Message
+			if err := json.Unmarshal([]byte(received.Payload), &msg); err != nil {
+				continue
+			}
+			deliver(msg)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+)
+
+// S3Client talks to any S3 compatible API. The driver only changes the endpoint,
+// addressing style, ACL and public URL, see New.
+type S3Client struct {
+	client     *s3.Client
+	presigner  *s3.PresignClient
+	driver     string
+	bucketName string
+	publicURL  string
+	// publicACL sends public-read with uploads, buckets that enforce bucket owner
+	// permissions (the AWS default) reject requests carrying an ACL
+	publicACL bool
+}
+
+func newS3Client(cfg Config, region string, pathStyle, publicACL bool) (*S3Client, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")),
+		config.WithRegion(region),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = pathStyle
+
+		// Only AWS understands the checksums the SDK adds by default
+		if cfg.Driver != DriverS3 {
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+	})
+
+	return &S3Client{
+		client:     client,
+		presigner:  s3.NewPresignClient(client),
+		driver:     cfg.Driver,
+		bucketName: cfg.Bucket,
+		publicURL:  strings.TrimSuffix(cfg.PublicURL, "/"),
+		publicACL:  publicACL,
+	}, nil
+}
+
+func (r *S3Client) UploadFile(ctx context.Context, key string, file io.Reader, contentType string, size int64) (*UploadResult, error) {
+	uploadInput := &s3.PutObjectInput{
+		Bucket:        aws.String(r.bucketName),
+		Key:           aws.String(key),
+		Body:          file,
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}
+	if r.publicACL {
+		uploadInput.ACL = types.ObjectCannedACLPublicRead
+	}
+
+	_, err := r.client.PutObject(ctx, uploadInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	publicURL := r.GetFileURL(key)
+
+	return &UploadResult{
+		Key: key,
+		URL: publicURL,
+	}, nil
+}
+
+// UploadPrivateFile stores a file without the public-read ACL, for backups and other
+// objects that must never be served from the public URL
+func (r *S3Client) UploadPrivateFile(ctx context.Context, key string, file io.Reader, contentType string, size int64) error {
+	_, err := r.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(r.bucketName),
+		Key:           aws.String(key),
+		Body:          file,
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return nil
+}
+
+// GeneratePresignedUploadURL returns a URL that accepts one PUT of key until expiry. The
+// content type and size are part of the signature, the client must send the same Content-Type
+// header and exactly size bytes, so the bucket refuses anything larger than was announced.
+func (r *S3Client) GeneratePresignedUploadURL(ctx context.Context, key string, contentType string, size int64, expiry time.Duration) (string, error) {
+	request, err := r.presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(r.bucketName),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign storage upload: %w", err)
+	}
+
+	return request.URL, nil
+}
+
+// DownloadFile returns the content of key, the caller closes it
+func (r *S3Client) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file from storage: %w", err)
+	}
+
+	return output.Body, nil
+}
+
+// ListFiles returns the keys starting with prefix in lexical order
+func (r *S3Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	objects, err := r.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Key
+	}
+
+	return keys, nil
+}
+
+// ListObjects returns every object under prefix with its size and modification time
+func (r *S3Client) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(r.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	objects := []ObjectInfo{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files in storage: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func (r *S3Client) Ping(ctx context.Context) error {
+	_, err := r.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(r.bucketName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to access storage bucket: %w", err)
+	}
+
+	return nil
+}
+
+// GetFileURL is where a public object is served, PublicURL when set or the driver's default
+func (r *S3Client) GetFileURL(key string) string {
+	switch r.driver {
+	case DriverR2:
+		if r.publicURL != "" {
+			return fmt.Sprintf("%s/%s/%s", r.publicURL, r.bucketName, key)
+		}
+		return fmt.Sprintf("https://pub-%s.r2.dev/%s", r.bucketName, key)
+	case DriverS3:
+		if r.publicURL != "" {
+			return fmt.Sprintf("%s/%s", r.publicURL, key)
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", r.bucketName, r.client.Options().Region, key)
+	default:
+		// GCS and MinIO serve path style from the API endpoint
+		if r.publicURL != "" {
+			return fmt.Sprintf("%s/%s", r.publicURL, key)
+		}
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(aws.ToString(r.client.Options().BaseEndpoint), "/"), r.bucketName, key)
+	}
+}
+
+// Helper functions
+func GenerateFileKey(originalFilename string) string {
+	ext := filepath.Ext(originalFilename)
+	id := uuid.New().String()
+	timestamp := time.Now().Unix()
+	return fmt.Sprintf("uploads/%d-%s%s", timestamp, id, ext)
+}
+
+func GetContentType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+func (r *S3Client) DeleteFile(ctx context.Context, key string) error {
+	deleteInput := &s3.DeleteObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+	}
+
+	_, err := r.client.DeleteObject(ctx, deleteInput)
+	if err != nil {
+		return fmt.Errorf("failed to delete file from storage: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFolder removes every object whose key starts with prefix
+func (r *S3Client) DeleteFolder(ctx context.Context, prefix string) error {
+	paginator := s3.NewListObjectsV2Paginator(r.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list files in storage: %w", err)
+		}
+
+		if len(page.Contents) == 0 {
+			continue
+		}
+
+		objects := make([]types.ObjectIdentifier, len(page.Contents))
+		for i, object := range page.Contents {
+			objects[i] = types.ObjectIdentifier{Key: object.Key}
+		}
+
+		_, err = r.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(r.bucketName),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete files from storage: %w", err)
+		}
+	}
+
+	return nil
+}
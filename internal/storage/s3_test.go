@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeneratePresignedUploadURLSignsSize(t *testing.T) {
+	client, err := New(Config{
+		Driver:          DriverMinIO,
+		Endpoint:        "http://localhost:9000",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "uploads",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploadURL, err := client.GeneratePresignedUploadURL(context.Background(), "users/1/uploads/a.png", "image/png", 1024, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(uploadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := strings.Split(parsed.Query().Get("X-Amz-SignedHeaders"), ";")
+	for _, header := range []string{"content-length", "content-type"} {
+		found := false
+		for _, name := range signed {
+			found = found || name == header
+		}
+		if !found {
+			t.Errorf("%s is not signed, signed headers are %v", header, signed)
+		}
+	}
+}
@@ -2,16 +2,105 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
+// Drivers picked with STORAGE_DRIVER, all of them go through the S3 compatible API
+const (
+	DriverR2    = "r2"
+	DriverS3    = "s3"
+	DriverGCS   = "gcs"
+	DriverMinIO = "minio"
+)
+
+// gcsEndpoint is the XML API of Cloud Storage, it takes HMAC keys as S3 credentials
+const gcsEndpoint = "https://storage.googleapis.com"
+
+type Config struct {
+	Driver string
+	// Endpoint is required for R2 and MinIO, S3 uses the AWS endpoint of Region
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Bucket          string
+	// PublicURL serves the uploads, e.g. a CDN in front of the bucket
+	PublicURL string
+}
+
 type Client interface {
 	UploadFile(ctx context.Context, key string, file io.Reader, contentType string, size int64) (*UploadResult, error)
+	UploadPrivateFile(ctx context.Context, key string, file io.Reader, contentType string, size int64) error
+	DownloadFile(ctx context.Context, key string) (io.ReadCloser, error)
+	ListFiles(ctx context.Context, prefix string) ([]string, error)
+	ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	GeneratePresignedUploadURL(ctx context.Context, key string, contentType string, size int64, expiry time.Duration) (string, error)
 	DeleteFile(ctx context.Context, key string) error
+	DeleteFolder(ctx context.Context, prefix string) error
 	GetFileURL(key string) string
+	Ping(ctx context.Context) error
+}
+
+// ObjectInfo describes a stored object without downloading it
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
 }
 
 type UploadResult struct {
 	Key string `json:"key"`
 	URL string `json:"url"`
-}
\ No newline at end of file
+}
+
+// UploadPrefixes hold the uploads tracked in the files table. Everything else in the
+// bucket, such as backups and snapshots, is left alone by the orphan cleanup.
+var UploadPrefixes = []string{"users/", "categories/"}
+
+// UserFolder is the key prefix for files owned by a user, so they can be
+// removed together when the account is purged
+func UserFolder(userID int64) string {
+	return fmt.Sprintf("users/%d/", userID)
+}
+
+// New returns the client of cfg.Driver
+func New(cfg Config) (Client, error) {
+	cfg.Driver = strings.ToLower(strings.TrimSpace(cfg.Driver))
+	if cfg.Bucket == "" {
+		return nil, errors.New("storage bucket is required")
+	}
+
+	switch cfg.Driver {
+	case DriverR2:
+		if cfg.Endpoint == "" {
+			return nil, errors.New("r2 storage needs an endpoint")
+		}
+		return newS3Client(cfg, "auto", true, true)
+	case DriverS3:
+		region := cfg.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return newS3Client(cfg, region, false, false)
+	case DriverGCS:
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = gcsEndpoint
+		}
+		return newS3Client(cfg, "auto", true, false)
+	case DriverMinIO:
+		if cfg.Endpoint == "" {
+			return nil, errors.New("minio storage needs an endpoint")
+		}
+		region := cfg.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return newS3Client(cfg, region, true, false)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q, use r2, s3, gcs or minio", cfg.Driver)
+	}
+}
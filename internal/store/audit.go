@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Deleted selects which soft deleted rows a query sees
+type Deleted string
+
+const (
+	// DeletedExclude hides soft deleted rows, every query does this unless told otherwise
+	DeletedExclude Deleted = ""
+	DeletedInclude Deleted = "include"
+	DeletedOnly    Deleted = "only"
+)
+
+var ErrInvalidDeleted = errors.New(`deleted must be "include" or "only"`)
+
+// ParseDeleted reads the ?deleted= value admins send to see soft deleted rows
+func ParseDeleted(value string) (Deleted, error) {
+	switch deleted := Deleted(value); deleted {
+	case DeletedExclude, DeletedInclude, DeletedOnly:
+		return deleted, nil
+	default:
+		return DeletedExclude, ErrInvalidDeleted
+	}
+}
+
+type deletedKey struct{}
+type actorKey struct{}
+
+// ContextWithDeleted makes the queries run with ctx see soft deleted rows. Only admin
+// requests should carry it, everyone else gets the default of hiding them.
+func ContextWithDeleted(ctx context.Context, deleted Deleted) context.Context {
+	return context.WithValue(ctx, deletedKey{}, deleted)
+}
+
+// ContextWithActor records the user making the changes, stores write it to created_by and
+// updated_by. Changes without one (registration, OTP flows, jobs) leave the columns NULL.
+func ContextWithActor(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+// DeletedFromContext is the scope ContextWithDeleted put in ctx, DeletedExclude without one
+func DeletedFromContext(ctx context.Context) Deleted {
+	deleted, _ := ctx.Value(deletedKey{}).(Deleted)
+	return deleted
+}
+
+// ActorFromContext is the user ContextWithActor put in ctx, false without one
+func ActorFromContext(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(actorKey{}).(int64)
+	return userID, ok
+}
+
+// deletedCondition is the condition on table.deleted_at the scope of ctx asks for
+func deletedCondition(ctx context.Context, table string) string {
+	switch DeletedFromContext(ctx) {
+	case DeletedInclude:
+		return "TRUE"
+	case DeletedOnly:
+		return fmt.Sprintf("%s.deleted_at IS NOT NULL", table)
+	default:
+		return fmt.Sprintf("%s.deleted_at IS NULL", table)
+	}
+}
+
+// actor is the created_by or updated_by value of a change made with ctx
+func actor(ctx context.Context) sql.NullInt64 {
+	userID, ok := ActorFromContext(ctx)
+	return sql.NullInt64{Int64: userID, Valid: ok}
+}
+
+// nullableID turns a scanned created_by or updated_by into the model field
+func nullableID(id sql.NullInt64) *int64 {
+	if !id.Valid {
+		return nil
+	}
+	return &id.Int64
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// AuditLogStore is append only, entries are never updated or deleted by the API and have no
+// foreign keys so the trail outlives the accounts it names
+type AuditLogStore struct {
+	db *sql.DB
+}
+
+type AuditLogQuery struct {
+	Limit  int        `json:"limit" validate:"gte=1,lte=100"`
+	Offset int        `json:"offset" validate:"gte=0"`
+	Sort   string     `json:"sort" validate:"oneof=asc desc"`
+	UserID int64      `json:"user_id" validate:"gte=0"`
+	Action string     `json:"action" validate:"max=50"`
+	Since  *time.Time `json:"since"`
+	Until  *time.Time `json:"until"`
+}
+
+// Parse reads user_id, action, since and until (RFC 3339) from the query string. The page
+// and its order come from pagination.Parse.
+func (query AuditLogQuery) Parse(request *http.Request) (AuditLogQuery, error) {
+	values := request.URL.Query()
+
+	userID := values.Get("user_id")
+	if userID != "" {
+		parsed, err := strconv.ParseInt(userID, 10, 64)
+		if err != nil {
+			return query, err
+		}
+		query.UserID = parsed
+	}
+
+	query.Action = strings.ToLower(strings.TrimSpace(values.Get("action")))
+
+	for key, target := range map[string]**time.Time{"since": &query.Since, "until": &query.Until} {
+		value := values.Get(key)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, err
+		}
+		*target = &parsed
+	}
+
+	return query, nil
+}
+
+// Create records an entry, ActorID defaults to the actor of ctx (see ContextWithActor)
+func (storage *AuditLogStore) Create(ctx context.Context, log *models.AuditLog) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, log)
+	})
+}
+
+// List returns a page of the trail, newest first unless sorted ascending
+func (storage *AuditLogStore) List(ctx context.Context, query AuditLogQuery) ([]*models.AuditLog, error) {
+	conditions := []string{"1 = 1"}
+	args := []any{}
+
+	if query.UserID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, query.UserID)
+	}
+	if query.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, query.Action)
+	}
+	if query.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, query.Since.UTC())
+	}
+	if query.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, query.Until.UTC())
+	}
+
+	sqlQuery := `
+		SELECT id, user_id, actor_id, action, ip, user_agent, metadata, created_at
+		FROM audit_logs
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY created_at ` + sortDirection(query.Sort) + `, id ` + sortDirection(query.Sort) + `
+		LIMIT ? OFFSET ?`
+
+	args = append(args, query.Limit, query.Offset)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []*models.AuditLog{}
+	for rows.Next() {
+		log := &models.AuditLog{}
+		var userID, actorID sql.NullInt64
+		var metadata []byte
+		err := rows.Scan(
+			&log.ID,
+			&userID,
+			&actorID,
+			&log.Action,
+			&log.IP,
+			&log.UserAgent,
+			&metadata,
+			&log.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		log.UserID, log.ActorID = nullableID(userID), nullableID(actorID)
+		log.Metadata = metadata
+
+		logs = append(logs, log)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// ================== Private methods ======================//
+func (storage *AuditLogStore) createQuery(ctx context.Context, tx *sql.Tx, log *models.AuditLog) error {
+	query := `
+		INSERT INTO audit_logs (user_id, actor_id, action, ip, user_agent, metadata)
+		VALUES (?, ?, ?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if log.ActorID == nil {
+		log.ActorID = nullableID(actor(ctx))
+	}
+
+	userAgent := log.UserAgent
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	// a NULL column rather than the JSON null when there is nothing to add
+	var metadata any
+	if len(log.Metadata) > 0 {
+		metadata = []byte(log.Metadata)
+	}
+
+	result, err := tx.ExecContext(ctx, query, log.UserID, log.ActorID, log.Action, log.IP, userAgent, metadata)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	log.ID = id
+
+	return nil
+}
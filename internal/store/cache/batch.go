@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// BatchStats describes the multi-gets of one cache since startup
+type BatchStats struct {
+	Batches          uint64  `json:"batches"`
+	Keys             uint64  `json:"keys"`
+	Hits             uint64  `json:"hits"`
+	Misses           uint64  `json:"misses"`
+	AverageBatchSize float64 `json:"average_batch_size"`
+	HitRatio         float64 `json:"hit_ratio"`
+}
+
+type batchMetrics struct {
+	batches atomic.Uint64
+	keys    atomic.Uint64
+	hits    atomic.Uint64
+}
+
+func (metrics *batchMetrics) record(keys, hits int) {
+	metrics.batches.Add(1)
+	metrics.keys.Add(uint64(keys))
+	metrics.hits.Add(uint64(hits))
+}
+
+func (metrics *batchMetrics) snapshot() BatchStats {
+	stats := BatchStats{
+		Batches: metrics.batches.Load(),
+		Keys:    metrics.keys.Load(),
+		Hits:    metrics.hits.Load(),
+	}
+	stats.Misses = stats.Keys - stats.Hits
+
+	if stats.Batches > 0 {
+		stats.AverageBatchSize = float64(stats.Keys) / float64(stats.Batches)
+	}
+	if stats.Keys > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(stats.Keys)
+	}
+
+	return stats
+}
+
+// getMany fetches every key in one MGET, missing keys come back as empty strings
+func getMany(ctx context.Context, rdb *redis.Client, keys []string) ([]string, error) {
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]string, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			results[i] = s
+		}
+	}
+
+	return results, nil
+}
+
+type batchEntry struct {
+	key   string
+	value []byte
+	ttl   time.Duration
+}
+
+// setMany writes every entry with its own TTL in a single pipelined round trip
+func setMany(ctx context.Context, rdb *redis.Client, entries []batchEntry) error {
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, entry := range entries {
+			pipe.SetEX(ctx, entry.key, entry.value, entry.ttl)
+		}
+		return nil
+	})
+	return err
+}
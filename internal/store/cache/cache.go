@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Backends a Cache can run on, Storage.Backend reports the one in use
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+	BackendNone   = "none"
+)
+
+// Cache stores values of T under string keys. A miss is not an error, Get reports it
+// with ok false and GetMany leaves the key out of the map.
+type Cache[T any] interface {
+	Get(ctx context.Context, key string) (T, bool, error)
+	// Set stores value with the TTL the cache was created with
+	Set(ctx context.Context, key string, value T) error
+	Delete(ctx context.Context, key string) error
+	GetMany(ctx context.Context, keys []string) (map[string]T, error)
+	SetMany(ctx context.Context, entries []Entry[T]) error
+}
+
+// Entry is a value to cache with its own TTL, zero means the TTL of the cache
+type Entry[T any] struct {
+	Key   string
+	Value T
+	TTL   time.Duration
+}
+
+// EntityConfig sizes the cache of one kind of value
+type EntityConfig struct {
+	TTL time.Duration
+	// Size is how many entries the in-memory cache holds before evicting the least
+	// recently used, Redis ignores it
+	Size int
+}
+
+// Config picks the backend and sizes every entity
+type Config struct {
+	Users EntityConfig
+	Feeds EntityConfig
+	// MemoryFallback caches in process memory when Redis is disabled instead of not
+	// caching at all. Evictions then only reach the instance that made them.
+	MemoryFallback bool
+}
+
+// newCache returns the cache of one entity on backend
+func newCache[T any](backend string, rdb *redis.Client, cfg EntityConfig) Cache[T] {
+	switch backend {
+	case BackendRedis:
+		return NewRedisCache[T](rdb, cfg.TTL)
+	case BackendMemory:
+		return NewLRUCache[T](cfg.Size, cfg.TTL)
+	default:
+		return NoopCache[T]{}
+	}
+}
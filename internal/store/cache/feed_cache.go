@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type FeedStore struct {
+	cache Cache[*FeedPage]
+}
+
+// FeedExpTime is kept short because new posts from followed users are not pushed into the cache
+const FeedExpTime = time.Minute
+
+type FeedPage struct {
+	Posts      []*models.Post `json:"posts"`
+	NextCursor string         `json:"next_cursor"`
+}
+
+// Get returns the cached first page of a user's feed, or nil when it is not cached
+func (storage *FeedStore) Get(ctx context.Context, userID int64, limit int) (*FeedPage, error) {
+	page, ok, err := storage.cache.Get(ctx, feedCacheKey(userID, limit))
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (storage *FeedStore) Set(ctx context.Context, userID int64, limit int, page *FeedPage) error {
+	return storage.cache.Set(ctx, feedCacheKey(userID, limit), page)
+}
+
+func feedCacheKey(userID int64, limit int) string {
+	return fmt.Sprintf("feed-%v-%v", userID, limit)
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// LRUCache keeps values in process memory and evicts the least recently used entry once
+// it holds size of them. Values are stored JSON encoded like in Redis, so a caller that
+// modifies what Get returned never changes the cached copy.
+type LRUCache[T any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+func NewLRUCache[T any](size int, ttl time.Duration) *LRUCache[T] {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &LRUCache[T]{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *LRUCache[T]) Get(_ context.Context, key string) (T, bool, error) {
+	var value T
+
+	data, ok := c.lookup(key, time.Now())
+	if !ok {
+		return value, false, nil
+	}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, false, err
+	}
+
+	return value, true, nil
+}
+
+func (c *LRUCache[T]) Set(_ context.Context, key string, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	c.store(key, data, c.ttl, time.Now())
+	return nil
+}
+
+func (c *LRUCache[T]) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	return nil
+}
+
+func (c *LRUCache[T]) GetMany(ctx context.Context, keys []string) (map[string]T, error) {
+	values := make(map[string]T, len(keys))
+	for _, key := range keys {
+		value, ok, err := c.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			values[key] = value
+		}
+	}
+
+	return values, nil
+}
+
+func (c *LRUCache[T]) SetMany(_ context.Context, entries []Entry[T]) error {
+	now := time.Now()
+	for _, entry := range entries {
+		data, err := json.Marshal(entry.Value)
+		if err != nil {
+			return err
+		}
+
+		ttl := entry.TTL
+		if ttl <= 0 {
+			ttl = c.ttl
+		}
+
+		c.store(entry.Key, data, ttl, now)
+	}
+
+	return nil
+}
+
+func (c *LRUCache[T]) lookup(key string, now time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if now.After(entry.expiresAt) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.data, true
+}
+
+func (c *LRUCache[T]) store(key string, data []byte, ttl time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.data = data
+		entry.expiresAt = now.Add(ttl)
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, data: data, expiresAt: now.Add(ttl)})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove expects c.mu to be held
+func (c *LRUCache[T]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,28 @@
+package cache
+
+import "context"
+
+// NoopCache never holds anything, every lookup is a miss. It stands in when caching is
+// off, so callers do not need to check whether a cache exists.
+type NoopCache[T any] struct{}
+
+func (NoopCache[T]) Get(context.Context, string) (T, bool, error) {
+	var value T
+	return value, false, nil
+}
+
+func (NoopCache[T]) Set(context.Context, string, T) error {
+	return nil
+}
+
+func (NoopCache[T]) Delete(context.Context, string) error {
+	return nil
+}
+
+func (NoopCache[T]) GetMany(_ context.Context, keys []string) (map[string]T, error) {
+	return map[string]T{}, nil
+}
+
+func (NoopCache[T]) SetMany(context.Context, []Entry[T]) error {
+	return nil
+}
@@ -1,6 +1,12 @@
 package cache
 
-import "github.com/go-redis/redis/v8"
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
 
 func NewRedisClient(address, password string, db int) *redis.Client {
 	return redis.NewClient(&redis.Options{
@@ -9,3 +15,95 @@ func NewRedisClient(address, password string, db int) *redis.Client {
 		DB:       db,
 	})
 }
+
+// RedisCache keeps JSON encoded values in Redis, shared by every instance. Keys are used
+// as they are, the entity stores already make them unique.
+type RedisCache[T any] struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func NewRedisCache[T any](rdb *redis.Client, ttl time.Duration) *RedisCache[T] {
+	return &RedisCache[T]{rdb: rdb, ttl: ttl}
+}
+
+func (c *RedisCache[T]) Get(ctx context.Context, key string) (T, bool, error) {
+	var value T
+
+	data, err := c.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return value, false, nil
+	} else if err != nil {
+		return value, false, err
+	}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, false, err
+	}
+
+	return value, true, nil
+}
+
+func (c *RedisCache[T]) Set(ctx context.Context, key string, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return c.rdb.SetEX(ctx, key, data, c.ttl).Err()
+}
+
+func (c *RedisCache[T]) Delete(ctx context.Context, key string) error {
+	return c.rdb.Del(ctx, key).Err()
+}
+
+// GetMany reads every key in one MGET
+func (c *RedisCache[T]) GetMany(ctx context.Context, keys []string) (map[string]T, error) {
+	values := make(map[string]T, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	results, err := getMany(ctx, c.rdb, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, data := range results {
+		if data == "" {
+			continue
+		}
+
+		var value T
+		if err := json.Unmarshal([]byte(data), &value); err != nil {
+			return nil, err
+		}
+		values[keys[i]] = value
+	}
+
+	return values, nil
+}
+
+// SetMany writes every entry in a single pipelined round trip
+func (c *RedisCache[T]) SetMany(ctx context.Context, entries []Entry[T]) error {
+	batch := make([]batchEntry, 0, len(entries))
+	for _, entry := range entries {
+		data, err := json.Marshal(entry.Value)
+		if err != nil {
+			return err
+		}
+
+		ttl := entry.TTL
+		if ttl <= 0 {
+			ttl = c.ttl
+		}
+
+		batch = append(batch, batchEntry{key: entry.Key, value: data, ttl: ttl})
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return setMany(ctx, c.rdb, batch)
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"sync"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// RoleStore keeps the roles in process memory. Roles only change through migrations,
+// so entries never expire.
+type RoleStore struct {
+	sync.RWMutex
+	roles map[string]*models.Role
+}
+
+func (storage *RoleStore) Get(name string) (*models.Role, bool) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	role, ok := storage.roles[name]
+	return role, ok
+}
+
+func (storage *RoleStore) Set(role *models.Role) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.roles[role.Name] = role
+}
+
+// SetAll replaces every cached role
+func (storage *RoleStore) SetAll(roles []*models.Role) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.roles = make(map[string]*models.Role, len(roles))
+	for _, role := range roles {
+		storage.roles[role.Name] = role
+	}
+}
@@ -9,14 +9,49 @@ import (
 )
 
 type Storage struct {
-	Users interface {
+	// Backend is where the users and feeds are cached, see the Backend constants
+	Backend string
+	Users   interface {
 		Get(context.Context, int64) (*models.User, error)
 		Set(context.Context, *models.User) error
+		Delete(context.Context, int64) error
+		GetMany(context.Context, []int64) (map[int64]*models.User, error)
+		SetMany(context.Context, []UserEntry) error
+		Stats() BatchStats
+	}
+	Usernames interface {
+		Get(context.Context, string) (int64, bool, error)
+		Set(context.Context, string, int64) error
+		Delete(context.Context, string) error
+	}
+	Feeds interface {
+		Get(ctx context.Context, userID int64, limit int) (*FeedPage, error)
+		Set(ctx context.Context, userID int64, limit int, page *FeedPage) error
+	}
+	Roles interface {
+		Get(name string) (*models.Role, bool)
+		Set(*models.Role)
+		SetAll([]*models.Role)
 	}
 }
 
-func NewRedisStorage(rdb *redis.Client) Storage {
+// NewStorage caches in Redis when rdb is set. Without it the users, usernames and feeds
+// are cached in process memory with cfg.MemoryFallback and not at all otherwise. Roles
+// always live in process memory.
+func NewStorage(rdb *redis.Client, cfg Config) Storage {
+	backend := BackendNone
+	switch {
+	case rdb != nil:
+		backend = BackendRedis
+	case cfg.MemoryFallback:
+		backend = BackendMemory
+	}
+
 	return Storage{
-		Users: &UserStore{rdb: rdb},
+		Backend:   backend,
+		Users:     &UserStore{cache: newCache[*models.User](backend, rdb, cfg.Users)},
+		Usernames: &UsernameStore{cache: newCache[int64](backend, rdb, cfg.Users)},
+		Feeds:     &FeedStore{cache: newCache[*FeedPage](backend, rdb, cfg.Feeds)},
+		Roles:     &RoleStore{roles: make(map[string]*models.Role)},
 	}
 }
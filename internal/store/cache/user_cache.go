@@ -2,55 +2,87 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"time"
 
-	"github.com/go-redis/redis/v8"
-
 	"godsendjoseph.dev/sandbox-api/internal/models"
 )
 
 type UserStore struct {
-	rdb *redis.Client
+	cache   Cache[*models.User]
+	metrics batchMetrics
+}
+
+// UserEntry is a user to cache with its own TTL, zero means the users TTL
+type UserEntry struct {
+	User *models.User
+	TTL  time.Duration
 }
 
 const UserExpTime = time.Minute * 5
 
+// Get returns the cached user, or nil when it is not cached
 func (storage *UserStore) Get(ctx context.Context, userID int64) (*models.User, error) {
-	if storage.rdb == nil {
-		return nil, errors.New("redis client not initialized")
+	user, ok, err := storage.cache.Get(ctx, userCacheKey(userID))
+	if err != nil || !ok {
+		return nil, err
 	}
 
-	cacheKey := fmt.Sprintf("user-%v", userID)
+	return user, nil
+}
 
-	data, err := storage.rdb.Get(ctx, cacheKey).Result()
-	if err == redis.Nil {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
+func (storage *UserStore) Set(ctx context.Context, user *models.User) error {
+	return storage.cache.Set(ctx, userCacheKey(user.ID), user)
+}
+
+func (storage *UserStore) Delete(ctx context.Context, userID int64) error {
+	return storage.cache.Delete(ctx, userCacheKey(userID))
+}
+
+// GetMany looks up several users in a single round trip. Users that are not cached
+// are left out of the map.
+func (storage *UserStore) GetMany(ctx context.Context, userIDs []int64) (map[int64]*models.User, error) {
+	users := make(map[int64]*models.User, len(userIDs))
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = userCacheKey(userID)
 	}
 
-	var user models.User
+	cached, err := storage.cache.GetMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
 
-	if data != "" {
-		err := json.Unmarshal([]byte(data), &user)
-		if err != nil {
-			return nil, err
+	for i, key := range keys {
+		if user, ok := cached[key]; ok {
+			users[userIDs[i]] = user
 		}
 	}
 
-	return &user, nil
-}
+	storage.metrics.record(len(keys), len(users))
 
-func (storage *UserStore) Set(ctx context.Context, user *models.User) error {
-	cacheKey := fmt.Sprintf("user-%v", user.ID)
+	return users, nil
+}
 
-	json, err := json.Marshal(user)
-	if err != nil {
-		return err
+// SetMany caches several users in a single round trip
+func (storage *UserStore) SetMany(ctx context.Context, entries []UserEntry) error {
+	batch := make([]Entry[*models.User], len(entries))
+	for i, entry := range entries {
+		batch[i] = Entry[*models.User]{Key: userCacheKey(entry.User.ID), Value: entry.User, TTL: entry.TTL}
 	}
 
-	return storage.rdb.SetEX(ctx, cacheKey, json, UserExpTime).Err()
+	return storage.cache.SetMany(ctx, batch)
+}
+
+// Stats returns the batch size and hit ratio of GetMany since startup
+func (storage *UserStore) Stats() BatchStats {
+	return storage.metrics.snapshot()
+}
+
+func userCacheKey(userID int64) string {
+	return fmt.Sprintf("user-%v", userID)
 }
@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// UsernameStore maps usernames to the ids of their users. Only taken usernames are
+// cached, a free one could be registered the next moment.
+type UsernameStore struct {
+	cache Cache[int64]
+}
+
+// Get returns the id of the user with username, ok is false when it is not cached
+func (storage *UsernameStore) Get(ctx context.Context, username string) (int64, bool, error) {
+	return storage.cache.Get(ctx, usernameCacheKey(username))
+}
+
+func (storage *UsernameStore) Set(ctx context.Context, username string, userID int64) error {
+	return storage.cache.Set(ctx, usernameCacheKey(username), userID)
+}
+
+func (storage *UsernameStore) Delete(ctx context.Context, username string) error {
+	return storage.cache.Delete(ctx, usernameCacheKey(username))
+}
+
+// usernameCacheKey folds the case, usernames are unique regardless of it
+func usernameCacheKey(username string) string {
+	return fmt.Sprintf("username-%v", strings.ToLower(username))
+}
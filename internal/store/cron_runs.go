@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// cronRunRetention is how long claimed runs are kept, far longer than any clock skew
+// between instances
+const cronRunRetention = time.Hour * 24
+
+type CronRunStore struct {
+	db *sql.DB
+}
+
+// Claim records that instance runs job for the schedule time runAt. It returns false
+// when another instance recorded the same run first.
+func (storage *CronRunStore) Claim(ctx context.Context, job string, runAt time.Time, instance string) (bool, error) {
+	claimed := false
+
+	err := withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		var err error
+		claimed, err = storage.claimQuery(ctx, tx, job, runAt, instance)
+		if err != nil || !claimed {
+			return err
+		}
+
+		return storage.pruneQuery(ctx, tx, job, runAt.Add(-cronRunRetention))
+	})
+
+	return claimed, err
+}
+
+// ================== Private methods ======================//
+func (storage *CronRunStore) claimQuery(ctx context.Context, tx *sql.Tx, job string, runAt time.Time, instance string) (bool, error) {
+	query := `INSERT INTO cron_runs (job_name, run_at, instance) VALUES (?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, query, job, runAt, instance); err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (storage *CronRunStore) pruneQuery(ctx context.Context, tx *sql.Tx, job string, before time.Time) error {
+	query := `DELETE FROM cron_runs WHERE job_name = ? AND run_at < ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, job, before)
+	return err
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// CascadeAction is what happens to a dependent row when its user is deleted
+type CascadeAction string
+
+const (
+	// CascadeDelete removes the dependent rows
+	CascadeDelete CascadeAction = "delete"
+	// CascadeAnonymize scrubs the dependent rows and hands them to DeletionPolicy.ReparentTo
+	CascadeAnonymize CascadeAction = "anonymize"
+	// CascadeReparent hands the dependent rows to DeletionPolicy.ReparentTo untouched
+	CascadeReparent CascadeAction = "reparent"
+)
+
+var ErrInvalidDeletionPolicy = errors.New("invalid user deletion policy")
+
+// DeletionPolicy configures the actions that can vary per deployment
+type DeletionPolicy struct {
+	Posts CascadeAction
+	// ReparentTo is the account (usually a "deleted user" placeholder) that
+	// receives anonymized and re-parented rows
+	ReparentTo int64
+}
+
+func DefaultDeletionPolicy() DeletionPolicy {
+	return DeletionPolicy{Posts: CascadeDelete}
+}
+
+// dependent is a table with a foreign key to users. The foreign keys are
+// ON DELETE RESTRICT, so a table missing from this list makes the delete fail
+// instead of silently cascading or leaving orphans.
+type dependent struct {
+	table  string
+	column string
+	action CascadeAction
+	// scrub holds the columns overwritten by CascadeAnonymize
+	scrub map[string]any
+}
+
+// DeletionService removes a user and resolves every row that references them in one transaction
+type DeletionService struct {
+	db         *sql.DB
+	dependents []dependent
+	reparentTo int64
+}
+
+func NewDeletionService(db *sql.DB, policy DeletionPolicy) (*DeletionService, error) {
+	switch policy.Posts {
+	case CascadeDelete:
+	case CascadeAnonymize, CascadeReparent:
+		if policy.ReparentTo <= 0 {
+			return nil, fmt.Errorf("%w: %s posts needs an account to re-parent them to", ErrInvalidDeletionPolicy, policy.Posts)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown posts action %q", ErrInvalidDeletionPolicy, policy.Posts)
+	}
+
+	return &DeletionService{
+		db: db,
+		dependents: []dependent{
+			{table: "followers", column: "user_id", action: CascadeDelete},
+			{table: "followers", column: "follower_id", action: CascadeDelete},
+			{table: "user_invitations", column: "user_id", action: CascadeDelete},
+			{table: "user_backup_codes", column: "user_id", action: CascadeDelete},
+			{table: "user_devices", column: "user_id", action: CascadeDelete},
+			{table: "support_tickets", column: "user_id", action: CascadeDelete},
+			{table: "notifications", column: "user_id", action: CascadeDelete},
+			// the objects themselves are removed with the user's storage folder
+			{table: "files", column: "user_id", action: CascadeDelete},
+			{
+				table:  "posts",
+				column: "user_id",
+				action: policy.Posts,
+				scrub: map[string]any{
+					"title":   "[deleted]",
+					"content": "[deleted]",
+					"tags":    nil,
+				},
+			},
+		},
+		reparentTo: policy.ReparentTo,
+	}, nil
+}
+
+// DeleteUser applies the cascade action of every dependent and then deletes the user
+func (service *DeletionService) DeleteUser(ctx context.Context, userID int64) error {
+	if service.reparentTo == userID {
+		return fmt.Errorf("%w: cannot delete the account rows are re-parented to", ErrInvalidDeletionPolicy)
+	}
+
+	return withTx(ctx, service.db, func(tx *sql.Tx) error {
+		for _, dependent := range service.dependents {
+			if err := service.resolveQuery(ctx, tx, dependent, userID); err != nil {
+				return fmt.Errorf("resolving %s.%s: %w", dependent.table, dependent.column, err)
+			}
+		}
+
+		return service.deleteUserQuery(ctx, tx, userID)
+	})
+}
+
+// ================== Private methods ======================//
+func (service *DeletionService) resolveQuery(ctx context.Context, tx *sql.Tx, dependent dependent, userID int64) error {
+	var query string
+	var args []any
+
+	switch dependent.action {
+	case CascadeDelete:
+		query = fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, dependent.table, dependent.column)
+		args = []any{userID}
+	case CascadeReparent:
+		query = fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?`, dependent.table, dependent.column, dependent.column)
+		args = []any{service.reparentTo, userID}
+	case CascadeAnonymize:
+		set := fmt.Sprintf("%s = ?", dependent.column)
+		args = []any{service.reparentTo}
+		for column, value := range dependent.scrub {
+			set += fmt.Sprintf(", %s = ?", column)
+			args = append(args, value)
+		}
+		query = fmt.Sprintf(`UPDATE %s SET %s WHERE %s = ?`, dependent.table, set, dependent.column)
+		args = append(args, userID)
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidDeletionPolicy, dependent.action)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+func (service *DeletionService) deleteUserQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM users WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// ErrDeviceReported is returned when a device was reported already
+var ErrDeviceReported = errors.New("device was already reported")
+
+type DeviceStore struct {
+	db *sql.DB
+}
+
+// Record stores a sign-in from device, or bumps last_seen_at when the user signed in from
+// it before, and fills in the rest of device. It reports whether the device is new. The
+// first device of an account is where it signed up, so it does not count as new.
+func (storage *DeviceStore) Record(ctx context.Context, device *models.UserDevice) (bool, error) {
+	newDevice := false
+	err := withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		var err error
+		newDevice, err = storage.recordQuery(ctx, tx, device)
+		return err
+	})
+
+	return newDevice, err
+}
+
+// GetByID returns the device, reported or not
+func (storage *DeviceStore) GetByID(ctx context.Context, id int64) (*models.UserDevice, error) {
+	query := `
+		SELECT id, user_id, ip, user_agent, first_seen_at, last_seen_at, reported_at
+		FROM user_devices
+		WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	device := &models.UserDevice{}
+	var reportedAt sql.NullTime
+	err := conn(ctx, storage.db).QueryRowContext(ctx, query, id).Scan(
+		&device.ID,
+		&device.UserID,
+		&device.IP,
+		&device.UserAgent,
+		&device.FirstSeenAt,
+		&device.LastSeenAt,
+		&reportedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if reportedAt.Valid {
+		device.ReportedAt = &reportedAt.Time
+	}
+
+	return device, nil
+}
+
+// MarkReported records that the user did not sign in from the device. It works once,
+// ErrDeviceReported afterwards.
+func (storage *DeviceStore) MarkReported(ctx context.Context, id int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markReportedQuery(ctx, tx, id)
+	})
+}
+
+// ================== Private methods ======================//
+func (storage *DeviceStore) recordQuery(ctx context.Context, tx *sql.Tx, device *models.UserDevice) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	fingerprint := device.Fingerprint()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_devices
+		SET last_seen_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND fingerprint = ?`,
+		device.UserID, fingerprint,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	newDevice := false
+	if updated == 0 {
+		var known bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM user_devices WHERE user_id = ?)`,
+			device.UserID,
+		).Scan(&known)
+		if err != nil {
+			return false, err
+		}
+
+		// a concurrent sign-in from the same device may have inserted it meanwhile
+		result, err := tx.ExecContext(ctx, `
+			INSERT IGNORE INTO user_devices (user_id, fingerprint, ip, user_agent)
+			VALUES (?, ?, ?, ?)`,
+			device.UserID, fingerprint, device.IP, device.UserAgent,
+		)
+		if err != nil {
+			return false, err
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		newDevice = known && inserted == 1
+	}
+
+	var reportedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, first_seen_at, last_seen_at, reported_at
+		FROM user_devices
+		WHERE user_id = ? AND fingerprint = ?`,
+		device.UserID, fingerprint,
+	).Scan(&device.ID, &device.FirstSeenAt, &device.LastSeenAt, &reportedAt)
+	if err != nil {
+		return false, err
+	}
+
+	device.ReportedAt = nil
+	if reportedAt.Valid {
+		device.ReportedAt = &reportedAt.Time
+	}
+
+	return newDevice, nil
+}
+
+func (storage *DeviceStore) markReportedQuery(ctx context.Context, tx *sql.Tx, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE user_devices SET reported_at = CURRENT_TIMESTAMP WHERE id = ? AND reported_at IS NULL`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrDeviceReported
+	}
+
+	return nil
+}
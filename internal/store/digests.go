@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type DigestStore struct {
+	db *sql.DB
+}
+
+// ListActivity returns the activity since since of up to limit verified users with an id
+// above afterID, in id order, leaving out those who opted out of category. Page through
+// every user by passing the id of the last one as afterID.
+func (storage *DigestStore) ListActivity(ctx context.Context, since time.Time, category string, afterID int64, limit int) ([]*models.UserActivity, error) {
+	query := `
+		SELECT
+			u.id,
+			u.username,
+			u.email,
+			(SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id AND f.created_at >= ?),
+			(SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id),
+			(SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id AND p.created_at >= ?),
+			(SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id)
+		FROM users u
+		LEFT JOIN user_settings s ON s.user_id = u.id
+		WHERE u.id > ? AND u.is_active = TRUE AND u.deleted_at IS NULL
+			AND (s.user_id IS NULL OR FIND_IN_SET(?, s.email_opt_outs) = 0)
+		ORDER BY u.id
+		LIMIT ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, since, since, afterID, category, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := []*models.UserActivity{}
+	for rows.Next() {
+		activity := &models.UserActivity{}
+
+		err := rows.Scan(
+			&activity.UserID,
+			&activity.Username,
+			&activity.Email,
+			&activity.NewFollowers,
+			&activity.Followers,
+			&activity.NewPosts,
+			&activity.Posts,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		activities = append(activities, activity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return activities, nil
+}
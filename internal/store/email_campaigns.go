@@ -0,0 +1,396 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type EmailCampaignStore struct {
+	db *sql.DB
+}
+
+type EmailCampaignQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Status string `json:"status" validate:"omitempty,oneof=sending completed cancelled"`
+}
+
+// Parse reads status from the query string. The page comes from pagination.Parse.
+func (query EmailCampaignQuery) Parse(request *http.Request) (EmailCampaignQuery, error) {
+	values := request.URL.Query()
+
+	query.Status = strings.ToLower(strings.TrimSpace(values.Get("status")))
+
+	return query, nil
+}
+
+// Create saves the campaign and picks its recipients from the audience. A campaign
+// without recipients is completed right away.
+func (storage *EmailCampaignStore) Create(ctx context.Context, campaign *models.EmailCampaign) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		if err := storage.createQuery(ctx, tx, campaign); err != nil {
+			return err
+		}
+
+		total, err := storage.addRecipientsQuery(ctx, tx, campaign)
+		if err != nil {
+			return err
+		}
+
+		if total == 0 {
+			if err := storage.completeQuery(ctx, tx, campaign.ID); err != nil {
+				return err
+			}
+		}
+
+		return storage.getQuery(ctx, tx, campaign)
+	})
+}
+
+func (storage *EmailCampaignStore) GetByID(ctx context.Context, id int64) (*models.EmailCampaign, error) {
+	query := `
+		SELECT ` + emailCampaignColumns + `
+		FROM email_campaigns c
+		LEFT JOIN email_campaign_recipients r ON r.campaign_id = c.id
+		WHERE c.id = ?
+		GROUP BY c.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	campaign, err := scanEmailCampaign(conn(ctx, storage.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return campaign, nil
+}
+
+// List returns a page of the campaigns with their progress, newest first
+func (storage *EmailCampaignStore) List(ctx context.Context, query EmailCampaignQuery) ([]*models.EmailCampaign, error) {
+	sqlQuery := `
+		SELECT ` + emailCampaignColumns + `
+		FROM email_campaigns c
+		LEFT JOIN email_campaign_recipients r ON r.campaign_id = c.id
+		WHERE (? = '' OR c.status = ?)
+		GROUP BY c.id
+		ORDER BY c.id DESC
+		LIMIT ? OFFSET ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, sqlQuery, query.Status, query.Status, query.Limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []*models.EmailCampaign{}
+	for rows.Next() {
+		campaign, err := scanEmailCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		campaigns = append(campaigns, campaign)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return campaigns, nil
+}
+
+// Cancel stops a campaign that is still sending, its pending recipients are not emailed.
+// ErrConflict means the campaign already finished.
+func (storage *EmailCampaignStore) Cancel(ctx context.Context, id int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.cancelQuery(ctx, tx, id)
+	})
+}
+
+// ListPending returns up to limit recipients waiting to be emailed, the oldest campaign first
+func (storage *EmailCampaignStore) ListPending(ctx context.Context, limit int) ([]*models.CampaignRecipient, error) {
+	query := `
+		SELECT r.id, r.campaign_id, r.user_id, r.username, r.email, r.status, COALESCE(r.last_error, '')
+		FROM email_campaign_recipients r
+		JOIN email_campaigns c ON c.id = r.campaign_id
+		WHERE c.status = ? AND r.status = ?
+		ORDER BY r.campaign_id, r.id
+		LIMIT ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, models.CampaignSending, models.RecipientPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []*models.CampaignRecipient{}
+	for rows.Next() {
+		recipient := &models.CampaignRecipient{}
+		var userID sql.NullInt64
+
+		err := rows.Scan(
+			&recipient.ID,
+			&recipient.CampaignID,
+			&userID,
+			&recipient.Username,
+			&recipient.Email,
+			&recipient.Status,
+			&recipient.LastError,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		recipient.UserID = nullableID(userID)
+		recipients = append(recipients, recipient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recipients, nil
+}
+
+// MarkRecipient records that a pending recipient was queued, opted out or failed, lastError
+// is empty unless it failed
+func (storage *EmailCampaignStore) MarkRecipient(ctx context.Context, id int64, status, lastError string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markRecipientQuery(ctx, tx, id, status, lastError)
+	})
+}
+
+// CompleteFinished completes the sending campaigns without pending recipients and returns
+// how many it completed
+func (storage *EmailCampaignStore) CompleteFinished(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE email_campaigns c
+		SET c.status = ?, c.completed_at = CURRENT_TIMESTAMP
+		WHERE c.status = ? AND NOT EXISTS (
+			SELECT 1 FROM email_campaign_recipients r
+			WHERE r.campaign_id = c.id AND r.status = ?
+		)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := conn(ctx, storage.db).ExecContext(ctx, query, models.CampaignCompleted, models.CampaignSending, models.RecipientPending)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ================== Private methods ======================//
+const emailCampaignColumns = `c.id, c.name, c.template, c.subject, c.message, c.audience, c.role, c.status,
+		c.created_by, c.created_at, c.updated_at, c.completed_at,
+		COUNT(r.id),
+		COALESCE(SUM(r.status = 'pending'), 0),
+		COALESCE(SUM(r.status = 'queued'), 0),
+		COALESCE(SUM(r.status = 'failed'), 0),
+		COALESCE(SUM(r.status = 'cancelled'), 0),
+		COALESCE(SUM(r.status = 'opted_out'), 0)`
+
+// campaignErrorLimit matches the width of email_campaign_recipients.last_error
+const campaignErrorLimit = 1000
+
+func scanEmailCampaign(row rowScanner) (*models.EmailCampaign, error) {
+	campaign := &models.EmailCampaign{}
+	var createdBy sql.NullInt64
+	var completedAt sql.NullString
+
+	err := row.Scan(
+		&campaign.ID,
+		&campaign.Name,
+		&campaign.Template,
+		&campaign.Subject,
+		&campaign.Message,
+		&campaign.Audience,
+		&campaign.Role,
+		&campaign.Status,
+		&createdBy,
+		&campaign.CreatedAt,
+		&campaign.UpdatedAt,
+		&completedAt,
+		&campaign.Progress.Total,
+		&campaign.Progress.Pending,
+		&campaign.Progress.Queued,
+		&campaign.Progress.Failed,
+		&campaign.Progress.Cancelled,
+		&campaign.Progress.OptedOut,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign.CreatedBy = nullableID(createdBy)
+	campaign.CompletedAt = completedAt.String
+
+	return campaign, nil
+}
+
+func (storage *EmailCampaignStore) createQuery(ctx context.Context, tx *sql.Tx, campaign *models.EmailCampaign) error {
+	query := `
+		INSERT INTO email_campaigns (name, template, subject, message, audience, role, status, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query,
+		campaign.Name,
+		campaign.Template,
+		campaign.Subject,
+		campaign.Message,
+		campaign.Audience,
+		campaign.Role,
+		models.CampaignSending,
+		actor(ctx),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	campaign.ID = id
+
+	return nil
+}
+
+// addRecipientsQuery copies the users of the audience into the recipients, soft deleted
+// accounts never get a campaign
+func (storage *EmailCampaignStore) addRecipientsQuery(ctx context.Context, tx *sql.Tx, campaign *models.EmailCampaign) (int64, error) {
+	conditions := []string{"users.deleted_at IS NULL"}
+	args := []any{campaign.ID}
+
+	switch campaign.Audience {
+	case models.AudienceVerified:
+		conditions = append(conditions, "users.is_active = TRUE")
+	case models.AudienceRole:
+		conditions = append(conditions, "users.is_active = TRUE", "roles.name = ?")
+		args = append(args, campaign.Role)
+	}
+
+	query := `
+		INSERT INTO email_campaign_recipients (campaign_id, user_id, username, email)
+		SELECT ?, users.id, users.username, users.email
+		FROM users
+		LEFT JOIN roles ON roles.id = users.role_id
+		WHERE ` + strings.Join(conditions, " AND ")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (storage *EmailCampaignStore) getQuery(ctx context.Context, tx *sql.Tx, campaign *models.EmailCampaign) error {
+	query := `
+		SELECT ` + emailCampaignColumns + `
+		FROM email_campaigns c
+		LEFT JOIN email_campaign_recipients r ON r.campaign_id = c.id
+		WHERE c.id = ?
+		GROUP BY c.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	saved, err := scanEmailCampaign(tx.QueryRowContext(ctx, query, campaign.ID))
+	if err != nil {
+		return err
+	}
+
+	*campaign = *saved
+	return nil
+}
+
+func (storage *EmailCampaignStore) completeQuery(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := `UPDATE email_campaigns SET status = ?, completed_at = CURRENT_TIMESTAMP WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, models.CampaignCompleted, id)
+	return err
+}
+
+func (storage *EmailCampaignStore) cancelQuery(ctx context.Context, tx *sql.Tx, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM email_campaigns WHERE id = ? FOR UPDATE`, id).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	if status != models.CampaignSending {
+		return ErrConflict
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE email_campaigns SET status = ?, completed_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		models.CampaignCancelled, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE email_campaign_recipients SET status = ? WHERE campaign_id = ? AND status = ?`,
+		models.RecipientCancelled, id, models.RecipientPending,
+	)
+	return err
+}
+
+func (storage *EmailCampaignStore) markRecipientQuery(ctx context.Context, tx *sql.Tx, id int64, status, lastError string) error {
+	var errorValue sql.NullString
+	if lastError != "" {
+		if len(lastError) > campaignErrorLimit {
+			lastError = lastError[:campaignErrorLimit]
+		}
+		errorValue = sql.NullString{String: lastError, Valid: true}
+	}
+
+	query := `
+		UPDATE email_campaign_recipients
+		SET status = ?, last_error = ?, queued_at = IF(? = 'queued', CURRENT_TIMESTAMP, queued_at)
+		WHERE id = ? AND status = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, status, errorValue, status, id, models.RecipientPending)
+	return err
+}
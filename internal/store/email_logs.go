@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// emailLogResponseLimit keeps a misbehaving provider from filling the table with huge bodies
+const emailLogResponseLimit = 4096
+
+type EmailLogStore struct {
+	db *sql.DB
+}
+
+type EmailLogQuery struct {
+	Limit     int        `json:"limit" validate:"gte=1,lte=100"`
+	Offset    int        `json:"offset" validate:"gte=0"`
+	Sort      string     `json:"sort" validate:"oneof=asc desc"`
+	Status    string     `json:"status" validate:"omitempty,oneof=sent failed sandbox"`
+	Recipient string     `json:"recipient" validate:"max=255"`
+	Template  string     `json:"template" validate:"max=255"`
+	Since     *time.Time `json:"since"`
+	Until     *time.Time `json:"until"`
+}
+
+// Parse reads status, recipient, template, since and until (RFC 3339) from the query
+// string. The page and its order come from pagination.Parse.
+func (query EmailLogQuery) Parse(request *http.Request) (EmailLogQuery, error) {
+	values := request.URL.Query()
+
+	query.Status = strings.ToLower(strings.TrimSpace(values.Get("status")))
+	query.Recipient = strings.TrimSpace(values.Get("recipient"))
+	query.Template = strings.TrimSpace(values.Get("template"))
+
+	for key, target := range map[string]**time.Time{"since": &query.Since, "until": &query.Until} {
+		value := values.Get(key)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, err
+		}
+		*target = &parsed
+	}
+
+	return query, nil
+}
+
+func (storage *EmailLogStore) Create(ctx context.Context, log *models.EmailLog) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, log)
+	})
+}
+
+// List returns a page of email logs, newest first unless sorted ascending
+func (storage *EmailLogStore) List(ctx context.Context, query EmailLogQuery) ([]*models.EmailLog, error) {
+	conditions := []string{"1 = 1"}
+	args := []any{}
+
+	if query.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, query.Status)
+	}
+	if query.Recipient != "" {
+		conditions = append(conditions, "recipient = ?")
+		args = append(args, query.Recipient)
+	}
+	if query.Template != "" {
+		conditions = append(conditions, "template = ?")
+		args = append(args, query.Template)
+	}
+	if query.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, query.Since.UTC())
+	}
+	if query.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, query.Until.UTC())
+	}
+
+	sqlQuery := `
+		SELECT id, provider, template, recipient, subject, status, attempts, COALESCE(provider_response, ''), created_at
+		FROM email_logs
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY created_at ` + sortDirection(query.Sort) + `, id ` + sortDirection(query.Sort) + `
+		LIMIT ? OFFSET ?`
+
+	args = append(args, query.Limit, query.Offset)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []*models.EmailLog{}
+	for rows.Next() {
+		log := &models.EmailLog{}
+		err := rows.Scan(
+			&log.ID,
+			&log.Provider,
+			&log.Template,
+			&log.Recipient,
+			&log.Subject,
+			&log.Status,
+			&log.Attempts,
+			&log.ProviderResponse,
+			&log.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, log)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// ================== Private methods ======================//
+func (storage *EmailLogStore) createQuery(ctx context.Context, tx *sql.Tx, log *models.EmailLog) error {
+	query := `
+		INSERT INTO email_logs (provider, template, recipient, subject, status, attempts, provider_response)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	response := log.ProviderResponse
+	if len(response) > emailLogResponseLimit {
+		response = response[:emailLogResponseLimit]
+	}
+
+	subject := log.Subject
+	if len(subject) > 255 {
+		subject = subject[:255]
+	}
+
+	result, err := tx.ExecContext(ctx, query, log.Provider, log.Template, log.Recipient, subject, log.Status, log.Attempts, response)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	log.ID = id
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FeedQuery is a page of the feed, read with pagination.Parse
+type FeedQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor" validate:"max=200"`
+}
+
+type feedCursor struct {
+	createdAt time.Time
+	id        int64
+}
+
+// encodeFeedCursor turns the last post of a page into an opaque cursor for the next page
+func encodeFeedCursor(post *models.Post) (string, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+
+	raw := fmt.Sprintf("%s|%d", createdAt.UTC().Format(time.RFC3339Nano), post.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw)), nil
+}
+
+func decodeFeedCursor(cursor string) (*feedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	parsedTime, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parsedID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &feedCursor{createdAt: parsedTime, id: parsedID}, nil
+}
+
+// GetFeed returns posts written by the users that userID follows, newest first.
+// It uses keyset pagination on (created_at, id) so deep pages cost the same as the first one,
+// and returns the cursor for the next page, or an empty string on the last page.
+func (storage *PostStore) GetFeed(ctx context.Context, userID int64, query FeedQuery) ([]*models.Post, string, error) {
+	conditions := ""
+	args := []any{userID}
+
+	if query.Cursor != "" {
+		cursor, err := decodeFeedCursor(query.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		conditions = "AND (posts.created_at < ? OR (posts.created_at = ? AND posts.id < ?))"
+		args = append(args, cursor.createdAt, cursor.createdAt, cursor.id)
+	}
+
+	// fetch one extra row to know whether there is a next page
+	args = append(args, query.Limit+1)
+
+	sqlQuery := `
+		SELECT
+			posts.id,
+			posts.title,
+			posts.content,
+			posts.user_id,
+			posts.tags,
+			posts.created_at,
+			posts.updated_at,
+			users.id,
+			users.first_name,
+			users.last_name,
+			users.username,
+			COALESCE(user_settings.private_profile, FALSE)
+		FROM followers
+		JOIN posts ON posts.user_id = followers.user_id
+		JOIN users ON users.id = posts.user_id
+		LEFT JOIN user_settings ON user_settings.user_id = users.id
+		WHERE followers.follower_id = ? ` + conditions + `
+		ORDER BY posts.created_at DESC, posts.id DESC
+		LIMIT ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := readDB(ctx, storage.db, storage.replicas).QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	posts := []*models.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, "", err
+		}
+
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(posts) <= query.Limit {
+		return posts, "", nil
+	}
+
+	posts = posts[:query.Limit]
+	nextCursor, err := encodeFeedCursor(posts[len(posts)-1])
+	if err != nil {
+		return nil, "", err
+	}
+
+	return posts, nextCursor, nil
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// fileKeyBatchSize bounds the IN list of ExistingKeys
+const fileKeyBatchSize = 500
+
+type FileStore struct {
+	db *sql.DB
+}
+
+// Create records an upload, a second row for the same key is ErrConflict
+func (storage *FileStore) Create(ctx context.Context, file *models.File) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, file)
+	})
+}
+
+// MarkActive confirms a pending upload once its object exists, with the size found in storage
+func (storage *FileStore) MarkActive(ctx context.Context, key string, size int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markActiveQuery(ctx, tx, key, size)
+	})
+}
+
+// DeleteByKey forgets an object, ErrNotFound when it was never recorded
+func (storage *FileStore) DeleteByKey(ctx context.Context, key string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.deleteByKeyQuery(ctx, tx, key)
+	})
+}
+
+// ListPendingBefore returns the uploads still pending that were started before cutoff
+func (storage *FileStore) ListPendingBefore(ctx context.Context, cutoff time.Time) ([]*models.File, error) {
+	query := `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE status = ? AND created_at < ?
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, models.FilePending, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []*models.File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// ExistingKeys reports which of keys have a row, in any status
+func (storage *FileStore) ExistingKeys(ctx context.Context, keys []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(keys))
+
+	for start := 0; start < len(keys); start += fileKeyBatchSize {
+		batch := keys[start:min(start+fileKeyBatchSize, len(keys))]
+		if err := storage.existingKeysQuery(ctx, batch, existing); err != nil {
+			return nil, err
+		}
+	}
+
+	return existing, nil
+}
+
+// ================== Private methods ======================//
+const fileColumns = `id, storage_key, user_id, size, content_type, COALESCE(checksum, ''), status, created_at, updated_at`
+
+func scanFile(row rowScanner) (*models.File, error) {
+	file := &models.File{}
+	var userID sql.NullInt64
+
+	err := row.Scan(
+		&file.ID,
+		&file.Key,
+		&userID,
+		&file.Size,
+		&file.ContentType,
+		&file.Checksum,
+		&file.Status,
+		&file.CreatedAt,
+		&file.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID.Valid {
+		file.UserID = &userID.Int64
+	}
+
+	return file, nil
+}
+
+func (storage *FileStore) createQuery(ctx context.Context, tx *sql.Tx, file *models.File) error {
+	query := `
+		INSERT INTO files (storage_key, user_id, size, content_type, checksum, status)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if file.Status == "" {
+		file.Status = models.FileActive
+	}
+
+	result, err := tx.ExecContext(ctx, query, file.Key, file.UserID, file.Size, file.ContentType, file.Checksum, file.Status)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			return ErrConflict
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	file.ID = id
+
+	return tx.QueryRowContext(ctx,
+		`SELECT created_at, updated_at FROM files WHERE id = ?`,
+		file.ID,
+	).Scan(&file.CreatedAt, &file.UpdatedAt)
+}
+
+func (storage *FileStore) markActiveQuery(ctx context.Context, tx *sql.Tx, key string, size int64) error {
+	query := `UPDATE files SET status = ?, size = ? WHERE storage_key = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, models.FileActive, size, key)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (storage *FileStore) deleteByKeyQuery(ctx context.Context, tx *sql.Tx, key string) error {
+	query := `DELETE FROM files WHERE storage_key = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, key)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (storage *FileStore) existingKeysQuery(ctx context.Context, keys []string, existing map[string]bool) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	query := `SELECT storage_key FROM files WHERE storage_key IN (?` + strings.Repeat(", ?", len(keys)-1) + `)`
+
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return err
+		}
+		existing[key] = true
+	}
+
+	return rows.Err()
+}
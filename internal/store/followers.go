@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type FollowerStore struct {
+	db *sql.DB
+}
+
+// Follow makes followerID follow userID
+func (storage *FollowerStore) Follow(ctx context.Context, userID, followerID int64) error {
+	query := `INSERT INTO followers (user_id, follower_id) VALUES (?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := conn(ctx, storage.db).ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			return ErrConflict
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Unfollow removes followerID from the followers of userID
+func (storage *FollowerStore) Unfollow(ctx context.Context, userID, followerID int64) error {
+	query := `DELETE FROM followers WHERE user_id = ? AND follower_id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := conn(ctx, storage.db).ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Counts returns how many users follow userID and how many users userID follows
+func (storage *FollowerStore) Counts(ctx context.Context, userID int64) (int64, int64, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM followers WHERE user_id = ?) AS followers_count,
+			(SELECT COUNT(*) FROM followers WHERE follower_id = ?) AS following_count`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var followers, following int64
+	err := conn(ctx, storage.db).QueryRowContext(ctx, query, userID, userID).Scan(&followers, &following)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return followers, following, nil
+}
+
+// FollowerIDs returns the IDs of the users following userID
+func (storage *FollowerStore) FollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `SELECT follower_id FROM followers WHERE user_id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
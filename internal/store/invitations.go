@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// ErrInvitationUsed is returned when an invitation was accepted already or expired meanwhile
+var ErrInvitationUsed = errors.New("invitation was already used")
+
+type InvitationStore struct {
+	db *sql.DB
+}
+
+// Create stores invitation and fills in its id and created_at
+func (storage *InvitationStore) Create(ctx context.Context, invitation *models.Invitation) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, invitation)
+	})
+}
+
+// GetByID returns the invitation with its role, accepted or not
+func (storage *InvitationStore) GetByID(ctx context.Context, id int64) (*models.Invitation, error) {
+	query := `
+		SELECT
+			invitations.id,
+			invitations.email,
+			invitations.normalized_email,
+			invitations.role_id,
+			invitations.invited_by,
+			invitations.expires_at,
+			invitations.accepted_at,
+			invitations.accepted_by,
+			invitations.created_at,
+			roles.id,
+			roles.name,
+			roles.level,
+			roles.description
+		FROM invitations
+		JOIN roles ON roles.id = invitations.role_id
+		WHERE invitations.id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	invitation := &models.Invitation{}
+	var invitedBy, acceptedBy sql.NullInt64
+	var acceptedAt sql.NullTime
+	err := conn(ctx, storage.db).QueryRowContext(ctx, query, id).Scan(
+		&invitation.ID,
+		&invitation.Email,
+		&invitation.NormalizedEmail,
+		&invitation.RoleID,
+		&invitedBy,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&acceptedBy,
+		&invitation.CreatedAt,
+		&invitation.Role.ID,
+		&invitation.Role.Name,
+		&invitation.Role.Level,
+		&invitation.Role.Description,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	invitation.InvitedBy, invitation.AcceptedBy = nullableID(invitedBy), nullableID(acceptedBy)
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+
+	return invitation, nil
+}
+
+// Accept marks the invitation used by userID. Run it in the transaction that creates the
+// user, ErrInvitationUsed then rolls the registration back when someone else was faster.
+func (storage *InvitationStore) Accept(ctx context.Context, id, userID int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.acceptQuery(ctx, tx, id, userID)
+	})
+}
+
+// ================== Private methods ======================//
+func (storage *InvitationStore) createQuery(ctx context.Context, tx *sql.Tx, invitation *models.Invitation) error {
+	query := `
+		INSERT INTO invitations (email, normalized_email, role_id, invited_by, expires_at)
+		VALUES (?, ?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	invitation.NormalizedEmail = normalizeEmail(invitation.Email)
+
+	result, err := tx.ExecContext(ctx, query,
+		invitation.Email,
+		invitation.NormalizedEmail,
+		invitation.RoleID,
+		invitation.InvitedBy,
+		invitation.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	invitation.ID = id
+
+	return tx.QueryRowContext(ctx,
+		`SELECT created_at FROM invitations WHERE id = ?`,
+		invitation.ID,
+	).Scan(&invitation.CreatedAt)
+}
+
+func (storage *InvitationStore) acceptQuery(ctx context.Context, tx *sql.Tx, id, userID int64) error {
+	query := `
+		UPDATE invitations
+		SET accepted_at = CURRENT_TIMESTAMP, accepted_by = ?
+		WHERE id = ? AND accepted_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrInvitationUsed
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// jobErrorLimit matches the width of jobs.last_error
+const jobErrorLimit = 1000
+
+// JobStore is the queue of the background jobs when JOBS_BACKEND is db
+type JobStore struct {
+	db *sql.DB
+}
+
+// Enqueue stores a pending job, due at job.RunAt
+func (storage *JobStore) Enqueue(ctx context.Context, job *models.Job) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.enqueueQuery(ctx, tx, job)
+	})
+}
+
+// ClaimDue leases up to limit due jobs to token, the highest priority first, and counts
+// the attempt. A job whose lease ran out, because the instance running it died, is due again.
+func (storage *JobStore) ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.Job, error) {
+	err := withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.claimDueQuery(ctx, tx, token, limit, lease)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, job_id, name, priority, payload, status, attempts, max_attempts, run_at,
+			   COALESCE(last_error, ''), created_at
+		FROM jobs
+		WHERE locked_by = ? AND status = ?
+		ORDER BY priority DESC, id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, token, models.JobRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*models.Job{}
+	for rows.Next() {
+		job := &models.Job{}
+		var payload []byte
+
+		err := rows.Scan(
+			&job.ID,
+			&job.JobID,
+			&job.Name,
+			&job.Priority,
+			&payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		job.Payload = payload
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// MarkDone deletes a job that succeeded
+func (storage *JobStore) MarkDone(ctx context.Context, id int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markDoneQuery(ctx, tx, id)
+	})
+}
+
+// MarkFailed records a failed attempt. The job is retried after retryIn, or kept as failed
+// when retryIn is zero.
+func (storage *JobStore) MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markFailedQuery(ctx, tx, id, lastError, retryIn)
+	})
+}
+
+// CountByStatus counts the jobs by status, a status without jobs is missing
+func (storage *JobStore) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	query := `SELECT status, COUNT(*) FROM jobs GROUP BY status`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{}
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// ================== Private methods ======================//
+
+func (storage *JobStore) enqueueQuery(ctx context.Context, tx *sql.Tx, job *models.Job) error {
+	query := `
+		INSERT INTO jobs (job_id, name, priority, payload, max_attempts, run_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, job.JobID, job.Name, job.Priority, []byte(job.Payload), job.MaxAttempts, job.RunAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	job.ID = id
+	job.Status = models.JobPending
+
+	return nil
+}
+
+func (storage *JobStore) claimDueQuery(ctx context.Context, tx *sql.Tx, token string, limit int, lease time.Duration) error {
+	// run_at doubles as the lease expiry while a job is running
+	query := `UPDATE jobs
+			  SET status = ?, locked_by = ?, attempts = attempts + 1,
+				  run_at = DATE_ADD(CURRENT_TIMESTAMP(3), INTERVAL ? SECOND)
+			  WHERE status IN (?, ?) AND run_at <= CURRENT_TIMESTAMP(3)
+			  ORDER BY priority DESC, run_at
+			  LIMIT ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query,
+		models.JobRunning, token, int(lease.Seconds()),
+		models.JobPending, models.JobRunning,
+		limit,
+	)
+	return err
+}
+
+func (storage *JobStore) markDoneQuery(ctx context.Context, tx *sql.Tx, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM jobs WHERE id = ?`, id)
+	return err
+}
+
+func (storage *JobStore) markFailedQuery(ctx context.Context, tx *sql.Tx, id int64, lastError string, retryIn time.Duration) error {
+	if len(lastError) > jobErrorLimit {
+		lastError = lastError[:jobErrorLimit]
+	}
+
+	status := models.JobPending
+	if retryIn <= 0 {
+		status = models.JobFailed
+	}
+
+	query := `UPDATE jobs
+			  SET status = ?, last_error = ?, locked_by = NULL,
+				  run_at = DATE_ADD(CURRENT_TIMESTAMP(3), INTERVAL ? MICROSECOND)
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, status, lastError, retryIn.Microseconds(), id)
+	return err
+}
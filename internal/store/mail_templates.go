@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// MailTemplateStore keeps every version of the edited email templates, a version is never
+// changed once saved so older copy can be brought back
+type MailTemplateStore struct {
+	db *sql.DB
+}
+
+// Create saves content as the next version of the template and makes it the active one
+func (storage *MailTemplateStore) Create(ctx context.Context, mailTemplate *models.MailTemplate) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, mailTemplate)
+	})
+}
+
+// ListVersions returns every version of a template, newest first
+func (storage *MailTemplateStore) ListVersions(ctx context.Context, name string) ([]*models.MailTemplate, error) {
+	query := `
+		SELECT ` + mailTemplateColumns + `
+		FROM mail_templates
+		WHERE name = ?
+		ORDER BY version DESC`
+
+	return storage.list(ctx, query, name)
+}
+
+// ListActive returns the active version of every edited template
+func (storage *MailTemplateStore) ListActive(ctx context.Context) ([]*models.MailTemplate, error) {
+	query := `
+		SELECT ` + mailTemplateColumns + `
+		FROM mail_templates
+		WHERE active = TRUE
+		ORDER BY name`
+
+	return storage.list(ctx, query)
+}
+
+// Activate makes version the one that is sent, 0 goes back to the embedded template
+func (storage *MailTemplateStore) Activate(ctx context.Context, name string, version int) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.activateQuery(ctx, tx, name, version)
+	})
+}
+
+// ================== Private methods ======================//
+const mailTemplateColumns = `id, name, version, content, active, created_by, created_at`
+
+func scanMailTemplate(row rowScanner) (*models.MailTemplate, error) {
+	mailTemplate := &models.MailTemplate{}
+	var createdBy sql.NullInt64
+
+	err := row.Scan(
+		&mailTemplate.ID,
+		&mailTemplate.Name,
+		&mailTemplate.Version,
+		&mailTemplate.Content,
+		&mailTemplate.Active,
+		&createdBy,
+		&mailTemplate.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mailTemplate.CreatedBy = nullableID(createdBy)
+
+	return mailTemplate, nil
+}
+
+func (storage *MailTemplateStore) list(ctx context.Context, query string, args ...any) ([]*models.MailTemplate, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*models.MailTemplate{}
+	for rows.Next() {
+		mailTemplate, err := scanMailTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, mailTemplate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+func (storage *MailTemplateStore) createQuery(ctx context.Context, tx *sql.Tx, mailTemplate *models.MailTemplate) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// the row lock keeps two admins saving at once from picking the same version
+	var version int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM mail_templates WHERE name = ? FOR UPDATE`,
+		mailTemplate.Name,
+	).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE mail_templates SET active = FALSE WHERE name = ?`, mailTemplate.Name); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO mail_templates (name, version, content, active, created_by) VALUES (?, ?, ?, TRUE, ?)`,
+		mailTemplate.Name, version+1, mailTemplate.Content, actor(ctx),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	saved, err := scanMailTemplate(tx.QueryRowContext(ctx,
+		`SELECT `+mailTemplateColumns+` FROM mail_templates WHERE id = ?`,
+		id,
+	))
+	if err != nil {
+		return err
+	}
+
+	*mailTemplate = *saved
+	return nil
+}
+
+func (storage *MailTemplateStore) activateQuery(ctx context.Context, tx *sql.Tx, name string, version int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if version != 0 {
+		var exists bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM mail_templates WHERE name = ? AND version = ?)`,
+			name, version,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE mail_templates SET active = (version = ?) WHERE name = ?`, version, name)
+	return err
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+type NotificationQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=100"`
+	Offset int `json:"offset" validate:"gte=0"`
+	// Unread leaves out the notifications already read
+	Unread bool `json:"unread"`
+}
+
+// Parse reads unread from the query string, keeping the current value when it is not
+// present. The page comes from pagination.Parse.
+func (query NotificationQuery) Parse(request *http.Request) (NotificationQuery, error) {
+	values := request.URL.Query()
+
+	unread := values.Get("unread")
+	if unread != "" {
+		parsed, err := strconv.ParseBool(unread)
+		if err != nil {
+			return query, err
+		}
+		query.Unread = parsed
+	}
+
+	return query, nil
+}
+
+func (storage *NotificationStore) Create(ctx context.Context, notification *models.Notification) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, notification)
+	})
+}
+
+// List returns a page of the notifications of userID, newest first
+func (storage *NotificationStore) List(ctx context.Context, userID int64, query NotificationQuery) ([]*models.Notification, error) {
+	sqlQuery := `
+		SELECT id, user_id, actor_id, type, data, read_at, created_at
+		FROM notifications
+		WHERE user_id = ? AND (? = FALSE OR read_at IS NULL)
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, sqlQuery, userID, query.Unread, query.Limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*models.Notification{}
+	for rows.Next() {
+		notification := &models.Notification{}
+		var actorID sql.NullInt64
+		var readAt sql.NullTime
+		var data []byte
+
+		err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&actorID,
+			&notification.Type,
+			&data,
+			&readAt,
+			&notification.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		notification.Data = data
+		if actorID.Valid {
+			notification.ActorID = &actorID.Int64
+		}
+		if readAt.Valid {
+			notification.ReadAt = &readAt.Time
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// CountUnread returns how many notifications of userID are not read yet
+func (storage *NotificationStore) CountUnread(ctx context.Context, userID int64) (int64, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int64
+	err := conn(ctx, storage.db).QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks one notification of userID read, ErrNotFound when it belongs to
+// someone else. Marking it again keeps the first read time.
+func (storage *NotificationStore) MarkRead(ctx context.Context, userID, id int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markReadQuery(ctx, tx, userID, id)
+	})
+}
+
+// MarkAllRead marks every notification of userID read and returns how many were unread
+func (storage *NotificationStore) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	var marked int64
+
+	err := withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		var err error
+		marked, err = storage.markAllReadQuery(ctx, tx, userID)
+		return err
+	})
+
+	return marked, err
+}
+
+// ================== Private methods ======================//
+func (storage *NotificationStore) createQuery(ctx context.Context, tx *sql.Tx, notification *models.Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, data)
+		VALUES (?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	data := []byte(notification.Data)
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+
+	result, err := tx.ExecContext(ctx, query, notification.UserID, notification.ActorID, notification.Type, data)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	notification.ID = id
+
+	return tx.QueryRowContext(ctx,
+		`SELECT created_at FROM notifications WHERE id = ?`,
+		notification.ID,
+	).Scan(&notification.CreatedAt)
+}
+
+func (storage *NotificationStore) markReadQuery(ctx context.Context, tx *sql.Tx, userID, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var exists bool
+	err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM notifications WHERE id = ? AND user_id = ?)`,
+		id, userID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	query := `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE id = ? AND read_at IS NULL`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	return err
+}
+
+func (storage *NotificationStore) markAllReadQuery(ctx context.Context, tx *sql.Tx, userID int64) (int64, error) {
+	query := `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// outboxErrorLimit matches the width of outbox.last_error
+const outboxErrorLimit = 1000
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// Create writes a pending message. Call it with the context of WithTransaction, so the
+// message exists only if the change that causes it is committed.
+func (storage *OutboxStore) Create(ctx context.Context, message *models.OutboxMessage) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, message)
+	})
+}
+
+// ClaimDue leases up to limit due messages to token and counts the attempt. A message
+// whose lease ran out, because the instance sending it died, is due again.
+func (storage *OutboxStore) ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	err := withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.claimDueQuery(ctx, tx, token, limit, lease)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, kind, payload, status, attempts, available_at, COALESCE(last_error, ''), created_at
+		FROM outbox
+		WHERE locked_by = ? AND status = ?
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, token, models.OutboxSending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*models.OutboxMessage{}
+	for rows.Next() {
+		message := &models.OutboxMessage{}
+		var payload []byte
+
+		err := rows.Scan(
+			&message.ID,
+			&message.Kind,
+			&payload,
+			&message.Status,
+			&message.Attempts,
+			&message.AvailableAt,
+			&message.LastError,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		message.Payload = payload
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Delete removes a message that was handled
+func (storage *OutboxStore) Delete(ctx context.Context, id int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.deleteQuery(ctx, tx, id)
+	})
+}
+
+// MarkFailed records a failed attempt. The message is retried after retryIn, or kept as
+// failed when retryIn is zero.
+func (storage *OutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markFailedQuery(ctx, tx, id, lastError, retryIn)
+	})
+}
+
+// ================== Private methods ======================//
+
+func (storage *OutboxStore) createQuery(ctx context.Context, tx *sql.Tx, message *models.OutboxMessage) error {
+	query := `INSERT INTO outbox (kind, payload) VALUES (?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, message.Kind, []byte(message.Payload))
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	message.ID = id
+	message.Status = models.OutboxPending
+
+	return nil
+}
+
+func (storage *OutboxStore) claimDueQuery(ctx context.Context, tx *sql.Tx, token string, limit int, lease time.Duration) error {
+	// available_at doubles as the lease expiry while a message is being sent
+	query := `UPDATE outbox
+			  SET status = ?, locked_by = ?, attempts = attempts + 1,
+				  available_at = DATE_ADD(CURRENT_TIMESTAMP(3), INTERVAL ? SECOND)
+			  WHERE status IN (?, ?) AND available_at <= CURRENT_TIMESTAMP(3)
+			  ORDER BY id
+			  LIMIT ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query,
+		models.OutboxSending, token, int(lease.Seconds()),
+		models.OutboxPending, models.OutboxSending,
+		limit,
+	)
+	return err
+}
+
+func (storage *OutboxStore) deleteQuery(ctx context.Context, tx *sql.Tx, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id = ?`, id)
+	return err
+}
+
+func (storage *OutboxStore) markFailedQuery(ctx context.Context, tx *sql.Tx, id int64, lastError string, retryIn time.Duration) error {
+	if len(lastError) > outboxErrorLimit {
+		lastError = lastError[:outboxErrorLimit]
+	}
+
+	status := models.OutboxPending
+	if retryIn <= 0 {
+		status = models.OutboxFailed
+	}
+
+	query := `UPDATE outbox
+			  SET status = ?, last_error = ?, locked_by = NULL,
+				  available_at = DATE_ADD(CURRENT_TIMESTAMP(3), INTERVAL ? SECOND)
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, status, lastError, int(retryIn.Seconds()), id)
+	return err
+}
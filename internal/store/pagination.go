@@ -0,0 +1,52 @@
+package store
+
+import (
+	"net/http"
+	"strings"
+)
+
+type PaginatedQuery struct {
+	Limit  int      `json:"limit" validate:"gte=1,lte=100"`
+	Offset int      `json:"offset" validate:"gte=0"`
+	Sort   string   `json:"sort" validate:"oneof=asc desc"`
+	Search string   `json:"search" validate:"max=100"`
+	Tags   []string `json:"tags" validate:"max=5"`
+}
+
+// Parse reads search and tags from the query string, keeping the current values for
+// anything that is not present. The page and its order come from pagination.Parse.
+func (query PaginatedQuery) Parse(request *http.Request) (PaginatedQuery, error) {
+	values := request.URL.Query()
+
+	search := values.Get("search")
+	if search != "" {
+		query.Search = strings.TrimSpace(search)
+	}
+
+	tags := values.Get("tags")
+	if tags != "" {
+		query.Tags = []string{}
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				query.Tags = append(query.Tags, tag)
+			}
+		}
+	}
+
+	return query, nil
+}
+
+// UserListQuery is a page of users. The search matches usernames, and emails only when
+// SearchEmail is set, which the handlers keep for admins.
+type UserListQuery struct {
+	PaginatedQuery
+	SearchEmail bool
+}
+
+// likeEscaper escapes the LIKE wildcards of user input, for conditions written with ESCAPE '\\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern is the LIKE pattern matching values that contain search as it is typed
+func containsPattern(search string) string {
+	return "%" + likeEscaper.Replace(search) + "%"
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type PostStore struct {
+	db       *sql.DB
+	replicas *Replicas
+}
+
+func (storage *PostStore) Create(ctx context.Context, post *models.Post) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, post)
+	})
+}
+
+func (storage *PostStore) GetByID(ctx context.Context, id int64) (*models.Post, error) {
+	query := `
+		SELECT
+			posts.id,
+			posts.title,
+			posts.content,
+			posts.user_id,
+			posts.tags,
+			posts.created_at,
+			posts.updated_at,
+			users.id,
+			users.first_name,
+			users.last_name,
+			users.username,
+			COALESCE(user_settings.private_profile, FALSE)
+		FROM posts
+		JOIN users ON posts.user_id = users.id
+		LEFT JOIN user_settings ON user_settings.user_id = users.id
+		WHERE posts.id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	row := readDB(ctx, storage.db, storage.replicas).QueryRowContext(ctx, query, id)
+
+	post, err := scanPost(row)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return post, nil
+}
+
+// List returns a page of posts, optionally filtered by a search term on title/content and by tags.
+// A post matches the tag filter when it has at least one of the requested tags.
+func (storage *PostStore) List(ctx context.Context, query PaginatedQuery) ([]*models.Post, error) {
+	conditions := []string{"(? = '' OR posts.title LIKE ? OR posts.content LIKE ?)"}
+	search := "%" + query.Search + "%"
+	args := []any{query.Search, search, search}
+
+	if len(query.Tags) > 0 {
+		tagConditions := make([]string, len(query.Tags))
+		for i, tag := range query.Tags {
+			tagConditions[i] = "FIND_IN_SET(?, posts.tags)"
+			args = append(args, tag)
+		}
+		conditions = append(conditions, "("+strings.Join(tagConditions, " OR ")+")")
+	}
+
+	sqlQuery := `
+		SELECT
+			posts.id,
+			posts.title,
+			posts.content,
+			posts.user_id,
+			posts.tags,
+			posts.created_at,
+			posts.updated_at,
+			users.id,
+			users.first_name,
+			users.last_name,
+			users.username,
+			COALESCE(user_settings.private_profile, FALSE)
+		FROM posts
+		JOIN users ON posts.user_id = users.id
+		LEFT JOIN user_settings ON user_settings.user_id = users.id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY posts.created_at ` + sortDirection(query.Sort) + `, posts.id ` + sortDirection(query.Sort) + `
+		LIMIT ? OFFSET ?`
+
+	args = append(args, query.Limit, query.Offset)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := readDB(ctx, storage.db, storage.replicas).QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*models.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (storage *PostStore) Update(ctx context.Context, post *models.Post) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.updateQuery(ctx, tx, post)
+	})
+}
+
+func (storage *PostStore) Delete(ctx context.Context, postID int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.deleteQuery(ctx, tx, postID)
+	})
+}
+
+// ================== Private methods ======================//
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPost(row rowScanner) (*models.Post, error) {
+	post := &models.Post{User: &models.User{}}
+
+	err := row.Scan(
+		&post.ID,
+		&post.Title,
+		&post.Content,
+		&post.UserID,
+		&post.Tags,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.User.ID,
+		&post.User.FirstName,
+		&post.User.LastName,
+		&post.User.Username,
+		&post.User.PrivateProfile,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+func (storage *PostStore) createQuery(ctx context.Context, tx *sql.Tx, post *models.Post) error {
+	query := `INSERT INTO posts (title, content, user_id, tags) VALUES (?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, post.Title, post.Content, post.UserID, post.Tags)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	post.ID = id
+
+	return tx.QueryRowContext(
+		ctx,
+		`SELECT created_at, updated_at FROM posts WHERE id = ?`,
+		id,
+	).Scan(&post.CreatedAt, &post.UpdatedAt)
+}
+
+func (storage *PostStore) updateQuery(ctx context.Context, tx *sql.Tx, post *models.Post) error {
+	query := `UPDATE posts
+			  SET title = ?, content = ?, tags = ?
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, post.Title, post.Content, post.Tags, post.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports 0 rows when nothing changed, so confirm the post still exists
+	if rows == 0 {
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM posts WHERE id = ?)`, post.ID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+
+	return tx.QueryRowContext(
+		ctx,
+		`SELECT updated_at FROM posts WHERE id = ?`,
+		post.ID,
+	).Scan(&post.UpdatedAt)
+}
+
+func (storage *PostStore) deleteQuery(ctx context.Context, tx *sql.Tx, postID int64) error {
+	query := `DELETE FROM posts WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, postID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
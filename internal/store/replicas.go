@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type primaryKey struct{}
+
+// ContextWithPrimary makes the reads run with ctx go to the primary. Flows that read what
+// they have just written, such as checking an OTP sent moments ago, cannot wait for a
+// replica to catch up.
+func ContextWithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// Replicas spreads the read-only queries over the read replicas in turn. A replica that fails
+// its health check is skipped until it answers again, and reads fall back to the primary
+// when none is left. A nil *Replicas reads from the primary.
+type Replicas struct {
+	primary  *sql.DB
+	replicas []*sql.DB
+	// healthy is false until a replica answered its first check
+	healthy []atomic.Bool
+	next    atomic.Uint64
+
+	// onChange is told when a replica leaves or rejoins the rotation
+	onChange func(index int, healthy bool, err error)
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewReplicas(primary *sql.DB, replicas []*sql.DB, onChange func(index int, healthy bool, err error)) *Replicas {
+	return &Replicas{
+		primary:  primary,
+		replicas: replicas,
+		healthy:  make([]atomic.Bool, len(replicas)),
+		onChange: onChange,
+	}
+}
+
+// reader is the database the read-only queries of ctx run on
+func (set *Replicas) reader(ctx context.Context) *sql.DB {
+	if set == nil || len(set.replicas) == 0 {
+		return nil
+	}
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary {
+		return set.primary
+	}
+
+	start := set.next.Add(1)
+	for i := range set.replicas {
+		index := (start + uint64(i)) % uint64(len(set.replicas))
+		if set.healthy[index].Load() {
+			return set.replicas[index]
+		}
+	}
+
+	return set.primary
+}
+
+// Healthy counts the replicas that answered their last health check
+func (set *Replicas) Healthy() int {
+	if set == nil {
+		return 0
+	}
+
+	count := 0
+	for i := range set.healthy {
+		if set.healthy[i].Load() {
+			count++
+		}
+	}
+	return count
+}
+
+// Start checks the replicas now and then every interval until Stop, taking the ones that do
+// not answer out of rotation and putting them back once they do
+func (set *Replicas) Start(interval time.Duration) {
+	if set == nil || len(set.replicas) == 0 || set.stop != nil {
+		return
+	}
+
+	set.check()
+
+	set.stop = make(chan struct{})
+	set.wg.Add(1)
+	go func() {
+		defer set.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-set.stop:
+				return
+			case <-ticker.C:
+				set.check()
+			}
+		}
+	}()
+}
+
+func (set *Replicas) Stop() {
+	if set == nil || set.stop == nil {
+		return
+	}
+
+	close(set.stop)
+	set.wg.Wait()
+	set.stop = nil
+}
+
+func (set *Replicas) check() {
+	for i, replica := range set.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), QueryTimeoutDuration)
+		err := replica.PingContext(ctx)
+		cancel()
+
+		healthy := err == nil
+		if set.healthy[i].Swap(healthy) != healthy && set.onChange != nil {
+			set.onChange(i, healthy, err)
+		}
+	}
+}
+
+// Close closes the replica pools, the primary is left to its owner
+func (set *Replicas) Close() error {
+	if set == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, replica := range set.replicas {
+		errs = append(errs, replica.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// readDB is where the reads of ctx go: its transaction, a replica, or db when there are no
+// replicas
+func readDB(ctx context.Context, db *sql.DB, replicas *Replicas) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	if reader := replicas.reader(ctx); reader != nil {
+		return reader
+	}
+	return db
+}
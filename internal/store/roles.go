@@ -18,7 +18,7 @@ func (storage *RoleStore) GetByName(ctx context.Context, slug string) (*models.R
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	row := storage.db.QueryRowContext(ctx, query, slug)
+	row := conn(ctx, storage.db).QueryRowContext(ctx, query, slug)
 
 	role := &models.Role{}
 	err := row.Scan(
@@ -38,3 +38,38 @@ func (storage *RoleStore) GetByName(ctx context.Context, slug string) (*models.R
 
 	return role, nil
 }
+
+func (storage *RoleStore) List(ctx context.Context) ([]*models.Role, error) {
+	query := `SELECT id, name, description, level FROM roles ORDER BY level`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*models.Role{}
+	for rows.Next() {
+		role := &models.Role{}
+		err := rows.Scan(
+			&role.ID,
+			&role.Name,
+			&role.Description,
+			&role.Level,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type ScheduledEmailStore struct {
+	db *sql.DB
+}
+
+// Create stores an email to send at email.SendAt and fills in its id
+func (storage *ScheduledEmailStore) Create(ctx context.Context, email *models.ScheduledEmail) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, email)
+	})
+}
+
+// ListDue returns up to limit emails due at now, the ones due first first
+func (storage *ScheduledEmailStore) ListDue(ctx context.Context, now time.Time, limit int) ([]*models.ScheduledEmail, error) {
+	query := `
+		SELECT id, template, username, email, subject, data, is_sandbox, send_at, created_at
+		FROM scheduled_emails
+		WHERE send_at <= ?
+		ORDER BY send_at, id
+		LIMIT ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*models.ScheduledEmail{}
+	for rows.Next() {
+		email := &models.ScheduledEmail{}
+		var data []byte
+
+		err := rows.Scan(
+			&email.ID,
+			&email.Template,
+			&email.Username,
+			&email.Email,
+			&email.Subject,
+			&data,
+			&email.IsSandbox,
+			&email.SendAt,
+			&email.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		email.Data = data
+		emails = append(emails, email)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// Delete removes an email once it is queued
+func (storage *ScheduledEmailStore) Delete(ctx context.Context, id int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.deleteQuery(ctx, tx, id)
+	})
+}
+
+// ================== Private methods ======================//
+
+func (storage *ScheduledEmailStore) createQuery(ctx context.Context, tx *sql.Tx, email *models.ScheduledEmail) error {
+	query := `
+		INSERT INTO scheduled_emails (template, username, email, subject, data, is_sandbox, send_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query,
+		email.Template,
+		email.Username,
+		email.Email,
+		email.Subject,
+		[]byte(email.Data),
+		email.IsSandbox,
+		email.SendAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	email.ID = id
+
+	return nil
+}
+
+func (storage *ScheduledEmailStore) deleteQuery(ctx context.Context, tx *sql.Tx, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM scheduled_emails WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type ScheduledJobStore struct {
+	db *sql.DB
+}
+
+func (storage *ScheduledJobStore) List(ctx context.Context) ([]*models.ScheduledJob, error) {
+	query := `
+		SELECT id, name, cron_expr, enabled, payload, created_at, updated_at
+		FROM scheduled_jobs
+		ORDER BY name`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*models.ScheduledJob{}
+	for rows.Next() {
+		job, err := scanScheduledJob(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (storage *ScheduledJobStore) GetByName(ctx context.Context, name string) (*models.ScheduledJob, error) {
+	query := `
+		SELECT id, name, cron_expr, enabled, payload, created_at, updated_at
+		FROM scheduled_jobs
+		WHERE name = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	job, err := scanScheduledJob(conn(ctx, storage.db).QueryRowContext(ctx, query, name))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+// CreateMissing inserts the jobs that have no row yet and leaves existing rows untouched,
+// so schedules changed through the API survive restarts
+func (storage *ScheduledJobStore) CreateMissing(ctx context.Context, jobs []*models.ScheduledJob) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		for _, job := range jobs {
+			if err := storage.createIgnoreQuery(ctx, tx, job); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (storage *ScheduledJobStore) Update(ctx context.Context, job *models.ScheduledJob) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.updateQuery(ctx, tx, job)
+	})
+}
+
+// ================== Private methods ======================//
+func scanScheduledJob(row rowScanner) (*models.ScheduledJob, error) {
+	job := &models.ScheduledJob{}
+	var payload []byte
+
+	err := row.Scan(
+		&job.ID,
+		&job.Name,
+		&job.CronExpr,
+		&job.Enabled,
+		&payload,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) > 0 {
+		job.Payload = payload
+	}
+
+	return job, nil
+}
+
+func (storage *ScheduledJobStore) createIgnoreQuery(ctx context.Context, tx *sql.Tx, job *models.ScheduledJob) error {
+	query := `INSERT IGNORE INTO scheduled_jobs (name, cron_expr, enabled, payload) VALUES (?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, job.Name, job.CronExpr, job.Enabled, nullableJSON(job.Payload))
+	return err
+}
+
+func (storage *ScheduledJobStore) updateQuery(ctx context.Context, tx *sql.Tx, job *models.ScheduledJob) error {
+	query := `UPDATE scheduled_jobs SET cron_expr = ?, enabled = ?, payload = ? WHERE name = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, job.CronExpr, job.Enabled, nullableJSON(job.Payload), job.Name)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports 0 affected rows when nothing changed, so check the row exists
+	if rows == 0 {
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM scheduled_jobs WHERE name = ?)`, job.Name).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+
+	return nil
+}
+
+func nullableJSON(payload []byte) any {
+	if len(payload) == 0 {
+		return nil
+	}
+	return string(payload)
+}
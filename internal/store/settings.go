@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type SettingsStore struct {
+	db *sql.DB
+}
+
+// Get returns the settings of a user, the defaults when they never saved any
+func (storage *SettingsStore) Get(ctx context.Context, userID int64) (*models.UserSettings, error) {
+	query := `
+		SELECT user_id, timezone, locale, theme, email_opt_outs, private_profile, updated_at
+		FROM user_settings
+		WHERE user_id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	settings := &models.UserSettings{}
+	err := conn(ctx, storage.db).QueryRowContext(ctx, query, userID).Scan(
+		&settings.UserID,
+		&settings.Timezone,
+		&settings.Locale,
+		&settings.Theme,
+		&settings.EmailOptOuts,
+		&settings.PrivateProfile,
+		&settings.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.DefaultUserSettings(userID), nil
+		default:
+			return nil, err
+		}
+	}
+
+	return settings, nil
+}
+
+// Save stores every field of settings, creating the row on the first save
+func (storage *SettingsStore) Save(ctx context.Context, settings *models.UserSettings) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.saveQuery(ctx, tx, settings)
+	})
+}
+
+// OptedOut reports whether the user with email turned off the emails of category. An
+// address without an account, or an account without settings, gets everything.
+func (storage *SettingsStore) OptedOut(ctx context.Context, email, category string) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1
+			FROM user_settings s
+			JOIN users u ON u.id = s.user_id
+			WHERE u.email = ? AND FIND_IN_SET(?, s.email_opt_outs) > 0
+		)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var optedOut bool
+	if err := conn(ctx, storage.db).QueryRowContext(ctx, query, email, category).Scan(&optedOut); err != nil {
+		return false, err
+	}
+
+	return optedOut, nil
+}
+
+// ================== Private methods ======================//
+func (storage *SettingsStore) saveQuery(ctx context.Context, tx *sql.Tx, settings *models.UserSettings) error {
+	query := `
+		INSERT INTO user_settings (user_id, timezone, locale, theme, email_opt_outs, private_profile)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			timezone = VALUES(timezone),
+			locale = VALUES(locale),
+			theme = VALUES(theme),
+			email_opt_outs = VALUES(email_opt_outs),
+			private_profile = VALUES(private_profile)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query,
+		settings.UserID,
+		settings.Timezone,
+		settings.Locale,
+		settings.Theme,
+		settings.EmailOptOuts,
+		settings.PrivateProfile,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.QueryRowContext(ctx,
+		`SELECT updated_at FROM user_settings WHERE user_id = ?`,
+		settings.UserID,
+	).Scan(&settings.UpdatedAt)
+}
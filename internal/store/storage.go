@@ -17,34 +17,208 @@ var (
 	ErrDuplicateEmail     = errors.New("record with email already exists")
 	ErrDuplicateUsername  = errors.New("record with username already exists")
 	ErrAccountNotVerified = errors.New("account is not verified")
+	ErrInvalidOTP         = errors.New("invalid otp code")
 	QueryTimeoutDuration  = time.Second * 5
+	// DeletedAccountGracePeriod is how long a soft deleted account can still be restored by logging in
+	DeletedAccountGracePeriod = time.Hour * 24 * 30
 )
 
 type Storage struct {
+	// db runs WithTransaction
+	db *sql.DB
+
 	Users interface {
 		Create(context.Context, *sql.Tx, *models.User) error
 		GetByID(context.Context, int64) (*models.User, error)
+		GetByUsername(context.Context, string) (*models.User, error)
+		List(context.Context, UserListQuery) ([]*models.User, error)
+		ListByRole(context.Context, string) ([]*models.User, error)
 		CreateUserTx(context.Context, *models.User) error
 		UpdateUserProfile(context.Context, *models.User) error
 		Delete(context.Context, int64) error
+		SoftDelete(context.Context, int64) error
+		Restore(context.Context, int64) error
+		ListDeletedBefore(context.Context, time.Time) ([]int64, error)
+		ListUnremindedBefore(ctx context.Context, cutoff time.Time, limit int) ([]*models.User, error)
+		ListUnverifiedBefore(context.Context, time.Time) ([]int64, error)
+		RemindVerification(ctx context.Context, user *models.User, otpCode string, otpExp string) error
 		GetByEmail(context.Context, string, bool) (*models.User, error)
 		UpdateOTPCode(context context.Context, user *models.User, otpCode string, otpExpiresAt string) error
-		VerifyEmail(context.Context, int64) error
-		ResetPassword(context.Context, *models.User) error
+		RecordOTPFailure(context.Context, int64) error
+		ClearExpiredOTPs(context.Context) (int64, error)
+		VerifyEmail(context.Context, int64, string) error
+		ResetPassword(context.Context, *models.User, string) error
+		ChangePassword(context.Context, *models.User) error
+		UpdateAvatar(context.Context, int64, string, string) error
+		UpdateRole(ctx context.Context, userID, roleID int64) error
+		SetTOTPSecret(context.Context, int64, string) error
+		EnableTwoFactor(context.Context, int64, []string) error
+		DisableTwoFactor(context.Context, int64) error
+		UseBackupCode(context.Context, int64, string) error
+		UseTOTPStep(context.Context, int64, int64) error
+		RecordTwoFactorFailure(context.Context, int64) error
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*models.Role, error)
+		List(context.Context) ([]*models.Role, error)
+	}
+	Posts interface {
+		Create(context.Context, *models.Post) error
+		GetByID(context.Context, int64) (*models.Post, error)
+		List(context.Context, PaginatedQuery) ([]*models.Post, error)
+		GetFeed(context.Context, int64, FeedQuery) ([]*models.Post, string, error)
+		Update(context.Context, *models.Post) error
+		Delete(context.Context, int64) error
+	}
+	Followers interface {
+		Follow(ctx context.Context, userID, followerID int64) error
+		Unfollow(ctx context.Context, userID, followerID int64) error
+		Counts(ctx context.Context, userID int64) (int64, int64, error)
+		FollowerIDs(ctx context.Context, userID int64) ([]int64, error)
+	}
+	EmailLogs interface {
+		Create(context.Context, *models.EmailLog) error
+		List(context.Context, EmailLogQuery) ([]*models.EmailLog, error)
+	}
+	SupportTickets interface {
+		Create(context.Context, *models.SupportTicket) error
+		GetByID(context.Context, int64) (*models.SupportTicket, error)
+		List(context.Context, SupportTicketQuery) ([]*models.SupportTicket, error)
+		Respond(ctx context.Context, id, adminID int64, response, status string) error
+	}
+	Files interface {
+		Create(context.Context, *models.File) error
+		MarkActive(ctx context.Context, key string, size int64) error
+		DeleteByKey(ctx context.Context, key string) error
+		ListPendingBefore(context.Context, time.Time) ([]*models.File, error)
+		ExistingKeys(ctx context.Context, keys []string) (map[string]bool, error)
+	}
+	Webhooks interface {
+		Create(context.Context, *models.Webhook) error
+		GetByID(context.Context, int64) (*models.Webhook, error)
+		List(context.Context) ([]*models.Webhook, error)
+		Update(context.Context, *models.Webhook) error
+		Delete(context.Context, int64) error
+		Enqueue(ctx context.Context, event, eventID string, payload []byte) (int64, error)
+		ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+		MarkDelivered(ctx context.Context, id int64, responseStatus int) error
+		MarkFailed(ctx context.Context, id int64, responseStatus *int, lastError string, retryIn time.Duration) error
+		ListDeliveries(context.Context, int64, WebhookDeliveryQuery) ([]*models.WebhookDelivery, error)
+	}
+	Notifications interface {
+		Create(context.Context, *models.Notification) error
+		List(context.Context, int64, NotificationQuery) ([]*models.Notification, error)
+		CountUnread(context.Context, int64) (int64, error)
+		MarkRead(ctx context.Context, userID, id int64) error
+		MarkAllRead(context.Context, int64) (int64, error)
+	}
+	AuditLogs interface {
+		Create(context.Context, *models.AuditLog) error
+		List(context.Context, AuditLogQuery) ([]*models.AuditLog, error)
+	}
+	EmailCampaigns interface {
+		Create(context.Context, *models.EmailCampaign) error
+		GetByID(context.Context, int64) (*models.EmailCampaign, error)
+		List(context.Context, EmailCampaignQuery) ([]*models.EmailCampaign, error)
+		Cancel(context.Context, int64) error
+		ListPending(ctx context.Context, limit int) ([]*models.CampaignRecipient, error)
+		MarkRecipient(ctx context.Context, id int64, status, lastError string) error
+		CompleteFinished(context.Context) (int64, error)
+	}
+	Settings interface {
+		Get(context.Context, int64) (*models.UserSettings, error)
+		Save(context.Context, *models.UserSettings) error
+		OptedOut(ctx context.Context, email, category string) (bool, error)
+	}
+	Invitations interface {
+		Create(context.Context, *models.Invitation) error
+		GetByID(context.Context, int64) (*models.Invitation, error)
+		Accept(ctx context.Context, id, userID int64) error
+	}
+	MailTemplates interface {
+		Create(context.Context, *models.MailTemplate) error
+		ListVersions(context.Context, string) ([]*models.MailTemplate, error)
+		ListActive(context.Context) ([]*models.MailTemplate, error)
+		Activate(ctx context.Context, name string, version int) error
+	}
+	Jobs interface {
+		Enqueue(context.Context, *models.Job) error
+		ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.Job, error)
+		MarkDone(context.Context, int64) error
+		MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration) error
+		CountByStatus(context.Context) (map[string]int64, error)
+	}
+	Outbox interface {
+		Create(context.Context, *models.OutboxMessage) error
+		ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.OutboxMessage, error)
+		Delete(context.Context, int64) error
+		MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration) error
+	}
+	CronRuns interface {
+		Claim(ctx context.Context, job string, runAt time.Time, instance string) (bool, error)
+	}
+	ScheduledJobs interface {
+		List(context.Context) ([]*models.ScheduledJob, error)
+		GetByName(context.Context, string) (*models.ScheduledJob, error)
+		CreateMissing(context.Context, []*models.ScheduledJob) error
+		Update(context.Context, *models.ScheduledJob) error
+	}
+	ScheduledEmails interface {
+		Create(context.Context, *models.ScheduledEmail) error
+		ListDue(ctx context.Context, now time.Time, limit int) ([]*models.ScheduledEmail, error)
+		Delete(context.Context, int64) error
+	}
+	Digests interface {
+		ListActivity(ctx context.Context, since time.Time, category string, afterID int64, limit int) ([]*models.UserActivity, error)
+	}
+	Devices interface {
+		Record(context.Context, *models.UserDevice) (bool, error)
+		GetByID(context.Context, int64) (*models.UserDevice, error)
+		MarkReported(context.Context, int64) error
 	}
 }
 
-func NewStorage(db *sql.DB) Storage {
-	return Storage{
-		Users: &UserStore{db},
-		Roles: &RoleStore{db},
+// NewStorage builds the stores on the primary db. The hot reads of users and posts go to
+// replicas when there are any, nil keeps everything on the primary.
+func NewStorage(db *sql.DB, replicas *Replicas, deletionPolicy DeletionPolicy) (Storage, error) {
+	deletion, err := NewDeletionService(db, deletionPolicy)
+	if err != nil {
+		return Storage{}, err
 	}
+
+	return Storage{
+		db:              db,
+		Users:           &UserStore{db: db, replicas: replicas, deletion: deletion},
+		Roles:           &RoleStore{db},
+		Posts:           &PostStore{db: db, replicas: replicas},
+		Followers:       &FollowerStore{db},
+		EmailLogs:       &EmailLogStore{db},
+		ScheduledJobs:   &ScheduledJobStore{db},
+		SupportTickets:  &SupportTicketStore{db},
+		Files:           &FileStore{db},
+		Webhooks:        &WebhookStore{db},
+		Notifications:   &NotificationStore{db},
+		CronRuns:        &CronRunStore{db},
+		Jobs:            &JobStore{db},
+		Outbox:          &OutboxStore{db},
+		AuditLogs:       &AuditLogStore{db},
+		EmailCampaigns:  &EmailCampaignStore{db},
+		MailTemplates:   &MailTemplateStore{db},
+		Settings:        &SettingsStore{db},
+		Invitations:     &InvitationStore{db},
+		ScheduledEmails: &ScheduledEmailStore{db},
+		Digests:         &DigestStore{db},
+		Devices:         &DeviceStore{db},
+	}, nil
 }
 
+// withTx runs fn in a transaction of its own, or in the one of WithTransaction when ctx
+// carries it. A joined transaction is committed or rolled back by WithTransaction.
 func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(tx)
+	}
+
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -76,3 +250,11 @@ func normalizeEmail(email string) string {
 
 	return strings.ToLower(username + "@" + domain)
 }
+
+// sortDirection maps a user supplied sort value onto a safe SQL keyword
+func sortDirection(sort string) string {
+	if strings.ToLower(sort) == "asc" {
+		return "ASC"
+	}
+	return "DESC"
+}
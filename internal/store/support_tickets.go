@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type SupportTicketStore struct {
+	db *sql.DB
+}
+
+type SupportTicketQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Sort   string `json:"sort" validate:"oneof=asc desc"`
+	Status string `json:"status" validate:"omitempty,oneof=open answered closed"`
+}
+
+// Parse reads status from the query string. The page and its order come from
+// pagination.Parse.
+func (query SupportTicketQuery) Parse(request *http.Request) (SupportTicketQuery, error) {
+	values := request.URL.Query()
+
+	query.Status = strings.ToLower(strings.TrimSpace(values.Get("status")))
+
+	return query, nil
+}
+
+func (storage *SupportTicketStore) Create(ctx context.Context, ticket *models.SupportTicket) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, ticket)
+	})
+}
+
+func (storage *SupportTicketStore) GetByID(ctx context.Context, id int64) (*models.SupportTicket, error) {
+	query := `
+		SELECT ` + supportTicketColumns + `
+		FROM support_tickets
+		WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	ticket, err := scanSupportTicket(conn(ctx, storage.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return ticket, nil
+}
+
+// List returns a page of tickets, newest first unless sorted ascending
+func (storage *SupportTicketStore) List(ctx context.Context, query SupportTicketQuery) ([]*models.SupportTicket, error) {
+	sqlQuery := `
+		SELECT ` + supportTicketColumns + `
+		FROM support_tickets
+		WHERE (? = '' OR status = ?)
+		ORDER BY created_at ` + sortDirection(query.Sort) + `, id ` + sortDirection(query.Sort) + `
+		LIMIT ? OFFSET ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, sqlQuery, query.Status, query.Status, query.Limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []*models.SupportTicket{}
+	for rows.Next() {
+		ticket, err := scanSupportTicket(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tickets = append(tickets, ticket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tickets, nil
+}
+
+// Respond stores the answer of adminID and moves the ticket to status
+func (storage *SupportTicketStore) Respond(ctx context.Context, id, adminID int64, response, status string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.respondQuery(ctx, tx, id, adminID, response, status)
+	})
+}
+
+// ================== Private methods ======================//
+const supportTicketColumns = `id, user_id, name, email, subject, message, status, COALESCE(response, ''),
+		responded_by, responded_at, created_at, updated_at`
+
+func scanSupportTicket(row rowScanner) (*models.SupportTicket, error) {
+	ticket := &models.SupportTicket{}
+	var userID, respondedBy sql.NullInt64
+	var respondedAt sql.NullTime
+
+	err := row.Scan(
+		&ticket.ID,
+		&userID,
+		&ticket.Name,
+		&ticket.Email,
+		&ticket.Subject,
+		&ticket.Message,
+		&ticket.Status,
+		&ticket.Response,
+		&respondedBy,
+		&respondedAt,
+		&ticket.CreatedAt,
+		&ticket.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID.Valid {
+		ticket.UserID = &userID.Int64
+	}
+	if respondedBy.Valid {
+		ticket.RespondedBy = &respondedBy.Int64
+	}
+	if respondedAt.Valid {
+		ticket.RespondedAt = &respondedAt.Time
+	}
+
+	return ticket, nil
+}
+
+func (storage *SupportTicketStore) createQuery(ctx context.Context, tx *sql.Tx, ticket *models.SupportTicket) error {
+	query := `
+		INSERT INTO support_tickets (user_id, name, email, subject, message, status)
+		VALUES (?, ?, ?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if ticket.Status == "" {
+		ticket.Status = models.TicketOpen
+	}
+
+	result, err := tx.ExecContext(ctx, query, ticket.UserID, ticket.Name, ticket.Email, ticket.Subject, ticket.Message, ticket.Status)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	ticket.ID = id
+
+	return tx.QueryRowContext(ctx,
+		`SELECT created_at, updated_at FROM support_tickets WHERE id = ?`,
+		ticket.ID,
+	).Scan(&ticket.CreatedAt, &ticket.UpdatedAt)
+}
+
+func (storage *SupportTicketStore) respondQuery(ctx context.Context, tx *sql.Tx, id, adminID int64, response, status string) error {
+	query := `UPDATE support_tickets
+			  SET response = ?, status = ?, responded_by = ?, responded_at = CURRENT_TIMESTAMP
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, response, status, adminID, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+// SetTOTPSecret stores the secret of a pending enrollment, two-factor stays off until EnableTwoFactor
+func (storage *UserStore) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.setTOTPQuery(ctx, tx, userID, sql.NullString{String: secret, Valid: true})
+	})
+}
+
+// EnableTwoFactor turns on two-factor and replaces the backup codes, only their hashes are stored
+func (storage *UserStore) EnableTwoFactor(ctx context.Context, userID int64, backupCodes []string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		if err := storage.enableTwoFactorQuery(ctx, tx, userID); err != nil {
+			return err
+		}
+		if err := storage.deleteBackupCodesQuery(ctx, tx, userID); err != nil {
+			return err
+		}
+		return storage.createBackupCodesQuery(ctx, tx, userID, backupCodes)
+	})
+}
+
+// DisableTwoFactor removes the secret and every backup code
+func (storage *UserStore) DisableTwoFactor(ctx context.Context, userID int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		if err := storage.setTOTPQuery(ctx, tx, userID, sql.NullString{}); err != nil {
+			return err
+		}
+		return storage.deleteBackupCodesQuery(ctx, tx, userID)
+	})
+}
+
+// UseBackupCode marks the unused backup code matching code as used, ErrNotFound when there is none
+func (storage *UserStore) UseBackupCode(ctx context.Context, userID int64, code string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		if err := storage.useBackupCodeQuery(ctx, tx, userID, code); err != nil {
+			return err
+		}
+		return storage.resetTwoFactorAttemptsQuery(ctx, tx, userID)
+	})
+}
+
+// UseTOTPStep records step as the last accepted TOTP code, ErrNotFound when it is not newer
+// than the last one, which happens when the same code is sent twice at once
+func (storage *UserStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.useTOTPStepQuery(ctx, tx, userID, step)
+	})
+}
+
+// RecordTwoFactorFailure counts a wrong second factor and locks two-factor for
+// models.TwoFactorLockout after models.MaxTwoFactorAttempts in a row
+func (storage *UserStore) RecordTwoFactorFailure(ctx context.Context, userID int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.recordTwoFactorFailureQuery(ctx, tx, userID)
+	})
+}
+
+// ================== Private methods ======================//
+func (storage *UserStore) setTOTPQuery(ctx context.Context, tx *sql.Tx, userID int64, secret sql.NullString) error {
+	query := `UPDATE users
+			  SET totp_secret = ?, totp_enabled_at = NULL, two_factor_attempts = 0, two_factor_locked_until = NULL,
+			      updated_by = ?, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, secret, actor(ctx), userID)
+
+	return err
+}
+
+func (storage *UserStore) enableTwoFactorQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `UPDATE users
+			  SET totp_enabled_at = CURRENT_TIMESTAMP, updated_by = ?, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = ? AND totp_secret IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, actor(ctx), userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (storage *UserStore) deleteBackupCodesQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM user_backup_codes WHERE user_id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+
+	return err
+}
+
+func (storage *UserStore) createBackupCodesQuery(ctx context.Context, tx *sql.Tx, userID int64, backupCodes []string) error {
+	if len(backupCodes) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(backupCodes))
+	args := make([]any, 0, len(backupCodes)*2)
+	for i, code := range backupCodes {
+		placeholders[i] = "(?, ?)"
+		args = append(args, userID, models.HashBackupCode(code))
+	}
+
+	query := `INSERT INTO user_backup_codes (user_id, code_hash) VALUES ` + strings.Join(placeholders, ", ")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+func (storage *UserStore) useBackupCodeQuery(ctx context.Context, tx *sql.Tx, userID int64, code string) error {
+	query := `UPDATE user_backup_codes
+			  SET used_at = CURRENT_TIMESTAMP
+			  WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, userID, models.HashBackupCode(code))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (storage *UserStore) useTOTPStepQuery(ctx context.Context, tx *sql.Tx, userID int64, step int64) error {
+	query := `UPDATE users
+			  SET totp_last_step = ?, two_factor_attempts = 0, two_factor_locked_until = NULL
+			  WHERE id = ? AND totp_last_step < ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (storage *UserStore) resetTwoFactorAttemptsQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `UPDATE users SET two_factor_attempts = 0, two_factor_locked_until = NULL WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+
+	return err
+}
+
+// recordTwoFactorFailureQuery starts the count over once it locks, so the next lock takes
+// another models.MaxTwoFactorAttempts wrong codes. The lock is set before the count changes,
+// MySQL assigns left to right.
+func (storage *UserStore) recordTwoFactorFailureQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `UPDATE users
+			  SET two_factor_locked_until = IF(two_factor_attempts + 1 >= ?, ?, two_factor_locked_until),
+			      two_factor_attempts = IF(two_factor_attempts + 1 >= ?, 0, two_factor_attempts + 1)
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	lockedUntil := time.Now().UTC().Add(models.TwoFactorLockout)
+	_, err := tx.ExecContext(ctx, query, models.MaxTwoFactorAttempts, lockedUntil, models.MaxTwoFactorAttempts, userID)
+
+	return err
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type txKey struct{}
+
+// querier is what *sql.DB and *sql.Tx have in common
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithTransaction runs fn in one transaction, so the changes of several stores are kept or
+// dropped together. The stores called with the ctx passed to fn join the transaction instead
+// of opening their own, and their reads see its uncommitted changes. It commits when fn
+// returns nil and rolls back otherwise. Calls nested in fn join the outermost transaction.
+//
+// Only store calls belong in fn. Side effects such as emails or events cannot be rolled back
+// and should run once WithTransaction returned.
+//
+// A Storage without a database, such as the in-memory one of internal/mocks, runs fn as is.
+func (storage Storage) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if storage.db == nil {
+		return fn(ctx)
+	}
+
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// conn is the transaction of ctx, or db outside of WithTransaction
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
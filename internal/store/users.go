@@ -7,10 +7,13 @@ import (
 	"github.com/go-sql-driver/mysql"
 	"godsendjoseph.dev/sandbox-api/internal/models"
 	"strings"
+	"time"
 )
 
 type UserStore struct {
-	db *sql.DB
+	db       *sql.DB
+	replicas *Replicas
+	deletion *DeletionService
 }
 
 func (storage *UserStore) CreateUserTx(ctx context.Context, user *models.User) error {
@@ -26,13 +29,16 @@ func (storage *UserStore) CreateUserTx(ctx context.Context, user *models.User) e
 
 func (storage *UserStore) Create(ctx context.Context, tx *sql.Tx, user *models.User) error {
 	query := `
-    INSERT INTO users (first_name, last_name, username, email, normalized_email, otp_code, otp_expires_at, password, role_id) 
-    VALUES (?, ?, ?, ?, ?, ?, ?, ?, (SELECT id FROM roles WHERE name = ?))`
+    INSERT INTO users (first_name, last_name, username, email, normalized_email, phone, otp_code, otp_expires_at, password, role_id, created_by, updated_by) 
+    VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, (SELECT id FROM roles WHERE name = ?), ?, ?)`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	user.NormalizedEmail = normalizeEmail(user.Email)
+	if user.OtpCode != "" {
+		user.OtpCode = models.HashOTP(user.OtpCode)
+	}
 
 	role := user.Role.Name
 	if role == "" {
@@ -47,10 +53,13 @@ func (storage *UserStore) Create(ctx context.Context, tx *sql.Tx, user *models.U
 		user.Username,
 		user.Email,
 		user.NormalizedEmail,
+		user.Phone,
 		user.OtpCode,
 		user.OtpExp,
 		user.Password.Hash,
 		role,
+		actor(ctx),
+		actor(ctx),
 	)
 	if err != nil {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
@@ -89,6 +98,17 @@ func (storage *UserStore) Create(ctx context.Context, tx *sql.Tx, user *models.U
 }
 
 func (storage *UserStore) GetByID(ctx context.Context, id int64) (*models.User, error) {
+	return storage.getQuery(ctx, "users.id = ?", id)
+}
+
+// GetByUsername returns the user with username, compared case-insensitively like the
+// unique key of the column
+func (storage *UserStore) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return storage.getQuery(ctx, "users.username = ?", username)
+}
+
+// ListByRole returns the active users that have exactly the given role
+func (storage *UserStore) ListByRole(ctx context.Context, roleName string) ([]*models.User, error) {
 	query := `
 		SELECT 
 			users.id, 
@@ -100,49 +120,155 @@ func (storage *UserStore) GetByID(ctx context.Context, id int64) (*models.User,
 			users.role_id, 
 			users.created_at, 
 			users.updated_at, 
+			users.password_changed_at, 
+			users.avatar_key, 
+			users.avatar_url, 
 			roles.id AS role_id, 
 			roles.name AS role_name, 
 			roles.level AS role_level, 
 			roles.description AS role_description
 		FROM users
 		JOIN roles ON users.role_id = roles.id 
-		WHERE users.id = ?`
+		WHERE roles.name = ? AND users.is_active = TRUE AND users.deleted_at IS NULL
+		ORDER BY users.id`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	row := storage.db.QueryRowContext(ctx, query, id)
+	rows, err := readDB(ctx, storage.db, storage.replicas).QueryContext(ctx, query, roleName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		var passwordChangedAt sql.NullTime
+		var avatarKey, avatarURL sql.NullString
+		err := rows.Scan(
+			&user.ID,
+			&user.FirstName,
+			&user.LastName,
+			&user.Username,
+			&user.Email,
+			&user.IsActive,
+			&user.RoleID,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&passwordChangedAt,
+			&avatarKey,
+			&avatarURL,
+			&user.Role.ID,
+			&user.Role.Name,
+			&user.Role.Level,
+			&user.Role.Description,
+		)
+		if err != nil {
+			return nil, err
+		}
 
-	user := &models.User{}
-	err := row.Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Username,
-		&user.Email,
-		&user.IsActive,
-		&user.RoleID,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.Role.ID,
-		&user.Role.Name,
-		&user.Role.Level,
-		&user.Role.Description,
-	)
+		if passwordChangedAt.Valid {
+			user.PasswordChangedAt = &passwordChangedAt.Time
+		}
+		user.AvatarKey, user.AvatarURL = avatarKey.String, avatarURL.String
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// List returns a page of the verified users, see UserListQuery for what the search matches
+func (storage *UserStore) List(ctx context.Context, query UserListQuery) ([]*models.User, error) {
+	sqlQuery := `
+		SELECT 
+			users.id, 
+			users.first_name, 
+			users.last_name,
+			users.username, 
+			users.email, 
+			users.is_active, 
+			users.role_id, 
+			users.created_at, 
+			users.updated_at, 
+			users.avatar_key, 
+			users.avatar_url, 
+			users.deleted_at, 
+			users.created_by, 
+			users.updated_by, 
+			COALESCE(user_settings.private_profile, FALSE) AS private_profile, 
+			roles.id AS role_id, 
+			roles.name AS role_name, 
+			roles.level AS role_level, 
+			roles.description AS role_description
+		FROM users
+		JOIN roles ON users.role_id = roles.id 
+		LEFT JOIN user_settings ON user_settings.user_id = users.id 
+		WHERE ` + deletedCondition(ctx, "users") + ` AND users.is_active = 1
+			AND (? = '' OR users.username LIKE ? ESCAPE '\\' OR (? AND users.email LIKE ? ESCAPE '\\'))
+		ORDER BY users.created_at ` + sortDirection(query.Sort) + `, users.id ` + sortDirection(query.Sort) + `
+		LIMIT ? OFFSET ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	search := containsPattern(query.Search)
+
+	rows, err := readDB(ctx, storage.db, storage.replicas).QueryContext(ctx, sqlQuery, query.Search, search, query.SearchEmail, search, query.Limit, query.Offset)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrNotFound
-		default:
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		var deletedAt sql.NullTime
+		var avatarKey, avatarURL sql.NullString
+		var createdBy, updatedBy sql.NullInt64
+		err := rows.Scan(
+			&user.ID,
+			&user.FirstName,
+			&user.LastName,
+			&user.Username,
+			&user.Email,
+			&user.IsActive,
+			&user.RoleID,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&avatarKey,
+			&avatarURL,
+			&deletedAt,
+			&createdBy,
+			&updatedBy,
+			&user.PrivateProfile,
+			&user.Role.ID,
+			&user.Role.Name,
+			&user.Role.Level,
+			&user.Role.Description,
+		)
+		if err != nil {
 			return nil, err
 		}
+		user.AvatarKey, user.AvatarURL = avatarKey.String, avatarURL.String
+		if deletedAt.Valid {
+			user.DeletedAt = &deletedAt.Time
+		}
+		user.CreatedBy, user.UpdatedBy = nullableID(createdBy), nullableID(updatedBy)
+
+		users = append(users, user)
 	}
 
-	if !user.IsActive {
-		return nil, ErrAccountNotVerified
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return user, nil
+	return users, nil
 }
 
 func (storage *UserStore) GetByEmail(ctx context.Context, email string, isAuth bool) (*models.User, error) {
@@ -150,20 +276,28 @@ func (storage *UserStore) GetByEmail(ctx context.Context, email string, isAuth b
 
 	query := `
     SELECT 
-    u.id, u.username, u.email, u.password, u.otp_code, u.otp_expires_at, u.is_active, u.created_at, u.updated_at, 
-    u.role_id,
+    u.id, u.username, u.email, u.password, u.otp_code, u.otp_expires_at, u.otp_attempts, u.is_active, u.created_at, u.updated_at, 
+    u.deleted_at, u.role_id, u.totp_secret, u.totp_enabled_at, u.totp_last_step, u.two_factor_attempts,
+    u.two_factor_locked_until, u.avatar_key, u.avatar_url,
+    COALESCE(s.private_profile, FALSE),
     r.id, r.name, r.level, r.description
     FROM users u
     LEFT JOIN roles r ON u.role_id = r.id
+    LEFT JOIN user_settings s ON s.user_id = u.id
     WHERE u.normalized_email = ?
 `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	row := storage.db.QueryRowContext(ctx, query, normalizedEmail)
+	row := readDB(ctx, storage.db, storage.replicas).QueryRowContext(ctx, query, normalizedEmail)
 
 	user := &models.User{}
+	var deletedAt sql.NullTime
+	var totpSecret sql.NullString
+	var totpEnabledAt sql.NullTime
+	var twoFactorLockedUntil sql.NullTime
+	var avatarKey, avatarURL sql.NullString
 	var roleID sql.NullInt64
 	var roleName sql.NullString
 	var roleLevel sql.NullInt64
@@ -176,10 +310,20 @@ func (storage *UserStore) GetByEmail(ctx context.Context, email string, isAuth b
 		&user.Password.Hash,
 		&user.OtpCode,
 		&user.OtpExp,
+		&user.OtpAttempts,
 		&user.IsActive,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&deletedAt,
 		&user.RoleID,
+		&totpSecret,
+		&totpEnabledAt,
+		&user.TOTPLastStep,
+		&user.TwoFactorAttempts,
+		&twoFactorLockedUntil,
+		&avatarKey,
+		&avatarURL,
+		&user.PrivateProfile,
 		&roleID,
 		&roleName,
 		&roleLevel,
@@ -194,6 +338,19 @@ func (storage *UserStore) GetByEmail(ctx context.Context, email string, isAuth b
 		}
 	}
 
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+
+	user.TOTPSecret = totpSecret.String
+	if totpEnabledAt.Valid {
+		user.TOTPEnabledAt = &totpEnabledAt.Time
+	}
+	if twoFactorLockedUntil.Valid {
+		user.TwoFactorLockedUntil = &twoFactorLockedUntil.Time
+	}
+	user.AvatarKey, user.AvatarURL = avatarKey.String, avatarURL.String
+
 	// Set role fields only if they're not NULL
 	if roleID.Valid {
 		user.Role.ID = roleID.Int64
@@ -215,43 +372,309 @@ func (storage *UserStore) UpdateUserProfile(ctx context.Context, user *models.Us
 	})
 }
 
-func (storage *UserStore) VerifyEmail(ctx context.Context, userId int64) error {
+// VerifyEmail activates the account and uses up otpCode, ErrInvalidOTP means the code
+// was already used or replaced in the meantime
+func (storage *UserStore) VerifyEmail(ctx context.Context, userId int64, otpCode string) error {
 	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		if err := storage.consumeOTPQuery(ctx, tx, userId, otpCode); err != nil {
+			return err
+		}
 		return storage.verifyEmailQuery(ctx, tx, userId)
 	})
 }
 
+// UpdateOTPCode stores the hash of a new code and resets the attempt counter
 func (storage *UserStore) UpdateOTPCode(ctx context.Context, user *models.User, otpCode string, otpExp string) error {
 	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
 		return storage.updateOTPQuery(ctx, tx, user, otpCode, otpExp)
 	})
 }
 
-func (storage *UserStore) ResetPassword(ctx context.Context, user *models.User) error {
+// RecordOTPFailure counts a wrong code and clears the pending one after models.MaxOTPAttempts
+func (storage *UserStore) RecordOTPFailure(ctx context.Context, userID int64) error {
 	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.recordOTPFailureQuery(ctx, tx, userID)
+	})
+}
+
+// ResetPassword stores the new password and uses up otpCode, see VerifyEmail. It stamps
+// password_changed_at like ChangePassword, so a stolen token does not outlive the reset.
+func (storage *UserStore) ResetPassword(ctx context.Context, user *models.User, otpCode string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		if err := storage.consumeOTPQuery(ctx, tx, user.ID, otpCode); err != nil {
+			return err
+		}
 		return storage.resetPasswordQuery(ctx, tx, user)
 	})
 }
 
+// ChangePassword stores the new hash and stamps password_changed_at, which
+// revokes every token issued before the change
+func (storage *UserStore) ChangePassword(ctx context.Context, user *models.User) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.changePasswordQuery(ctx, tx, user)
+	})
+}
+
+// Delete removes the user for good, see DeletionService for what happens to their data
+// UpdateAvatar points the user at a newly uploaded avatar
+func (storage *UserStore) UpdateAvatar(ctx context.Context, userID int64, key, url string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.updateAvatarQuery(ctx, tx, userID, key, url)
+	})
+}
+
+// UpdateRole moves the user to roleID
+func (storage *UserStore) UpdateRole(ctx context.Context, userID, roleID int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.updateRoleQuery(ctx, tx, userID, roleID)
+	})
+}
+
 func (storage *UserStore) Delete(ctx context.Context, userID int64) error {
+	return storage.deletion.DeleteUser(ctx, userID)
+}
+
+// SoftDelete hides the account until it is restored or purged after DeletedAccountGracePeriod
+func (storage *UserStore) SoftDelete(ctx context.Context, userID int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		deletedAt := time.Now().UTC()
+		return storage.setDeletedAtQuery(ctx, tx, userID, &deletedAt)
+	})
+}
+
+func (storage *UserStore) Restore(ctx context.Context, userID int64) error {
 	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
-		if err := storage.deleteQuery(ctx, tx, userID); err != nil {
+		return storage.setDeletedAtQuery(ctx, tx, userID, nil)
+	})
+}
+
+// ListDeletedBefore returns the ids of accounts soft deleted before cutoff
+func (storage *UserStore) ListDeletedBefore(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	query := `SELECT id FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// ListUnremindedBefore returns up to limit unverified accounts created before cutoff that
+// have not been reminded to verify their email yet
+func (storage *UserStore) ListUnremindedBefore(ctx context.Context, cutoff time.Time, limit int) ([]*models.User, error) {
+	query := `
+		SELECT id, username, email, created_at
+		FROM users
+		WHERE is_active = FALSE AND deleted_at IS NULL AND verification_reminded_at IS NULL AND created_at < ?
+		ORDER BY created_at
+		LIMIT ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListUnverifiedBefore returns the ids of accounts created before cutoff that never verified their email
+func (storage *UserStore) ListUnverifiedBefore(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	query := `SELECT id FROM users WHERE is_active = FALSE AND deleted_at IS NULL AND created_at < ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// RemindVerification stores a fresh OTP for the reminder email and marks the account
+// reminded, so it is reminded once
+func (storage *UserStore) RemindVerification(ctx context.Context, user *models.User, otpCode string, otpExp string) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		if err := storage.updateOTPQuery(ctx, tx, user, otpCode, otpExp); err != nil {
 			return err
 		}
+		return storage.setVerificationRemindedQuery(ctx, tx, user.ID)
+	})
+}
+
+// ClearExpiredOTPs blanks the OTP codes past their expiry and returns how many were cleared.
+// otp_expires_at is an RFC 3339 string with the offset of the instance that wrote it, so
+// expiries are compared in Go rather than in SQL.
+func (storage *UserStore) ClearExpiredOTPs(ctx context.Context) (int64, error) {
+	expired, err := storage.listExpiredOTPsQuery(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var cleared int64
+	err = withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		for userID, otpExp := range expired {
+			affected, err := storage.clearOTPQuery(ctx, tx, userID, otpExp)
+			if err != nil {
+				return err
+			}
+			cleared += affected
+		}
 		return nil
 	})
+
+	return cleared, err
 }
 
 // ================== Private methods ======================//
+// getQuery returns the user matching condition, a WHERE clause on users with a single arg
+func (storage *UserStore) getQuery(ctx context.Context, condition string, arg any) (*models.User, error) {
+	query := `
+		SELECT 
+			users.id, 
+			users.first_name, 
+			users.last_name,
+			users.username, 
+			users.email, 
+			users.phone, 
+			users.is_active, 
+			users.role_id, 
+			users.created_at, 
+			users.updated_at, 
+			users.password_changed_at, 
+			users.avatar_key, 
+			users.avatar_url, 
+			users.deleted_at, 
+			users.created_by, 
+			users.updated_by, 
+			COALESCE(user_settings.private_profile, FALSE) AS private_profile, 
+			roles.id AS role_id, 
+			roles.name AS role_name, 
+			roles.level AS role_level, 
+			roles.description AS role_description
+		FROM users
+		JOIN roles ON users.role_id = roles.id 
+		LEFT JOIN user_settings ON user_settings.user_id = users.id 
+		WHERE ` + condition + ` AND ` + deletedCondition(ctx, "users")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	row := readDB(ctx, storage.db, storage.replicas).QueryRowContext(ctx, query, arg)
+
+	user := &models.User{}
+	var passwordChangedAt, deletedAt sql.NullTime
+	var phone, avatarKey, avatarURL sql.NullString
+	var createdBy, updatedBy sql.NullInt64
+	err := row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Username,
+		&user.Email,
+		&phone,
+		&user.IsActive,
+		&user.RoleID,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&passwordChangedAt,
+		&avatarKey,
+		&avatarURL,
+		&deletedAt,
+		&createdBy,
+		&updatedBy,
+		&user.PrivateProfile,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if passwordChangedAt.Valid {
+		user.PasswordChangedAt = &passwordChangedAt.Time
+	}
+	user.Phone = phone.String
+	user.AvatarKey, user.AvatarURL = avatarKey.String, avatarURL.String
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	user.CreatedBy, user.UpdatedBy = nullableID(createdBy), nullableID(updatedBy)
+
+	if !user.IsActive {
+		return nil, ErrAccountNotVerified
+	}
+
+	return user, nil
+}
+
 func (storage *UserStore) updateQuery(ctx context.Context, tx *sql.Tx, user *models.User) error {
 	query := `UPDATE users
-			  SET first_name = ?, last_name = ?
+			  SET first_name = ?, last_name = ?, phone = NULLIF(?, ''), updated_by = ?, updated_at = CURRENT_TIMESTAMP
 			  WHERE id = ?`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, user.FirstName, user.LastName, user.ID)
+	_, err := tx.ExecContext(ctx, query, user.FirstName, user.LastName, user.Phone, actor(ctx), user.ID)
 
 	if err != nil {
 		return err
@@ -262,13 +685,30 @@ func (storage *UserStore) updateQuery(ctx context.Context, tx *sql.Tx, user *mod
 
 func (storage *UserStore) resetPasswordQuery(ctx context.Context, tx *sql.Tx, user *models.User) error {
 	query := `UPDATE users
-			  SET password = ?, otp_code = ?
+			  SET password = ?, password_changed_at = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP
 			  WHERE id = ?`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, user.Password.Hash, "", user.ID)
+	_, err := tx.ExecContext(ctx, query, user.Password.Hash, user.PasswordChangedAt, actor(ctx), user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (storage *UserStore) changePasswordQuery(ctx context.Context, tx *sql.Tx, user *models.User) error {
+	query := `UPDATE users
+			  SET password = ?, password_changed_at = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Password.Hash, user.PasswordChangedAt, actor(ctx), user.ID)
 
 	if err != nil {
 		return err
@@ -279,13 +719,13 @@ func (storage *UserStore) resetPasswordQuery(ctx context.Context, tx *sql.Tx, us
 
 func (storage *UserStore) verifyEmailQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
 	query := `UPDATE users
-			  SET is_active = ?, otp_code = ?
+			  SET is_active = ?
 			  WHERE id = ?`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, true, "", userID)
+	_, err := tx.ExecContext(ctx, query, true, userID)
 
 	if err != nil {
 		return err
@@ -296,13 +736,13 @@ func (storage *UserStore) verifyEmailQuery(ctx context.Context, tx *sql.Tx, user
 
 func (storage *UserStore) updateOTPQuery(ctx context.Context, tx *sql.Tx, user *models.User, otpCode string, otpExp string) error {
 	query := `UPDATE users
-			  SET otp_code = ?, otp_expires_at = ?
+			  SET otp_code = ?, otp_expires_at = ?, otp_attempts = 0
 			  WHERE id = ?`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, otpCode, otpExp, user.ID)
+	_, err := tx.ExecContext(ctx, query, models.HashOTP(otpCode), otpExp, user.ID)
 
 	if err != nil {
 		return err
@@ -311,17 +751,150 @@ func (storage *UserStore) updateOTPQuery(ctx context.Context, tx *sql.Tx, user *
 	return nil
 }
 
-func (storage *UserStore) deleteQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
-	query := `DELETE FROM users WHERE id = ?`
+// consumeOTPQuery clears the code only if it still matches, so two requests racing
+// with the same code cannot both succeed
+func (storage *UserStore) consumeOTPQuery(ctx context.Context, tx *sql.Tx, userID int64, otpCode string) error {
+	query := `UPDATE users
+			  SET otp_code = '', otp_attempts = 0
+			  WHERE id = ? AND otp_code = ? AND otp_code <> ''`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, userID)
+	result, err := tx.ExecContext(ctx, query, userID, models.HashOTP(otpCode))
+	if err != nil {
+		return err
+	}
 
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return ErrInvalidOTP
+	}
 
 	return nil
 }
+
+func (storage *UserStore) recordOTPFailureQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
+	// MySQL assigns left to right, so otp_code still sees the old counter
+	query := `UPDATE users
+			  SET otp_code = IF(otp_attempts + 1 >= ?, '', otp_code), otp_attempts = otp_attempts + 1
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, models.MaxOTPAttempts, userID)
+
+	return err
+}
+
+func (storage *UserStore) setDeletedAtQuery(ctx context.Context, tx *sql.Tx, userID int64, deletedAt *time.Time) error {
+	query := `UPDATE users
+			  SET deleted_at = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, deletedAt, actor(ctx), userID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (storage *UserStore) updateAvatarQuery(ctx context.Context, tx *sql.Tx, userID int64, key, url string) error {
+	query := `UPDATE users
+			  SET avatar_key = ?, avatar_url = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, key, url, actor(ctx), userID)
+
+	return err
+}
+
+func (storage *UserStore) updateRoleQuery(ctx context.Context, tx *sql.Tx, userID, roleID int64) error {
+	query := `UPDATE users
+			  SET role_id = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, roleID, actor(ctx), userID)
+
+	return err
+}
+
+func (storage *UserStore) setVerificationRemindedQuery(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `UPDATE users
+			  SET verification_reminded_at = CURRENT_TIMESTAMP
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+
+	return err
+}
+
+// listExpiredOTPsQuery returns the otp_expires_at of every user whose pending code expired before now
+func (storage *UserStore) listExpiredOTPsQuery(ctx context.Context, now time.Time) (map[int64]string, error) {
+	query := `SELECT id, otp_expires_at FROM users WHERE otp_code IS NOT NULL AND otp_code <> ''`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expired := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var otpExp sql.NullString
+		if err := rows.Scan(&id, &otpExp); err != nil {
+			return nil, err
+		}
+
+		// a code without a readable expiry can never be used, it goes too
+		expiresAt, err := time.Parse(time.RFC3339, otpExp.String)
+		if err != nil || expiresAt.Before(now) {
+			expired[id] = otpExp.String
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// clearOTPQuery only clears the code that expired at otpExp, a code issued since stays
+func (storage *UserStore) clearOTPQuery(ctx context.Context, tx *sql.Tx, userID int64, otpExp string) (int64, error) {
+	query := `UPDATE users
+			  SET otp_code = '', otp_attempts = 0
+			  WHERE id = ? AND COALESCE(otp_expires_at, '') = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, userID, otpExp)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,443 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+type WebhookStore struct {
+	db *sql.DB
+}
+
+type WebhookDeliveryQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Status string `json:"status" validate:"omitempty,oneof=pending sending delivered failed"`
+}
+
+// Parse reads status from the query string. The page comes from pagination.Parse.
+func (query WebhookDeliveryQuery) Parse(request *http.Request) (WebhookDeliveryQuery, error) {
+	values := request.URL.Query()
+
+	query.Status = strings.ToLower(strings.TrimSpace(values.Get("status")))
+
+	return query, nil
+}
+
+func (storage *WebhookStore) Create(ctx context.Context, webhook *models.Webhook) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.createQuery(ctx, tx, webhook)
+	})
+}
+
+func (storage *WebhookStore) GetByID(ctx context.Context, id int64) (*models.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	webhook, err := scanWebhook(conn(ctx, storage.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return webhook, nil
+}
+
+// List returns every webhook, there are only ever a handful
+func (storage *WebhookStore) List(ctx context.Context) ([]*models.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Update saves the url, events, description and enabled flag, the secret never changes
+func (storage *WebhookStore) Update(ctx context.Context, webhook *models.Webhook) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.updateQuery(ctx, tx, webhook)
+	})
+}
+
+// Delete removes the webhook together with its deliveries
+func (storage *WebhookStore) Delete(ctx context.Context, id int64) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.deleteQuery(ctx, tx, id)
+	})
+}
+
+// Enqueue queues payload for every enabled webhook subscribed to event and returns how
+// many deliveries were created
+func (storage *WebhookStore) Enqueue(ctx context.Context, event, eventID string, payload []byte) (int64, error) {
+	var queued int64
+
+	err := withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		var err error
+		queued, err = storage.enqueueQuery(ctx, tx, event, eventID, payload)
+		return err
+	})
+
+	return queued, err
+}
+
+// ClaimDue leases up to limit deliveries that are due to token and counts the attempt.
+// A delivery whose lease ran out, because the instance sending it died, is due again.
+func (storage *WebhookStore) ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	err := withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.claimDueQuery(ctx, tx, token, limit, lease)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + webhookDeliveryColumns + `, w.url, w.secret
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.locked_by = ? AND d.status = ?
+		ORDER BY d.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, query, token, models.DeliverySending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows, &sql.NullString{}, &sql.NullString{})
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// MarkDelivered records the successful attempt of a delivery
+func (storage *WebhookStore) MarkDelivered(ctx context.Context, id int64, responseStatus int) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markDeliveredQuery(ctx, tx, id, responseStatus)
+	})
+}
+
+// MarkFailed records a failed attempt. The delivery is retried after retryIn, or given
+// up on for good when retryIn is zero. responseStatus is nil when no response came back.
+func (storage *WebhookStore) MarkFailed(ctx context.Context, id int64, responseStatus *int, lastError string, retryIn time.Duration) error {
+	return withTx(ctx, storage.db, func(tx *sql.Tx) error {
+		return storage.markFailedQuery(ctx, tx, id, responseStatus, lastError, retryIn)
+	})
+}
+
+// ListDeliveries returns a page of the deliveries of a webhook, newest first
+func (storage *WebhookStore) ListDeliveries(ctx context.Context, webhookID int64, query WebhookDeliveryQuery) ([]*models.WebhookDelivery, error) {
+	sqlQuery := `
+		SELECT ` + webhookDeliveryColumns + `, NULL, NULL
+		FROM webhook_deliveries d
+		WHERE d.webhook_id = ? AND (? = '' OR d.status = ?)
+		ORDER BY d.id DESC
+		LIMIT ? OFFSET ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := conn(ctx, storage.db).QueryContext(ctx, sqlQuery, webhookID, query.Status, query.Status, query.Limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows, &sql.NullString{}, &sql.NullString{})
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ================== Private methods ======================//
+const webhookColumns = `id, url, secret, events, description, enabled, created_by, created_at, updated_at`
+
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event_id, d.event, d.payload, d.status, d.attempts,
+		d.next_attempt_at, d.response_status, COALESCE(d.last_error, ''), d.delivered_at, d.created_at`
+
+// webhookErrorLimit matches the width of webhook_deliveries.last_error
+const webhookErrorLimit = 1000
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	var createdBy sql.NullInt64
+
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.URL,
+		&webhook.Secret,
+		&webhook.Events,
+		&webhook.Description,
+		&webhook.Enabled,
+		&createdBy,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if createdBy.Valid {
+		webhook.CreatedBy = &createdBy.Int64
+	}
+
+	return webhook, nil
+}
+
+// scanWebhookDelivery reads webhookDeliveryColumns followed by the url and secret of the
+// webhook, which are only selected when a delivery is claimed
+func scanWebhookDelivery(row rowScanner, url, secret *sql.NullString) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	var payload []byte
+	var nextAttemptAt, deliveredAt sql.NullTime
+	var responseStatus sql.NullInt64
+
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&nextAttemptAt,
+		&responseStatus,
+		&delivery.LastError,
+		&deliveredAt,
+		&delivery.CreatedAt,
+		url,
+		secret,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = payload
+	delivery.URL = url.String
+	delivery.Secret = secret.String
+
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		delivery.ResponseStatus = &status
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+
+	return delivery, nil
+}
+
+func (storage *WebhookStore) createQuery(ctx context.Context, tx *sql.Tx, webhook *models.Webhook) error {
+	query := `
+		INSERT INTO webhooks (url, secret, events, description, enabled, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, webhook.URL, webhook.Secret, webhook.Events, webhook.Description, webhook.Enabled, webhook.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	webhook.ID = id
+
+	return tx.QueryRowContext(ctx,
+		`SELECT created_at, updated_at FROM webhooks WHERE id = ?`,
+		webhook.ID,
+	).Scan(&webhook.CreatedAt, &webhook.UpdatedAt)
+}
+
+func (storage *WebhookStore) updateQuery(ctx context.Context, tx *sql.Tx, webhook *models.Webhook) error {
+	query := `UPDATE webhooks
+			  SET url = ?, events = ?, description = ?, enabled = ?
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, webhook.URL, webhook.Events, webhook.Description, webhook.Enabled, webhook.ID)
+	if err != nil {
+		return err
+	}
+
+	// RowsAffected is zero when nothing changed, read the row back to tell that apart from a missing one
+	err = tx.QueryRowContext(ctx,
+		`SELECT updated_at FROM webhooks WHERE id = ?`,
+		webhook.ID,
+	).Scan(&webhook.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (storage *WebhookStore) deleteQuery(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := `DELETE FROM webhooks WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (storage *WebhookStore) enqueueQuery(ctx context.Context, tx *sql.Tx, event, eventID string, payload []byte) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload)
+		SELECT id, ?, ?, ?
+		FROM webhooks
+		WHERE enabled = TRUE AND FIND_IN_SET(?, events) > 0`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, query, eventID, event, payload, event)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (storage *WebhookStore) claimDueQuery(ctx context.Context, tx *sql.Tx, token string, limit int, lease time.Duration) error {
+	// next_attempt_at doubles as the lease expiry while a delivery is being sent
+	query := `UPDATE webhook_deliveries
+			  SET status = ?, locked_by = ?, attempts = attempts + 1,
+				  next_attempt_at = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND)
+			  WHERE status IN (?, ?) AND next_attempt_at <= CURRENT_TIMESTAMP
+			  ORDER BY next_attempt_at
+			  LIMIT ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query,
+		models.DeliverySending, token, int(lease.Seconds()),
+		models.DeliveryPending, models.DeliverySending,
+		limit,
+	)
+	return err
+}
+
+func (storage *WebhookStore) markDeliveredQuery(ctx context.Context, tx *sql.Tx, id int64, responseStatus int) error {
+	query := `UPDATE webhook_deliveries
+			  SET status = ?, response_status = ?, last_error = NULL, locked_by = NULL,
+				  next_attempt_at = NULL, delivered_at = CURRENT_TIMESTAMP
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, models.DeliveryDelivered, responseStatus, id)
+	return err
+}
+
+func (storage *WebhookStore) markFailedQuery(ctx context.Context, tx *sql.Tx, id int64, responseStatus *int, lastError string, retryIn time.Duration) error {
+	if len(lastError) > webhookErrorLimit {
+		lastError = lastError[:webhookErrorLimit]
+	}
+
+	status := models.DeliveryPending
+	var retrySeconds *int
+	if retryIn > 0 {
+		seconds := int(retryIn.Seconds())
+		retrySeconds = &seconds
+	} else {
+		status = models.DeliveryFailed
+	}
+
+	query := `UPDATE webhook_deliveries
+			  SET status = ?, response_status = ?, last_error = ?, locked_by = NULL,
+				  next_attempt_at = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND)
+			  WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, status, responseStatus, lastError, retrySeconds, id)
+	return err
+}
@@ -0,0 +1,44 @@
+package supportref
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps the last limit events of this instance, for a single instance
+// without Redis. They are lost on restart.
+type MemoryStore struct {
+	mu     sync.Mutex
+	events map[string]Event
+	order  []string
+	limit  int
+}
+
+func NewMemoryStore(limit int) *MemoryStore {
+	return &MemoryStore{events: make(map[string]Event), limit: limit}
+}
+
+func (store *MemoryStore) Record(_ context.Context, event Event) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, exists := store.events[event.Ref]; !exists {
+		store.order = append(store.order, event.Ref)
+	}
+	store.events[event.Ref] = event
+
+	if len(store.order) > store.limit {
+		delete(store.events, store.order[0])
+		store.order = store.order[1:]
+	}
+	return nil
+}
+
+func (store *MemoryStore) Get(_ context.Context, ref string) (Event, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	event, ok := store.events[strings.ToUpper(ref)]
+	return event, ok, nil
+}
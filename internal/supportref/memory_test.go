@@ -0,0 +1,29 @@
+package supportref
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryStoreKeepsTheLastEvents(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2)
+
+	for _, ref := range []string{"0000000A", "0000000B", "0000000C"} {
+		if err := store.Record(ctx, Event{Ref: ref, Status: 500}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, found, _ := store.Get(ctx, "0000000A"); found {
+		t.Error("the oldest event is still kept past the limit")
+	}
+	// users read references out in any case
+	event, found, err := store.Get(ctx, "0000000c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || event.Ref != "0000000C" {
+		t.Errorf("Get = %v, %v, want the event of 0000000C", event, found)
+	}
+}
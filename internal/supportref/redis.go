@@ -0,0 +1,47 @@
+package supportref
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore keeps each event in a JSON encoded key shared by every instance, it expires
+// ttl after the request failed
+type RedisStore struct {
+	rdb    *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func NewRedisStore(rdb *redis.Client, prefix string, ttl time.Duration) *RedisStore {
+	return &RedisStore{rdb: rdb, prefix: prefix, ttl: ttl}
+}
+
+func (store *RedisStore) Record(ctx context.Context, event Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return store.rdb.Set(ctx, store.prefix+event.Ref, value, store.ttl).Err()
+}
+
+func (store *RedisStore) Get(ctx context.Context, ref string) (Event, bool, error) {
+	value, err := store.rdb.Get(ctx, store.prefix+strings.ToUpper(ref)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Event{}, false, nil
+	}
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	var event Event
+	if err := json.Unmarshal(value, &event); err != nil {
+		return Event{}, false, err
+	}
+	return event, true, nil
+}
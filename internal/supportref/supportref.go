@@ -0,0 +1,28 @@
+// Package supportref keeps the failed requests users quote a support reference for, so an
+// admin can look one up on any instance for a while after it failed.
+package supportref
+
+import (
+	"context"
+	"time"
+)
+
+// Event is a failed request, stored under the support reference of its response
+type Event struct {
+	Ref        string    `json:"ref"`
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error"`
+	UserID     int64     `json:"user_id,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Store keeps the recent events by reference. References are upper case hex, Get is
+// handed them as users typed them.
+type Store interface {
+	Record(ctx context.Context, event Event) error
+	// Get returns the event of ref, found is false when it is unknown or expired
+	Get(ctx context.Context, ref string) (event Event, found bool, err error)
+}
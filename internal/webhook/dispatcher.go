@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"godsendjoseph.dev/sandbox-api/internal/models"
+)
+
+const (
+	// pollInterval is how often the dispatcher looks for due deliveries
+	pollInterval = time.Second * 5
+	// batchSize caps the deliveries one poll sends, they are sent concurrently
+	batchSize = 20
+	// requestTimeout bounds one attempt, a slow receiver counts as a failure
+	requestTimeout = time.Second * 10
+	// leaseDuration is how long a claimed delivery stays with this instance before
+	// another one may pick it up, well above requestTimeout
+	leaseDuration = time.Minute
+	// responseLimit is how much of a failed response is kept as the error
+	responseLimit = 512
+)
+
+// Backoff is the wait after each failed attempt. A delivery still failing after the last
+// one is marked failed, seven attempts over roughly a day.
+var Backoff = []time.Duration{
+	time.Minute,
+	time.Minute * 5,
+	time.Minute * 30,
+	time.Hour * 2,
+	time.Hour * 6,
+	time.Hour * 12,
+}
+
+// DeliveryStore keeps the delivery queue, store.WebhookStore implements it
+type DeliveryStore interface {
+	Enqueue(ctx context.Context, event, eventID string, payload []byte) (int64, error)
+	ClaimDue(ctx context.Context, token string, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id int64, responseStatus int) error
+	MarkFailed(ctx context.Context, id int64, responseStatus *int, lastError string, retryIn time.Duration) error
+}
+
+// Envelope is the body of every delivery
+type Envelope struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Dispatcher queues events in the database and posts them to the subscribed webhooks.
+// The queue is shared, every instance can run a dispatcher and each delivery is sent by
+// whichever claims it.
+type Dispatcher struct {
+	store   DeliveryStore
+	client  *http.Client
+	logger  *zap.SugaredLogger
+	running bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+func NewDispatcher(store DeliveryStore, logger *zap.SugaredLogger) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		logger: logger,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// a redirect is answered like any other non 2xx response, the signed
+			// body is never forwarded to a host the webhook did not name
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Emit queues event with data for every webhook subscribed to it. Nothing is sent
+// inline, the request that caused the event does not wait for the partners.
+func (dispatcher *Dispatcher) Emit(ctx context.Context, event string, data any) error {
+	envelope := Envelope{
+		ID:        uuid.NewString(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	queued, err := dispatcher.store.Enqueue(ctx, event, envelope.ID, payload)
+	if err != nil {
+		return fmt.Errorf("queueing %s: %w", event, err)
+	}
+
+	if queued > 0 {
+		dispatcher.logger.Debugw("webhook event queued", "event", event, "eventID", envelope.ID, "deliveries", queued)
+	}
+
+	return nil
+}
+
+// Start polls for due deliveries until Stop is called
+func (dispatcher *Dispatcher) Start() {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+
+	if dispatcher.running {
+		return
+	}
+
+	dispatcher.running = true
+	dispatcher.stop = make(chan struct{})
+
+	dispatcher.wg.Add(1)
+	go dispatcher.loop()
+}
+
+// Stop ends polling and waits for the deliveries in flight
+func (dispatcher *Dispatcher) Stop() {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+
+	if !dispatcher.running {
+		return
+	}
+
+	dispatcher.running = false
+	close(dispatcher.stop)
+
+	dispatcher.wg.Wait()
+}
+
+func (dispatcher *Dispatcher) loop() {
+	defer dispatcher.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dispatcher.stop:
+			return
+		case <-ticker.C:
+			dispatcher.dispatchDue()
+		}
+	}
+}
+
+// dispatchDue claims a batch of due deliveries and sends them
+func (dispatcher *Dispatcher) dispatchDue() {
+	ctx := context.Background()
+
+	deliveries, err := dispatcher.store.ClaimDue(ctx, uuid.NewString(), batchSize, leaseDuration)
+	if err != nil {
+		dispatcher.logger.Errorw("failed to claim webhook deliveries", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			dispatcher.deliver(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// deliver makes one attempt and records its outcome, Attempts already counts it
+func (dispatcher *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	status, err := dispatcher.send(ctx, delivery)
+	if err == nil {
+		if err := dispatcher.store.MarkDelivered(ctx, delivery.ID, status); err != nil {
+			dispatcher.logger.Errorw("failed to record webhook delivery", "deliveryID", delivery.ID, "error", err)
+		}
+		return
+	}
+
+	var retryIn time.Duration
+	if delivery.Attempts <= len(Backoff) {
+		retryIn = Backoff[delivery.Attempts-1]
+	}
+
+	var responseStatus *int
+	if status != 0 {
+		responseStatus = &status
+	}
+
+	dispatcher.logger.Warnw("webhook delivery failed",
+		"deliveryID", delivery.ID,
+		"webhookID", delivery.WebhookID,
+		"event", delivery.Event,
+		"attempt", delivery.Attempts,
+		"retryIn", retryIn,
+		"error", err,
+	)
+
+	if err := dispatcher.store.MarkFailed(ctx, delivery.ID, responseStatus, err.Error(), retryIn); err != nil {
+		dispatcher.logger.Errorw("failed to record webhook failure", "deliveryID", delivery.ID, "error", err)
+	}
+}
+
+// send posts the signed payload, any response outside 2xx is an error. The status is 0
+// when no response came back.
+func (dispatcher *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "sandbox-api-webhooks/1")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(IDHeader, delivery.EventID)
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, responseLimit))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("receiver answered %d: %s", response.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return response.StatusCode, nil
+}
@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events partners can subscribe to
+const (
+	UserRegistered = "user.registered"
+	UserVerified   = "user.verified"
+	PostCreated    = "post.created"
+)
+
+// Events lists every event a webhook can subscribe to
+var Events = []string{UserRegistered, UserVerified, PostCreated}
+
+// Headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	IDHeader        = "X-Webhook-ID"
+)
+
+// SignatureTolerance is how old a signed timestamp Verify accepts, it keeps a captured
+// delivery from being replayed later
+const SignatureTolerance = time.Minute * 5
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("webhook signature timestamp is too old")
+)
+
+// IsEvent reports whether event is one of Events
+func IsEvent(event string) bool {
+	for _, known := range Events {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random signing secret for a new webhook
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp. The HMAC covers the
+// timestamp and the body joined with a dot, in the form t=<unix seconds>,v1=<hex>.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", unix, signature(secret, unix, body))
+}
+
+// Verify checks a SignatureHeader value the way a receiver should, it is what the
+// ReadMe points partners to
+func Verify(secret, header string, body []byte, now time.Time) error {
+	var unix, sent string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			sent = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || sent == "" {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(sent), []byte(signature(secret, unix, body))) {
+		return ErrInvalidSignature
+	}
+
+	if now.Sub(time.Unix(seconds, 0)) > SignatureTolerance {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
+
+func signature(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}